@@ -0,0 +1,336 @@
+package goque
+
+import "sync"
+
+// defaultAsyncBufferSize is the number of items EnqueueAsync buffers
+// unless SetAsyncBuffer says otherwise.
+const defaultAsyncBufferSize = 1024
+
+// asyncBuffer is the ring buffer holding the items of EnqueueAsync until
+// its writer adds them to the priority queue. Items are numbered in the
+// order they are buffered, and removed holds the number of items taken
+// or dropped from the front so far, so Flush can wait for every item
+// buffered before it.
+type asyncBuffer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []*PriorityItem
+	head    int
+	count   int
+	size    int
+	policy  OverflowPolicy
+	added   uint64
+	removed uint64
+	writing uint64
+	from    uint64
+	err     error
+	closed  bool
+}
+
+// newAsyncBuffer returns an empty buffer of the given size and overflow
+// policy.
+func newAsyncBuffer(size int, policy OverflowPolicy) *asyncBuffer {
+	b := &asyncBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	b.resize(size, policy)
+
+	return b
+}
+
+// resize changes the size and the overflow policy of the buffer, keeping
+// the items it holds even if there are more of them than fit. The caller
+// must hold the lock of the buffer.
+func (b *asyncBuffer) resize(size int, policy OverflowPolicy) {
+	if size <= 0 {
+		size = defaultAsyncBufferSize
+	}
+
+	n := size
+	if b.count > n {
+		n = b.count
+	}
+	items := make([]*PriorityItem, n)
+	for i := 0; i < b.count; i++ {
+		items[i] = b.items[(b.head+i)%len(b.items)]
+	}
+
+	b.items, b.head, b.size, b.policy = items, 0, size, policy
+	b.cond.Broadcast()
+}
+
+// add appends the given item to the buffer, applying the overflow policy
+// if it is full.
+func (b *asyncBuffer) add(item *PriorityItem) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for !b.closed && b.count >= b.size {
+		switch b.policy {
+		case OverflowBlock:
+			b.cond.Wait()
+			continue
+		case OverflowDropOldest:
+			b.items[b.head] = nil
+			b.head = (b.head + 1) % len(b.items)
+			b.count--
+			b.removed++
+			continue
+		}
+		return ErrFull
+	}
+
+	// If the buffer is closed.
+	if b.closed {
+		return ErrDBClosed
+	}
+
+	b.items[(b.head+b.count)%len(b.items)] = item
+	b.count++
+	b.added++
+	b.cond.Broadcast()
+
+	return nil
+}
+
+// take removes every item in the buffer and returns them, waiting for
+// items to be added if it is empty. It returns nil once the buffer is
+// closed and empty.
+func (b *asyncBuffer) take() []*PriorityItem {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.count == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.count == 0 {
+		return nil
+	}
+
+	items := make([]*PriorityItem, b.count)
+	for i := range items {
+		j := (b.head + i) % len(b.items)
+		items[i], b.items[j] = b.items[j], nil
+	}
+	b.from = b.removed
+	b.writing = uint64(len(items))
+	b.removed += b.writing
+	b.head, b.count = 0, 0
+	b.cond.Broadcast()
+
+	return items
+}
+
+// written records the errors of the items last taken, keeping the first
+// one for Flush.
+func (b *asyncBuffer) written(errs []error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, err := range errs {
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+	}
+	b.writing = 0
+	b.cond.Broadcast()
+}
+
+// settled returns the number of items from the start that were all
+// written or dropped. The caller must hold the lock of the buffer.
+func (b *asyncBuffer) settled() uint64 {
+	if b.writing > 0 {
+		return b.from
+	}
+	return b.removed
+}
+
+// flush waits until every item added so far was written or dropped,
+// then returns the first error the writer ran into since the last flush.
+func (b *asyncBuffer) flush() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for target := b.added; b.settled() < target; {
+		b.cond.Wait()
+	}
+	err := b.err
+	b.err = nil
+
+	return err
+}
+
+// close stops the buffer from taking new items, waking anything waiting
+// on it. Items already buffered are still written.
+func (b *asyncBuffer) close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// SetAsyncBuffer sets how many items EnqueueAsync holds before they are
+// written, and what it does when that many are waiting: OverflowBlock
+// waits for the writer to make space, OverflowError returns ErrFull,
+// and OverflowDropOldest discards the oldest item that wasn't written
+// yet. A size of 0 uses the default of 1024 items. Items already waiting
+// are kept. Without a call to SetAsyncBuffer, EnqueueAsync buffers 1024
+// items and blocks when they are all waiting.
+//
+// The buffer isn't persisted, so SetAsyncBuffer must be called after
+// every open.
+func (pq *PriorityQueue) SetAsyncBuffer(size int, policy OverflowPolicy) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return
+	}
+
+	if pq.async == nil {
+		pq.startAsync(newAsyncBuffer(size, policy))
+		return
+	}
+
+	pq.async.mu.Lock()
+	pq.async.resize(size, policy)
+	pq.async.mu.Unlock()
+}
+
+// EnqueueAsync adds the given item to a buffer in memory and returns,
+// leaving a background writer to add it to the priority queue along with
+// the other buffered items in a single batch. This gives up on knowing
+// the item was added, and on keeping it if the process exits first, for
+// more throughput. Errors of the writer are logged and returned by the
+// next Flush. The item must not be used until it was written, as the
+// writer sets its ID and key.
+//
+// Buffered items aren't counted by Length or dequeued until they are
+// written. Close writes every buffered item first.
+func (pq *PriorityQueue) EnqueueAsync(item *PriorityItem) error {
+	b, err := pq.asyncBuffer(item)
+	if err != nil {
+		return err
+	}
+
+	return b.add(item)
+}
+
+// EnqueueAsyncString is a helper function for EnqueueAsync that accepts
+// a priority level and a value as a string.
+func (pq *PriorityQueue) EnqueueAsyncString(priority uint8, value string) error {
+	return pq.EnqueueAsync(NewPriorityItemString(value, priority))
+}
+
+// asyncBuffer returns the buffer of EnqueueAsync, starting its writer if
+// needed, after making sure the given item fits the priority queue.
+func (pq *PriorityQueue) asyncBuffer(item *PriorityItem) (*asyncBuffer, error) {
+	pq.RLock()
+	b := pq.async
+	err := pq.bounds.checkValue(uint64(len(item.Value)))
+	if !pq.isOpen {
+		err = ErrDBClosed
+	}
+	pq.RUnlock()
+	if b != nil || err != nil {
+		return b, err
+	}
+
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue was closed meanwhile.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	if pq.async == nil {
+		pq.startAsync(newAsyncBuffer(defaultAsyncBufferSize, OverflowBlock))
+	}
+
+	return pq.async, nil
+}
+
+// startAsync sets the given buffer as the one of EnqueueAsync and starts
+// its writer. The caller must hold the lock.
+func (pq *PriorityQueue) startAsync(b *asyncBuffer) {
+	pq.async = b
+	pq.streams.Add(1)
+	go pq.runAsyncWriter(b)
+}
+
+// runAsyncWriter adds the items of the given buffer to the priority
+// queue in batches until the buffer is closed and empty.
+func (pq *PriorityQueue) runAsyncWriter(b *asyncBuffer) {
+	defer pq.streams.Done()
+
+	for {
+		items := b.take()
+		if items == nil {
+			return
+		}
+
+		errs := pq.commitGroup(items)
+		for _, err := range errs {
+			if err != nil {
+				pq.log.warn("goque: Failed to write buffered item", "dir", pq.DataDir, "error", err)
+			}
+		}
+		b.written(errs)
+	}
+}
+
+// Flush waits until every item EnqueueAsync added before the call was
+// written to the priority queue, or dropped by the overflow policy, and
+// returns the first error the background writer ran into since the last
+// Flush.
+func (pq *PriorityQueue) Flush() error {
+	pq.RLock()
+	b := pq.async
+	open := pq.isOpen
+	pq.RUnlock()
+
+	// If the priority queue is closed.
+	if !open {
+		return ErrDBClosed
+	}
+
+	return b.flush()
+}
+
+// closeAsync stops EnqueueAsync from buffering more items and waits for
+// the buffered ones to be written, returning the first error the writer
+// ran into since the last Flush.
+func (pq *PriorityQueue) closeAsync() error {
+	pq.RLock()
+	b := pq.async
+	pq.RUnlock()
+
+	b.close()
+	return b.flush()
+}
+
+// reopenAsync replaces the buffer of EnqueueAsync that closeAsync closed
+// with a new one of the same size and overflow policy, which the next
+// Flush returns the given error of. The caller must hold the lock.
+func (pq *PriorityQueue) reopenAsync(err error) {
+	b := pq.async
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	nb := newAsyncBuffer(b.size, b.policy)
+	b.mu.Unlock()
+
+	nb.err = err
+	pq.startAsync(nb)
+}
@@ -0,0 +1,171 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueEnqueueAsync(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetAsyncBuffer(16, OverflowBlock)
+	for i := 0; i < 100; i++ {
+		if err = pq.EnqueueAsyncString(uint8(i%2), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 100 {
+		t.Errorf("Expected queue length of 100, got %d", pq.Length())
+	}
+
+	// The items of each level are in the order they were buffered.
+	for i := 0; i < 100; i += 2 {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("value%d", i); item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+
+	// A value too large is rejected right away.
+	if err = pq.SetCapacity(Capacity{MaxValueSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, tooLarge := pq.EnqueueAsyncString(0, "much too large").(*ValueTooLargeError); !tooLarge {
+		t.Error("Expected a *ValueTooLargeError")
+	}
+}
+
+func TestPriorityQueueEnqueueAsyncErrors(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// The writer can only add one of the items, and Flush reports it.
+	if err = pq.SetCapacity(Capacity{MaxItems: 1, Policy: OverflowError}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = pq.EnqueueAsyncString(0, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.Flush(); err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+	if err = pq.Flush(); err != nil {
+		t.Errorf("Expected no error from the next Flush, got %v", err)
+	}
+}
+
+func TestPriorityQueueEnqueueAsyncClose(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 0; i < 10; i++ {
+		if err = pq.EnqueueAsyncString(0, fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close writes the buffered items.
+	if err = pq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.EnqueueAsyncString(0, "value"); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+	if err = pq.Flush(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", pq.Length())
+	}
+}
+
+func TestAsyncBufferOverflow(t *testing.T) {
+	// OverflowError rejects items while the buffer is full.
+	b := newAsyncBuffer(2, OverflowError)
+	for i := 0; i < 2; i++ {
+		if err := b.add(NewPriorityItemString(fmt.Sprintf("value%d", i), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.add(NewPriorityItemString("value", 0)); err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+	if items := b.take(); len(items) != 2 {
+		t.Errorf("Expected 2 items taken, got %d", len(items))
+	}
+	b.written(nil)
+
+	// OverflowDropOldest discards the oldest items.
+	b.mu.Lock()
+	b.resize(2, OverflowDropOldest)
+	b.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if err := b.add(NewPriorityItemString(fmt.Sprintf("value%d", i), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items := b.take()
+	if len(items) != 2 || items[0].ToString() != "value1" || items[1].ToString() != "value2" {
+		t.Errorf("Expected 'value1' and 'value2' to be kept, got %d items", len(items))
+	}
+	b.written(nil)
+	if err := b.flush(); err != nil {
+		t.Error(err)
+	}
+
+	// OverflowBlock waits for the items to be taken.
+	b.mu.Lock()
+	b.resize(1, OverflowBlock)
+	b.mu.Unlock()
+	if err := b.add(NewPriorityItemString("value", 0)); err != nil {
+		t.Fatal(err)
+	}
+	added := make(chan error)
+	go func() {
+		added <- b.add(NewPriorityItemString("value", 0))
+	}()
+	select {
+	case err := <-added:
+		t.Fatalf("Expected the add to wait for space, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.take()
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the buffer rejects new items.
+	b.close()
+	if err := b.add(NewPriorityItemString("value", 0)); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+}
@@ -0,0 +1,519 @@
+package goque
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// backupMagic starts every backup written by Backup.
+var backupMagic = []byte("goque-backup")
+
+// The versions of the backup format. Version 1 backups don't record the
+// layout version, and were all taken from data directories of layout 1.
+const (
+	backupV1 byte = 1
+	backupV2 byte = 2
+)
+
+// Restore writes the keys of a backup in batches of up to
+// defaultCopyBatchSize keys or restoreBatchBytes bytes.
+const restoreBatchBytes = 4 << 20
+
+// maxBackupField is the longest key or value Restore accepts, so a
+// corrupt length can't make it allocate an arbitrary amount of memory.
+const maxBackupField = 1 << 31
+
+// A backup holds a header followed by every key/value pair of the
+// store, and ends with a checksum:
+//
+//	magic + version + Goque type + format + layout
+//	(uvarint key length + key + uvarint value length + value) per key
+//	uvarint 0 + CRC-32 (IEEE) of everything before it, big endian
+//
+// Goque never stores an empty key, so a zero key length ends the keys.
+
+// Backup writes a backup of the priority queue to w, which Restore
+// turns back into a data directory. It streams the keys of a snapshot
+// of the store taken when the backup starts, so the priority queue can
+// be used in the meantime, but it must not be closed before Backup
+// returns. Items that are in flight are not included.
+//
+// If the store of the priority queue can't take snapshots,
+// ErrSnapshotUnsupported is returned.
+func (pq *PriorityQueue) Backup(w io.Writer) error {
+	pq.readLock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		pq.readUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := takeSnapshot(pq.db)
+	pq.readUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goquePriorityQueue, pq.format, snap)
+}
+
+// Backup writes a backup of the stack to w, the same way as
+// PriorityQueue.Backup.
+func (s *Stack) Backup(w io.Writer) error {
+	s.RLock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		s.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := takeSnapshot(s.db)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueStack, s.format, snap)
+}
+
+// Backup writes a backup of the queue to w, the same way as
+// PriorityQueue.Backup.
+func (q *Queue) Backup(w io.Writer) error {
+	q.RLock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := q.db.GetSnapshot()
+	q.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueQueue, q.format, snap)
+}
+
+// Backup writes a backup of the deque to w, the same way as
+// PriorityQueue.Backup.
+func (d *Deque) Backup(w io.Writer) error {
+	d.RLock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		d.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := d.db.GetSnapshot()
+	d.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueDeque, defaultFormat(goqueDeque), snap)
+}
+
+// Backup writes a backup of the prefix queue to w, the same way as
+// PriorityQueue.Backup.
+func (pq *PrefixQueue) Backup(w io.Writer) error {
+	pq.RLock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		pq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := pq.db.GetSnapshot()
+	pq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goquePrefixQueue, defaultFormat(goquePrefixQueue), snap)
+}
+
+// Backup writes a backup of the delay queue to w, the same way as
+// PriorityQueue.Backup.
+func (dq *DelayQueue) Backup(w io.Writer) error {
+	return dq.backup(w, goqueDelayQueue)
+}
+
+// Backup writes a backup of the retry queue to w, the same way as
+// PriorityQueue.Backup.
+func (rq *RetryQueue) Backup(w io.Writer) error {
+	return rq.dq.backup(w, goqueRetryQueue)
+}
+
+// Backup writes a backup of the unique queue to w, the same way as
+// PriorityQueue.Backup.
+func (uq *UniqueQueue) Backup(w io.Writer) error {
+	uq.RLock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		uq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := uq.db.GetSnapshot()
+	uq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueUniqueQueue, defaultFormat(goqueUniqueQueue), snap)
+}
+
+// Backup writes a backup of the topic to w, the same way as
+// PriorityQueue.Backup.
+func (t *Topic) Backup(w io.Writer) error {
+	t.RLock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		t.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := t.db.GetSnapshot()
+	t.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueTopic, defaultFormat(goqueTopic), snap)
+}
+
+// Backup writes a backup of the 64-bit priority queue to w, the same way
+// as PriorityQueue.Backup.
+func (pq *PriorityQueue64) Backup(w io.Writer) error {
+	return pq.backup(w, goquePriorityQueue64)
+}
+
+// Backup writes a backup of the deadline queue to w, the same way as
+// PriorityQueue.Backup.
+func (dq *DeadlineQueue) Backup(w io.Writer) error {
+	return dq.pq.backup(w, goqueDeadlineQueue)
+}
+
+// Backup writes a backup of the sorted queue to w, the same way as
+// PriorityQueue.Backup.
+func (sq *SortedQueue) Backup(w io.Writer) error {
+	sq.RLock()
+
+	// If the sorted queue is closed.
+	if !sq.isOpen {
+		sq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := sq.db.GetSnapshot()
+	sq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goqueSortedQueue, defaultFormat(goqueSortedQueue), snap)
+}
+
+// Backup writes a backup of the priority stack to w, the same way as
+// PriorityQueue.Backup.
+func (ps *PriorityStack) Backup(w io.Writer) error {
+	ps.RLock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		ps.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := ps.db.GetSnapshot()
+	ps.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, goquePriorityStack, defaultFormat(goquePriorityStack), snap)
+}
+
+// backup writes a backup of the 64-bit priority queue to w, recording
+// the given Goque type, as it may belong to a deadline queue.
+func (pq *PriorityQueue64) backup(w io.Writer, gt goqueType) error {
+	pq.RLock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		pq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := pq.db.GetSnapshot()
+	pq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, gt, defaultFormat(gt), snap)
+}
+
+// backup writes a backup of the delay queue to w, recording the given
+// Goque type, as the delay queue may belong to a retry queue.
+func (dq *DelayQueue) backup(w io.Writer, gt goqueType) error {
+	dq.RLock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		dq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := dq.db.GetSnapshot()
+	dq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, gt, defaultFormat(gt), snap)
+}
+
+// writeBackup writes every key of the snapshot to w as a backup of a
+// data structure of the given Goque type and format.
+func writeBackup(w io.Writer, gt goqueType, format uint8, snap StoreSnapshot) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	header := append(append([]byte{}, backupMagic...), backupV2, byte(gt), format, currentLayout())
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for iter.Next() {
+		for _, field := range [][]byte{iter.Key(), iter.Value()} {
+			n := binary.PutUvarint(buf, uint64(len(field)))
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			if _, err := out.Write(field); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// End the keys and append the checksum.
+	if _, err := out.Write([]byte{0}); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf, crc.Sum32())
+	if _, err := bw.Write(buf[:4]); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Restore creates a data directory at dataDir from a backup written by
+// Backup, read from r. The data directory can then be opened by the
+// data structure the backup was taken from, whose type DataDirType
+// returns.
+//
+// dataDir must not exist or be empty, or ErrDataDirExists is returned.
+// If the backup is invalid or truncated, ErrInvalidBackup is returned
+// and the data directory is removed again. The 'GOQUE' file is only
+// written once the whole backup was restored and its checksum matched,
+// so a failed restore can't be opened by mistake.
+func Restore(r io.Reader, dataDir string) (err error) {
+	// Make sure the data directory is empty.
+	entries, err := ioutil.ReadDir(dataDir)
+	if err == nil && len(entries) > 0 {
+		return ErrDataDirExists
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.RemoveAll(dataDir)
+		}
+	}()
+
+	// Write the keys in batches.
+	batch := new(leveldb.Batch)
+	var size int
+	marker, err := readBackup(r, func(key, value []byte) error {
+		batch.Put(key, value)
+		size += len(key) + len(value)
+		if batch.Len() < defaultCopyBatchSize && size < restoreBatchBytes {
+			return nil
+		}
+
+		err := db.Write(batch, nil)
+		batch.Reset()
+		size = 0
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dataDir, "GOQUE"), marker, 0644)
+}
+
+// VerifyBackup reads a backup written by Backup from r, without
+// restoring it, and returns ErrInvalidBackup if it is invalid,
+// truncated or doesn't match its checksum.
+func VerifyBackup(r io.Reader) error {
+	_, err := readBackup(r, func(key, value []byte) error { return nil })
+	return err
+}
+
+// readBackup reads a backup from r, calling put with every key and
+// value in it, and checks its checksum. It returns the contents of the
+// 'GOQUE' file of the data directory the backup was taken from.
+func readBackup(r io.Reader, put func(key, value []byte) error) ([]byte, error) {
+	br := &backupReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	// Read the header, adding the layout version to the one of a version
+	// 1 backup.
+	header := make([]byte, len(backupMagic)+3, len(backupMagic)+4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, invalidBackup(err)
+	}
+	if !bytes.Equal(header[:len(backupMagic)], backupMagic) || int(header[len(backupMagic)+1]) >= len(typeNames) {
+		return nil, ErrInvalidBackup
+	}
+	switch header[len(backupMagic)] {
+	case backupV1:
+		header = append(header, 1)
+	case backupV2:
+		header = header[:len(header)+1]
+		if _, err := io.ReadFull(br, header[len(header)-1:]); err != nil {
+			return nil, invalidBackup(err)
+		}
+	default:
+		return nil, ErrInvalidBackup
+	}
+
+	// Read the keys until the zero key length ending them.
+	for {
+		key, err := br.readField()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			break
+		}
+
+		value, err := br.readField()
+		if err != nil {
+			return nil, err
+		}
+		if err = put(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the checksum of everything read so far.
+	sum := br.crc.Sum32()
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(br.r, trailer); err != nil {
+		return nil, invalidBackup(err)
+	}
+	if binary.BigEndian.Uint32(trailer) != sum {
+		return nil, ErrInvalidBackup
+	}
+
+	return header[len(backupMagic)+1:], nil
+}
+
+// backupReader reads a backup, updating the checksum with every byte
+// read through it.
+type backupReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (br *backupReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.crc.Write(p[:n])
+	return n, err
+}
+
+func (br *backupReader) ReadByte() (byte, error) {
+	b, err := br.r.ReadByte()
+	if err == nil {
+		br.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// readField reads a length-prefixed key or value.
+func (br *backupReader) readField() ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, invalidBackup(err)
+	}
+	if n > maxBackupField {
+		return nil, ErrInvalidBackup
+	}
+
+	field := make([]byte, n)
+	if _, err = io.ReadFull(br, field); err != nil {
+		return nil, invalidBackup(err)
+	}
+
+	return field, nil
+}
+
+// invalidBackup returns ErrInvalidBackup for a backup that ended early,
+// and any other error as is.
+func invalidBackup(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidBackup
+	}
+
+	return err
+}
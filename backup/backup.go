@@ -0,0 +1,220 @@
+// Package backup periodically takes backups of an open Goque data
+// structure and uploads them to an object store, keeping the last few.
+package backup
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// Source is a data structure that can write a backup of itself, such
+// as a *goque.PriorityQueue or *goque.Queue. Every Goque data structure
+// implements it.
+type Source interface {
+	Backup(w io.Writer) error
+}
+
+// Uploader stores backups as named objects in an object store.
+type Uploader interface {
+	// Upload stores the data read from r as the named object.
+	Upload(ctx context.Context, name string, r io.Reader) error
+
+	// List returns the names of the objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete deletes the named object.
+	Delete(ctx context.Context, name string) error
+}
+
+// Options configures a Scheduler.
+type Options struct {
+	// Interval is the time between two backups. Defaults to an hour.
+	Interval time.Duration
+
+	// Prefix is prepended to the name of every backup, such as
+	// "jobs/". Backups are named after the time they were taken, so
+	// names sort by age.
+	Prefix string
+
+	// Keep, if set, is the number of backups kept. Older backups
+	// starting with Prefix are deleted after each upload.
+	Keep int
+
+	// Logger, if set, receives the uploads and failures of the
+	// backups taken in the background.
+	Logger goque.Logger
+}
+
+// The layout and extension of backup names, following Prefix.
+const (
+	nameLayout = "20060102T150405.000000000Z"
+	nameExt    = ".goque"
+)
+
+// Scheduler takes backups of a source and uploads them.
+type Scheduler struct {
+	src  Source
+	up   Uploader
+	opts Options
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// New returns a Scheduler uploading backups of src with up. Backups are
+// only taken in the background once Start is called.
+func New(src Source, up Uploader, opts Options) *Scheduler {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+
+	return &Scheduler{src: src, up: up, opts: opts}
+}
+
+// Start starts a background goroutine taking a backup every Interval,
+// the first one right away. Calling Start again while it runs does
+// nothing.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.stopped = make(chan struct{})
+	go s.run(ctx, s.stopped)
+}
+
+// Stop stops the background goroutine, cancelling the upload in
+// progress, if any, and waits for it to return. The source must not be
+// closed before Stop returns.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.stopped
+	s.cancel = nil
+}
+
+// run takes a backup every Interval until the context is cancelled.
+func (s *Scheduler) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		name, err := s.Snapshot(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.warn("goque: Backup failed", "error", err)
+		} else if err == nil {
+			s.info("goque: Uploaded a backup", "name", name, "duration", time.Since(start))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Snapshot takes a backup of the source right away and uploads it,
+// streaming it to the uploader as it is written, then deletes the
+// backups exceeding Keep. It returns the name of the backup, which is
+// set even if deleting older backups failed.
+func (s *Scheduler) Snapshot(ctx context.Context) (string, error) {
+	name := s.opts.Prefix + time.Now().UTC().Format(nameLayout) + nameExt
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := s.src.Backup(pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	err := s.up.Upload(ctx, name, pr)
+
+	// Stop the backup if the upload returned before reading all of it.
+	// The backup only fails with io.ErrClosedPipe then, so that error
+	// is returned if the upload didn't fail.
+	pr.Close()
+	if berr := <-errc; berr != nil && (berr != io.ErrClosedPipe || err == nil) {
+		return "", berr
+	} else if err != nil {
+		return "", err
+	}
+
+	return name, s.prune(ctx)
+}
+
+// prune deletes the oldest backups starting with Prefix, keeping Keep
+// of them.
+func (s *Scheduler) prune(ctx context.Context) error {
+	if s.opts.Keep <= 0 {
+		return nil
+	}
+
+	names, err := s.up.List(ctx, s.opts.Prefix)
+	if err != nil {
+		return err
+	}
+
+	// Only consider the objects named like backups, oldest first.
+	var backups []string
+	for _, name := range names {
+		if _, ok := backupTime(s.opts.Prefix, name); ok {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+
+	for len(backups) > s.opts.Keep {
+		if err = s.up.Delete(ctx, backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// backupTime returns the time the named backup was taken, and false if
+// the name isn't that of a backup starting with prefix.
+func backupTime(prefix, name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, nameExt) {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(nameLayout, strings.TrimSuffix(name[len(prefix):], nameExt))
+	return t, err == nil
+}
+
+func (s *Scheduler) info(msg string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Info(msg, args...)
+	}
+}
+
+func (s *Scheduler) warn(msg string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Warn(msg, args...)
+	}
+}
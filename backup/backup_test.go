@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// memUploader is an Uploader keeping the objects in memory.
+type memUploader struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemUploader() *memUploader {
+	return &memUploader{objects: make(map[string][]byte)}
+}
+
+func (u *memUploader) Upload(ctx context.Context, name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.objects[name] = data
+	return nil
+}
+
+func (u *memUploader) List(ctx context.Context, prefix string) ([]string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var names []string
+	for name := range u.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (u *memUploader) Delete(ctx context.Context, name string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.objects, name)
+	return nil
+}
+
+func (u *memUploader) len() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.objects)
+}
+
+func TestSnapshot(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(goque.NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	up := newMemUploader()
+	up.objects["jobs/other"] = []byte("not a backup")
+	s := New(pq, up, Options{Prefix: "jobs/", Keep: 2})
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name, err := s.Snapshot(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		names = append(names, name)
+	}
+
+	// The oldest backup is deleted, other objects are left alone.
+	if up.len() != 3 {
+		t.Errorf("Expected 3 objects, got %d", up.len())
+	}
+	if _, ok := up.objects[names[0]]; ok {
+		t.Errorf("Expected backup %s to be deleted", names[0])
+	}
+	if _, ok := up.objects["jobs/other"]; !ok {
+		t.Error("Expected jobs/other to be kept")
+	}
+
+	// The latest backup restores the priority queue.
+	if err = goque.Restore(bytes.NewReader(up.objects[names[2]]), file+"_restore"); err != nil {
+		t.Error(err)
+	}
+	dst, err := goque.OpenPriorityQueue(file+"_restore", goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	if dst.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", dst.Length())
+	}
+}
+
+func TestSnapshotClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	q.Close()
+
+	up := newMemUploader()
+	if _, err = New(q, up, Options{}).Snapshot(context.Background()); err != goque.ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+// failUploader is an Uploader whose uploads fail after reading a few
+// bytes.
+type failUploader struct {
+	*memUploader
+}
+
+var errUpload = errors.New("upload failed")
+
+func (u failUploader) Upload(ctx context.Context, name string, r io.Reader) error {
+	if _, err := r.Read(make([]byte, 4)); err != nil {
+		return err
+	}
+	return errUpload
+}
+
+func TestSnapshotUploadFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	up := failUploader{newMemUploader()}
+	if _, err = New(q, up, Options{}).Snapshot(context.Background()); err != errUpload {
+		t.Errorf("Expected to get upload error, got %v", err)
+	}
+}
+
+func TestSchedulerStartStop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	up := newMemUploader()
+	sched := New(s, up, Options{Interval: 10 * time.Millisecond, Keep: 2})
+	sched.Start()
+	sched.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for up.len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	sched.Stop()
+	sched.Stop()
+
+	if up.len() != 2 {
+		t.Errorf("Expected 2 backups, got %d", up.len())
+	}
+
+	// No backup is taken once stopped.
+	up.objects = make(map[string][]byte)
+	time.Sleep(30 * time.Millisecond)
+	if up.len() != 0 {
+		t.Errorf("Expected no backup, got %d", up.len())
+	}
+}
+
+func TestBackupTime(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	name := "jobs/" + at.Format(nameLayout) + nameExt
+
+	if got, ok := backupTime("jobs/", name); !ok || !got.Equal(at) {
+		t.Errorf("Expected %v, got %v and %v", at, got, ok)
+	}
+	for _, name := range []string{"other/" + at.Format(nameLayout) + nameExt, "jobs/latest" + nameExt, "jobs/" + at.Format(nameLayout)} {
+		if _, ok := backupTime("jobs/", name); ok {
+			t.Errorf("Expected %s not to be a backup", name)
+		}
+	}
+}
+
+func (u *memUploader) Download(ctx context.Context, name string) (io.ReadCloser, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	data, ok := u.objects[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,70 @@
+// Package gcsuploader provides a backup.Uploader storing backups in a
+// Google Cloud Storage bucket, which is also a backup.Downloader reading
+// them back.
+package gcsuploader
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Uploader is a backup.Uploader storing backups as objects of a Cloud
+// Storage bucket.
+type Uploader struct {
+	bucket *storage.BucketHandle
+}
+
+// New returns an Uploader storing backups in the given bucket, such as
+// client.Bucket("name").
+func New(bucket *storage.BucketHandle) *Uploader {
+	return &Uploader{bucket: bucket}
+}
+
+// Upload stores the data read from r as the named object. A failed
+// upload doesn't leave a partial object behind.
+func (u *Uploader) Upload(ctx context.Context, name string, r io.Reader) error {
+	// Cancelling the context aborts the upload.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := u.bucket.Object(name).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// List returns the names of the objects starting with prefix.
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := u.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		names = append(names, attrs.Name)
+	}
+
+	return names, nil
+}
+
+// Download returns a reader for the named object, which must be closed
+// once read.
+func (u *Uploader) Download(ctx context.Context, name string) (io.ReadCloser, error) {
+	return u.bucket.Object(name).NewReader(ctx)
+}
+
+// Delete deletes the named object.
+func (u *Uploader) Delete(ctx context.Context, name string) error {
+	return u.bucket.Object(name).Delete(ctx)
+}
@@ -0,0 +1,139 @@
+package gcsuploader
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// fakeServer serves the parts of the Cloud Storage JSON API the
+// Uploader uses, keeping the objects in memory.
+type fakeServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/bucket/o"):
+		// A multipart upload holds the metadata, then the content.
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+
+		var attrs struct {
+			Name string `json:"name"`
+		}
+		part, err := mr.NextPart()
+		if err == nil {
+			err = json.NewDecoder(part).Decode(&attrs)
+		}
+		if err == nil {
+			part, err = mr.NextPart()
+		}
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadAll(part)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.objects[attrs.Name] = data
+		json.NewEncoder(w).Encode(map[string]string{"bucket": "bucket", "name": attrs.Name})
+
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/bucket/o":
+		var names []string
+		for name := range s.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		items := []map[string]string{}
+		for _, name := range names {
+			items = append(items, map[string]string{"bucket": "bucket", "name": name})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+		delete(s.objects, strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet:
+		// Objects are read through the XML API.
+		data, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+
+	default:
+		http.Error(w, "unexpected request", http.StatusNotImplemented)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	fake := &fakeServer{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	u := New(client.Bucket("bucket"))
+	for _, name := range []string{"jobs/1", "jobs/2", "other/1"} {
+		if err = u.Upload(ctx, name, strings.NewReader("backup of "+name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if string(fake.objects["jobs/2"]) != "backup of jobs/2" {
+		t.Errorf("Expected 'backup of jobs/2', got '%s'", fake.objects["jobs/2"])
+	}
+
+	r, err := u.Download(ctx, "jobs/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "backup of jobs/2" {
+		t.Errorf("Expected 'backup of jobs/2', got '%s' and %v", data, err)
+	}
+
+	if err = u.Delete(ctx, "jobs/1"); err != nil {
+		t.Error(err)
+	}
+
+	names, err := u.List(ctx, "jobs/")
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(names, ",") != "jobs/2" {
+		t.Errorf("Expected 'jobs/2', got '%s'", strings.Join(names, ","))
+	}
+}
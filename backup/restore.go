@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+var (
+	// ErrNoBackup is returned when restoring to a point in time no
+	// backup was taken at or before.
+	ErrNoBackup = errors.New("backup: No backup was taken at or before the given time")
+
+	// ErrTypeMismatch is returned when a restored data directory
+	// doesn't belong to the expected type of data structure.
+	ErrTypeMismatch = errors.New("backup: Restored data directory has a different type")
+)
+
+// Downloader reads back the backups stored by an Uploader.
+type Downloader interface {
+	// List returns the names of the objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Download returns a reader for the named object, which must be
+	// closed once read.
+	Download(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// Entry is a backup in the catalog returned by List.
+type Entry struct {
+	Name string    // The name of the backup.
+	Time time.Time // The time the backup was taken.
+}
+
+// List returns the catalog of the backups starting with prefix, oldest
+// first. Other objects starting with prefix are left out.
+func List(ctx context.Context, d Downloader, prefix string) ([]Entry, error) {
+	names, err := d.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, name := range names {
+		if t, ok := backupTime(prefix, name); ok {
+			entries = append(entries, Entry{Name: name, Time: t})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// Verify downloads the named backup and checks that it is complete and
+// matches its checksum, returning goque.ErrInvalidBackup otherwise.
+func Verify(ctx context.Context, d Downloader, name string) error {
+	r, err := d.Download(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return goque.VerifyBackup(r)
+}
+
+// Restore downloads the named backup and rebuilds the data directory at
+// dataDir from it with goque.Restore, which checks its checksum. If typ
+// is set, the restored data directory must belong to that type of data
+// structure, as named by goque.DataDirType, such as "priority queue".
+// Otherwise ErrTypeMismatch is returned and the data directory is
+// removed again.
+func Restore(ctx context.Context, d Downloader, name, dataDir, typ string) error {
+	r, err := d.Download(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = goque.Restore(r, dataDir); err != nil {
+		return err
+	}
+
+	// Check the type marker of the restored data directory.
+	got, err := goque.DataDirType(dataDir)
+	if err == nil && typ != "" && got != typ {
+		err = ErrTypeMismatch
+	}
+	if err != nil {
+		os.RemoveAll(dataDir)
+	}
+
+	return err
+}
+
+// RestoreAt rebuilds the data directory at dataDir from the latest
+// backup starting with prefix taken at or before the given time, the
+// same way as Restore, and returns it. If there is no such backup,
+// ErrNoBackup is returned.
+func RestoreAt(ctx context.Context, d Downloader, prefix string, at time.Time, dataDir, typ string) (Entry, error) {
+	entries, err := List(ctx, d, prefix)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// Find the last backup that isn't after the given time.
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Time.After(at)
+	})
+	if i == 0 {
+		return Entry{}, ErrNoBackup
+	}
+
+	entry := entries[i-1]
+	return entry, Restore(ctx, d, entry.Name, dataDir, typ)
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+func TestRestoreAt(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	// Take a backup after each item.
+	up := newMemUploader()
+	s := New(q, up, Options{Prefix: "jobs/"})
+	var times []time.Time
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+		if _, err = s.Snapshot(context.Background()); err != nil {
+			t.Error(err)
+		}
+		times = append(times, time.Now())
+	}
+	up.objects["jobs/other"] = []byte("not a backup")
+
+	ctx := context.Background()
+	entries, err := List(ctx, up, "jobs/")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 backups, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if err = Verify(ctx, up, e.Name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Restore the backup taken after the second item.
+	entry, err := RestoreAt(ctx, up, "jobs/", times[1], file+"_restore", "queue")
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file + "_restore")
+
+	if entry != entries[1] {
+		t.Errorf("Expected backup %s, got %s", entries[1].Name, entry.Name)
+	}
+	dst, err := goque.OpenQueue(file + "_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if dst.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", dst.Length())
+	}
+
+	// No backup was taken before the first one.
+	if _, err = RestoreAt(ctx, up, "jobs/", entries[0].Time.Add(-time.Nanosecond), file+"_none", ""); err != ErrNoBackup {
+		t.Errorf("Expected to get no backup error, got %v", err)
+	}
+}
+
+func TestRestoreTypeMismatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	up := newMemUploader()
+	name, err := New(s, up, Options{}).Snapshot(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+
+	ctx := context.Background()
+	if err = Restore(ctx, up, name, file+"_restore", "priority queue"); err != ErrTypeMismatch {
+		t.Errorf("Expected to get type mismatch error, got %v", err)
+	}
+	if _, err = os.Stat(file + "_restore"); !os.IsNotExist(err) {
+		t.Errorf("Expected the data directory to be removed, got %v", err)
+	}
+
+	// A corrupt backup fails its checksum.
+	up.objects[name][len(up.objects[name])-1]++
+	if err = Verify(ctx, up, name); err != goque.ErrInvalidBackup {
+		t.Errorf("Expected to get invalid backup error, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Package s3uploader provides a backup.Uploader storing backups in an
+// Amazon S3 bucket, which is also a backup.Downloader reading them back.
+package s3uploader
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Client is the subset of the S3 API the Uploader uses, which an
+// *s3.Client implements.
+type Client interface {
+	manager.UploadAPIClient
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Uploader is a backup.Uploader storing backups as objects of an S3
+// bucket.
+type Uploader struct {
+	client Client
+	bucket string
+	up     *manager.Uploader
+}
+
+// New returns an Uploader storing backups in the given bucket. Backups
+// are streamed in multipart uploads, so their size doesn't need to be
+// known in advance.
+func New(client Client, bucket string) *Uploader {
+	return &Uploader{client: client, bucket: bucket, up: manager.NewUploader(client)}
+}
+
+// Upload stores the data read from r as the named object.
+func (u *Uploader) Upload(ctx context.Context, name string, r io.Reader) error {
+	_, err := u.up.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(name),
+		Body:   r,
+	})
+	return err
+}
+
+// List returns the names of the objects starting with prefix.
+func (u *Uploader) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	p := s3.NewListObjectsV2Paginator(u.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(u.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			names = append(names, aws.ToString(obj.Key))
+		}
+	}
+
+	return names, nil
+}
+
+// Download returns a reader for the named object, which must be closed
+// once read.
+func (u *Uploader) Download(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := u.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
+
+// Delete deletes the named object.
+func (u *Uploader) Delete(ctx context.Context, name string) error {
+	_, err := u.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
@@ -0,0 +1,119 @@
+package s3uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var errMultipart = errors.New("multipart uploads are not supported")
+
+// fakeClient is a Client keeping the objects of a single bucket in
+// memory. Values smaller than a part are uploaded with PutObject.
+type fakeClient struct {
+	objects map[string][]byte
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errMultipart
+}
+
+func (c *fakeClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+func (c *fakeClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+func (c *fakeClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+// ListObjectsV2 returns one object per page, to exercise paging.
+func (c *fakeClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{}
+	if len(keys) > 0 {
+		out.Contents = []types.Object{{Key: aws.String(keys[0])}}
+	}
+	if len(keys) > 1 {
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(keys[0])
+	}
+	return out, nil
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (c *fakeClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(c.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestUploader(t *testing.T) {
+	client := &fakeClient{objects: make(map[string][]byte)}
+	u := New(client, "bucket")
+	ctx := context.Background()
+
+	for _, name := range []string{"jobs/1", "jobs/2", "other/1"} {
+		if err := u.Upload(ctx, name, strings.NewReader("backup of "+name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if string(client.objects["jobs/2"]) != "backup of jobs/2" {
+		t.Errorf("Expected 'backup of jobs/2', got '%s'", client.objects["jobs/2"])
+	}
+
+	r, err := u.Download(ctx, "jobs/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "backup of jobs/2" {
+		t.Errorf("Expected 'backup of jobs/2', got '%s' and %v", data, err)
+	}
+
+	if err = u.Delete(ctx, "jobs/1"); err != nil {
+		t.Error(err)
+	}
+
+	names, err := u.List(ctx, "")
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(names, ",") != "jobs/2,other/1" {
+		t.Errorf("Expected 'jobs/2,other/1', got '%s'", strings.Join(names, ","))
+	}
+}
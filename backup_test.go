@@ -0,0 +1,289 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%3))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// Items added after the backup started are not in it.
+	if err = pq.Enqueue(NewPriorityItemString("value for item 11", 0)); err != nil {
+		t.Error(err)
+	}
+
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Error(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "priority queue" {
+		t.Errorf("Expected type 'priority queue', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenPriorityQueue(file+"_restore", ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if dst.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", dst.Length())
+	}
+	for _, want := range []string{"value for item 6", "value for item 9", "value for item 1"} {
+		item, err := dst.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestStackBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = s.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Error(err)
+	}
+
+	dst, err := OpenStack(file + "_restore")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", item.ToString())
+	}
+}
+
+func TestRetryQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := OpenRetryQueue(file, RetryOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.ForceDrop()
+
+	if _, err = rq.EnqueueString("value"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = rq.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Error(err)
+	}
+
+	// The backup keeps the type of the retry queue.
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "retry queue" {
+		t.Errorf("Expected type 'retry queue', got '%s' and %v", typ, err)
+	}
+	dst, err := OpenRetryQueue(file+"_restore", RetryOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+	data := buf.Bytes()
+
+	// A non-empty data directory is refused.
+	if err = Restore(bytes.NewReader(data), file); err != ErrDataDirExists {
+		t.Errorf("Expected to get data directory exists error, got %v", err)
+	}
+
+	// A truncated backup, or one with a byte changed, is removed again.
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)-10]++
+	for _, b := range [][]byte{data[:len(data)-1], corrupt, []byte("not a backup")} {
+		if err = Restore(bytes.NewReader(b), file+"_restore"); err != ErrInvalidBackup {
+			t.Errorf("Expected to get invalid backup error, got %v", err)
+		}
+		if _, err = os.Stat(file + "_restore"); !os.IsNotExist(err) {
+			t.Errorf("Expected the data directory to be removed, got %v", err)
+			os.RemoveAll(file + "_restore")
+		}
+	}
+}
+
+func TestBackupClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	d.Close()
+
+	if err = d.Backup(new(bytes.Buffer)); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	// Enough items to restore them in more than one batch.
+	for i := 1; i <= defaultCopyBatchSize+10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+	if err = VerifyBackup(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Error(err)
+	}
+	if err = VerifyBackup(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err != ErrInvalidBackup {
+		t.Errorf("Expected to get invalid backup error, got %v", err)
+	}
+
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Error(err)
+	}
+	dst, err := OpenQueue(file + "_restore")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if dst.Length() != defaultCopyBatchSize+10 {
+		t.Errorf("Expected queue length of %d, got %d", defaultCopyBatchSize+10, dst.Length())
+	}
+}
+
+func TestRestoreV1Backup(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// Turn it into a version 1 backup, without the layout version.
+	b := buf.Bytes()
+	v1 := append([]byte{}, b[:len(backupMagic)+3]...)
+	v1[len(backupMagic)] = backupV1
+	v1 = append(v1, b[len(backupMagic)+4:len(b)-4]...)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(v1))
+	v1 = append(v1, sum[:]...)
+
+	if err = Restore(bytes.NewReader(v1), file+"_restore"); err != nil {
+		t.Error(err)
+	}
+	marker, err := ioutil.ReadFile(filepath.Join(file+"_restore", "GOQUE"))
+	if err != nil {
+		t.Error(err)
+	}
+	if want := []byte{byte(goqueQueue), formatEnvelope, 1}; !bytes.Equal(marker, want) {
+		t.Errorf("Expected 'GOQUE' file %v, got %v", want, marker)
+	}
+
+	dst, err := OpenQueue(file + "_restore")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", item.ToString())
+	}
+}
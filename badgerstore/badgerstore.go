@@ -0,0 +1,379 @@
+// Package badgerstore provides a goque.Store using BadgerDB, whose value
+// log keeps large values out of the LSM tree.
+package badgerstore
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store is a goque.Store using BadgerDB.
+type Store struct {
+	db *badger.DB
+}
+
+// Open opens the BadgerDB database at the given directory, creating it
+// if it does not exist, using the default options without logging.
+func Open(dir string) (*Store, error) {
+	return OpenWithOptions(badger.DefaultOptions(dir).WithLogger(nil))
+}
+
+// OpenWithOptions opens a BadgerDB database using the given options.
+func OpenWithOptions(o badger.Options) (*Store, error) {
+	db, err := badger.Open(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(db), nil
+}
+
+// New returns a Store using the given BadgerDB database.
+func New(db *badger.DB) *Store {
+	return &Store{db: db}
+}
+
+// DB returns the underlying BadgerDB database.
+func (s *Store) DB() *badger.DB {
+	return s.db
+}
+
+// Get returns the value for the given key, or leveldb.ErrNotFound if
+// the key does not exist.
+func (s *Store) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return leveldb.ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+
+	return value, err
+}
+
+// MultiGet returns the values for the given keys, read in a single
+// transaction, with nil for any key that does not exist.
+func (s *Store) MultiGet(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	err := s.db.View(func(txn *badger.Txn) error {
+		for i, key := range keys {
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = item.Value(func(v []byte) error {
+				values[i] = append([]byte{}, v...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Put sets the value for the given key.
+func (s *Store) Put(key, value []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, value)
+	return s.Write(batch, wo)
+}
+
+// Delete deletes the value for the given key.
+func (s *Store) Delete(key []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return s.Write(batch, wo)
+}
+
+// Write applies the given batch in a single transaction.
+func (s *Store) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		r := &replay{txn: txn}
+		if err := batch.Replay(r); err != nil {
+			return err
+		}
+		return r.err
+	})
+	if err != nil {
+		return err
+	}
+
+	if wo.GetSync() {
+		return s.db.Sync()
+	}
+
+	return nil
+}
+
+// NewIterator returns an iterator over a snapshot of the keys in the
+// given range. A nil range iterates over every key.
+func (s *Store) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	it := &iter{txn: s.db.NewTransaction(false)}
+	if slice != nil {
+		it.start = slice.Start
+		it.limit = slice.Limit
+	}
+
+	return it
+}
+
+// Close closes the BadgerDB database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// replay applies the operations of a LevelDB batch to a transaction,
+// keeping the first error.
+type replay struct {
+	txn *badger.Txn
+	err error
+}
+
+func (r *replay) Put(key, value []byte) {
+	if r.err == nil {
+		r.err = r.txn.Set(key, value)
+	}
+}
+
+func (r *replay) Delete(key []byte) {
+	if r.err == nil {
+		r.err = r.txn.Delete(key)
+	}
+}
+
+// The positions of an iterator that is not on a key.
+const (
+	posStart = iota // Before the first key.
+	posKey          // On a key.
+	posEnd          // After the last key.
+)
+
+// iter is a LevelDB iterator over a read-only BadgerDB transaction.
+// BadgerDB iterators only go one way, so a forward and a reverse one
+// are created as needed, and the iterator switches between them when
+// it changes direction.
+type iter struct {
+	util.BasicReleaser
+	txn          *badger.Txn
+	fwd, rev     *badger.Iterator
+	start, limit []byte
+	pos          int
+	key, value   []byte
+	err          error
+	released     bool
+}
+
+// forward returns the forward BadgerDB iterator.
+func (it *iter) forward() *badger.Iterator {
+	if it.fwd == nil {
+		it.fwd = it.txn.NewIterator(badger.DefaultIteratorOptions)
+	}
+	return it.fwd
+}
+
+// reverse returns the reverse BadgerDB iterator.
+func (it *iter) reverse() *badger.Iterator {
+	if it.rev == nil {
+		o := badger.DefaultIteratorOptions
+		o.Reverse = true
+		it.rev = it.txn.NewIterator(o)
+	}
+	return it.rev
+}
+
+// inRange reports whether the given key is within the range of the
+// iterator.
+func (it *iter) inRange(key []byte) bool {
+	return (it.start == nil || bytes.Compare(key, it.start) >= 0) &&
+		(it.limit == nil || bytes.Compare(key, it.limit) < 0)
+}
+
+// load positions the iterator on the current key of the given BadgerDB
+// iterator, or past the end in the given direction if there is none.
+func (it *iter) load(bi *badger.Iterator, end int) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if !bi.Valid() || !it.inRange(bi.Item().Key()) {
+		it.pos = end
+		it.key, it.value = nil, nil
+		return false
+	}
+
+	item := bi.Item()
+	it.key = item.KeyCopy(nil)
+	if it.value, it.err = item.ValueCopy(nil); it.err != nil {
+		it.pos = end
+		it.key, it.value = nil, nil
+		return false
+	}
+	it.pos = posKey
+
+	return true
+}
+
+// usable reports whether the iterator can be moved.
+func (it *iter) usable() bool {
+	if it.released {
+		it.err = leveldb.ErrIterReleased
+	}
+	return it.err == nil
+}
+
+func (it *iter) First() bool {
+	if !it.usable() {
+		return false
+	}
+
+	fwd := it.forward()
+	if it.start != nil {
+		fwd.Seek(it.start)
+	} else {
+		fwd.Rewind()
+	}
+
+	return it.load(fwd, posEnd)
+}
+
+func (it *iter) Last() bool {
+	if !it.usable() {
+		return false
+	}
+
+	rev := it.reverse()
+	if it.limit != nil {
+		rev.Seek(it.limit)
+		if rev.Valid() && bytes.Equal(rev.Item().Key(), it.limit) {
+			rev.Next()
+		}
+	} else {
+		rev.Rewind()
+	}
+
+	return it.load(rev, posStart)
+}
+
+func (it *iter) Seek(key []byte) bool {
+	if !it.usable() {
+		return false
+	}
+
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		key = it.start
+	}
+
+	fwd := it.forward()
+	fwd.Seek(key)
+
+	return it.load(fwd, posEnd)
+}
+
+func (it *iter) Next() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return it.First()
+	case posEnd:
+		return false
+	}
+
+	// Move the forward iterator past the current key.
+	fwd := it.forward()
+	if fwd.Valid() && bytes.Equal(fwd.Item().Key(), it.key) {
+		fwd.Next()
+	} else {
+		fwd.Seek(it.key)
+		if fwd.Valid() && bytes.Equal(fwd.Item().Key(), it.key) {
+			fwd.Next()
+		}
+	}
+
+	return it.load(fwd, posEnd)
+}
+
+func (it *iter) Prev() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return false
+	case posEnd:
+		return it.Last()
+	}
+
+	// Move the reverse iterator before the current key.
+	rev := it.reverse()
+	if rev.Valid() && bytes.Equal(rev.Item().Key(), it.key) {
+		rev.Next()
+	} else {
+		rev.Seek(it.key)
+		if rev.Valid() && bytes.Equal(rev.Item().Key(), it.key) {
+			rev.Next()
+		}
+	}
+
+	return it.load(rev, posStart)
+}
+
+func (it *iter) Valid() bool {
+	return it.pos == posKey && it.err == nil
+}
+
+func (it *iter) Key() []byte {
+	return it.key
+}
+
+func (it *iter) Value() []byte {
+	return it.value
+}
+
+func (it *iter) Error() error {
+	return it.err
+}
+
+// Release closes the BadgerDB iterators and discards the transaction.
+func (it *iter) Release() {
+	if it.released {
+		return
+	}
+	it.released = true
+
+	if it.fwd != nil {
+		it.fwd.Close()
+	}
+	if it.rev != nil {
+		it.rev.Close()
+	}
+	it.txn.Discard()
+	it.pos = posStart
+	it.key, it.value = nil, nil
+
+	it.BasicReleaser.Release()
+}
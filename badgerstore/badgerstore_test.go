@@ -0,0 +1,242 @@
+package badgerstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	_ goque.Store       = (*Store)(nil)
+	_ goque.MultiGetter = (*Store)(nil)
+)
+
+func TestPriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	store, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pq, err := goque.OpenPriorityQueueWithStore(file, goque.ASC, store)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if err = pq.Enqueue(goque.NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(4-p))); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.Priority != 0 {
+		t.Errorf("Expected priority level to be 0, got %d", deqItem.Priority)
+	}
+
+	if deqItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", deqItem.ToString())
+	}
+
+	// Reopen the priority queue.
+	pq.Close()
+	if store, err = Open(file); err != nil {
+		t.Fatal(err)
+	}
+	if pq, err = goque.OpenPriorityQueueWithStore(file, goque.ASC, store); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 49 {
+		t.Errorf("Expected queue length of 49, got %d", pq.Length())
+	}
+
+	deqItem, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 2" {
+		t.Errorf("Expected string to be 'value for item 2', got '%s'", deqItem.ToString())
+	}
+
+	if deqItem.Seq != 42 {
+		t.Errorf("Expected sequence number to be 42, got %d", deqItem.Seq)
+	}
+}
+
+func TestStack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	store, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := goque.OpenStackWithStore(file, store)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	items := make([]*goque.Item, 10)
+	for i := range items {
+		items[i] = goque.NewItemString(fmt.Sprintf("value for item %d", i+1))
+	}
+	if _, err = s.PushBatch(items); err != nil {
+		t.Error(err)
+	}
+
+	popItems, err := s.PopBatch(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(popItems) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(popItems))
+	}
+
+	if popItems[0].ToString() != "value for item 10" {
+		t.Errorf("Expected string to be 'value for item 10', got '%s'", popItems[0].ToString())
+	}
+
+	if s.Length() != 7 {
+		t.Errorf("Expected stack length of 7, got %d", s.Length())
+	}
+}
+
+// move is a step taken with both iterators in TestIterator.
+type move struct {
+	name string
+	fn   func(iterator.Iterator) bool
+}
+
+func TestIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	store, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	defer store.Close()
+
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ldb.Close()
+
+	// Fill both stores with the same keys.
+	for i := 0; i < 20; i += 2 {
+		key := []byte(fmt.Sprintf("key%02d", i))
+		value := []byte(fmt.Sprintf("value%02d", i))
+		if err = store.Put(key, value, nil); err != nil {
+			t.Error(err)
+		}
+		if err = ldb.Put(key, value, nil); err != nil {
+			t.Error(err)
+		}
+	}
+
+	moves := []move{
+		{"Next", func(it iterator.Iterator) bool { return it.Next() }},
+		{"Prev", func(it iterator.Iterator) bool { return it.Prev() }},
+		{"First", func(it iterator.Iterator) bool { return it.First() }},
+		{"Last", func(it iterator.Iterator) bool { return it.Last() }},
+		{"Seek(key05)", func(it iterator.Iterator) bool { return it.Seek([]byte("key05")) }},
+		{"Seek(key00)", func(it iterator.Iterator) bool { return it.Seek([]byte("key00")) }},
+		{"Seek(key99)", func(it iterator.Iterator) bool { return it.Seek([]byte("key99")) }},
+	}
+	ranges := []*util.Range{
+		nil,
+		{Start: []byte("key04"), Limit: []byte("key12")},
+		{Start: []byte("key05"), Limit: []byte("key13")},
+		util.BytesPrefix([]byte("key1")),
+		{Start: []byte("zzz")},
+	}
+
+	// Walk both iterators through the same sequence of moves.
+	for _, r := range ranges {
+		bit := store.NewIterator(r, nil)
+		lit := ldb.NewIterator(r, nil)
+
+		seed := 1
+		for step := 0; step < 200; step++ {
+			seed = (seed*31 + 7) % 1009
+			m := moves[seed%len(moves)]
+			if step%5 != 0 {
+				m = moves[seed%2]
+			}
+
+			got, want := m.fn(bit), m.fn(lit)
+			if got != want || string(bit.Key()) != string(lit.Key()) || string(bit.Value()) != string(lit.Value()) {
+				t.Fatalf("Expected %s at step %d to return %v at '%s', got %v at '%s'", m.name, step, want, lit.Key(), got, bit.Key())
+			}
+		}
+
+		bit.Release()
+		lit.Release()
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	store, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	defer store.Close()
+
+	if _, err = store.Get([]byte("missing"), nil); err != leveldb.ErrNotFound {
+		t.Errorf("Expected to get leveldb not found error, got %s", err)
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	store, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	defer store.Close()
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte("a"), []byte("value a"))
+	batch.Put([]byte("b"), []byte{})
+	batch.Put([]byte("d"), []byte("value d"))
+	if err = store.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := store.MultiGet([][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 4 {
+		t.Fatalf("Expected 4 values, got %d", len(values))
+	}
+	if string(values[0]) != "value a" || string(values[3]) != "value d" {
+		t.Errorf("Expected 'value a' and 'value d', got '%s' and '%s'", values[0], values[3])
+	}
+	if values[1] == nil || len(values[1]) != 0 {
+		t.Errorf("Expected an empty value for 'b', got %v", values[1])
+	}
+	if values[2] != nil {
+		t.Errorf("Expected a nil value for the missing key, got '%s'", values[2])
+	}
+}
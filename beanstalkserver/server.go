@@ -0,0 +1,249 @@
+// Package beanstalkserver serves Goque priority queues over the
+// beanstalkd protocol, so workers written for beanstalkd can keep
+// running against an embedded Goque instance.
+//
+// Every priority queue is registered as a tube. Jobs are items, with
+// the priority of a job, clamped to 255, as the priority of the item,
+// so the priority queues should be opened in ASC order. The supported
+// commands are:
+//
+//	put, use, reserve, reserve-with-timeout, delete, release, bury,
+//	touch, kick, watch, ignore, list-tubes, list-tube-used,
+//	list-tubes-watched, stats-tube and quit
+//
+// Reserved jobs are reserved items, which are returned to their tube
+// once their time to run (TTR) passes, as with beanstalkd, or once the
+// connection that reserved them closes. Buried jobs are moved into the
+// buried priority queue of their tube, from which kick moves them back.
+//
+// Unlike beanstalkd, job IDs are assigned by the server and only
+// identify a job while it is reserved by the connection it was reserved
+// on, tubes must be registered before they are used, put doesn't
+// support delays and release keeps the priority of a job.
+package beanstalkserver
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/beeker1121/goque"
+)
+
+var (
+	// ErrRegistered is returned when registering a priority queue
+	// under a tube that is already taken.
+	ErrRegistered = errors.New("beanstalkserver: Tube is already registered")
+
+	// ErrServerClosed is returned by Serve once the server is closed.
+	ErrServerClosed = errors.New("beanstalkserver: Server closed")
+)
+
+// The largest job accepted, unless set by the options, which is the
+// default of beanstalkd.
+const defaultMaxJobSize = 1<<16 - 1
+
+// Options configures a Server.
+type Options struct {
+	// MaxJobSize is the largest job body accepted, in bytes. Defaults
+	// to 65535.
+	MaxJobSize int
+}
+
+// tube holds the priority queues registered under a tube.
+type tube struct {
+	pq     *goque.PriorityQueue
+	buried *goque.PriorityQueue
+}
+
+// Server serves the registered tubes over the beanstalkd protocol.
+type Server struct {
+	mu        sync.RWMutex
+	tubes     map[string]*tube
+	opts      Options
+	lastID    uint64
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	done      chan struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a Server without any tube.
+func New(opts Options) *Server {
+	if opts.MaxJobSize <= 0 {
+		opts.MaxJobSize = defaultMaxJobSize
+	}
+
+	return &Server{
+		tubes:     make(map[string]*tube),
+		opts:      opts,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Register serves the given priority queue as the given tube. Jobs
+// buried in the tube are moved into buried, which may be nil to make
+// bury commands fail. The priority queues must be unregistered before
+// they are closed.
+func (s *Server) Register(name string, pq, buried *goque.PriorityQueue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tubes[name]; ok {
+		return ErrRegistered
+	}
+	s.tubes[name] = &tube{pq: pq, buried: buried}
+
+	return nil
+}
+
+// Unregister stops serving the given tube.
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tubes, name)
+}
+
+// ListenAndServe listens on the given TCP address and serves the
+// connections accepted on it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on l until the server is
+// closed, when it returns ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, closes every connection and waits for the
+// commands in progress to return. The jobs reserved on the connections
+// are released.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+		for l := range s.listeners {
+			l.Close()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn runs the commands read from a connection until it is
+// closed, then releases the jobs it reserved.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+
+	sess := &session{
+		s:     s,
+		conn:  textproto.NewConn(conn),
+		use:   "default",
+		watch: []string{"default"},
+		jobs:  make(map[uint64]*job),
+	}
+	defer func() {
+		sess.releaseAll()
+
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	for {
+		line, err := sess.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		quit, err := sess.run(line)
+		if err != nil || quit {
+			return
+		}
+	}
+}
+
+// tube returns the tube registered under name, or nil.
+func (s *Server) tube(name string) *tube {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.tubes[name]
+}
+
+// tubeNames returns the names of the registered tubes, sorted.
+func (s *Server) tubeNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.tubes))
+	for name := range s.tubes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// nextID returns a new job ID.
+func (s *Server) nextID() uint64 {
+	return atomic.AddUint64(&s.lastID, 1)
+}
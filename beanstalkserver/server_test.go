@@ -0,0 +1,178 @@
+package beanstalkserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// client sends commands to a Server and reads its replies.
+type client struct {
+	t    *testing.T
+	conn *textproto.Conn
+	raw  net.Conn
+}
+
+// serve starts a server with the given tubes registered, returning it
+// and its address.
+func serve(t *testing.T, tubes map[string][2]*goque.PriorityQueue) (*Server, string) {
+	s := New(Options{MaxJobSize: 16})
+	for name, pqs := range tubes {
+		if err := s.Register(name, pqs[0], pqs[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+
+	return s, l.Addr().String()
+}
+
+// dial connects a client to the server at addr.
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &client{t: t, conn: textproto.NewConn(conn), raw: conn}
+}
+
+// do sends a command line, followed by a body if one is given, and
+// returns the reply line along with its body, if any.
+func (c *client) do(line string, body ...string) string {
+	c.send(line, body...)
+	return c.reply()
+}
+
+// send writes a command line, followed by a body if one is given.
+func (c *client) send(line string, body ...string) {
+	for _, b := range append([]string{line}, body...) {
+		if err := c.conn.PrintfLine("%s", b); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// reply reads the next reply line, followed by a space and its body if
+// it has one.
+func (c *client) reply() string {
+	c.raw.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.conn.ReadLine()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	fields := strings.Fields(line)
+	if fields[0] != "OK" && fields[0] != "RESERVED" {
+		return line
+	}
+
+	size, _ := strconv.Atoi(fields[len(fields)-1])
+	body := make([]byte, size+2)
+	if _, err = io.ReadFull(c.conn.R, body); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return line + " " + string(body[:size])
+}
+
+// openPriorityQueue opens a new priority queue, returning it and a
+// function dropping it.
+func openPriorityQueue(t *testing.T) (*goque.PriorityQueue, func()) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq, func() { pq.ForceDrop() }
+}
+
+func TestServerRegister(t *testing.T) {
+	pq, drop := openPriorityQueue(t)
+	defer drop()
+
+	s := New(Options{})
+	if err := s.Register("jobs", pq, nil); err != nil {
+		t.Error(err)
+	}
+	if err := s.Register("jobs", pq, nil); err != ErrRegistered {
+		t.Errorf("Expected error ErrRegistered, got %v", err)
+	}
+	s.Unregister("jobs")
+	if err := s.Register("jobs", pq, nil); err != nil {
+		t.Error(err)
+	}
+	if names := s.tubeNames(); len(names) != 1 || names[0] != "jobs" {
+		t.Errorf("Expected tubes [jobs], got %v", names)
+	}
+}
+
+func TestServerDisconnectReleases(t *testing.T) {
+	pq, drop := openPriorityQueue(t)
+	defer drop()
+
+	s, addr := serve(t, map[string][2]*goque.PriorityQueue{"default": {pq, nil}})
+	defer s.Close()
+
+	c := dial(t, addr)
+	if got := c.do("put 0 0 60 3", "abc"); !strings.HasPrefix(got, "INSERTED ") {
+		t.Errorf("Expected INSERTED, got %q", got)
+	}
+	if got := c.do("reserve"); !strings.HasSuffix(got, " 3 abc") {
+		t.Errorf("Expected to reserve abc, got %q", got)
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected length of 0, got %d", pq.Length())
+	}
+
+	// Closing the connection returns the job to its tube.
+	c.send("quit")
+	for i := 0; i < 100; i++ {
+		if leases, err := pq.Leases(); err != nil || len(leases) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected the job to be released, got length %d", pq.Length())
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := New(Options{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Serve(l) }()
+
+	c := dial(t, l.Addr().String())
+	defer c.raw.Close()
+
+	// Close unblocks the pending reserve and stops serving.
+	c.send("reserve")
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+
+	if err = <-errc; err != ErrServerClosed {
+		t.Errorf("Expected error ErrServerClosed, got %v", err)
+	}
+	if err = s.Serve(l); err != ErrServerClosed {
+		t.Errorf("Expected error ErrServerClosed, got %v", err)
+	}
+}
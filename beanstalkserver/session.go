@@ -0,0 +1,525 @@
+package beanstalkserver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// ttrHeader is the item header holding the time to run of a job, in
+// seconds.
+const ttrHeader = "beanstalk-ttr"
+
+// The time to run of jobs that don't have one, such as items enqueued
+// without this package.
+const defaultTTR = 60 * time.Second
+
+// pollInterval is how often blocking reserves check their tubes for
+// jobs.
+const pollInterval = 10 * time.Millisecond
+
+// job is a job reserved by a connection.
+type job struct {
+	tube  *tube
+	item  *goque.PriorityItem
+	token goque.Token
+	ttr   time.Duration
+}
+
+// session holds the state of a connection.
+type session struct {
+	s     *Server
+	conn  *textproto.Conn
+	use   string
+	watch []string
+	jobs  map[uint64]*job
+}
+
+// run runs a command line and writes its reply. It returns true if the
+// connection should be closed, and an error if the reply couldn't be
+// written.
+func (sess *session) run(line string) (bool, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false, sess.reply("UNKNOWN_COMMAND")
+	}
+
+	name, args := args[0], args[1:]
+	switch name {
+	case "quit":
+		return true, nil
+	case "put":
+		return false, sess.put(args)
+	case "use":
+		return false, sess.useTube(args)
+	case "reserve":
+		if len(args) != 0 {
+			return false, sess.reply("BAD_FORMAT")
+		}
+		return false, sess.reserve(-1)
+	case "reserve-with-timeout":
+		seconds, ok := parseArgs(args, 1)
+		if !ok {
+			return false, sess.reply("BAD_FORMAT")
+		}
+		return false, sess.reserve(time.Duration(seconds[0]) * time.Second)
+	case "delete":
+		return false, sess.delete(args)
+	case "release":
+		return false, sess.release(args)
+	case "bury":
+		return false, sess.bury(args)
+	case "touch":
+		return false, sess.touch(args)
+	case "kick":
+		return false, sess.kick(args)
+	case "watch":
+		return false, sess.watchTube(args)
+	case "ignore":
+		return false, sess.ignoreTube(args)
+	case "list-tubes":
+		return false, sess.replyList(sess.s.tubeNames())
+	case "list-tube-used":
+		return false, sess.reply("USING " + sess.use)
+	case "list-tubes-watched":
+		return false, sess.replyList(sess.watch)
+	case "stats-tube":
+		return false, sess.statsTube(args)
+	}
+
+	return false, sess.reply("UNKNOWN_COMMAND")
+}
+
+// put enqueues a job in the used tube.
+func (sess *session) put(args []string) error {
+	n, ok := parseArgs(args, 4)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+	priority, delay, ttr, size := n[0], n[1], n[2], n[3]
+
+	// Read the job body along with its trailing CRLF, or skip it if it
+	// is too big.
+	if size > uint64(sess.s.opts.MaxJobSize) {
+		if _, err := io.CopyN(ioutil.Discard, sess.conn.R, int64(size)+2); err != nil {
+			return err
+		}
+		return sess.reply("JOB_TOO_BIG")
+	}
+	body := make([]byte, size+2)
+	if _, err := io.ReadFull(sess.conn.R, body); err != nil {
+		return err
+	}
+	if body[size] != '\r' || body[size+1] != '\n' {
+		return sess.reply("EXPECTED_CRLF")
+	}
+
+	if delay > 0 {
+		return sess.reply("BAD_FORMAT")
+	}
+	t := sess.s.tube(sess.use)
+	if t == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	if priority > 255 {
+		priority = 255
+	}
+	if ttr == 0 {
+		ttr = 1
+	}
+	item := goque.NewPriorityItem(body[:size], uint8(priority))
+	item.Headers = map[string]string{ttrHeader: strconv.FormatUint(ttr, 10)}
+	if err := t.pq.Enqueue(item); err != nil {
+		return sess.replyError(err)
+	}
+
+	return sess.reply(fmt.Sprintf("INSERTED %d", sess.s.nextID()))
+}
+
+// useTube sets the tube jobs are put into.
+func (sess *session) useTube(args []string) error {
+	if len(args) != 1 {
+		return sess.reply("BAD_FORMAT")
+	}
+	if sess.s.tube(args[0]) == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	sess.use = args[0]
+	return sess.reply("USING " + sess.use)
+}
+
+// reserve reserves the next job of the first watched tube that has one,
+// checking them every pollInterval until the given timeout. A negative
+// timeout waits until the server is closed.
+func (sess *session) reserve(timeout time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range sess.watch {
+			t := sess.s.tube(name)
+			if t == nil {
+				continue
+			}
+
+			j, err := reserveJob(t)
+			if err == goque.ErrEmpty {
+				continue
+			} else if err != nil {
+				return sess.replyError(err)
+			}
+
+			id := sess.s.nextID()
+			sess.jobs[id] = j
+			return sess.replyData(fmt.Sprintf("RESERVED %d %d", id, len(j.item.Value)), j.item.Value)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return sess.reply("TIMED_OUT")
+		case <-sess.s.done:
+			return sess.reply("TIMED_OUT")
+		}
+	}
+}
+
+// reserveJob reserves the next job of a tube for its time to run.
+func reserveJob(t *tube) (*job, error) {
+	item, token, err := t.pq.Reserve(defaultTTR)
+	if err != nil {
+		return nil, err
+	}
+
+	// The time to run is only known once the item is dequeued.
+	ttr := itemTTR(item)
+	if ttr != defaultTTR {
+		if err = t.pq.Extend(token, ttr); err != nil {
+			t.pq.Nack(token)
+			return nil, err
+		}
+	}
+
+	return &job{tube: t, item: item, token: token, ttr: ttr}, nil
+}
+
+// itemTTR returns the time to run of the job held by an item.
+func itemTTR(item *goque.PriorityItem) time.Duration {
+	seconds, err := strconv.ParseUint(item.Headers[ttrHeader], 10, 32)
+	if err != nil || seconds == 0 {
+		return defaultTTR
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// delete deletes a reserved job.
+func (sess *session) delete(args []string) error {
+	j, id, ok := sess.job(args, 1)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+	if j == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	if err := j.tube.pq.Ack(j.token); err != nil {
+		return sess.jobError(id, err)
+	}
+	delete(sess.jobs, id)
+
+	return sess.reply("DELETED")
+}
+
+// release returns a reserved job to its tube, right away or once the
+// given delay passes.
+func (sess *session) release(args []string) error {
+	j, id, ok := sess.job(args, 3)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+	if j == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	// A delayed job is left reserved until the delay passes, when it
+	// is returned to its tube like an expired reservation.
+	delay, _ := strconv.ParseUint(args[2], 10, 32)
+	var err error
+	if delay > 0 {
+		err = j.tube.pq.Extend(j.token, time.Duration(delay)*time.Second)
+	} else {
+		err = j.tube.pq.Nack(j.token)
+	}
+	if err != nil {
+		return sess.jobError(id, err)
+	}
+	delete(sess.jobs, id)
+
+	return sess.reply("RELEASED")
+}
+
+// bury moves a reserved job into the buried priority queue of its tube,
+// with the given priority.
+func (sess *session) bury(args []string) error {
+	j, id, ok := sess.job(args, 2)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+	if j == nil {
+		return sess.reply("NOT_FOUND")
+	}
+	if j.tube.buried == nil {
+		return sess.reply("INTERNAL_ERROR")
+	}
+
+	// Make sure the reservation holds while the job is moved, so it
+	// isn't returned to its tube as well.
+	if err := j.tube.pq.Extend(j.token, j.ttr); err != nil {
+		return sess.jobError(id, err)
+	}
+
+	priority, _ := strconv.ParseUint(args[1], 10, 32)
+	if priority > 255 {
+		priority = 255
+	}
+	item := goque.NewPriorityItem(j.item.Value, uint8(priority))
+	item.Headers = j.item.Headers
+	if err := j.tube.buried.Enqueue(item); err != nil {
+		return sess.replyError(err)
+	}
+	if err := j.tube.pq.Ack(j.token); err != nil {
+		return sess.jobError(id, err)
+	}
+	delete(sess.jobs, id)
+
+	return sess.reply("BURIED")
+}
+
+// touch gives a reserved job its full time to run again.
+func (sess *session) touch(args []string) error {
+	j, id, ok := sess.job(args, 1)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+	if j == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	if err := j.tube.pq.Extend(j.token, j.ttr); err != nil {
+		return sess.jobError(id, err)
+	}
+
+	return sess.reply("TOUCHED")
+}
+
+// kick moves up to the given number of buried jobs back into the used
+// tube.
+func (sess *session) kick(args []string) error {
+	n, ok := parseArgs(args, 1)
+	if !ok {
+		return sess.reply("BAD_FORMAT")
+	}
+
+	t := sess.s.tube(sess.use)
+	var kicked uint64
+	for t != nil && t.buried != nil && kicked < n[0] {
+		// Reserve the buried job until it is back in the tube, so it
+		// can't be lost in between.
+		item, token, err := t.buried.Reserve(0)
+		if err == goque.ErrEmpty {
+			break
+		} else if err != nil {
+			return sess.replyError(err)
+		}
+
+		kickedItem := goque.NewPriorityItem(item.Value, item.Priority)
+		kickedItem.Headers = item.Headers
+		if err = t.pq.Enqueue(kickedItem); err != nil {
+			t.buried.Nack(token)
+			return sess.replyError(err)
+		}
+		if err = t.buried.Ack(token); err != nil {
+			return sess.replyError(err)
+		}
+		kicked++
+	}
+
+	return sess.reply(fmt.Sprintf("KICKED %d", kicked))
+}
+
+// watchTube adds a tube to the watch list.
+func (sess *session) watchTube(args []string) error {
+	if len(args) != 1 {
+		return sess.reply("BAD_FORMAT")
+	}
+	if sess.s.tube(args[0]) == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	if indexOf(sess.watch, args[0]) < 0 {
+		sess.watch = append(sess.watch, args[0])
+	}
+
+	return sess.reply(fmt.Sprintf("WATCHING %d", len(sess.watch)))
+}
+
+// ignoreTube removes a tube from the watch list, which can't be left
+// empty.
+func (sess *session) ignoreTube(args []string) error {
+	if len(args) != 1 {
+		return sess.reply("BAD_FORMAT")
+	}
+
+	if i := indexOf(sess.watch, args[0]); i >= 0 {
+		if len(sess.watch) == 1 {
+			return sess.reply("NOT_IGNORED")
+		}
+		sess.watch = append(sess.watch[:i], sess.watch[i+1:]...)
+	}
+
+	return sess.reply(fmt.Sprintf("WATCHING %d", len(sess.watch)))
+}
+
+// statsTube writes the job counts of a tube.
+func (sess *session) statsTube(args []string) error {
+	if len(args) != 1 {
+		return sess.reply("BAD_FORMAT")
+	}
+	t := sess.s.tube(args[0])
+	if t == nil {
+		return sess.reply("NOT_FOUND")
+	}
+
+	ready, err := t.pq.Stats()
+	if err != nil {
+		return sess.replyError(err)
+	}
+	leases, err := t.pq.Leases()
+	if err != nil {
+		return sess.replyError(err)
+	}
+	var buried uint64
+	if t.buried != nil {
+		stats, err := t.buried.Stats()
+		if err != nil {
+			return sess.replyError(err)
+		}
+		buried = stats.Length
+	}
+
+	stats := fmt.Sprintf("---\nname: %s\ncurrent-jobs-ready: %d\ncurrent-jobs-reserved: %d\ncurrent-jobs-buried: %d\n",
+		args[0], ready.Length, len(leases), buried)
+	return sess.replyData(fmt.Sprintf("OK %d", len(stats)), []byte(stats))
+}
+
+// releaseAll returns the jobs still reserved by the connection to their
+// tubes.
+func (sess *session) releaseAll() {
+	for id, j := range sess.jobs {
+		j.tube.pq.Nack(j.token)
+		delete(sess.jobs, id)
+	}
+}
+
+// job returns the reserved job whose ID is the first of the given
+// number of numeric arguments, or nil if there is none. It returns
+// false if the arguments are invalid.
+func (sess *session) job(args []string, n int) (*job, uint64, bool) {
+	ids, ok := parseArgs(args, n)
+	if !ok {
+		return nil, 0, false
+	}
+
+	return sess.jobs[ids[0]], ids[0], true
+}
+
+// jobError writes the reply of a failed command on a reserved job. A job
+// whose reservation expired is no longer reserved by the connection.
+func (sess *session) jobError(id uint64, err error) error {
+	if err == goque.ErrInvalidToken || err == goque.ErrLeaseExpired {
+		delete(sess.jobs, id)
+		return sess.reply("NOT_FOUND")
+	}
+
+	return sess.replyError(err)
+}
+
+// reply writes a reply line.
+func (sess *session) reply(line string) error {
+	return sess.conn.PrintfLine("%s", line)
+}
+
+// replyData writes a reply line followed by a body.
+func (sess *session) replyData(line string, data []byte) error {
+	w := sess.conn.W
+	w.WriteString(line + "\r\n")
+	w.Write(data)
+	w.WriteString("\r\n")
+
+	return w.Flush()
+}
+
+// replyList writes a list of tube names as a YAML body.
+func (sess *session) replyList(names []string) error {
+	list := "---\n"
+	for _, name := range names {
+		list += "- " + name + "\n"
+	}
+
+	return sess.replyData(fmt.Sprintf("OK %d", len(list)), []byte(list))
+}
+
+// replyError writes the reply of a command that failed with a Goque
+// error.
+func (sess *session) replyError(err error) error {
+	if err == goque.ErrFull {
+		return sess.reply("OUT_OF_MEMORY")
+	}
+
+	return sess.reply("INTERNAL_ERROR")
+}
+
+// parseArgs parses exactly n unsigned integer arguments.
+func parseArgs(args []string, n int) ([]uint64, bool) {
+	if len(args) != n {
+		return nil, false
+	}
+
+	values := make([]uint64, n)
+	for i, arg := range args {
+		v, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+
+	return values, true
+}
+
+// indexOf returns the index of name in names, or -1.
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+
+	return -1
+}
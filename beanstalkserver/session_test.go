@@ -0,0 +1,128 @@
+package beanstalkserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+func TestSessionPutReserveDelete(t *testing.T) {
+	pq, drop := openPriorityQueue(t)
+	defer drop()
+
+	s, addr := serve(t, map[string][2]*goque.PriorityQueue{"jobs": {pq, nil}})
+	defer s.Close()
+	c := dial(t, addr)
+
+	tests := []struct {
+		line string
+		body []string
+		want string
+	}{
+		{"put 0 0 60 1", []string{"a"}, "NOT_FOUND"},
+		{"use other", nil, "NOT_FOUND"},
+		{"use jobs", nil, "USING jobs"},
+		{"list-tube-used", nil, "USING jobs"},
+		{"put 1024 0 60 3", []string{"low"}, "INSERTED 1"},
+		{"put 1 0 60 4", []string{"high"}, "INSERTED 2"},
+		{"put 0 5 60 1", []string{"a"}, "BAD_FORMAT"},
+		{"put 0 0 60 17", []string{"0123456789abcdefg"}, "JOB_TOO_BIG"},
+		{"put x 0 60 1", nil, "BAD_FORMAT"},
+		{"reserve-with-timeout 0", nil, "TIMED_OUT"},
+		{"watch jobs", nil, "WATCHING 2"},
+		{"ignore default", nil, "WATCHING 1"},
+		{"ignore jobs", nil, "NOT_IGNORED"},
+		{"list-tubes-watched", nil, "OK 11 ---\n- jobs\n"},
+		{"reserve", nil, "RESERVED 3 4 high"},
+		{"reserve-with-timeout 1", nil, "RESERVED 4 3 low"},
+		{"stats-tube jobs", nil, "OK 85 ---\nname: jobs\ncurrent-jobs-ready: 0\ncurrent-jobs-reserved: 2\ncurrent-jobs-buried: 0\n"},
+		{"delete 3", nil, "DELETED"},
+		{"delete 3", nil, "NOT_FOUND"},
+		{"touch 4", nil, "TOUCHED"},
+		{"release 4 0 0", nil, "RELEASED"},
+		{"release 4 0 0", nil, "NOT_FOUND"},
+		{"bury 5 0", nil, "NOT_FOUND"},
+		{"reserve", nil, "RESERVED 5 3 low"},
+		{"bury 5 0", nil, "INTERNAL_ERROR"},
+		{"kick 1", nil, "KICKED 0"},
+		{"frobnicate", nil, "UNKNOWN_COMMAND"},
+		{"put 0 0 60 1", []string{"ab"}, "EXPECTED_CRLF"},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.line, tt.body...); got != tt.want {
+			t.Errorf("Expected %q to reply %q, got %q", tt.line, tt.want, got)
+		}
+	}
+}
+
+func TestSessionBuryKick(t *testing.T) {
+	pq, drop := openPriorityQueue(t)
+	defer drop()
+	buried, dropBuried := openPriorityQueue(t)
+	defer dropBuried()
+
+	s, addr := serve(t, map[string][2]*goque.PriorityQueue{"default": {pq, buried}})
+	defer s.Close()
+	c := dial(t, addr)
+
+	c.do("put 3 0 60 3", "job")
+	if got := c.do("reserve"); got != "RESERVED 2 3 job" {
+		t.Fatalf("Expected to reserve job, got %q", got)
+	}
+	if got := c.do("bury 2 7"); got != "BURIED" {
+		t.Errorf("Expected BURIED, got %q", got)
+	}
+	if pq.Length() != 0 || buried.Length() != 1 {
+		t.Errorf("Expected the job to be buried, got lengths %d and %d", pq.Length(), buried.Length())
+	}
+	if item, err := buried.Peek(); err != nil || item.Priority != 7 {
+		t.Errorf("Expected the buried job to have priority 7, got %v, %v", item, err)
+	}
+
+	if got := c.do("kick 5"); got != "KICKED 1" {
+		t.Errorf("Expected KICKED 1, got %q", got)
+	}
+	if pq.Length() != 1 || buried.Length() != 0 {
+		t.Errorf("Expected the job to be kicked, got lengths %d and %d", pq.Length(), buried.Length())
+	}
+	if got := c.do("list-tubes"); got != "OK 14 ---\n- default\n" {
+		t.Errorf("Expected the list of tubes, got %q", got)
+	}
+}
+
+func TestSessionTTR(t *testing.T) {
+	pq, drop := openPriorityQueue(t)
+	defer drop()
+
+	s, addr := serve(t, map[string][2]*goque.PriorityQueue{"default": {pq, nil}})
+	defer s.Close()
+	c := dial(t, addr)
+
+	c.do("put 0 0 1 1", "a")
+	if got := c.do("reserve"); got != "RESERVED 2 1 a" {
+		t.Fatalf("Expected to reserve a, got %q", got)
+	}
+
+	// Once its time to run passes, the job is reserved again.
+	time.Sleep(1100 * time.Millisecond)
+	if got := c.do("reserve-with-timeout 1"); got != "RESERVED 3 1 a" {
+		t.Errorf("Expected to reserve a again, got %q", got)
+	}
+	if got := c.do("delete 2"); got != "NOT_FOUND" {
+		t.Errorf("Expected the first reservation to be gone, got %q", got)
+	}
+
+	// A delayed release returns the job once the delay passes.
+	if got := c.do("release 3 0 1"); got != "RELEASED" {
+		t.Errorf("Expected RELEASED, got %q", got)
+	}
+	if got := c.do("reserve-with-timeout 0"); got != "TIMED_OUT" {
+		t.Errorf("Expected the job to be delayed, got %q", got)
+	}
+	if got := c.do("reserve-with-timeout 2"); !strings.HasSuffix(got, " 1 a") {
+		t.Errorf("Expected to reserve a after the delay, got %q", got)
+	}
+}
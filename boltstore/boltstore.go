@@ -0,0 +1,326 @@
+// Package boltstore provides a goque.Store using bbolt, which keeps the
+// whole database in a single file.
+package boltstore
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucket is the name of the bbolt bucket the keys are kept in.
+var bucket = []byte("goque")
+
+// Store is a goque.Store using bbolt.
+//
+// Every write is synced by bbolt when its transaction commits, unless
+// the database was opened with NoSync.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the bbolt database file at the given path, creating it if
+// it does not exist, using the default options.
+func Open(path string) (*Store, error) {
+	return OpenWithOptions(path, nil)
+}
+
+// OpenWithOptions opens the bbolt database file at the given path using
+// the given options.
+func OpenWithOptions(path string, o *bolt.Options) (*Store, error) {
+	db, err := bolt.Open(path, 0600, o)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// New returns a Store using the given bbolt database, creating the
+// bucket it keeps the keys in if needed.
+func New(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// DB returns the underlying bbolt database.
+func (s *Store) DB() *bolt.DB {
+	return s.db
+}
+
+// Get returns the value for the given key, or leveldb.ErrNotFound if
+// the key does not exist.
+func (s *Store) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return leveldb.ErrNotFound
+		}
+
+		value = append([]byte{}, data...)
+		return nil
+	})
+
+	return value, err
+}
+
+// MultiGet returns the values for the given keys, read in a single
+// transaction, with nil for any key that does not exist.
+func (s *Store) MultiGet(keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for i, key := range keys {
+			if data := b.Get(key); data != nil {
+				values[i] = append([]byte{}, data...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Put sets the value for the given key.
+func (s *Store) Put(key, value []byte, wo *opt.WriteOptions) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, value)
+	})
+}
+
+// Delete deletes the value for the given key.
+func (s *Store) Delete(key []byte, wo *opt.WriteOptions) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete(key)
+	})
+}
+
+// Write applies the given batch in a single transaction.
+func (s *Store) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		r := &replay{b: tx.Bucket(bucket)}
+		if err := batch.Replay(r); err != nil {
+			return err
+		}
+		return r.err
+	})
+}
+
+// NewIterator returns an iterator over a snapshot of the keys in the
+// given range. A nil range iterates over every key.
+//
+// The iterator holds a read transaction open until it is released, and
+// bbolt can't grow the database file while one is open, so iterators
+// must be released before writing.
+func (s *Store) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return iterator.NewEmptyIterator(err)
+	}
+
+	it := &iter{tx: tx, c: tx.Bucket(bucket).Cursor()}
+	if slice != nil {
+		it.start = slice.Start
+		it.limit = slice.Limit
+	}
+
+	return it
+}
+
+// Close closes the bbolt database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// replay applies the operations of a LevelDB batch to a bucket, keeping
+// the first error.
+type replay struct {
+	b   *bolt.Bucket
+	err error
+}
+
+func (r *replay) Put(key, value []byte) {
+	if r.err == nil {
+		r.err = r.b.Put(key, value)
+	}
+}
+
+func (r *replay) Delete(key []byte) {
+	if r.err == nil {
+		r.err = r.b.Delete(key)
+	}
+}
+
+// The positions of an iterator.
+const (
+	posStart = iota // Before the first key.
+	posKey          // On a key.
+	posEnd          // After the last key.
+)
+
+// iter is a LevelDB iterator over a bbolt cursor in a read-only
+// transaction.
+type iter struct {
+	util.BasicReleaser
+	tx           *bolt.Tx
+	c            *bolt.Cursor
+	start, limit []byte
+	pos          int
+	key, value   []byte
+	err          error
+	released     bool
+}
+
+// load positions the iterator on the given key from the cursor, or past
+// the end in the given direction if it is nil or out of range. The key
+// and value are copied, as they are only valid while the transaction is
+// open.
+func (it *iter) load(key, value []byte, end int) bool {
+	if key == nil ||
+		(it.start != nil && bytes.Compare(key, it.start) < 0) ||
+		(it.limit != nil && bytes.Compare(key, it.limit) >= 0) {
+		it.pos = end
+		it.key, it.value = nil, nil
+		return false
+	}
+
+	it.pos = posKey
+	it.key = append(it.key[:0], key...)
+	it.value = append(it.value[:0], value...)
+	return true
+}
+
+// usable reports whether the iterator can be moved.
+func (it *iter) usable() bool {
+	if it.released {
+		it.err = leveldb.ErrIterReleased
+	}
+	return it.err == nil
+}
+
+func (it *iter) First() bool {
+	if !it.usable() {
+		return false
+	}
+
+	if it.start != nil {
+		key, value := it.c.Seek(it.start)
+		return it.load(key, value, posEnd)
+	}
+
+	key, value := it.c.First()
+	return it.load(key, value, posEnd)
+}
+
+func (it *iter) Last() bool {
+	if !it.usable() {
+		return false
+	}
+
+	if it.limit != nil {
+		// Step back from the first key at or after the limit.
+		if key, _ := it.c.Seek(it.limit); key != nil {
+			key, value := it.c.Prev()
+			return it.load(key, value, posStart)
+		}
+	}
+
+	key, value := it.c.Last()
+	return it.load(key, value, posStart)
+}
+
+func (it *iter) Seek(key []byte) bool {
+	if !it.usable() {
+		return false
+	}
+
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		key = it.start
+	}
+
+	k, v := it.c.Seek(key)
+	return it.load(k, v, posEnd)
+}
+
+func (it *iter) Next() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return it.First()
+	case posEnd:
+		return false
+	}
+
+	key, value := it.c.Next()
+	return it.load(key, value, posEnd)
+}
+
+func (it *iter) Prev() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return false
+	case posEnd:
+		return it.Last()
+	}
+
+	key, value := it.c.Prev()
+	return it.load(key, value, posStart)
+}
+
+func (it *iter) Valid() bool {
+	return it.pos == posKey && it.err == nil
+}
+
+func (it *iter) Key() []byte {
+	return it.key
+}
+
+func (it *iter) Value() []byte {
+	return it.value
+}
+
+func (it *iter) Error() error {
+	return it.err
+}
+
+// Release ends the read transaction.
+func (it *iter) Release() {
+	if it.released {
+		return
+	}
+	it.released = true
+
+	it.tx.Rollback()
+	it.pos = posStart
+	it.key, it.value = nil, nil
+
+	it.BasicReleaser.Release()
+}
@@ -0,0 +1,288 @@
+// Package bridge pumps the items of a Goque priority queue to a message
+// broker, such as Kafka or NATS, so the priority queue can serve as a
+// durable local buffer in front of a broker connection that comes and
+// goes.
+//
+// Items are reserved in batches and only deleted once the broker acked
+// them. Batches that fail to publish are returned to the priority queue
+// in order and published again after a backoff, giving at-least-once
+// delivery.
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// Message is an item published to a broker.
+type Message struct {
+	Value     []byte
+	Headers   map[string]string
+	Priority  uint8
+	CreatedAt time.Time
+}
+
+// Publisher publishes messages to a broker.
+type Publisher interface {
+	// Publish publishes the messages in order, returning once the
+	// broker acked all of them. If it returns an error, the messages
+	// are all published again later, so some of them may be published
+	// twice.
+	Publish(ctx context.Context, msgs []*Message) error
+}
+
+// The defaults of the options.
+const (
+	defaultBatchSize    = 100
+	defaultLeaseTimeout = time.Minute
+	defaultMinBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff   = 30 * time.Second
+)
+
+// retryInterval is how often an idle pump retries the priority queue
+// without being signaled, so items whose reservation expired are
+// published again.
+const retryInterval = time.Second
+
+// Options configures a Pump.
+type Options struct {
+	// BatchSize is the largest number of items published at once.
+	// Defaults to 100.
+	BatchSize int
+
+	// LeaseTimeout is how long the items of a batch stay reserved
+	// while they are published. Items not acked by then are returned
+	// to the priority queue, so it must be longer than a publish can
+	// take. Defaults to a minute.
+	LeaseTimeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the wait after a failed publish,
+	// which doubles with every failure in a row. They default to 100
+	// milliseconds and 30 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Logger, if set, receives the failures of the pump running in the
+	// background.
+	Logger goque.Logger
+}
+
+// Pump publishes the items of a priority queue with a Publisher.
+type Pump struct {
+	pq   *goque.PriorityQueue
+	pub  Publisher
+	opts Options
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// New returns a Pump publishing the items of pq with pub. Items are only
+// published in the background once Start is called.
+func New(pq *goque.PriorityQueue, pub Publisher, opts Options) *Pump {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.LeaseTimeout <= 0 {
+		opts.LeaseTimeout = defaultLeaseTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = defaultMaxBackoff
+		if opts.MaxBackoff < opts.MinBackoff {
+			opts.MaxBackoff = opts.MinBackoff
+		}
+	}
+
+	return &Pump{pq: pq, pub: pub, opts: opts}
+}
+
+// Start starts a background goroutine publishing the items of the
+// priority queue as they are added, until Stop is called or the
+// priority queue is closed. Calling Start again while it runs does
+// nothing.
+func (p *Pump) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.stopped = make(chan struct{})
+	go p.run(ctx, p.stopped)
+}
+
+// Stop stops the background goroutine, cancelling the publish in
+// progress, if any, and waits for it to return. The priority queue
+// must not be closed before Stop returns.
+func (p *Pump) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel == nil {
+		return
+	}
+
+	p.cancel()
+	<-p.stopped
+	p.cancel = nil
+}
+
+// run publishes batches until the context is cancelled, waiting for new
+// items while the priority queue is empty and backing off after
+// failures.
+func (p *Pump) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	// Start listening before the first batch, so no item added in
+	// between is missed.
+	ch := p.pq.Notify()
+	defer p.pq.StopNotify(ch)
+
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	var backoff time.Duration
+	for {
+		n, err := p.publishBatch(ctx)
+		if err == goque.ErrDBClosed {
+			return
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			backoff = p.nextBackoff(backoff)
+			p.warn("goque: Publishing a batch failed", "dir", p.pq.DataDir, "error", err, "backoff", backoff)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			continue
+		}
+		backoff = 0
+
+		if n > 0 {
+			continue
+		}
+
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush publishes the items of the priority queue right away, batch by
+// batch, until it is empty or a publish fails. It returns the number of
+// items published. Flush can run alongside the background goroutine.
+func (p *Pump) Flush(ctx context.Context) (int, error) {
+	var total int
+	for {
+		n, err := p.publishBatch(ctx)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
+
+// publishBatch reserves up to BatchSize items and publishes them,
+// deleting them once acked and returning them to the priority queue
+// otherwise. It returns the number of items published.
+func (p *Pump) publishBatch(ctx context.Context) (int, error) {
+	var msgs []*Message
+	var tokens []goque.Token
+	for len(msgs) < p.opts.BatchSize {
+		item, token, err := p.pq.Reserve(p.opts.LeaseTimeout)
+		if err == goque.ErrEmpty {
+			break
+		} else if err != nil {
+			p.release(tokens)
+			return 0, err
+		}
+
+		msgs = append(msgs, &Message{
+			Value:     item.Value,
+			Headers:   item.Headers,
+			Priority:  item.Priority,
+			CreatedAt: item.CreatedAt,
+		})
+		tokens = append(tokens, token)
+	}
+
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	if err := p.pub.Publish(ctx, msgs); err != nil {
+		p.release(tokens)
+		return 0, err
+	}
+
+	for _, token := range tokens {
+		// An item whose reservation expired was returned to the
+		// priority queue, and will be published again.
+		if err := p.pq.Ack(token); err != nil {
+			p.warn("goque: Acking a published item failed", "dir", p.pq.DataDir, "error", err)
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// release returns reserved items to the head of their priority level,
+// the last one first so they keep their order.
+func (p *Pump) release(tokens []goque.Token) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if err := p.pq.Nack(tokens[i]); err != nil {
+			p.warn("goque: Releasing an item failed", "dir", p.pq.DataDir, "error", err)
+		}
+	}
+}
+
+// nextBackoff returns the backoff following the given one.
+func (p *Pump) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return p.opts.MinBackoff
+	}
+
+	backoff *= 2
+	if backoff > p.opts.MaxBackoff {
+		return p.opts.MaxBackoff
+	}
+
+	return backoff
+}
+
+// sleep waits for d, returning false if the context is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *Pump) warn(msg string, args ...interface{}) {
+	if p.opts.Logger != nil {
+		p.opts.Logger.Warn(msg, args...)
+	}
+}
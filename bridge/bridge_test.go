@@ -0,0 +1,148 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// fakePublisher records the messages it publishes, failing the first
+// fails publishes.
+type fakePublisher struct {
+	mu      sync.Mutex
+	fails   int
+	calls   int
+	batches [][]string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msgs []*Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.fails > 0 {
+		p.fails--
+		return errors.New("broker unavailable")
+	}
+
+	var batch []string
+	for _, msg := range msgs {
+		batch = append(batch, string(msg.Value))
+	}
+	p.batches = append(p.batches, batch)
+	return nil
+}
+
+// published returns the values published so far, in order.
+func (p *fakePublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var values []string
+	for _, batch := range p.batches {
+		values = append(values, batch...)
+	}
+	return values
+}
+
+func TestPumpFlush(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub := &fakePublisher{fails: 1}
+	p := New(pq, pub, Options{BatchSize: 2})
+
+	// A failed publish returns the batch to the priority queue.
+	if n, err := p.Flush(context.Background()); err == nil || n != 0 {
+		t.Errorf("Expected the first flush to fail, got %d, %v", n, err)
+	}
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+
+	n, err := p.Flush(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 5 || len(pub.batches) != 3 {
+		t.Errorf("Expected 5 items published in 3 batches, got %d in %d", n, len(pub.batches))
+	}
+	for i, value := range pub.published() {
+		if value != fmt.Sprintf("value for item %d", i+1) {
+			t.Errorf("Expected value for item %d, got %s", i+1, value)
+		}
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+	if leases, err := pq.Leases(); err != nil || len(leases) != 0 {
+		t.Errorf("Expected no reserved item, got %d, %v", len(leases), err)
+	}
+}
+
+func TestPumpStart(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pub := &fakePublisher{fails: 2}
+	p := New(pq, pub, Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	p.Start()
+	p.Start()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The items are published once the broker comes back.
+	for i := 0; i < 200 && len(pub.published()) < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	p.Stop()
+
+	values := pub.published()
+	if len(values) != 3 {
+		t.Fatalf("Expected 3 items published, got %v", values)
+	}
+	for i, value := range values {
+		if value != fmt.Sprintf("value for item %d", i+1) {
+			t.Errorf("Expected value for item %d, got %s", i+1, value)
+		}
+	}
+	if pub.calls < 3 {
+		t.Errorf("Expected at least 3 publishes, got %d", pub.calls)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	p := New(nil, nil, Options{MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+
+	var backoff time.Duration
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if backoff = p.nextBackoff(backoff); backoff != want {
+			t.Errorf("Expected backoff %v, got %v", want, backoff)
+		}
+	}
+}
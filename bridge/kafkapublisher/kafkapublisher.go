@@ -0,0 +1,48 @@
+// Package kafkapublisher implements a bridge.Publisher writing messages
+// to Kafka with github.com/segmentio/kafka-go.
+package kafkapublisher
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/beeker1121/goque/bridge"
+	"github.com/segmentio/kafka-go"
+)
+
+// PriorityHeader is the Kafka header holding the priority of a message.
+const PriorityHeader = "goque-priority"
+
+// Writer writes messages to Kafka. A *kafka.Writer implements it.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Publisher writes messages with a Writer.
+type Publisher struct {
+	w Writer
+}
+
+// New returns a Publisher writing messages with w. For a *kafka.Writer,
+// the topic is set on the writer, which must be synchronous so writes
+// only return once acked, and should require the acks of all replicas.
+func New(w Writer) *Publisher {
+	return &Publisher{w: w}
+}
+
+// Publish writes the messages to Kafka in a single batch, with their
+// headers and priority as Kafka headers.
+func (p *Publisher) Publish(ctx context.Context, msgs []*bridge.Message) error {
+	kmsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		headers := make([]kafka.Header, 0, len(msg.Headers)+1)
+		for k, v := range msg.Headers {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		headers = append(headers, kafka.Header{Key: PriorityHeader, Value: []byte(strconv.Itoa(int(msg.Priority)))})
+
+		kmsgs[i] = kafka.Message{Value: msg.Value, Headers: headers, Time: msg.CreatedAt}
+	}
+
+	return p.w.WriteMessages(ctx, kmsgs...)
+}
@@ -0,0 +1,50 @@
+package kafkapublisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque/bridge"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeWriter records the messages written.
+type fakeWriter struct {
+	msgs []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	w := &fakeWriter{}
+	p := New(w)
+
+	created := time.Now()
+	err := p.Publish(context.Background(), []*bridge.Message{
+		{Value: []byte("a"), Headers: map[string]string{"n": "1"}, Priority: 3, CreatedAt: created},
+		{Value: []byte("b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w.msgs) != 2 {
+		t.Fatalf("Expected 2 messages written, got %d", len(w.msgs))
+	}
+
+	msg := w.msgs[0]
+	if string(msg.Value) != "a" || !msg.Time.Equal(created) {
+		t.Errorf("Expected message a, got %v", msg)
+	}
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers["n"] != "1" || headers[PriorityHeader] != "3" {
+		t.Errorf("Expected the headers and priority, got %v", headers)
+	}
+}
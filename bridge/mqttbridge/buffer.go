@@ -0,0 +1,111 @@
+// Package mqttbridge buffers MQTT messages in a Goque priority queue on
+// IoT gateways, replaying them to an upstream broker in order once it
+// can be reached.
+//
+// The HandleMessage method of a Buffer is subscribed on the local MQTT
+// broker, and enqueues every message with a priority derived from its
+// topic. A bridge.Pump using a Publisher then replays the priority queue
+// to the upstream broker, backing off while it is offline. Every message
+// goes through the priority queue, even while the upstream broker is
+// online, so messages of the same priority are never reordered.
+package mqttbridge
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/beeker1121/goque"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// The item headers holding the topic and retained flag of a buffered
+// message.
+const (
+	TopicHeader    = "mqtt-topic"
+	RetainedHeader = "mqtt-retained"
+)
+
+// Rule gives a priority to the messages whose topic matches a filter,
+// which may hold the + and # wildcards of MQTT.
+type Rule struct {
+	Filter   string
+	Priority uint8
+}
+
+// Options configures a Buffer.
+type Options struct {
+	// Rules set the priority of messages, the first matching rule
+	// winning. Messages matching no rule get DefaultPriority.
+	Rules           []Rule
+	DefaultPriority uint8
+
+	// Logger, if set, receives the messages that couldn't be
+	// buffered.
+	Logger goque.Logger
+}
+
+// Buffer enqueues MQTT messages in a priority queue.
+type Buffer struct {
+	pq   *goque.PriorityQueue
+	opts Options
+}
+
+// NewBuffer returns a Buffer enqueueing messages in pq.
+func NewBuffer(pq *goque.PriorityQueue, opts Options) *Buffer {
+	return &Buffer{pq: pq, opts: opts}
+}
+
+// HandleMessage enqueues a message received from the local broker. It
+// is an mqtt.MessageHandler, to be passed to Subscribe. The message is
+// only acked once enqueued, so with auto-ack disabled on the client, a
+// QoS 1 or 2 message the buffer failed to store is sent again by the
+// broker.
+func (b *Buffer) HandleMessage(client mqtt.Client, msg mqtt.Message) {
+	item := goque.NewPriorityItem(msg.Payload(), b.Priority(msg.Topic()))
+	item.Headers = map[string]string{
+		TopicHeader:    msg.Topic(),
+		RetainedHeader: strconv.FormatBool(msg.Retained()),
+	}
+
+	if err := b.pq.Enqueue(item); err != nil {
+		if b.opts.Logger != nil {
+			b.opts.Logger.Warn("goque: Buffering an MQTT message failed", "topic", msg.Topic(), "error", err)
+		}
+		return
+	}
+
+	msg.Ack()
+}
+
+// Priority returns the priority of the messages of a topic.
+func (b *Buffer) Priority(topic string) uint8 {
+	for _, rule := range b.opts.Rules {
+		if match(rule.Filter, topic) {
+			return rule.Priority
+		}
+	}
+
+	return b.opts.DefaultPriority
+}
+
+// match returns whether a topic matches an MQTT topic filter. As in
+// MQTT, the wildcards don't match topics starting with $ at the first
+// level.
+func match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filters := strings.Split(filter, "/")
+	levels := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) || (f != "+" && f != levels[i]) {
+			return false
+		}
+	}
+
+	return len(filters) == len(levels)
+}
@@ -0,0 +1,117 @@
+package mqttbridge
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// fakeMessage is a message received from the local broker.
+type fakeMessage struct {
+	topic    string
+	payload  string
+	retained bool
+	acked    bool
+}
+
+func (m *fakeMessage) Duplicate() bool   { return false }
+func (m *fakeMessage) Qos() byte         { return 1 }
+func (m *fakeMessage) Retained() bool    { return m.retained }
+func (m *fakeMessage) Topic() string     { return m.topic }
+func (m *fakeMessage) MessageID() uint16 { return 1 }
+func (m *fakeMessage) Payload() []byte   { return []byte(m.payload) }
+func (m *fakeMessage) Ack()              { m.acked = true }
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"alarms/#", "alarms", true},
+		{"alarms/#", "alarms/fire/floor1", true},
+		{"sensors/+/temp", "sensors/a/temp", true},
+		{"sensors/+/temp", "sensors/a/b/temp", false},
+		{"sensors/+", "sensors", false},
+		{"sensors/a", "sensors/a", true},
+		{"sensors/a", "sensors/a/b", false},
+		{"#", "anything/at/all", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Expected match(%q, %q) to be %v, got %v", tt.filter, tt.topic, tt.want, got)
+		}
+	}
+}
+
+func TestBufferHandleMessage(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	b := NewBuffer(pq, Options{
+		Rules: []Rule{
+			{Filter: "alarms/#", Priority: 0},
+			{Filter: "sensors/+/temp", Priority: 5},
+		},
+		DefaultPriority: 9,
+	})
+
+	msgs := []*fakeMessage{
+		{topic: "logs/gateway", payload: "log"},
+		{topic: "sensors/a/temp", payload: "21.5", retained: true},
+		{topic: "alarms/fire", payload: "fire"},
+	}
+	for _, msg := range msgs {
+		b.HandleMessage(nil, msg)
+		if !msg.acked {
+			t.Errorf("Expected the message on %s to be acked", msg.topic)
+		}
+	}
+
+	for _, want := range []struct {
+		payload  string
+		priority uint8
+		topic    string
+		retained string
+	}{
+		{"fire", 0, "alarms/fire", "false"},
+		{"21.5", 5, "sensors/a/temp", "true"},
+		{"log", 9, "logs/gateway", "false"},
+	} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want.payload || item.Priority != want.priority {
+			t.Errorf("Expected %s with priority %d, got %s with priority %d", want.payload, want.priority, item.ToString(), item.Priority)
+		}
+		if item.Headers[TopicHeader] != want.topic || item.Headers[RetainedHeader] != want.retained {
+			t.Errorf("Expected the topic and retained flag of %s, got %v", want.payload, item.Headers)
+		}
+	}
+}
+
+func TestBufferHandleMessageClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+	pq.Close()
+
+	msg := &fakeMessage{topic: "logs", payload: "log"}
+	NewBuffer(pq, Options{}).HandleMessage(nil, msg)
+	if msg.acked {
+		t.Error("Expected a message that wasn't buffered not to be acked")
+	}
+}
@@ -0,0 +1,55 @@
+package mqttbridge
+
+import (
+	"context"
+
+	"github.com/beeker1121/goque/bridge"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Client publishes MQTT messages. An mqtt.Client implements it.
+type Client interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+}
+
+// Publisher implements bridge.Publisher, replaying buffered messages to
+// an upstream broker under their original topic.
+type Publisher struct {
+	client Client
+	qos    byte
+}
+
+// NewPublisher returns a Publisher publishing messages with client at
+// the given QoS. A QoS of at least 1 is needed for the upstream broker
+// to ack messages, so they are only deleted once delivered.
+func NewPublisher(client Client, qos byte) *Publisher {
+	return &Publisher{client: client, qos: qos}
+}
+
+// Publish publishes the messages, then waits for all of them to
+// complete. Messages without a topic header are skipped.
+func (p *Publisher) Publish(ctx context.Context, msgs []*bridge.Message) error {
+	tokens := make([]mqtt.Token, 0, len(msgs))
+	for _, msg := range msgs {
+		topic, ok := msg.Headers[TopicHeader]
+		if !ok {
+			continue
+		}
+		retained := msg.Headers[RetainedHeader] == "true"
+
+		tokens = append(tokens, p.client.Publish(topic, p.qos, retained, msg.Value))
+	}
+
+	for _, token := range tokens {
+		select {
+		case <-token.Done():
+			if err := token.Error(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package mqttbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/beeker1121/goque/bridge"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeToken is a completed publish.
+type fakeToken struct {
+	err  error
+	done chan struct{}
+}
+
+func newToken(err error) *fakeToken {
+	t := &fakeToken{err: err, done: make(chan struct{})}
+	close(t.done)
+	return t
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Done() <-chan struct{}          { return t.done }
+func (t *fakeToken) Error() error                   { return t.err }
+
+// fakeClient is an upstream client, failing publishes while offline.
+type fakeClient struct {
+	mu        sync.Mutex
+	online    bool
+	published []string
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.online {
+		return newToken(errors.New("not connected"))
+	}
+	c.published = append(c.published, fmt.Sprintf("%s %d %v %s", topic, qos, retained, payload))
+	return newToken(nil)
+}
+
+func (c *fakeClient) setOnline(online bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.online = online
+}
+
+func (c *fakeClient) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.published...)
+}
+
+func TestPublisherReplay(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	b := NewBuffer(pq, Options{DefaultPriority: 1})
+	client := &fakeClient{}
+	pump := bridge.New(pq, NewPublisher(client, 1), bridge.Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	// Messages received while offline are buffered.
+	for i := 1; i <= 3; i++ {
+		b.HandleMessage(nil, &fakeMessage{topic: "sensors/temp", payload: fmt.Sprint(i), retained: i == 3})
+	}
+	if _, err = pump.Flush(context.Background()); err == nil {
+		t.Error("Expected replaying while offline to fail")
+	}
+	if pq.Length() != 3 {
+		t.Errorf("Expected 3 buffered messages, got %d", pq.Length())
+	}
+
+	// Once online, they are replayed in order.
+	client.setOnline(true)
+	pump.Start()
+	defer pump.Stop()
+
+	var got []string
+	for i := 0; i < 200; i++ {
+		if got = client.messages(); len(got) == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := []string{"sensors/temp 1 false 1", "sensors/temp 1 false 2", "sensors/temp 1 true 3"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %v to be replayed, got %v", want, got)
+	}
+}
+
+func TestPublisherWithoutTopic(t *testing.T) {
+	client := &fakeClient{online: true}
+	p := NewPublisher(client, 1)
+
+	err := p.Publish(context.Background(), []*bridge.Message{
+		{Value: []byte("a")},
+		{Value: []byte("b"), Headers: map[string]string{TopicHeader: "t"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := client.messages(); len(got) != 1 || got[0] != "t 1 false b" {
+		t.Errorf("Expected only the message with a topic to be published, got %v", got)
+	}
+}
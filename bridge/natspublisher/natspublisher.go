@@ -0,0 +1,64 @@
+// Package natspublisher implements a bridge.Publisher publishing
+// messages to NATS JetStream, which acks every message once stored.
+package natspublisher
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/beeker1121/goque/bridge"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// PriorityHeader is the NATS header holding the priority of a message.
+const PriorityHeader = "Goque-Priority"
+
+// JetStream publishes messages asynchronously. A jetstream.JetStream
+// implements it.
+type JetStream interface {
+	PublishMsgAsync(msg *nats.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error)
+}
+
+// Publisher publishes messages to a JetStream subject.
+type Publisher struct {
+	js      JetStream
+	subject string
+}
+
+// New returns a Publisher publishing messages to the given subject,
+// which must be bound to a stream.
+func New(js JetStream, subject string) *Publisher {
+	return &Publisher{js: js, subject: subject}
+}
+
+// Publish publishes the messages asynchronously, with their headers and
+// priority as NATS headers, then waits for all of their acks.
+func (p *Publisher) Publish(ctx context.Context, msgs []*bridge.Message) error {
+	futures := make([]jetstream.PubAckFuture, 0, len(msgs))
+	for _, msg := range msgs {
+		nmsg := &nats.Msg{Subject: p.subject, Data: msg.Value, Header: nats.Header{}}
+		for k, v := range msg.Headers {
+			nmsg.Header.Set(k, v)
+		}
+		nmsg.Header.Set(PriorityHeader, strconv.Itoa(int(msg.Priority)))
+
+		future, err := p.js.PublishMsgAsync(nmsg)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
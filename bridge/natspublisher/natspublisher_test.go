@@ -0,0 +1,69 @@
+package natspublisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/beeker1121/goque/bridge"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeFuture is an already resolved publish.
+type fakeFuture struct {
+	msg *nats.Msg
+	ok  chan *jetstream.PubAck
+	err chan error
+}
+
+func (f *fakeFuture) Ok() <-chan *jetstream.PubAck { return f.ok }
+func (f *fakeFuture) Err() <-chan error            { return f.err }
+func (f *fakeFuture) Msg() *nats.Msg               { return f.msg }
+
+// fakeJetStream records the messages published, failing the ones whose
+// data is "fail".
+type fakeJetStream struct {
+	msgs []*nats.Msg
+}
+
+func (js *fakeJetStream) PublishMsgAsync(msg *nats.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	js.msgs = append(js.msgs, msg)
+
+	f := &fakeFuture{msg: msg, ok: make(chan *jetstream.PubAck, 1), err: make(chan error, 1)}
+	if string(msg.Data) == "fail" {
+		f.err <- errors.New("no stream")
+	} else {
+		f.ok <- &jetstream.PubAck{Stream: "jobs"}
+	}
+	return f, nil
+}
+
+func TestPublish(t *testing.T) {
+	js := &fakeJetStream{}
+	p := New(js, "jobs.new")
+
+	err := p.Publish(context.Background(), []*bridge.Message{
+		{Value: []byte("a"), Headers: map[string]string{"N": "1"}, Priority: 3},
+		{Value: []byte("b")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(js.msgs) != 2 {
+		t.Fatalf("Expected 2 messages published, got %d", len(js.msgs))
+	}
+	msg := js.msgs[0]
+	if msg.Subject != "jobs.new" || string(msg.Data) != "a" {
+		t.Errorf("Expected message a on jobs.new, got %s %s", msg.Subject, msg.Data)
+	}
+	if msg.Header.Get("N") != "1" || msg.Header.Get(PriorityHeader) != "3" {
+		t.Errorf("Expected the headers and priority, got %v", msg.Header)
+	}
+
+	err = p.Publish(context.Background(), []*bridge.Message{{Value: []byte("b")}, {Value: []byte("fail")}})
+	if err == nil {
+		t.Error("Expected an error when a publish isn't acked")
+	}
+}
@@ -0,0 +1,344 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// OverflowPolicy defines what happens when adding items to a full data
+// structure.
+type OverflowPolicy int
+
+// The possible overflow policies.
+const (
+	OverflowError      OverflowPolicy = iota // Return ErrFull.
+	OverflowBlock                            // Block until there is space.
+	OverflowDropOldest                       // Remove the oldest items to make space.
+)
+
+// Capacity limits the number of items and the total size of the item
+// values a data structure holds, and the size of the value of each item
+// added to it. A zero limit means no limit.
+type Capacity struct {
+	MaxItems     uint64
+	MaxBytes     uint64
+	MaxValueSize uint64
+	Policy       OverflowPolicy
+}
+
+// ValueTooLargeError is returned when adding an item whose value is
+// larger than the MaxValueSize of the capacity of a data structure,
+// whatever its overflow policy.
+type ValueTooLargeError struct {
+	Size uint64
+	Max  uint64
+}
+
+func (e *ValueTooLargeError) Error() string {
+	return fmt.Sprintf("goque: Item value of %d bytes is larger than the maximum of %d bytes", e.Size, e.Max)
+}
+
+// bounds enforces the capacity of a data structure. It is protected by
+// the lock of the data structure it belongs to, and a nil bounds has no
+// limits.
+type bounds struct {
+	Capacity
+	bytes uint64
+	space *sync.Cond
+}
+
+// fits returns whether n more items of the given total size fit next to
+// the given number of items currently held.
+func (b *bounds) fits(length, n, size uint64) bool {
+	if b.MaxItems > 0 && length+n > b.MaxItems {
+		return false
+	}
+	if b.MaxBytes > 0 && b.bytes+size > b.MaxBytes {
+		return false
+	}
+
+	return true
+}
+
+// checkValue returns a ValueTooLargeError if a value of the given size
+// is larger than the maximum.
+func (b *bounds) checkValue(size uint64) error {
+	if b != nil && b.MaxValueSize > 0 && size > b.MaxValueSize {
+		return &ValueTooLargeError{Size: size, Max: b.MaxValueSize}
+	}
+
+	return nil
+}
+
+// exceeds returns whether n items of the given total size can never
+// fit, even when the data structure is empty.
+func (b *bounds) exceeds(n, size uint64) bool {
+	return (b.MaxItems > 0 && n > b.MaxItems) || (b.MaxBytes > 0 && size > b.MaxBytes)
+}
+
+// add records that an item with the given value size was added.
+func (b *bounds) add(size uint64) {
+	if b != nil {
+		b.bytes += size
+	}
+}
+
+// remove records that an item with the given value size was removed,
+// waking anything waiting for space.
+func (b *bounds) remove(size uint64) {
+	if b != nil {
+		b.bytes -= size
+		b.space.Broadcast()
+	}
+}
+
+// wake wakes anything waiting for space, so it can notice the data
+// structure was closed.
+func (b *bounds) wake() {
+	if b != nil {
+		b.space.Broadcast()
+	}
+}
+
+// SetCapacity limits the size of the priority queue. Items already in
+// the priority queue are kept, and the limit applies to items added
+// afterwards. Items returned to the priority queue from a lease are
+// never rejected.
+func (pq *PriorityQueue) SetCapacity(c Capacity) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	b, err := pq.newBounds(c)
+	if err != nil {
+		return err
+	}
+
+	// Wake anything waiting on the previous capacity.
+	pq.bounds.wake()
+	pq.bounds = b
+
+	return nil
+}
+
+// newBounds returns bounds enforcing the given capacity, holding the
+// size of the item values in the priority queue.
+func (pq *PriorityQueue) newBounds(c Capacity) (*bounds, error) {
+	b := &bounds{Capacity: c, space: sync.NewCond(&pq.RWMutex)}
+
+	// Sum the size of the item values.
+	iter := pq.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != 10 || key[1] != prefixSep[0] {
+			continue
+		}
+
+		item, err := pq.decodeItem(key, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		b.bytes += uint64(len(item.Value))
+	}
+
+	return b, iter.Error()
+}
+
+// makeRoom makes sure n more items of the given total size fit in the
+// priority queue, applying its overflow policy.
+func (pq *PriorityQueue) makeRoom(n, size uint64) error {
+	if pq.bounds == nil {
+		return nil
+	} else if pq.bounds.exceeds(n, size) {
+		return ErrFull
+	}
+
+	for b := pq.bounds; !b.fits(pq.Length(), n, size); b = pq.bounds {
+		switch b.Policy {
+		case OverflowBlock:
+			b.space.Wait()
+			if !pq.isOpen {
+				return ErrDBClosed
+			}
+		case OverflowDropOldest:
+			if err := pq.dropOldest(); err != nil {
+				return err
+			}
+		default:
+			return ErrFull
+		}
+	}
+
+	return nil
+}
+
+// dropOldest removes the oldest item in the priority queue.
+func (pq *PriorityQueue) dropOldest() error {
+	oldest, err := pq.oldestItem()
+	if err != nil {
+		return err
+	}
+
+	return pq.dropHead(oldest)
+}
+
+// oldestItem returns the item with the lowest sequence number among the
+// heads of the priority levels. Ties, such as items stored without a
+// sequence number, are broken by dequeue order.
+func (pq *PriorityQueue) oldestItem() (*PriorityItem, error) {
+	var oldest *PriorityItem
+	levels := pq.active.levels()
+	for i := range levels {
+		priority := levels[i]
+		if pq.order == DESC {
+			priority = levels[len(levels)-1-i]
+		}
+
+		item, err := pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+		if err != nil {
+			return nil, err
+		}
+		if oldest == nil || item.Seq < oldest.Seq {
+			oldest = item
+		}
+	}
+	if oldest == nil {
+		return nil, ErrEmpty
+	}
+
+	return oldest, nil
+}
+
+// dropHead discards the given item at the head of its priority level.
+func (pq *PriorityQueue) dropHead(item *PriorityItem) error {
+	// Remove this item from the priority queue.
+	if err := pq.deleteItem(item, ChangeDrop); err != nil {
+		return err
+	}
+
+	// Increment position.
+	pq.advanceHead(item.Priority, item.ID)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	firePriority(pq.hooks.OnDrop, item)
+
+	return nil
+}
+
+// SetCapacity limits the size of the stack. Items already in the stack
+// are kept, and the limit applies to items pushed afterwards. When the
+// stack is full, OverflowDropOldest removes items from the bottom.
+func (s *Stack) SetCapacity(c Capacity) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	b := &bounds{Capacity: c, space: sync.NewCond(&s.RWMutex)}
+
+	// Sum the size of the item values.
+	iter := s.db.NewIterator(&util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}, nil)
+	defer iter.Release()
+	for iter.Next() {
+		item, err := copyItem(s.format, s.seal, iter.Key(), iter.Value())
+		if err != nil {
+			return err
+		}
+		b.bytes += uint64(len(item.Value))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Wake anything waiting on the previous capacity.
+	s.bounds.wake()
+	s.bounds = b
+
+	return nil
+}
+
+// makeRoom makes sure n more items of the given total size fit in the
+// stack, applying its overflow policy.
+func (s *Stack) makeRoom(n, size uint64) error {
+	if s.bounds == nil {
+		return nil
+	} else if s.bounds.exceeds(n, size) {
+		return ErrFull
+	}
+
+	for b := s.bounds; !b.fits(s.Length(), n, size); b = s.bounds {
+		switch b.Policy {
+		case OverflowBlock:
+			b.space.Wait()
+			if !s.isOpen {
+				return ErrDBClosed
+			}
+		case OverflowDropOldest:
+			if err := s.dropOldest(); err != nil {
+				return err
+			}
+		default:
+			return ErrFull
+		}
+	}
+
+	return nil
+}
+
+// dropOldest removes the item at the bottom of the stack.
+func (s *Stack) dropOldest() error {
+	// Try to get the item at the bottom of the stack.
+	item, err := s.getItemByID(s.tail + 1)
+	if err != nil {
+		return err
+	}
+
+	// Remove this item from the stack.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	head, tail := s.trimmed(s.head, s.tail+1)
+	if err := s.writeMeta(batch, head, tail); err != nil {
+		return err
+	}
+
+	// Increment position.
+	s.tail++
+	s.trim()
+	s.bounds.remove(uint64(len(item.Value)))
+	s.compact.deleted(s.db, s.log, 1, uint64(len(item.Value)))
+	fireItem(s.hooks.OnDrop, item)
+
+	return nil
+}
+
+// itemsSize returns the total size of the values of the given items.
+func itemsSize(items []*Item) uint64 {
+	var size uint64
+	for _, item := range items {
+		size += uint64(len(item.Value))
+	}
+
+	return size
+}
+
+// priorityItemsSize returns the total size of the values of the given
+// items.
+func priorityItemsSize(items []*PriorityItem) uint64 {
+	var size uint64
+	for _, item := range items {
+		size += uint64(len(item.Value))
+	}
+
+	return size
+}
@@ -0,0 +1,264 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueCapacityError(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxItems: 3}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString("value", uint8(i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != ErrFull {
+		t.Errorf("Expected to get full error, got %v", err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriorityQueueCapacityMaxBytes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("12345", 0)); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.SetCapacity(Capacity{MaxBytes: 8}); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("1234", 1)); err != ErrFull {
+		t.Errorf("Expected to get full error, got %v", err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("123", 1)); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("123456789", 1)); err != ErrFull {
+		t.Errorf("Expected to get full error for an item larger than the capacity, got %v", err)
+	}
+}
+
+func TestPriorityQueueCapacityDropOldest(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxItems: 2, Policy: OverflowDropOldest}); err != nil {
+		t.Error(err)
+	}
+
+	for i, priority := range []uint8{5, 0, 5} {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i+1), priority)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	for _, compStr := range []string{"value for item 2", "value for item 3"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestPriorityQueueCapacityBlock(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxItems: 1, Policy: OverflowBlock}); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("first", 0)); err != nil {
+		t.Error(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- pq.Enqueue(NewPriorityItemString("second", 0))
+	}()
+
+	select {
+	case <-done:
+		t.Error("Expected Enqueue to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Enqueue to return once space was available")
+	}
+
+	go func() {
+		done <- pq.Enqueue(NewPriorityItemString("third", 0))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	pq.Close()
+
+	select {
+	case err = <-done:
+		if err != ErrDBClosed {
+			t.Errorf("Expected to get database closed error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Enqueue to return once the queue was closed")
+	}
+}
+
+func TestStackCapacityError(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.SetCapacity(Capacity{MaxItems: 2, MaxBytes: 10}); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Push(NewItemString("value1")); err != ErrFull {
+		t.Errorf("Expected to get full error, got %v", err)
+	}
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Push(NewItemString("")); err != ErrFull {
+		t.Errorf("Expected to get full error, got %v", err)
+	}
+}
+
+func TestStackCapacityDropOldest(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.SetCapacity(Capacity{MaxItems: 3, Policy: OverflowDropOldest}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	for i := 5; i >= 3; i-- {
+		item, err := s.Pop()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestPriorityQueueCapacityMaxValueSize(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxValueSize: 5, Policy: OverflowDropOldest}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := pq.EnqueueString(0, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pq.Enqueue(NewPriorityItemString("value 2", 0))
+	if tooLarge, ok := err.(*ValueTooLargeError); !ok || tooLarge.Size != 7 || tooLarge.Max != 5 {
+		t.Errorf("Expected a ValueTooLargeError for 7 bytes, got %v", err)
+	}
+	if _, err = pq.EnqueueBatch([]*PriorityItem{NewPriorityItemString("a", 0), NewPriorityItemString("value 3", 0)}); err == nil {
+		t.Error("Expected the batch to be rejected")
+	}
+	if err = pq.Update(item, []byte("value 4")); err == nil {
+		t.Error("Expected the update to be rejected")
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+	if item, err = pq.Peek(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+	}
+}
@@ -0,0 +1,169 @@
+package goque
+
+import (
+	"context"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Chan returns a channel, with the given buffer size, that streams
+// items dequeued from the priority queue in dequeue order. When the
+// priority queue is empty, the stream waits for new items.
+//
+// The channel is closed when the context is canceled or the priority
+// queue is closed. Items that were dequeued but not yet received from
+// the channel at that point are returned to the head of their priority
+// level, so no item is lost. If they can't be written back, they are
+// lost and a warning is logged.
+func (pq *PriorityQueue) Chan(ctx context.Context, buffer int) <-chan *PriorityItem {
+	out := make(chan *PriorityItem, buffer)
+
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is already closed.
+	if !pq.isOpen {
+		close(out)
+		return out
+	}
+
+	pq.streams.Add(1)
+	go pq.stream(ctx, out)
+
+	return out
+}
+
+// stream dequeues items into out until the context is canceled or the
+// priority queue is closed.
+func (pq *PriorityQueue) stream(ctx context.Context, out chan *PriorityItem) {
+	defer pq.streams.Done()
+
+	var pending *PriorityItem
+	for pending == nil {
+		item, wait, err := pq.dequeueOrWait()
+		if err != nil {
+			break
+		}
+
+		// Wait for a new item if the priority queue is empty.
+		if item == nil {
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+			case <-pq.done:
+			}
+			break
+		}
+
+		select {
+		case out <- item:
+		case <-ctx.Done():
+			pending = item
+		case <-pq.done:
+			pending = item
+		}
+	}
+
+	// Collect the items that were never received, in dequeue order.
+	close(out)
+	var items []*PriorityItem
+	for item := range out {
+		items = append(items, item)
+	}
+	if pending != nil {
+		items = append(items, pending)
+	}
+
+	pq.Lock()
+	if err := pq.requeue(items); err != nil {
+		pq.log.warn("goque: Failed to requeue undelivered items", "dir", pq.DataDir, "items", len(items), "error", err)
+	}
+	pq.Unlock()
+}
+
+// dequeueOrWait removes the next item in the priority queue and returns
+// it. If the priority queue is empty, it instead returns a channel that
+// is closed when items are added.
+func (pq *PriorityQueue) dequeueOrWait() (*PriorityItem, <-chan struct{}, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, nil, ErrDBClosed
+	}
+
+	item, err := pq.dequeue()
+	if err == ErrEmpty {
+		if pq.added == nil {
+			pq.added = make(chan struct{})
+		}
+		return nil, pq.added, nil
+	}
+
+	return item, nil, err
+}
+
+// signalAdded wakes the channel streams waiting for items to be added,
+// and signals the Notify channels of the priority levels that were not
+// active before. The caller must hold the lock.
+func (pq *PriorityQueue) signalAdded(before levelSet) {
+	if pq.added != nil {
+		close(pq.added)
+		pq.added = nil
+	}
+	pq.notify.added(before, pq.active)
+}
+
+// requeue returns the given dequeued items, in dequeue order, to the
+// head of their priority levels. The caller must hold the lock.
+func (pq *PriorityQueue) requeue(items []*PriorityItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	// Set the item IDs and keys, walking backwards so every item ends
+	// up in front of the ones dequeued after it.
+	var heads [256]uint64
+	for i, level := range pq.levels {
+		heads[i] = level.head
+	}
+	batch := new(leveldb.Batch)
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		item.ID = heads[item.Priority]
+		item.Key = pq.generateKey(item.Priority, item.ID)
+		if err := pq.putValue(batch, item); err != nil {
+			return err
+		}
+		heads[item.Priority]--
+	}
+
+	// Add them back to the priority queue.
+	for _, item := range items {
+		next := *pq.levels[item.Priority]
+		next.head = heads[item.Priority]
+		putLevelMeta(batch, item.Priority, next)
+	}
+	if err := pq.write(batch, changeOf(ChangeRequeue, items...)); err != nil {
+		return err
+	}
+
+	before := pq.active
+	for _, item := range items {
+		pq.levels[item.Priority].head = heads[item.Priority]
+		pq.active.set(item.Priority, true)
+		pq.bounds.add(uint64(len(item.Value)))
+		pq.counters.Enqueued++
+		firePriority(pq.hooks.OnRequeue, item)
+
+		// If this priority level is more important than the curLevel.
+		if pq.cmpAsc(item.Priority) || pq.cmpDesc(item.Priority) {
+			pq.curLevel = item.Priority
+		}
+	}
+	pq.signalAdded(before)
+
+	return nil
+}
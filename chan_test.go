@@ -0,0 +1,179 @@
+package goque
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func TestPriorityQueueChan(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i, priority := range []uint8{1, 0} {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i+1), priority)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	items := pq.Chan(ctx, 0)
+
+	for _, compStr := range []string{"value for item 2", "value for item 1", "value for item 3"} {
+		if compStr == "value for item 3" {
+			if err = pq.Enqueue(NewPriorityItemString(compStr, 5)); err != nil {
+				t.Error(err)
+			}
+		}
+
+		select {
+		case item := <-items:
+			if item.ToString() != compStr {
+				t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected to receive '%s' on the channel", compStr)
+		}
+	}
+
+	cancel()
+	if _, ok := <-items; ok {
+		t.Error("Expected channel to be closed after the context was canceled")
+	}
+}
+
+func TestPriorityQueueChanRequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	items := pq.Chan(ctx, 2)
+
+	item := <-items
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", item.ToString())
+	}
+
+	// Let the stream fill the buffer before canceling it, then reopen
+	// the priority queue once the stream has stopped.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", pq.Length())
+	}
+
+	for i := 2; i <= 5; i++ {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+// errWriteFailed is returned by every write of a failWriteStore.
+var errWriteFailed = errors.New("write failed")
+
+// failWriteStore is a Store whose batch writes always fail.
+type failWriteStore struct{ Store }
+
+func (failWriteStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	return errWriteFailed
+}
+
+func TestPriorityQueueChanRequeueFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	l := &testLogger{}
+	pq.SetLogger(l, 0)
+	for i := 1; i <= 5; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	items := pq.Chan(ctx, 2)
+	<-items
+
+	// Let the stream fill the buffer, then make writing the undelivered
+	// items back fail.
+	time.Sleep(50 * time.Millisecond)
+	pq.Lock()
+	pq.db = failWriteStore{pq.db}
+	pq.Unlock()
+	cancel()
+	pq.Close()
+
+	if !l.has("goque: Failed to requeue undelivered items") {
+		t.Error("Expected a warning about the lost items")
+	}
+}
+
+func TestPriorityQueueChanClose(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	items := pq.Chan(context.Background(), 0)
+	time.Sleep(20 * time.Millisecond)
+	pq.Close()
+
+	if _, ok := <-items; ok {
+		t.Error("Expected channel to be closed without receiving an item")
+	}
+
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected undelivered item to remain queued, got length %d", pq.Length())
+	}
+
+	if _, ok := <-pq.Chan(context.Background(), 0); !ok {
+		t.Error("Expected to receive the undelivered item")
+	}
+}
@@ -0,0 +1,431 @@
+package goque
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// changePrefix is the key prefix of the records of the change log,
+// followed by their sequence number. Its second byte is not prefixSep,
+// so it can never collide with the key of an item in any priority level.
+var changePrefix = []byte("goque:cdc:")
+
+// ChangeOp is the kind of operation recorded by a Change.
+type ChangeOp uint8
+
+// The operations recorded in the change log.
+const (
+	// ChangeEnqueue records an item added by Enqueue, EnqueueBatch, a
+	// committed transaction or a copy.
+	ChangeEnqueue ChangeOp = iota + 1
+
+	// ChangeDequeue records an item removed by Dequeue,
+	// DequeueByPriority, DrainTo, Reserve, a transfer, a channel stream
+	// or a committed transaction.
+	ChangeDequeue
+
+	// ChangeRequeue records an item put back by Requeue, by releasing or
+	// reclaiming its lease, or by a channel stream returning it
+	// undelivered.
+	ChangeRequeue
+
+	// ChangeUpdate records an item whose value was changed by Update.
+	ChangeUpdate
+
+	// ChangeMove records an item moved to another priority level by
+	// UpdatePriority. PrevKey is the key it was moved from.
+	ChangeMove
+
+	// ChangeDrop records an item discarded without being dequeued, by a
+	// capacity with OverflowDropOldest, by RemoveByPriorityID or by
+	// Split.
+	ChangeDrop
+
+	// ChangeClear records a priority level emptied by Clear or
+	// ClearPriority. Only the Priority of its item is set.
+	ChangeClear
+)
+
+// String returns the name of the operation.
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeEnqueue:
+		return "enqueue"
+	case ChangeDequeue:
+		return "dequeue"
+	case ChangeRequeue:
+		return "requeue"
+	case ChangeUpdate:
+		return "update"
+	case ChangeMove:
+		return "move"
+	case ChangeDrop:
+		return "drop"
+	case ChangeClear:
+		return "clear"
+	}
+
+	return "unknown"
+}
+
+// Change is a record of the change log of a priority queue.
+type Change struct {
+	// Seq numbers the records of the change log, starting at 1 and
+	// increasing by 1 with every record.
+	Seq uint64
+
+	// Op is the operation recorded.
+	Op ChangeOp
+
+	// Time is when the change was written.
+	Time time.Time
+
+	// Item is the item as it was stored after the change, or before it
+	// for the operations removing it.
+	Item *PriorityItem
+
+	// PrevKey is the key the item had before a ChangeMove.
+	PrevKey []byte
+}
+
+// ChangeLogOptions configures the change log of a priority queue.
+type ChangeLogOptions struct {
+	// MaxChanges, if set, is the number of records kept. Older records
+	// are deleted as new ones are written.
+	MaxChanges uint64
+}
+
+// changeLog holds the state of the change log of a priority queue. It is
+// protected by the lock of the priority queue it belongs to.
+type changeLog struct {
+	first   uint64
+	last    uint64
+	max     uint64
+	changed chan struct{}
+}
+
+// change is an operation to record in the change log along with a
+// write.
+type change struct {
+	op    ChangeOp
+	items []*PriorityItem
+	prev  []byte
+}
+
+// changeOf returns the change recording the given operation on the
+// items.
+func changeOf(op ChangeOp, items ...*PriorityItem) change {
+	return change{op: op, items: items}
+}
+
+// EnableChangeLog starts recording every change to the items of the
+// priority queue in a change log kept in its database. Each record is
+// written in the same LevelDB batch as the change itself, so the log
+// never misses a change or records one that didn't happen, and it can
+// be read or tailed from any sequence number it still holds.
+//
+// The change log is not enabled by opening the priority queue, so call
+// EnableChangeLog right after opening it, before any change. The
+// records written before are kept, and numbering carries on from them.
+// Calling it again replaces the options.
+func (pq *PriorityQueue) EnableChangeLog(opts ChangeLogOptions) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	if pq.changes != nil {
+		pq.changes.max = opts.MaxChanges
+		return nil
+	}
+
+	// Find the records kept from before.
+	c := &changeLog{first: 1, max: opts.MaxChanges, changed: make(chan struct{})}
+	iter := pq.db.NewIterator(util.BytesPrefix(changePrefix), nil)
+	if iter.First() {
+		c.first = changeSeq(iter.Key())
+		iter.Last()
+		c.last = changeSeq(iter.Key())
+	}
+	err := iter.Error()
+	iter.Release()
+	if err != nil {
+		return err
+	}
+
+	pq.changes = c
+	return nil
+}
+
+// ChangeLogRange returns the sequence numbers of the first and last
+// records kept in the change log. If it holds none yet, last is first
+// minus 1.
+func (pq *PriorityQueue) ChangeLogRange() (first, last uint64, err error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, 0, ErrDBClosed
+	}
+
+	if pq.changes == nil {
+		return 0, 0, ErrChangeLogDisabled
+	}
+
+	return pq.changes.first, pq.changes.last, nil
+}
+
+// Changes returns up to max records of the change log, starting with
+// the one numbered from. If that record was already trimmed,
+// ErrChangesTrimmed is returned, as the changes since from can't be
+// replayed anymore.
+func (pq *PriorityQueue) Changes(from uint64, max int) ([]*Change, error) {
+	changes, _, err := pq.readChanges(from, max)
+	return changes, err
+}
+
+// TailChanges calls fn with every record of the change log, starting
+// with the one numbered from, waiting for new records once it has seen
+// them all. It returns when the context is done, fn returns an error or
+// the priority queue is closed, returning ErrDBClosed.
+func (pq *PriorityQueue) TailChanges(ctx context.Context, from uint64, fn func(*Change) error) error {
+	for {
+		changes, changed, err := pq.readChanges(from, clearBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range changes {
+			if err = fn(c); err != nil {
+				return err
+			}
+			from = c.Seq + 1
+		}
+		if len(changes) > 0 {
+			continue
+		}
+
+		// Wait for new records.
+		select {
+		case <-changed:
+		case <-pq.done:
+			return ErrDBClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TrimChanges deletes the records of the change log numbered below seq,
+// once every reader is past them. The last record is always kept, so
+// numbering carries on from it after reopening.
+func (pq *PriorityQueue) TrimChanges(seq uint64) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	c := pq.changes
+	if c == nil {
+		return ErrChangeLogDisabled
+	}
+
+	if seq > c.last {
+		seq = c.last
+	}
+	if seq <= c.first {
+		return nil
+	}
+
+	slice := &util.Range{Start: changeKey(c.first), Limit: changeKey(seq)}
+	if err := clearRange(pq.db, pq.wo, slice, func(keys, values [][]byte) {
+		c.first = changeSeq(keys[len(keys)-1]) + 1
+	}); err != nil {
+		return err
+	}
+	c.first = seq
+
+	return nil
+}
+
+// readChanges returns up to max records of the change log starting with
+// the one numbered from, along with the channel closed once records are
+// added after them.
+func (pq *PriorityQueue) readChanges(from uint64, max int) ([]*Change, <-chan struct{}, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, nil, ErrDBClosed
+	}
+
+	c := pq.changes
+	if c == nil {
+		return nil, nil, ErrChangeLogDisabled
+	}
+
+	if from == 0 {
+		from = 1
+	}
+	if from < c.first {
+		return nil, nil, ErrChangesTrimmed
+	}
+
+	var changes []*Change
+	iter := pq.db.NewIterator(&util.Range{Start: changeKey(from), Limit: changeKey(c.last + 1)}, nil)
+	defer iter.Release()
+	for len(changes) < max && iter.Next() {
+		change, err := pq.decodeChange(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	return changes, c.changed, nil
+}
+
+// write writes the batch along with the records of the given changes,
+// if the change log is enabled. The caller must hold the lock.
+func (pq *PriorityQueue) write(batch *leveldb.Batch, changes ...change) error {
+	c := pq.changes
+	if c == nil {
+		return pq.db.Write(batch, pq.wo)
+	}
+
+	// Add the records, and delete the ones past the limit.
+	last, now := c.last, time.Now()
+	for _, ch := range changes {
+		for _, item := range ch.items {
+			last++
+			record, err := pq.encodeChange(ch, item, now)
+			if err != nil {
+				return err
+			}
+			batch.Put(changeKey(last), record)
+		}
+	}
+	first := c.first
+	for ; c.max > 0 && last >= first && last-first >= c.max; first++ {
+		batch.Delete(changeKey(first))
+	}
+
+	if err := pq.db.Write(batch, pq.wo); err != nil {
+		return err
+	}
+
+	// Wake the readers tailing the change log.
+	if last != c.last {
+		c.first, c.last = first, last
+		close(c.changed)
+		c.changed = make(chan struct{})
+	}
+
+	return nil
+}
+
+// putItem stores the given item, recording the operation in the change
+// log if it is enabled. The caller must hold the lock.
+func (pq *PriorityQueue) putItem(item *PriorityItem, op ChangeOp) error {
+	batch := new(leveldb.Batch)
+	if err := pq.putValue(batch, item); err != nil {
+		return err
+	}
+
+	return pq.write(batch, changeOf(op, item))
+}
+
+// deleteItem deletes the given item at the head of its priority level,
+// along with the positions advanceHead then leaves the level with,
+// recording the operation in the change log if it is enabled. The caller
+// must hold the lock.
+func (pq *PriorityQueue) deleteItem(item *PriorityItem, op ChangeOp) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	putLevelMeta(batch, item.Priority, pq.levels[item.Priority].withHead(item.ID))
+	return pq.write(batch, changeOf(op, item))
+}
+
+// changeKey returns the key of the change log record with the given
+// sequence number.
+func changeKey(seq uint64) []byte {
+	return append(append([]byte(nil), changePrefix...), idToKey(seq)...)
+}
+
+// changeSeq returns the sequence number of the change log record with
+// the given key.
+func changeSeq(key []byte) uint64 {
+	return keyToID(key[len(changePrefix):])
+}
+
+// encodeChange encodes the record of a change of the given item.
+func (pq *PriorityQueue) encodeChange(ch change, item *PriorityItem, now time.Time) ([]byte, error) {
+	// op + time + key [+ previous key] + value = 1 + 8 + 10 [+ 10] + n
+	data := make([]byte, 9, 29)
+	data[0] = byte(ch.op)
+	binary.BigEndian.PutUint64(data[1:9], uint64(now.UnixNano()))
+
+	switch ch.op {
+	case ChangeClear:
+		return append(data, pq.generateKey(item.Priority, 0)...), nil
+	case ChangeMove:
+		data = append(data, item.Key...)
+		data = append(data, ch.prev...)
+	default:
+		data = append(data, item.Key...)
+	}
+
+	value, err := pq.encodeValue(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, value...), nil
+}
+
+// decodeChange decodes the change log record with the given key.
+func (pq *PriorityQueue) decodeChange(key, data []byte) (*Change, error) {
+	if len(data) < 19 {
+		return nil, ErrInvalidRecord
+	}
+
+	c := &Change{
+		Seq:  changeSeq(key),
+		Op:   ChangeOp(data[0]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(data[1:9]))),
+	}
+	itemKey, data := data[9:19], data[19:]
+
+	switch c.Op {
+	case ChangeClear:
+		c.Item = &PriorityItem{Priority: itemKey[0]}
+		return c, nil
+	case ChangeMove:
+		if len(data) < 10 {
+			return nil, ErrInvalidRecord
+		}
+		c.PrevKey, data = append([]byte(nil), data[:10]...), data[10:]
+	}
+
+	var err error
+	if c.Item, err = pq.decodeItem(itemKey, data); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,235 @@
+package goque
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// describeChanges formats the given change log records as "op value"
+// strings, or "op priority" for a clear.
+func describeChanges(changes []*Change) []string {
+	var out []string
+	for _, c := range changes {
+		if c.Op == ChangeClear {
+			out = append(out, fmt.Sprintf("%s %d", c.Op, c.Item.Priority))
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s %s", c.Op, c.Item.ToString()))
+	}
+
+	return out
+}
+
+func TestPriorityQueueChangeLog(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.Changes(1, 10); err != ErrChangeLogDisabled {
+		t.Errorf("Expected ErrChangeLogDisabled, got %v", err)
+	}
+	if err = pq.EnableChangeLog(ChangeLogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Requeue(item, false); err != nil {
+		t.Fatal(err)
+	}
+	item, err = pq.PeekByPriorityID(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.UpdateString(item, "item 2b"); err != nil {
+		t.Fatal(err)
+	}
+	prevKey := item.Key
+	if _, err = pq.UpdatePriority(item, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.RemoveByPriorityID(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.ClearPriority(1); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := pq.Changes(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"enqueue item 1", "enqueue item 2", "enqueue item 3", "dequeue item 1", "requeue item 1",
+		"update item 2b", "move item 2b", "drop item 3", "clear 1"}
+	if fmt.Sprint(describeChanges(changes)) != fmt.Sprint(want) {
+		t.Fatalf("Expected changes %v, got %v", want, describeChanges(changes))
+	}
+	for i, c := range changes {
+		if c.Seq != uint64(i+1) || c.Time.IsZero() {
+			t.Errorf("Expected change %d to be numbered and timed, got %d at %v", i+1, c.Seq, c.Time)
+		}
+	}
+	if move := changes[6]; string(move.PrevKey) != string(prevKey) || move.Item.Priority != 1 {
+		t.Errorf("Expected the move from %v to priority 1, got %v to %d", prevKey, move.PrevKey, move.Item.Priority)
+	}
+
+	// Reading starts at the given record.
+	if changes, err = pq.Changes(8, 100); err != nil || len(changes) != 2 || changes[0].Seq != 8 {
+		t.Errorf("Expected changes 8 and 9, got %v (%v)", describeChanges(changes), err)
+	}
+	if changes, err = pq.Changes(4, 1); err != nil || len(changes) != 1 || changes[0].Seq != 4 {
+		t.Errorf("Expected change 4, got %v (%v)", describeChanges(changes), err)
+	}
+}
+
+func TestPriorityQueueChangeLogReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.EnableChangeLog(ChangeLogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.TrimChanges(10); err != nil {
+		t.Fatal(err)
+	}
+	pq.Close()
+
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+	if err = pq.EnableChangeLog(ChangeLogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last record survives trimming, so numbering carries on.
+	if first, last, err := pq.ChangeLogRange(); err != nil || first != 3 || last != 3 {
+		t.Errorf("Expected the change log to hold record 3, got %d to %d (%v)", first, last, err)
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := pq.Changes(3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"enqueue item 3", "dequeue item 1"}
+	if fmt.Sprint(describeChanges(changes)) != fmt.Sprint(want) || changes[1].Seq != 4 {
+		t.Errorf("Expected changes %v, got %v", want, describeChanges(changes))
+	}
+
+	if _, err = pq.Changes(2, 10); err != ErrChangesTrimmed {
+		t.Errorf("Expected ErrChangesTrimmed, got %v", err)
+	}
+}
+
+func TestPriorityQueueChangeLogMax(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.EnableChangeLog(ChangeLogOptions{MaxChanges: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = pq.DequeueBatch(2); err != nil {
+		t.Fatal(err)
+	}
+
+	first, last, err := pq.ChangeLogRange()
+	if err != nil || first != 5 || last != 7 {
+		t.Errorf("Expected the change log to hold records 5 to 7, got %d to %d (%v)", first, last, err)
+	}
+	changes, err := pq.Changes(first, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"enqueue item 5", "dequeue item 1", "dequeue item 2"}
+	if fmt.Sprint(describeChanges(changes)) != fmt.Sprint(want) {
+		t.Errorf("Expected changes %v, got %v", want, describeChanges(changes))
+	}
+}
+
+func TestPriorityQueueTailChanges(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.EnableChangeLog(ChangeLogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(0, "item 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := make(chan *Change)
+	done := make(chan error, 1)
+	go func() {
+		done <- pq.TailChanges(ctx, 1, func(c *Change) error {
+			seen <- c
+			return nil
+		})
+	}()
+
+	// Records written before and while tailing are both seen.
+	if c := <-seen; c.Seq != 1 || c.Item.ToString() != "item 1" {
+		t.Errorf("Expected change 1, got %d %s", c.Seq, c.Item.ToString())
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-seen:
+		if c.Seq != 2 || c.Op != ChangeDequeue {
+			t.Errorf("Expected change 2 to be a dequeue, got %d %s", c.Seq, c.Op)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the new change to be tailed")
+	}
+
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// Closing the priority queue stops tailing.
+	go func() {
+		done <- pq.TailChanges(context.Background(), 3, func(c *Change) error { return nil })
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pq.Close()
+	if err = <-done; err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+}
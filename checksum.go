@@ -0,0 +1,93 @@
+package goque
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// checksumFlag is set in the version byte of an envelope followed by
+// the CRC-32 (Castagnoli) checksum of everything before it, big endian.
+const checksumFlag byte = 0x80
+
+// checksumTable is the CRC-32 table used for the checksums of values.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SetChecksums sets whether the priority queue stores a checksum along
+// with the value of every item it writes from now on. The checksum of a
+// value is verified whenever it is read, whether checksums are still
+// enabled or not, and ErrChecksumMismatch is returned instead of the
+// item if it doesn't match. The item is left in place, and can be
+// removed with RemoveByPriorityID, or by VerifyIntegrity with repair,
+// so the rest of its priority level can be dequeued. Checksums are
+// disabled by default, and aren't persisted, so SetChecksums must be
+// called after every open.
+//
+// If the priority queue stores values as is, having been created by an
+// older version of Goque, ErrUnsupportedFormat is returned.
+func (pq *PriorityQueue) SetChecksums(enabled bool) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if pq.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	pq.seal.checksums = enabled
+
+	return nil
+}
+
+// SetChecksums sets whether the stack stores a checksum along with the
+// value of every item it writes from now on, the same way as
+// PriorityQueue.SetChecksums.
+func (s *Stack) SetChecksums(enabled bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	s.seal.checksums = enabled
+
+	return nil
+}
+
+// SetChecksums sets whether the queue stores a checksum along with the
+// value of every item it writes from now on, the same way as
+// PriorityQueue.SetChecksums.
+func (q *Queue) SetChecksums(enabled bool) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	q.seal.checksums = enabled
+
+	return nil
+}
+
+// appendChecksum marks the envelope in data as checksummed and appends
+// its checksum.
+func appendChecksum(data []byte) []byte {
+	data[0] |= checksumFlag
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], crc32.Checksum(data, checksumTable))
+	return append(data, b[:]...)
+}
+
+// verifyChecksum checks the checksum of the envelope in data, if it has
+// one, returning a copy of the envelope without it. It returns
+// ErrChecksumMismatch if the checksum doesn't match.
+func verifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < 1 || data[0]&checksumFlag == 0 {
+		return data, nil
+	}
+
+	n := len(data) - 4
+	if n < 1 || crc32.Checksum(data[:n], checksumTable) != binary.BigEndian.Uint32(data[n:]) {
+		return nil, ErrChecksumMismatch
+	}
+
+	envelope := append([]byte{data[0] &^ checksumFlag}, data[1:n]...)
+	return envelope, nil
+}
@@ -0,0 +1,217 @@
+package goque
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueChecksums(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString(0, "value 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := NewPriorityItemString("value 4", 0)
+	item.Headers = map[string]string{"key": "value"}
+	if err = pq.Enqueue(item); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a bit of the value of item 3.
+	key := pq.generateKey(0, 3)
+	data, err := pq.db.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0]&checksumFlag == 0 {
+		t.Error("Expected the value to have a checksum")
+	}
+	data[len(data)-6] ^= 1
+	if err = pq.db.Put(key, data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values with and without a checksum are read, whether checksums are
+	// enabled or not.
+	if err = pq.SetChecksums(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"value 1", "value 2"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if pq.Length() != 2 {
+		t.Errorf("Expected the corrupted item to be kept, got queue length %d", pq.Length())
+	}
+
+	report, err := pq.VerifyIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.InvalidValues) != 1 || string(report.InvalidValues[0]) != string(key) {
+		t.Errorf("Expected the corrupted item to be reported, got %+v", report)
+	}
+
+	item, err = pq.PeekByPriorityID(0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 4" || item.Headers["key"] != "value" {
+		t.Errorf("Expected 'value 4' with its headers, got '%s' with %v", item.ToString(), item.Headers)
+	}
+}
+
+func TestPriorityQueueChecksumsRemoveHead(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Flip a bit of the value of the head item.
+	key := pq.generateKey(0, 1)
+	data, err := pq.db.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-6] ^= 1
+	if err = pq.db.Put(key, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.Dequeue(); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	// The corrupted item is removed without its value.
+	item, err := pq.RemoveByPriorityID(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 1 || item.Value != nil {
+		t.Errorf("Expected item 1 without a value, got item %d with '%s'", item.ID, item.ToString())
+	}
+
+	// The rest of the level is dequeued.
+	for _, want := range []string{"value 2", "value 3"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestStackChecksums(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Truncate the value of the top item.
+	data, err := s.db.Get(idToKey(2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.db.Put(idToKey(2), data[:len(data)-1], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Pop(); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	item, err := s.PeekByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 1" {
+		t.Errorf("Expected 'value 1', got '%s'", item.ToString())
+	}
+
+	// The corrupted item is removed, and the rest of the stack popped.
+	if item, err = s.RemoveByID(2); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 2 || item.Value != nil {
+		t.Errorf("Expected item 2 without a value, got item %d with '%s'", item.ID, item.ToString())
+	}
+	if item, err = s.Pop(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 1" {
+		t.Errorf("Expected 'value 1', got '%s'", item.ToString())
+	}
+}
+
+func TestQueueChecksumsRawFormat(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+
+	// Create a data directory the way older versions of Goque did.
+	if err := os.MkdirAll(file, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(goqueQueue)}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.SetChecksums(true); err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// chunkPrefix is the key prefix of the chunks of the values split by a
+// ChunkStore. Its second byte is not prefixSep, so it can never collide
+// with the key of an item in any priority level.
+var chunkPrefix = []byte("goque:chunk:")
+
+// The tags starting the values stored by a ChunkStore.
+const (
+	chunkWhole byte = 0 // The value follows.
+	chunkSplit byte = 1 // The number of chunks (4) and the size of the value (8) follow, big endian.
+)
+
+// ChunkStore is a Store splitting the values larger than its chunk size
+// into chunks, stored under keys of their own in the store it wraps,
+// and reassembling them when they are read. LevelDB copies large values
+// over and over as it compacts, so keeping them in chunks of a few
+// hundred kilobytes keeps compactions short.
+//
+// Every value is stored along with a tag telling whether it was split,
+// so the wrapped store must always be opened through a ChunkStore. The
+// keys of the chunks are hidden from its iterators. Deleting or
+// overwriting a key reads its value first, to find its chunks.
+type ChunkStore struct {
+	store Store
+	size  int
+
+	// Serializes the writes, which read the values they replace.
+	mu sync.Mutex
+}
+
+// The ChunkStore is a Store.
+var (
+	_ Store       = (*ChunkStore)(nil)
+	_ Snapshotter = (*ChunkStore)(nil)
+	_ Compacter   = (*ChunkStore)(nil)
+	_ Sizer       = (*ChunkStore)(nil)
+)
+
+// NewChunkStore returns the ChunkStore splitting the values of the given
+// store into chunks of up to chunkSize bytes, which must be positive.
+func NewChunkStore(store Store, chunkSize int) *ChunkStore {
+	return &ChunkStore{store: store, size: chunkSize}
+}
+
+// Get returns the value of the given key, reassembled from its chunks.
+func (c *ChunkStore) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	data, err := c.store.Get(key, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	return readChunks(c.store, key, data)
+}
+
+// Put stores the value of the given key, split into chunks if needed.
+func (c *ChunkStore) Put(key, value []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, value)
+	return c.Write(batch, wo)
+}
+
+// Delete deletes the given key along with its chunks.
+func (c *ChunkStore) Delete(key []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return c.Write(batch, wo)
+}
+
+// Write applies the given batch atomically, splitting the values it
+// puts into chunks and deleting the chunks of the values it replaces.
+func (c *ChunkStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &chunkWriter{store: c.store, size: c.size, out: new(leveldb.Batch), chunks: make(map[string]uint32)}
+	if err := batch.Replay(w); err != nil {
+		return err
+	} else if w.err != nil {
+		return w.err
+	}
+
+	return c.store.Write(w.out, wo)
+}
+
+// NewIterator returns an iterator over the given range, skipping the
+// keys of the chunks. It iterates over a snapshot of the wrapped store
+// if it can take one, so the chunks of a value can't be deleted before
+// they are read.
+func (c *ChunkStore) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	snap, err := takeSnapshot(c.store)
+	if err != nil {
+		return &chunkIterator{Iterator: c.store.NewIterator(slice, ro), r: c.store}
+	}
+
+	return &chunkIterator{Iterator: snap.NewIterator(slice, ro), r: snap, snap: snap}
+}
+
+// Close closes the wrapped store.
+func (c *ChunkStore) Close() error {
+	return c.store.Close()
+}
+
+// Snapshot takes a snapshot of the wrapped store, returning
+// ErrSnapshotUnsupported if it can't take one.
+func (c *ChunkStore) Snapshot() (StoreSnapshot, error) {
+	snap, err := takeSnapshot(c.store)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkSnapshot{snap: snap}, nil
+}
+
+// CompactRange compacts the given range of the wrapped store, returning
+// ErrCompactUnsupported if it can't compact.
+func (c *ChunkStore) CompactRange(r util.Range) error {
+	return compactStore(c.store, r)
+}
+
+// SizeOf estimates the on-disk size of the given ranges of the wrapped
+// store, returning ErrSizeUnsupported if it can't estimate it.
+func (c *ChunkStore) SizeOf(ranges []util.Range) (leveldb.Sizes, error) {
+	sizer, ok := c.store.(Sizer)
+	if !ok {
+		return nil, ErrSizeUnsupported
+	}
+
+	return sizer.SizeOf(ranges)
+}
+
+// chunkReader is the store or snapshot the chunks of values are read
+// from.
+type chunkReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+}
+
+// readChunks returns the value stored as data at the given key,
+// reassembling it from its chunks if it was split. It returns
+// ErrInvalidRecord if data isn't tagged, or chunks are missing.
+func readChunks(r chunkReader, key, data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == chunkWhole {
+		return data[1:], nil
+	}
+
+	// tag + chunks + size = 1 + 4 + 8
+	if len(data) != 13 || data[0] != chunkSplit {
+		return nil, ErrInvalidRecord
+	}
+	n := binary.BigEndian.Uint32(data[1:5])
+	size := binary.BigEndian.Uint64(data[5:13])
+
+	value := make([]byte, 0, size)
+	for i := uint32(0); i < n; i++ {
+		chunk, err := r.Get(chunkKey(key, i), nil)
+		if err == leveldb.ErrNotFound {
+			return nil, ErrInvalidRecord
+		} else if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+	if uint64(len(value)) != size {
+		return nil, ErrInvalidRecord
+	}
+
+	return value, nil
+}
+
+// chunkKey returns the key of the chunk with the given index of the
+// value stored at the given key.
+func chunkKey(key []byte, i uint32) []byte {
+	out := make([]byte, 0, len(chunkPrefix)+len(key)+4)
+	out = append(out, chunkPrefix...)
+	out = append(out, key...)
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], i)
+	return append(out, b[:]...)
+}
+
+// chunkWriter replays a batch written to a ChunkStore into the batch
+// written to the wrapped store.
+type chunkWriter struct {
+	store Store
+	size  int
+	out   *leveldb.Batch
+	err   error
+
+	// The number of chunks of the keys written so far, which the
+	// wrapped store doesn't hold yet.
+	chunks map[string]uint32
+}
+
+// Put puts the given value, split into chunks if larger than the chunk
+// size, replacing the chunks of the previous value.
+func (w *chunkWriter) Put(key, value []byte) {
+	w.deleteChunks(key)
+	if len(value) <= w.size {
+		w.out.Put(key, append([]byte{chunkWhole}, value...))
+		w.chunks[string(key)] = 0
+		return
+	}
+
+	var n uint32
+	for start := 0; start < len(value); start += w.size {
+		end := start + w.size
+		if end > len(value) {
+			end = len(value)
+		}
+		w.out.Put(chunkKey(key, n), value[start:end])
+		n++
+	}
+
+	head := make([]byte, 13)
+	head[0] = chunkSplit
+	binary.BigEndian.PutUint32(head[1:5], n)
+	binary.BigEndian.PutUint64(head[5:13], uint64(len(value)))
+	w.out.Put(key, head)
+	w.chunks[string(key)] = n
+}
+
+// Delete deletes the given key along with its chunks.
+func (w *chunkWriter) Delete(key []byte) {
+	w.deleteChunks(key)
+	w.out.Delete(key)
+	w.chunks[string(key)] = 0
+}
+
+// deleteChunks deletes the chunks of the value currently stored at the
+// given key, if it was split.
+func (w *chunkWriter) deleteChunks(key []byte) {
+	n, ok := w.chunks[string(key)]
+	if !ok {
+		data, err := w.store.Get(key, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			w.err = err
+			return
+		}
+		if len(data) == 13 && data[0] == chunkSplit {
+			n = binary.BigEndian.Uint32(data[1:5])
+		}
+	}
+
+	for i := uint32(0); i < n; i++ {
+		w.out.Delete(chunkKey(key, i))
+	}
+}
+
+// chunkIterator is an iterator of a ChunkStore, skipping the keys of
+// the chunks and reassembling the values.
+type chunkIterator struct {
+	iterator.Iterator
+	r    chunkReader
+	snap StoreSnapshot
+	err  error
+}
+
+// skip moves past the keys of chunks using move, given the result of
+// the last move.
+func (it *chunkIterator) skip(ok bool, move func() bool) bool {
+	for ok && bytes.HasPrefix(it.Iterator.Key(), chunkPrefix) {
+		ok = move()
+	}
+
+	return ok
+}
+
+func (it *chunkIterator) First() bool {
+	return it.skip(it.Iterator.First(), it.Iterator.Next)
+}
+
+func (it *chunkIterator) Last() bool {
+	return it.skip(it.Iterator.Last(), it.Iterator.Prev)
+}
+
+func (it *chunkIterator) Seek(key []byte) bool {
+	return it.skip(it.Iterator.Seek(key), it.Iterator.Next)
+}
+
+func (it *chunkIterator) Next() bool {
+	return it.skip(it.Iterator.Next(), it.Iterator.Next)
+}
+
+func (it *chunkIterator) Prev() bool {
+	return it.skip(it.Iterator.Prev(), it.Iterator.Prev)
+}
+
+// Value returns the value at the current key, reassembled from its
+// chunks. If that fails, it returns nil and Error returns why.
+func (it *chunkIterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+
+	value, err := readChunks(it.r, it.Key(), it.Iterator.Value())
+	if err != nil {
+		it.err = err
+		return nil
+	}
+
+	return value
+}
+
+func (it *chunkIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.Iterator.Error()
+}
+
+// Release releases the iterator, along with its snapshot.
+func (it *chunkIterator) Release() {
+	it.Iterator.Release()
+	if it.snap != nil {
+		it.snap.Release()
+	}
+}
+
+// chunkSnapshot is a snapshot of a ChunkStore.
+type chunkSnapshot struct {
+	snap StoreSnapshot
+}
+
+func (s *chunkSnapshot) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	data, err := s.snap.Get(key, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	return readChunks(s.snap, key, data)
+}
+
+func (s *chunkSnapshot) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &chunkIterator{Iterator: s.snap.NewIterator(slice, ro), r: s.snap}
+}
+
+func (s *chunkSnapshot) Release() {
+	s.snap.Release()
+}
@@ -0,0 +1,106 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestChunkStore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq, err := OpenPriorityQueueWithStore(file, ASC, NewChunkStore(db, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	large := bytes.Repeat([]byte("0123456789"), 50)
+	if err = pq.Enqueue(NewPriorityItem(large, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(0, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if chunks := countKeys(db, chunkPrefix); chunks < 8 {
+		t.Errorf("Expected the large value to be split into at least 8 chunks, got %d", chunks)
+	}
+
+	// The chunks are hidden from iterators.
+	report, err := pq.VerifyIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Items != 2 {
+		t.Errorf("Expected 2 items and no problems, got %+v", report)
+	}
+
+	// The value moves into a lease and back.
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(item.Value, large) {
+		t.Error("Expected the large value to be reassembled")
+	}
+	if err = pq.Release(token); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range [][]byte{[]byte("small"), large} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(item.Value, want) {
+			t.Errorf("Expected a value of %d bytes, got %d", len(want), len(item.Value))
+		}
+	}
+	if chunks := countKeys(db, chunkPrefix); chunks != 0 {
+		t.Errorf("Expected the chunks to be deleted along with the value, got %d", chunks)
+	}
+}
+
+func TestChunkStoreMissingChunk(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStackWithStore(file, NewChunkStore(db, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("a value split into chunks")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(chunkKey(idToKey(1), 2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Peek(); err != ErrInvalidRecord {
+		t.Errorf("Expected ErrInvalidRecord, got %v", err)
+	}
+}
+
+// countKeys returns the number of keys of the store with the given
+// prefix.
+func countKeys(db Store, prefix []byte) int {
+	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	n := 0
+	for iter.Next() {
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,188 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// clearBatchSize is the number of keys deleted per batch when clearing
+// a data structure.
+const clearBatchSize = 1000
+
+// Clear removes every item from the priority queue, leaving it open and
+// ready to use. Items in flight are not affected, and still return to
+// the priority queue if their lease is released or expires.
+//
+// The items are deleted in batches, so if Clear fails part way, the
+// items deleted so far stay deleted.
+func (pq *PriorityQueue) Clear() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	for _, priority := range pq.active.levels() {
+		if err := pq.clearLevel(priority); err != nil {
+			return err
+		}
+	}
+	pq.resetCurrentLevel()
+
+	return nil
+}
+
+// ClearPriority removes every item of the given priority level, leaving
+// the other levels untouched. Like Clear, it does not affect items in
+// flight, and the items deleted so far stay deleted if it fails part
+// way.
+func (pq *PriorityQueue) ClearPriority(priority uint8) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return pq.clearLevel(priority)
+}
+
+// clearLevel deletes every item of the given priority level. The head
+// of the level is moved past each batch of deleted items, so the level
+// stays consistent if a batch fails. The caller must hold the lock.
+func (pq *PriorityQueue) clearLevel(priority uint8) error {
+	// Record the clear before deleting anything, so the change log
+	// doesn't miss the items deleted if it fails part way.
+	if pq.changes != nil {
+		err := pq.write(new(leveldb.Batch), changeOf(ChangeClear, &PriorityItem{Priority: priority}))
+		if err != nil {
+			return err
+		}
+	}
+
+	level := pq.levels[priority]
+	slice := &util.Range{
+		Start: pq.generateKey(priority, level.head+1),
+		Limit: pq.generateKey(priority, level.tail+1),
+	}
+
+	err := clearRange(pq.db, pq.wo, slice, func(keys, values [][]byte) {
+		pq.advanceHead(priority, keyToID(keys[len(keys)-1][2:]))
+
+		// Count the size of the deleted item values.
+		if pq.bounds != nil || pq.compact != nil {
+			var size uint64
+			for i := range keys {
+				if item, err := pq.decodeItem(keys[i], values[i]); err == nil {
+					size += uint64(len(item.Value))
+				}
+			}
+			pq.bounds.remove(size)
+			pq.compact.deleted(pq.db, pq.log, uint64(len(keys)), size)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Delete the tombstones of the removed items.
+	if err := clearRange(pq.db, pq.wo, util.BytesPrefix(removedKey(pq.generatePrefix(priority))), nil); err != nil {
+		return err
+	}
+
+	// Reset the positions of the now empty priority level.
+	if err := pq.db.Delete(levelMetaKey(priority), pq.wo); err != nil {
+		return err
+	}
+	level.head = 0
+	level.tail = 0
+	level.removed = nil
+	pq.updateActive(priority)
+
+	return nil
+}
+
+// Clear removes every item from the stack, leaving it open and ready to
+// use.
+//
+// The items are deleted in batches from the bottom of the stack, so if
+// Clear fails part way, the items deleted so far stay deleted.
+func (s *Stack) Clear() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	slice := &util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}
+	err := clearRange(s.db, s.wo, slice, func(keys, values [][]byte) {
+		s.tail = keyToID(keys[len(keys)-1])
+		s.trim()
+
+		// Count the size of the deleted item values.
+		if s.bounds != nil || s.compact != nil {
+			var size uint64
+			for i := range keys {
+				if item, err := copyItem(s.format, s.seal, keys[i], values[i]); err == nil {
+					size += uint64(len(item.Value))
+				}
+			}
+			s.bounds.remove(size)
+			s.compact.deleted(s.db, s.log, uint64(len(keys)), size)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Delete the tombstones of the removed items.
+	if err := clearRange(s.db, s.wo, util.BytesPrefix(removedPrefix), nil); err != nil {
+		return err
+	}
+
+	// Reset the positions of the now empty stack.
+	s.head = 0
+	s.tail = 0
+	s.removed = nil
+
+	return s.writeMeta(new(leveldb.Batch), 0, 0)
+}
+
+// clearRange deletes the keys in the given range in batches of
+// clearBatchSize, calling deleted, if set, with the keys and values of
+// each batch once it is written.
+func clearRange(db Store, wo *opt.WriteOptions, slice *util.Range, deleted func(keys, values [][]byte)) error {
+	for {
+		// Collect the next batch of keys. The iterator is released
+		// before the batch is written, as some stores can't write while
+		// one is open.
+		iter := db.NewIterator(slice, nil)
+		var keys, values [][]byte
+		batch := new(leveldb.Batch)
+		for len(keys) < clearBatchSize && iter.Next() {
+			keys = append(keys, append([]byte(nil), iter.Key()...))
+			values = append(values, append([]byte(nil), iter.Value()...))
+			batch.Delete(iter.Key())
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		} else if len(keys) == 0 {
+			return nil
+		}
+
+		if err := db.Write(batch, wo); err != nil {
+			return err
+		}
+		if deleted != nil {
+			deleted(keys, values)
+		}
+	}
+}
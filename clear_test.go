@@ -0,0 +1,248 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueClear(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	// Spread more than one batch of items over a few levels.
+	for i := 1; i <= 2500; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%3))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Keep one item in flight.
+	leased, token, err := pq.DequeueWithLease(time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Clear(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// The priority queue can still be used.
+	if err = pq.Enqueue(NewPriorityItemString("new item", 2)); err != nil {
+		t.Error(err)
+	}
+	if err = pq.Release(token); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != leased.ToString() {
+		t.Errorf("Expected string to be '%s', got '%s'", leased.ToString(), item.ToString())
+	}
+
+	// Nothing cleared comes back after reopening.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	item, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "new item" {
+		t.Errorf("Expected string to be 'new item', got '%s'", item.ToString())
+	}
+}
+
+func TestPriorityQueueClearCapacity(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxBytes: 10}); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("0123456789", 0)); err != nil {
+		t.Error(err)
+	}
+	if err = pq.Clear(); err != nil {
+		t.Error(err)
+	}
+
+	// The cleared bytes are free again.
+	if err = pq.Enqueue(NewPriorityItemString("0123456789", 0)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriorityQueueClearClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	if err = pq.Clear(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestPriorityQueueClearPriority(t *testing.T) {
+	for _, o := range []order{ASC, DESC} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		pq, err := OpenPriorityQueue(file, o)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for p := 0; p <= 2; p++ {
+			for i := 1; i <= 1500; i++ {
+				if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+
+		// Clear the level being dequeued from and one other.
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+		if err = pq.ClearPriority(0); err != nil {
+			t.Error(err)
+		}
+		if err = pq.ClearPriority(2); err != nil {
+			t.Error(err)
+		}
+
+		if pq.Length() != 1500 {
+			t.Errorf("Expected queue length of 1500, got %d", pq.Length())
+		}
+		if fmt.Sprint(pq.ActiveLevels()) != "[1]" {
+			t.Errorf("Expected active levels [1], got %v", pq.ActiveLevels())
+		}
+
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.Priority != 1 || item.ToString() != "value for item 1" {
+			t.Errorf("Expected priority 1 and 'value for item 1', got %d and '%s'", item.Priority, item.ToString())
+		}
+
+		// A cleared level can be used again.
+		if err = pq.Enqueue(NewPriorityItemString("new item", 0)); err != nil {
+			t.Error(err)
+		}
+		if pq.Length() != 1500 {
+			t.Errorf("Expected queue length of 1500, got %d", pq.Length())
+		}
+
+		pq.ForceDrop()
+	}
+}
+
+func TestPriorityQueueClearPriorityClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	if err = pq.ClearPriority(0); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestStackClear(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.SetCapacity(Capacity{MaxBytes: 30000}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2500; i++ {
+		if err = s.Push(NewItemString("0123456789")); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.Clear(); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+	if _, err = s.Pop(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// The stack can still be used, with all of its space.
+	for i := 1; i <= 3000; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("%010d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ID != 3000 || item.ToString() != "0000003000" {
+		t.Errorf("Expected ID 3000 and '0000003000', got %d and '%s'", item.ID, item.ToString())
+	}
+}
+
+func TestStackClearClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	s.Close()
+
+	if err = s.Clear(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package goque
+
+import (
+	"io"
+)
+
+// Clone creates an independent copy of the priority queue in a new data
+// directory at dstDir, such as to reproduce its state elsewhere or to
+// try a migration first. It streams a backup of a snapshot of the store
+// straight into Restore, so no file is written in between and the
+// priority queue can be used in the meantime. The copy is opened with
+// OpenPriorityQueue once Clone returns.
+//
+// dstDir must not exist or be empty, or ErrDataDirExists is returned.
+// If the copy fails, what was written to dstDir is removed. Items that
+// are in flight are not included.
+func (pq *PriorityQueue) Clone(dstDir string) error {
+	return clone(pq.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the stack at dstDir, the same
+// way as PriorityQueue.Clone.
+func (s *Stack) Clone(dstDir string) error {
+	return clone(s.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the queue at dstDir, the same
+// way as PriorityQueue.Clone.
+func (q *Queue) Clone(dstDir string) error {
+	return clone(q.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the deque at dstDir, the same
+// way as PriorityQueue.Clone.
+func (d *Deque) Clone(dstDir string) error {
+	return clone(d.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the prefix queue at dstDir, the
+// same way as PriorityQueue.Clone.
+func (pq *PrefixQueue) Clone(dstDir string) error {
+	return clone(pq.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the delay queue at dstDir, the
+// same way as PriorityQueue.Clone.
+func (dq *DelayQueue) Clone(dstDir string) error {
+	return clone(dq.Backup, dstDir)
+}
+
+// Clone creates an independent copy of the retry queue at dstDir, the
+// same way as PriorityQueue.Clone.
+func (rq *RetryQueue) Clone(dstDir string) error {
+	return clone(rq.Backup, dstDir)
+}
+
+// clone restores the backup written by the given function to dstDir,
+// passing it through a pipe.
+func clone(backup func(w io.Writer) error, dstDir string) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := backup(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	err := Restore(pr, dstDir)
+
+	// Stop the backup if Restore returned early.
+	pr.Close()
+	if berr := <-done; berr != nil && berr != io.ErrClosedPipe {
+		return berr
+	}
+
+	return err
+}
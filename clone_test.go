@@ -0,0 +1,140 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueClone(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p < 3; p++ {
+		for i := 1; i <= 5; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value %d-%d", p, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	dir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if err = pq.Clone(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Changes to the original don't reach the clone.
+	if _, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := OpenPriorityQueue(dir, DESC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.ForceDrop()
+
+	if clone.Length() != 15 {
+		t.Errorf("Expected clone length of 15, got %d", clone.Length())
+	}
+	item, err := clone.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 2-1" {
+		t.Errorf("Expected 'value 2-1', got '%s'", item.ToString())
+	}
+	if pq.Length() != 14 {
+		t.Errorf("Expected original length of 14, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueCloneExists(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	other, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.ForceDrop()
+
+	if err = pq.Clone(other.DataDir); err != ErrDataDirExists {
+		t.Errorf("Expected ErrDataDirExists, got %v", err)
+	}
+	if other.Length() != 0 {
+		t.Errorf("Expected the existing queue to be untouched, got %d items", other.Length())
+	}
+}
+
+func TestPriorityQueueCloneClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	dir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if err = pq.Clone(dir); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		os.RemoveAll(dir)
+		t.Error("Expected the data directory of a failed clone to be removed")
+	}
+}
+
+func TestQueueClone(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if err = q.Clone(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clone, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		item, err := clone.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("value %d", i); item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/hashicorp/raft"
+)
+
+// The operations of the Raft log.
+const (
+	opEnqueue byte = iota + 1
+	opDequeue
+)
+
+// errCommandCorrupt is returned when applying a Raft log entry that
+// can't be decoded.
+var errCommandCorrupt = errors.New("cluster: Raft command is corrupt")
+
+// result is what applying a command returns.
+type result struct {
+	item *goque.PriorityItem
+	err  error
+}
+
+// fsm applies the Raft log to the local priority queue.
+type fsm struct {
+	dir  string
+	open func(dir string) (*goque.PriorityQueue, error)
+
+	// mu guards pq, which Restore replaces.
+	mu sync.RWMutex
+	pq *goque.PriorityQueue
+}
+
+// Apply applies a committed command to the priority queue.
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(log.Data) == 0 {
+		return &result{err: errCommandCorrupt}
+	}
+
+	switch log.Data[0] {
+	case opEnqueue:
+		item, err := decodeEnqueue(log.Data[1:])
+		if err != nil {
+			return &result{err: err}
+		}
+		if err = f.pq.Enqueue(item); err != nil {
+			return &result{err: err}
+		}
+		return &result{item: item}
+	case opDequeue:
+		item, err := f.pq.Dequeue()
+		return &result{item: item, err: err}
+	}
+
+	return &result{err: errCommandCorrupt}
+}
+
+// Snapshot takes a snapshot of the priority queue, which is then
+// persisted while commands keep being applied.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	snap, err := f.pq.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsmSnapshot{snap: snap}, nil
+}
+
+// Restore replaces the priority queue with a snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.pq.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(f.dir); err != nil {
+		return err
+	}
+
+	// Reopen the priority queue even if the restore failed, so it
+	// stays usable.
+	rerr := goque.Restore(rc, f.dir)
+	pq, err := f.open(f.dir)
+	if err != nil {
+		return err
+	}
+	f.pq = pq
+
+	return rerr
+}
+
+// fsmSnapshot persists a snapshot of the priority queue as a backup.
+type fsmSnapshot struct {
+	snap *goque.PriorityQueueSnapshot
+}
+
+// Persist writes the backup to the sink.
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.snap.Backup(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+// Release releases the snapshot.
+func (s *fsmSnapshot) Release() {
+	s.snap.Release()
+}
+
+// encodeEnqueue encodes the command enqueueing an item. The creation
+// time is part of it, so every node stores the same item.
+func encodeEnqueue(item *goque.PriorityItem) []byte {
+	data := make([]byte, 10, 10+len(item.Value)+binary.MaxVarintLen64)
+	data[0] = opEnqueue
+	data[1] = item.Priority
+	binary.BigEndian.PutUint64(data[2:], uint64(item.CreatedAt.UnixNano()))
+
+	data = appendBytes(data, item.Value)
+	var buf [binary.MaxVarintLen64]byte
+	data = append(data, buf[:binary.PutUvarint(buf[:], uint64(len(item.Headers)))]...)
+	for k, v := range item.Headers {
+		data = appendBytes(data, []byte(k))
+		data = appendBytes(data, []byte(v))
+	}
+
+	return data
+}
+
+// decodeEnqueue decodes the item of an enqueue command, without its
+// operation.
+func decodeEnqueue(data []byte) (*goque.PriorityItem, error) {
+	if len(data) < 9 {
+		return nil, errCommandCorrupt
+	}
+
+	var ok bool
+	item := &goque.PriorityItem{Priority: data[0]}
+	item.CreatedAt = time.Unix(0, int64(binary.BigEndian.Uint64(data[1:])))
+	item.UpdatedAt = item.CreatedAt
+	if item.Value, data, ok = readBytes(data[9:]); !ok {
+		return nil, errCommandCorrupt
+	}
+
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)) {
+		return nil, errCommandCorrupt
+	}
+	data = data[size:]
+	if n > 0 {
+		item.Headers = make(map[string]string, n)
+	}
+	for i := uint64(0); i < n; i++ {
+		var k, v []byte
+		if k, data, ok = readBytes(data); !ok {
+			return nil, errCommandCorrupt
+		}
+		if v, data, ok = readBytes(data); !ok {
+			return nil, errCommandCorrupt
+		}
+		item.Headers[string(k)] = string(v)
+	}
+
+	return item, nil
+}
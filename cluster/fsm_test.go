@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/hashicorp/raft"
+)
+
+// memSink is a snapshot sink keeping the snapshot in memory.
+type memSink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (s *memSink) ID() string    { return "test" }
+func (s *memSink) Close() error  { return nil }
+func (s *memSink) Cancel() error { s.cancelled = true; return nil }
+
+// openFSM opens an fsm on a new priority queue.
+func openFSM(t *testing.T) *fsm {
+	f := &fsm{
+		dir: fmt.Sprintf("test_db_%d", time.Now().UnixNano()),
+		open: func(dir string) (*goque.PriorityQueue, error) {
+			return goque.OpenPriorityQueue(dir, goque.ASC)
+		},
+	}
+
+	var err error
+	if f.pq, err = f.open(f.dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestEnqueueCommand(t *testing.T) {
+	item := goque.NewPriorityItemString("value", 3)
+	item.CreatedAt = time.Unix(0, 12345)
+	item.Headers = map[string]string{"a": "1", "b": "2"}
+
+	data := encodeEnqueue(item)
+	if data[0] != opEnqueue {
+		t.Fatalf("Expected an enqueue command, got %d", data[0])
+	}
+
+	decoded, err := decodeEnqueue(data[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ToString() != "value" || decoded.Priority != 3 || !decoded.CreatedAt.Equal(item.CreatedAt) ||
+		fmt.Sprint(decoded.Headers) != fmt.Sprint(item.Headers) {
+		t.Errorf("Expected %+v to be decoded, got %+v", item, decoded)
+	}
+
+	if _, err = decodeEnqueue(data[1 : len(data)-1]); err != errCommandCorrupt {
+		t.Errorf("Expected a truncated command to be corrupt, got %v", err)
+	}
+}
+
+func TestFSMApply(t *testing.T) {
+	f := openFSM(t)
+	defer f.pq.ForceDrop()
+
+	for i := 1; i <= 2; i++ {
+		res := f.Apply(&raft.Log{Data: encodeEnqueue(goque.NewPriorityItemString(fmt.Sprint(i), 0))}).(*result)
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.item.ID != uint64(i) {
+			t.Errorf("Expected item ID %d, got %d", i, res.item.ID)
+		}
+	}
+
+	res := f.Apply(&raft.Log{Data: []byte{opDequeue}}).(*result)
+	if res.err != nil || res.item.ToString() != "1" {
+		t.Errorf("Expected to dequeue item 1, got %v (%v)", res.item, res.err)
+	}
+
+	if res = f.Apply(&raft.Log{Data: []byte{99}}).(*result); res.err != errCommandCorrupt {
+		t.Errorf("Expected an unknown command to be corrupt, got %v", res.err)
+	}
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	f := openFSM(t)
+	defer f.pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := f.pq.EnqueueString(uint8(i), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items dequeued later are still part of the snapshot.
+	if _, err = f.pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &memSink{}
+	if err = snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	snap.Release()
+
+	restored := openFSM(t)
+	defer restored.pq.ForceDrop()
+	if _, err := restored.pq.EnqueueString(0, "replaced"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = restored.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.pq.Length() != 3 {
+		t.Fatalf("Expected 3 restored items, got %d", restored.pq.Length())
+	}
+	item, err := restored.pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "1" {
+		t.Errorf("Expected item 1 to be dequeued first, got %s", item.ToString())
+	}
+
+	// A failed restore leaves an empty priority queue.
+	if err = restored.Restore(ioutil.NopCloser(bytes.NewReader([]byte("garbage")))); err != goque.ErrInvalidBackup {
+		t.Errorf("Expected goque.ErrInvalidBackup, got %v", err)
+	}
+	if restored.pq.Length() != 0 {
+		t.Errorf("Expected an empty priority queue, got %d items", restored.pq.Length())
+	}
+}
@@ -0,0 +1,290 @@
+// Package cluster replicates a Goque priority queue across a cluster of
+// nodes with Raft, so it survives the loss of a node and its disk.
+//
+// Every node keeps a copy of the priority queue in its own LevelDB
+// database. Enqueue and Dequeue go through the leader, which appends
+// them to the Raft log and returns once a majority of the nodes stored
+// them, every node then applying them to its copy in the same order. A
+// cluster of 3 nodes keeps working with any one of them down, and one of
+// 5 with any two down.
+//
+// The Raft log and stable state are kept in a separate LevelDB
+// database, and snapshots of the priority queue are taken as backups.
+// The local priority queue is rebuilt from the latest snapshot and the
+// Raft log every time a node opens, so it always matches the log.
+package cluster
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/hashicorp/raft"
+)
+
+// ErrNotLeader is returned when writing to, or changing the members of,
+// a cluster through a node that is not its leader. Leader returns the
+// address of the leader, if known.
+var ErrNotLeader = errors.New("cluster: Node is not the leader")
+
+// The defaults of the options.
+const (
+	defaultApplyTimeout = 10 * time.Second
+	transportTimeout    = 10 * time.Second
+	transportPool       = 3
+	snapshotsRetained   = 2
+)
+
+// Options configures a Node.
+type Options struct {
+	// ID identifies the node in the cluster. It must be unique, and
+	// stay the same when the node restarts.
+	ID string
+
+	// Dir is the directory holding the priority queue, Raft log and
+	// snapshots of the node.
+	Dir string
+
+	// BindAddr is the TCP address the node exchanges the Raft log on,
+	// such as "10.0.0.1:7000". The other nodes must be able to reach
+	// it.
+	BindAddr string
+
+	// Bootstrap, if set, starts a new cluster made of this node alone
+	// when it has no Raft state yet. Set it on the first node only,
+	// then add the other nodes to the leader with Join.
+	Bootstrap bool
+
+	// Descending dequeues the highest priority level first, like
+	// goque.DESC. Every node of a cluster must use the same order.
+	Descending bool
+
+	// ApplyTimeout bounds how long Enqueue and Dequeue wait for the
+	// command to be sent to the other nodes. Defaults to 10 seconds.
+	ApplyTimeout time.Duration
+
+	// Config, if set, is the Raft configuration, whose LocalID is set
+	// to ID. Defaults to raft.DefaultConfig.
+	Config *raft.Config
+
+	// LogOutput receives the logs of Raft. Defaults to os.Stderr.
+	LogOutput io.Writer
+}
+
+// Node is a member of a cluster.
+type Node struct {
+	opts      Options
+	fsm       *fsm
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	logs      *logStore
+}
+
+// Open opens the node, starting a new cluster if Bootstrap is set. The
+// node rejoins its cluster if it was a member of one before.
+func Open(opts Options) (n *Node, err error) {
+	if opts.ApplyTimeout <= 0 {
+		opts.ApplyTimeout = defaultApplyTimeout
+	}
+	if opts.LogOutput == nil {
+		opts.LogOutput = os.Stderr
+	}
+
+	config := raft.DefaultConfig()
+	if opts.Config != nil {
+		c := *opts.Config
+		config = &c
+	}
+	config.LocalID = raft.ServerID(opts.ID)
+	if config.Logger == nil {
+		config.LogOutput = opts.LogOutput
+	}
+
+	if err = os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	n = &Node{opts: opts}
+	defer func() {
+		if err != nil {
+			n.Close()
+		}
+	}()
+
+	// Start from an empty priority queue, which the Raft snapshot and
+	// log fill again.
+	f := &fsm{dir: filepath.Join(opts.Dir, "queue"), open: n.openQueue}
+	if err = os.RemoveAll(f.dir); err != nil {
+		return nil, err
+	}
+	if f.pq, err = n.openQueue(f.dir); err != nil {
+		return nil, err
+	}
+	n.fsm = f
+
+	if n.logs, err = openLogStore(filepath.Join(opts.Dir, "raft")); err != nil {
+		return nil, err
+	}
+	snaps, err := raft.NewFileSnapshotStore(opts.Dir, snapshotsRetained, opts.LogOutput)
+	if err != nil {
+		return nil, err
+	}
+	if n.transport, err = raft.NewTCPTransport(opts.BindAddr, nil, transportPool, transportTimeout, opts.LogOutput); err != nil {
+		return nil, err
+	}
+
+	if opts.Bootstrap {
+		exists, err := raft.HasExistingState(n.logs, n.logs, snaps)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			servers := []raft.Server{{ID: config.LocalID, Address: n.transport.LocalAddr()}}
+			err = raft.BootstrapCluster(config, n.logs, n.logs, snaps, n.transport, raft.Configuration{Servers: servers})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if n.raft, err = raft.NewRaft(config, f, n.logs, n.logs, snaps, n.transport); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// openQueue opens the local priority queue in dir.
+func (n *Node) openQueue(dir string) (*goque.PriorityQueue, error) {
+	if n.opts.Descending {
+		return goque.OpenPriorityQueue(dir, goque.DESC)
+	}
+
+	return goque.OpenPriorityQueue(dir, goque.ASC)
+}
+
+// Addr returns the address the node exchanges the Raft log on.
+func (n *Node) Addr() string {
+	return string(n.transport.LocalAddr())
+}
+
+// Leader returns the address of the leader of the cluster, or an empty
+// string if there is none right now.
+func (n *Node) Leader() string {
+	addr, _ := n.raft.LeaderWithID()
+	return string(addr)
+}
+
+// IsLeader returns whether the node is the leader of the cluster.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Join adds the node with the given ID and address to the cluster. It
+// must be called on the leader.
+func (n *Node) Join(id, addr string) error {
+	return leaderError(n.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, n.opts.ApplyTimeout).Error())
+}
+
+// Leave removes the node with the given ID from the cluster. It must be
+// called on the leader.
+func (n *Node) Leave(id string) error {
+	return leaderError(n.raft.RemoveServer(raft.ServerID(id), 0, n.opts.ApplyTimeout).Error())
+}
+
+// Enqueue adds an item to the priority queue of the cluster, setting its
+// ID and key like goque.PriorityQueue.Enqueue. It returns once a
+// majority of the nodes stored it.
+func (n *Node) Enqueue(item *goque.PriorityItem) error {
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+
+	enqueued, err := n.apply(encodeEnqueue(item))
+	if err != nil {
+		return err
+	}
+	*item = *enqueued
+
+	return nil
+}
+
+// Dequeue removes the next item from the priority queue of the cluster
+// and returns it. If the node fails before returning the item, it may be
+// lost.
+func (n *Node) Dequeue() (*goque.PriorityItem, error) {
+	return n.apply([]byte{opDequeue})
+}
+
+// Peek returns the next item of the local priority queue. On a node that
+// is not the leader, it may not hold the latest writes yet.
+func (n *Node) Peek() (*goque.PriorityItem, error) {
+	n.fsm.mu.RLock()
+	defer n.fsm.mu.RUnlock()
+
+	return n.fsm.pq.Peek()
+}
+
+// Length returns the number of items in the local priority queue. On a
+// node that is not the leader, it may not hold the latest writes yet.
+func (n *Node) Length() uint64 {
+	n.fsm.mu.RLock()
+	defer n.fsm.mu.RUnlock()
+
+	stats, err := n.fsm.pq.Stats()
+	if err != nil {
+		return 0
+	}
+
+	return stats.Length
+}
+
+// apply applies a command through the Raft log, returning its result.
+func (n *Node) apply(cmd []byte) (*goque.PriorityItem, error) {
+	future := n.raft.Apply(cmd, n.opts.ApplyTimeout)
+	if err := leaderError(future.Error()); err != nil {
+		return nil, err
+	}
+
+	res := future.Response().(*result)
+	return res.item, res.err
+}
+
+// leaderError returns ErrNotLeader for the Raft error of a node that is
+// not the leader, and other errors as they are.
+func leaderError(err error) error {
+	if err == raft.ErrNotLeader {
+		return ErrNotLeader
+	}
+
+	return err
+}
+
+// Close shuts the node down. It stays a member of the cluster, and
+// catches up with the writes it missed once opened again.
+func (n *Node) Close() error {
+	var err error
+	if n.raft != nil {
+		err = n.raft.Shutdown().Error()
+	}
+	if n.transport != nil {
+		if cerr := n.transport.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if n.logs != nil {
+		if cerr := n.logs.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if n.fsm != nil {
+		if cerr := n.fsm.pq.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
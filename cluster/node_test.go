@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/hashicorp/raft"
+)
+
+// testConfig returns a Raft configuration electing a leader quickly.
+func testConfig() *raft.Config {
+	config := raft.DefaultConfig()
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+
+	return config
+}
+
+// openNode opens a node in dir on a local port.
+func openNode(t *testing.T, id, dir string, bootstrap bool) *Node {
+	n, err := Open(Options{
+		ID:        id,
+		Dir:       dir,
+		BindAddr:  "127.0.0.1:0",
+		Bootstrap: bootstrap,
+		Config:    testConfig(),
+		LogOutput: ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+// waitLeader waits for one of the nodes to become the leader.
+func waitLeader(t *testing.T, nodes ...*Node) *Node {
+	for i := 0; i < 500; i++ {
+		for _, n := range nodes {
+			if n.IsLeader() {
+				return n
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("Expected a leader to be elected")
+	return nil
+}
+
+// waitLength waits for the local priority queue of a node to hold n
+// items.
+func waitLength(t *testing.T, node *Node, n uint64) {
+	for i := 0; i < 500 && node.Length() != n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if node.Length() != n {
+		t.Fatalf("Expected %d items on node %s, got %d", n, node.opts.ID, node.Length())
+	}
+}
+
+func TestCluster(t *testing.T) {
+	base := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	defer os.RemoveAll(base)
+
+	var nodes []*Node
+	for i := 1; i <= 3; i++ {
+		n := openNode(t, fmt.Sprintf("node%d", i), fmt.Sprintf("%s/node%d", base, i), i == 1)
+		defer n.Close()
+		nodes = append(nodes, n)
+	}
+
+	leader := waitLeader(t, nodes[0])
+	for _, n := range nodes[1:] {
+		if err := leader.Join(n.opts.ID, n.Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i <= 4; i++ {
+		item := goque.NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))
+		item.Headers = map[string]string{"n": fmt.Sprint(i)}
+		if err := leader.Enqueue(item); err != nil {
+			t.Fatal(err)
+		}
+		if item.ID == 0 || item.CreatedAt.IsZero() {
+			t.Errorf("Expected the enqueued item to get an ID and creation time, got %+v", item)
+		}
+	}
+
+	item, err := leader.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value for item 2" || item.Headers["n"] != "2" {
+		t.Errorf("Expected item 2 with its headers, got %s %v", item.ToString(), item.Headers)
+	}
+
+	// Every node applies the writes.
+	for _, n := range nodes {
+		waitLength(t, n, 3)
+	}
+
+	// Followers don't accept writes.
+	for _, n := range nodes {
+		if n == leader {
+			continue
+		}
+		if err := n.Enqueue(goque.NewPriorityItemString("value", 0)); err != ErrNotLeader {
+			t.Errorf("Expected ErrNotLeader, got %v", err)
+		}
+		if n.Leader() != leader.Addr() {
+			t.Errorf("Expected the leader to be %s, got %s", leader.Addr(), n.Leader())
+		}
+	}
+
+	// The cluster keeps going without its leader.
+	if err := leader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	leader = waitLeader(t, nodes[1], nodes[2])
+
+	item, err = leader.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value for item 4" {
+		t.Errorf("Expected item 4 from the new leader, got %s", item.ToString())
+	}
+}
+
+func TestNodeRestart(t *testing.T) {
+	dir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	defer os.RemoveAll(dir)
+
+	n := openNode(t, "node1", dir, true)
+	waitLeader(t, n)
+	for i := 1; i <= 3; i++ {
+		if err := n.Enqueue(goque.NewPriorityItemString(fmt.Sprint(i), 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := n.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The priority queue is rebuilt from the Raft log, without applying
+	// any command twice.
+	n = openNode(t, "node1", dir, true)
+	defer n.Close()
+	waitLeader(t, n)
+	waitLength(t, n, 2)
+
+	item, err := n.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "2" {
+		t.Errorf("Expected item 2, got %s", item.ToString())
+	}
+
+	if _, err = n.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n.Dequeue(); err != goque.ErrEmpty {
+		t.Errorf("Expected goque.ErrEmpty, got %v", err)
+	}
+}
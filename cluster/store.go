@@ -0,0 +1,227 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The key prefixes of the Raft log entries and of the stable values.
+var (
+	logPrefix    = []byte("log:")
+	stablePrefix = []byte("stable:")
+)
+
+// syncWrites makes the writes to the log store durable before they
+// return, as Raft requires.
+var syncWrites = &opt.WriteOptions{Sync: true}
+
+// errLogCorrupt is returned when reading a Raft log entry that can't be
+// decoded.
+var errLogCorrupt = errors.New("cluster: Raft log entry is corrupt")
+
+// logStore keeps the Raft log and stable values in a LevelDB database.
+type logStore struct {
+	db *leveldb.DB
+}
+
+// The logStore is both stores Raft needs.
+var (
+	_ raft.LogStore    = (*logStore)(nil)
+	_ raft.StableStore = (*logStore)(nil)
+)
+
+// openLogStore opens the log store in the given directory.
+func openLogStore(dir string) (*logStore, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logStore{db: db}, nil
+}
+
+// logKey returns the key of the log entry at the given index.
+func logKey(index uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], index)
+
+	return key
+}
+
+// FirstIndex returns the index of the first log entry, or 0 if the log
+// is empty.
+func (s *logStore) FirstIndex() (uint64, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		return 0, iter.Error()
+	}
+
+	return binary.BigEndian.Uint64(iter.Key()[len(logPrefix):]), nil
+}
+
+// LastIndex returns the index of the last log entry, or 0 if the log is
+// empty.
+func (s *logStore) LastIndex() (uint64, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		return 0, iter.Error()
+	}
+
+	return binary.BigEndian.Uint64(iter.Key()[len(logPrefix):]), nil
+}
+
+// GetLog gets the log entry at the given index.
+func (s *logStore) GetLog(index uint64, log *raft.Log) error {
+	data, err := s.db.Get(logKey(index), nil)
+	if err == leveldb.ErrNotFound {
+		return raft.ErrLogNotFound
+	} else if err != nil {
+		return err
+	}
+
+	log.Index = index
+	return decodeLog(data, log)
+}
+
+// StoreLog stores a log entry.
+func (s *logStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores log entries atomically.
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	batch := new(leveldb.Batch)
+	for _, log := range logs {
+		batch.Put(logKey(log.Index), encodeLog(log))
+	}
+
+	return s.db.Write(batch, syncWrites)
+}
+
+// DeleteRange deletes the log entries from min to max, inclusive.
+func (s *logStore) DeleteRange(min, max uint64) error {
+	iter := s.db.NewIterator(&util.Range{Start: logKey(min), Limit: logKey(max + 1)}, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return s.db.Write(batch, nil)
+}
+
+// Set sets a stable value.
+func (s *logStore) Set(key, value []byte) error {
+	return s.db.Put(append(append([]byte{}, stablePrefix...), key...), value, syncWrites)
+}
+
+// Get gets a stable value, which is empty if it was never set.
+func (s *logStore) Get(key []byte) ([]byte, error) {
+	value, err := s.db.Get(append(append([]byte{}, stablePrefix...), key...), nil)
+	if err == leveldb.ErrNotFound {
+		return []byte{}, nil
+	}
+
+	return value, err
+}
+
+// SetUint64 sets a stable number.
+func (s *logStore) SetUint64(key []byte, value uint64) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, value)
+
+	return s.Set(key, data)
+}
+
+// GetUint64 gets a stable number, which is 0 if it was never set.
+func (s *logStore) GetUint64(key []byte) (uint64, error) {
+	data, err := s.Get(key)
+	if err != nil || len(data) == 0 {
+		return 0, err
+	} else if len(data) != 8 {
+		return 0, errLogCorrupt
+	}
+
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// Close closes the database.
+func (s *logStore) Close() error {
+	return s.db.Close()
+}
+
+// encodeLog encodes a log entry.
+func encodeLog(log *raft.Log) []byte {
+	// term + type + appended at + data + extensions
+	data := make([]byte, 17, 17+2*binary.MaxVarintLen64+len(log.Data)+len(log.Extensions))
+	binary.BigEndian.PutUint64(data, log.Term)
+	data[8] = byte(log.Type)
+	var appendedAt int64
+	if !log.AppendedAt.IsZero() {
+		appendedAt = log.AppendedAt.UnixNano()
+	}
+	binary.BigEndian.PutUint64(data[9:], uint64(appendedAt))
+
+	data = appendBytes(data, log.Data)
+	return appendBytes(data, log.Extensions)
+}
+
+// decodeLog decodes a log entry.
+func decodeLog(data []byte, log *raft.Log) error {
+	if len(data) < 17 {
+		return errLogCorrupt
+	}
+
+	log.Term = binary.BigEndian.Uint64(data)
+	log.Type = raft.LogType(data[8])
+	log.AppendedAt = time.Time{}
+	if ns := int64(binary.BigEndian.Uint64(data[9:])); ns != 0 {
+		log.AppendedAt = time.Unix(0, ns)
+	}
+
+	var ok bool
+	data = data[17:]
+	if log.Data, data, ok = readBytes(data); !ok {
+		return errLogCorrupt
+	}
+	if log.Extensions, _, ok = readBytes(data); !ok {
+		return errLogCorrupt
+	}
+
+	return nil
+}
+
+// appendBytes appends a length-prefixed field to data.
+func appendBytes(data, field []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(field)))
+
+	return append(append(data, buf[:n]...), field...)
+}
+
+// readBytes reads a length-prefixed field from data, returning the
+// field and the rest of data.
+func readBytes(data []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, false
+	}
+	data = data[n:]
+
+	return data[:length:length], data[length:], true
+}
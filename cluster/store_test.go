@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestLogStore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := openLogStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	defer s.Close()
+
+	if first, err := s.FirstIndex(); err != nil || first != 0 {
+		t.Errorf("Expected an empty log to start at 0, got %d (%v)", first, err)
+	}
+
+	appendedAt := time.Now()
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, &raft.Log{
+			Index:      i,
+			Term:       2,
+			Type:       raft.LogCommand,
+			Data:       []byte(fmt.Sprintf("command %d", i)),
+			Extensions: []byte("ext"),
+			AppendedAt: appendedAt,
+		})
+	}
+	if err = s.StoreLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	var log raft.Log
+	if err = s.GetLog(3, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Index != 3 || log.Term != 2 || log.Type != raft.LogCommand || string(log.Data) != "command 3" ||
+		string(log.Extensions) != "ext" || !log.AppendedAt.Equal(appendedAt) {
+		t.Errorf("Expected log entry 3 to be read back, got %+v", log)
+	}
+
+	if err = s.DeleteRange(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+	if first != 3 || last != 5 {
+		t.Errorf("Expected the log to span 3 to 5, got %d to %d", first, last)
+	}
+	if err = s.GetLog(1, &log); err != raft.ErrLogNotFound {
+		t.Errorf("Expected raft.ErrLogNotFound for a deleted entry, got %v", err)
+	}
+}
+
+func TestLogStoreStable(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := openLogStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	defer s.Close()
+
+	if value, err := s.Get([]byte("missing")); err != nil || len(value) != 0 {
+		t.Errorf("Expected a missing value to be empty, got %q (%v)", value, err)
+	}
+	if n, err := s.GetUint64([]byte("missing")); err != nil || n != 0 {
+		t.Errorf("Expected a missing number to be 0, got %d (%v)", n, err)
+	}
+
+	if err = s.Set([]byte("vote"), []byte("node1")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SetUint64([]byte("term"), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := s.Get([]byte("vote")); string(value) != "node1" {
+		t.Errorf("Expected node1, got %q", value)
+	}
+	if n, _ := s.GetUint64([]byte("term")); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+
+	// Stable values are not log entries.
+	if last, _ := s.LastIndex(); last != 0 {
+		t.Errorf("Expected the log to stay empty, got last index %d", last)
+	}
+}
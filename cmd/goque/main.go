@@ -0,0 +1,325 @@
+// Command goque inspects and administers the data directory of a Goque
+// stack, queue or priority queue.
+//
+// Usage:
+//
+//	goque <command> [flags] <dir> [args]
+//
+// The commands are:
+//
+//	stats                print the length, priority levels and disk usage
+//	peek <dir> <n>       print the next n items as JSON lines
+//	dump                 write every item as JSON lines to stdout
+//	import               add the items read as JSON lines from stdin
+//	compact              compact the data directory
+//	clear                remove every item
+//	drop                 delete the data directory, which needs -force
+//	convert <dir> <dst>  copy every item into a new data directory of
+//	                     the type given by -to
+//
+// Items are listed in dequeue order. Each JSON line holds the priority,
+// ID, base64 value and metadata of an item. The type of the data
+// directory is read from its 'GOQUE' file unless -type is given.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// The types of data directory the command handles.
+const (
+	typeStack  = "stack"
+	typeQueue  = "queue"
+	typePQueue = "pqueue"
+)
+
+// errUsage is returned for invalid command lines, after printing the
+// usage.
+var errUsage = errors.New("invalid usage")
+
+// record is an item as written by dump and read by import.
+type record struct {
+	Priority  *uint8            `json:"priority,omitempty"`
+	ID        uint64            `json:"id"`
+	Value     []byte            `json:"value"`
+	Attempts  uint32            `json:"attempts,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// options are the flags shared by the commands.
+type options struct {
+	typ      string
+	to       string
+	order    string
+	priority uint
+	force    bool
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, "goque:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command line given by args.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return errUsage
+	}
+	cmd := args[0]
+
+	var o options
+	fs := flag.NewFlagSet("goque "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr) }
+	fs.StringVar(&o.typ, "type", "", "type of the data directory: stack, queue or pqueue")
+	fs.StringVar(&o.to, "to", "", "type of the destination of convert")
+	fs.StringVar(&o.order, "order", "asc", "priority order of a pqueue: asc, desc or rr")
+	fs.UintVar(&o.priority, "priority", 0, "priority of imported items that have none")
+	fs.BoolVar(&o.force, "force", false, "allow drop to delete the data directory")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	// Check the number of arguments of the command.
+	want := map[string]int{
+		"stats": 1, "peek": 2, "dump": 1, "import": 1,
+		"compact": 1, "clear": 1, "drop": 1, "convert": 2,
+	}
+	n, ok := want[cmd]
+	if !ok || fs.NArg() != n {
+		usage(stderr)
+		return errUsage
+	}
+	dir := fs.Arg(0)
+
+	if cmd == "drop" && !o.force {
+		return errors.New("drop deletes the data directory, pass -force to confirm")
+	}
+
+	// Open the data directory.
+	typ := o.typ
+	if typ == "" {
+		var err error
+		if typ, err = detectType(dir); err != nil {
+			return err
+		}
+	}
+	st, err := open(typ, dir, o.order)
+	if err != nil {
+		return err
+	}
+	if cmd == "drop" {
+		return st.drop()
+	}
+
+	err = runCommand(cmd, st, fs.Args()[1:], o, stdin, stdout)
+	if cerr := st.close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// runCommand runs the given command other than drop on the opened data
+// structure.
+func runCommand(cmd string, st structure, args []string, o options, stdin io.Reader, stdout io.Writer) error {
+	switch cmd {
+	case "stats":
+		stats, err := st.stats()
+		if err != nil {
+			return err
+		}
+		return printStats(stdout, stats)
+
+	case "peek":
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of items %q", args[0])
+		}
+		return dump(stdout, st, n)
+
+	case "dump":
+		return dump(stdout, st, -1)
+
+	case "import":
+		return load(st, stdin, uint8(o.priority))
+
+	case "compact":
+		return st.compact()
+
+	case "clear":
+		return st.clear()
+
+	case "convert":
+		if o.to == "" {
+			return errors.New("convert needs the destination type given by -to")
+		}
+		dst, err := create(o.to, args[0], o.order)
+		if err != nil {
+			return err
+		}
+		err = copyRecords(dst, func(fn func(r *record) error) error {
+			return st.each(-1, fn)
+		}, uint8(o.priority))
+		if cerr := dst.close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	return errUsage
+}
+
+// usage prints the usage of the command.
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: goque <command> [flags] <dir> [args]
+
+Commands:
+  stats                print the length, priority levels and disk usage
+  peek <dir> <n>       print the next n items as JSON lines
+  dump                 write every item as JSON lines to stdout
+  import               add the items read as JSON lines from stdin
+  compact              compact the data directory
+  clear                remove every item
+  drop                 delete the data directory, which needs -force
+  convert <dir> <dst>  copy every item into a new data directory of the
+                       type given by -to
+
+Flags:
+  -type string      type of the data directory: stack, queue or pqueue
+                    (read from the data directory by default)
+  -to string        type of the destination of convert
+  -order string     priority order of a pqueue: asc, desc or rr (default asc)
+  -priority uint    priority of imported items that have none
+  -force            allow drop to delete the data directory
+`)
+}
+
+// detectType returns the type of the given data directory.
+func detectType(dir string) (string, error) {
+	name, err := goque.DataDirType(dir)
+	if err != nil {
+		return "", err
+	}
+
+	switch name {
+	case "stack":
+		return typeStack, nil
+	case "queue":
+		return typeQueue, nil
+	case "priority queue":
+		return typePQueue, nil
+	}
+
+	return "", fmt.Errorf("unsupported data directory type %q", name)
+}
+
+// printStats prints the given stats.
+func printStats(w io.Writer, stats *goque.Stats) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "length:     %d\n", stats.Length)
+	for _, level := range stats.Levels {
+		fmt.Fprintf(bw, "priority %d: %d\n", level.Priority, level.Length)
+	}
+	if stats.DiskUsage >= 0 {
+		fmt.Fprintf(bw, "disk usage: %d bytes\n", stats.DiskUsage)
+	}
+	if !stats.Next.IsZero() {
+		fmt.Fprintf(bw, "head age:   %s\n", time.Since(stats.Next).Round(time.Millisecond))
+	}
+	if ldb := stats.LevelDB; ldb != nil {
+		for i := range ldb.LevelSizes {
+			fmt.Fprintf(bw, "level %d:    %d tables, %d bytes\n", i, ldb.LevelTablesCounts[i], ldb.LevelSizes[i])
+		}
+	}
+
+	return bw.Flush()
+}
+
+// dump writes up to max items of the data structure as JSON lines, or
+// every item if max is negative.
+func dump(w io.Writer, st structure, max int) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := st.each(max, func(r *record) error { return enc.Encode(r) }); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// importBatchSize is the number of items added at once by import and
+// convert.
+const importBatchSize = 1000
+
+// load adds the items read as JSON lines to the data structure, giving
+// the given priority to items that have none.
+func load(st structure, r io.Reader, priority uint8) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	return copyRecords(st, func(fn func(r *record) error) error {
+		for {
+			rec := new(record)
+			err := dec.Decode(rec)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if err = fn(rec); err != nil {
+				return err
+			}
+		}
+	}, priority)
+}
+
+// copyRecords adds the records passed to fn by each to the data
+// structure in batches, giving the given priority to records that have
+// none. The records of a stack are added at once, as they go below each
+// other.
+func copyRecords(dst structure, each func(fn func(r *record) error) error, priority uint8) error {
+	var batch []*record
+	err := each(func(r *record) error {
+		batch = append(batch, withPriority(r, priority))
+		if len(batch) < importBatchSize || dst.lifo() {
+			return nil
+		}
+
+		err := dst.add(batch)
+		batch = nil
+		return err
+	})
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+
+	return dst.add(batch)
+}
+
+// withPriority returns the record, giving it the given priority if it
+// has none.
+func withPriority(r *record, priority uint8) *record {
+	if r.Priority == nil {
+		r.Priority = &priority
+	}
+
+	return r
+}
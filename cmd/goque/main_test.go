@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+func TestDumpImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		item := goque.NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))
+		item.Headers = map[string]string{"n": fmt.Sprint(i)}
+		if err = pq.Enqueue(item); err != nil {
+			t.Error(err)
+		}
+	}
+	pq.Close()
+	defer os.RemoveAll(file)
+
+	// Dump the priority queue.
+	var out bytes.Buffer
+	if err = run([]string{"dump", file}, nil, &out, os.Stderr); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"priority":0`) {
+		t.Errorf("Expected 3 lines starting with priority 0, got %q", out.String())
+	}
+
+	// Peek at the first item only.
+	var peek bytes.Buffer
+	if err = run([]string{"peek", file, "1"}, nil, &peek, os.Stderr); err != nil {
+		t.Error(err)
+	}
+	if strings.TrimSpace(peek.String()) != lines[0] {
+		t.Errorf("Expected '%s', got '%s'", lines[0], peek.String())
+	}
+
+	// Import the dump into a new priority queue.
+	dst := file + "_import"
+	defer os.RemoveAll(dst)
+	if err = run([]string{"import", "-type", "pqueue", dst}, strings.NewReader(out.String()), &bytes.Buffer{}, os.Stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	pq, err = goque.OpenPriorityQueue(dst, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.Close()
+
+	for _, want := range []string{"value for item 2", "value for item 1", "value for item 3"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+		if item.Headers["n"] != want[len(want)-1:] {
+			t.Errorf("Expected header n=%s, got %v", want[len(want)-1:], item.Headers)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(goque.NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	s.Close()
+	defer os.RemoveAll(file)
+
+	// Convert the stack into a stack and a queue, which keep the pop
+	// order.
+	for _, typ := range []string{"stack", "queue"} {
+		dst := file + "_" + typ
+		defer os.RemoveAll(dst)
+		if err = run([]string{"convert", "-to", typ, file, dst}, nil, &bytes.Buffer{}, os.Stderr); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err = run([]string{"dump", dst}, nil, &out, os.Stderr); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 3 || !strings.Contains(lines[0], `"value":"dmFsdWUgZm9yIGl0ZW0gMw=="`) {
+			t.Errorf("Expected 3 lines starting with item 3 for a %s, got %q", typ, out.String())
+		}
+	}
+
+	// Converting into a data directory holding items fails.
+	if err = run([]string{"convert", "-to", "queue", file, file + "_queue"}, nil, &bytes.Buffer{}, os.Stderr); err == nil {
+		t.Error("Expected an error converting into a non-empty data directory")
+	}
+}
+
+func TestStatsClearDrop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	q.Close()
+	defer os.RemoveAll(file)
+
+	var out bytes.Buffer
+	if err = run([]string{"stats", file}, nil, &out, os.Stderr); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(out.String(), "length:     3") {
+		t.Errorf("Expected a length of 3, got %q", out.String())
+	}
+
+	for _, cmd := range []string{"compact", "clear"} {
+		if err = run([]string{cmd, file}, nil, &out, os.Stderr); err != nil {
+			t.Error(err)
+		}
+	}
+	out.Reset()
+	if err = run([]string{"stats", file}, nil, &out, os.Stderr); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(out.String(), "length:     0") {
+		t.Errorf("Expected a length of 0, got %q", out.String())
+	}
+
+	// Drop needs -force.
+	if err = run([]string{"drop", file}, nil, &out, os.Stderr); err == nil {
+		t.Error("Expected drop without -force to fail")
+	}
+	if err = run([]string{"drop", "-force", file}, nil, &out, os.Stderr); err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected the data directory to be deleted, got %v", err)
+	}
+
+	var stderr bytes.Buffer
+	if err = run([]string{"bogus"}, nil, &out, &stderr); err != errUsage {
+		t.Errorf("Expected to get usage error, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Usage: goque") {
+		t.Errorf("Expected the usage, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/beeker1121/goque"
+)
+
+// structure is an open data structure the commands work on.
+type structure interface {
+	// each calls fn with up to max items in dequeue order, or with
+	// every item if max is negative.
+	each(max int, fn func(r *record) error) error
+
+	// add adds the given items, which are dequeued after the items
+	// already there. For a stack they must hold every item to add, in
+	// dequeue order, as they go below each other.
+	add(rs []*record) error
+
+	// lifo reports whether items added later are dequeued first.
+	lifo() bool
+
+	stats() (*goque.Stats, error)
+	compact() error
+	clear() error
+	close() error
+	drop() error
+}
+
+// open opens the data directory of the given type.
+func open(typ, dir, order string) (structure, error) {
+	switch typ {
+	case typeStack:
+		s, err := goque.OpenStack(dir)
+		if err != nil {
+			return nil, err
+		}
+		return &stack{s}, nil
+
+	case typeQueue:
+		q, err := goque.OpenQueue(dir)
+		if err != nil {
+			return nil, err
+		}
+		return &queue{q}, nil
+
+	case typePQueue:
+		o := goque.ASC
+		switch order {
+		case "asc":
+		case "desc":
+			o = goque.DESC
+		case "rr":
+			o = goque.RR
+		default:
+			return nil, fmt.Errorf("invalid priority order %q", order)
+		}
+		pq, err := goque.OpenPriorityQueue(dir, o)
+		if err != nil {
+			return nil, err
+		}
+		return &pqueue{pq}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
+
+// create opens a new data directory of the given type, returning an
+// error if the directory already holds items.
+func create(typ, dir, order string) (structure, error) {
+	st, err := open(typ, dir, order)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := st.stats()
+	if err == nil && stats.Length > 0 {
+		err = fmt.Errorf("%s already holds %d items", dir, stats.Length)
+	}
+	if err != nil {
+		st.close()
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// stack is a Goque stack.
+type stack struct {
+	s *goque.Stack
+}
+
+func (st *stack) each(max int, fn func(r *record) error) error {
+	it, err := st.s.Iterator(goque.TopDown)
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	for n := 0; n != max && it.Next(); n++ {
+		if err = fn(itemRecord(it.Item())); err != nil {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
+func (st *stack) add(rs []*record) error {
+	items := make([]*goque.Item, len(rs))
+	for i, r := range rs {
+		items[len(rs)-1-i] = recordItem(r)
+	}
+
+	_, err := st.s.PushBatch(items)
+	return err
+}
+
+func (st *stack) lifo() bool                   { return true }
+func (st *stack) stats() (*goque.Stats, error) { return st.s.Stats() }
+func (st *stack) compact() error               { return st.s.Compact() }
+func (st *stack) clear() error                 { return st.s.Clear() }
+func (st *stack) close() error                 { return st.s.Close() }
+func (st *stack) drop() error                  { return st.s.ForceDrop() }
+
+// queue is a Goque queue.
+type queue struct {
+	q *goque.Queue
+}
+
+func (st *queue) each(max int, fn func(r *record) error) error {
+	for n := 0; n != max; n++ {
+		item, err := st.q.PeekByOffset(uint64(n))
+		if err == goque.ErrEmpty || err == goque.ErrOutOfBounds {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err = fn(itemRecord(item)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (st *queue) add(rs []*record) error {
+	for _, r := range rs {
+		if err := st.q.Enqueue(recordItem(r)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (st *queue) clear() error {
+	for {
+		n, err := st.q.DrainTo(goque.ItemWriterFunc(func(items []*goque.Item) (int, error) {
+			return len(items), nil
+		}), importBatchSize)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+func (st *queue) lifo() bool                   { return false }
+func (st *queue) stats() (*goque.Stats, error) { return st.q.Stats() }
+func (st *queue) compact() error               { return st.q.Compact() }
+func (st *queue) close() error                 { return st.q.Close() }
+func (st *queue) drop() error                  { return st.q.ForceDrop() }
+
+// pqueue is a Goque priority queue.
+type pqueue struct {
+	pq *goque.PriorityQueue
+}
+
+func (st *pqueue) each(max int, fn func(r *record) error) error {
+	it, err := st.pq.Iterator()
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	for n := 0; n != max && it.Next(); n++ {
+		item := it.Item()
+		r := itemRecord(&goque.Item{
+			ID:        item.ID,
+			Value:     item.Value,
+			Headers:   item.Headers,
+			CreatedAt: item.CreatedAt,
+			UpdatedAt: item.UpdatedAt,
+		})
+		r.Priority = &item.Priority
+		r.Attempts = item.Attempts
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
+func (st *pqueue) add(rs []*record) error {
+	items := make([]*goque.PriorityItem, len(rs))
+	for i, r := range rs {
+		var priority uint8
+		if r.Priority != nil {
+			priority = *r.Priority
+		}
+		items[i] = goque.NewPriorityItem(r.Value, priority)
+		items[i].Attempts = r.Attempts
+		items[i].Headers = r.Headers
+		items[i].CreatedAt = r.CreatedAt
+		items[i].UpdatedAt = r.UpdatedAt
+	}
+
+	_, err := st.pq.EnqueueBatch(items)
+	return err
+}
+
+func (st *pqueue) lifo() bool                   { return false }
+func (st *pqueue) stats() (*goque.Stats, error) { return st.pq.Stats() }
+func (st *pqueue) compact() error               { return st.pq.Compact() }
+func (st *pqueue) clear() error                 { return st.pq.Clear() }
+func (st *pqueue) close() error                 { return st.pq.Close() }
+func (st *pqueue) drop() error                  { return st.pq.ForceDrop() }
+
+// itemRecord returns the record of the given item.
+func itemRecord(item *goque.Item) *record {
+	return &record{
+		ID:        item.ID,
+		Value:     item.Value,
+		Headers:   item.Headers,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
+
+// recordItem returns a new item holding the given record.
+func recordItem(r *record) *goque.Item {
+	item := goque.NewItem(r.Value)
+	item.Headers = r.Headers
+	item.CreatedAt = r.CreatedAt
+	item.UpdatedAt = r.UpdatedAt
+
+	return item
+}
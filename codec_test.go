@@ -0,0 +1,23 @@
+package goque
+
+import (
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		data, err := codec.Marshal(object{Name: "value", Count: 3})
+		if err != nil {
+			t.Error(err)
+		}
+
+		var obj object
+		if err = codec.Unmarshal(data, &obj); err != nil {
+			t.Error(err)
+		}
+
+		if obj.Name != "value" || obj.Count != 3 {
+			t.Errorf("Expected object to be {value 3}, got %v", obj)
+		}
+	}
+}
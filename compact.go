@@ -0,0 +1,245 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Compacter is implemented by a Store that can compact a range of its
+// keys, which Compact and automatic compaction need. The LevelDB
+// database implements it.
+type Compacter interface {
+	CompactRange(r util.Range) error
+}
+
+// AutoCompact triggers a compaction of the whole store once enough
+// items were deleted since the last one. A zero limit is never reached.
+type AutoCompact struct {
+	Deletes uint64 // Number of deleted items.
+	Bytes   uint64 // Total size of the deleted item values.
+}
+
+// compaction tracks the deletions towards an automatic compaction. It
+// is protected by the lock of the data structure it belongs to, and a
+// nil compaction never compacts.
+type compaction struct {
+	AutoCompact
+	deletes uint64
+	bytes   uint64
+}
+
+// deleted records that n items of the given total size were deleted
+// from the store, compacting it if that reaches one of the limits.
+//
+// The deletions were already written, so a failed compaction is only
+// reported to the logger. It is tried again on the next deletion.
+func (c *compaction) deleted(db Store, log *logger, n, size uint64) {
+	if c == nil || n == 0 {
+		return
+	}
+
+	c.deletes += n
+	c.bytes += size
+	if (c.Deletes == 0 || c.deletes < c.Deletes) && (c.Bytes == 0 || c.bytes < c.Bytes) {
+		return
+	}
+
+	start := time.Now()
+	if err := compactStore(db, util.Range{}); err != nil {
+		log.warn("goque: Automatic compaction failed", "error", err)
+		return
+	}
+	log.info("goque: Compacted the store", "deletes", c.deletes, "bytes", c.bytes, "duration", time.Since(start))
+	c.deletes = 0
+	c.bytes = 0
+}
+
+// compactStore compacts the keys of the store in the given range,
+// returning ErrCompactUnsupported if the store can't compact.
+func compactStore(db Store, r util.Range) error {
+	if c, ok := db.(Compacter); ok {
+		return c.CompactRange(r)
+	}
+
+	return ErrCompactUnsupported
+}
+
+// Compact compacts the whole store of the priority queue, reclaiming
+// the space of deleted items.
+func (pq *PriorityQueue) Compact() error {
+	return pq.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the priority queue's store in the
+// given range. A nil Start or Limit leaves that end of the range open.
+func (pq *PriorityQueue) CompactRange(r util.Range) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return compactStore(pq.db, r)
+}
+
+// SetAutoCompact makes the priority queue compact its store once the
+// given number of items or bytes were deleted since the last
+// compaction. The operation deleting the items that reach the limit
+// compacts the store before it returns. A zero AutoCompact turns
+// automatic compaction off.
+func (pq *PriorityQueue) SetAutoCompact(a AutoCompact) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	pq.compact = newCompaction(a)
+	return nil
+}
+
+// Compact compacts the whole store of the stack, reclaiming the space
+// of deleted items.
+func (s *Stack) Compact() error {
+	return s.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the stack's store in the given
+// range. A nil Start or Limit leaves that end of the range open.
+func (s *Stack) CompactRange(r util.Range) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	return compactStore(s.db, r)
+}
+
+// SetAutoCompact makes the stack compact its store once the given
+// number of items or bytes were deleted since the last compaction, the
+// same way as PriorityQueue.SetAutoCompact.
+func (s *Stack) SetAutoCompact(a AutoCompact) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	s.compact = newCompaction(a)
+	return nil
+}
+
+// newCompaction returns the compaction tracking the given limits, or
+// nil if there are none.
+func newCompaction(a AutoCompact) *compaction {
+	if a == (AutoCompact{}) {
+		return nil
+	}
+
+	return &compaction{AutoCompact: a}
+}
+
+// Compact compacts the whole LevelDB database of the queue, reclaiming
+// the space of dequeued items.
+func (q *Queue) Compact() error {
+	return q.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the queue's LevelDB database in the
+// given range. A nil Start or Limit leaves that end of the range open.
+func (q *Queue) CompactRange(r util.Range) error {
+	q.RLock()
+	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	return q.db.CompactRange(r)
+}
+
+// Compact compacts the whole LevelDB database of the deque, reclaiming
+// the space of popped items.
+func (d *Deque) Compact() error {
+	return d.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the deque's LevelDB database in the
+// given range. A nil Start or Limit leaves that end of the range open.
+func (d *Deque) CompactRange(r util.Range) error {
+	d.RLock()
+	defer d.RUnlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return ErrDBClosed
+	}
+
+	return d.db.CompactRange(r)
+}
+
+// Compact compacts the whole LevelDB database of the prefix queue,
+// reclaiming the space of dequeued items.
+func (pq *PrefixQueue) Compact() error {
+	return pq.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the prefix queue's LevelDB database
+// in the given range. A nil Start or Limit leaves that end of the range
+// open.
+func (pq *PrefixQueue) CompactRange(r util.Range) error {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return pq.db.CompactRange(r)
+}
+
+// Compact compacts the whole LevelDB database of the delay queue,
+// reclaiming the space of dequeued items.
+func (dq *DelayQueue) Compact() error {
+	return dq.CompactRange(util.Range{})
+}
+
+// CompactRange compacts the keys of the delay queue's LevelDB database
+// in the given range. A nil Start or Limit leaves that end of the range
+// open.
+func (dq *DelayQueue) CompactRange(r util.Range) error {
+	dq.RLock()
+	defer dq.RUnlock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		return ErrDBClosed
+	}
+
+	return dq.db.CompactRange(r)
+}
+
+// Compact compacts the whole LevelDB database of the retry queue,
+// reclaiming the space of dequeued items.
+func (rq *RetryQueue) Compact() error {
+	return rq.dq.Compact()
+}
+
+// CompactRange compacts the keys of the retry queue's LevelDB database
+// in the given range. A nil Start or Limit leaves that end of the range
+// open.
+func (rq *RetryQueue) CompactRange(r util.Range) error {
+	return rq.dq.CompactRange(r)
+}
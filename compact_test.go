@@ -0,0 +1,149 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestPriorityQueueCompact(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = pq.Compact(); err != nil {
+		t.Error(err)
+	}
+	if err = pq.CompactRange(util.Range{Start: pq.generatePrefix(0), Limit: pq.generatePrefix(1)}); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+
+	// A store that can't compact reports it.
+	pq.db = struct{ Store }{pq.db}
+	if err = pq.Compact(); err != ErrCompactUnsupported {
+		t.Errorf("Expected to get compaction unsupported error, got %v", err)
+	}
+}
+
+func TestPriorityQueueAutoCompact(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetAutoCompact(AutoCompact{Deletes: 3}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The third deletion compacts the store, starting the count over.
+	for i := 0; i < 4; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+	if pq.compact.deletes != 1 {
+		t.Errorf("Expected 1 deletion since the last compaction, got %d", pq.compact.deletes)
+	}
+
+	// Deletions in a batch count as well.
+	if _, err = pq.DequeueBatch(2); err != nil {
+		t.Error(err)
+	}
+	if pq.compact.deletes != 0 {
+		t.Errorf("Expected 0 deletions since the last compaction, got %d", pq.compact.deletes)
+	}
+
+	// A zero AutoCompact turns it off.
+	if err = pq.SetAutoCompact(AutoCompact{}); err != nil {
+		t.Error(err)
+	}
+	if pq.compact != nil {
+		t.Error("Expected automatic compaction to be off")
+	}
+}
+
+func TestStackAutoCompact(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.SetAutoCompact(AutoCompact{Bytes: 20}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Each value is 7 bytes, so the third pop reaches the limit.
+	for i := 0; i < 2; i++ {
+		if _, err = s.Pop(); err != nil {
+			t.Error(err)
+		}
+	}
+	if s.compact.bytes != 14 {
+		t.Errorf("Expected 14 bytes since the last compaction, got %d", s.compact.bytes)
+	}
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+	if s.compact.bytes != 0 {
+		t.Errorf("Expected 0 bytes since the last compaction, got %d", s.compact.bytes)
+	}
+
+	if err = s.Compact(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompactClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.Compact(); err != nil {
+		t.Error(err)
+	}
+
+	q.Close()
+
+	if err = q.Compact(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package goque
+
+import (
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// envelopeCompressed starts a compressed envelope, which holds the
+// Compression it was compressed with followed by the compressed
+// envelope:
+//
+//	version + compression (1) + compressed envelope
+const envelopeCompressed byte = 0x20
+
+// Compression defines the codec the values of items are compressed
+// with. It is stored with every compressed value, so values compressed
+// with any of them can always be read.
+type Compression uint8
+
+// The possible compressions.
+const (
+	// CompressionNone stores values as they are.
+	CompressionNone Compression = 0
+
+	// CompressionSnappy compresses values with Snappy, which is fast
+	// but compresses less.
+	CompressionSnappy Compression = 1
+
+	// CompressionZstd compresses values with Zstandard, which
+	// compresses better at some cost in speed.
+	CompressionZstd Compression = 2
+)
+
+// The Zstandard encoder and decoder, shared by every data structure and
+// created on first use.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// SetCompression makes the priority queue compress the values of the
+// items it writes from now on with the given compression, along with
+// their headers, when they are larger than threshold bytes. Values that
+// don't get smaller are stored as they are. Compressed values are
+// decompressed whenever they are read, whatever compression is set, so
+// the compression can be changed at any time. CompressionNone stops
+// compressing new values.
+//
+// Compression comes before checksums and encryption, which then apply
+// to the compressed value. It isn't persisted, so SetCompression must
+// be called after every open. If the priority queue stores values as
+// is, having been created by an older version of Goque,
+// ErrUnsupportedFormat is returned.
+func (pq *PriorityQueue) SetCompression(c Compression, threshold int) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if pq.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	pq.seal.compression, pq.seal.threshold = c, threshold
+
+	return nil
+}
+
+// SetCompression makes the stack compress the values of the items it
+// writes from now on, the same way as PriorityQueue.SetCompression.
+func (s *Stack) SetCompression(c Compression, threshold int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	s.seal.compression, s.seal.threshold = c, threshold
+
+	return nil
+}
+
+// SetCompression makes the queue compress the values of the items it
+// writes from now on, the same way as PriorityQueue.SetCompression.
+func (q *Queue) SetCompression(c Compression, threshold int) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+	q.seal.compression, q.seal.threshold = c, threshold
+
+	return nil
+}
+
+// compress returns the envelope in data compressed with the given
+// compression, or data itself if it doesn't get smaller.
+func compress(c Compression, data []byte) []byte {
+	out := []byte{envelopeCompressed, byte(c)}
+	switch c {
+	case CompressionSnappy:
+		out = append(out, snappy.Encode(nil, data)...)
+	case CompressionZstd:
+		zstdOnce.Do(initZstd)
+		out = zstdEncoder.EncodeAll(data, out)
+	default:
+		return data
+	}
+
+	if len(out) >= len(data) {
+		return data
+	}
+	return out
+}
+
+// decompress returns the envelope compressed in data, or data itself if
+// it isn't compressed. It returns ErrInvalidRecord if data can't be
+// decompressed.
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 1 || data[0] != envelopeCompressed {
+		return data, nil
+	} else if len(data) < 2 {
+		return nil, ErrInvalidRecord
+	}
+
+	var envelope []byte
+	var err error
+	switch Compression(data[1]) {
+	case CompressionSnappy:
+		envelope, err = snappy.Decode(nil, data[2:])
+	case CompressionZstd:
+		zstdOnce.Do(initZstd)
+		envelope, err = zstdDecoder.DecodeAll(data[2:], nil)
+	default:
+		return nil, ErrInvalidRecord
+	}
+	if err != nil {
+		return nil, ErrInvalidRecord
+	}
+
+	return envelope, nil
+}
+
+// initZstd creates the Zstandard encoder and decoder. Neither can fail
+// without options.
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
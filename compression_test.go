@@ -0,0 +1,115 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueCompression(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	large := strings.Repeat(`{"name":"value"},`, 100)
+	values := []string{large, "small", large, large, large}
+	compressions := []Compression{CompressionSnappy, CompressionSnappy, CompressionZstd, CompressionZstd, CompressionNone}
+	for i, value := range values {
+		if err = pq.SetCompression(compressions[i], 64); err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			// Compression comes before checksums and encryption.
+			keys := StaticKeys{Current: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}}
+			if err = pq.SetEncryption(keys); err != nil {
+				t.Fatal(err)
+			}
+			if err = pq.SetChecksums(true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err = pq.EnqueueString(0, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Check how each value was stored.
+	for i, want := range []byte{envelopeCompressed, envelopeV3, envelopeCompressed} {
+		data, err := pq.db.Get(pq.generateKey(0, uint64(i+1)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != want {
+			t.Errorf("Expected value %d to start with %d, got %d", i+1, want, data[0])
+		}
+		if want == envelopeCompressed && (Compression(data[1]) != compressions[i] || len(data) > len(large)/4) {
+			t.Errorf("Expected value %d to be compressed with %d, got %d bytes with %d", i+1, compressions[i], len(data), data[1])
+		}
+	}
+
+	// Every value reads back, whatever compression is set.
+	if err = pq.SetCompression(CompressionNone, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range values {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%.20s', got '%.20s'", want, item.ToString())
+		}
+	}
+}
+
+func TestQueueCompression(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.SetCompression(CompressionZstd, 0); err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("compressible ", 100)
+	item := NewItemString(value)
+	item.Headers = map[string]string{"type": "text"}
+	if err = q.Enqueue(item); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := q.db.Get(idToKey(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != envelopeCompressed {
+		t.Errorf("Expected a compressed value, got %d", data[0])
+	}
+
+	// A value that can't be decompressed is invalid.
+	data[1] = 9
+	if err = q.db.Put(idToKey(1), data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Peek(); err != ErrInvalidRecord {
+		t.Errorf("Expected ErrInvalidRecord, got %v", err)
+	}
+	data[1] = byte(CompressionZstd)
+	if err = q.db.Put(idToKey(1), data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if item, err = q.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != value || item.Headers["type"] != "text" {
+		t.Errorf("Expected the value with its headers, got '%.20s' with %v", item.ToString(), item.Headers)
+	}
+}
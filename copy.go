@@ -0,0 +1,291 @@
+package goque
+
+import (
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// copyPrefix is the key prefix used to persist copy checkpoints. Its
+// second byte is not prefixSep, so it can never collide with the key
+// of an item in any priority level.
+var copyPrefix = []byte("goque:copy:")
+
+// defaultCopyBatchSize is the number of items written to the
+// destination at once when CopyOptions.BatchSize is not set.
+const defaultCopyBatchSize = 1000
+
+// Queuer is implemented by every Goque data structure and is used as
+// the destination when copying or transferring items.
+type Queuer interface {
+	copyItems(items []*PriorityItem) error
+}
+
+// CopyOptions configures a call to CopyInto.
+type CopyOptions struct {
+	// BatchSize is the number of items written to the destination at
+	// once. Defaults to 1000.
+	BatchSize int
+
+	// Filter, if set, is called for every item and only items it
+	// returns true for are copied.
+	Filter func(item *PriorityItem) bool
+
+	// Transform, if set, is called for every item that passed Filter
+	// and its result is copied instead. Returning a nil item skips it.
+	Transform func(item *PriorityItem) (*PriorityItem, error)
+
+	// Progress, if set, is called after every batch with the number of
+	// items processed so far and the total number of items to process.
+	Progress func(done, total uint64)
+
+	// Checkpoint, if set, names a checkpoint persisted in the source
+	// priority queue after every batch. A later copy using the same
+	// checkpoint resumes after the last item processed, so an
+	// interrupted copy writes each item at least once.
+	Checkpoint string
+}
+
+// CopyInto copies the items of the priority queue, in dequeue order,
+// into the given destination without removing them. Only items present
+// when the copy starts are copied. It returns the number of items
+// written to the destination.
+func (pq *PriorityQueue) CopyInto(dst Queuer, opts CopyOptions) (uint64, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultCopyBatchSize
+	}
+
+	// Load the checkpoint, if any.
+	var checkpoint [256]uint64
+	if opts.Checkpoint != "" {
+		var err error
+		if checkpoint, err = pq.getCopyCheckpoint(opts.Checkpoint); err != nil {
+			return 0, err
+		}
+	}
+
+	// Find the last item of every level and the number of items to copy.
+	var done, total, copied uint64
+	var last [256]uint64
+	pq.readLock()
+	for i, level := range pq.levels {
+		last[i] = level.tail
+		if checkpoint[i] < level.head {
+			checkpoint[i] = level.head
+		}
+		if checkpoint[i] < level.tail {
+			total += level.tail - checkpoint[i]
+		}
+	}
+	pq.readUnlock()
+
+	for {
+		// Read the next batch of items.
+		items, err := pq.copyBatch(&checkpoint, &last, opts.BatchSize)
+		if err != nil {
+			return copied, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		done += uint64(len(items))
+
+		// Filter and transform the items.
+		var batch []*PriorityItem
+		for _, item := range items {
+			if opts.Filter != nil && !opts.Filter(item) {
+				continue
+			}
+			if opts.Transform != nil {
+				if item, err = opts.Transform(item); err != nil {
+					return copied, err
+				}
+				if item == nil {
+					continue
+				}
+			}
+			batch = append(batch, item)
+		}
+
+		// Write the batch to the destination.
+		if len(batch) > 0 {
+			if err = dst.copyItems(batch); err != nil {
+				return copied, err
+			}
+			copied += uint64(len(batch))
+		}
+
+		// Persist the checkpoint.
+		if opts.Checkpoint != "" {
+			if err = pq.putCopyCheckpoint(opts.Checkpoint, &checkpoint); err != nil {
+				return copied, err
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(done, total)
+		}
+	}
+
+	return copied, nil
+}
+
+// copyBatch reads up to max items in dequeue order that come after the
+// given checkpoint and no later than the given last IDs, advancing the
+// checkpoint past the items read.
+func (pq *PriorityQueue) copyBatch(checkpoint, last *[256]uint64, max int) ([]*PriorityItem, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	var items []*PriorityItem
+	levels := pq.active.levels()
+	for i := range levels {
+		if len(items) == max {
+			break
+		}
+
+		priority := levels[i]
+		if pq.order == DESC {
+			priority = levels[len(levels)-1-i]
+		}
+
+		// Skip items that have been dequeued since the last batch.
+		start := checkpoint[priority]
+		if start < pq.levels[priority].head {
+			start = pq.levels[priority].head
+		}
+		if start >= last[priority] {
+			continue
+		}
+
+		// Create a new LevelDB Iterator over the remaining items.
+		iter := pq.db.NewIterator(&util.Range{
+			Start: pq.generateKey(priority, start+1),
+			Limit: pq.generateKey(priority, last[priority]+1),
+		}, nil)
+
+		for len(items) < max && iter.Next() {
+			item, err := pq.decodeItem(iter.Key(), iter.Value())
+			if err != nil {
+				iter.Release()
+				return nil, err
+			}
+			items = append(items, item)
+			checkpoint[priority] = item.ID
+		}
+
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+
+		// Nothing is left in this level if the batch is not full.
+		if len(items) < max {
+			checkpoint[priority] = last[priority]
+		}
+	}
+
+	return items, nil
+}
+
+// getCopyCheckpoint returns the last copied ID of every priority level
+// for the given checkpoint name.
+func (pq *PriorityQueue) getCopyCheckpoint(name string) ([256]uint64, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	var checkpoint [256]uint64
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return checkpoint, ErrDBClosed
+	}
+
+	data, err := pq.db.Get(copyKey(name), nil)
+	if err == leveldb.ErrNotFound {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, err
+	}
+
+	for i := 0; i < 256 && len(data) >= (i+1)*8; i++ {
+		checkpoint[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+
+	return checkpoint, nil
+}
+
+// putCopyCheckpoint persists the last copied ID of every priority level
+// for the given checkpoint name.
+func (pq *PriorityQueue) putCopyCheckpoint(name string, checkpoint *[256]uint64) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	data := make([]byte, 256*8)
+	for i, id := range checkpoint {
+		binary.BigEndian.PutUint64(data[i*8:], id)
+	}
+
+	return pq.db.Put(copyKey(name), data, pq.wo)
+}
+
+// copyKey creates the key used to store the copy checkpoint with the
+// given name.
+func copyKey(name string) []byte {
+	key := make([]byte, len(copyPrefix)+len(name))
+	copy(key, copyPrefix)
+	copy(key[len(copyPrefix):], name)
+	return key
+}
+
+// copyItems adds copies of the given items to the priority queue.
+func (pq *PriorityQueue) copyItems(items []*PriorityItem) error {
+	batch := make([]*PriorityItem, len(items))
+	for i, item := range items {
+		batch[i] = NewPriorityItem(item.Value, item.Priority)
+		batch[i].Headers = item.Headers
+		batch[i].CreatedAt = item.CreatedAt
+		batch[i].UpdatedAt = item.UpdatedAt
+	}
+
+	_, err := pq.EnqueueBatch(batch)
+	return err
+}
+
+// copyItems adds copies of the given items to the queue.
+func (q *Queue) copyItems(items []*PriorityItem) error {
+	batch := make([]*Item, len(items))
+	for i, item := range items {
+		batch[i] = NewItem(item.Value)
+		batch[i].Headers = item.Headers
+		batch[i].CreatedAt = item.CreatedAt
+		batch[i].UpdatedAt = item.UpdatedAt
+	}
+
+	return q.enqueueBatch(batch)
+}
+
+// copyItems adds copies of the given items to the stack.
+func (s *Stack) copyItems(items []*PriorityItem) error {
+	batch := make([]*Item, len(items))
+	for i, item := range items {
+		batch[i] = NewItem(item.Value)
+		batch[i].Headers = item.Headers
+		batch[i].CreatedAt = item.CreatedAt
+		batch[i].UpdatedAt = item.UpdatedAt
+	}
+
+	_, err := s.PushBatch(batch)
+	return err
+}
@@ -0,0 +1,134 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueCopyInto(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenPriorityQueue(dstFile, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			item := NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))
+			if err = pq.Enqueue(item); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	var progress []uint64
+	copied, err := pq.CopyInto(dst, CopyOptions{
+		BatchSize: 15,
+		Filter: func(item *PriorityItem) bool {
+			return item.Priority != 2
+		},
+		Transform: func(item *PriorityItem) (*PriorityItem, error) {
+			return NewPriorityItemString("copy of "+item.ToString(), item.Priority), nil
+		},
+		Progress: func(done, total uint64) {
+			if total != 50 {
+				t.Errorf("Expected total of 50, got %d", total)
+			}
+			progress = append(progress, done)
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if copied != 40 {
+		t.Errorf("Expected 40 items to be copied, got %d", copied)
+	}
+
+	if fmt.Sprint(progress) != "[15 30 45 50]" {
+		t.Errorf("Expected progress of [15 30 45 50], got %v", progress)
+	}
+
+	if pq.Length() != 50 || dst.Length() != 40 {
+		t.Errorf("Expected lengths of 50 and 40, got %d and %d", pq.Length(), dst.Length())
+	}
+
+	item, err := dst.DequeueByPriority(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "copy of value for item 1"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestPriorityQueueCopyIntoCheckpoint(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(dstFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Copy only the first batch of items.
+	stop := fmt.Errorf("stop")
+	_, err = pq.CopyInto(s, CopyOptions{
+		BatchSize:  3,
+		Checkpoint: "backup",
+		Transform: func(item *PriorityItem) (*PriorityItem, error) {
+			if s.Length() == 3 {
+				return nil, stop
+			}
+			return item, nil
+		},
+	})
+	if err != stop {
+		t.Errorf("Expected to get transform error, got %v", err)
+	}
+
+	// Resume the copy from the checkpoint.
+	copied, err := pq.CopyInto(s, CopyOptions{BatchSize: 3, Checkpoint: "backup"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if copied != 7 || s.Length() != 10 {
+		t.Errorf("Expected 7 more items to be copied, got %d", copied)
+	}
+
+	// The last item copied is the last item of the lowest level.
+	compStr := "value for item 10"
+
+	item, err := s.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
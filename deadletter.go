@@ -0,0 +1,65 @@
+package goque
+
+// SetDeadLetter configures the priority queue to move reserved items
+// into the given dead-letter queue once they have been nacked or left
+// to expire more than maxAttempts times, instead of redelivering them.
+// Items removed once their TTL has passed, set by EnqueueWithTTL, are
+// moved there as well. Passing a nil dead-letter queue turns this off.
+//
+// The dead-letter queue must be a different priority queue. Moved items
+// are enqueued there before their reservation is deleted, so a crash in
+// between can leave an item in both queues, but never in neither.
+//
+// Attempts are only persisted by priority queues that store items in
+// an envelope, which all priority queues created by this version do.
+func (pq *PriorityQueue) SetDeadLetter(dlq *PriorityQueue, maxAttempts uint32) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.dlq = dlq
+	pq.attempts = maxAttempts
+}
+
+// failLease records a failed delivery of the item owned by the given
+// lease. The item is moved to the dead-letter queue if it has used up
+// its attempts, and otherwise returned to its priority level, at the
+// head if front is set.
+func (pq *PriorityQueue) failLease(lease *Lease, front bool) error {
+	item := lease.Item
+	item.Attempts++
+
+	if pq.dlq == nil || item.Attempts <= pq.attempts {
+		return pq.releaseLease(lease, front)
+	}
+
+	// Move the item to the dead-letter queue.
+	if err := pq.deadLetter(item); err != nil {
+		return err
+	}
+
+	return pq.db.Delete(leaseKey(lease.Token), pq.wo)
+}
+
+// deadLetter adds a copy of the given item to the dead-letter queue.
+// The expiry of the item is left out, so it doesn't expire there.
+func (pq *PriorityQueue) deadLetter(item *PriorityItem) error {
+	dead := NewPriorityItem(item.Value, item.Priority)
+	dead.Attempts = item.Attempts
+	dead.Headers = item.Headers
+	dead.CreatedAt = item.CreatedAt
+	dead.UpdatedAt = item.UpdatedAt
+	if _, ok := item.Headers[ExpiresHeader]; ok {
+		dead.Headers = make(map[string]string, len(item.Headers))
+		for k, v := range item.Headers {
+			if k != ExpiresHeader {
+				dead.Headers[k] = v
+			}
+		}
+	}
+	if err := pq.dlq.Enqueue(dead); err != nil {
+		return err
+	}
+	pq.log.info("goque: Moved an item to the dead-letter queue", "dir", pq.DataDir, "priority", item.Priority, "id", item.ID, "attempts", item.Attempts)
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueDeadLetterNack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	dlqFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dlq, err := OpenPriorityQueue(dlqFile, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dlq.ForceDrop()
+
+	pq.SetDeadLetter(dlq, 2)
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 4)); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		item, token, err := pq.Reserve(time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.Attempts != uint32(i-1) {
+			t.Errorf("Expected attempts to be %d, got %d", i-1, item.Attempts)
+		}
+
+		if err = pq.Nack(token); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	leases, err := pq.Leases()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(leases) != 0 {
+		t.Errorf("Expected no leases to be left, got %d", len(leases))
+	}
+
+	item, err := dlq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value" || item.Priority != 4 || item.Attempts != 3 {
+		t.Errorf("Expected 'value' with priority 4 and 3 attempts, got '%s' with %d and %d", item.ToString(), item.Priority, item.Attempts)
+	}
+}
+
+func TestPriorityQueueDeadLetterExpired(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	dlqFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dlq, err := OpenPriorityQueue(dlqFile, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dlq.ForceDrop()
+
+	pq.SetDeadLetter(dlq, 1)
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err = pq.Reserve(time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if _, err = pq.ReclaimExpired(); err != nil {
+			t.Error(err)
+		}
+
+		// Reopen the priority queue to make sure attempts persist.
+		pq.Close()
+		if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+			t.Error(err)
+		}
+		pq.SetDeadLetter(dlq, 1)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	if dlq.Length() != 1 {
+		t.Errorf("Expected dead-letter queue length of 1, got %d", dlq.Length())
+	}
+}
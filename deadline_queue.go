@@ -0,0 +1,140 @@
+package goque
+
+import (
+	"time"
+)
+
+// DeadlineItem represents an entry in a deadline queue.
+type DeadlineItem struct {
+	ID       uint64
+	Deadline time.Time
+	Key      []byte
+	Value    []byte
+}
+
+// NewDeadlineItem creates a new item for use with a deadline queue that
+// is due at the given deadline.
+func NewDeadlineItem(value []byte, deadline time.Time) *DeadlineItem {
+	return &DeadlineItem{Deadline: deadline, Value: value}
+}
+
+// NewDeadlineItemString is a helper function for NewDeadlineItem that
+// accepts a value as a string rather than a byte slice.
+func NewDeadlineItemString(value string, deadline time.Time) *DeadlineItem {
+	return NewDeadlineItem([]byte(value), deadline)
+}
+
+// ToString returns the deadline item value as a string.
+func (di *DeadlineItem) ToString() string {
+	return string(di.Value)
+}
+
+// DeadlineQueue is an earliest-deadline-first queue, where every item
+// carries a deadline and Dequeue always returns the item with the
+// nearest one, whether or not it has passed. Items with the same
+// deadline are dequeued in the order they were added.
+type DeadlineQueue struct {
+	pq *PriorityQueue64
+}
+
+// OpenDeadlineQueue opens a deadline queue if one exists at the given
+// directory. If one does not already exist, a new deadline queue is
+// created.
+func OpenDeadlineQueue(dataDir string) (*DeadlineQueue, error) {
+	pq, err := openPriorityQueue64(dataDir, ASC, goqueDeadlineQueue)
+	return &DeadlineQueue{pq: pq}, err
+}
+
+// Enqueue adds an item to the deadline queue. Deadlines before the Unix
+// epoch are treated as the epoch.
+func (dq *DeadlineQueue) Enqueue(item *DeadlineItem) error {
+	pi := &PriorityItem64{Priority: deadlinePriority(item.Deadline), Value: item.Value}
+	if err := dq.pq.Enqueue(pi); err != nil {
+		return err
+	}
+
+	item.ID = pi.ID
+	item.Key = pi.Key
+	return nil
+}
+
+// Dequeue removes the item with the nearest deadline and returns it.
+func (dq *DeadlineQueue) Dequeue() (*DeadlineItem, error) {
+	pi, err := dq.pq.Dequeue()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDeadlineItem(pi), nil
+}
+
+// Peek returns the item with the nearest deadline without removing it.
+func (dq *DeadlineQueue) Peek() (*DeadlineItem, error) {
+	pi, err := dq.pq.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDeadlineItem(pi), nil
+}
+
+// Overdue returns the items whose deadline is before the given time,
+// nearest deadline first, without removing them.
+func (dq *DeadlineQueue) Overdue(now time.Time) ([]*DeadlineItem, error) {
+	pis, err := dq.pq.peekBelow(deadlinePriority(now))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*DeadlineItem, len(pis))
+	for i, pi := range pis {
+		items[i] = decodeDeadlineItem(pi)
+	}
+
+	return items, nil
+}
+
+// Length returns the total number of items in the deadline queue.
+func (dq *DeadlineQueue) Length() uint64 {
+	return dq.pq.Length()
+}
+
+// Close closes the LevelDB database of the deadline queue.
+func (dq *DeadlineQueue) Close() error {
+	return dq.pq.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the deadline queue,
+// as long as it holds no items. Otherwise nothing is done and
+// ErrNotEmpty is returned.
+func (dq *DeadlineQueue) Drop() error {
+	return dq.pq.Drop()
+}
+
+// ForceDrop closes and deletes the LevelDB database of the deadline
+// queue, along with any items it still holds.
+func (dq *DeadlineQueue) ForceDrop() error {
+	return dq.pq.ForceDrop()
+}
+
+// deadlinePriority returns the priority of an item due at the given
+// deadline in the underlying priority queue.
+func deadlinePriority(deadline time.Time) uint64 {
+	ns := deadline.UnixNano()
+	if ns < 0 {
+		ns = 0
+	}
+
+	return uint64(ns)
+}
+
+// decodeDeadlineItem creates a DeadlineItem from the given item of the
+// underlying priority queue.
+func decodeDeadlineItem(pi *PriorityItem64) *DeadlineItem {
+	return &DeadlineItem{
+		ID:       pi.ID,
+		Deadline: time.Unix(0, int64(pi.Priority)),
+		Key:      pi.Key,
+		Value:    pi.Value,
+	}
+}
@@ -0,0 +1,108 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadlineQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDeadlineQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dq.ForceDrop()
+
+	now := time.Now()
+	for _, offset := range []time.Duration{time.Hour, -time.Minute, time.Second, -time.Hour, time.Second} {
+		value := fmt.Sprintf("due%v", offset)
+		if err = dq.Enqueue(NewDeadlineItemString(value, now.Add(offset))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The items already past their deadline, nearest first.
+	overdue, err := dq.Overdue(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overdue) != 2 || overdue[0].ToString() != "due-1h0m0s" || overdue[1].ToString() != "due-1m0s" {
+		t.Fatalf("Expected the two overdue items, got %d", len(overdue))
+	}
+	if !overdue[0].Deadline.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected deadline %v, got %v", now.Add(-time.Hour), overdue[0].Deadline)
+	}
+	if dq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", dq.Length())
+	}
+
+	// Dequeue returns the nearest deadline, keeping the order of ties.
+	item, err := dq.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "due-1h0m0s" {
+		t.Errorf("Expected 'due-1h0m0s', got '%s'", item.ToString())
+	}
+	var ids []uint64
+	for _, want := range []string{"due-1h0m0s", "due-1m0s", "due1s", "due1s", "due1h0m0s"} {
+		item, err := dq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+		ids = append(ids, item.ID)
+	}
+	if ids[2] != 3 || ids[3] != 5 {
+		t.Errorf("Expected the items due in a second in the order they were added, got IDs %d and %d", ids[2], ids[3])
+	}
+	if _, err = dq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	if overdue, err = dq.Overdue(now); err != nil || len(overdue) != 0 {
+		t.Errorf("Expected no overdue items, got %d and %v", len(overdue), err)
+	}
+}
+
+func TestDeadlineQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDeadlineQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dq.ForceDrop()
+
+	deadline := time.Now().Add(time.Minute)
+	if err = dq.Enqueue(NewDeadlineItemString("value", deadline)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = dq.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "deadline queue" {
+		t.Errorf("Expected type 'deadline queue', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenDeadlineQueue(file + "_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" || !item.Deadline.Equal(deadline) {
+		t.Errorf("Expected 'value' due at %v, got '%s' due at %v", deadline, item.ToString(), item.Deadline)
+	}
+}
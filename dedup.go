@@ -0,0 +1,281 @@
+package goque
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// dedupPrefix is the key prefix of the records of the items enqueued
+// with a deduplication ID, and dedupExpiryPrefix the one of the index
+// of those records by expiry. Their second byte is not prefixSep, so
+// they can never collide with the key of an item in any priority level.
+var (
+	dedupPrefix       = []byte("goque:dedup:")
+	dedupExpiryPrefix = []byte("goque:dedupexp:")
+)
+
+// DefaultDedupWindow is how long the deduplication ID of an item is
+// remembered, unless SetDedupWindow changes it.
+const DefaultDedupWindow = 10 * time.Minute
+
+// dedupPurgeLimit is the maximum number of expired deduplication records
+// deleted by a single EnqueueOnce, so their deletion is spread over the
+// calls.
+const dedupPurgeLimit = 64
+
+// dedupRecord is the record of an item enqueued with a deduplication
+// ID.
+type dedupRecord struct {
+	expires int64 // In Unix nanoseconds.
+	key     []byte
+}
+
+// dedupEntry is a deduplication record about to be written for an item
+// enqueued at now, replacing the expired record prev, if any.
+type dedupEntry struct {
+	id      string
+	now     time.Time
+	expires int64
+	prev    *dedupRecord
+}
+
+// dedupKey returns the key of the record of the given deduplication ID.
+func dedupKey(id string) []byte {
+	key := make([]byte, 0, len(dedupPrefix)+len(id))
+	key = append(key, dedupPrefix...)
+	return append(key, id...)
+}
+
+// dedupExpiryKey returns the key of the given deduplication ID, expiring
+// at the given time, in the index of the records by expiry.
+func dedupExpiryKey(expires int64, id string) []byte {
+	key := make([]byte, 0, len(dedupExpiryPrefix)+8+len(id))
+	key = append(key, dedupExpiryPrefix...)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(expires))
+	key = append(key, b[:]...)
+	return append(key, id...)
+}
+
+// getDedup returns the record of the given deduplication ID, or nil if
+// there is none.
+func getDedup(db Store, id string) (*dedupRecord, error) {
+	data, err := db.Get(dedupKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// expires + key = 8 + key
+	if len(data) < 8 {
+		return nil, ErrInvalidRecord
+	}
+
+	return &dedupRecord{
+		expires: int64(binary.BigEndian.Uint64(data[:8])),
+		key:     data[8:],
+	}, nil
+}
+
+// lookupDedup returns the record of the given deduplication ID if it
+// hasn't expired at now, or the entry to write along with the item
+// enqueued with it otherwise.
+func lookupDedup(db Store, id string, window time.Duration, now time.Time) (*dedupRecord, *dedupEntry, error) {
+	rec, err := getDedup(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rec != nil && rec.expires > now.UnixNano() {
+		return rec, nil, nil
+	}
+
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	return nil, &dedupEntry{id: id, now: now, expires: now.Add(window).UnixNano(), prev: rec}, nil
+}
+
+// put adds the record of the entry, for the item with the given key, to
+// the batch, along with the deletion of up to dedupPurgeLimit expired
+// records.
+func (e *dedupEntry) put(db Store, batch *leveldb.Batch, key []byte) error {
+	if err := purgeDedup(db, batch, e.now); err != nil {
+		return err
+	}
+
+	// The record replaced is gone from the index, as it expired, unless
+	// the purge left it behind.
+	if e.prev != nil {
+		batch.Delete(dedupExpiryKey(e.prev.expires, e.id))
+	}
+
+	value := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(value, uint64(e.expires))
+	value = append(value, key...)
+	batch.Put(dedupKey(e.id), value)
+	batch.Put(dedupExpiryKey(e.expires, e.id), nil)
+
+	return nil
+}
+
+// purgeDedup adds to the batch the deletion of up to dedupPurgeLimit
+// records expired at now, along with their entries in the index. A
+// record renewed since its entry was indexed is left alone.
+func purgeDedup(db Store, batch *leveldb.Batch, now time.Time) error {
+	limit := dedupExpiryKey(now.UnixNano(), "")
+	iter := db.NewIterator(&util.Range{Start: dedupExpiryPrefix, Limit: limit}, nil)
+	defer iter.Release()
+
+	for n := 0; n < dedupPurgeLimit && iter.Next(); n++ {
+		key := iter.Key()
+		if len(key) < len(dedupExpiryPrefix)+8 {
+			continue
+		}
+		expires := int64(binary.BigEndian.Uint64(key[len(dedupExpiryPrefix):]))
+		id := string(key[len(dedupExpiryPrefix)+8:])
+
+		rec, err := getDedup(db, id)
+		if err != nil && err != ErrInvalidRecord {
+			return err
+		}
+		if rec == nil || rec.expires == expires {
+			batch.Delete(dedupKey(id))
+		}
+		batch.Delete(append([]byte(nil), key...))
+	}
+
+	return iter.Error()
+}
+
+// SetDedupWindow sets how long the deduplication ID of an item added by
+// EnqueueOnce is remembered, DefaultDedupWindow if window isn't
+// positive. It applies to the items added from then on. The window
+// isn't persisted, so it should be set again after every open.
+func (pq *PriorityQueue) SetDedupWindow(window time.Duration) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.dedup = window
+}
+
+// EnqueueOnce adds the given item to the priority queue, unless an item
+// was added with the same deduplication ID within the deduplication
+// window, so a producer can safely retry an enqueue that may or may not
+// have happened. It reports whether the item was added.
+//
+// If it wasn't, the original item is returned instead. Once the
+// original item has left the priority queue, only its ID, priority and
+// key are set. The deduplication ID is remembered for the window from
+// when the original item was added, even after it is dequeued.
+func (pq *PriorityQueue) EnqueueOnce(dedupID string, item *PriorityItem) (*PriorityItem, bool, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, false, ErrDBClosed
+	}
+
+	rec, entry, err := lookupDedup(pq.db, dedupID, pq.dedup, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if rec != nil {
+		orig, err := pq.dedupItem(rec.key)
+		return orig, false, err
+	}
+
+	if err = pq.enqueue(item, entry); err != nil {
+		return nil, false, err
+	}
+
+	return item, true, nil
+}
+
+// dedupItem returns the item with the given key, or one with only its
+// ID, priority and key set if it is no longer in the priority queue.
+// The caller must hold the lock.
+func (pq *PriorityQueue) dedupItem(key []byte) (*PriorityItem, error) {
+	// priority + prefixSep + id = 1 + 1 + 8
+	if len(key) != 10 {
+		return nil, ErrInvalidRecord
+	}
+
+	priority, id := key[0], keyToID(key[2:])
+	item, err := pq.getItemByPriorityID(priority, id)
+	switch err {
+	case nil:
+		return item, nil
+	case ErrEmpty, ErrOutOfBounds, leveldb.ErrNotFound:
+		return &PriorityItem{ID: id, Priority: priority, Key: pq.generateKey(priority, id)}, nil
+	}
+
+	return nil, err
+}
+
+// SetDedupWindow sets how long the deduplication ID of an item added by
+// EnqueueOnce is remembered, the same way as
+// PriorityQueue.SetDedupWindow.
+func (q *Queue) SetDedupWindow(window time.Duration) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.dedup = window
+}
+
+// EnqueueOnce adds the given item to the queue, unless an item was
+// added with the same deduplication ID within the deduplication window,
+// the same way as PriorityQueue.EnqueueOnce. Once the original item has
+// left the queue, only its ID and key are set.
+func (q *Queue) EnqueueOnce(dedupID string, item *Item) (*Item, bool, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, false, ErrDBClosed
+	}
+
+	rec, entry, err := lookupDedup(q.db, dedupID, q.dedup, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if rec != nil {
+		orig, err := q.dedupItem(rec.key)
+		return orig, false, err
+	}
+
+	if err = q.enqueue(item, entry); err != nil {
+		return nil, false, err
+	}
+
+	return item, true, nil
+}
+
+// dedupItem returns the item with the given key, or one with only its
+// ID and key set if it is no longer in the queue. The caller must hold
+// the lock.
+func (q *Queue) dedupItem(key []byte) (*Item, error) {
+	if len(key) != 8 {
+		return nil, ErrInvalidRecord
+	}
+
+	item := &Item{ID: keyToID(key), Key: idToKey(keyToID(key))}
+	if item.ID <= q.head || item.ID > q.tail {
+		return item, nil
+	}
+
+	data, err := q.db.Get(item.Key, nil)
+	if err == leveldb.ErrNotFound {
+		return item, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item, decodeItemValue(q.format, q.seal, item, data)
+}
@@ -0,0 +1,161 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueEnqueueOnce(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	item, added, err := pq.EnqueueOnce("job-1", NewPriorityItem([]byte("first"), 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !added || item.ID != 1 {
+		t.Errorf("Expected the item to be added with ID 1, got %v with ID %d", added, item.ID)
+	}
+
+	// A retry returns the original item.
+	orig, added, err := pq.EnqueueOnce("job-1", NewPriorityItem([]byte("retry"), 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added {
+		t.Error("Expected the duplicate to be ignored")
+	}
+	if orig.ToString() != "first" || orig.Priority != 3 || orig.ID != 1 {
+		t.Errorf("Expected the original item, got '%s' with priority %d and ID %d", orig.ToString(), orig.Priority, orig.ID)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	// Other IDs are not affected.
+	if _, added, err = pq.EnqueueOnce("job-2", NewPriorityItem([]byte("second"), 3)); err != nil {
+		t.Fatal(err)
+	}
+	if !added {
+		t.Error("Expected an item with another deduplication ID to be added")
+	}
+
+	// The ID is still remembered once the item is dequeued.
+	if _, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if orig, added, err = pq.EnqueueOnce("job-1", NewPriorityItem([]byte("retry"), 5)); err != nil {
+		t.Fatal(err)
+	}
+	if added {
+		t.Error("Expected the duplicate to be ignored after the original was dequeued")
+	}
+	if orig.ID != 1 || orig.Priority != 3 || orig.Value != nil {
+		t.Errorf("Expected only the ID and priority of the original item, got %+v", orig)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	// Plain enqueues are never deduplicated.
+	if _, err = pq.EnqueueString(3, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueDedupWindow(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetDedupWindow(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, _, err = pq.EnqueueOnce(fmt.Sprintf("job-%d", i), NewPriorityItemString("value", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	// Past the window, the ID can be used again.
+	pq.SetDedupWindow(0)
+	if _, added, err := pq.EnqueueOnce("job-0", NewPriorityItemString("again", 0)); err != nil {
+		t.Fatal(err)
+	} else if !added {
+		t.Error("Expected the item to be added once the window passed")
+	}
+	if pq.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", pq.Length())
+	}
+
+	// The expired records were purged, while the new one is kept.
+	if n := countKeys(pq.db, dedupPrefix); n != 1 {
+		t.Errorf("Expected 1 deduplication record, got %d", n)
+	}
+	if n := countKeys(pq.db, dedupExpiryPrefix); n != 1 {
+		t.Errorf("Expected 1 indexed deduplication record, got %d", n)
+	}
+	if _, added, err := pq.EnqueueOnce("job-0", NewPriorityItemString("retry", 0)); err != nil {
+		t.Fatal(err)
+	} else if added {
+		t.Error("Expected the renewed ID to be deduplicated")
+	}
+}
+
+func TestQueueEnqueueOnce(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if _, added, err := q.EnqueueOnce("job", NewItemString("first")); err != nil {
+		t.Fatal(err)
+	} else if !added {
+		t.Error("Expected the item to be added")
+	}
+
+	orig, added, err := q.EnqueueOnce("job", NewItemString("retry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added || orig.ToString() != "first" {
+		t.Errorf("Expected the original item, got '%s'", orig.ToString())
+	}
+
+	// The records are not mistaken for items.
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if q, err = OpenQueue(file); err != nil {
+		t.Fatal(err)
+	}
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "first" {
+		t.Errorf("Expected 'first', got '%s'", item.ToString())
+	}
+
+	if orig, added, err = q.EnqueueOnce("job", NewItemString("retry")); err != nil {
+		t.Fatal(err)
+	}
+	if added || orig.ID != 1 || orig.Value != nil {
+		t.Errorf("Expected only the ID of the original item, got %+v", orig)
+	}
+}
@@ -0,0 +1,325 @@
+package goque
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// delayMetaKey is the key used to persist the metadata of a delay
+// queue. Item keys start with a non-negative timestamp, so their
+// first byte is always below 0x80 and never collides with it.
+var delayMetaKey = []byte{0xFF}
+
+// delayItemRange is the key range holding the items of a delay queue.
+var delayItemRange = &util.Range{Start: nil, Limit: []byte{0x80}}
+
+// DelayItem represents an entry in a delay queue.
+type DelayItem struct {
+	ID        uint64
+	VisibleAt time.Time
+	Key       []byte
+	Value     []byte
+}
+
+// NewDelayItem creates a new item for use with a delay queue that
+// becomes visible after the given delay.
+func NewDelayItem(value []byte, delay time.Duration) *DelayItem {
+	return &DelayItem{VisibleAt: time.Now().Add(delay), Value: value}
+}
+
+// NewDelayItemString is a helper function for NewDelayItem that accepts
+// a value as a string rather than a byte slice.
+func NewDelayItemString(value string, delay time.Duration) *DelayItem {
+	return NewDelayItem([]byte(value), delay)
+}
+
+// ToString returns the delay item value as a string.
+func (di *DelayItem) ToString() string {
+	return string(di.Value)
+}
+
+// DelayQueue is a queue where every item carries the time it becomes
+// visible at, and items are dequeued in order of that time once it has
+// passed.
+type DelayQueue struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	lastID  uint64
+	length  uint64
+	isOpen  bool
+}
+
+// OpenDelayQueue opens a delay queue if one exists at the given
+// directory. If one does not already exist, a new delay queue is
+// created.
+func OpenDelayQueue(dataDir string) (*DelayQueue, error) {
+	return openDelayQueue(dataDir, goqueDelayQueue)
+}
+
+// openDelayQueue opens a delay queue storing the given Goque type.
+func openDelayQueue(dataDir string, gt goqueType) (*DelayQueue, error) {
+	var err error
+
+	// Create a new DelayQueue.
+	dq := &DelayQueue{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		isOpen:  false,
+	}
+
+	// Open database for the delay queue.
+	dq.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return dq, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, gt)
+	if err != nil {
+		return dq, err
+	}
+	if !ok {
+		return dq, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, dq.db, gt); err != nil {
+		return dq, err
+	}
+
+	// Set isOpen and return.
+	dq.isOpen = true
+	return dq, dq.init()
+}
+
+// Enqueue adds an item to the delay queue.
+func (dq *DelayQueue) Enqueue(item *DelayItem) error {
+	dq.Lock()
+	defer dq.Unlock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Set item ID and key.
+	item.ID = dq.lastID + 1
+	item.Key = generateDelayKey(item.VisibleAt, item.ID)
+
+	// Add it to the delay queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, item.Value)
+	dq.putMeta(batch, item.ID, dq.length+1)
+	if err := dq.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	dq.lastID++
+	dq.length++
+
+	return nil
+}
+
+// Dequeue removes the next visible item in the delay queue and returns
+// it. If the delay queue has items but none of them are visible yet,
+// ErrNotVisible is returned.
+func (dq *DelayQueue) Dequeue() (*DelayItem, error) {
+	dq.Lock()
+	defer dq.Unlock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the next item in the delay queue.
+	item, err := dq.getNextItem()
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the item is visible.
+	if item.VisibleAt.After(time.Now()) {
+		return nil, ErrNotVisible
+	}
+
+	// Remove this item from the delay queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	dq.putMeta(batch, dq.lastID, dq.length-1)
+	if err = dq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	dq.length--
+
+	return item, nil
+}
+
+// Peek returns the next item in the delay queue without removing it,
+// whether or not it is visible yet.
+func (dq *DelayQueue) Peek() (*DelayItem, error) {
+	dq.RLock()
+	defer dq.RUnlock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return dq.getNextItem()
+}
+
+// Update updates an item in the delay queue without changing its
+// position.
+func (dq *DelayQueue) Update(item *DelayItem, newValue []byte) error {
+	dq.Lock()
+	defer dq.Unlock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		return ErrDBClosed
+	}
+
+	item.Value = newValue
+	return dq.db.Put(item.Key, item.Value, nil)
+}
+
+// UpdateString is a helper function for Update that accepts a value
+// as a string rather than a byte slice.
+func (dq *DelayQueue) UpdateString(item *DelayItem, newValue string) error {
+	return dq.Update(item, []byte(newValue))
+}
+
+// Length returns the total number of items in the delay queue, visible
+// or not.
+func (dq *DelayQueue) Length() uint64 {
+	return dq.length
+}
+
+// Close closes the LevelDB database of the delay queue. Once closed, every
+// operation on the delay queue returns ErrDBClosed.
+func (dq *DelayQueue) Close() error {
+	_, err := dq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the delay queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the delay queue in
+// between. If check fails, the delay queue is left as it is and the error is
+// returned. closeIf reports whether the delay queue is closed.
+func (dq *DelayQueue) closeIf(check func() error) (bool, error) {
+	dq.Lock()
+	defer dq.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If delay queue is already closed.
+	if !dq.isOpen {
+		return true, nil
+	}
+	dq.isOpen = false
+
+	return true, dq.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the delay queue, as long
+// as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (dq *DelayQueue) Drop() error {
+	return dropIf(dq.DataDir, dq.closeIf, checkEmpty(dq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the delay queue,
+// along with any items it still holds.
+func (dq *DelayQueue) ForceDrop() error {
+	err := dq.Close()
+	if rerr := os.RemoveAll(dq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// getNextItem returns the item with the earliest visibility time using
+// a single iterator seek.
+func (dq *DelayQueue) getNextItem() (*DelayItem, error) {
+	if dq.length == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Create a new LevelDB Iterator over the items.
+	iter := dq.db.NewIterator(delayItemRange, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmpty
+	}
+
+	key := iter.Key()
+	item := &DelayItem{
+		ID:        keyToID(key[8:]),
+		VisibleAt: time.Unix(0, int64(keyToID(key[:8]))),
+		Key:       append([]byte(nil), key...),
+		Value:     append([]byte(nil), iter.Value()...),
+	}
+
+	return item, nil
+}
+
+// putMeta adds the last assigned ID and the length of the delay queue
+// to the batch.
+func (dq *DelayQueue) putMeta(batch *leveldb.Batch, lastID, length uint64) {
+	// lastID + length = 8 + 8
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[0:8], lastID)
+	binary.BigEndian.PutUint64(data[8:16], length)
+	batch.Put(delayMetaKey, data)
+}
+
+// init initializes the delay queue data.
+func (dq *DelayQueue) init() error {
+	data, err := dq.db.Get(delayMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 16 {
+		return ErrInvalidRecord
+	}
+	dq.lastID = binary.BigEndian.Uint64(data[0:8])
+	dq.length = binary.BigEndian.Uint64(data[8:16])
+
+	return nil
+}
+
+// generateDelayKey creates a key ordered by the given visibility time,
+// using the ID to keep keys unique.
+func generateDelayKey(visibleAt time.Time, id uint64) []byte {
+	// Times before the Unix epoch are treated as the epoch.
+	ts := visibleAt.UnixNano()
+	if ts < 0 {
+		ts = 0
+	}
+
+	// timestamp + id = 8 + 8
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[0:8], uint64(ts))
+	binary.BigEndian.PutUint64(key[8:16], id)
+	return key
+}
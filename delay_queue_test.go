@@ -0,0 +1,241 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDelayQueueDrop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); os.IsNotExist(err) {
+		t.Error(err)
+	}
+
+	dq.Drop()
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestDelayQueueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = dq.Enqueue(NewDelayItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	if err = dq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = dq.Enqueue(NewDelayItemString("value", 0)); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Enqueue, got %v", err)
+	}
+
+	if _, err = dq.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Dequeue, got %v", err)
+	}
+
+	if _, err = dq.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Peek, got %v", err)
+	}
+
+	// Closing again is a no-op.
+	if err = dq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = dq.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestDelayQueueIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+	pq.Close()
+
+	if _, err = OpenDelayQueue(file); err != ErrIncompatibleType {
+		t.Error("Expected delay queue to return ErrIncompatibleTypes when opening PriorityQueue")
+	}
+}
+
+func TestDelayQueueDequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if err = dq.Enqueue(NewDelayItemString("later item", time.Hour)); err != nil {
+		t.Error(err)
+	}
+	if err = dq.Enqueue(NewDelayItemString("second item", -time.Second)); err != nil {
+		t.Error(err)
+	}
+	if err = dq.Enqueue(NewDelayItemString("first item", -time.Minute)); err != nil {
+		t.Error(err)
+	}
+
+	if dq.Length() != 3 {
+		t.Errorf("Expected delay queue length of 3, got %d", dq.Length())
+	}
+
+	for _, compStr := range []string{"first item", "second item"} {
+		item, err := dq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = dq.Dequeue(); err != ErrNotVisible {
+		t.Errorf("Expected to get not visible error, got %v", err)
+	}
+
+	item, err := dq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "later item"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if dq.Length() != 1 {
+		t.Errorf("Expected delay queue length of 1, got %d", dq.Length())
+	}
+}
+
+func TestDelayQueueDequeueFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if err = dq.Enqueue(NewDelayItemString("value", -time.Second)); err != nil {
+		t.Error(err)
+	}
+
+	// A failed dequeue must not hand out the item.
+	dq.db.Close()
+	item, err := dq.Dequeue()
+	if item != nil || err == nil {
+		t.Errorf("Expected no item and an error, got %v and %v", item, err)
+	}
+	dq.Close()
+
+	// The item is still the next one.
+	if dq, err = OpenDelayQueue(file); err != nil {
+		t.Fatal(err)
+	}
+	if item, err = dq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+	}
+}
+
+func TestDelayQueueUpdate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	item := NewDelayItemString("value for item", 0)
+	if err = dq.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+
+	compStr := "new value for item"
+	if err = dq.UpdateString(item, compStr); err != nil {
+		t.Error(err)
+	}
+
+	newItem, err := dq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, newItem.ToString())
+	}
+}
+
+func TestDelayQueueReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = dq.Enqueue(NewDelayItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	dq.Close()
+
+	dq, err = OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if dq.Length() != 3 {
+		t.Errorf("Expected delay queue length of 3, got %d", dq.Length())
+	}
+
+	item := NewDelayItemString("value for item 4", 0)
+	if err = dq.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 4 {
+		t.Errorf("Expected item ID to be 4, got %d", item.ID)
+	}
+}
+
+func TestDelayQueueEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if _, err = dq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get queue empty error, got %v", err)
+	}
+}
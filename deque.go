@@ -0,0 +1,329 @@
+package goque
+
+import (
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// dequeStart is the ID position an empty deque starts at, allowing IDs
+// to grow in both directions.
+const dequeStart uint64 = 1 << 63
+
+// Deque is a double-ended queue, allowing items to be added to and
+// removed from both the front and the back.
+type Deque struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	head    uint64
+	tail    uint64
+	isOpen  bool
+}
+
+// OpenDeque opens a deque if one exists at the given directory. If one
+// does not already exist, a new deque is created.
+func OpenDeque(dataDir string) (*Deque, error) {
+	var err error
+
+	// Create a new Deque.
+	d := &Deque{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		head:    dequeStart,
+		tail:    dequeStart,
+		isOpen:  false,
+	}
+
+	// Open database for the deque.
+	d.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return d, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goqueDeque)
+	if err != nil {
+		return d, err
+	}
+	if !ok {
+		return d, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, d.db, goqueDeque); err != nil {
+		return d, err
+	}
+
+	// Set isOpen and return.
+	d.isOpen = true
+	return d, d.init()
+}
+
+// PushFront adds an item to the front of the deque.
+func (d *Deque) PushFront(item *Item) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return ErrDBClosed
+	}
+
+	// Set item ID and key.
+	item.ID = d.head
+	item.Key = idToKey(item.ID)
+
+	// Add it to the deque.
+	err := d.db.Put(item.Key, item.Value, nil)
+	if err == nil {
+		d.head--
+	}
+
+	return err
+}
+
+// PushBack adds an item to the back of the deque.
+func (d *Deque) PushBack(item *Item) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return ErrDBClosed
+	}
+
+	// Set item ID and key.
+	item.ID = d.tail + 1
+	item.Key = idToKey(item.ID)
+
+	// Add it to the deque.
+	err := d.db.Put(item.Key, item.Value, nil)
+	if err == nil {
+		d.tail++
+	}
+
+	return err
+}
+
+// PopFront removes the item at the front of the deque and returns it.
+func (d *Deque) PopFront() (*Item, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the item at the front of the deque.
+	item, err := d.getItemByID(d.head + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the deque.
+	if err := d.db.Delete(item.Key, nil); err != nil {
+		return nil, err
+	}
+
+	// Increment position.
+	d.head++
+
+	return item, nil
+}
+
+// PopBack removes the item at the back of the deque and returns it.
+func (d *Deque) PopBack() (*Item, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the item at the back of the deque.
+	item, err := d.getItemByID(d.tail)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the deque.
+	if err := d.db.Delete(item.Key, nil); err != nil {
+		return nil, err
+	}
+
+	// Decrement position.
+	d.tail--
+
+	return item, nil
+}
+
+// PeekFront returns the item at the front of the deque without
+// removing it.
+func (d *Deque) PeekFront() (*Item, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return d.getItemByID(d.head + 1)
+}
+
+// PeekBack returns the item at the back of the deque without removing
+// it.
+func (d *Deque) PeekBack() (*Item, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return d.getItemByID(d.tail)
+}
+
+// PeekByOffset returns the item located at the given offset,
+// starting from the front of the deque, without removing it.
+func (d *Deque) PeekByOffset(offset uint64) (*Item, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return d.getItemByID(d.head + offset + 1)
+}
+
+// PeekByID returns the item with the given ID without removing it.
+func (d *Deque) PeekByID(id uint64) (*Item, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return d.getItemByID(id)
+}
+
+// Update updates an item in the deque without changing its position.
+func (d *Deque) Update(item *Item, newValue []byte) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		return ErrDBClosed
+	}
+
+	item.Value = newValue
+	return d.db.Put(item.Key, item.Value, nil)
+}
+
+// UpdateString is a helper function for Update that accepts a value
+// as a string rather than a byte slice.
+func (d *Deque) UpdateString(item *Item, newValue string) error {
+	return d.Update(item, []byte(newValue))
+}
+
+// Length returns the total number of items in the deque.
+func (d *Deque) Length() uint64 {
+	return d.tail - d.head
+}
+
+// Close closes the LevelDB database of the deque. Once closed, every
+// operation on the deque returns ErrDBClosed.
+func (d *Deque) Close() error {
+	_, err := d.closeIf(nil)
+	return err
+}
+
+// closeIf closes the deque like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the deque in
+// between. If check fails, the deque is left as it is and the error is
+// returned. closeIf reports whether the deque is closed.
+func (d *Deque) closeIf(check func() error) (bool, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If deque is already closed.
+	if !d.isOpen {
+		return true, nil
+	}
+	d.isOpen = false
+
+	return true, d.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the deque, as long
+// as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (d *Deque) Drop() error {
+	return dropIf(d.DataDir, d.closeIf, checkEmpty(d.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the deque,
+// along with any items it still holds.
+func (d *Deque) ForceDrop() error {
+	err := d.Close()
+	if rerr := os.RemoveAll(d.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// getItemByID returns an item, if found, for the given ID.
+func (d *Deque) getItemByID(id uint64) (*Item, error) {
+	// Check if empty or out of bounds.
+	if d.Length() == 0 {
+		return nil, ErrEmpty
+	} else if id <= d.head || id > d.tail {
+		return nil, ErrOutOfBounds
+	}
+
+	var err error
+	item := &Item{ID: id, Key: idToKey(id)}
+	item.Value, err = d.db.Get(item.Key, nil)
+
+	return item, err
+}
+
+// init initializes the deque data.
+func (d *Deque) init() error {
+	// Create a new LevelDB Iterator.
+	iter := d.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	// Set deque head to the first item.
+	if iter.First() {
+		d.head = keyToID(iter.Key()) - 1
+	} else {
+		d.head = dequeStart
+	}
+
+	// Set deque tail to the last item.
+	if iter.Last() {
+		d.tail = keyToID(iter.Key())
+	} else {
+		d.tail = dequeStart
+	}
+
+	return iter.Error()
+}
@@ -0,0 +1,315 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDequeDrop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); os.IsNotExist(err) {
+		t.Error(err)
+	}
+
+	d.Drop()
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestDequeClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = d.PushBack(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = d.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = d.PushBack(NewItemString("value")); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on PushBack, got %v", err)
+	}
+
+	if _, err = d.PopFront(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on PopFront, got %v", err)
+	}
+
+	if _, err = d.PeekFront(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on PeekFront, got %v", err)
+	}
+
+	// Closing again is a no-op.
+	if err = d.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = d.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestDequeIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+	q.Close()
+
+	if _, err = OpenDeque(file); err != ErrIncompatibleType {
+		t.Error("Expected deque to return ErrIncompatibleTypes when opening Queue")
+	}
+}
+
+func TestDequePushPop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = d.PushBack(NewItemString(fmt.Sprintf("back item %d", i))); err != nil {
+			t.Error(err)
+		}
+		if err = d.PushFront(NewItemString(fmt.Sprintf("front item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if d.Length() != 10 {
+		t.Errorf("Expected deque length of 10, got %d", d.Length())
+	}
+
+	frontItem, err := d.PopFront()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "front item 5"
+	if frontItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, frontItem.ToString())
+	}
+
+	backItem, err := d.PopBack()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "back item 5"
+	if backItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, backItem.ToString())
+	}
+
+	if d.Length() != 8 {
+		t.Errorf("Expected deque length of 8, got %d", d.Length())
+	}
+}
+
+func TestDequePeek(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = d.PushBack(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	frontItem, err := d.PeekFront()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+	if frontItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, frontItem.ToString())
+	}
+
+	backItem, err := d.PeekBack()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 10"
+	if backItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, backItem.ToString())
+	}
+
+	offsetItem, err := d.PeekByOffset(2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 3"
+	if offsetItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, offsetItem.ToString())
+	}
+
+	idItem, err := d.PeekByID(offsetItem.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if idItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, idItem.ToString())
+	}
+
+	if d.Length() != 10 {
+		t.Errorf("Expected deque length of 10, got %d", d.Length())
+	}
+}
+
+func TestDequeUpdate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	item := NewItemString("value for item")
+	if err = d.PushFront(item); err != nil {
+		t.Error(err)
+	}
+
+	compStr := "new value for item"
+	if err = d.UpdateString(item, compStr); err != nil {
+		t.Error(err)
+	}
+
+	newItem, err := d.PeekByID(item.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, newItem.ToString())
+	}
+}
+
+func TestDequeReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = d.PushFront(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	d.Close()
+
+	d, err = OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	if d.Length() != 3 {
+		t.Errorf("Expected deque length of 3, got %d", d.Length())
+	}
+
+	item, err := d.PopBack()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestDequeEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	if err = d.PushBack(NewItemString("value for item")); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = d.PopFront(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = d.PopBack(); err != ErrEmpty {
+		t.Errorf("Expected to get queue empty error, got %v", err)
+	}
+}
+
+func BenchmarkDequePushBack(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		b.Error(err)
+	}
+	defer d.ForceDrop()
+
+	// Create dummy data for pushing
+	item := NewItemString("value")
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_ = d.PushBack(item)
+	}
+}
+
+func BenchmarkDequePopFront(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		b.Error(err)
+	}
+	defer d.ForceDrop()
+
+	// Fill with dummy data
+	for n := 0; n < b.N; n++ {
+		if err := d.PushBack(NewItemString("value")); err != nil {
+			b.Error(err)
+		}
+	}
+
+	// Start benchmark
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = d.PopFront()
+	}
+}
@@ -0,0 +1,303 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ItemWriter is the interface used to hand off items drained from a
+// stack or queue.
+//
+// WriteItems is given a batch of items in the order they would have been
+// removed and returns how many of them, starting from the first, were
+// accepted. Only accepted items are removed from the stack or queue.
+type ItemWriter interface {
+	WriteItems(items []*Item) (int, error)
+}
+
+// ItemWriterFunc is an adapter to allow the use of an ordinary function
+// as an ItemWriter.
+type ItemWriterFunc func(items []*Item) (int, error)
+
+// WriteItems calls f(items).
+func (f ItemWriterFunc) WriteItems(items []*Item) (int, error) {
+	return f(items)
+}
+
+// PriorityItemWriter is the interface used to hand off items drained
+// from a priority queue.
+//
+// WritePriorityItems is given a batch of items in dequeue order and
+// returns how many of them, starting from the first, were accepted.
+// Only accepted items are removed from the priority queue.
+type PriorityItemWriter interface {
+	WritePriorityItems(items []*PriorityItem) (int, error)
+}
+
+// PriorityItemWriterFunc is an adapter to allow the use of an ordinary
+// function as a PriorityItemWriter.
+type PriorityItemWriterFunc func(items []*PriorityItem) (int, error)
+
+// WritePriorityItems calls f(items).
+func (f PriorityItemWriterFunc) WritePriorityItems(items []*PriorityItem) (int, error) {
+	return f(items)
+}
+
+// DrainTo dequeues up to max items and hands them to the given writer,
+// removing only the items the writer accepted. It returns the number of
+// items removed from the queue.
+func (q *Queue) DrainTo(w ItemWriter, max int) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	if max <= 0 || q.Length() == 0 {
+		return 0, nil
+	}
+
+	// Create a new LevelDB Iterator over the items in the queue.
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}, nil)
+
+	// Collect up to max items from the head of the queue. The iterator
+	// is released before the items are removed, as some stores can't
+	// write while one is open.
+	var items []*Item
+	var err error
+	for len(items) < max && err == nil && iter.Next() {
+		var item *Item
+		if item, err = copyItem(q.format, q.seal, iter.Key(), iter.Value()); err == nil {
+			items = append(items, item)
+		}
+	}
+	if err == nil {
+		err = iter.Error()
+	}
+	iter.Release()
+	if err != nil {
+		return 0, err
+	}
+
+	// Hand the items to the writer.
+	n, werr := w.WriteItems(items)
+	n = clampAccepted(n, len(items))
+
+	// Remove the accepted items from the queue.
+	if err := deleteItems(q.db, q.wo, items[:n]); err != nil {
+		return 0, err
+	}
+	q.head += uint64(n)
+
+	return n, werr
+}
+
+// DrainTo pops up to max items and hands them to the given writer,
+// removing only the items the writer accepted. It returns the number of
+// items removed from the stack.
+func (s *Stack) DrainTo(w ItemWriter, max int) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	if max <= 0 || s.Length() == 0 {
+		return 0, nil
+	}
+
+	// Create a new LevelDB Iterator over the items in the stack.
+	iter := s.db.NewIterator(&util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}, nil)
+
+	// Collect up to max items from the top of the stack. The iterator
+	// is released before the items are removed, as some stores can't
+	// write while one is open.
+	var items []*Item
+	var err error
+	for ok := iter.Last(); ok && len(items) < max && err == nil; ok = iter.Prev() {
+		var item *Item
+		if item, err = copyItem(s.format, s.seal, iter.Key(), iter.Value()); err == nil {
+			items = append(items, item)
+		}
+	}
+	if err == nil {
+		err = iter.Error()
+	}
+	iter.Release()
+	if err != nil {
+		return 0, err
+	}
+
+	// Hand the items to the writer.
+	n, werr := w.WriteItems(items)
+	n = clampAccepted(n, len(items))
+
+	// Remove the accepted items from the stack.
+	if n > 0 {
+		batch := new(leveldb.Batch)
+		for _, item := range items[:n] {
+			batch.Delete(item.Key)
+		}
+		head, tail := s.trimmed(items[n-1].ID-1, s.tail)
+		if err := s.writeMeta(batch, head, tail); err != nil {
+			return 0, err
+		}
+		s.head = items[n-1].ID - 1
+		s.trim()
+	}
+	size := itemsSize(items[:n])
+	s.bounds.remove(size)
+	s.compact.deleted(s.db, s.log, uint64(n), size)
+	s.counters.Dequeued += uint64(n)
+	fireItem(s.hooks.OnDequeue, items[:n]...)
+
+	return n, werr
+}
+
+// DrainTo dequeues up to max items and hands them to the given writer,
+// removing only the items the writer accepted. It returns the number of
+// items removed from the priority queue.
+func (pq *PriorityQueue) DrainTo(w PriorityItemWriter, max int) (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	if max <= 0 {
+		return 0, nil
+	}
+
+	// Return items with expired leases first, and remove the expired
+	// items at the front of each level.
+	if err := pq.reclaimDue(); err != nil {
+		return 0, err
+	}
+	if err := pq.expireHeads(); err != nil {
+		return 0, err
+	}
+
+	// Collect up to max items, walking the active priority levels in
+	// dequeue order.
+	var items []*PriorityItem
+	levels := pq.active.levels()
+	for i := range levels {
+		if len(items) == max {
+			break
+		}
+
+		priority := levels[i]
+		if pq.order == DESC {
+			priority = levels[len(levels)-1-i]
+		}
+
+		var err error
+		if items, err = pq.appendLevelItems(items, priority, max); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	// Hand the items to the writer.
+	n, werr := w.WritePriorityItems(items)
+	n = clampAccepted(n, len(items))
+
+	// Remove the accepted items from the priority queue.
+	if n > 0 {
+		batch := new(leveldb.Batch)
+		for _, item := range items[:n] {
+			batch.Delete(item.Key)
+		}
+		pq.putLevelsMeta(batch, items[:n], (*priorityLevel).withHead)
+		if err := pq.write(batch, changeOf(ChangeDequeue, items[:n]...)); err != nil {
+			return 0, err
+		}
+	}
+
+	// Increment the position of each priority level.
+	for _, item := range items[:n] {
+		pq.advanceHead(item.Priority, item.ID)
+	}
+	size := priorityItemsSize(items[:n])
+	pq.bounds.remove(size)
+	pq.compact.deleted(pq.db, pq.log, uint64(n), size)
+	pq.counters.Dequeued += uint64(n)
+	firePriority(pq.hooks.OnDequeue, items[:n]...)
+
+	return n, werr
+}
+
+// appendLevelItems appends items from the head of the given priority
+// level to items until it holds max items or the level is exhausted.
+func (pq *PriorityQueue) appendLevelItems(items []*PriorityItem, priority uint8, max int) ([]*PriorityItem, error) {
+	level := pq.levels[priority]
+
+	// Create a new LevelDB Iterator over the items in this level.
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq.generateKey(priority, level.head+1),
+		Limit: pq.generateKey(priority, level.tail+1),
+	}, nil)
+	defer iter.Release()
+
+	for len(items) < max && iter.Next() {
+		item, err := pq.decodeItem(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, iter.Error()
+}
+
+// clampAccepted limits the number of items a writer reports as
+// accepted to the range of items it was given.
+func clampAccepted(n, total int) int {
+	if n < 0 {
+		return 0
+	} else if n > total {
+		return total
+	}
+
+	return n
+}
+
+// copyItem creates an Item from the key and value of a LevelDB
+// iterator, stored in the given format and sealed with seal, copying
+// both since the iterator reuses its buffers.
+func copyItem(format uint8, seal valueSeal, key, value []byte) (*Item, error) {
+	item := &Item{
+		ID:  keyToID(key),
+		Key: append([]byte(nil), key...),
+	}
+	if err := decodeItemValue(format, seal, item, value); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// deleteItems deletes the keys of the given items in a single batch,
+// using the given write options.
+func deleteItems(db Store, wo *opt.WriteOptions, items []*Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	for _, item := range items {
+		batch.Delete(item.Key)
+	}
+
+	return db.Write(batch, wo)
+}
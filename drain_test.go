@@ -0,0 +1,133 @@
+package goque
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueDrainTo(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = q.Enqueue(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Accept only the first 3 of the 5 items handed to the writer.
+	errUpstream := errors.New("upstream unavailable")
+	var got []*Item
+	n, err := q.DrainTo(ItemWriterFunc(func(items []*Item) (int, error) {
+		got = items
+		return 3, errUpstream
+	}), 5)
+	if err != errUpstream {
+		t.Errorf("Expected to get writer error, got %v", err)
+	}
+
+	if n != 3 || len(got) != 5 {
+		t.Errorf("Expected 3 of 5 items to be drained, got %d of %d", n, len(got))
+	}
+
+	if q.Length() != 7 {
+		t.Errorf("Expected queue length of 7, got %d", q.Length())
+	}
+
+	compStr := "value for item 4"
+
+	item, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestStackDrainTo(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var got []*Item
+	n, err := s.DrainTo(ItemWriterFunc(func(items []*Item) (int, error) {
+		got = items
+		return len(items), nil
+	}), 20)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 10 || s.Length() != 0 {
+		t.Errorf("Expected all 10 items to be drained, got %d", n)
+	}
+
+	compStr := "value for item 10"
+	if got[0].ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, got[0].ToString())
+	}
+}
+
+func TestPriorityQueueDrainTo(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 2; i++ {
+			item := NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))
+			if err = pq.Enqueue(item); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	var got []*PriorityItem
+	n, err := pq.DrainTo(PriorityItemWriterFunc(func(items []*PriorityItem) (int, error) {
+		got = items
+		return len(items), nil
+	}), 5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 5 || pq.Length() != 5 {
+		t.Errorf("Expected 5 items to be drained, got %d", n)
+	}
+
+	for i, p := range []uint8{4, 4, 3, 3, 2} {
+		if got[i].Priority != p {
+			t.Errorf("Expected priority level to be %d, got %d", p, got[i].Priority)
+		}
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+	if item.Priority != 2 || item.ToString() != compStr {
+		t.Errorf("Expected item '%s' at priority 2, got '%s' at %d", compStr, item.ToString(), item.Priority)
+	}
+}
@@ -0,0 +1,169 @@
+package goque
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// DropWithArchive writes a gzip-compressed backup of the priority queue
+// to a new file at path, then closes and deletes its LevelDB database
+// like ForceDrop. If the archive can't be written, or a file already
+// exists at path, nothing is deleted. The archive is restored by passing
+// it through gzip.NewReader to Restore.
+//
+// The archive is written holding the lock of the priority queue, which
+// is only released once it is closed, so every item added before the
+// call is part of the archive and nothing is added afterwards. Items
+// that are in flight are not included. As with Drop, EnqueueAsync
+// returns ErrDBClosed until the archive is written.
+func (pq *PriorityQueue) DropWithArchive(path string) error {
+	return dropIf(pq.DataDir, pq.closeIf, func() error {
+		return archiveStore(path, pq.isOpen, goquePriorityQueue, pq.format, pq.db)
+	})
+}
+
+// DropWithArchive writes a gzip-compressed backup of the stack to a new
+// file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (s *Stack) DropWithArchive(path string) error {
+	return dropIf(s.DataDir, s.closeIf, func() error {
+		return archiveStore(path, s.isOpen, goqueStack, s.format, s.db)
+	})
+}
+
+// DropWithArchive writes a gzip-compressed backup of the queue to a new
+// file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (q *Queue) DropWithArchive(path string) error {
+	return dropIf(q.DataDir, q.closeIf, func() error {
+		return archiveStore(path, q.isOpen, goqueQueue, q.format, q.db)
+	})
+}
+
+// DropWithArchive writes a gzip-compressed backup of the deque to a new
+// file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (d *Deque) DropWithArchive(path string) error {
+	return dropIf(d.DataDir, d.closeIf, func() error {
+		return archiveStore(path, d.isOpen, goqueDeque, defaultFormat(goqueDeque), d.db)
+	})
+}
+
+// DropWithArchive writes a gzip-compressed backup of the prefix queue to
+// a new file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (pq *PrefixQueue) DropWithArchive(path string) error {
+	return dropIf(pq.DataDir, pq.closeIf, func() error {
+		return archiveStore(path, pq.isOpen, goquePrefixQueue, defaultFormat(goquePrefixQueue), pq.db)
+	})
+}
+
+// DropWithArchive writes a gzip-compressed backup of the delay queue to
+// a new file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (dq *DelayQueue) DropWithArchive(path string) error {
+	return dropIf(dq.DataDir, dq.closeIf, dq.archiveCheck(path, goqueDelayQueue))
+}
+
+// DropWithArchive writes a gzip-compressed backup of the retry queue to
+// a new file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive.
+func (rq *RetryQueue) DropWithArchive(path string) error {
+	return dropIf(rq.dq.DataDir, rq.dq.closeIf, rq.dq.archiveCheck(path, goqueRetryQueue))
+}
+
+// DropWithArchive writes a gzip-compressed backup of the scheduled queue
+// to a new file at path, then deletes it, the same way as
+// PriorityQueue.DropWithArchive. Items the background goroutine already
+// dequeued are not included.
+func (sq *ScheduledQueue) DropWithArchive(path string) error {
+	return dropIf(sq.DataDir, sq.closeIf, sq.archiveCheck(path, goqueDelayQueue))
+}
+
+// archiveCheck returns the check for closeIf that writes the archive of
+// DropWithArchive for the delay queue, as a data structure of the given
+// Goque type.
+func (dq *DelayQueue) archiveCheck(path string, gt goqueType) func() error {
+	return func() error {
+		return archiveStore(path, dq.isOpen, gt, defaultFormat(gt), dq.db)
+	}
+}
+
+// dropIf closes a data structure with the given closeIf, passing it
+// check, and deletes its data directory at dir if it was closed. Drop
+// and DropWithArchive use it so nothing can change the data structure
+// between the check and the close.
+func dropIf(dir string, closeIf func(check func() error) (bool, error), check func() error) error {
+	closed, err := closeIf(check)
+	if !closed {
+		return err
+	}
+
+	if rerr := os.RemoveAll(dir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// checkEmpty returns the check for closeIf that fails with ErrNotEmpty
+// while the given length is more than 0.
+func checkEmpty(length func() uint64) func() error {
+	return func() error {
+		if length() > 0 {
+			return ErrNotEmpty
+		}
+		return nil
+	}
+}
+
+// archiveStore writes a backup of the given store, holding a data
+// structure of the given Goque type and format, to a new file at path
+// with writeArchive. The caller must hold the lock of the data
+// structure, which is closed unless isOpen.
+func archiveStore(path string, isOpen bool, gt goqueType, format uint8, db Store) error {
+	// If the data structure is closed.
+	if !isOpen {
+		return ErrDBClosed
+	}
+
+	snap, err := takeSnapshot(db)
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeArchive(path, func(w io.Writer) error {
+		return writeBackup(w, gt, format, snap)
+	})
+}
+
+// writeArchive writes the backup written by the given function to a new
+// file at path, compressed with gzip. The file is synced before it is
+// closed, so the data structure is only deleted once its archive is on
+// disk, and removed again if anything fails.
+func writeArchive(path string, backup func(w io.Writer) error) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	zw := gzip.NewWriter(f)
+	if err = backup(zw); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,248 @@
+package goque
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueDropNotEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+
+	// Items in flight count too.
+	if _, _, err = pq.DequeueWithLease(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty with an item in flight, got %v", err)
+	}
+
+	// Nothing was closed or deleted.
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Errorf("Expected the priority queue to stay open, got %v", err)
+	}
+
+	if err = pq.ForceDrop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestPriorityQueueDropAsync(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// Items buffered by EnqueueAsync count too.
+	pq.SetAsyncBuffer(16, OverflowError)
+	if err = pq.EnqueueAsyncString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty with a buffered item, got %v", err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	// EnqueueAsync buffers items again, with the same overflow policy.
+	for i := 0; i < 16; i++ {
+		if err = pq.EnqueueAsyncString(0, "value"); err != nil && err != ErrFull {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() < 2 {
+		t.Errorf("Expected the buffered items to be written, got queue length of %d", pq.Length())
+	}
+}
+
+func TestStackDropNotEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestScheduledQueueDropNotEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueIn([]byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err = sq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty for an item not due yet, got %v", err)
+	}
+}
+
+func TestPriorityQueueDropWithArchive(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(uint8(i), fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An existing file is never overwritten, and nothing is deleted.
+	archive := file + ".gz"
+	defer os.Remove(archive)
+	if err = ioutil.WriteFile(archive, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.DropWithArchive(archive); !os.IsExist(err) {
+		t.Errorf("Expected an existing archive to be refused, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(archive); string(data) != "existing" {
+		t.Errorf("Expected the existing file to be kept, got %q", data)
+	}
+	if pq.Length() != 3 {
+		t.Fatalf("Expected 3 items to be kept, got %d", pq.Length())
+	}
+	os.Remove(archive)
+
+	if err = pq.DropWithArchive(archive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+
+	// The archive restores the priority queue.
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := file + "_restored"
+	if err = Restore(zr, restored); err != nil {
+		t.Fatal(err)
+	}
+	if pq, err = OpenPriorityQueue(restored, ASC); err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected 3 restored items, got %d", pq.Length())
+	}
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected 'value for item 1', got '%s'", item.ToString())
+	}
+}
+
+func TestPriorityQueueDropWithArchiveConcurrent(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// Every item added before the priority queue is closed is archived.
+	added := make(chan int)
+	for p := 0; p < 4; p++ {
+		go func(p int) {
+			n := 0
+			for {
+				if _, err := pq.EnqueueString(uint8(p), "value"); err != nil {
+					break
+				}
+				n++
+			}
+			added <- n
+		}(p)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	archive := file + ".gz"
+	defer os.Remove(archive)
+	if err = pq.DropWithArchive(archive); err != nil {
+		t.Fatal(err)
+	}
+	var n uint64
+	for p := 0; p < 4; p++ {
+		n += uint64(<-added)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := file + "_restored"
+	if err = Restore(zr, restored); err != nil {
+		t.Fatal(err)
+	}
+	if pq, err = OpenPriorityQueue(restored, ASC); err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if pq.Length() != n {
+		t.Errorf("Expected %d restored items, got %d", n, pq.Length())
+	}
+}
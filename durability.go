@@ -0,0 +1,107 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// syncKey is deleted to sync the journal of a store. It is never stored,
+// so the deletion leaves nothing behind that an iterator would see.
+var syncKey = []byte("goque:sync")
+
+// Durability defines when writes are synced to stable storage.
+type Durability int
+
+// The possible durability levels.
+const (
+	// DurabilityNone never syncs writes, leaving it to the operating
+	// system. A power loss can lose recent writes.
+	DurabilityNone Durability = iota
+
+	// DurabilityBatched does not sync writes as they happen, but syncs
+	// everything written so far when Sync is called and on Close.
+	DurabilityBatched
+
+	// DurabilityPerWrite syncs every write before it returns.
+	DurabilityPerWrite
+)
+
+// writeOptions returns the LevelDB write options for the durability
+// level.
+func (d Durability) writeOptions() *opt.WriteOptions {
+	return &opt.WriteOptions{Sync: d == DurabilityPerWrite}
+}
+
+// syncDB syncs everything written to the store so far.
+func syncDB(db Store) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(syncKey)
+	return db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// SetDurability sets when the writes of the priority queue are synced.
+// The default is DurabilityNone.
+func (pq *PriorityQueue) SetDurability(d Durability) {
+	pq.Lock()
+	defer pq.Unlock()
+	pq.durable = d
+	pq.wo = d.writeOptions()
+}
+
+// Sync syncs everything written to the priority queue so far to stable
+// storage.
+func (pq *PriorityQueue) Sync() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(pq.db)
+}
+
+// SetDurability sets when the writes of the stack are synced. The
+// default is DurabilityNone.
+func (s *Stack) SetDurability(d Durability) {
+	s.Lock()
+	defer s.Unlock()
+	s.durable = d
+	s.wo = d.writeOptions()
+}
+
+// Sync syncs everything written to the stack so far to stable storage.
+func (s *Stack) Sync() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(s.db)
+}
+
+// SetDurability sets when the writes of the queue are synced. The
+// default is DurabilityNone.
+func (q *Queue) SetDurability(d Durability) {
+	q.Lock()
+	defer q.Unlock()
+	q.durable = d
+	q.wo = d.writeOptions()
+}
+
+// Sync syncs everything written to the queue so far to stable storage.
+func (q *Queue) Sync() error {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(q.db)
+}
@@ -0,0 +1,105 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueDurability(t *testing.T) {
+	for _, d := range []Durability{DurabilityNone, DurabilityBatched, DurabilityPerWrite} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		pq, err := OpenPriorityQueue(file, ASC)
+		if err != nil {
+			t.Error(err)
+		}
+
+		pq.SetDurability(d)
+		for i := 1; i <= 3; i++ {
+			if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+				t.Error(err)
+			}
+		}
+
+		if err = pq.Sync(); err != nil {
+			t.Error(err)
+		}
+
+		// Reopen the priority queue and make sure the sync left no item.
+		pq.Close()
+		if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+			t.Error(err)
+		}
+
+		if pq.Length() != 3 {
+			t.Errorf("Expected queue length of 3 with durability %d, got %d", d, pq.Length())
+		}
+		pq.ForceDrop()
+	}
+}
+
+func TestStackDurability(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	s.SetDurability(DurabilityBatched)
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.Sync(); err != nil {
+		t.Error(err)
+	}
+
+	// Reopen the stack and make sure the sync left no item.
+	s.Close()
+	if s, err = OpenStack(file); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", item.ToString())
+	}
+}
+
+func TestQueueDurability(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	q.SetDurability(DurabilityPerWrite)
+	if err = q.Enqueue(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Sync(); err != nil {
+		t.Error(err)
+	}
+
+	q.Close()
+	if q, err = OpenQueue(file); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
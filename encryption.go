@@ -0,0 +1,236 @@
+package goque
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// envelopeEncrypted starts an encrypted envelope, which holds the ID of
+// the key it was encrypted with, the nonce and the AES-GCM ciphertext of
+// the envelope, sealed with the key of the item as additional data so
+// it can't be moved to another item:
+//
+//	version + key ID (4, big endian) + nonce (12) + ciphertext
+const envelopeEncrypted byte = 0x40
+
+// KeyProvider supplies the AES keys the values of items are encrypted
+// with, each known by an ID that is stored with the values it encrypted,
+// so keys can be rotated without re-encrypting the values.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key new values are encrypted
+	// with. The key must be 16, 24 or 32 bytes long, to use AES-128,
+	// AES-192 or AES-256.
+	CurrentKey() (uint32, []byte, error)
+
+	// Key returns the key with the given ID, to decrypt the values
+	// encrypted with it.
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory, by ID, which
+// encrypts new values with the key of the ID Current.
+type StaticKeys struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+// CurrentKey returns the key of the ID Current.
+func (k StaticKeys) CurrentKey() (uint32, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+// Key returns the key with the given ID, or ErrKeyNotFound.
+func (k StaticKeys) Key(id uint32) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// SetEncryption makes the priority queue encrypt the value of every item
+// it writes from now on with AES-GCM, using the current key of the given
+// provider, along with the headers, timestamps and attempts of the item.
+// Values are decrypted whenever they are read, using the key they were
+// encrypted with.
+//
+// To rotate keys, make the provider return a new current key and call
+// SetEncryption again. Values encrypted before keep their key until they
+// are written again, so the provider must go on returning it. A nil
+// provider stops encrypting new values, and reading an encrypted one
+// then returns ErrKeyNotFound. An encrypted value that was tampered
+// with, or can't be decrypted with its key, returns ErrDecryptionFailed.
+//
+// Encryption isn't persisted, so SetEncryption must be called after
+// every open. If the priority queue stores values as is, having been
+// created by an older version of Goque, ErrUnsupportedFormat is
+// returned.
+func (pq *PriorityQueue) SetEncryption(keys KeyProvider) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if pq.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+
+	crypt, err := newEncryption(keys)
+	if err != nil {
+		return err
+	}
+	pq.seal.crypt = crypt
+
+	return nil
+}
+
+// SetEncryption makes the stack encrypt the value of every item it
+// writes from now on, the same way as PriorityQueue.SetEncryption.
+func (s *Stack) SetEncryption(keys KeyProvider) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+
+	crypt, err := newEncryption(keys)
+	if err != nil {
+		return err
+	}
+	s.seal.crypt = crypt
+
+	return nil
+}
+
+// SetEncryption makes the queue encrypt the value of every item it
+// writes from now on, the same way as PriorityQueue.SetEncryption.
+func (q *Queue) SetEncryption(keys KeyProvider) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.format == formatRaw {
+		return ErrUnsupportedFormat
+	}
+
+	crypt, err := newEncryption(keys)
+	if err != nil {
+		return err
+	}
+	q.seal.crypt = crypt
+
+	return nil
+}
+
+// encryption encrypts envelopes with the current key of a KeyProvider,
+// and decrypts them with the key they were encrypted with.
+type encryption struct {
+	keys    KeyProvider
+	id      uint32
+	current cipher.AEAD
+
+	// The ciphers of the keys used to decrypt values so far, by ID.
+	mu      sync.Mutex
+	ciphers map[uint32]cipher.AEAD
+}
+
+// newEncryption returns the encryption using the current key of the
+// given provider, or nil if the provider is nil.
+func newEncryption(keys KeyProvider) (*encryption, error) {
+	if keys == nil {
+		return nil, nil
+	}
+
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptWith(keys, id, key)
+}
+
+// encryptWith returns the encryption using the given key, with the
+// given ID, of the given provider.
+func encryptWith(keys KeyProvider, id uint32, key []byte) (*encryption, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryption{
+		keys:    keys,
+		id:      id,
+		current: aead,
+		ciphers: map[uint32]cipher.AEAD{id: aead},
+	}, nil
+}
+
+// newAEAD returns the AES-GCM cipher using the given key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the envelope in data, stored at the given key, with the
+// current key, returning an error if no random nonce could be read.
+func (e *encryption) seal(key, data []byte) ([]byte, error) {
+	// version + key ID + nonce = 1 + 4 + 12 = 17
+	out := make([]byte, 17, 17+len(data)+e.current.Overhead())
+	out[0] = envelopeEncrypted
+	binary.BigEndian.PutUint32(out[1:5], e.id)
+	if _, err := io.ReadFull(rand.Reader, out[5:17]); err != nil {
+		return nil, err
+	}
+
+	return e.current.Seal(out, out[5:17], data, key), nil
+}
+
+// open decrypts the encrypted envelope in data, stored at the given key.
+func (e *encryption) open(key, data []byte) ([]byte, error) {
+	if len(data) < 17 {
+		return nil, ErrDecryptionFailed
+	}
+
+	aead, err := e.cipher(binary.BigEndian.Uint32(data[1:5]))
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := aead.Open(nil, data[5:17], data[17:], key)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return envelope, nil
+}
+
+// cipher returns the cipher of the key with the given ID, fetching the
+// key from the provider the first time.
+func (e *encryption) cipher(id uint32) (cipher.AEAD, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if aead, ok := e.ciphers[id]; ok {
+		return aead, nil
+	}
+
+	key, err := e.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	e.ciphers[id] = aead
+
+	return aead, nil
+}
@@ -0,0 +1,190 @@
+package goque
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueEncryption(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	keys := &StaticKeys{Current: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}}
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+
+	item := NewPriorityItemString("secret 1", 0)
+	item.Headers = map[string]string{"email": "someone@example.com"}
+	if err = pq.Enqueue(item); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the value nor the headers are stored in the clear.
+	data, err := pq.db.Get(item.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != envelopeEncrypted || bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("example.com")) {
+		t.Errorf("Expected an encrypted value, got %q", data)
+	}
+
+	// Rotate the key.
+	keys.Current = 2
+	keys.Keys[2] = bytes.Repeat([]byte{2}, 16)
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(0, "secret 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the priority queue, and read both values back.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	defer pq.Close()
+
+	if _, err = pq.Peek(); err != ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound without the keys, got %v", err)
+	}
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"secret 1", "secret 2"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if item.Headers["email"] != "someone@example.com" {
+		t.Errorf("Expected the headers to be decrypted, got %v", item.Headers)
+	}
+}
+
+func TestPriorityQueueEncryptionTampered(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	keys := StaticKeys{Current: 7, Keys: map[uint32][]byte{7: bytes.Repeat([]byte{7}, 32)}}
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A value moved to another item doesn't decrypt.
+	data, err := pq.db.Get(pq.generateKey(0, 2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.db.Put(pq.generateKey(0, 1), data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.Dequeue(); err != ErrDecryptionFailed {
+		t.Errorf("Expected ErrDecryptionFailed, got %v", err)
+	}
+
+	// A key that isn't AES-sized is refused.
+	keys.Keys[7] = []byte("short")
+	if err = pq.SetEncryption(keys); err == nil {
+		t.Error("Expected an invalid key to be refused")
+	}
+}
+
+// errNonceFailed is returned by every read of a failReader.
+var errNonceFailed = errors.New("nonce failed")
+
+// failReader is a reader whose reads always fail.
+type failReader struct{}
+
+func (failReader) Read(p []byte) (int, error) {
+	return 0, errNonceFailed
+}
+
+func TestPriorityQueueEncryptionNonceFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	keys := &StaticKeys{Current: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}}
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	// An item is never stored with a nonce that isn't random.
+	reader := rand.Reader
+	rand.Reader = failReader{}
+	_, err = pq.EnqueueString(0, "secret")
+	rand.Reader = reader
+	if err != errNonceFailed {
+		t.Errorf("Expected the nonce error, got %v", err)
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestQueueEncryption(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if _, err = q.EnqueueString("plain"); err != nil {
+		t.Fatal(err)
+	}
+	keys := StaticKeys{Current: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 24)}}
+	if err = q.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.EnqueueString("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := q.db.Get(idToKey(2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Errorf("Expected an encrypted value, got %q", data)
+	}
+
+	for _, want := range []string{"plain", "secret"} {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
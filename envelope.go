@@ -0,0 +1,452 @@
+package goque
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// seqKey is the key used to persist the last sequence number assigned
+// to an item in a priority queue. Its second byte is not prefixSep, so
+// it can never collide with the key of an item in any priority level.
+var seqKey = []byte("goque:seq")
+
+// levelSeqPrefix is the prefix of the keys used instead of seqKey by
+// enqueues holding just the lock of their priority level, followed by
+// the priority. Each key is only written by one enqueue at a time, so
+// the numbers stored are always the last ones of their level.
+var levelSeqPrefix = []byte("goque:seq:")
+
+// The versions of the envelope wrapping item values.
+const (
+	envelopeV1 byte = 1 // Sequence number followed by the value.
+	envelopeV2 byte = 2 // Sequence number and attempts followed by the value.
+	envelopeV3 byte = 3 // Sequence number, attempts and metadata followed by the value.
+)
+
+// The versions of the envelope wrapping the values of stack and queue
+// items.
+const (
+	itemEnvelopeV1 byte = 1 // Metadata followed by the value.
+)
+
+// encodeValue returns the value stored in LevelDB for the given item,
+// passing it through the middleware, then wrapping it in an envelope
+// unless the priority queue was created before envelopes were
+// introduced, and sealing the envelope.
+func (pq *PriorityQueue) encodeValue(item *PriorityItem) ([]byte, error) {
+	value, err := pq.seal.write(item.Key, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	if pq.format == formatRaw {
+		return value, nil
+	}
+
+	stored := *item
+	stored.Value = value
+	data := encodeEnvelope(&stored)
+	return pq.seal.seal(item.Key, data)
+}
+
+// putValue adds the stored value of the given item to the batch.
+func (pq *PriorityQueue) putValue(batch *leveldb.Batch, item *PriorityItem) error {
+	value, err := pq.encodeValue(item)
+	if err != nil {
+		return err
+	}
+	batch.Put(item.Key, value)
+
+	return nil
+}
+
+// encodeEnvelope wraps the value of the given item in an envelope.
+// Items without headers or timestamps use the smaller version 1 or 2
+// envelopes, depending on whether they have failed attempts.
+func encodeEnvelope(item *PriorityItem) []byte {
+	if hasMetadata(item.Headers, item.CreatedAt, item.UpdatedAt) {
+		// version + seq + attempts + metadata + value
+		data := make([]byte, 13, 13+metadataSize(item.Headers)+len(item.Value))
+		data[0] = envelopeV3
+		binary.BigEndian.PutUint64(data[1:9], item.Seq)
+		binary.BigEndian.PutUint32(data[9:13], item.Attempts)
+		data = appendMetadata(data, item.Headers, item.CreatedAt, item.UpdatedAt)
+		return append(data, item.Value...)
+	}
+
+	if item.Attempts == 0 {
+		// version + seq + value = 1 + 8 + n
+		data := make([]byte, 9+len(item.Value))
+		data[0] = envelopeV1
+		binary.BigEndian.PutUint64(data[1:9], item.Seq)
+		copy(data[9:], item.Value)
+		return data
+	}
+
+	// version + seq + attempts + value = 1 + 8 + 4 + n
+	data := make([]byte, 13+len(item.Value))
+	data[0] = envelopeV2
+	binary.BigEndian.PutUint64(data[1:9], item.Seq)
+	binary.BigEndian.PutUint32(data[9:13], item.Attempts)
+	copy(data[13:], item.Value)
+	return data
+}
+
+// decodeItem creates a PriorityItem from the given key and stored
+// value, unwrapping the envelope of the value and passing it through
+// the middleware. Both are copied, so they may be buffers reused by a
+// LevelDB iterator.
+func (pq *PriorityQueue) decodeItem(key, data []byte) (*PriorityItem, error) {
+	item := &PriorityItem{
+		ID:       keyToID(key[2:]),
+		Priority: key[0],
+		Key:      append([]byte(nil), key...),
+	}
+
+	if pq.format == formatRaw {
+		return pq.readValue(item, append([]byte(nil), data...))
+	}
+
+	data, err := pq.seal.open(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(data) >= 9 && data[0] == envelopeV1:
+		item.Seq = binary.BigEndian.Uint64(data[1:9])
+		data = data[9:]
+	case len(data) >= 13 && data[0] == envelopeV2:
+		item.Seq = binary.BigEndian.Uint64(data[1:9])
+		item.Attempts = binary.BigEndian.Uint32(data[9:13])
+		data = data[13:]
+	case len(data) >= 13 && data[0] == envelopeV3:
+		item.Seq = binary.BigEndian.Uint64(data[1:9])
+		item.Attempts = binary.BigEndian.Uint32(data[9:13])
+		value, ok := readMetadata(data[13:], &item.Headers, &item.CreatedAt, &item.UpdatedAt)
+		if !ok {
+			return nil, ErrInvalidRecord
+		}
+		data = value
+	default:
+		return nil, ErrInvalidRecord
+	}
+
+	return pq.readValue(item, append([]byte(nil), data...))
+}
+
+// readValue returns the given item with the given copy of its stored
+// value, passed through the middleware.
+func (pq *PriorityQueue) readValue(item *PriorityItem, value []byte) (*PriorityItem, error) {
+	value, err := pq.seal.read(item.Key, value)
+	if err != nil {
+		return nil, err
+	}
+	item.Value = value
+
+	return item, nil
+}
+
+// encodeItemValue returns the value stored for the given stack or queue
+// item stored at the given key, passing it through the middleware of
+// seal, then wrapping it in an envelope unless the data directory was
+// created before envelopes were introduced for stacks and queues, and
+// sealing the envelope with seal.
+func encodeItemValue(format uint8, seal valueSeal, key []byte, item *Item) ([]byte, error) {
+	value, err := seal.write(key, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	if format == formatRaw {
+		return value, nil
+	}
+
+	// version + metadata + value
+	data := make([]byte, 1, 1+metadataSize(item.Headers)+len(value)+4)
+	data[0] = itemEnvelopeV1
+	data = appendMetadata(data, item.Headers, item.CreatedAt, item.UpdatedAt)
+	data = append(data, value...)
+	return seal.seal(key, data)
+}
+
+// decodeItemValue sets the value, headers and timestamps of the given
+// stack or queue item from its stored value, opening the envelope of
+// the value sealed with seal and passing it through the middleware of
+// seal. The value is copied, so it may be a buffer reused by a LevelDB
+// iterator.
+func decodeItemValue(format uint8, seal valueSeal, item *Item, data []byte) error {
+	if format == formatRaw {
+		return readItemValue(seal, item, append([]byte(nil), data...))
+	}
+
+	data, err := seal.open(item.Key, data)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < 1 || data[0] != itemEnvelopeV1 {
+		return ErrInvalidRecord
+	}
+	value, ok := readMetadata(data[1:], &item.Headers, &item.CreatedAt, &item.UpdatedAt)
+	if !ok {
+		return ErrInvalidRecord
+	}
+
+	return readItemValue(seal, item, append([]byte(nil), value...))
+}
+
+// readItemValue sets the value of the given stack or queue item to the
+// given copy of its stored value, passed through the middleware of
+// seal.
+func readItemValue(seal valueSeal, item *Item, value []byte) error {
+	value, err := seal.read(item.Key, value)
+	if err != nil {
+		return err
+	}
+	item.Value = value
+
+	return nil
+}
+
+// valueSeal is how a data structure stores its values: passed through
+// its middleware, with their envelopes compressed, with a checksum,
+// encrypted, or any of them.
+type valueSeal struct {
+	middleware  []ItemMiddleware
+	compression Compression
+	threshold   int
+	checksums   bool
+	crypt       *encryption
+}
+
+// seal returns the envelope in data as stored at the given key,
+// compressed if enabled and larger than the threshold, with a checksum
+// if enabled, encrypted if enabled.
+func (v valueSeal) seal(key, data []byte) ([]byte, error) {
+	if v.compression != CompressionNone && len(data) > v.threshold {
+		data = compress(v.compression, data)
+	}
+	if v.checksums {
+		data = appendChecksum(data)
+	}
+	if v.crypt != nil {
+		return v.crypt.seal(key, data)
+	}
+
+	return data, nil
+}
+
+// open returns the envelope sealed in data, stored at the given key,
+// decrypting it, checking its checksum and decompressing it, as needed.
+func (v valueSeal) open(key, data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == envelopeEncrypted {
+		if v.crypt == nil {
+			return nil, ErrKeyNotFound
+		}
+
+		var err error
+		if data, err = v.crypt.open(key, data); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := verifyChecksum(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompress(data)
+}
+
+// hasMetadata reports whether an item has any headers or timestamps.
+func hasMetadata(headers map[string]string, created, updated time.Time) bool {
+	return len(headers) > 0 || !created.IsZero() || !updated.IsZero()
+}
+
+// metadataSize returns the largest size of the encoded metadata with
+// the given headers.
+func metadataSize(headers map[string]string) int {
+	size := 16 + binary.MaxVarintLen64
+	for k, v := range headers {
+		size += 2*binary.MaxVarintLen64 + len(k) + len(v)
+	}
+
+	return size
+}
+
+// appendMetadata appends the encoded headers and timestamps of an item
+// to data. The timestamps come first, as nanoseconds since the Unix
+// epoch or 0 if unset, followed by the number of headers and each
+// length prefixed key and value, sorted by key.
+func appendMetadata(data []byte, headers map[string]string, created, updated time.Time) []byte {
+	var b [binary.MaxVarintLen64]byte
+	data = append(data, timeBytes(created)...)
+	data = append(data, timeBytes(updated)...)
+	data = append(data, b[:binary.PutUvarint(b[:], uint64(len(headers)))]...)
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		data = append(data, b[:binary.PutUvarint(b[:], uint64(len(k)))]...)
+		data = append(data, k...)
+		data = append(data, b[:binary.PutUvarint(b[:], uint64(len(headers[k])))]...)
+		data = append(data, headers[k]...)
+	}
+
+	return data
+}
+
+// readMetadata decodes the headers and timestamps encoded at the start
+// of data by appendMetadata, returning the rest of data. It returns
+// false if the metadata is truncated.
+func readMetadata(data []byte, headers *map[string]string, created, updated *time.Time) ([]byte, bool) {
+	if len(data) < 16 {
+		return nil, false
+	}
+	*created = bytesTime(data[0:8])
+	*updated = bytesTime(data[8:16])
+	data = data[16:]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, false
+	}
+	data = data[n:]
+
+	// readString reads the next length prefixed string.
+	readString := func() (string, bool) {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return "", false
+		}
+		s := string(data[n : n+int(size)])
+		data = data[n+int(size):]
+		return s, true
+	}
+
+	*headers = nil
+	for i := uint64(0); i < count; i++ {
+		k, ok := readString()
+		if !ok {
+			return nil, false
+		}
+		v, ok := readString()
+		if !ok {
+			return nil, false
+		}
+		if *headers == nil {
+			*headers = make(map[string]string)
+		}
+		(*headers)[k] = v
+	}
+
+	return data, true
+}
+
+// timeBytes encodes a timestamp as nanoseconds since the Unix epoch, or
+// 0 if it is unset.
+func timeBytes(t time.Time) []byte {
+	b := make([]byte, 8)
+	if !t.IsZero() {
+		binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	}
+	return b
+}
+
+// bytesTime decodes a timestamp encoded by timeBytes.
+func bytesTime(b []byte) time.Time {
+	if n := int64(binary.BigEndian.Uint64(b)); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// stampItem sets the creation and update times of a stack or queue item
+// added for the first time, unless the data directory stores values as
+// is. Items that already have a creation time, such as copies of items
+// from another data structure, keep their timestamps.
+func stampItem(format uint8, item *Item) {
+	if format != formatRaw && item.CreatedAt.IsZero() {
+		now := time.Now()
+		item.CreatedAt, item.UpdatedAt = now, now
+	}
+}
+
+// stampItems assigns the next global sequence numbers to the given
+// items, adding the new last sequence number to the batch. The
+// sequence is only advanced in memory once the batch is written, by
+// calling commitSeq with the returned value.
+func (pq *PriorityQueue) stampItems(batch *leveldb.Batch, items ...*PriorityItem) uint64 {
+	return pq.stampItemsFrom(pq.seq, batch, items...)
+}
+
+// stampItemsFrom is like stampItems, but assigns the sequence numbers
+// following the given one instead of the last committed one. Items
+// without a creation time are given one, along with an update time.
+func (pq *PriorityQueue) stampItemsFrom(seq uint64, batch *leveldb.Batch, items ...*PriorityItem) uint64 {
+	return pq.stampItemsTo(seqKey, seq, batch, items...)
+}
+
+// stampItemsTo is like stampItemsFrom, but adds the new last sequence
+// number to the batch under the given key.
+func (pq *PriorityQueue) stampItemsTo(key []byte, seq uint64, batch *leveldb.Batch, items ...*PriorityItem) uint64 {
+	if pq.format == formatRaw {
+		return seq
+	}
+
+	for _, item := range items {
+		seq++
+		item.Seq = seq
+		if item.CreatedAt.IsZero() {
+			now := time.Now()
+			item.CreatedAt, item.UpdatedAt = now, now
+		}
+	}
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, seq)
+	batch.Put(key, data)
+
+	return seq
+}
+
+// levelSeqKey returns the key storing the last sequence number assigned
+// by the enqueues holding just the lock of the given priority level.
+func levelSeqKey(priority uint8) []byte {
+	return append(append([]byte(nil), levelSeqPrefix...), priority)
+}
+
+// initSeq loads the last sequence number assigned to an item, which is
+// the highest one stored under seqKey or the keys of the levels.
+func (pq *PriorityQueue) initSeq() error {
+	pq.seq = 0
+	data, err := pq.db.Get(seqKey, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return err
+	} else if err == nil {
+		if len(data) != 8 {
+			return ErrInvalidRecord
+		}
+		pq.seq = binary.BigEndian.Uint64(data)
+	}
+
+	iter := pq.db.NewIterator(util.BytesPrefix(levelSeqPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if len(iter.Key()) != len(levelSeqPrefix)+1 || len(iter.Value()) != 8 {
+			return ErrInvalidRecord
+		}
+		if seq := binary.BigEndian.Uint64(iter.Value()); seq > pq.seq {
+			pq.seq = seq
+		}
+	}
+
+	return iter.Error()
+}
@@ -12,7 +12,115 @@ var (
 	// ErrEmpty is returned when the queue is empty.
 	ErrEmpty = errors.New("goque: The queue is empty")
 
+	// ErrFull is returned when adding items to a data structure that
+	// has reached its capacity.
+	ErrFull = errors.New("goque: The queue is full")
+
+	// ErrDBClosed is returned when using a data structure whose
+	// database has been closed.
+	ErrDBClosed = errors.New("goque: Database is closed")
+
+	// ErrTxDone is returned when using a transaction that has already
+	// been committed or rolled back.
+	ErrTxDone = errors.New("goque: Transaction has already been committed or rolled back")
+
+	// ErrSnapshotUnsupported is returned when taking a snapshot of a
+	// data structure whose store can't take snapshots.
+	ErrSnapshotUnsupported = errors.New("goque: Store does not support snapshots")
+
+	// ErrCompactUnsupported is returned when compacting a data
+	// structure whose store can't compact.
+	ErrCompactUnsupported = errors.New("goque: Store does not support compaction")
+
+	// ErrSizeUnsupported is returned when asking for the disk usage of
+	// a data structure whose store can't estimate its size.
+	ErrSizeUnsupported = errors.New("goque: Store does not support size estimates")
+
+	// ErrExpvarPublished is returned when publishing the stats of a
+	// data structure under an expvar name that is already published.
+	ErrExpvarPublished = errors.New("goque: Expvar name is already published")
+
+	// ErrInvalidBackup is returned when restoring a backup that is
+	// invalid, truncated or fails its checksum.
+	ErrInvalidBackup = errors.New("goque: Backup is invalid or truncated")
+
+	// ErrDataDirExists is returned when restoring a backup into a data
+	// directory that is not empty.
+	ErrDataDirExists = errors.New("goque: Data directory already exists")
+
+	// ErrNotEmpty is returned by Drop when the data structure still
+	// holds items. ForceDrop deletes them along with it.
+	ErrNotEmpty = errors.New("goque: Data structure still holds items")
+
+	// ErrNotVisible is returned when the queue has items, but none of
+	// them are visible yet.
+	ErrNotVisible = errors.New("goque: No item in the queue is visible yet")
+
+	// ErrMaxAttempts is returned when retrying an item that has used
+	// up all of its attempts.
+	ErrMaxAttempts = errors.New("goque: Item has used up all of its attempts")
+
 	// ErrOutOfBounds is returned when the ID used to lookup an item
 	// in the queue is outside the current range of the queue.
 	ErrOutOfBounds = errors.New("goque: ID used is out of the range of the queue")
+
+	// ErrUnsupportedFormat is returned when the data directory uses an
+	// on-disk format unknown to this version of Goque.
+	ErrUnsupportedFormat = errors.New("goque: Stored data format is not supported")
+
+	// ErrInvalidRecord is returned when a record stored in the
+	// database cannot be decoded.
+	ErrInvalidRecord = errors.New("goque: Stored record is invalid or has an unknown format")
+
+	// ErrChecksumMismatch is returned when the stored value of an item
+	// doesn't match its checksum.
+	ErrChecksumMismatch = errors.New("goque: Stored value does not match its checksum")
+
+	// ErrKeyNotFound is returned when the key an encrypted value was
+	// encrypted with is not available.
+	ErrKeyNotFound = errors.New("goque: Encryption key not found")
+
+	// ErrDecryptionFailed is returned when an encrypted value can't be
+	// decrypted, such as after it was tampered with.
+	ErrDecryptionFailed = errors.New("goque: Stored value could not be decrypted")
+
+	// ErrEncryptionDisabled is returned when rotating the key of a data
+	// structure on which SetEncryption was not called.
+	ErrEncryptionDisabled = errors.New("goque: Encryption is not enabled")
+
+	// ErrDuplicateKey is returned when enqueueing an item with a key
+	// that already has a pending item in a unique queue.
+	ErrDuplicateKey = errors.New("goque: Key already has a pending item")
+
+	// ErrItemNotFound is returned when looking up a key that has no
+	// pending item in a unique queue.
+	ErrItemNotFound = errors.New("goque: Key has no pending item")
+
+	// ErrOffsetTrimmed is returned when reading a topic from an offset
+	// whose item was already trimmed by its retention policy.
+	ErrOffsetTrimmed = errors.New("goque: Topic no longer holds the item at the requested offset")
+
+	// ErrInvalidToken is returned when an ownership token does not
+	// belong to any item currently in flight.
+	ErrInvalidToken = errors.New("goque: Token does not own an in-flight item")
+
+	// ErrLeaseExpired is returned when trying to extend the lease of an
+	// in-flight item after its deadline has passed.
+	ErrLeaseExpired = errors.New("goque: Lease on the in-flight item has expired")
+
+	// ErrGroupsInFlight is returned when every item queued belongs to a
+	// message group that already has an item in flight.
+	ErrGroupsInFlight = errors.New("goque: Every queued item belongs to a group with an item in flight")
+
+	// ErrChangeLogDisabled is returned when reading the change log of a
+	// priority queue on which EnableChangeLog was not called.
+	ErrChangeLogDisabled = errors.New("goque: Change log is not enabled")
+
+	// ErrChangesTrimmed is returned when reading the change log from a
+	// record that was already trimmed.
+	ErrChangesTrimmed = errors.New("goque: Change log no longer holds the requested changes")
+
+	// ErrShardCount is returned when opening a sharded queue with no
+	// shards, or with another number of shards than it was created with.
+	ErrShardCount = errors.New("goque: Shard count does not match the sharded queue")
 )
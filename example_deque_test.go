@@ -0,0 +1,49 @@
+package goque_test
+
+import (
+	"fmt"
+
+	"github.com/beeker1121/goque"
+)
+
+// ExampleDeque demonstrates the implementation of a Goque deque.
+func Example_deque() {
+	// Open/create a deque.
+	d, err := goque.OpenDeque("data_dir")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer d.Close()
+
+	// Add items to both ends of the deque.
+	err = d.PushBack(goque.NewItemString("back value"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = d.PushFront(goque.NewItemString("front value"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// Remove an item from the front of the deque.
+	frontItem, err := d.PopFront()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(frontItem.ToString()) // front value
+
+	// Remove an item from the back of the deque.
+	backItem, err := d.PopBack()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(backItem.ToString()) // back value
+}
@@ -0,0 +1,44 @@
+package goque_test
+
+import (
+	"fmt"
+
+	"github.com/beeker1121/goque"
+)
+
+// ExamplePrefixQueue demonstrates the implementation of a Goque prefix
+// queue.
+func Example_prefixQueue() {
+	// Open/create a prefix queue.
+	pq, err := goque.OpenPrefixQueue("data_dir")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer pq.Close()
+
+	// Enqueue items into two independent queues.
+	item, err := pq.EnqueueString("emails", "item value")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(item.ID)         // 1
+	fmt.Println(item.ToString()) // item value
+
+	_, err = pq.EnqueueString("reports", "other item value")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// Dequeue the next item of one of the queues.
+	deqItem, err := pq.DequeueString("reports")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(deqItem.ToString()) // other item value
+}
@@ -0,0 +1,224 @@
+package goque
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ExpiresHeader is the header holding the time an item expires at, in
+// Unix nanoseconds. It is set by EnqueueWithTTL.
+const ExpiresHeader = "goque-expires"
+
+// ExpiresAt returns the time the item expires at, or the zero time if it
+// never expires.
+func (pi *PriorityItem) ExpiresAt() time.Time {
+	ns, err := strconv.ParseInt(pi.Headers[ExpiresHeader], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
+
+// expired returns whether the item has expired by the given time.
+func (pi *PriorityItem) expired(now time.Time) bool {
+	expires := pi.ExpiresAt()
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// EnqueueWithTTL adds an item to the priority queue that expires once
+// the given duration has passed. The expiry is kept in the ExpiresHeader
+// of the item, so it is only persisted by priority queues that store
+// items in an envelope.
+//
+// Expired items are never dequeued. Dequeue, DequeueByPriority,
+// DequeueWithToken, DequeueWithLease and Reserve remove the expired
+// items they come across instead of returning them, and DrainTo removes
+// the expired items at the front of each priority level. Expired items
+// further back are left in place, and still returned by Peek, until
+// they reach the front or RemoveExpired is called, which SetJanitor can
+// do periodically.
+//
+// Each removed item is passed to the OnExpire hook, and moved to the
+// dead-letter queue set by SetDeadLetter, if any.
+//
+// A duration of 0 means the item never expires.
+func (pq *PriorityQueue) EnqueueWithTTL(item *PriorityItem, ttl time.Duration) error {
+	if ttl <= 0 {
+		return pq.Enqueue(item)
+	}
+
+	headers := make(map[string]string, len(item.Headers)+1)
+	for k, v := range item.Headers {
+		headers[k] = v
+	}
+	headers[ExpiresHeader] = strconv.FormatInt(time.Now().Add(ttl).UnixNano(), 10)
+	item.Headers = headers
+
+	return pq.Enqueue(item)
+}
+
+// RemoveExpired removes every expired item from the priority queue,
+// wherever it is, and returns the number of items removed.
+func (pq *PriorityQueue) RemoveExpired() (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	now := time.Now()
+	removed := 0
+	for _, priority := range pq.active.levels() {
+		items, err := pq.expiredItems(priority, now)
+		if err != nil {
+			return removed, err
+		}
+
+		for _, item := range items {
+			if err = pq.expireItem(item); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// SetJanitor starts a goroutine calling RemoveExpired and Trim at the
+// given interval until the priority queue is closed, replacing the one
+// started before. An interval of 0 stops it.
+//
+// The janitor isn't persisted, so SetJanitor should be called right
+// after every open.
+func (pq *PriorityQueue) SetJanitor(interval time.Duration) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if pq.janitor != nil {
+		close(pq.janitor)
+		pq.janitor = nil
+	}
+
+	// If the priority queue is closed.
+	if !pq.isOpen || interval <= 0 {
+		return
+	}
+
+	pq.janitor = make(chan struct{})
+	pq.streams.Add(1)
+	go pq.runJanitor(interval, pq.janitor)
+}
+
+// runJanitor removes the expired items and applies the retention policy
+// at the given interval until stop is closed or the priority queue is
+// closed.
+func (pq *PriorityQueue) runJanitor(interval time.Duration, stop chan struct{}) {
+	defer pq.streams.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := pq.RemoveExpired(); err != nil && err != ErrDBClosed {
+				pq.log.warn("goque: Failed to remove expired items", "dir", pq.DataDir, "error", err)
+			}
+			if _, err := pq.Trim(); err != nil && err != ErrDBClosed {
+				pq.log.warn("goque: Failed to trim items", "dir", pq.DataDir, "error", err)
+			}
+		case <-stop:
+			return
+		case <-pq.done:
+			return
+		}
+	}
+}
+
+// expiredItems returns the items of the given priority level that have
+// expired by the given time. The caller must hold the lock.
+func (pq *PriorityQueue) expiredItems(priority uint8, now time.Time) ([]*PriorityItem, error) {
+	level := pq.levels[priority]
+
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq.generateKey(priority, level.head+1),
+		Limit: pq.generateKey(priority, level.tail+1),
+	}, nil)
+	defer iter.Release()
+
+	var items []*PriorityItem
+	for iter.Next() {
+		item, err := pq.decodeItem(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if item.expired(now) {
+			items = append(items, item)
+		}
+	}
+
+	return items, iter.Error()
+}
+
+// skipExpired calls next until it returns an item that hasn't expired,
+// removing the expired ones. The caller must hold the lock.
+func (pq *PriorityQueue) skipExpired(next func() (*PriorityItem, error)) (*PriorityItem, error) {
+	now := time.Now()
+	for {
+		item, err := next()
+		if err != nil || !item.expired(now) {
+			return item, err
+		}
+
+		if err = pq.expireItem(item); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expireHeads removes the expired items at the front of every priority
+// level. The caller must hold the lock.
+func (pq *PriorityQueue) expireHeads() error {
+	for _, priority := range pq.active.levels() {
+		_, err := pq.skipExpired(func() (*PriorityItem, error) {
+			return pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+		})
+		if err != nil && err != ErrEmpty {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expireItem removes the given expired item from the priority queue,
+// moving it to the dead-letter queue if there is one. The caller must
+// hold the lock.
+func (pq *PriorityQueue) expireItem(item *PriorityItem) error {
+	if pq.dlq != nil {
+		if err := pq.deadLetter(item); err != nil {
+			return err
+		}
+	}
+
+	// Remove this item from the priority queue.
+	batch := new(leveldb.Batch)
+	pq.removeItem(batch, item)
+	putLevelMeta(batch, item.Priority, pq.levels[item.Priority].without(item.ID))
+	if err := pq.write(batch, changeOf(ChangeDrop, item)); err != nil {
+		return err
+	}
+	pq.commitRemove(item)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	firePriority(pq.hooks.OnExpire, item)
+
+	return nil
+}
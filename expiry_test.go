@@ -0,0 +1,147 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueEnqueueWithTTL(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	dlqFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dlq, err := OpenPriorityQueue(dlqFile, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dlq.ForceDrop()
+
+	var expired []string
+	pq.SetHooks(PriorityHooks{OnExpire: func(item *PriorityItem) {
+		expired = append(expired, item.ToString())
+	}})
+	pq.SetDeadLetter(dlq, 0)
+
+	for _, value := range []string{"short1", "short2"} {
+		if err = pq.EnqueueWithTTL(NewPriorityItemString(value, 0), 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	long := NewPriorityItemString("long", 0)
+	if err = pq.EnqueueWithTTL(long, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if long.ExpiresAt().Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("Expected the item to expire in an hour, got %v", long.ExpiresAt())
+	}
+	if err = pq.Enqueue(NewPriorityItemString("forever", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dequeue skips the expired items.
+	time.Sleep(20 * time.Millisecond)
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "long" {
+		t.Errorf("Expected 'long', got '%s'", item.ToString())
+	}
+	if len(expired) != 2 || expired[0] != "short1" || expired[1] != "short2" {
+		t.Errorf("Expected both short items to expire, got %v", expired)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	// The expired items are moved to the dead-letter queue, without
+	// their expiry.
+	if dlq.Length() != 2 {
+		t.Fatalf("Expected dead-letter queue length of 2, got %d", dlq.Length())
+	}
+	dead, err := dlq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dead.ToString() != "short1" || !dead.ExpiresAt().IsZero() {
+		t.Errorf("Expected 'short1' without an expiry, got '%s' expiring at %v", dead.ToString(), dead.ExpiresAt())
+	}
+
+	// An item without a TTL never expires.
+	item, err = pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !item.ExpiresAt().IsZero() {
+		t.Errorf("Expected no expiry, got %v", item.ExpiresAt())
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPriorityQueueRemoveExpired(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// Expiring items in the middle of their priority levels.
+	for i := 0; i < 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value%d", i), uint8(i))); err != nil {
+			t.Fatal(err)
+		}
+		if err = pq.EnqueueWithTTL(NewPriorityItemString("expiring", uint8(i)), 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value%d", i), uint8(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if n, err := pq.RemoveExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Errorf("Expected 3 items to be removed, got %d", n)
+	}
+	if pq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", pq.Length())
+	}
+	for i := 0; i < 6; i++ {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() == "expiring" {
+			t.Error("Expected the expired items to be removed")
+		}
+	}
+
+	// The janitor removes expired items in the background.
+	if err = pq.EnqueueWithTTL(NewPriorityItemString("expiring", 0), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.EnqueueWithTTL(NewPriorityItemString("expiring", 0), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	pq.SetJanitor(5 * time.Millisecond)
+	for i := 0; i < 100 && pq.LengthByPriority(0) != 1; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := pq.LengthByPriority(0); n != 1 {
+		t.Errorf("Expected queue length of 1, got %d", n)
+	}
+
+	// Close stops the janitor.
+	if err = pq.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,438 @@
+package goque
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// exportRecord is an item as written by Export and read by Import, as
+// one JSON object per line. Values and prefixes are base64 encoded, and
+// fields a data structure doesn't keep are left out.
+type exportRecord struct {
+	Priority  *uint8            `json:"priority,omitempty"`
+	Prefix    []byte            `json:"prefix,omitempty"`
+	ID        uint64            `json:"id"`
+	Value     []byte            `json:"value"`
+	Attempts  uint32            `json:"attempts,omitempty"`
+	VisibleAt *time.Time        `json:"visible_at,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+}
+
+// Export writes every item of the priority queue to w in dequeue order,
+// as JSON lines holding the priority, ID, base64 value and metadata of
+// each item. It reads a snapshot of the priority queue taken when the
+// export starts, without removing any item.
+func (pq *PriorityQueue) Export(w io.Writer) error {
+	it, err := pq.Iterator()
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		if !it.Next() {
+			return nil, it.Error()
+		}
+
+		item := it.Item()
+		rec := &exportRecord{
+			Priority: &item.Priority,
+			ID:       item.ID,
+			Value:    item.Value,
+			Attempts: item.Attempts,
+			Headers:  item.Headers,
+		}
+		rec.CreatedAt, rec.UpdatedAt = timePtr(item.CreatedAt), timePtr(item.UpdatedAt)
+		return rec, nil
+	})
+}
+
+// Import adds the items written by Export to the priority queue, read as
+// JSON lines from r, in batches of up to 1000 items. Items without a
+// priority go to priority level 0. They are given new IDs, keeping their
+// attempts, headers and timestamps, so an export imported into an empty
+// priority queue dequeues the same way.
+func (pq *PriorityQueue) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		items := make([]*PriorityItem, len(recs))
+		for i, rec := range recs {
+			var priority uint8
+			if rec.Priority != nil {
+				priority = *rec.Priority
+			}
+			items[i] = NewPriorityItem(rec.Value, priority)
+			items[i].Attempts = rec.Attempts
+			items[i].Headers = rec.Headers
+			items[i].CreatedAt, items[i].UpdatedAt = timeValue(rec.CreatedAt), timeValue(rec.UpdatedAt)
+		}
+
+		_, err := pq.EnqueueBatch(items)
+		return err
+	})
+}
+
+// Export writes every item of the stack to w in pop order, the same way
+// as PriorityQueue.Export.
+func (s *Stack) Export(w io.Writer) error {
+	it, err := s.Iterator(TopDown)
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		if !it.Next() {
+			return nil, it.Error()
+		}
+		return itemRecord(it.Item()), nil
+	})
+}
+
+// Import pushes the items written by Export onto the stack, read as JSON
+// lines from r, keeping their headers and timestamps. The items are
+// read in pop order, so they are all read before being pushed in a
+// single batch, the last one first, and pop in the order they were read.
+func (s *Stack) Import(r io.Reader) error {
+	var items []*Item
+	err := importFrom(r, func(recs []*exportRecord) error {
+		for _, rec := range recs {
+			items = append(items, recordItem(rec))
+		}
+		return nil
+	})
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	// Reverse the items, so the first one read ends up on top.
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+
+	_, err = s.PushBatch(items)
+	return err
+}
+
+// Export writes every item of the queue to w in dequeue order, the same
+// way as PriorityQueue.Export.
+func (q *Queue) Export(w io.Writer) error {
+	q.RLock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return ErrDBClosed
+	}
+
+	// The iterator reads a snapshot, so the lock isn't needed past
+	// this point.
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}, nil)
+	format, seal := q.format, q.seal
+	q.RUnlock()
+	defer iter.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		if !iter.Next() {
+			return nil, iter.Error()
+		}
+
+		item, err := copyItem(format, seal, iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		return itemRecord(item), nil
+	})
+}
+
+// Import adds the items written by Export to the queue, read as JSON
+// lines from r, in batches of up to 1000 items, keeping their headers
+// and timestamps.
+func (q *Queue) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		items := make([]*Item, len(recs))
+		for i, rec := range recs {
+			items[i] = recordItem(rec)
+		}
+
+		return q.enqueueBatch(items)
+	})
+}
+
+// Export writes every item of the deque to w from front to back, the
+// same way as PriorityQueue.Export.
+func (d *Deque) Export(w io.Writer) error {
+	d.RLock()
+
+	// If the deque is closed.
+	if !d.isOpen {
+		d.RUnlock()
+		return ErrDBClosed
+	}
+
+	iter := d.db.NewIterator(&util.Range{Start: idToKey(d.head + 1), Limit: idToKey(d.tail + 1)}, nil)
+	d.RUnlock()
+	defer iter.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		if !iter.Next() {
+			return nil, iter.Error()
+		}
+		return &exportRecord{ID: keyToID(iter.Key()), Value: copyValue(iter)}, nil
+	})
+}
+
+// Import pushes the items written by Export to the back of the deque,
+// read as JSON lines from r.
+func (d *Deque) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		for _, rec := range recs {
+			if err := d.PushBack(NewItem(rec.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Export writes every item of the prefix queue to w, the same way as
+// PriorityQueue.Export, along with its prefix. The queues are written
+// in the order of their prefixes, each one in dequeue order.
+func (pq *PrefixQueue) Export(w io.Writer) error {
+	pq.RLock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		pq.RUnlock()
+		return ErrDBClosed
+	}
+
+	iter := pq.db.NewIterator(nil, nil)
+	pq.RUnlock()
+	defer iter.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		for iter.Next() {
+			// Skip the total length and the positions of each queue,
+			// kept under ID 0.
+			key := iter.Key()
+			if len(key) < 9 || key[len(key)-9] != prefixSep[0] {
+				continue
+			}
+			id := keyToID(key[len(key)-8:])
+			if id == 0 {
+				continue
+			}
+
+			prefix := append([]byte{}, key[:len(key)-9]...)
+			return &exportRecord{Prefix: prefix, ID: id, Value: copyValue(iter)}, nil
+		}
+		return nil, iter.Error()
+	})
+}
+
+// Import adds the items written by Export to the queues of their
+// prefixes, read as JSON lines from r.
+func (pq *PrefixQueue) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		for _, rec := range recs {
+			if _, err := pq.Enqueue(rec.Prefix, rec.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Export writes every item of the delay queue to w in order of
+// visibility, the same way as PriorityQueue.Export, along with the time
+// it becomes visible at.
+func (dq *DelayQueue) Export(w io.Writer) error {
+	return dq.export(w, func(item *DelayItem) (*exportRecord, error) {
+		return &exportRecord{ID: item.ID, Value: item.Value, VisibleAt: &item.VisibleAt}, nil
+	})
+}
+
+// Import adds the items written by Export to the delay queue, read as
+// JSON lines from r. Items without a visibility time are visible right
+// away.
+func (dq *DelayQueue) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		for _, rec := range recs {
+			item := &DelayItem{VisibleAt: visibleAt(rec), Value: rec.Value}
+			if err := dq.Enqueue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// export writes every item of the delay queue to w in order of
+// visibility, as the records returned by the given function.
+func (dq *DelayQueue) export(w io.Writer, record func(item *DelayItem) (*exportRecord, error)) error {
+	dq.RLock()
+
+	// If the delay queue is closed.
+	if !dq.isOpen {
+		dq.RUnlock()
+		return ErrDBClosed
+	}
+
+	iter := dq.db.NewIterator(delayItemRange, nil)
+	dq.RUnlock()
+	defer iter.Release()
+
+	return exportTo(w, func() (*exportRecord, error) {
+		if !iter.Next() {
+			return nil, iter.Error()
+		}
+
+		key := iter.Key()
+		return record(&DelayItem{
+			ID:        keyToID(key[8:]),
+			VisibleAt: time.Unix(0, int64(keyToID(key[:8]))),
+			Value:     copyValue(iter),
+		})
+	})
+}
+
+// Export writes every item of the retry queue to w in order of
+// visibility, the same way as PriorityQueue.Export, along with its
+// attempts and the time it becomes visible at.
+func (rq *RetryQueue) Export(w io.Writer) error {
+	return rq.dq.export(w, func(di *DelayItem) (*exportRecord, error) {
+		item, err := decodeRetryItem(di)
+		if err != nil {
+			return nil, err
+		}
+		return &exportRecord{ID: item.ID, Value: item.Value, Attempts: item.Attempts, VisibleAt: &item.VisibleAt}, nil
+	})
+}
+
+// Import adds the items written by Export to the retry queue, read as
+// JSON lines from r, keeping their attempts. Items without a visibility
+// time are visible right away.
+func (rq *RetryQueue) Import(r io.Reader) error {
+	return importFrom(r, func(recs []*exportRecord) error {
+		for _, rec := range recs {
+			item := &RetryItem{Attempts: rec.Attempts, VisibleAt: visibleAt(rec), Value: rec.Value}
+			if err := rq.put(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// exportTo writes the records returned by next to w as JSON lines, until
+// next returns nil.
+func exportTo(w io.Writer, next func() (*exportRecord, error)) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for {
+		rec, err := next()
+		if err != nil {
+			return err
+		} else if rec == nil {
+			break
+		}
+
+		if err = enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// importFrom reads the records written by Export from r as JSON lines,
+// passing them to add in batches of up to defaultCopyBatchSize.
+func importFrom(r io.Reader, add func(recs []*exportRecord) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var batch []*exportRecord
+	for {
+		rec := new(exportRecord)
+		if err := dec.Decode(rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		batch = append(batch, rec)
+		if len(batch) == defaultCopyBatchSize {
+			if err := add(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return add(batch)
+}
+
+// itemRecord returns the record of the given item.
+func itemRecord(item *Item) *exportRecord {
+	return &exportRecord{
+		ID:        item.ID,
+		Value:     item.Value,
+		Headers:   item.Headers,
+		CreatedAt: timePtr(item.CreatedAt),
+		UpdatedAt: timePtr(item.UpdatedAt),
+	}
+}
+
+// recordItem returns a new item holding the value, headers and
+// timestamps of the given record.
+func recordItem(rec *exportRecord) *Item {
+	item := NewItem(rec.Value)
+	item.Headers = rec.Headers
+	item.CreatedAt, item.UpdatedAt = timeValue(rec.CreatedAt), timeValue(rec.UpdatedAt)
+
+	return item
+}
+
+// visibleAt returns the visibility time of the given record, or the
+// current time if it has none.
+func visibleAt(rec *exportRecord) time.Time {
+	if rec.VisibleAt == nil {
+		return time.Now()
+	}
+
+	return *rec.VisibleAt
+}
+
+// timePtr returns a pointer to the given time, or nil if it is zero.
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// timeValue returns the time the given pointer points to, or the zero
+// time if it is nil.
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
+
+// copyValue returns a copy of the value the iterator is at.
+func copyValue(iter iterator.Iterator) []byte {
+	return append([]byte{}, iter.Value()...)
+}
@@ -0,0 +1,345 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 4; i++ {
+		item := NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))
+		item.Headers = map[string]string{"n": fmt.Sprint(i)}
+		item.Attempts = uint32(i)
+		if err = pq.Enqueue(item); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Export(&buf); err != nil {
+		t.Error(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 4 {
+		t.Errorf("Expected 4 lines, got %d", n)
+	}
+	if pq.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", pq.Length())
+	}
+
+	// Import the export into a new priority queue.
+	dst, err := OpenPriorityQueue(file+"_import", ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(&buf); err != nil {
+		t.Error(err)
+	}
+
+	for _, i := range []int{2, 4, 1, 3} {
+		want, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		item, err := dst.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != fmt.Sprintf("value for item %d", i) || item.Priority != want.Priority ||
+			item.Attempts != want.Attempts || item.Headers["n"] != want.Headers["n"] ||
+			!item.CreatedAt.Equal(want.CreatedAt) || !item.UpdatedAt.Equal(want.UpdatedAt) {
+			t.Errorf("Expected item %+v, got %+v", want, item)
+		}
+	}
+}
+
+func TestStackExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = s.Export(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// The export of a stack imported into a stack pops the same way.
+	dst, err := OpenStack(file + "_import")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Error(err)
+	}
+	for i := 3; i >= 1; i-- {
+		item, err := dst.Pop()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != fmt.Sprintf("value for item %d", i) {
+			t.Errorf("Expected string to be 'value for item %d', got '%s'", i, item.ToString())
+		}
+	}
+
+	// Imported into a queue, it dequeues in pop order.
+	q, err := OpenQueue(file + "_queue")
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.Import(&buf); err != nil {
+		t.Error(err)
+	}
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", item.ToString())
+	}
+}
+
+func TestQueueExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Export(&buf); err != nil {
+		t.Error(err)
+	}
+	if err = q.Import(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// The imported items are added after the ones already there.
+	for _, i := range []int{2, 3, 2, 3} {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != fmt.Sprintf("value for item %d", i) {
+			t.Errorf("Expected string to be 'value for item %d', got '%s'", i, item.ToString())
+		}
+	}
+}
+
+func TestDequeExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	d, err := OpenDeque(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer d.ForceDrop()
+
+	if err = d.PushBack(NewItemString("back")); err != nil {
+		t.Error(err)
+	}
+	if err = d.PushFront(NewItemString("front")); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = d.Export(&buf); err != nil {
+		t.Error(err)
+	}
+
+	dst, err := OpenDeque(file + "_import")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(&buf); err != nil {
+		t.Error(err)
+	}
+	for _, want := range []string{"front", "back"} {
+		item, err := dst.PopFront()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestPrefixQueueExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for _, prefix := range []string{"b", "a"} {
+		for i := 1; i <= 2; i++ {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("%s%d", prefix, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Export(&buf); err != nil {
+		t.Error(err)
+	}
+
+	dst, err := OpenPrefixQueue(file + "_import")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(&buf); err != nil {
+		t.Error(err)
+	}
+	if dst.Length() != 4 {
+		t.Errorf("Expected length of 4, got %d", dst.Length())
+	}
+	for _, want := range []string{"b1", "b2"} {
+		item, err := dst.DequeueString("b")
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestDelayQueueExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if err = dq.Enqueue(NewDelayItemString("later", time.Hour)); err != nil {
+		t.Error(err)
+	}
+	if err = dq.Enqueue(NewDelayItemString("now", 0)); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = dq.Export(&buf); err != nil {
+		t.Error(err)
+	}
+
+	dst, err := OpenDelayQueue(file + "_import")
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(&buf); err != nil {
+		t.Error(err)
+	}
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "now" {
+		t.Errorf("Expected string to be 'now', got '%s'", item.ToString())
+	}
+	if _, err = dst.Dequeue(); err != ErrNotVisible {
+		t.Errorf("Expected to get not visible error, got %v", err)
+	}
+}
+
+func TestRetryQueueExportImport(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := OpenRetryQueue(file, RetryOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.ForceDrop()
+
+	item, err := rq.EnqueueString("value")
+	if err != nil {
+		t.Error(err)
+	}
+	if item, err = rq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if err = rq.Retry(item); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = rq.Export(&buf); err != nil {
+		t.Error(err)
+	}
+
+	dst, err := OpenRetryQueue(file+"_import", RetryOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.ForceDrop()
+
+	if err = dst.Import(&buf); err != nil {
+		t.Error(err)
+	}
+	peeked, err := dst.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if peeked.ToString() != "value" || peeked.Attempts != 1 || !peeked.VisibleAt.Equal(item.VisibleAt) {
+		t.Errorf("Expected value with 1 attempt visible at %v, got %+v", item.VisibleAt, peeked)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.Import(strings.NewReader(`{"value":"dmFsdWU="}` + "\nnot json\n")); err == nil {
+		t.Error("Expected an error importing invalid JSON")
+	}
+
+	// Only complete batches are added before the error.
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+}
@@ -0,0 +1,70 @@
+package goque
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// expvarMu makes checking for and publishing an expvar name atomic, as
+// expvar.Publish panics on a name that is already published.
+var expvarMu sync.Mutex
+
+// PublishExpvar publishes the length, head item age and operation
+// counters of the priority queue via expvar under the given name, so
+// they show up on /debug/vars. They are read from Stats whenever the
+// variable is, and are null once the priority queue is closed. If the
+// name is already published, ErrExpvarPublished is returned.
+//
+// Published names can't be removed, so a priority queue reopened in
+// the same process must be published under a new name.
+func (pq *PriorityQueue) PublishExpvar(name string) error {
+	return publishExpvar(name, pq.Stats)
+}
+
+// PublishExpvar publishes the length, top item age and operation
+// counters of the stack via expvar under the given name, the same way as
+// PriorityQueue.PublishExpvar.
+func (s *Stack) PublishExpvar(name string) error {
+	return publishExpvar(name, s.Stats)
+}
+
+// publishExpvar publishes the stats returned by the given function under
+// the given name.
+func publishExpvar(name string, stats func() (*Stats, error)) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return ErrExpvarPublished
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		st, err := stats()
+		if err != nil {
+			return nil
+		}
+
+		return expvarStats(st, time.Now())
+	}))
+
+	return nil
+}
+
+// expvarStats returns the published variables of the given stats.
+func expvarStats(st *Stats, now time.Time) map[string]interface{} {
+	var age float64
+	if !st.Next.IsZero() {
+		age = now.Sub(st.Next).Seconds()
+	}
+
+	return map[string]interface{}{
+		"length":               st.Length,
+		"head_age_seconds":     age,
+		"enqueued":             st.Counters.Enqueued,
+		"dequeued":             st.Counters.Dequeued,
+		"trimmed":              st.Counters.Trimmed,
+		"dequeues":             st.Counters.Dequeues,
+		"dequeue_time_seconds": st.Counters.DequeueTime.Seconds(),
+	}
+}
@@ -0,0 +1,79 @@
+package goque
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueuePublishExpvar(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.PublishExpvar(file); err != nil {
+		t.Error(err)
+	}
+	if err = pq.PublishExpvar(file); err != ErrExpvarPublished {
+		t.Errorf("Expected to get expvar published error, got %v", err)
+	}
+
+	var vars struct {
+		Length   uint64  `json:"length"`
+		HeadAge  float64 `json:"head_age_seconds"`
+		Enqueued uint64  `json:"enqueued"`
+		Dequeued uint64  `json:"dequeued"`
+	}
+	if err = json.Unmarshal([]byte(expvar.Get(file).String()), &vars); err != nil {
+		t.Error(err)
+	}
+	if vars.Length != 2 || vars.Enqueued != 3 || vars.Dequeued != 1 || vars.HeadAge <= 0 {
+		t.Errorf("Expected length 2, 3 enqueued, 1 dequeued and a head age above 0, got %+v", vars)
+	}
+
+	// A closed priority queue publishes null.
+	pq.Close()
+	if v := expvar.Get(file).String(); v != "null" {
+		t.Errorf("Expected null, got %s", v)
+	}
+}
+
+func TestStackPublishExpvar(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+	if err = s.PublishExpvar(file); err != nil {
+		t.Error(err)
+	}
+
+	var vars struct {
+		Length uint64 `json:"length"`
+	}
+	if err = json.Unmarshal([]byte(expvar.Get(file).String()), &vars); err != nil {
+		t.Error(err)
+	}
+	if vars.Length != 1 {
+		t.Errorf("Expected length 1, got %d", vars.Length)
+	}
+}
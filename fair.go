@@ -0,0 +1,104 @@
+package goque
+
+// fairness picks priority levels by smooth weighted round robin, so each
+// level with items gets a share of the dequeues proportional to its
+// weight, spread out evenly instead of in bursts.
+type fairness struct {
+	weights [256]int64
+	current [256]int64
+}
+
+// newFairness returns a fairness giving each priority level the given
+// weight, or a weight of 1 if it has none.
+func newFairness(weights map[uint8]uint32) *fairness {
+	f := &fairness{}
+	for i := range f.weights {
+		f.weights[i] = 1
+	}
+	for priority, w := range weights {
+		if w > 0 {
+			f.weights[priority] = int64(w)
+		}
+	}
+
+	return f
+}
+
+// clone returns a copy of the fairness, or nil if it is nil.
+func (f *fairness) clone() *fairness {
+	if f == nil {
+		return nil
+	}
+
+	c := *f
+	return &c
+}
+
+// next returns the priority level the next item should be taken from,
+// among the given levels in dequeue order, without recording the choice.
+// At least one level must be given.
+func (f *fairness) next(levels []uint8) uint8 {
+	var best uint8
+	var bestWeight int64
+	for i, priority := range levels {
+		if w := f.current[priority] + f.weights[priority]; i == 0 || w > bestWeight {
+			best, bestWeight = priority, w
+		}
+	}
+
+	return best
+}
+
+// took records that an item was taken from the given priority level,
+// while the levels in the given set held items.
+func (f *fairness) took(active levelSet, priority uint8) {
+	var total int64
+	for i := range f.current {
+		level := uint8(i)
+		if !active.has(level) {
+			f.current[level] = 0
+			continue
+		}
+
+		f.current[level] += f.weights[level]
+		total += f.weights[level]
+	}
+	f.current[priority] -= total
+}
+
+// SetWeights makes Dequeue share the items dequeued between the priority
+// levels in proportion to the given weights, instead of always taking the
+// items of the most important level first. With the weights 8, 4 and 1
+// for the levels 0, 1 and 2, 8 of every 13 items dequeued while all three
+// levels hold items come from level 0, 4 from level 1 and 1 from level 2,
+// interleaved. A level without a weight, or with a weight of 0, has a
+// weight of 1. Ties go to the more important level.
+//
+// The weights apply to Dequeue, DequeueWithToken, DequeueWithLease,
+// Reserve and Transfer. DrainTo and DequeueBatch still take the items in
+// priority order, and so does group ordering while a group is in flight.
+// Passing nil weights goes back to strict priority order, or to rotating
+// among the levels of a priority queue opened with RR.
+//
+// The weights aren't persisted, so SetWeights should be called right
+// after every open.
+func (pq *PriorityQueue) SetWeights(weights map[uint8]uint32) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if weights == nil && pq.order != RR {
+		pq.fair = nil
+		return
+	}
+
+	pq.fair = newFairness(weights)
+}
+
+// tookItem records that the given item was taken from the front of its
+// priority level, before its removal is committed. The caller must hold
+// the lock.
+func (pq *PriorityQueue) tookItem(item *PriorityItem) {
+	if pq.fair != nil {
+		pq.fair.took(pq.active, item.Priority)
+	}
+}
@@ -0,0 +1,141 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueWeights(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p < 3; p++ {
+		for i := 0; i < 20; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each level gets a share of the dequeues by its weight.
+	pq.SetWeights(map[uint8]uint32{0: 8, 1: 4, 2: 1})
+	var counts [3]int
+	for i := 0; i < 13; i++ {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[item.Priority]++
+	}
+	if counts != [3]int{8, 4, 1} {
+		t.Errorf("Expected 8, 4 and 1 items from each level, got %v", counts)
+	}
+
+	// Leased dequeues are weighted too, and keep the order within a level.
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 0 || item.ToString() != "value8" {
+		t.Errorf("Expected 'value8' of level 0, got '%s' of level %d", item.ToString(), item.Priority)
+	}
+	if err = pq.Complete(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// A level without items gives way to the others.
+	if err = pq.ClearPriority(0); err != nil {
+		t.Fatal(err)
+	}
+	counts = [3]int{}
+	for i := 0; i < 10; i++ {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[item.Priority]++
+	}
+	if counts[1] != 8 || counts[2] != 2 {
+		t.Errorf("Expected 8 and 2 items from levels 1 and 2, got %v", counts)
+	}
+
+	// Without weights, the most important level goes first again.
+	pq.SetWeights(nil)
+	item, err = pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 1 {
+		t.Errorf("Expected an item of level 1, got level %d", item.Priority)
+	}
+}
+
+func TestPriorityQueueRoundRobin(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, RR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for _, p := range []uint8{7, 7, 7, 3, 3, 200} {
+		if _, err = pq.EnqueueString(p, fmt.Sprintf("value%d", p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Peek shows the item Dequeue returns.
+	item, err := pq.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 3 {
+		t.Errorf("Expected an item of level 3, got level %d", item.Priority)
+	}
+
+	// Peeking by offset sees the levels in ascending order.
+	if item, err = pq.PeekByOffset(2); err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 7 {
+		t.Errorf("Expected an item of level 7, got level %d", item.Priority)
+	}
+
+	// Consecutive dequeues rotate among the levels with items.
+	for _, want := range []uint8{3, 7, 200, 3, 7, 7} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Priority != want {
+			t.Errorf("Expected an item of level %d, got level %d", want, item.Priority)
+		}
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+
+	// The rotation is kept without weights.
+	pq.SetWeights(map[uint8]uint32{1: 2})
+	pq.SetWeights(nil)
+	for _, p := range []uint8{1, 1, 2} {
+		if _, err = pq.EnqueueString(p, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []uint8{1, 2, 1} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Priority != want {
+			t.Errorf("Expected an item of level %d, got level %d", want, item.Priority)
+		}
+	}
+
+}
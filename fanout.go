@@ -0,0 +1,69 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// EnqueueTarget is a priority level of a priority queue fed by
+// MultiEnqueue.
+type EnqueueTarget struct {
+	Queue    *PriorityQueue
+	Priority uint8
+}
+
+// MultiEnqueue adds a copy of the item to each of the targets, so a
+// producer can feed several independent consumers in one call. It
+// returns the copies in the order of the targets, with their IDs, keys
+// and sequence numbers set.
+//
+// The copies added to the same priority queue, whatever their priority
+// levels, are written in a single LevelDB batch, so either all of them
+// are added or none are. Every priority queue has a database of its
+// own, though, so if adding the copies to one of them fails, the copies
+// already added to the others are removed again and the error is
+// returned. Consumers may dequeue a copy before it is removed, and the
+// removal fires OnDrop and is recorded in the change log like
+// RemoveByPriorityID.
+func MultiEnqueue(item *PriorityItem, targets ...EnqueueTarget) ([]*PriorityItem, error) {
+	// Make the copies, grouping them by priority queue in the order the
+	// priority queues first appear.
+	copies := make([]*PriorityItem, len(targets))
+	var queues []*PriorityQueue
+	groups := make(map[*PriorityQueue][]*PriorityItem)
+	for i, target := range targets {
+		copies[i] = NewPriorityItem(item.Value, target.Priority)
+		copies[i].Headers = item.Headers
+		copies[i].CreatedAt = item.CreatedAt
+		copies[i].UpdatedAt = item.UpdatedAt
+
+		if _, ok := groups[target.Queue]; !ok {
+			queues = append(queues, target.Queue)
+		}
+		groups[target.Queue] = append(groups[target.Queue], copies[i])
+	}
+
+	for i, pq := range queues {
+		if _, err := pq.EnqueueBatch(groups[pq]); err != nil {
+			// Remove the copies added to the priority queues before.
+			for _, added := range queues[:i] {
+				added.removeCopies(groups[added])
+			}
+			return nil, err
+		}
+	}
+
+	return copies, nil
+}
+
+// removeCopies removes the given items added by MultiEnqueue, skipping
+// the ones already dequeued.
+func (pq *PriorityQueue) removeCopies(items []*PriorityItem) {
+	for _, item := range items {
+		_, err := pq.RemoveByPriorityID(item.Priority, item.ID)
+		if err != nil && err != ErrEmpty && err != ErrOutOfBounds && err != leveldb.ErrNotFound {
+			pq.readLock()
+			pq.log.warn("goque: Could not remove an item of a failed fan-out", "dir", pq.DataDir, "error", err)
+			pq.readUnlock()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMultiEnqueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq1, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq1.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq2, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq2.ForceDrop()
+
+	item := NewPriorityItemString("value", 0)
+	item.Headers = map[string]string{"a": "1"}
+	copies, err := MultiEnqueue(item, EnqueueTarget{pq1, 1}, EnqueueTarget{pq2, 0}, EnqueueTarget{pq1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 3 || copies[0].Priority != 1 || copies[1].Priority != 0 || copies[2].Priority != 2 {
+		t.Fatalf("Expected a copy for each target, got %v", copies)
+	}
+	if item.ID != 0 {
+		t.Errorf("Expected the item itself not to be enqueued, got ID %d", item.ID)
+	}
+
+	if pq1.LengthByPriority(1) != 1 || pq1.LengthByPriority(2) != 1 || pq2.LengthByPriority(0) != 1 {
+		t.Errorf("Expected one copy in each priority level")
+	}
+	got, err := pq2.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ToString() != "value" || got.Headers["a"] != "1" {
+		t.Errorf("Expected the copy to keep the value and headers, got %s %v", got.ToString(), got.Headers)
+	}
+}
+
+func TestMultiEnqueueFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq1, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq1.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq2, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq2.ForceDrop()
+
+	if _, err = pq1.EnqueueString(0, "existing"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq2.SetCapacity(Capacity{MaxItems: 1, Policy: OverflowError}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both copies don't fit in pq2, so none is added anywhere.
+	item := NewPriorityItemString("value", 0)
+	_, err = MultiEnqueue(item, EnqueueTarget{pq1, 0}, EnqueueTarget{pq1, 3}, EnqueueTarget{pq2, 0}, EnqueueTarget{pq2, 1})
+	if err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+
+	if pq1.LengthByPriority(0) != 1 || pq1.LengthByPriority(3) != 0 || pq2.LengthByPriority(0) != 0 {
+		t.Errorf("Expected the copies to be removed again")
+	}
+	got, err := pq1.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ToString() != "existing" {
+		t.Errorf("Expected 'existing', got '%s'", got.ToString())
+	}
+	if _, err = pq1.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package goque
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -14,24 +15,57 @@ const (
 	goqueStack goqueType = iota
 	goqueQueue
 	goquePriorityQueue
+	goqueDeque
+	goquePrefixQueue
+	goqueDelayQueue
+	goqueRetryQueue
+	goqueUniqueQueue
+	goqueTopic
+	goquePriorityQueue64
+	goqueDeadlineQueue
+	goqueSortedQueue
+	goquePriorityStack
+	goqueShardedQueue
 )
 
+// The possible on-disk formats of item values, stored after the Goque
+// type in the 'GOQUE' file. Data directories created before the format
+// was recorded use formatRaw.
+const (
+	formatRaw      uint8 = iota // Values are stored as is.
+	formatEnvelope              // Values are wrapped in an envelope.
+)
+
+// defaultFormat returns the format used for item values by a newly
+// created data directory of the given Goque type.
+func defaultFormat(gt goqueType) uint8 {
+	switch gt {
+	case goqueStack, goqueQueue, goquePriorityQueue:
+		return formatEnvelope
+	}
+
+	return formatRaw
+}
+
 // checkGoqueType checks if the type of Goque data structure
 // trying to be opened is compatible with the opener type.
 //
 // A file named 'GOQUE' within the data directory used by
 // the structure stores the structure type, using the constants
-// declared above.
+// declared above, followed by the format of the item values and
+// the layout version migrate upgrades.
 //
 // Stacks and Queues are 100% compatible with each other, while
-// a PriorityQueue is incompatible with both.
+// every other structure is only compatible with itself.
 //
 // Returns true if types are compatible and false if incompatible.
 func checkGoqueType(dataDir string, gt goqueType) (bool, error) {
 	// Set the path and goqueType byte slice used when saving to a file.
 	path := filepath.Join(dataDir, "GOQUE")
-	gtb := make([]byte, 1)
+	gtb := make([]byte, 3)
 	gtb[0] = byte(gt)
+	gtb[1] = defaultFormat(gt)
+	gtb[2] = currentLayout()
 
 	// Read 'GOQUE' file for this directory.
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
@@ -61,17 +95,70 @@ func checkGoqueType(dataDir string, gt goqueType) (bool, error) {
 		return false, err
 	}
 
-	// Convert the file byte to its goqueType.
-	filegt := goqueType(fb[0])
-
 	// Compare the types.
+	return compatibleType(goqueType(fb[0]), gt), nil
+}
+
+// compatibleType returns whether a data directory storing the Goque type
+// filegt can be opened as the Goque type gt.
+func compatibleType(filegt, gt goqueType) bool {
 	if filegt == gt {
-		return true, nil
+		return true
 	} else if filegt == goqueStack && gt == goqueQueue {
-		return true, nil
+		return true
 	} else if filegt == goqueQueue && gt == goqueStack {
-		return true, nil
+		return true
+	}
+
+	return false
+}
+
+// typeNames are the names of the Goque types returned by DataDirType.
+var typeNames = [...]string{
+	goqueStack:           "stack",
+	goqueQueue:           "queue",
+	goquePriorityQueue:   "priority queue",
+	goqueDeque:           "deque",
+	goquePrefixQueue:     "prefix queue",
+	goqueDelayQueue:      "delay queue",
+	goqueRetryQueue:      "retry queue",
+	goqueUniqueQueue:     "unique queue",
+	goqueTopic:           "topic",
+	goquePriorityQueue64: "64-bit priority queue",
+	goqueDeadlineQueue:   "deadline queue",
+	goqueSortedQueue:     "sorted queue",
+	goquePriorityStack:   "priority stack",
+	goqueShardedQueue:    "sharded queue",
+}
+
+// DataDirType returns the name of the type of Goque data structure that
+// created the given data directory, such as "stack", "queue" or
+// "priority queue", as recorded in its 'GOQUE' file. If the type is
+// unknown, ErrIncompatibleType is returned.
+func DataDirType(dataDir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < 1 || int(data[0]) >= len(typeNames) {
+		return "", ErrIncompatibleType
+	}
+
+	return typeNames[data[0]], nil
+}
+
+// goqueFormat returns the on-disk format of item values recorded in
+// the 'GOQUE' file of the given data directory.
+func goqueFormat(dataDir string) (uint8, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if err != nil {
+		return formatRaw, err
+	}
+
+	if len(data) < 2 {
+		return formatRaw, nil
 	}
 
-	return false, nil
+	return data[1], nil
 }
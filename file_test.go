@@ -0,0 +1,28 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDataDirType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	name, err := DataDirType(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if name != "priority queue" {
+		t.Errorf("Expected type 'priority queue', got '%s'", name)
+	}
+
+	if _, err = DataDirType(file + "_missing"); err == nil {
+		t.Error("Expected an error for a missing data directory")
+	}
+}
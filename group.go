@@ -0,0 +1,97 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// GroupHeader is the header holding the ID of the message group of an
+// item. Once SetGroupOrdering is enabled, the items of a group are taken
+// in order, one at a time.
+const GroupHeader = "goque-group"
+
+// SetGroupOrdering sets whether the priority queue keeps the items of
+// each message group in order, so parallel consumers never process two
+// items of the same group at once.
+//
+// When enabled, DequeueWithToken and DequeueWithLease skip the items
+// whose group, set in their GroupHeader, already has an item in flight,
+// returning ErrGroupsInFlight if every queued item was skipped. A
+// grouped item released or returned by ReclaimExpired goes back to the
+// front of its priority level, ahead of the rest of its group. Items
+// without a group are never skipped, and Dequeue ignores groups.
+//
+// The setting isn't persisted, so SetGroupOrdering should be called
+// right after every open.
+func (pq *PriorityQueue) SetGroupOrdering(enabled bool) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.groups = enabled
+}
+
+// getNextUngrouped returns the next item in dequeue order whose group
+// has no item in flight. The caller must hold the lock.
+func (pq *PriorityQueue) getNextUngrouped() (*PriorityItem, error) {
+	busy, err := pq.busyGroups()
+	if err != nil {
+		return nil, err
+	}
+	if len(busy) == 0 {
+		return pq.getNextItem()
+	}
+
+	levels := pq.dequeueLevels()
+	if len(levels) == 0 {
+		return nil, ErrEmpty
+	}
+	for _, priority := range levels {
+		item, err := pq.firstUngrouped(priority, busy)
+		if item != nil || err != nil {
+			return item, err
+		}
+	}
+
+	return nil, ErrGroupsInFlight
+}
+
+// firstUngrouped returns the first item of the given priority level
+// whose group isn't busy, or nil if there is none.
+func (pq *PriorityQueue) firstUngrouped(priority uint8, busy map[string]bool) (*PriorityItem, error) {
+	iter := pq.db.NewIterator(util.BytesPrefix(pq.generatePrefix(priority)), nil)
+	defer iter.Release()
+
+	for ok := iter.Seek(pq.generateKey(priority, pq.levels[priority].head+1)); ok; ok = iter.Next() {
+		item, err := pq.decodeItem(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if group := item.Headers[GroupHeader]; group == "" || !busy[group] {
+			return item, nil
+		}
+	}
+
+	return nil, iter.Error()
+}
+
+// busyGroups returns the groups with an item in flight. The caller must
+// hold the lock.
+func (pq *PriorityQueue) busyGroups() (map[string]bool, error) {
+	leases, err := pq.getLeases()
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make(map[string]bool)
+	for _, lease := range leases {
+		if group := lease.Item.Headers[GroupHeader]; group != "" {
+			busy[group] = true
+		}
+	}
+
+	return busy, nil
+}
+
+// grouped returns whether the given item takes part in group ordering.
+func (pq *PriorityQueue) grouped(item *PriorityItem) bool {
+	return pq.groups && item.Headers[GroupHeader] != ""
+}
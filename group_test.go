@@ -0,0 +1,143 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newGroupItem creates an item of the given message group.
+func newGroupItem(value, group string) *PriorityItem {
+	item := NewPriorityItemString(value, 0)
+	if group != "" {
+		item.Headers = map[string]string{GroupHeader: group}
+	}
+	return item
+}
+
+func TestPriorityQueueGroupOrdering(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetGroupOrdering(true)
+	for _, item := range []*PriorityItem{
+		newGroupItem("a1", "a"),
+		newGroupItem("a2", "a"),
+		newGroupItem("b1", "b"),
+		newGroupItem("none", ""),
+		newGroupItem("b2", "b"),
+	} {
+		if err = pq.Enqueue(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each group has at most one item in flight.
+	tokens := make(map[string]Token)
+	for _, want := range []string{"a1", "b1", "none"} {
+		item, token, err := pq.DequeueWithToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+		tokens[want] = token
+	}
+	if _, _, err = pq.DequeueWithToken(); err != ErrGroupsInFlight {
+		t.Errorf("Expected ErrGroupsInFlight, got %v", err)
+	}
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	// Releasing an item keeps it ahead of the rest of its group.
+	if err = pq.Release(tokens["b1"]); err != nil {
+		t.Fatal(err)
+	}
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "b1" {
+		t.Errorf("Expected 'b1', got '%s'", item.ToString())
+	}
+	if err = pq.Complete(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completing an item frees its group.
+	if err = pq.Complete(tokens["a1"]); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a2", "b2"} {
+		item, _, err := pq.DequeueWithToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, _, err = pq.DequeueWithToken(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPriorityQueueGroupOrderingExpired(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetGroupOrdering(true)
+	for _, value := range []string{"a1", "a2"} {
+		if err = pq.Enqueue(newGroupItem(value, "a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.Enqueue(newGroupItem("b1", "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = pq.DequeueWithLease(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// b1 is taken from behind a2, leaving a gap.
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "b1" {
+		t.Errorf("Expected 'b1', got '%s'", item.ToString())
+	}
+	if err = pq.Complete(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired item comes back before the rest of its group.
+	time.Sleep(20 * time.Millisecond)
+	if n, err := pq.ReclaimExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("Expected 1 item to be reclaimed, got %d", n)
+	}
+	for _, want := range []string{"a1", "a2"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
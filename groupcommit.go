@@ -0,0 +1,128 @@
+package goque
+
+import (
+	"sync"
+	"time"
+)
+
+// groupCommit gathers the items of concurrent enqueues, so they can be
+// written and synced together.
+type groupCommit struct {
+	window  time.Duration
+	mu      sync.Mutex
+	pending *commitGroup
+}
+
+// commitGroup is the set of items written by a single group commit.
+type commitGroup struct {
+	items []*PriorityItem
+	errs  []error
+	done  chan struct{}
+}
+
+// SetGroupCommit makes concurrent Enqueues write their items together,
+// in a single synced batch, while the durability is DurabilityPerWrite.
+// The first Enqueue of a group waits for the given window for others to
+// join it, so each Enqueue takes up to that much longer, but producers
+// share the cost of every sync. A window of 0 turns group commit off,
+// which is the default.
+//
+// Group commit isn't persisted, so SetGroupCommit must be called after
+// every open.
+func (pq *PriorityQueue) SetGroupCommit(window time.Duration) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.commit = nil
+	if window > 0 {
+		pq.commit = &groupCommit{window: window}
+	}
+}
+
+// groupCommit returns the group commit Enqueue writes its item with, or
+// nil if it writes the item on its own.
+func (pq *PriorityQueue) groupCommit() *groupCommit {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	if pq.durable != DurabilityPerWrite {
+		return nil
+	}
+	return pq.commit
+}
+
+// enqueueGrouped adds the given item to the priority queue along with the
+// items of other Enqueues joining the same group. The first one writes
+// the group once the window has passed, and the others wait for it.
+func (pq *PriorityQueue) enqueueGrouped(gc *groupCommit, item *PriorityItem) error {
+	gc.mu.Lock()
+	g := gc.pending
+	leader := g == nil
+	if leader {
+		g = &commitGroup{done: make(chan struct{})}
+		gc.pending = g
+	}
+	i := len(g.items)
+	g.items = append(g.items, item)
+	gc.mu.Unlock()
+
+	if !leader {
+		<-g.done
+		return g.errs[i]
+	}
+
+	// Wait for other Enqueues to join, then close the group.
+	time.Sleep(gc.window)
+	gc.mu.Lock()
+	gc.pending = nil
+	gc.mu.Unlock()
+
+	g.errs = pq.commitGroup(g.items)
+	close(g.done)
+
+	return g.errs[0]
+}
+
+// commitGroup adds the items of a group to the priority queue in a
+// single batch, and returns the error of each. Items that are too large
+// fail on their own, and if the batch still can't be written, such as
+// when middleware rejects an item, each item is enqueued on its own
+// instead, so only the items at fault fail.
+func (pq *PriorityQueue) commitGroup(items []*PriorityItem) []error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	errs := make([]error, len(items))
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		for i := range errs {
+			errs[i] = ErrDBClosed
+		}
+		return errs
+	}
+
+	// Leave out the items that are too large.
+	var batch []*PriorityItem
+	var indexes []int
+	for i, item := range items {
+		if errs[i] = pq.bounds.checkValue(uint64(len(item.Value))); errs[i] == nil {
+			batch = append(batch, item)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(batch) == 0 {
+		return errs
+	}
+
+	ids, err := pq.enqueueBatch(batch)
+	for _, i := range indexes {
+		if ids != nil || len(batch) == 1 {
+			errs[i] = err
+		} else {
+			errs[i] = pq.enqueue(items[i], nil)
+		}
+	}
+
+	return errs
+}
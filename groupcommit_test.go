@@ -0,0 +1,123 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// syncCountingStore is a LevelDB store counting its synced writes.
+type syncCountingStore struct {
+	*leveldb.DB
+	syncs int64
+}
+
+func (s *syncCountingStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	if wo != nil && wo.Sync {
+		atomic.AddInt64(&s.syncs, 1)
+	}
+	return s.DB.Write(batch, wo)
+}
+
+func TestPriorityQueueGroupCommit(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &syncCountingStore{DB: db}
+	pq, err := OpenPriorityQueueWithStore(file, ASC, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetDurability(DurabilityPerWrite)
+	pq.SetGroupCommit(50 * time.Millisecond)
+
+	// Concurrent enqueues, one of them too large to fit.
+	if err = pq.SetCapacity(Capacity{MaxValueSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := fmt.Sprintf("value%d", i)
+			if i == 7 {
+				value = "much too large"
+			}
+			errs[i] = pq.Enqueue(NewPriorityItemString(value, uint8(i%3)))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if _, tooLarge := err.(*ValueTooLargeError); i == 7 && !tooLarge {
+			t.Errorf("Expected a *ValueTooLargeError, got %v", err)
+		} else if i != 7 && err != nil {
+			t.Errorf("Expected item %d to be added, got %v", i, err)
+		}
+	}
+	if pq.Length() != 19 {
+		t.Errorf("Expected queue length of 19, got %d", pq.Length())
+	}
+	if syncs := atomic.LoadInt64(&store.syncs); syncs >= 19 {
+		t.Errorf("Expected the enqueues to share syncs, got %d syncs", syncs)
+	}
+
+	// Without per-write durability, each enqueue writes on its own.
+	pq.SetDurability(DurabilityNone)
+	if pq.groupCommit() != nil {
+		t.Error("Expected no group commit without per-write durability")
+	}
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every item is dequeued once.
+	seen := make(map[string]bool)
+	for pq.Length() > 0 {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[item.ToString()] && item.ToString() != "value" {
+			t.Errorf("Expected '%s' to be dequeued once", item.ToString())
+		}
+		seen[item.ToString()] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("Expected 20 distinct values, got %d", len(seen))
+	}
+}
+
+func TestPriorityQueueGroupCommitClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.SetDurability(DurabilityPerWrite)
+	pq.SetGroupCommit(time.Millisecond)
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	pq.Close()
+	if _, err = pq.EnqueueString(0, "value"); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+}
@@ -0,0 +1,5 @@
+// Package goquepb holds the protocol buffer messages and gRPC service of
+// the Goque gRPC server, generated from goque.proto.
+package goquepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative goque.proto
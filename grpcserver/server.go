@@ -0,0 +1,271 @@
+// Package grpcserver serves Goque priority queues over gRPC, using the
+// Queue service defined in goquepb/goque.proto, so Goque can act as a
+// small single-node broker for clients in any language.
+//
+// Items are reserved when they are dequeued or consumed, and must be
+// acked with the token they were delivered with once processed. Items
+// that aren't acked within their visibility timeout are delivered
+// again.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/beeker1121/goque/grpcserver/goquepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrRegistered is returned when registering a priority queue under a
+// name that is already taken.
+var ErrRegistered = errors.New("grpcserver: Name is already registered")
+
+// The visibility timeout of reservations that don't set one.
+const defaultVisibilityTimeout = 30 * time.Second
+
+// retryInterval is how often Consume retries an empty priority queue
+// without being signaled, so items whose reservation expired are
+// delivered again.
+const retryInterval = time.Second
+
+// Server implements goquepb.QueueServer for the registered priority
+// queues. Register it with a *grpc.Server using
+// goquepb.RegisterQueueServer.
+type Server struct {
+	goquepb.UnimplementedQueueServer
+
+	mu     sync.RWMutex
+	queues map[string]*goque.PriorityQueue
+}
+
+// New returns a Server without any priority queue.
+func New() *Server {
+	return &Server{queues: make(map[string]*goque.PriorityQueue)}
+}
+
+// Register serves the given priority queue under name. The priority
+// queue must be unregistered before it is closed.
+func (s *Server) Register(name string, pq *goque.PriorityQueue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; ok {
+		return ErrRegistered
+	}
+	s.queues[name] = pq
+
+	return nil
+}
+
+// Unregister stops serving the priority queue registered under name.
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.queues, name)
+}
+
+// Enqueue adds an item to a priority queue.
+func (s *Server) Enqueue(ctx context.Context, req *goquepb.EnqueueRequest) (*goquepb.Item, error) {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetPriority() > 255 {
+		return nil, status.Errorf(codes.InvalidArgument, "priority %d is out of range", req.GetPriority())
+	}
+
+	item := goque.NewPriorityItem(req.GetValue(), uint8(req.GetPriority()))
+	item.Headers = req.GetHeaders()
+	if err = pq.Enqueue(item); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return itemMessage(item), nil
+}
+
+// Dequeue reserves the next item of a priority queue.
+func (s *Server) Dequeue(ctx context.Context, req *goquepb.DequeueRequest) (*goquepb.Delivery, error) {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return nil, err
+	}
+
+	item, token, err := pq.Reserve(visibilityTimeout(req.GetVisibilityTimeout().AsDuration()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &goquepb.Delivery{Item: itemMessage(item), Token: string(token)}, nil
+}
+
+// Peek returns the next item of a priority queue without removing it.
+func (s *Server) Peek(ctx context.Context, req *goquepb.PeekRequest) (*goquepb.Item, error) {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := pq.Peek()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return itemMessage(item), nil
+}
+
+// Ack deletes a reserved item.
+func (s *Server) Ack(ctx context.Context, req *goquepb.AckRequest) (*goquepb.AckResponse, error) {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pq.Ack(goque.Token(req.GetToken())); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &goquepb.AckResponse{}, nil
+}
+
+// Nack makes a reserved item visible again right away.
+func (s *Server) Nack(ctx context.Context, req *goquepb.NackRequest) (*goquepb.NackResponse, error) {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pq.Nack(goque.Token(req.GetToken())); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &goquepb.NackResponse{}, nil
+}
+
+// Consume streams the items of a priority queue until the client
+// cancels the call, waiting for new items whenever it is empty.
+func (s *Server) Consume(req *goquepb.ConsumeRequest, stream goquepb.Queue_ConsumeServer) error {
+	pq, err := s.queue(req.GetQueue())
+	if err != nil {
+		return err
+	}
+
+	// Start listening before the first dequeue, so no item added in
+	// between is missed.
+	ch := pq.Notify()
+	defer pq.StopNotify(ch)
+
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	ctx := stream.Context()
+	timeout := visibilityTimeout(req.GetVisibilityTimeout().AsDuration())
+	for {
+		delivery, err := next(pq, timeout, req.GetAutoAck())
+		if err == goque.ErrEmpty {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return toStatus(goque.ErrDBClosed)
+				}
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		} else if err != nil {
+			return toStatus(err)
+		}
+
+		if err = stream.Send(delivery); err != nil {
+			// Return the reserved item right away, as it wasn't sent.
+			if delivery.Token != "" {
+				pq.Nack(goque.Token(delivery.Token))
+			}
+			return err
+		}
+	}
+}
+
+// next dequeues the next item of the priority queue, reserving it
+// unless autoAck is set.
+func next(pq *goque.PriorityQueue, timeout time.Duration, autoAck bool) (*goquepb.Delivery, error) {
+	if autoAck {
+		item, err := pq.Dequeue()
+		if err != nil {
+			return nil, err
+		}
+		return &goquepb.Delivery{Item: itemMessage(item)}, nil
+	}
+
+	item, token, err := pq.Reserve(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &goquepb.Delivery{Item: itemMessage(item), Token: string(token)}, nil
+}
+
+// queue returns the priority queue registered under name.
+func (s *Server) queue(name string) (*goque.PriorityQueue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pq, ok := s.queues[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no queue named %q", name)
+	}
+
+	return pq, nil
+}
+
+// visibilityTimeout returns the given visibility timeout, or the
+// default one if it is not positive.
+func visibilityTimeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultVisibilityTimeout
+	}
+
+	return d
+}
+
+// itemMessage returns the message of a priority queue item.
+func itemMessage(item *goque.PriorityItem) *goquepb.Item {
+	msg := &goquepb.Item{
+		Id:       item.ID,
+		Priority: uint32(item.Priority),
+		Value:    item.Value,
+		Attempts: item.Attempts,
+		Headers:  item.Headers,
+	}
+	if !item.CreatedAt.IsZero() {
+		msg.CreatedAt = timestamppb.New(item.CreatedAt)
+	}
+	if !item.UpdatedAt.IsZero() {
+		msg.UpdatedAt = timestamppb.New(item.UpdatedAt)
+	}
+
+	return msg
+}
+
+// toStatus returns a Goque error as a gRPC status error with a
+// matching code.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch err {
+	case goque.ErrEmpty, goque.ErrInvalidToken:
+		code = codes.NotFound
+	case goque.ErrDBClosed:
+		code = codes.Unavailable
+	case goque.ErrFull:
+		code = codes.ResourceExhausted
+	case goque.ErrLeaseExpired:
+		code = codes.FailedPrecondition
+	}
+
+	return status.Error(code, err.Error())
+}
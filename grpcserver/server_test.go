@@ -0,0 +1,192 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/beeker1121/goque/grpcserver/goquepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// serve starts a gRPC server serving the given priority queue as
+// "jobs" over an in-memory connection, returning a client and a
+// function stopping it.
+func serve(t *testing.T, pq *goque.PriorityQueue) (goquepb.QueueClient, func()) {
+	s := New()
+	if err := s.Register("jobs", pq); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	goquepb.RegisterQueueServer(srv, s)
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return goquepb.NewQueueClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func TestServer(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := serve(t, pq)
+	defer stop()
+	ctx := context.Background()
+
+	for i, priority := range []uint32{5, 1} {
+		item, err := client.Enqueue(ctx, &goquepb.EnqueueRequest{
+			Queue:    "jobs",
+			Priority: priority,
+			Value:    []byte(fmt.Sprintf("value for item %d", i+1)),
+			Headers:  map[string]string{"n": fmt.Sprint(i + 1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.GetPriority() != priority || item.GetCreatedAt() == nil {
+			t.Errorf("Expected priority %d and a creation time, got %v", priority, item)
+		}
+	}
+
+	item, err := client.Peek(ctx, &goquepb.PeekRequest{Queue: "jobs"})
+	if err != nil {
+		t.Error(err)
+	}
+	if string(item.GetValue()) != "value for item 2" || item.GetHeaders()["n"] != "2" {
+		t.Errorf("Expected to peek at 'value for item 2', got %v", item)
+	}
+
+	// Nack the item, which is delivered again, then ack it.
+	delivery, err := client.Dequeue(ctx, &goquepb.DequeueRequest{Queue: "jobs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Nack(ctx, &goquepb.NackRequest{Queue: "jobs", Token: delivery.GetToken()}); err != nil {
+		t.Error(err)
+	}
+	if delivery, err = client.Dequeue(ctx, &goquepb.DequeueRequest{Queue: "jobs"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(delivery.GetItem().GetValue()) != "value for item 2" {
+		t.Errorf("Expected 'value for item 2', got '%s'", delivery.GetItem().GetValue())
+	}
+	if _, err = client.Ack(ctx, &goquepb.AckRequest{Queue: "jobs", Token: delivery.GetToken()}); err != nil {
+		t.Error(err)
+	}
+	if _, err = client.Ack(ctx, &goquepb.AckRequest{Queue: "jobs", Token: delivery.GetToken()}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound acking twice, got %v", err)
+	}
+
+	if _, err = client.Dequeue(ctx, &goquepb.DequeueRequest{Queue: "jobs"}); err != nil {
+		t.Error(err)
+	}
+	if _, err = client.Dequeue(ctx, &goquepb.DequeueRequest{Queue: "jobs"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an empty queue, got %v", err)
+	}
+	if _, err = client.Peek(ctx, &goquepb.PeekRequest{Queue: "other"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown queue, got %v", err)
+	}
+	if _, err = client.Enqueue(ctx, &goquepb.EnqueueRequest{Queue: "jobs", Priority: 256}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for priority 256, got %v", err)
+	}
+}
+
+func TestServerConsume(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := serve(t, pq)
+	defer stop()
+
+	if _, err = pq.EnqueueString(0, "value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Consume(ctx, &goquepb.ConsumeRequest{Queue: "jobs", VisibilityTimeout: durationpb.New(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items enqueued while the stream waits are delivered too.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pq.EnqueueString(0, "value for item 2")
+	}()
+
+	for i := 1; i <= 2; i++ {
+		delivery, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(delivery.GetItem().GetValue()) != fmt.Sprintf("value for item %d", i) || delivery.GetToken() == "" {
+			t.Errorf("Expected reserved 'value for item %d', got %v", i, delivery)
+		}
+		if err = pq.Ack(goque.Token(delivery.GetToken())); err != nil {
+			t.Error(err)
+		}
+	}
+	cancel()
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestServerConsumeAutoAck(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := serve(t, pq)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Consume(ctx, &goquepb.ConsumeRequest{Queue: "jobs", AutoAck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Error(err)
+	}
+	delivery, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(delivery.GetItem().GetValue()) != "value" || delivery.GetToken() != "" {
+		t.Errorf("Expected 'value' without a token, got %v", delivery)
+	}
+}
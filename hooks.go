@@ -0,0 +1,96 @@
+package goque
+
+// PriorityHooks are callbacks fired with the items moving through a
+// priority queue. A nil callback is skipped.
+//
+// The callbacks run while the priority queue is locked, right after the
+// change was written, so they see the items of each priority level in
+// the order they moved. Enqueues and dequeues on different levels may
+// fire them at the same time, so they must be safe for concurrent use.
+// They must not use the priority queue, and should return quickly.
+type PriorityHooks struct {
+	// OnEnqueue is fired for each item added by Enqueue, EnqueueBatch
+	// or a committed transaction.
+	OnEnqueue func(item *PriorityItem)
+
+	// OnDequeue is fired for each item removed by Dequeue,
+	// DequeueByPriority, DrainTo, Reserve, a channel stream or a
+	// committed transaction.
+	OnDequeue func(item *PriorityItem)
+
+	// OnRequeue is fired for each item put back by Requeue, by
+	// releasing or reclaiming its lease, or by a channel stream
+	// returning it undelivered.
+	OnRequeue func(item *PriorityItem)
+
+	// OnDrop is fired for each item discarded without being dequeued,
+	// by a capacity with OverflowDropOldest, by a retention policy, by
+	// RemoveByPriorityID or by Split. Items removed by Clear are not
+	// reported.
+	OnDrop func(item *PriorityItem)
+
+	// OnExpire is fired for each item removed once its TTL has passed,
+	// set by EnqueueWithTTL.
+	OnExpire func(item *PriorityItem)
+}
+
+// Hooks are callbacks fired with the items moving through a stack, the
+// same way as PriorityHooks.
+type Hooks struct {
+	// OnEnqueue is fired for each item added by Push or PushBatch.
+	OnEnqueue func(item *Item)
+
+	// OnDequeue is fired for each item removed by Pop, PopBatch or
+	// DrainTo.
+	OnDequeue func(item *Item)
+
+	// OnRequeue is fired for each item put back by Requeue.
+	OnRequeue func(item *Item)
+
+	// OnDrop is fired for each item discarded without being popped, by
+	// a capacity with OverflowDropOldest or by RemoveByID. Items
+	// removed by Clear are not reported.
+	OnDrop func(item *Item)
+}
+
+// SetHooks sets the callbacks fired with the items moving through the
+// priority queue, replacing the ones set before. A zero PriorityHooks
+// removes them.
+func (pq *PriorityQueue) SetHooks(h PriorityHooks) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.hooks = h
+}
+
+// SetHooks sets the callbacks fired with the items moving through the
+// stack, replacing the ones set before. A zero Hooks removes them.
+func (s *Stack) SetHooks(h Hooks) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.hooks = h
+}
+
+// firePriority calls the given callback, if any, with each of the
+// priority items.
+func firePriority(f func(*PriorityItem), items ...*PriorityItem) {
+	if f == nil {
+		return
+	}
+
+	for _, item := range items {
+		f(item)
+	}
+}
+
+// fireItem calls the given callback, if any, with each of the items.
+func fireItem(f func(*Item), items ...*Item) {
+	if f == nil {
+		return
+	}
+
+	for _, item := range items {
+		f(item)
+	}
+}
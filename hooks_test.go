@@ -0,0 +1,137 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueHooks(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	var events []string
+	record := func(event string) func(*PriorityItem) {
+		return func(item *PriorityItem) {
+			events = append(events, fmt.Sprintf("%s %s", event, item.ToString()))
+		}
+	}
+	pq.SetHooks(PriorityHooks{
+		OnEnqueue: record("enqueue"),
+		OnDequeue: record("dequeue"),
+		OnRequeue: record("requeue"),
+		OnDrop:    record("drop"),
+	})
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if err = pq.Requeue(item, true); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.RemoveByPriorityID(0, 2); err != nil {
+		t.Error(err)
+	}
+
+	want := []string{"enqueue item 1", "enqueue item 2", "enqueue item 3", "dequeue item 1", "requeue item 1", "drop item 2"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+
+	// Without hooks, nothing is fired.
+	pq.SetHooks(PriorityHooks{})
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if len(events) != len(want) {
+		t.Errorf("Expected %d events, got %d", len(want), len(events))
+	}
+}
+
+func TestPriorityQueueHooksTx(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	var enqueued, dequeued int
+	pq.SetHooks(PriorityHooks{
+		OnEnqueue: func(*PriorityItem) { enqueued++ },
+		OnDequeue: func(*PriorityItem) { dequeued++ },
+	})
+
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err = tx.Enqueue(NewPriorityItemString(fmt.Sprintf("item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = tx.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing is fired before the commit.
+	if enqueued != 0 || dequeued != 0 {
+		t.Errorf("Expected no events before commit, got %d and %d", enqueued, dequeued)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Error(err)
+	}
+	if enqueued != 2 || dequeued != 1 {
+		t.Errorf("Expected 2 enqueues and 1 dequeue, got %d and %d", enqueued, dequeued)
+	}
+}
+
+func TestStackHooks(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	var events []string
+	record := func(event string) func(*Item) {
+		return func(item *Item) {
+			events = append(events, fmt.Sprintf("%s %s", event, item.ToString()))
+		}
+	}
+	s.SetHooks(Hooks{
+		OnEnqueue: record("push"),
+		OnDequeue: record("pop"),
+		OnDrop:    record("drop"),
+	})
+
+	if _, err = s.PushBatch([]*Item{NewItemString("item 1"), NewItemString("item 2")}); err != nil {
+		t.Error(err)
+	}
+	if err = s.Push(NewItemString("item 3")); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.RemoveByID(1); err != nil {
+		t.Error(err)
+	}
+
+	want := []string{"push item 1", "push item 2", "push item 3", "pop item 3", "drop item 1"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+}
@@ -0,0 +1,331 @@
+package goque
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// IntegrityReport is the outcome of VerifyIntegrity.
+type IntegrityReport struct {
+	// Items is the number of items checked.
+	Items uint64
+
+	// Gaps are the ranges of IDs missing between the ends of a priority
+	// level or stack that no tombstone accounts for. Dequeuing fails with
+	// leveldb.ErrNotFound once it reaches one.
+	Gaps []IntegrityGap
+
+	// Stray are the keys of the items outside the ends of their priority
+	// level or stack, which are never dequeued.
+	Stray [][]byte
+
+	// InvalidKeys are the keys that are neither the key of an item nor
+	// one Goque keeps next to the items.
+	InvalidKeys [][]byte
+
+	// InvalidValues are the keys of the items whose values can't be
+	// decoded or don't match their checksums.
+	InvalidValues [][]byte
+
+	// WrongType is true if the 'GOQUE' file of the data directory is
+	// missing or records a type of data structure that can't open it.
+	WrongType bool
+
+	// Repaired is true if the gaps were repaired and the items with
+	// invalid values removed.
+	Repaired bool
+}
+
+// IntegrityGap is a range of missing IDs, from First to Last, in the
+// priority level of the given priority, or in a stack.
+type IntegrityGap struct {
+	Priority uint8
+	First    uint64
+	Last     uint64
+}
+
+// OK returns true if no problem was found.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Gaps) == 0 && len(r.Stray) == 0 && len(r.InvalidKeys) == 0 &&
+		len(r.InvalidValues) == 0 && !r.WrongType
+}
+
+// VerifyIntegrity checks the priority queue for damage, such as after a
+// disk fault or a recovery. It scans every key of the store, checking
+// that each one is the key of an item or one Goque keeps, that every
+// item between the ends of its priority level exists or was removed,
+// that no item lies outside them, and that every value decodes and
+// matches its checksum, if it has one. It also checks the 'GOQUE' file
+// of the data directory.
+//
+// If repair is true, the gaps found are repaired, so dequeuing skips
+// them: gaps at either end of a priority level move that end, and the
+// others are tombstoned like items removed by RemoveByPriorityID. The
+// items with invalid values are removed the same way, as they would
+// otherwise block their priority level. The other problems are only
+// reported.
+//
+// The priority queue is locked while it is scanned.
+func (pq *PriorityQueue) VerifyIntegrity(repair bool) (*IntegrityReport, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	report := &IntegrityReport{}
+	if _, ok := pq.db.(*leveldb.DB); ok {
+		report.WrongType = !markerMatches(pq.DataDir, goquePriorityQueue)
+	}
+
+	// The next ID expected in each priority level.
+	var next [256]uint64
+	for i, level := range pq.levels {
+		next[i] = level.head + 1
+	}
+
+	iter := pq.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := iter.Key()
+		if bytes.HasPrefix(key, goquePrefix) {
+			continue
+		}
+		if len(key) != 10 || key[1] != prefixSep[0] {
+			report.InvalidKeys = append(report.InvalidKeys, append([]byte{}, key...))
+			continue
+		}
+
+		priority, id := key[0], keyToID(key[2:])
+		level := pq.levels[priority]
+		if id <= level.head || id > level.tail {
+			report.Stray = append(report.Stray, append([]byte{}, key...))
+			continue
+		}
+
+		report.Items++
+		report.addGaps(priority, next[priority], id-1, level.removed)
+		next[priority] = id + 1
+		if _, err := pq.decodeItem(key, iter.Value()); err != nil {
+			report.InvalidValues = append(report.InvalidValues, append([]byte{}, key...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// Check the ends of the priority levels past their last item.
+	for i, level := range pq.levels {
+		report.addGaps(uint8(i), next[i], level.tail, level.removed)
+	}
+
+	if !repair || (len(report.Gaps) == 0 && len(report.InvalidValues) == 0) {
+		return report, nil
+	}
+
+	for priority := 0; priority <= 255; priority++ {
+		level := pq.levels[priority]
+		gaps := report.gapsOf(uint8(priority))
+		if len(gaps) == 0 {
+			continue
+		}
+
+		key := func(id uint64) []byte { return pq.generateKey(uint8(priority), id) }
+		if err := repairGaps(pq.db, pq.wo, gaps, &level.removed, &level.head, &level.tail, key); err != nil {
+			return report, err
+		}
+		pq.updateActive(uint8(priority))
+
+		batch := new(leveldb.Batch)
+		putLevelMeta(batch, uint8(priority), *level)
+		if err := pq.db.Write(batch, pq.wo); err != nil {
+			return report, err
+		}
+	}
+
+	// Remove the items with invalid values.
+	for _, key := range report.InvalidValues {
+		item := &PriorityItem{ID: keyToID(key[2:]), Priority: key[0], Key: key}
+		if err := pq.dropItem(item); err != nil {
+			return report, err
+		}
+	}
+	report.Repaired = true
+	pq.log.warn("goque: Repaired a priority queue", "dir", pq.DataDir, "gaps", len(report.Gaps), "invalid", len(report.InvalidValues))
+
+	return report, nil
+}
+
+// VerifyIntegrity checks the stack for damage and optionally repairs
+// the gaps found and removes the items with invalid values, the same
+// way as PriorityQueue.VerifyIntegrity. The Priority of the gaps is
+// zero.
+func (s *Stack) VerifyIntegrity(repair bool) (*IntegrityReport, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	report := &IntegrityReport{}
+	if _, ok := s.db.(*leveldb.DB); ok {
+		report.WrongType = !markerMatches(s.DataDir, goqueStack)
+	}
+
+	next := s.tail + 1
+	iter := s.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := iter.Key()
+		if bytes.HasPrefix(key, goquePrefix) {
+			continue
+		}
+		if len(key) != 8 {
+			report.InvalidKeys = append(report.InvalidKeys, append([]byte{}, key...))
+			continue
+		}
+
+		id := keyToID(key)
+		if id <= s.tail || id > s.head {
+			report.Stray = append(report.Stray, append([]byte{}, key...))
+			continue
+		}
+
+		report.Items++
+		report.addGaps(0, next, id-1, s.removed)
+		next = id + 1
+		if err := decodeItemValue(s.format, s.seal, &Item{Key: key}, iter.Value()); err != nil {
+			report.InvalidValues = append(report.InvalidValues, append([]byte{}, key...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	report.addGaps(0, next, s.head, s.removed)
+
+	if !repair || (len(report.Gaps) == 0 && len(report.InvalidValues) == 0) {
+		return report, nil
+	}
+
+	if len(report.Gaps) > 0 {
+		if err := repairGaps(s.db, s.wo, report.Gaps, &s.removed, &s.tail, &s.head, idToKey); err != nil {
+			return report, err
+		}
+		if err := s.writeMeta(new(leveldb.Batch), s.head, s.tail); err != nil {
+			return report, err
+		}
+	}
+
+	// Remove the items with invalid values.
+	for _, key := range report.InvalidValues {
+		if err := s.dropItem(&Item{ID: keyToID(key), Key: key}); err != nil {
+			return report, err
+		}
+	}
+	report.Repaired = true
+	s.log.warn("goque: Repaired a stack", "dir", s.DataDir, "gaps", len(report.Gaps), "invalid", len(report.InvalidValues))
+
+	return report, nil
+}
+
+// addGaps adds the IDs from first to last that are not removed ones as
+// gaps of the given priority level.
+func (r *IntegrityReport) addGaps(priority uint8, first, last uint64, removed removedIDs) {
+	i := sort.Search(len(removed), func(i int) bool { return removed[i] >= first })
+	for id := first; id <= last; {
+		// Skip to the next ID not removed.
+		for i < len(removed) && removed[i] == id {
+			i++
+			id++
+		}
+		if id > last {
+			return
+		}
+
+		// Extend the gap up to the next removed ID.
+		end := last
+		if i < len(removed) && removed[i] <= last {
+			end = removed[i] - 1
+		}
+		r.Gaps = append(r.Gaps, IntegrityGap{Priority: priority, First: id, Last: end})
+		id = end + 1
+	}
+}
+
+// gapsOf returns the gaps of the given priority level.
+func (r *IntegrityReport) gapsOf(priority uint8) []IntegrityGap {
+	var gaps []IntegrityGap
+	for _, gap := range r.Gaps {
+		if gap.Priority == priority {
+			gaps = append(gaps, gap)
+		}
+	}
+
+	return gaps
+}
+
+// repairGaps repairs the gaps of the IDs after low up to high, moving
+// low or high past the gaps at either end and tombstoning the IDs of
+// the others, whose keys key returns. The caller must hold the lock.
+func repairGaps(db Store, wo *opt.WriteOptions, gaps []IntegrityGap, removed *removedIDs, low, high *uint64, key func(id uint64) []byte) error {
+	first, last := *low+1, *high
+
+	// Tombstone the gaps in the middle, in batches.
+	ids := append(removedIDs{}, *removed...)
+	batch := new(leveldb.Batch)
+	for _, gap := range gaps {
+		if gap.First == first || gap.Last == last {
+			continue
+		}
+		for id := gap.First; id <= gap.Last; id++ {
+			batch.Put(removedKey(key(id)), []byte{})
+			ids = append(ids, id)
+			if batch.Len() >= clearBatchSize {
+				if err := db.Write(batch, wo); err != nil {
+					return err
+				}
+				batch.Reset()
+			}
+		}
+	}
+	if err := db.Write(batch, wo); err != nil {
+		return err
+	}
+
+	// Move the ends past the gaps there.
+	for _, gap := range gaps {
+		if gap.First == first {
+			*low = gap.Last
+		} else if gap.Last == last {
+			*high = gap.First - 1
+		}
+	}
+	if *high < *low {
+		*high = *low
+	}
+
+	sort.Sort(ids)
+	*removed = ids.trim(low, high)
+
+	return nil
+}
+
+// markerMatches returns whether the 'GOQUE' file of the data directory
+// records a Goque type that can be opened as the given one.
+func markerMatches(dataDir string, gt goqueType) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if err != nil || len(data) < 1 {
+		return false
+	}
+
+	return compatibleType(goqueType(data[0]), gt)
+}
@@ -0,0 +1,219 @@
+package goque
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueVerifyIntegrity(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 1; p++ {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value %d-%d", p, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err = pq.RemoveByPriorityID(0, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := pq.VerifyIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Items != 19 {
+		t.Errorf("Expected 19 intact items, got %+v", report)
+	}
+
+	// Lose items in the middle and at both ends, and add stray keys.
+	for _, key := range [][]byte{pq.generateKey(0, 4), pq.generateKey(0, 5), pq.generateKey(0, 8),
+		pq.generateKey(1, 1), pq.generateKey(1, 2), pq.generateKey(1, 10)} {
+		if err = pq.db.Delete(key, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pq.db.Put(pq.generateKey(2, 50), []byte("stray"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.db.Put([]byte("junk"), []byte("junk"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = pq.VerifyIntegrity(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.Repaired || report.Items != 13 {
+		t.Errorf("Expected 13 items with problems, got %+v", report)
+	}
+	gaps := []IntegrityGap{{0, 4, 5}, {0, 8, 8}, {1, 1, 2}, {1, 10, 10}}
+	if !reflect.DeepEqual(report.Gaps, gaps) {
+		t.Errorf("Expected gaps %v, got %v", gaps, report.Gaps)
+	}
+	if len(report.Stray) != 1 || len(report.InvalidKeys) != 1 || len(report.InvalidValues) != 0 || report.WrongType {
+		t.Errorf("Expected 1 stray and 1 invalid key, got %+v", report)
+	}
+
+	// Repair the gaps.
+	if report, err = pq.VerifyIntegrity(true); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Repaired {
+		t.Error("Expected the gaps to be repaired")
+	}
+	if pq.Length() != 13 {
+		t.Errorf("Expected queue length of 13, got %d", pq.Length())
+	}
+	if report, err = pq.VerifyIntegrity(false); err != nil || len(report.Gaps) != 0 {
+		t.Errorf("Expected no gaps left, got %+v and %v", report, err)
+	}
+
+	// The repair outlives reopening the priority queue.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.db.Delete(pq.generateKey(2, 50), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.db.Delete([]byte("junk"), nil); err != nil {
+		t.Fatal(err)
+	}
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	defer pq.Close()
+
+	if report, err = pq.VerifyIntegrity(false); err != nil || !report.OK() {
+		t.Errorf("Expected no problems, got %+v and %v", report, err)
+	}
+	for _, want := range []string{"0-1", "0-2", "0-3", "0-6", "0-9", "0-10", "1-3", "1-4", "1-5", "1-6", "1-7", "1-8", "1-9"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != "value "+want {
+			t.Errorf("Expected 'value %s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPriorityQueueVerifyIntegrityInvalidHead(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetChecksums(true); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Flip a bit of the value of the head item, blocking its level.
+	key := pq.generateKey(0, 1)
+	data, err := pq.db.Get(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-6] ^= 1
+	if err = pq.db.Put(key, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.Dequeue(); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	report, err := pq.VerifyIntegrity(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.InvalidValues) != 1 || !report.Repaired {
+		t.Errorf("Expected the invalid value to be repaired, got %+v", report)
+	}
+
+	// The rest of the level is dequeued.
+	for _, want := range []string{"value 2", "value 3"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if report, err = pq.VerifyIntegrity(false); err != nil || !report.OK() {
+		t.Errorf("Expected no problems, got %+v and %v", report, err)
+	}
+}
+
+func TestStackVerifyIntegrity(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Lose the top item, corrupt another and change the 'GOQUE' file.
+	if err = s.db.Delete(idToKey(5), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.db.Put(idToKey(2), []byte{0xff}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(goqueDeque)}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.VerifyIntegrity(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gaps := []IntegrityGap{{0, 5, 5}}; !reflect.DeepEqual(report.Gaps, gaps) {
+		t.Errorf("Expected gaps %v, got %v", gaps, report.Gaps)
+	}
+	if len(report.InvalidValues) != 1 || !report.WrongType || !report.Repaired || report.Items != 4 {
+		t.Errorf("Expected 4 items with 1 invalid value and the wrong type, got %+v", report)
+	}
+
+	// The corrupted item was removed too.
+	for _, want := range []string{"value 4", "value 3", "value 1"} {
+		item, err := s.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+}
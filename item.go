@@ -2,13 +2,23 @@ package goque
 
 import (
 	"encoding/binary"
+	"sort"
+	"time"
 )
 
 // Item represents an entry in either a stack or queue.
+//
+// Headers, CreatedAt and UpdatedAt are persisted along with the value
+// by stacks and queues created by this version. CreatedAt and UpdatedAt
+// are set when the item is first added, and UpdatedAt again when it is
+// updated. Other data structures storing Items ignore them.
 type Item struct {
-	ID    uint64
-	Key   []byte
-	Value []byte
+	ID        uint64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // NewItem creates a new item for use with a stack or queue.
@@ -28,11 +38,27 @@ func (i *Item) ToString() string {
 }
 
 // PriorityItem represents an entry in a priority queue.
+//
+// Seq is a global sequence number, increasing across all priority
+// levels in the order items were enqueued. It is 0 for items stored by
+// priority queues created before sequence numbers were introduced.
+//
+// Attempts is the number of times the item was reserved and then
+// nacked or left to expire.
+//
+// Headers, CreatedAt and UpdatedAt are persisted along with the value,
+// the same way as for an Item, unless the priority queue was created
+// before sequence numbers were introduced.
 type PriorityItem struct {
-	ID       uint64
-	Priority uint8
-	Key      []byte
-	Value    []byte
+	ID        uint64
+	Priority  uint8
+	Seq       uint64
+	Attempts  uint32
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // NewPriorityItem creates a new item for use with a priority queue.
@@ -62,3 +88,26 @@ func idToKey(id uint64) []byte {
 func keyToID(key []byte) uint64 {
 	return binary.BigEndian.Uint64(key)
 }
+
+// idIndexes sorts the indexes of an ID slice by the ID they point to.
+type idIndexes struct {
+	ids     []uint64
+	indexes []int
+}
+
+func (x idIndexes) Len() int           { return len(x.indexes) }
+func (x idIndexes) Less(i, j int) bool { return x.ids[x.indexes[i]] < x.ids[x.indexes[j]] }
+func (x idIndexes) Swap(i, j int)      { x.indexes[i], x.indexes[j] = x.indexes[j], x.indexes[i] }
+
+// sortedIndexes returns the indexes of the given IDs, ordered so the
+// IDs they point to are ascending. This lets batch lookups access keys
+// in sorted order while still returning results in the given order.
+func sortedIndexes(ids []uint64) []int {
+	x := idIndexes{ids: ids, indexes: make([]int, len(ids))}
+	for i := range x.indexes {
+		x.indexes[i] = i
+	}
+	sort.Sort(x)
+
+	return x.indexes
+}
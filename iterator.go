@@ -0,0 +1,206 @@
+package goque
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// PriorityQueueIterator walks the items of a priority queue in dequeue
+// order without removing them. It reads a snapshot of the priority
+// queue taken when it was created, so items added or removed later do
+// not affect it. Items that are in flight are not included.
+//
+// The iterator must be released once it is no longer needed.
+type PriorityQueueIterator struct {
+	pq     *PriorityQueue
+	iter   iterator.Iterator
+	levels []uint8
+	prefix []byte
+	item   *PriorityItem
+	err    error
+}
+
+// Iterator returns an iterator over the items of the priority queue.
+func (pq *PriorityQueue) Iterator() (*PriorityQueueIterator, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	it := &PriorityQueueIterator{
+		pq:     pq,
+		iter:   pq.db.NewIterator(nil, nil),
+		levels: pq.dequeueLevels(),
+	}
+
+	return it, nil
+}
+
+// Next moves the iterator to the next item, returning false once there
+// are no more items or an error occurred.
+func (it *PriorityQueueIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.item = nil
+	for {
+		// Move to the next item of the current priority level, or to
+		// the first item of the next one.
+		var ok bool
+		if it.prefix != nil {
+			ok = it.iter.Next()
+		} else if len(it.levels) > 0 {
+			it.prefix = it.pq.generatePrefix(it.levels[0])
+			it.levels = it.levels[1:]
+			ok = it.iter.Seek(it.prefix)
+		} else {
+			it.err = it.iter.Error()
+			return false
+		}
+
+		if !ok || !bytes.HasPrefix(it.iter.Key(), it.prefix) {
+			if it.err = it.iter.Error(); it.err != nil {
+				return false
+			}
+			it.prefix = nil
+			continue
+		}
+
+		it.item, it.err = it.pq.decodeItem(it.iter.Key(), it.iter.Value())
+		return it.err == nil
+	}
+}
+
+// Item returns the current item of the iterator.
+func (it *PriorityQueueIterator) Item() *PriorityItem {
+	return it.item
+}
+
+// Error returns the error that stopped the iterator, if any.
+func (it *PriorityQueueIterator) Error() error {
+	return it.err
+}
+
+// Release releases the snapshot read by the iterator.
+func (it *PriorityQueueIterator) Release() {
+	it.iter.Release()
+	it.item = nil
+}
+
+// ForEach calls fn for every item of the priority queue in dequeue
+// order, without removing them, until fn returns false. Like Iterator,
+// it reads a snapshot of the priority queue, so fn may use the priority
+// queue.
+func (pq *PriorityQueue) ForEach(fn func(item *PriorityItem) bool) error {
+	it, err := pq.Iterator()
+	if err != nil {
+		return err
+	}
+	defer it.Release()
+
+	for it.Next() {
+		if !fn(it.Item()) {
+			break
+		}
+	}
+
+	return it.Error()
+}
+
+// Direction defines which way a stack iterator walks the stack.
+type Direction int
+
+// The directions a stack iterator can walk in.
+const (
+	TopDown  Direction = iota // From the top of the stack, in pop order.
+	BottomUp                  // From the bottom of the stack.
+)
+
+// StackIterator walks the items of a stack without removing them. Like
+// PriorityQueueIterator, it reads a snapshot of the stack taken when it
+// was created.
+//
+// The iterator must be released once it is no longer needed.
+type StackIterator struct {
+	iter    iterator.Iterator
+	dir     Direction
+	format  uint8
+	seal    valueSeal
+	started bool
+	item    *Item
+	err     error
+}
+
+// Iterator returns an iterator over the items of the stack, walking in
+// the given direction.
+func (s *Stack) Iterator(dir Direction) (*StackIterator, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	it := &StackIterator{
+		iter:   s.db.NewIterator(&util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}, nil),
+		dir:    dir,
+		format: s.format,
+		seal:   s.seal,
+	}
+
+	return it, nil
+}
+
+// Next moves the iterator to the next item, returning false once there
+// are no more items or an error occurred.
+func (it *StackIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	// Start from the end of the stack the iterator walks from.
+	var ok bool
+	switch {
+	case !it.started && it.dir == TopDown:
+		ok = it.iter.Last()
+	case !it.started:
+		ok = it.iter.First()
+	case it.dir == TopDown:
+		ok = it.iter.Prev()
+	default:
+		ok = it.iter.Next()
+	}
+	it.started = true
+
+	if !ok {
+		it.item = nil
+		it.err = it.iter.Error()
+		return false
+	}
+
+	it.item, it.err = copyItem(it.format, it.seal, it.iter.Key(), it.iter.Value())
+	return it.err == nil
+}
+
+// Item returns the current item of the iterator.
+func (it *StackIterator) Item() *Item {
+	return it.item
+}
+
+// Error returns the error that stopped the iterator, if any.
+func (it *StackIterator) Error() error {
+	return it.err
+}
+
+// Release releases the snapshot read by the iterator.
+func (it *StackIterator) Release() {
+	it.iter.Release()
+	it.item = nil
+}
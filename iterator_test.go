@@ -0,0 +1,196 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueIterator(t *testing.T) {
+	for _, o := range []order{ASC, DESC} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		pq, err := OpenPriorityQueue(file, o)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for p := 0; p <= 4; p++ {
+			for i := 1; i <= 3; i++ {
+				if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p*50))); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+
+		// Collect the dequeue order to compare the iterator with.
+		var want []string
+		for p := 0; p <= 4; p++ {
+			priority := p * 50
+			if o == DESC {
+				priority = (4 - p) * 50
+			}
+			for i := 1; i <= 3; i++ {
+				want = append(want, fmt.Sprintf("%d %s", priority, fmt.Sprintf("value for item %d", i)))
+			}
+		}
+
+		it, err := pq.Iterator()
+		if err != nil {
+			t.Error(err)
+		}
+
+		// Changes made after the iterator was created are not seen.
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+		if err = pq.Enqueue(NewPriorityItemString("later item", 100)); err != nil {
+			t.Error(err)
+		}
+
+		var got []string
+		for it.Next() {
+			got = append(got, fmt.Sprintf("%d %s", it.Item().Priority, it.Item().ToString()))
+		}
+		if err = it.Error(); err != nil {
+			t.Error(err)
+		}
+		it.Release()
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected items %v, got %v", want, got)
+		}
+
+		pq.ForceDrop()
+	}
+}
+
+func TestPriorityQueueForEach(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Stop after the fifth item.
+	var count int
+	err = pq.ForEach(func(item *PriorityItem) bool {
+		count++
+		compStr := fmt.Sprintf("value for item %d", count)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+		return count < 5
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if count != 5 {
+		t.Errorf("Expected 5 items, got %d", count)
+	}
+
+	if pq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueForEachEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	err = pq.ForEach(func(item *PriorityItem) bool {
+		t.Error("Expected no items")
+		return true
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStackIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = s.RemoveByID(3); err != nil {
+		t.Error(err)
+	}
+
+	for _, dir := range []Direction{TopDown, BottomUp} {
+		it, err := s.Iterator(dir)
+		if err != nil {
+			t.Error(err)
+		}
+
+		// Changes made after the iterator was created are not seen.
+		if _, err = s.Pop(); err != nil {
+			t.Error(err)
+		}
+		if err = s.Push(NewItemString("later item")); err != nil {
+			t.Error(err)
+		}
+
+		var got []uint64
+		for it.Next() {
+			got = append(got, it.Item().ID)
+			compStr := fmt.Sprintf("value for item %d", it.Item().ID)
+			if it.Item().ToString() != compStr {
+				t.Errorf("Expected string to be '%s', got '%s'", compStr, it.Item().ToString())
+			}
+		}
+		if err = it.Error(); err != nil {
+			t.Error(err)
+		}
+		it.Release()
+
+		want := "[5 4 2 1]"
+		if dir == BottomUp {
+			want = "[1 2 4 5]"
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("Expected IDs %s, got %v", want, got)
+		}
+
+		// Put the stack back the way it was.
+		if _, err = s.Pop(); err != nil {
+			t.Error(err)
+		}
+		if err = s.Push(NewItemString("value for item 5")); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestStackIteratorClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	s.Close()
+
+	if _, err = s.Iterator(TopDown); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
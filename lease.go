@@ -0,0 +1,444 @@
+package goque
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// leasePrefix is the key prefix used to persist the leases of in-flight
+// items. Its second byte is not prefixSep, so it can never collide with
+// the key of an item in any priority level.
+var leasePrefix = []byte("goque:lease:")
+
+// Token is an opaque ownership token bound to an in-flight item.
+type Token string
+
+// Lease represents the ownership of an item that has been dequeued
+// but not yet completed or released.
+//
+// A zero Deadline means the lease never expires.
+type Lease struct {
+	Token      Token
+	Item       *PriorityItem
+	AcquiredAt time.Time
+	Deadline   time.Time
+}
+
+// expired returns whether the lease deadline has passed.
+func (l *Lease) expired(now time.Time) bool {
+	return !l.Deadline.IsZero() && now.After(l.Deadline)
+}
+
+// DequeueWithToken removes the next item in the priority queue and
+// returns it along with an ownership token. The item is kept in flight
+// until the token is passed to either Complete or Release.
+func (pq *PriorityQueue) DequeueWithToken() (*PriorityItem, Token, error) {
+	return pq.DequeueWithLease(0)
+}
+
+// DequeueWithLease is like DequeueWithToken, but the lease on the item
+// expires after the given duration unless it is extended using Extend.
+// Expired items are returned to the queue by ReclaimExpired.
+//
+// A duration of 0 means the lease never expires.
+func (pq *PriorityQueue) DequeueWithLease(d time.Duration) (*PriorityItem, Token, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, "", ErrDBClosed
+	}
+
+	// Move the next item into a lease.
+	lease, err := pq.takeNext(leasePrefix, d)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Track the earliest lease deadline.
+	pq.trackDeadline(lease.Deadline)
+
+	return lease.Item, lease.Token, nil
+}
+
+// takeNext removes the next item in the priority queue and stores it in
+// a lease record under the given key prefix, in a single LevelDB batch.
+// The caller must hold the lock.
+func (pq *PriorityQueue) takeNext(prefix []byte, d time.Duration) (*Lease, error) {
+	// Return items with expired leases first.
+	if err := pq.reclaimDue(); err != nil {
+		return nil, err
+	}
+
+	// Try to get the next item, skipping the groups in flight and
+	// removing the expired items.
+	next := pq.getNextItem
+	if pq.groups {
+		next = pq.getNextUngrouped
+	}
+	item, err := pq.skipExpired(next)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate a new token for this item.
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Move the item from its priority level into the record.
+	lease := &Lease{Token: token, Item: item, AcquiredAt: time.Now()}
+	if d > 0 {
+		lease.Deadline = lease.AcquiredAt.Add(d)
+	}
+	record, err := pq.encodeLease(lease)
+	if err != nil {
+		return nil, err
+	}
+	batch := new(leveldb.Batch)
+	pq.removeItem(batch, item)
+	putLevelMeta(batch, item.Priority, pq.levels[item.Priority].without(item.ID))
+	batch.Put(tokenKey(prefix, token), record)
+	if err = pq.write(batch, changeOf(ChangeDequeue, item)); err != nil {
+		return nil, err
+	}
+
+	// Increment position, or skip the gap left by a grouped item.
+	pq.tookItem(item)
+	pq.commitRemove(item)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.counters.Dequeued++
+	firePriority(pq.hooks.OnDequeue, item)
+
+	return lease, nil
+}
+
+// Complete deletes the in-flight item owned by the given token.
+func (pq *PriorityQueue) Complete(token Token) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Make sure the token is still valid.
+	if _, err := pq.getLease(token); err != nil {
+		return err
+	}
+
+	return pq.db.Delete(leaseKey(token), pq.wo)
+}
+
+// Extend pushes the deadline of the lease owned by the given token out
+// to the given duration from now. Consumers processing long-running
+// items should call Extend periodically as a heartbeat.
+//
+// If the lease has already expired, ErrLeaseExpired is returned and the
+// item will be returned to the queue by the next ReclaimExpired.
+func (pq *PriorityQueue) Extend(token Token, d time.Duration) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Get the lease for this token.
+	lease, err := pq.getLease(token)
+	if err != nil {
+		return err
+	}
+
+	// Check if the lease has already expired.
+	now := time.Now()
+	if lease.expired(now) {
+		return ErrLeaseExpired
+	}
+
+	lease.Deadline = now.Add(d)
+	record, err := pq.encodeLease(lease)
+	if err != nil {
+		return err
+	}
+	if err = pq.db.Put(leaseKey(token), record, pq.wo); err != nil {
+		return err
+	}
+
+	// Track the new deadline, in case it is earlier than the others.
+	pq.trackDeadline(lease.Deadline)
+
+	return nil
+}
+
+// Release returns the in-flight item owned by the given token to the
+// tail of its priority level, giving it a new ID.
+func (pq *PriorityQueue) Release(token Token) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Get the lease for this token.
+	lease, err := pq.getLease(token)
+	if err != nil {
+		return err
+	}
+
+	return pq.releaseLease(lease, false)
+}
+
+// ReclaimExpired returns every in-flight item whose lease has expired
+// to the queue, returning the number of items reclaimed.
+func (pq *PriorityQueue) ReclaimExpired() (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return pq.reclaimExpired(time.Now())
+}
+
+// reclaimExpired returns every in-flight item whose lease expired by
+// the given time to the queue, and finds the earliest deadline of the
+// remaining leases.
+func (pq *PriorityQueue) reclaimExpired(now time.Time) (int, error) {
+	// Find the expired leases.
+	leases, err := pq.getLeases()
+	if err != nil {
+		return 0, err
+	}
+
+	var reclaimed int
+	pq.deadline = time.Time{}
+	for _, lease := range leases {
+		if !lease.expired(now) {
+			pq.trackDeadline(lease.Deadline)
+			continue
+		}
+
+		if err = pq.failLease(lease, false); err != nil {
+			return reclaimed, err
+		}
+		reclaimed++
+	}
+
+	return reclaimed, nil
+}
+
+// trackDeadline updates the earliest lease deadline of the priority
+// queue with the given deadline.
+func (pq *PriorityQueue) trackDeadline(deadline time.Time) {
+	if !deadline.IsZero() && (pq.deadline.IsZero() || deadline.Before(pq.deadline)) {
+		pq.deadline = deadline
+	}
+}
+
+// reclaimDue returns the in-flight items with expired leases to the
+// queue, if any lease may have expired since the last time.
+func (pq *PriorityQueue) reclaimDue() error {
+	if pq.deadline.IsZero() {
+		return nil
+	}
+
+	now := time.Now()
+	if !now.After(pq.deadline) {
+		return nil
+	}
+
+	_, err := pq.reclaimExpired(now)
+	return err
+}
+
+// Leases returns the leases of every item currently in flight, so
+// abandoned items can be found and reclaimed using Release.
+func (pq *PriorityQueue) Leases() ([]*Lease, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return pq.getLeases()
+}
+
+// releaseLease moves the item owned by the given lease back into its
+// priority level, at the head if front is set or the item is grouped,
+// and at the tail otherwise.
+func (pq *PriorityQueue) releaseLease(lease *Lease, front bool) error {
+	return pq.restoreItem(lease.Item, leaseKey(lease.Token), front || pq.grouped(lease.Item))
+}
+
+// restoreItem moves an item out of the record with the given key back
+// into its priority level, at the head if front is set and at the tail
+// otherwise.
+func (pq *PriorityQueue) restoreItem(item *PriorityItem, key []byte, front bool) error {
+	// Get the priorityLevel.
+	level := pq.levels[item.Priority]
+
+	// Set item ID and key. The item can only go in front of the head if
+	// there is a free ID there.
+	front = front && level.head > 0
+	if front {
+		item.ID = level.head
+	} else {
+		item.ID = level.tail + 1
+	}
+	item.Key = pq.generateKey(item.Priority, item.ID)
+
+	// Move the item from its record back into the priority level.
+	batch := new(leveldb.Batch)
+	if err := pq.putValue(batch, item); err != nil {
+		return err
+	}
+	batch.Delete(key)
+	next := *level
+	if front {
+		next.head--
+	} else {
+		next.tail++
+	}
+	putLevelMeta(batch, item.Priority, next)
+	if err := pq.write(batch, changeOf(ChangeRequeue, item)); err != nil {
+		return err
+	}
+
+	if front {
+		level.head--
+	} else {
+		level.tail++
+	}
+	before := pq.active
+	pq.active.set(item.Priority, true)
+	pq.bounds.add(uint64(len(item.Value)))
+	pq.counters.Enqueued++
+	firePriority(pq.hooks.OnRequeue, item)
+	pq.signalAdded(before)
+
+	// If this priority level is more important than the curLevel.
+	if pq.cmpAsc(item.Priority) || pq.cmpDesc(item.Priority) {
+		pq.curLevel = item.Priority
+	}
+
+	return nil
+}
+
+// getLeases returns the leases of every item currently in flight.
+func (pq *PriorityQueue) getLeases() ([]*Lease, error) {
+	return pq.getRecords(leasePrefix)
+}
+
+// getRecords returns the lease records stored under the given key
+// prefix.
+func (pq *PriorityQueue) getRecords(prefix []byte) ([]*Lease, error) {
+	// Create a new LevelDB Iterator for the record keys.
+	iter := pq.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	var leases []*Lease
+	for iter.Next() {
+		lease, err := pq.decodeLease(iter.Key()[len(prefix):], iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, lease)
+	}
+
+	return leases, iter.Error()
+}
+
+// getLease returns the lease, if found, for the given token.
+func (pq *PriorityQueue) getLease(token Token) (*Lease, error) {
+	data, err := pq.db.Get(leaseKey(token), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	return pq.decodeLease([]byte(token), data)
+}
+
+// newToken generates a new random ownership token.
+func newToken() (Token, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return Token(hex.EncodeToString(b)), nil
+}
+
+// leaseKey creates the key used to store the lease of the given token.
+func leaseKey(token Token) []byte {
+	return tokenKey(leasePrefix, token)
+}
+
+// tokenKey creates the key under the given prefix for the given token.
+func tokenKey(prefix []byte, token Token) []byte {
+	key := make([]byte, len(prefix)+len(token))
+	copy(key, prefix)
+	copy(key[len(prefix):], token)
+	return key
+}
+
+// encodeLease encodes a lease into the value stored in LevelDB.
+func (pq *PriorityQueue) encodeLease(lease *Lease) ([]byte, error) {
+	var deadline int64
+	if !lease.Deadline.IsZero() {
+		deadline = lease.Deadline.UnixNano()
+	}
+	value, err := pq.encodeValue(lease.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	// key + acquired at + deadline + value = 10 + 8 + 8 + n
+	data := make([]byte, 26+len(value))
+	copy(data[0:10], lease.Item.Key)
+	binary.BigEndian.PutUint64(data[10:18], uint64(lease.AcquiredAt.UnixNano()))
+	binary.BigEndian.PutUint64(data[18:26], uint64(deadline))
+	copy(data[26:], value)
+	return data, nil
+}
+
+// decodeLease decodes a lease from the given token and stored value.
+func (pq *PriorityQueue) decodeLease(token, data []byte) (*Lease, error) {
+	if len(data) < 26 {
+		return nil, ErrInvalidRecord
+	}
+
+	// Create the PriorityItem this lease owns.
+	item, err := pq.decodeItem(data[0:10], data[26:])
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{
+		Token:      Token(token),
+		Item:       item,
+		AcquiredAt: time.Unix(0, int64(binary.BigEndian.Uint64(data[10:18]))),
+	}
+	if deadline := int64(binary.BigEndian.Uint64(data[18:26])); deadline != 0 {
+		lease.Deadline = time.Unix(0, deadline)
+	}
+
+	return lease, nil
+}
@@ -0,0 +1,293 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueDequeueWithToken(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if token == "" {
+		t.Error("Expected a non-empty token")
+	}
+
+	if pq.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", pq.Length())
+	}
+
+	leases, err := pq.Leases()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(leases) != 1 {
+		t.Fatalf("Expected 1 lease, got %d", len(leases))
+	}
+
+	if leases[0].Token != token {
+		t.Errorf("Expected lease token to be '%s', got '%s'", token, leases[0].Token)
+	}
+
+	if leases[0].Item.ToString() != item.ToString() {
+		t.Errorf("Expected string to be '%s', got '%s'", item.ToString(), leases[0].Item.ToString())
+	}
+}
+
+func TestPriorityQueueComplete(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 0)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Complete(token); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	if err = pq.Complete(token); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+}
+
+func TestPriorityQueueRelease(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 2; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Release(token); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	if err = pq.Release(token); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+
+	// The released item should be at the tail of its priority level.
+	compStr := "value for item 1"
+
+	lastItem, err := pq.PeekByPriorityID(0, 3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if lastItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, lastItem.ToString())
+	}
+}
+
+func TestPriorityQueueLeasesPersist(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 5)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	pq.Close()
+
+	// Reopen the priority queue and reclaim the abandoned item.
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	leases, err := pq.Leases()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(leases) != 1 || leases[0].Token != token {
+		t.Fatalf("Expected lease with token '%s' to persist", token)
+	}
+
+	if err = pq.Release(leases[0].Token); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.Priority != 5 {
+		t.Errorf("Expected priority level to be 5, got %d", item.Priority)
+	}
+}
+
+func TestPriorityQueueExtend(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 0)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.DequeueWithLease(50 * time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Extend(token, time.Hour); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	reclaimed, err := pq.ReclaimExpired()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if reclaimed != 0 {
+		t.Errorf("Expected 0 items to be reclaimed, got %d", reclaimed)
+	}
+
+	if err = pq.Complete(token); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriorityQueueExtendShorter(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 0)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.DequeueWithLease(time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Extend(token, 10*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// The next dequeue returns the item whose lease was shortened.
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item == nil || item.ToString() != "value for item" {
+		t.Errorf("Expected to dequeue the reclaimed item, got %v", item)
+	}
+}
+
+func TestPriorityQueueReclaimExpired(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 2; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, expToken, err := pq.DequeueWithLease(10 * time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, _, err = pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err = pq.Extend(expToken, time.Hour); err != ErrLeaseExpired {
+		t.Errorf("Expected to get lease expired error, got %v", err)
+	}
+
+	reclaimed, err := pq.ReclaimExpired()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if reclaimed != 1 {
+		t.Errorf("Expected 1 item to be reclaimed, got %d", reclaimed)
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+
+	if err = pq.Extend(expToken, time.Hour); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+}
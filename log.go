@@ -0,0 +1,106 @@
+package goque
+
+import (
+	"sync"
+	"time"
+)
+
+// Logger receives the recoverable events of priority queues and stacks,
+// such as recovering after an unclean shutdown, compactions, slow
+// operations and items moved to a dead-letter queue. Each event is a
+// message followed by alternating keys and values. A *slog.Logger
+// implements it.
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// logger is the logger of a data structure along with the duration
+// after which its operations are reported as slow. It is protected by
+// the lock of the data structure it belongs to, and a nil logger
+// reports nothing.
+type logger struct {
+	Logger
+	slow time.Duration
+}
+
+// The logger given to data structures when they are opened.
+var (
+	defaultLogMu sync.Mutex
+	defaultLog   *logger
+)
+
+// SetLogger sets the logger of every priority queue and stack opened
+// afterwards, which reports events from the moment they are opened. Any
+// call taking longer than slow to enqueue, dequeue, push or pop an item
+// is reported as well; a zero slow reports none. A nil logger turns
+// logging off, which is the default.
+func SetLogger(l Logger, slow time.Duration) {
+	defaultLogMu.Lock()
+	defer defaultLogMu.Unlock()
+
+	defaultLog = newLogger(l, slow)
+}
+
+// SetLogger sets the logger of the priority queue, the same way as the
+// package-level SetLogger.
+func (pq *PriorityQueue) SetLogger(l Logger, slow time.Duration) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.log = newLogger(l, slow)
+}
+
+// SetLogger sets the logger of the stack, the same way as the
+// package-level SetLogger.
+func (s *Stack) SetLogger(l Logger, slow time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.log = newLogger(l, slow)
+}
+
+// newLogger returns the logger using the given Logger, or nil if it is
+// nil.
+func newLogger(l Logger, slow time.Duration) *logger {
+	if l == nil {
+		return nil
+	}
+
+	return &logger{Logger: l, slow: slow}
+}
+
+// openLogger returns the logger set by SetLogger for a data structure
+// being opened.
+func openLogger() *logger {
+	defaultLogMu.Lock()
+	defer defaultLogMu.Unlock()
+
+	return defaultLog
+}
+
+// info reports an informational event.
+func (l *logger) info(msg string, args ...interface{}) {
+	if l != nil {
+		l.Info(msg, args...)
+	}
+}
+
+// warn reports an event that may need attention.
+func (l *logger) warn(msg string, args ...interface{}) {
+	if l != nil {
+		l.Warn(msg, args...)
+	}
+}
+
+// timed reports the given operation if it started long enough ago to be
+// slow.
+func (l *logger) timed(op string, start time.Time) {
+	if l == nil || l.slow <= 0 {
+		return
+	}
+
+	if d := time.Since(start); d >= l.slow {
+		l.Warn("goque: Slow operation", "op", op, "duration", d)
+	}
+}
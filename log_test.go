@@ -0,0 +1,140 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLogger records the messages it receives.
+type testLogger struct {
+	sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Info(msg string, args ...interface{}) { l.log(msg) }
+func (l *testLogger) Warn(msg string, args ...interface{}) { l.log(msg) }
+
+func (l *testLogger) log(msg string) {
+	l.Lock()
+	defer l.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+// has reports whether the given message was received.
+func (l *testLogger) has(msg string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, m := range l.msgs {
+		if m == msg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestPriorityQueueLogger(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	l := &testLogger{}
+	pq.SetLogger(l, time.Nanosecond)
+	if err = pq.SetAutoCompact(AutoCompact{Deletes: 2}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if !l.has("goque: Slow operation") {
+		t.Error("Expected slow operations to be logged")
+	}
+	if !l.has("goque: Compacted the store") {
+		t.Error("Expected the automatic compaction to be logged")
+	}
+}
+
+func TestPriorityQueueLoggerDeadLetter(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	dlq, err := OpenPriorityQueue(file+"_dlq", ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dlq.ForceDrop()
+
+	l := &testLogger{}
+	pq.SetLogger(l, 0)
+	pq.SetDeadLetter(dlq, 0)
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+	_, token, err := pq.Reserve(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Nack(token); err != nil {
+		t.Error(err)
+	}
+
+	if !l.has("goque: Moved an item to the dead-letter queue") {
+		t.Error("Expected the dead-letter move to be logged")
+	}
+	if l.has("goque: Slow operation") {
+		t.Error("Expected no slow operations to be logged")
+	}
+}
+
+func TestStackLoggerRecovered(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Close the database without the persisted positions, as a data
+	// directory written by an older version has none.
+	if err = s.db.Delete(metaKey, nil); err != nil {
+		t.Error(err)
+	}
+	s.db.Close()
+
+	l := &testLogger{}
+	SetLogger(l, 0)
+	defer SetLogger(nil, 0)
+
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if !l.has("goque: Rebuilt the positions of a stack") {
+		t.Error("Expected the rebuild to be logged")
+	}
+}
@@ -0,0 +1,34 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// OpenPriorityQueueMem opens a new priority queue that is kept entirely
+// in memory. Its items are lost when it is closed.
+func OpenPriorityQueueMem(order order) (*PriorityQueue, error) {
+	// Open an in-memory database for the priority queue.
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return &PriorityQueue{order: order, db: &leveldb.DB{}}, err
+	}
+
+	return OpenPriorityQueueWithStore("", order, db)
+}
+
+// OpenStackMem opens a new stack that is kept entirely in memory. Its
+// items are lost when it is closed.
+func OpenStackMem() (*Stack, error) {
+	// Open an in-memory database for the stack.
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		return &Stack{db: &leveldb.DB{}}, err
+	}
+
+	// Nothing was stored before, so the items keep their metadata.
+	s, err := OpenStackWithStore("", db)
+	s.format = defaultFormat(goqueStack)
+
+	return s, err
+}
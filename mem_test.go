@@ -0,0 +1,111 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPriorityQueueMem(t *testing.T) {
+	pq, err := OpenPriorityQueueMem(ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if pq.Length() != 50 {
+		t.Errorf("Expected queue length of 50, got %d", pq.Length())
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.Priority != 0 {
+		t.Errorf("Expected priority level to be 0, got %d", deqItem.Priority)
+	}
+
+	if deqItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", deqItem.ToString())
+	}
+
+	if deqItem.Seq != 1 {
+		t.Errorf("Expected sequence number to be 1, got %d", deqItem.Seq)
+	}
+
+	// Leases and the other features built on reserved keys work too.
+	_, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Complete(token); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 48 {
+		t.Errorf("Expected queue length of 48, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueMemIsolated(t *testing.T) {
+	pq1, err := OpenPriorityQueueMem(ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq1.ForceDrop()
+
+	pq2, err := OpenPriorityQueueMem(ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq2.ForceDrop()
+
+	if err = pq1.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	if pq2.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq2.Length())
+	}
+}
+
+func TestStackMem(t *testing.T) {
+	s, err := OpenStackMem()
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if s.Length() != 10 {
+		t.Errorf("Expected stack length of 10, got %d", s.Length())
+	}
+
+	popItem, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if popItem.ToString() != "value for item 10" {
+		t.Errorf("Expected string to be 'value for item 10', got '%s'", popItem.ToString())
+	}
+
+	s.Close()
+	if _, err = s.Pop(); err == nil {
+		t.Error("Expected to get an error after closing the stack")
+	}
+}
@@ -0,0 +1,37 @@
+package goque
+
+// Merge moves every item of the source priority queue into this one, in
+// batches of up to 1000 items, keeping their priority level, headers
+// and timestamps. Items keep their relative order within each priority
+// level, after the items already in this one. It returns the number of
+// items moved, and stops at the first error.
+//
+// Each batch is removed from the source only once this priority queue
+// holds it, so a failed or interrupted merge never loses an item,
+// although the last batch may then end up in both. Items in flight in
+// the source are not moved, and stay there once released. Items added
+// to the source during the merge are moved too, so stop its producers
+// first to consolidate it for good. The source stays locked while each
+// batch is written, so two priority queues must not be merged into each
+// other at the same time.
+func (pq *PriorityQueue) Merge(src *PriorityQueue) (uint64, error) {
+	// Merging a priority queue into itself leaves it as it is.
+	if src == pq {
+		return 0, nil
+	}
+
+	var merged uint64
+	w := PriorityItemWriterFunc(func(items []*PriorityItem) (int, error) {
+		if err := pq.copyItems(items); err != nil {
+			return 0, err
+		}
+		return len(items), nil
+	})
+	for {
+		n, err := src.DrainTo(w, defaultCopyBatchSize)
+		merged += uint64(n)
+		if err != nil || n == 0 {
+			return merged, err
+		}
+	}
+}
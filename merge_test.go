@@ -0,0 +1,109 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueMerge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.ForceDrop()
+
+	if _, err = pq.EnqueueString(1, "existing"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 1500; i++ {
+		item := NewPriorityItemString(fmt.Sprintf("item %d", i), uint8(i%3))
+		item.Headers = map[string]string{"n": fmt.Sprint(i)}
+		if err = src.Enqueue(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := pq.Merge(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1500 {
+		t.Errorf("Expected 1500 items to be merged, got %d", n)
+	}
+	if src.Length() != 0 || pq.Length() != 1501 {
+		t.Errorf("Expected the items to be moved, got %d left and %d merged", src.Length(), pq.Length())
+	}
+
+	// Every level keeps its order, after the items already there.
+	for priority := 0; priority < 3; priority++ {
+		if priority == 1 {
+			item, err := pq.DequeueByPriority(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.ToString() != "existing" {
+				t.Errorf("Expected 'existing' first, got '%s'", item.ToString())
+			}
+		}
+
+		for i := priority; i <= 1500; i += 3 {
+			if i == 0 {
+				continue
+			}
+			item, err := pq.DequeueByPriority(uint8(priority))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("item %d", i); item.ToString() != want || item.Headers["n"] != fmt.Sprint(i) {
+				t.Fatalf("Expected '%s' in priority %d, got '%s' %v", want, priority, item.ToString(), item.Headers)
+			}
+		}
+	}
+}
+
+func TestPriorityQueueMergeFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = src.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is removed from the source if the items don't fit.
+	if err = pq.SetCapacity(Capacity{MaxItems: 2, Policy: OverflowError}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := pq.Merge(src); err != ErrFull || n != 0 {
+		t.Errorf("Expected ErrFull and no item merged, got %v and %d", err, n)
+	}
+	if src.Length() != 3 {
+		t.Errorf("Expected 3 items left in the source, got %d", src.Length())
+	}
+
+	// A priority queue merged into itself is left as it is.
+	if n, err := src.Merge(src); err != nil || n != 0 || src.Length() != 3 {
+		t.Errorf("Expected nothing to be merged, got %d (%v) and %d items", n, err, src.Length())
+	}
+}
@@ -0,0 +1,234 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// metaKey is the key holding the positions of a stack, so it can be
+// opened without scanning its items, or a marker telling that a priority
+// queue keeps the positions of its priority levels under levelMetaPrefix.
+// Its second byte is not prefixSep, so it can never collide with the
+// key of an item in any priority level, and it is longer than the key of
+// a stack item.
+//
+// The positions are written in the same batch as the items they
+// describe, so they match them even after a crash. Only if they are
+// missing, or don't match the items found, the next open scans the
+// items instead.
+var metaKey = []byte("goque:meta")
+
+// levelMetaPrefix is the prefix of the keys holding the positions of the
+// priority levels of a priority queue that contain items, followed by
+// the priority.
+var levelMetaPrefix = []byte("goque:meta:")
+
+// goquePrefix is the prefix of every key Goque keeps in a stack or queue
+// besides the items. Such keys sort after the keys of the items.
+var goquePrefix = []byte("goque:")
+
+// The versions of the persisted positions. Stacks store metaV1 along
+// with their positions, and priority queues store metaV2 once they keep
+// the positions of their priority levels.
+const (
+	metaV1 byte = 1
+	metaV2 byte = 2
+)
+
+// levelMetaKey returns the key holding the positions of the given
+// priority level.
+func levelMetaKey(priority uint8) []byte {
+	return append(append([]byte(nil), levelMetaPrefix...), priority)
+}
+
+// putLevelMeta adds the given positions of a priority level to the
+// batch, or their deletion if the level is empty, so they are written
+// along with the items.
+func putLevelMeta(batch *leveldb.Batch, priority uint8, level priorityLevel) {
+	// head + tail = 8 + 8
+	if level.head >= level.tail {
+		batch.Delete(levelMetaKey(priority))
+		return
+	}
+	batch.Put(levelMetaKey(priority), append(idToKey(level.head), idToKey(level.tail)...))
+}
+
+// putLevelsMeta adds the positions of the priority levels of the given
+// items to the batch, as apply leaves them when called with the ID of
+// each item in turn. The caller must hold the lock.
+func (pq *PriorityQueue) putLevelsMeta(batch *leveldb.Batch, items []*PriorityItem, apply func(pl *priorityLevel, id uint64) priorityLevel) {
+	var levels [256]*priorityLevel
+	for _, item := range items {
+		level := levels[item.Priority]
+		if level == nil {
+			next := *pq.levels[item.Priority]
+			level = &next
+			levels[item.Priority] = level
+		}
+		*level = apply(level, item.ID)
+	}
+
+	for i, level := range levels {
+		if level != nil {
+			putLevelMeta(batch, uint8(i), *level)
+		}
+	}
+}
+
+// saveMeta persists the positions of every priority level, along with
+// the marker telling they are kept from now on. The caller must hold the
+// lock.
+func (pq *PriorityQueue) saveMeta() error {
+	batch := new(leveldb.Batch)
+	for i, level := range pq.levels {
+		putLevelMeta(batch, uint8(i), *level)
+	}
+	batch.Put(metaKey, []byte{metaV2})
+
+	return pq.db.Write(batch, pq.wo)
+}
+
+// loadMeta sets the positions of the priority levels to the persisted
+// ones. It returns false if there are none, or if they don't match the
+// items in the store.
+func (pq *PriorityQueue) loadMeta() (bool, error) {
+	data, err := pq.db.Get(metaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else if len(data) != 1 || data[0] != metaV2 {
+		return false, nil
+	}
+
+	var levels [256]*priorityLevel
+	iter := pq.db.NewIterator(util.BytesPrefix(levelMetaPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if len(key) != len(levelMetaPrefix)+1 || len(value) != 16 {
+			return false, nil
+		}
+
+		priority := key[len(levelMetaPrefix)]
+		level := &priorityLevel{head: keyToID(value[:8]), tail: keyToID(value[8:])}
+		if level.head >= level.tail {
+			return false, nil
+		}
+
+		// Check that both ends of the level are where they were left.
+		ok, err := checkEnds(pq.db,
+			pq.generateKey(priority, level.head+1),
+			pq.generateKey(priority, level.tail),
+			pq.generateKey(priority, level.tail+1))
+		if err != nil || !ok {
+			return false, err
+		}
+		levels[priority] = level
+	}
+	if err := iter.Error(); err != nil {
+		return false, err
+	}
+
+	for i, level := range levels {
+		if level == nil {
+			level = &priorityLevel{}
+		} else if pq.cmpAsc(uint8(i)) || pq.cmpDesc(uint8(i)) {
+			// Since this priority level has item(s), handle updating curLevel.
+			pq.curLevel = uint8(i)
+		}
+
+		pq.levels[i] = level
+		pq.updateActive(uint8(i))
+	}
+
+	return true, nil
+}
+
+// putMeta adds the given positions of the stack to the batch, so they
+// are written along with the items.
+func (s *Stack) putMeta(batch *leveldb.Batch, head, tail uint64) {
+	// version + head + tail = 1 + 8 + 8
+	data := []byte{metaV1}
+	data = append(data, idToKey(head)...)
+	data = append(data, idToKey(tail)...)
+	batch.Put(metaKey, data)
+}
+
+// writeMeta writes the batch along with the given positions of the
+// stack. The caller must hold the lock.
+func (s *Stack) writeMeta(batch *leveldb.Batch, head, tail uint64) error {
+	s.putMeta(batch, head, tail)
+	return s.db.Write(batch, s.wo)
+}
+
+// loadMeta sets the positions of the stack to the persisted ones. It
+// returns false if there are none, or if they don't match the items in
+// the store.
+func (s *Stack) loadMeta() (bool, error) {
+	data, err := s.db.Get(metaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if len(data) != 17 || data[0] != metaV1 {
+		return false, nil
+	}
+
+	head, tail := keyToID(data[1:9]), keyToID(data[9:17])
+	if head < tail {
+		return false, nil
+	} else if head > tail {
+		// Check that both ends of the stack are where they were left.
+		ok, err := checkEnds(s.db, idToKey(tail+1), idToKey(head), idToKey(head+1))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	s.head, s.tail = head, tail
+
+	return true, nil
+}
+
+// takeMeta returns the persisted positions in the store, if any, and
+// deletes them.
+func takeMeta(db Store, wo *opt.WriteOptions) ([]byte, error) {
+	data, err := db.Get(metaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = db.Delete(metaKey, wo); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// checkEnds reports whether the first and last keys of a range of items
+// are in the store, and the key following the last one is not.
+func checkEnds(db Store, first, last, next []byte) (bool, error) {
+	for _, key := range [][]byte{first, last} {
+		if ok, err := hasKey(db, key); err != nil || !ok {
+			return false, err
+		}
+	}
+
+	ok, err := hasKey(db, next)
+	return err == nil && !ok, err
+}
+
+// hasKey reports whether the given key is in the store.
+func hasKey(db Store, key []byte) (bool, error) {
+	_, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
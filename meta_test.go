@@ -0,0 +1,333 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestPriorityQueueMeta(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%3))); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Close the database without closing the priority queue, as a crash
+	// would, then reopen it, which should use the persisted positions.
+	pq.db.Close()
+	l := &testLogger{}
+	SetLogger(l, 0)
+	defer SetLogger(nil, 0)
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if l.has("goque: Rebuilt the positions of a priority queue") {
+		t.Error("Expected the persisted positions to be used")
+	}
+	if pq.Length() != 8 {
+		t.Errorf("Expected queue length of 8, got %d", pq.Length())
+	}
+	if pq.levels[0].head != 2 || pq.levels[0].tail != 3 {
+		t.Errorf("Expected head 2 and tail 3 for priority 0, got %d and %d", pq.levels[0].head, pq.levels[0].tail)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 9" {
+		t.Errorf("Expected string to be 'value for item 9', got '%s'", item.ToString())
+	}
+}
+
+func TestPriorityQueueMetaInconsistent(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 1)); err != nil {
+			t.Error(err)
+		}
+	}
+	pq.Close()
+
+	// Persist positions that don't match the items.
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(levelMetaKey(1), append(idToKey(0), idToKey(5)...), nil); err != nil {
+		t.Error(err)
+	}
+	db.Close()
+
+	// Reopen the priority queue, which should scan the items instead.
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+	if pq.levels[1].tail != 3 {
+		t.Errorf("Expected tail 3 for priority 1, got %d", pq.levels[1].tail)
+	}
+
+	// The positions found are persisted again.
+	data, err := pq.db.Get(levelMetaKey(1), nil)
+	if err != nil || len(data) != 16 || keyToID(data[8:]) != 3 {
+		t.Errorf("Expected tail 3 to be persisted for priority 1, got %v and %v", data, err)
+	}
+}
+
+func TestPriorityQueueMetaWrites(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	// Change the positions of the priority levels in every way.
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%3))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = pq.EnqueueBatch([]*PriorityItem{NewPriorityItemString("value", 3), NewPriorityItemString("value", 4)}); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.RemoveByPriorityID(1, 2); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.RemoveByPriorityID(2, 3); err != nil {
+		t.Error(err)
+	}
+	item, err := pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.UpdatePriority(item, 5); err != nil {
+		t.Error(err)
+	}
+	_, token, err := pq.DequeueWithLease(time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+	if err = pq.Nack(token); err != nil {
+		t.Error(err)
+	}
+	if err = pq.ClearPriority(4); err != nil {
+		t.Error(err)
+	}
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Enqueue(NewPriorityItemString("value", 6)); err != nil {
+		t.Error(err)
+	}
+	if _, err = tx.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	var want [256]priorityLevel
+	for i, level := range pq.levels {
+		want[i] = *level
+	}
+	length := pq.Length()
+
+	// Reopen the priority queue after a crash, which should find the
+	// same positions without scanning.
+	pq.db.Close()
+	l := &testLogger{}
+	SetLogger(l, 0)
+	defer SetLogger(nil, 0)
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.has("goque: Rebuilt the positions of a priority queue") {
+		t.Error("Expected the persisted positions to be used")
+	}
+	if pq.Length() != length {
+		t.Errorf("Expected queue length of %d, got %d", length, pq.Length())
+	}
+	for i, level := range pq.levels {
+		if want[i].length() == 0 {
+			if level.length() != 0 {
+				t.Errorf("Expected priority %d to be empty, got length %d", i, level.length())
+			}
+		} else if level.head != want[i].head || level.tail != want[i].tail {
+			t.Errorf("Expected head %d and tail %d for priority %d, got %d and %d", want[i].head, want[i].tail, i, level.head, level.tail)
+		}
+	}
+}
+
+func TestStackMeta(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.RemoveByID(5); err != nil {
+		t.Error(err)
+	}
+
+	// Close the database without closing the stack, as a crash would,
+	// then reopen it, which should use the persisted positions.
+	s.db.Close()
+	l := &testLogger{}
+	SetLogger(l, 0)
+	defer SetLogger(nil, 0)
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if l.has("goque: Rebuilt the positions of a stack") {
+		t.Error("Expected the persisted positions to be used")
+	}
+	if s.head != 9 || s.tail != 0 || s.Length() != 8 {
+		t.Errorf("Expected head 9, tail 0 and length 8, got %d, %d and %d", s.head, s.tail, s.Length())
+	}
+
+	// Without persisted positions, the stack is scanned, passing the
+	// tombstone kept after the items.
+	s.Close()
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get(metaKey, nil); err != nil {
+		t.Errorf("Expected the positions to be persisted, got %v", err)
+	}
+	if err = db.Delete(metaKey, nil); err != nil {
+		t.Error(err)
+	}
+	db.Close()
+
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if s.head != 9 || s.tail != 0 || s.Length() != 8 {
+		t.Errorf("Expected head 9, tail 0 and length 8, got %d, %d and %d", s.head, s.tail, s.Length())
+	}
+}
+
+func TestStackMetaWrites(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	// Change the positions of the stack in every way.
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = s.PushBatch([]*Item{NewItemString("value"), NewItemString("value")}); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+	for _, id := range []uint64{1, 3, 6} {
+		if _, err = s.RemoveByID(id); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = s.Requeue(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+	head, tail, length := s.head, s.tail, s.Length()
+
+	// Reopen the stack after a crash, which should find the same
+	// positions without scanning.
+	s.db.Close()
+	l := &testLogger{}
+	SetLogger(l, 0)
+	defer SetLogger(nil, 0)
+	if s, err = OpenStack(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.has("goque: Rebuilt the positions of a stack") {
+		t.Error("Expected the persisted positions to be used")
+	}
+	if s.head != head || s.tail != tail || s.Length() != length {
+		t.Errorf("Expected head %d, tail %d and length %d, got %d, %d and %d", head, tail, length, s.head, s.tail, s.Length())
+	}
+}
+
+func TestStackMetaQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	s.Close()
+
+	// A queue opening the same data directory discards the positions
+	// of the stack, as it changes them.
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if q.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", q.Length())
+	}
+	if _, err = q.db.Get(metaKey, nil); err != leveldb.ErrNotFound {
+		t.Errorf("Expected the persisted positions to be deleted, got %v", err)
+	}
+}
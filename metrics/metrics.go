@@ -0,0 +1,176 @@
+// Package metrics provides a Prometheus collector exporting the stats of
+// Goque priority queues and stacks.
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrRegistered is returned when registering a source under a name
+// that is already taken.
+var ErrRegistered = errors.New("metrics: Name is already registered")
+
+// Source is a data structure whose stats are exported, such as a
+// *goque.PriorityQueue or *goque.Stack.
+type Source interface {
+	Stats() (*goque.Stats, error)
+}
+
+// Collector is a prometheus.Collector exporting the stats of every
+// registered source, labeled with the name it was registered under.
+// Closed sources are skipped.
+type Collector struct {
+	mu      sync.RWMutex
+	sources map[string]Source
+
+	items           *prometheus.Desc
+	priorityItems   *prometheus.Desc
+	enqueued        *prometheus.Desc
+	dequeued        *prometheus.Desc
+	trimmed         *prometheus.Desc
+	dequeueDuration *prometheus.Desc
+	headAge         *prometheus.Desc
+	diskUsage       *prometheus.Desc
+	levelSize       *prometheus.Desc
+	levelTables     *prometheus.Desc
+	compactionRead  *prometheus.Desc
+	compactionWrite *prometheus.Desc
+	compactionTime  *prometheus.Desc
+	writeDelays     *prometheus.Desc
+	writeDelayTime  *prometheus.Desc
+}
+
+// NewCollector returns a collector without any sources.
+func NewCollector() *Collector {
+	queue := []string{"queue"}
+	priority := []string{"queue", "priority"}
+	level := []string{"queue", "level"}
+
+	return &Collector{
+		sources: make(map[string]Source),
+
+		items:           desc("items", "Number of items.", queue),
+		priorityItems:   desc("priority_items", "Number of items in each priority level.", priority),
+		enqueued:        desc("enqueued_items_total", "Number of items added.", queue),
+		dequeued:        desc("dequeued_items_total", "Number of items dequeued.", queue),
+		trimmed:         desc("trimmed_items_total", "Number of items discarded by the retention policy.", queue),
+		dequeueDuration: desc("dequeue_duration_seconds", "Time taken by calls to dequeue an item.", queue),
+		headAge:         desc("head_age_seconds", "Age of the item that would be dequeued next.", queue),
+		diskUsage:       desc("disk_usage_bytes", "Approximate on-disk size of the store.", queue),
+		levelSize:       desc("leveldb_level_size_bytes", "Size of the tables in each LevelDB level.", level),
+		levelTables:     desc("leveldb_level_tables", "Number of tables in each LevelDB level.", level),
+		compactionRead:  desc("leveldb_compaction_read_bytes_total", "Bytes read by compactions into each LevelDB level.", level),
+		compactionWrite: desc("leveldb_compaction_written_bytes_total", "Bytes written by compactions into each LevelDB level.", level),
+		compactionTime:  desc("leveldb_compaction_duration_seconds_total", "Time spent compacting into each LevelDB level.", level),
+		writeDelays:     desc("leveldb_write_delays_total", "Number of writes delayed by compaction.", queue),
+		writeDelayTime:  desc("leveldb_write_delay_seconds_total", "Time writes were delayed by compaction.", queue),
+	}
+}
+
+// desc returns the description of a metric of the given name in the
+// goque namespace.
+func desc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName("goque", "", name), help, labels, nil)
+}
+
+// Register adds a source whose stats are exported with the given name
+// as the queue label.
+func (c *Collector) Register(name string, s Source) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.sources[name]; ok {
+		return ErrRegistered
+	}
+	c.sources[name] = s
+
+	return nil
+}
+
+// Unregister removes the source registered with the given name, if any.
+func (c *Collector) Unregister(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sources, name)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.items, c.priorityItems, c.enqueued, c.dequeued, c.trimmed, c.dequeueDuration,
+		c.headAge, c.diskUsage, c.levelSize, c.levelTables, c.compactionRead,
+		c.compactionWrite, c.compactionTime, c.writeDelays, c.writeDelayTime,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	for name, s := range c.sources {
+		stats, err := s.Stats()
+		if err == goque.ErrDBClosed {
+			continue
+		} else if err != nil {
+			ch <- prometheus.NewInvalidMetric(c.items, err)
+			continue
+		}
+
+		c.collect(ch, name, stats, now)
+	}
+}
+
+// collect sends the metrics of the given stats.
+func (c *Collector) collect(ch chan<- prometheus.Metric, name string, stats *goque.Stats, now time.Time) {
+	gauge := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, append([]string{name}, labels...)...)
+	}
+	counter := func(d *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, append([]string{name}, labels...)...)
+	}
+
+	gauge(c.items, float64(stats.Length))
+	for _, level := range stats.Levels {
+		gauge(c.priorityItems, float64(level.Length), strconv.Itoa(int(level.Priority)))
+	}
+
+	counter(c.enqueued, float64(stats.Counters.Enqueued))
+	counter(c.dequeued, float64(stats.Counters.Dequeued))
+	counter(c.trimmed, float64(stats.Counters.Trimmed))
+	ch <- prometheus.MustNewConstSummary(c.dequeueDuration, stats.Counters.Dequeues,
+		stats.Counters.DequeueTime.Seconds(), nil, name)
+
+	if !stats.Next.IsZero() {
+		gauge(c.headAge, now.Sub(stats.Next).Seconds())
+	}
+	if stats.DiskUsage >= 0 {
+		gauge(c.diskUsage, float64(stats.DiskUsage))
+	}
+
+	ldb := stats.LevelDB
+	if ldb == nil {
+		return
+	}
+
+	for i := range ldb.LevelSizes {
+		level := strconv.Itoa(i)
+		gauge(c.levelSize, float64(ldb.LevelSizes[i]), level)
+		gauge(c.levelTables, float64(ldb.LevelTablesCounts[i]), level)
+		counter(c.compactionRead, float64(ldb.LevelRead[i]), level)
+		counter(c.compactionWrite, float64(ldb.LevelWrite[i]), level)
+		counter(c.compactionTime, ldb.LevelDurations[i].Seconds(), level)
+	}
+	counter(c.writeDelays, float64(ldb.WriteDelayCount))
+	counter(c.writeDelayTime, ldb.WriteDelayDuration.Seconds())
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the metrics of the given collector by name.
+func gather(t *testing.T, c *Collector) map[string]*dto.MetricFamily {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		m[f.GetName()] = f
+	}
+
+	return m
+}
+
+func TestCollectorPriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(goque.NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	c := NewCollector()
+	if err = c.Register("jobs", pq); err != nil {
+		t.Error(err)
+	}
+	if err = c.Register("jobs", pq); err != ErrRegistered {
+		t.Errorf("Expected to get registered error, got %v", err)
+	}
+
+	m := gather(t, c)
+	if v := m["goque_items"].GetMetric()[0].GetGauge().GetValue(); v != 7 {
+		t.Errorf("Expected 7 items, got %v", v)
+	}
+	if n := len(m["goque_priority_items"].GetMetric()); n != 2 {
+		t.Errorf("Expected 2 priority levels, got %d", n)
+	}
+	if v := m["goque_enqueued_items_total"].GetMetric()[0].GetCounter().GetValue(); v != 10 {
+		t.Errorf("Expected 10 enqueued items, got %v", v)
+	}
+	if v := m["goque_dequeued_items_total"].GetMetric()[0].GetCounter().GetValue(); v != 3 {
+		t.Errorf("Expected 3 dequeued items, got %v", v)
+	}
+	if v := m["goque_dequeue_duration_seconds"].GetMetric()[0].GetSummary().GetSampleCount(); v != 3 {
+		t.Errorf("Expected 3 timed dequeues, got %v", v)
+	}
+	if v := m["goque_head_age_seconds"].GetMetric()[0].GetGauge().GetValue(); v <= 0 {
+		t.Errorf("Expected a head age above 0, got %v", v)
+	}
+	if _, ok := m["goque_leveldb_write_delays_total"]; !ok {
+		t.Error("Expected LevelDB metrics")
+	}
+	if l := m["goque_items"].GetMetric()[0].GetLabel()[0]; l.GetName() != "queue" || l.GetValue() != "jobs" {
+		t.Errorf("Expected label queue=jobs, got %s=%s", l.GetName(), l.GetValue())
+	}
+
+	// A closed priority queue is skipped.
+	pq.Close()
+	if m = gather(t, c); len(m) != 0 {
+		t.Errorf("Expected no metrics, got %d", len(m))
+	}
+}
+
+func TestCollectorStack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(goque.NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	c := NewCollector()
+	if err = c.Register("stack", s); err != nil {
+		t.Error(err)
+	}
+
+	m := gather(t, c)
+	if v := m["goque_items"].GetMetric()[0].GetGauge().GetValue(); v != 5 {
+		t.Errorf("Expected 5 items, got %v", v)
+	}
+	if _, ok := m["goque_priority_items"]; ok {
+		t.Error("Expected no priority levels for a stack")
+	}
+
+	c.Unregister("stack")
+	if m = gather(t, c); len(m) != 0 {
+		t.Errorf("Expected no metrics, got %d", len(m))
+	}
+}
@@ -0,0 +1,106 @@
+package goque
+
+// ItemMiddleware transforms the values of items on their way to and
+// from storage, such as to validate, compress or encrypt them. It works
+// on the value alone, below the headers and the other metadata of the
+// item, and the item in memory keeps its original value.
+//
+// Write is called every time a value of an item is stored, which
+// includes moving the item into a lease, requeueing it and recording it
+// in the change log, so it may see a value more than once. Read is
+// called every time a stored value is read back. Both may be called
+// concurrently, and must undo each other.
+type ItemMiddleware interface {
+	// Write returns the value to store for the item with the given key.
+	// Returning an error fails the write.
+	Write(key, value []byte) ([]byte, error)
+
+	// Read returns the value of the item with the given key from the
+	// stored one, which it may modify.
+	Read(key, value []byte) ([]byte, error)
+}
+
+// MiddlewareFuncs is an ItemMiddleware calling the given functions. A
+// nil function passes values through as they are, so validation only
+// needs OnWrite.
+type MiddlewareFuncs struct {
+	OnWrite func(key, value []byte) ([]byte, error)
+	OnRead  func(key, value []byte) ([]byte, error)
+}
+
+// Write calls OnWrite, if set.
+func (m MiddlewareFuncs) Write(key, value []byte) ([]byte, error) {
+	if m.OnWrite == nil {
+		return value, nil
+	}
+
+	return m.OnWrite(key, value)
+}
+
+// Read calls OnRead, if set.
+func (m MiddlewareFuncs) Read(key, value []byte) ([]byte, error) {
+	if m.OnRead == nil {
+		return value, nil
+	}
+
+	return m.OnRead(key, value)
+}
+
+// SetMiddleware sets the middleware the values of the items of the
+// priority queue go through, replacing the ones set before. Values are
+// passed through the middleware in the given order when written, and in
+// the reverse order when read. No middleware stores values as they are.
+//
+// Middleware isn't persisted, and values stored through it can only be
+// read through it again, so SetMiddleware should be called right after
+// every open, before any item is read or written.
+func (pq *PriorityQueue) SetMiddleware(mw ...ItemMiddleware) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.seal.middleware = mw
+}
+
+// SetMiddleware sets the middleware the values of the items of the
+// stack go through, the same way as PriorityQueue.SetMiddleware.
+func (s *Stack) SetMiddleware(mw ...ItemMiddleware) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seal.middleware = mw
+}
+
+// SetMiddleware sets the middleware the values of the items of the
+// queue go through, the same way as PriorityQueue.SetMiddleware.
+func (q *Queue) SetMiddleware(mw ...ItemMiddleware) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.seal.middleware = mw
+}
+
+// write passes the value of the item with the given key through the
+// middleware, in order.
+func (v valueSeal) write(key, value []byte) ([]byte, error) {
+	for _, mw := range v.middleware {
+		var err error
+		if value, err = mw.Write(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// read passes the stored value of the item with the given key through
+// the middleware, in the reverse order.
+func (v valueSeal) read(key, value []byte) ([]byte, error) {
+	for i := len(v.middleware) - 1; i >= 0; i-- {
+		var err error
+		if value, err = v.middleware[i].Read(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
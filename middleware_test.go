@@ -0,0 +1,119 @@
+package goque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// prefixMiddleware prepends its prefix to the values it writes.
+type prefixMiddleware struct {
+	prefix string
+}
+
+func (m prefixMiddleware) Write(key, value []byte) ([]byte, error) {
+	return append([]byte(m.prefix), value...), nil
+}
+
+func (m prefixMiddleware) Read(key, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, []byte(m.prefix)) {
+		return nil, fmt.Errorf("missing prefix %q", m.prefix)
+	}
+	return value[len(m.prefix):], nil
+}
+
+func TestPriorityQueueMiddleware(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	errEmpty := errors.New("empty value")
+	validate := MiddlewareFuncs{OnWrite: func(key, value []byte) ([]byte, error) {
+		if len(value) == 0 {
+			return nil, errEmpty
+		}
+		return value, nil
+	}}
+	pq.SetMiddleware(validate, prefixMiddleware{"a:"}, prefixMiddleware{"b:"})
+
+	if _, err = pq.EnqueueString(0, ""); err != errEmpty {
+		t.Errorf("Expected the empty value to be rejected, got %v", err)
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	item, err := pq.EnqueueString(0, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected the item to keep its value, got '%s'", item.ToString())
+	}
+
+	// The middleware is applied in order.
+	data, err := pq.db.Get(item.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("b:a:value")) {
+		t.Errorf("Expected the stored value to end with 'b:a:value', got %q", data)
+	}
+
+	// Items in flight go through it as well.
+	_, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pq.Release(token); err != nil {
+		t.Fatal(err)
+	}
+	if item, err = pq.Peek(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected 'value', got '%s'", item.ToString())
+	}
+
+	// Without the middleware, the stored value is read as is.
+	pq.SetMiddleware()
+	if item, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "b:a:value" {
+		t.Errorf("Expected 'b:a:value', got '%s'", item.ToString())
+	}
+}
+
+func TestStackMiddleware(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	s.SetMiddleware(prefixMiddleware{"x:"})
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetMiddleware(prefixMiddleware{"y:"})
+	if _, err = s.Peek(); err == nil {
+		t.Error("Expected the middleware to fail reading the value")
+	}
+
+	s.SetMiddleware(prefixMiddleware{"x:"})
+	item, err := s.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected 'value', got '%s'", item.ToString())
+	}
+}
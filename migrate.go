@@ -0,0 +1,95 @@
+package goque
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// migration upgrades the store of a data directory of the given Goque
+// type, with item values in the given format, from one layout version
+// to the next, returning the format of the item values afterwards. It
+// must leave the store valid for the next layout even if it was
+// interrupted and is run again, such as by writing all its changes in a
+// single batch.
+type migration func(db Store, gt goqueType, format uint8) (uint8, error)
+
+// migrations upgrade data directories to the current layout version,
+// the one at index i upgrading layout i+1 to layout i+2. A change to
+// the keys or the encoding of the items stored by any data structure
+// appends a migration, which makes it the current layout.
+var migrations []migration
+
+// currentLayout returns the layout version of the keys and values
+// written by this version of Goque. Data directories created before the
+// layout was recorded use layout 1.
+func currentLayout() uint8 {
+	return uint8(len(migrations)) + 1
+}
+
+// migrate upgrades the data directory, whose store is db, to the
+// current layout version, running the migrations from its layout on in
+// order. The layout is recorded in the 'GOQUE' file after each of them,
+// so an upgrade that failed or was interrupted picks up where it
+// stopped on the next open.
+//
+// If the data directory uses a layout newer than this version of Goque
+// knows, ErrUnsupportedFormat is returned.
+func migrate(dataDir string, db Store, gt goqueType) error {
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if err != nil {
+		return err
+	}
+
+	// Data directories created before the format and the layout were
+	// recorded use formatRaw and layout 1.
+	marker := make([]byte, 3)
+	copy(marker, data)
+	if len(data) < 3 {
+		marker[2] = 1
+	}
+
+	if marker[2] == 0 || marker[2] > currentLayout() {
+		return ErrUnsupportedFormat
+	}
+
+	for marker[2] < currentLayout() {
+		format, err := migrations[marker[2]-1](db, gt, marker[1])
+		if err != nil {
+			return err
+		}
+
+		marker[1] = format
+		marker[2]++
+		if err = writeMarker(dataDir, marker); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMarker replaces the 'GOQUE' file of the data directory with the
+// given contents, writing them to a temporary file first so the file is
+// never left half written.
+func writeMarker(dataDir string, marker []byte) error {
+	path := filepath.Join(dataDir, "GOQUE")
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(marker); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,178 @@
+package goque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pq.Close()
+
+	marker, err := ioutil.ReadFile(filepath.Join(file, "GOQUE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := currentLayout()
+	if want := []byte{byte(goquePriorityQueue), formatEnvelope, layout}; !bytes.Equal(marker, want) {
+		t.Errorf("Expected 'GOQUE' file %v, got %v", want, marker)
+	}
+
+	// Add a migration to the next layout.
+	defer func(saved []migration) { migrations = saved }(migrations)
+	var runs int
+	migrations = append(migrations, func(db Store, gt goqueType, format uint8) (uint8, error) {
+		runs++
+		if gt != goquePriorityQueue || format != formatEnvelope {
+			t.Errorf("Expected a priority queue with enveloped values, got type %d and format %d", gt, format)
+		}
+		return format, nil
+	})
+
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("Expected the migration to run once, ran %d times", runs)
+	}
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	// A migrated data directory isn't migrated again.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("Expected the migration to run once, ran %d times", runs)
+	}
+	pq.Close()
+
+	marker, err = ioutil.ReadFile(filepath.Join(file, "GOQUE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{byte(goquePriorityQueue), formatEnvelope, layout + 1}; !bytes.Equal(marker, want) {
+		t.Errorf("Expected 'GOQUE' file %v, got %v", want, marker)
+	}
+}
+
+func TestMigrateOldFormat(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+
+	// Create a data directory the way older versions of Goque did.
+	if err := os.MkdirAll(file, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(goqueQueue)}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the migrations with one from layout 1 to 2, switching the
+	// values to envelopes.
+	defer func(saved []migration) { migrations = saved }(migrations)
+	migrations = []migration{func(db Store, gt goqueType, format uint8) (uint8, error) {
+		if format != formatRaw {
+			t.Errorf("Expected raw values, got format %d", format)
+		}
+		return formatEnvelope, nil
+	}}
+
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if q.format != formatEnvelope {
+		t.Errorf("Expected the migrated format to be used, got %d", q.format)
+	}
+
+	marker, err := ioutil.ReadFile(filepath.Join(file, "GOQUE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{byte(goqueQueue), formatEnvelope, 2}; !bytes.Equal(marker, want) {
+		t.Errorf("Expected 'GOQUE' file %v, got %v", want, marker)
+	}
+}
+
+func TestMigrateFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+	s.Close()
+
+	defer func(saved []migration) { migrations = saved }(migrations)
+	errMigration := errors.New("migration failed")
+	fail := true
+	migrations = append(migrations, func(db Store, gt goqueType, format uint8) (uint8, error) {
+		if fail {
+			return format, errMigration
+		}
+		return format, nil
+	})
+
+	s, err = OpenStack(file)
+	if err != errMigration {
+		t.Errorf("Expected the migration error, got %v", err)
+	}
+	s.db.Close()
+
+	marker, err := ioutil.ReadFile(filepath.Join(file, "GOQUE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker[2] != currentLayout()-1 {
+		t.Errorf("Expected layout %d to be kept, got %d", currentLayout()-1, marker[2])
+	}
+
+	// The next open runs the migration again.
+	fail = false
+	if s, err = OpenStack(file); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
+
+func TestMigrateNewerLayout(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(file)
+	pq.Close()
+
+	marker := []byte{byte(goquePriorityQueue), formatEnvelope, currentLayout() + 1}
+	if err = ioutil.WriteFile(filepath.Join(file, "GOQUE"), marker, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+	pq.db.Close()
+}
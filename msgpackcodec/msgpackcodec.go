@@ -0,0 +1,20 @@
+// Package msgpackcodec provides a goque.Codec using MessagePack.
+package msgpackcodec
+
+import (
+	"github.com/shamaton/msgpack/v2"
+)
+
+// Codec is a goque.Codec using MessagePack.
+type Codec struct{}
+
+// Marshal encodes the given value using MessagePack.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal decodes the given data into the value pointed to by v using
+// MessagePack.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
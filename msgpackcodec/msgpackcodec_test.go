@@ -0,0 +1,43 @@
+package msgpackcodec
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+type object struct {
+	Name  string
+	Count int
+}
+
+var _ goque.Codec = Codec{}
+
+func TestCodec(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if _, err = s.PushObjectWithCodec(object{Name: "value", Count: 3}, Codec{}); err != nil {
+		t.Error(err)
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj object
+	if err = item.ToObjectWithCodec(&obj, Codec{}); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Name != "value" || obj.Count != 3 {
+		t.Errorf("Expected object to be {value 3}, got %v", obj)
+	}
+}
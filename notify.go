@@ -0,0 +1,127 @@
+package goque
+
+// notifier holds the channels signaled when a priority queue, or one of
+// its priority levels, stops being empty. It is protected by the lock of
+// the priority queue it belongs to.
+type notifier struct {
+	all    []chan struct{}
+	levels map[uint8][]chan struct{}
+}
+
+// Notify returns a channel that receives a signal whenever an item is
+// added to the priority queue while it is empty, so an idle consumer can
+// wait for it instead of polling Length. Signals are not queued: if one
+// was not received yet, the next one is dropped, so the consumer should
+// dequeue until the priority queue is empty before waiting again.
+//
+// Each call returns a new channel, which is closed when the priority
+// queue is closed or the channel is passed to StopNotify. A channel
+// returned by a closed priority queue is already closed.
+func (pq *PriorityQueue) Notify() <-chan struct{} {
+	pq.Lock()
+	defer pq.Unlock()
+
+	ch := make(chan struct{}, 1)
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		close(ch)
+		return ch
+	}
+
+	pq.notify.all = append(pq.notify.all, ch)
+	return ch
+}
+
+// NotifyPriority is like Notify, but signals whenever an item is added to
+// the given priority level while it is empty.
+func (pq *PriorityQueue) NotifyPriority(priority uint8) <-chan struct{} {
+	pq.Lock()
+	defer pq.Unlock()
+
+	ch := make(chan struct{}, 1)
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		close(ch)
+		return ch
+	}
+
+	if pq.notify.levels == nil {
+		pq.notify.levels = make(map[uint8][]chan struct{})
+	}
+	pq.notify.levels[priority] = append(pq.notify.levels[priority], ch)
+	return ch
+}
+
+// StopNotify stops signaling and closes the given channel returned by
+// Notify or NotifyPriority. It does nothing if the channel was already
+// stopped.
+func (pq *PriorityQueue) StopNotify(ch <-chan struct{}) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.notify.all = stopNotify(pq.notify.all, ch)
+	for priority, chans := range pq.notify.levels {
+		if chans = stopNotify(chans, ch); len(chans) == 0 {
+			delete(pq.notify.levels, priority)
+		} else {
+			pq.notify.levels[priority] = chans
+		}
+	}
+}
+
+// stopNotify removes the given channel from chans and closes it.
+func stopNotify(chans []chan struct{}, ch <-chan struct{}) []chan struct{} {
+	for i, c := range chans {
+		if (<-chan struct{})(c) == ch {
+			close(c)
+			return append(chans[:i], chans[i+1:]...)
+		}
+	}
+
+	return chans
+}
+
+// added signals the channels of the priority queue and of the priority
+// levels that contain items now but didn't before.
+func (n *notifier) added(before, after levelSet) {
+	if before == (levelSet{}) && after != (levelSet{}) {
+		signal(n.all)
+	}
+
+	if len(n.levels) == 0 {
+		return
+	}
+	var added levelSet
+	for i := range added {
+		added[i] = after[i] &^ before[i]
+	}
+	for _, priority := range added.levels() {
+		signal(n.levels[priority])
+	}
+}
+
+// close closes every channel.
+func (n *notifier) close() {
+	for _, ch := range n.all {
+		close(ch)
+	}
+	for _, chans := range n.levels {
+		for _, ch := range chans {
+			close(ch)
+		}
+	}
+	n.all, n.levels = nil, nil
+}
+
+// signal sends a signal to each of the channels that doesn't already
+// hold one.
+func signal(chans []chan struct{}) {
+	for _, ch := range chans {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
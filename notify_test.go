@@ -0,0 +1,107 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// signaled reports whether the given channel holds a signal.
+func signaled(ch <-chan struct{}) bool {
+	select {
+	case _, ok := <-ch:
+		return ok
+	default:
+		return false
+	}
+}
+
+func TestPriorityQueueNotify(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	ch := pq.Notify()
+	level := pq.NotifyPriority(1)
+
+	// Adding to an empty priority queue signals once.
+	for i := 1; i <= 2; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+	if !signaled(ch) {
+		t.Error("Expected a signal")
+	}
+	if signaled(ch) || signaled(level) {
+		t.Error("Expected no more signals")
+	}
+
+	// Adding to an empty priority level signals its channel only.
+	if _, err = pq.EnqueueString(1, "value"); err != nil {
+		t.Error(err)
+	}
+	if signaled(ch) || !signaled(level) {
+		t.Error("Expected a signal for priority level 1 only")
+	}
+
+	// Emptying the priority queue and adding again signals again.
+	for i := 0; i < 3; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = pq.EnqueueBatch([]*PriorityItem{NewPriorityItemString("value", 1)}); err != nil {
+		t.Error(err)
+	}
+	if !signaled(ch) || !signaled(level) {
+		t.Error("Expected signals for the priority queue and level 1")
+	}
+
+	// A stopped channel is closed and no longer signaled.
+	pq.StopNotify(level)
+	if _, ok := <-level; ok {
+		t.Error("Expected the channel to be closed")
+	}
+
+	// Closing the priority queue closes the channels.
+	pq.Close()
+	if _, ok := <-ch; ok {
+		t.Error("Expected the channel to be closed")
+	}
+	if _, ok := <-pq.Notify(); ok {
+		t.Error("Expected a closed channel from a closed priority queue")
+	}
+}
+
+func TestPriorityQueueNotifyWait(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	ch := pq.Notify()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pq.EnqueueString(0, "value")
+	}()
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a signal within a second")
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value" {
+		t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+	}
+}
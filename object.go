@@ -0,0 +1,109 @@
+package goque
+
+// EnqueueObject is a helper function for Enqueue that accepts any
+// value type, which is then encoded into a byte slice using
+// encoding/gob.
+func (pq *PriorityQueue) EnqueueObject(value interface{}, priority uint8) (*PriorityItem, error) {
+	return pq.EnqueueObjectWithCodec(value, priority, GobCodec{})
+}
+
+// EnqueueObjectAsJSON is a helper function for Enqueue that accepts any
+// value type, which is then encoded into a JSON byte slice using
+// encoding/json.
+func (pq *PriorityQueue) EnqueueObjectAsJSON(value interface{}, priority uint8) (*PriorityItem, error) {
+	return pq.EnqueueObjectWithCodec(value, priority, JSONCodec{})
+}
+
+// EnqueueObjectWithCodec is a helper function for Enqueue that accepts
+// any value type, which is then encoded into a byte slice using the
+// given codec.
+func (pq *PriorityQueue) EnqueueObjectWithCodec(value interface{}, priority uint8, codec Codec) (*PriorityItem, error) {
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.EnqueueValue(priority, data)
+}
+
+// PushObject is a helper function for Push that accepts any value type,
+// which is then encoded into a byte slice using encoding/gob.
+func (s *Stack) PushObject(value interface{}) (*Item, error) {
+	return s.PushObjectWithCodec(value, GobCodec{})
+}
+
+// PushObjectAsJSON is a helper function for Push that accepts any value
+// type, which is then encoded into a JSON byte slice using
+// encoding/json.
+func (s *Stack) PushObjectAsJSON(value interface{}) (*Item, error) {
+	return s.PushObjectWithCodec(value, JSONCodec{})
+}
+
+// PushObjectWithCodec is a helper function for Push that accepts any
+// value type, which is then encoded into a byte slice using the given
+// codec.
+func (s *Stack) PushObjectWithCodec(value interface{}, codec Codec) (*Item, error) {
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	item := NewItem(data)
+	if err = s.Push(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ToObject decodes the item value into the given value type using
+// encoding/gob.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (i *Item) ToObject(value interface{}) error {
+	return GobCodec{}.Unmarshal(i.Value, value)
+}
+
+// ToObjectFromJSON decodes the item value into the given value type
+// using encoding/json.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (i *Item) ToObjectFromJSON(value interface{}) error {
+	return JSONCodec{}.Unmarshal(i.Value, value)
+}
+
+// ToObjectWithCodec decodes the item value into the given value type
+// using the given codec.
+func (i *Item) ToObjectWithCodec(value interface{}, codec Codec) error {
+	return codec.Unmarshal(i.Value, value)
+}
+
+// ToObject decodes the priority item value into the given value type
+// using encoding/gob.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (pi *PriorityItem) ToObject(value interface{}) error {
+	return GobCodec{}.Unmarshal(pi.Value, value)
+}
+
+// ToObjectFromJSON decodes the priority item value into the given value
+// type using encoding/json.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (pi *PriorityItem) ToObjectFromJSON(value interface{}) error {
+	return JSONCodec{}.Unmarshal(pi.Value, value)
+}
+
+// ToObjectWithCodec decodes the priority item value into the given
+// value type using the given codec.
+func (pi *PriorityItem) ToObjectWithCodec(value interface{}, codec Codec) error {
+	return codec.Unmarshal(pi.Value, value)
+}
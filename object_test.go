@@ -0,0 +1,112 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type object struct {
+	Name  string
+	Count int
+}
+
+func TestPriorityQueueEnqueueObject(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueObject(object{Name: "gob", Count: 1}, 1); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.EnqueueObjectAsJSON(object{Name: "json", Count: 2}, 0); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj object
+	if err = item.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Name != "json" || obj.Count != 2 {
+		t.Errorf("Expected object to be {json 2}, got %v", obj)
+	}
+
+	if item, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if err = item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Name != "gob" || obj.Count != 1 {
+		t.Errorf("Expected object to be {gob 1}, got %v", obj)
+	}
+
+	// A failed enqueue returns no item.
+	pq.Close()
+	if item, err = pq.EnqueueObject(object{Name: "gob", Count: 1}, 0); item != nil || err != ErrDBClosed {
+		t.Errorf("Expected no item and ErrDBClosed, got %v and %v", item, err)
+	}
+}
+
+func TestStackPushObject(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if _, err = s.PushObject(object{Name: "gob", Count: 1}); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.PushObjectAsJSON(object{Name: "json", Count: 2}); err != nil {
+		t.Error(err)
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj object
+	if err = item.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Name != "json" || obj.Count != 2 {
+		t.Errorf("Expected object to be {json 2}, got %v", obj)
+	}
+
+	if item, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	if err = item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Name != "gob" || obj.Count != 1 {
+		t.Errorf("Expected object to be {gob 1}, got %v", obj)
+	}
+
+	if _, err = s.PushObjectAsJSON(make(chan int)); err == nil {
+		t.Error("Expected an error encoding a channel")
+	}
+
+	// A failed push returns no item.
+	s.Close()
+	if item, err = s.PushObject(object{Name: "gob", Count: 1}); item != nil || err != ErrDBClosed {
+		t.Errorf("Expected no item and ErrDBClosed, got %v and %v", item, err)
+	}
+}
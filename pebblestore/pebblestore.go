@@ -0,0 +1,318 @@
+// Package pebblestore provides a goque.Store using Pebble, which holds
+// up better than LevelDB under heavy compaction.
+package pebblestore
+
+import (
+	"bytes"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store is a goque.Store using Pebble.
+type Store struct {
+	db *pebble.DB
+}
+
+// Open opens the Pebble database at the given directory, creating it
+// if it does not exist, using the default options.
+func Open(dir string) (*Store, error) {
+	return OpenWithOptions(dir, nil)
+}
+
+// OpenWithOptions opens the Pebble database at the given directory
+// using the given options.
+func OpenWithOptions(dir string, o *pebble.Options) (*Store, error) {
+	db, err := pebble.Open(dir, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(db), nil
+}
+
+// New returns a Store using the given Pebble database.
+func New(db *pebble.DB) *Store {
+	return &Store{db: db}
+}
+
+// DB returns the underlying Pebble database.
+func (s *Store) DB() *pebble.DB {
+	return s.db
+}
+
+// Get returns the value for the given key, or leveldb.ErrNotFound if
+// the key does not exist.
+func (s *Store) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	data, closer, err := s.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, leveldb.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	return append([]byte{}, data...), nil
+}
+
+// MultiGet returns the values for the given keys, read from a single
+// snapshot, with nil for any key that does not exist.
+func (s *Store) MultiGet(keys [][]byte) ([][]byte, error) {
+	snap := s.db.NewSnapshot()
+	defer snap.Close()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		data, closer, err := snap.Get(key)
+		if err == pebble.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		values[i] = append([]byte{}, data...)
+		closer.Close()
+	}
+
+	return values, nil
+}
+
+// Put sets the value for the given key.
+func (s *Store) Put(key, value []byte, wo *opt.WriteOptions) error {
+	return s.db.Set(key, value, writeOptions(wo))
+}
+
+// Delete deletes the value for the given key.
+func (s *Store) Delete(key []byte, wo *opt.WriteOptions) error {
+	return s.db.Delete(key, writeOptions(wo))
+}
+
+// Write applies the given batch atomically.
+func (s *Store) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	r := &replay{batch: s.db.NewBatch()}
+	defer r.batch.Close()
+
+	if err := batch.Replay(r); err != nil {
+		return err
+	} else if r.err != nil {
+		return r.err
+	}
+
+	return s.db.Apply(r.batch, writeOptions(wo))
+}
+
+// NewIterator returns an iterator over a snapshot of the keys in the
+// given range. A nil range iterates over every key.
+func (s *Store) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	o := &pebble.IterOptions{}
+	if slice != nil {
+		o.LowerBound = slice.Start
+		o.UpperBound = slice.Limit
+	}
+
+	pi, err := s.db.NewIter(o)
+	if err != nil {
+		return iterator.NewEmptyIterator(err)
+	}
+
+	return &iter{pi: pi, start: o.LowerBound}
+}
+
+// CompactRange compacts the keys in the given range. A nil Start or
+// Limit leaves that end of the range open.
+func (s *Store) CompactRange(r util.Range) error {
+	start, end := r.Start, r.Limit
+	if start == nil {
+		start = []byte{}
+	}
+
+	// Pebble needs an end to compact up to, so an open range ends right
+	// after the last key.
+	if end == nil {
+		pi, err := s.db.NewIter(&pebble.IterOptions{LowerBound: start})
+		if err != nil {
+			return err
+		}
+		if pi.Last() {
+			end = append(append([]byte{}, pi.Key()...), 0)
+		}
+		if err = pi.Close(); err != nil {
+			return err
+		}
+	}
+
+	if bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+
+	return s.db.Compact(start, end, true)
+}
+
+// Close closes the Pebble database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// writeOptions returns the Pebble write options for the given LevelDB
+// write options.
+func writeOptions(wo *opt.WriteOptions) *pebble.WriteOptions {
+	if wo.GetSync() {
+		return pebble.Sync
+	}
+	return pebble.NoSync
+}
+
+// replay applies the operations of a LevelDB batch to a Pebble batch,
+// keeping the first error.
+type replay struct {
+	batch *pebble.Batch
+	err   error
+}
+
+func (r *replay) Put(key, value []byte) {
+	if r.err == nil {
+		r.err = r.batch.Set(key, value, nil)
+	}
+}
+
+func (r *replay) Delete(key []byte) {
+	if r.err == nil {
+		r.err = r.batch.Delete(key, nil)
+	}
+}
+
+// The positions of an iterator.
+const (
+	posStart = iota // Before the first key.
+	posKey          // On a key.
+	posEnd          // After the last key.
+)
+
+// iter is a LevelDB iterator over a Pebble iterator. It tracks where
+// the iterator is, so that stepping from either end behaves like a
+// LevelDB iterator.
+type iter struct {
+	util.BasicReleaser
+	pi       *pebble.Iterator
+	start    []byte
+	pos      int
+	err      error
+	released bool
+}
+
+// moved records the result of moving the Pebble iterator. If it is no
+// longer on a key, it is past the end in the given direction.
+func (it *iter) moved(ok bool, end int) bool {
+	if ok {
+		it.pos = posKey
+		return true
+	}
+
+	it.pos = end
+	it.err = it.pi.Error()
+	return false
+}
+
+// usable reports whether the iterator can be moved.
+func (it *iter) usable() bool {
+	if it.released {
+		it.err = leveldb.ErrIterReleased
+	}
+	return it.err == nil
+}
+
+func (it *iter) First() bool {
+	if !it.usable() {
+		return false
+	}
+	return it.moved(it.pi.First(), posEnd)
+}
+
+func (it *iter) Last() bool {
+	if !it.usable() {
+		return false
+	}
+	return it.moved(it.pi.Last(), posStart)
+}
+
+func (it *iter) Seek(key []byte) bool {
+	if !it.usable() {
+		return false
+	}
+
+	if it.start != nil && bytes.Compare(key, it.start) < 0 {
+		key = it.start
+	}
+
+	return it.moved(it.pi.SeekGE(key), posEnd)
+}
+
+func (it *iter) Next() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return it.First()
+	case posEnd:
+		return false
+	}
+
+	return it.moved(it.pi.Next(), posEnd)
+}
+
+func (it *iter) Prev() bool {
+	if !it.usable() {
+		return false
+	}
+
+	switch it.pos {
+	case posStart:
+		return false
+	case posEnd:
+		return it.Last()
+	}
+
+	return it.moved(it.pi.Prev(), posStart)
+}
+
+func (it *iter) Valid() bool {
+	return it.pos == posKey && it.err == nil
+}
+
+func (it *iter) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.pi.Key()
+}
+
+func (it *iter) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.pi.Value()
+}
+
+func (it *iter) Error() error {
+	return it.err
+}
+
+// Release closes the Pebble iterator.
+func (it *iter) Release() {
+	if it.released {
+		return
+	}
+	it.released = true
+
+	if err := it.pi.Close(); err != nil && it.err == nil {
+		it.err = err
+	}
+	it.pos = posStart
+
+	it.BasicReleaser.Release()
+}
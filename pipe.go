@@ -0,0 +1,75 @@
+package goque
+
+import (
+	"context"
+	"time"
+)
+
+// pipeRetryInterval is how often an idle Pipe retries the source without
+// being signaled, so items whose lease expired are moved too.
+const pipeRetryInterval = time.Second
+
+// PipeFunc transforms an item moved by Pipe, returning the item to add
+// to the destination, or nil to drop it. It is given a copy of the item,
+// which it may modify and return, such as to change its priority,
+// re-encode its value or update its headers. Returning an error puts the
+// item back in the source.
+type PipeFunc func(item *PriorityItem) (*PriorityItem, error)
+
+// Pipe keeps moving the items of the source priority queue to the
+// destination, such as another priority queue, a queue or a stack, in
+// dequeue order, adding to it the item returned by fn for each, or the
+// item as it is if fn is nil. Once the source is empty, it waits for new
+// items.
+//
+// Each item is handed off through a journal record like Transfer, so it
+// is never lost: if fn or the destination fails, the item is returned to
+// the head of its priority level and the error returned, and if the
+// process exits halfway, the item is returned when the source is next
+// opened, although it may then end up in the destination as well.
+//
+// Pipe blocks until the context is done, returning its error, or the
+// source is closed, returning ErrDBClosed. Run it in a goroutine of its
+// own.
+func Pipe(ctx context.Context, src *PriorityQueue, dst Queuer, fn PipeFunc) error {
+	ready := src.Notify()
+	defer src.StopNotify(ready)
+	retry := time.NewTicker(pipeRetryInterval)
+	defer retry.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err := src.transfer(dst, fn)
+		if err != ErrEmpty {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Wait for new items.
+		select {
+		case <-ready:
+		case <-retry.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// cloneHeaders returns a copy of the given item headers.
+func cloneHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	clone := make(map[string]string, len(headers))
+	for k, v := range headers {
+		clone[k] = v
+	}
+
+	return clone
+}
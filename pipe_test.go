@@ -0,0 +1,131 @@
+package goque
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	for i := 1; i <= 4; i++ {
+		if _, err = src.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Drop item 2, and move the others to the priority of their number.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(ctx, src, dst, func(item *PriorityItem) (*PriorityItem, error) {
+			if item.ToString() == "item 2" {
+				return nil, nil
+			}
+			fmt.Sscanf(item.ToString(), "item %d", &item.Priority)
+			item.Value = append(item.Value, '!')
+			return item, nil
+		})
+	}()
+
+	// Items added later are moved too.
+	if _, err = src.EnqueueString(0, "item 5"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500 && dst.LengthByPriority(5) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if src.LengthByPriority(0) != 0 {
+		t.Errorf("Expected an empty source, got %d items", src.LengthByPriority(0))
+	}
+	for _, want := range []string{"1 item 1!", "3 item 3!", "4 item 4!", "5 item 5!"} {
+		item, err := dst.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%d %s", item.Priority, item.ToString()); got != want {
+			t.Errorf("Expected '%s', got '%s'", want, got)
+		}
+	}
+	if _, err = dst.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPipeFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = src.EnqueueString(0, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed transform puts the item back unchanged.
+	errTransform := errors.New("transform failed")
+	err = Pipe(context.Background(), src, dst, func(item *PriorityItem) (*PriorityItem, error) {
+		if item.ToString() == "item 2" {
+			item.Value = []byte("changed")
+			return nil, errTransform
+		}
+		return item, nil
+	})
+	if err != errTransform {
+		t.Errorf("Expected the transform error, got %v", err)
+	}
+
+	if dst.Length() != 1 {
+		t.Errorf("Expected 1 item in the destination, got %d", dst.Length())
+	}
+	item, err := src.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "item 2" {
+		t.Errorf("Expected 'item 2' to be put back, got '%s'", item.ToString())
+	}
+	if records, _ := src.getRecords(transferPrefix); len(records) != 0 {
+		t.Errorf("Expected 0 transfer records, got %d", len(records))
+	}
+
+	// Closing the source stops the pipe.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		src.Close()
+	}()
+	if err = Pipe(context.Background(), src, dst, nil); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+}
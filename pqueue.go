@@ -3,8 +3,10 @@ package goque
 import (
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -18,36 +20,143 @@ type order int
 const (
 	ASC  order = iota // Set priority level 0 as most important.
 	DESC              // Set priority level 255 as most important.
+	RR                // Rotate among the priority levels with items.
 )
 
 // priorityLevel holds the head and tail position of a priority
-// level within the queue.
+// level within the queue, along with the IDs removed from between them.
 type priorityLevel struct {
-	head uint64
-	tail uint64
+	head    uint64
+	tail    uint64
+	removed removedIDs
 }
 
 // length returns the total number of items in this priority level.
 func (pl *priorityLevel) length() uint64 {
-	return pl.tail - pl.head
+	return pl.tail - pl.head - uint64(len(pl.removed))
+}
+
+// id returns the ID of the nth item of this priority level, counting
+// from 1 at the head.
+func (pl *priorityLevel) id(n uint64) uint64 {
+	return pl.removed.after(pl.head, n)
+}
+
+// trim moves the head and tail past any removed IDs, so the items at
+// both ends of this priority level are never removed ones.
+func (pl *priorityLevel) trim() {
+	pl.removed = pl.removed.trim(&pl.head, &pl.tail)
+}
+
+// withHead returns the priority level with its head moved past the
+// given ID, as advanceHead leaves it.
+func (pl *priorityLevel) withHead(id uint64) priorityLevel {
+	next := *pl
+	next.head = id
+	next.trim()
+
+	return next
+}
+
+// without returns the priority level with the item of the given ID
+// removed, as commitRemove leaves it.
+func (pl *priorityLevel) without(id uint64) priorityLevel {
+	next := *pl
+	switch id {
+	case next.head + 1:
+		next.head++
+	case next.tail:
+		next.tail--
+	default:
+		next.removed = next.removed.with(id)
+	}
+	next.trim()
+
+	return next
+}
+
+// levelSet is a bitmap of priority levels.
+type levelSet [4]uint64
+
+// set adds or removes the given priority level from the set.
+func (ls *levelSet) set(level uint8, ok bool) {
+	if ok {
+		ls[level/64] |= 1 << (level % 64)
+	} else {
+		ls[level/64] &^= 1 << (level % 64)
+	}
+}
+
+// has returns whether the given priority level is in the set.
+func (ls *levelSet) has(level uint8) bool {
+	return ls[level/64]&(1<<(level%64)) != 0
+}
+
+// levels returns the priority levels in the set in ascending order.
+func (ls *levelSet) levels() []uint8 {
+	var levels []uint8
+	for w, bits := range ls {
+		for b := uint(0); bits != 0; b++ {
+			if bits&1 == 1 {
+				levels = append(levels, uint8(w*64)+uint8(b))
+			}
+			bits >>= 1
+		}
+	}
+
+	return levels
 }
 
 // PriorityQueue is a standard FIFO (first in, first out) queue with
 // priority levels.
 type PriorityQueue struct {
 	sync.RWMutex
-	DataDir  string
-	db       *leveldb.DB
-	order    order
-	levels   [256]*priorityLevel
-	curLevel uint8
-	isOpen   bool
+	DataDir   string
+	db        Store
+	order     order
+	levels    [256]*priorityLevel
+	active    levelSet
+	curLevel  uint8
+	format    uint8
+	seal      valueSeal
+	seq       uint64
+	deadline  time.Time
+	dlq       *PriorityQueue
+	attempts  uint32
+	bounds    *bounds
+	compact   *compaction
+	counters  Counters
+	log       *logger
+	hooks     PriorityHooks
+	notify    notifier
+	changes   *changeLog
+	dedup     time.Duration
+	groups    bool
+	fair      *fairness
+	stripes   [256]sync.Mutex
+	commit    *groupCommit
+	async     *asyncBuffer
+	state     sync.Mutex
+	janitor   chan struct{}
+	retention Retention
+	wo        *opt.WriteOptions
+	durable   Durability
+	added     chan struct{}
+	done      chan struct{}
+	streams   sync.WaitGroup
+	isOpen    bool
 }
 
 // OpenPriorityQueue opens a priority queue if one exists at the given
 // directory. If one does not already exist, a new priority queue is
 // created.
 func OpenPriorityQueue(dataDir string, order order) (*PriorityQueue, error) {
+	return OpenPriorityQueueWithOptions(dataDir, order, nil)
+}
+
+// OpenPriorityQueueWithOptions is like OpenPriorityQueue, but opens the
+// LevelDB database using the given options.
+func OpenPriorityQueueWithOptions(dataDir string, order order, o *opt.Options) (*PriorityQueue, error) {
 	var err error
 
 	// Create a new PriorityQueue.
@@ -55,11 +164,12 @@ func OpenPriorityQueue(dataDir string, order order) (*PriorityQueue, error) {
 		DataDir: dataDir,
 		db:      &leveldb.DB{},
 		order:   order,
+		done:    make(chan struct{}),
 		isOpen:  false,
 	}
 
 	// Open database for the priority queue.
-	pq.db, err = leveldb.OpenFile(dataDir, nil)
+	pq.db, err = leveldb.OpenFile(dataDir, o)
 	if err != nil {
 		return pq, err
 	}
@@ -73,101 +183,426 @@ func OpenPriorityQueue(dataDir string, order order) (*PriorityQueue, error) {
 		return pq, ErrIncompatibleType
 	}
 
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, pq.db, goquePriorityQueue); err != nil {
+		return pq, err
+	}
+
+	// Get the on-disk format of the item values.
+	if pq.format, err = goqueFormat(dataDir); err != nil {
+		return pq, err
+	}
+	if pq.format > formatEnvelope {
+		return pq, ErrUnsupportedFormat
+	}
+
 	// Set isOpen and return.
 	pq.isOpen = true
 	return pq, pq.init()
 }
 
+// OpenPriorityQueueWithStore opens a priority queue kept in the given
+// store, such as one of another storage engine. The store is closed
+// along with the priority queue.
+//
+// dataDir is the path of the store's data, removed by Drop. It may be
+// a single file, so no 'GOQUE' file is kept there, and the store must
+// only be used for this priority queue.
+func OpenPriorityQueueWithStore(dataDir string, order order, store Store) (*PriorityQueue, error) {
+	// Create a new PriorityQueue.
+	pq := &PriorityQueue{
+		DataDir: dataDir,
+		db:      store,
+		order:   order,
+		format:  defaultFormat(goquePriorityQueue),
+		done:    make(chan struct{}),
+		isOpen:  true,
+	}
+
+	return pq, pq.init()
+}
+
 // Enqueue adds an item to the priority queue.
 func (pq *PriorityQueue) Enqueue(item *PriorityItem) error {
+	start := time.Now()
+	defer pq.log.timed("enqueue", start)
+
+	// Write the item along with concurrent enqueues, if group commit is
+	// on.
+	if gc := pq.groupCommit(); gc != nil {
+		return pq.enqueueGrouped(gc, item)
+	}
+
+	// Hold just the lock of the priority level of the item, if possible.
+	if ok, err := pq.enqueueStriped(item); ok {
+		return err
+	}
+
 	pq.Lock()
 	defer pq.Unlock()
 
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return pq.enqueue(item, nil)
+}
+
+// enqueue adds the given item to the priority queue, along with the
+// given deduplication record if not nil. The caller must hold the lock.
+func (pq *PriorityQueue) enqueue(item *PriorityItem, dedup *dedupEntry) error {
+	// Make sure the item fits.
+	if err := pq.bounds.checkValue(uint64(len(item.Value))); err != nil {
+		return err
+	}
+	if err := pq.makeRoom(1, uint64(len(item.Value))); err != nil {
+		return err
+	}
+
 	// Get the priorityLevel.
 	level := pq.levels[item.Priority]
 
-	// Set item ID and key.
+	// Set item ID, key and sequence number.
 	item.ID = level.tail + 1
 	item.Key = pq.generateKey(item.Priority, item.ID)
+	batch := new(leveldb.Batch)
+	seq := pq.stampItems(batch, item)
+	if err := pq.putValue(batch, item); err != nil {
+		return err
+	}
+	if dedup != nil {
+		if err := dedup.put(pq.db, batch, item.Key); err != nil {
+			return err
+		}
+	}
 
 	// Add it to the priority queue.
-	err := pq.db.Put(item.Key, item.Value, nil)
+	next := *level
+	next.tail++
+	putLevelMeta(batch, item.Priority, next)
+	err := pq.write(batch, changeOf(ChangeEnqueue, item))
 	if err == nil {
+		pq.seq = seq
 		level.tail++
+		before := pq.active
+		pq.active.set(item.Priority, true)
+		pq.bounds.add(uint64(len(item.Value)))
+		pq.counters.Enqueued++
+		firePriority(pq.hooks.OnEnqueue, item)
+		pq.signalAdded(before)
 
 		// If this priority level is more important than the curLevel.
 		if pq.cmpAsc(item.Priority) || pq.cmpDesc(item.Priority) {
 			pq.curLevel = item.Priority
 		}
+
+		// Apply the retention policy.
+		_, err = pq.trim(time.Now())
 	}
 
 	return err
 }
 
+// EnqueueValue creates an item with the given priority and value, adds
+// it to the priority queue and returns it with its ID, key, sequence
+// number and timestamps set.
+func (pq *PriorityQueue) EnqueueValue(priority uint8, value []byte) (*PriorityItem, error) {
+	item := NewPriorityItem(value, priority)
+	if err := pq.Enqueue(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// EnqueueString is a helper function for EnqueueValue that accepts a
+// value as a string rather than a byte slice.
+func (pq *PriorityQueue) EnqueueString(priority uint8, value string) (*PriorityItem, error) {
+	return pq.EnqueueValue(priority, []byte(value))
+}
+
+// EnqueueBatch adds the given items to the priority queue using a
+// single LevelDB batch, so either all of them are added or none are.
+// It returns the IDs assigned to the items, in the same order.
+func (pq *PriorityQueue) EnqueueBatch(items []*PriorityItem) ([]uint64, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return pq.enqueueBatch(items)
+}
+
+// enqueueBatch adds the given items to the priority queue in a single
+// batch. The caller must hold the lock.
+func (pq *PriorityQueue) enqueueBatch(items []*PriorityItem) ([]uint64, error) {
+	// Make sure the items fit.
+	for _, item := range items {
+		if err := pq.bounds.checkValue(uint64(len(item.Value))); err != nil {
+			return nil, err
+		}
+	}
+	size := priorityItemsSize(items)
+	if err := pq.makeRoom(uint64(len(items)), size); err != nil {
+		return nil, err
+	}
+
+	// Set the item IDs and keys, counting the items added to each
+	// priority level.
+	var added [256]uint64
+	ids := make([]uint64, len(items))
+	batch := new(leveldb.Batch)
+	seq := pq.stampItems(batch, items...)
+	for i, item := range items {
+		added[item.Priority]++
+		item.ID = pq.levels[item.Priority].tail + added[item.Priority]
+		item.Key = pq.generateKey(item.Priority, item.ID)
+		if err := pq.putValue(batch, item); err != nil {
+			return nil, err
+		}
+		ids[i] = item.ID
+	}
+
+	// Add them to the priority queue.
+	for i, n := range added {
+		if n > 0 {
+			next := *pq.levels[i]
+			next.tail += n
+			putLevelMeta(batch, uint8(i), next)
+		}
+	}
+	if err := pq.write(batch, changeOf(ChangeEnqueue, items...)); err != nil {
+		return nil, err
+	}
+	pq.seq = seq
+	pq.bounds.add(size)
+	pq.counters.Enqueued += uint64(len(items))
+	firePriority(pq.hooks.OnEnqueue, items...)
+
+	before := pq.active
+	for i, n := range added {
+		if n == 0 {
+			continue
+		}
+
+		priority := uint8(i)
+		pq.levels[priority].tail += n
+		pq.active.set(priority, true)
+
+		// If this priority level is more important than the curLevel.
+		if pq.cmpAsc(priority) || pq.cmpDesc(priority) {
+			pq.curLevel = priority
+		}
+	}
+	pq.signalAdded(before)
+
+	// Apply the retention policy. The items are added by now, so their
+	// IDs are returned along with the error.
+	if _, err := pq.trim(time.Now()); err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
+
 // Dequeue removes the next item in the priority queue and returns it.
+//
+// The item is deleted in a single write before it is returned, and the
+// positions of the priority queue follow from the stored keys, so a
+// crash never leaves it half removed. Either the item is still stored
+// and dequeued again once reopened, or it is gone along with the crashed
+// caller. It is never returned together with an error, so a failed
+// Dequeue can't deliver it twice. Use Reserve for items that must
+// survive a crash of the caller.
 func (pq *PriorityQueue) Dequeue() (*PriorityItem, error) {
+	start := time.Now()
+
+	// Hold just the lock of the priority level of the item, if possible.
+	if item, ok, err := pq.dequeueStriped(0, true, start); ok {
+		if err == nil {
+			pq.log.timed("dequeue", start)
+		}
+		return item, err
+	}
+
 	pq.Lock()
 	defer pq.Unlock()
 
-	// Try to get the next item in the current priority level.
-	item, err := pq.getNextItem()
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	item, err := pq.dequeue()
+	if err == nil {
+		pq.counters.dequeue(start)
+		pq.log.timed("dequeue", start)
+	}
+
+	return item, err
+}
+
+// dequeue removes the next item in the priority queue and returns it.
+// The caller must hold the lock.
+func (pq *PriorityQueue) dequeue() (*PriorityItem, error) {
+	// Return items with expired leases first.
+	if err := pq.reclaimDue(); err != nil {
+		return nil, err
+	}
+
+	// Try to get the next item in the current priority level, removing
+	// the expired ones.
+	item, err := pq.skipExpired(pq.getNextItem)
 	if err != nil {
-		return item, err
+		return nil, err
 	}
 
 	// Remove this item from the priority queue.
-	if err = pq.db.Delete(item.Key, nil); err != nil {
-		return item, err
+	if err = pq.deleteItem(item, ChangeDequeue); err != nil {
+		return nil, err
 	}
 
 	// Increment position.
-	pq.levels[pq.curLevel].head++
+	pq.tookItem(item)
+	pq.advanceHead(item.Priority, item.ID)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	pq.counters.Dequeued++
+	firePriority(pq.hooks.OnDequeue, item)
 
 	return item, nil
 }
 
+// DequeueBatch removes up to n items from the priority queue in
+// dequeue order and returns them, deleting them in a single LevelDB
+// batch. If the priority queue is empty, ErrEmpty is returned.
+func (pq *PriorityQueue) DequeueBatch(n int) ([]*PriorityItem, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var items []*PriorityItem
+	_, err := pq.DrainTo(PriorityItemWriterFunc(func(batch []*PriorityItem) (int, error) {
+		items = batch
+		return len(batch), nil
+	}), n)
+	if err != nil {
+		return nil, err
+	} else if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return items, nil
+}
+
 // DequeueByPriority removes the next item in the given priority level
-// and returns it.
+// and returns it. Like Dequeue, it never returns the item together with
+// an error.
 func (pq *PriorityQueue) DequeueByPriority(priority uint8) (*PriorityItem, error) {
+	start := time.Now()
+
+	// Hold just the lock of the priority level, if possible.
+	if item, ok, err := pq.dequeueStriped(priority, false, start); ok {
+		if err == nil {
+			pq.log.timed("dequeue", start)
+		}
+		return item, err
+	}
+
 	pq.Lock()
 	defer pq.Unlock()
 
-	// Try to get the next item in the given priority level.
-	item, err := pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Return items with expired leases first.
+	if err := pq.reclaimDue(); err != nil {
+		return nil, err
+	}
+
+	// Try to get the next item in the given priority level, removing the
+	// expired ones.
+	item, err := pq.skipExpired(func() (*PriorityItem, error) {
+		return pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+	})
 	if err != nil {
-		return item, err
+		return nil, err
 	}
 
 	// Remove this item from the priority queue.
-	if err = pq.db.Delete(item.Key, nil); err != nil {
-		return item, err
+	if err = pq.deleteItem(item, ChangeDequeue); err != nil {
+		return nil, err
 	}
 
 	// Increment position.
-	pq.levels[priority].head++
+	pq.advanceHead(priority, item.ID)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	pq.counters.Dequeued++
+	pq.counters.dequeue(start)
+	firePriority(pq.hooks.OnDequeue, item)
+	pq.log.timed("dequeue", start)
 
 	return item, nil
 }
 
 // Peek returns the next item in the priority queue without removing it.
 func (pq *PriorityQueue) Peek() (*PriorityItem, error) {
-	pq.RLock()
-	defer pq.RUnlock()
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return pq.getNextItem()
 }
 
+// PeekLast returns the item that would be dequeued last, the most
+// recently enqueued item of the least important priority level, without
+// removing it.
+func (pq *PriorityQueue) PeekLast() (*PriorityItem, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	levels := pq.dequeueLevels()
+	if len(levels) == 0 {
+		return nil, ErrEmpty
+	}
+
+	priority := levels[len(levels)-1]
+	return pq.getItemByPriorityID(priority, pq.levels[priority].tail)
+}
+
 // PeekByOffset returns the item located at the given offset,
 // starting from the head of the queue, without removing it.
 func (pq *PriorityQueue) PeekByOffset(offset uint64) (*PriorityItem, error) {
-	pq.RLock()
-	defer pq.RUnlock()
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
 
 	// If the offset is within the current priority level.
 	if pq.levels[pq.curLevel].length()-1 >= offset {
-		return pq.getItemByPriorityID(pq.curLevel, pq.levels[pq.curLevel].head+offset+1)
+		return pq.getItemByPriorityID(pq.curLevel, pq.levels[pq.curLevel].id(offset+1))
 	}
 
-	if pq.order == ASC {
+	if pq.order == ASC || pq.order == RR {
 		return pq.findOffsetAsc(offset)
 	} else if pq.order == DESC {
 		return pq.findOffsetDesc(offset)
@@ -179,18 +614,150 @@ func (pq *PriorityQueue) PeekByOffset(offset uint64) (*PriorityItem, error) {
 // PeekByPriorityID returns the item with the given ID and priority without
 // removing it.
 func (pq *PriorityQueue) PeekByPriorityID(priority uint8, id uint64) (*PriorityItem, error) {
-	pq.RLock()
-	defer pq.RUnlock()
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return pq.getItemByPriorityID(priority, id)
 }
 
+// PeekByPriorityIDs returns the items with the given IDs in the given
+// priority level without removing them, fetching all of them in a
+// single pass. The returned slice is in the same order as ids and
+// contains nil for any ID not currently in the priority level.
+func (pq *PriorityQueue) PeekByPriorityIDs(priority uint8, ids []uint64) ([]*PriorityItem, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Collect the keys of the IDs within range in ascending order.
+	var keys [][]byte
+	var indexes []int
+	level := pq.levels[priority]
+	for _, i := range sortedIndexes(ids) {
+		if ids[i] > level.head && ids[i] <= level.tail {
+			keys = append(keys, pq.generateKey(priority, ids[i]))
+			indexes = append(indexes, i)
+		}
+	}
+
+	// Fetch all of the values at once.
+	values, err := multiGet(pq.db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*PriorityItem, len(ids))
+	for j, i := range indexes {
+		if values[j] != nil {
+			if items[i], err = pq.decodeItem(keys[j], values[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return items, nil
+}
+
 // Update updates an item in the priority queue without changing its
-// position.
+// position. The headers of the item are stored as they are set on it,
+// and its update time is set to the current time.
 func (pq *PriorityQueue) Update(item *PriorityItem, newValue []byte) error {
 	pq.Lock()
 	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	if err := pq.bounds.checkValue(uint64(len(newValue))); err != nil {
+		return err
+	}
+
+	oldSize := uint64(len(item.Value))
 	item.Value = newValue
-	return pq.db.Put(item.Key, item.Value, nil)
+	if pq.format != formatRaw {
+		item.UpdatedAt = time.Now()
+	}
+	if err := pq.putItem(item, ChangeUpdate); err != nil {
+		return err
+	}
+
+	pq.bounds.remove(oldSize)
+	pq.bounds.add(uint64(len(newValue)))
+
+	return nil
+}
+
+// UpdatePriority moves an item to the tail of the given priority level,
+// removing it from its current one in the same LevelDB batch. The item
+// is updated with its new ID, key and priority and returned. Its value
+// and sequence number are kept.
+func (pq *PriorityQueue) UpdatePriority(item *PriorityItem, newPriority uint8) (*PriorityItem, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Make sure the item is still in the priority queue.
+	stored, err := pq.getItemByPriorityID(item.Priority, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	*item = *stored
+	if item.Priority == newPriority {
+		return item, nil
+	}
+
+	// Move the item to the tail of the new priority level.
+	level := pq.levels[newPriority]
+	moved := *item
+	moved.ID = level.tail + 1
+	moved.Priority = newPriority
+	if pq.format != formatRaw {
+		moved.UpdatedAt = time.Now()
+	}
+	moved.Key = pq.generateKey(newPriority, moved.ID)
+
+	batch := new(leveldb.Batch)
+	pq.removeItem(batch, stored)
+	putLevelMeta(batch, stored.Priority, pq.levels[stored.Priority].without(stored.ID))
+	if err = pq.putValue(batch, &moved); err != nil {
+		return nil, err
+	}
+	next := *level
+	next.tail++
+	putLevelMeta(batch, newPriority, next)
+	move := change{op: ChangeMove, items: []*PriorityItem{&moved}, prev: stored.Key}
+	if err = pq.write(batch, move); err != nil {
+		return nil, err
+	}
+	before := pq.active
+	pq.commitRemove(stored)
+
+	level.tail++
+	pq.active.set(newPriority, true)
+	pq.notify.added(before, pq.active)
+
+	// If this priority level is more important than the curLevel.
+	if pq.cmpAsc(newPriority) || pq.cmpDesc(newPriority) {
+		pq.curLevel = newPriority
+	}
+
+	*item = moved
+	return item, nil
 }
 
 // UpdateString is a helper function for Update that accepts a value
@@ -199,6 +766,51 @@ func (pq *PriorityQueue) UpdateString(item *PriorityItem, newValue string) error
 	return pq.Update(item, []byte(newValue))
 }
 
+// ActiveLevels returns the priority levels that currently contain
+// items, in the order they would be dequeued.
+func (pq *PriorityQueue) ActiveLevels() []uint8 {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	return pq.dequeueLevels()
+}
+
+// LevelLength is the number of items in a priority level.
+type LevelLength struct {
+	Priority uint8
+	Length   uint64
+}
+
+// Levels returns the number of items in each priority level that
+// currently contains items, in the order they would be dequeued.
+func (pq *PriorityQueue) Levels() []LevelLength {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	return pq.levelLengths()
+}
+
+// levelLengths returns the number of items in each priority level that
+// contains items, in the order they would be dequeued. The caller must
+// hold the lock.
+func (pq *PriorityQueue) levelLengths() []LevelLength {
+	var levels []LevelLength
+	for _, priority := range pq.dequeueLevels() {
+		levels = append(levels, LevelLength{Priority: priority, Length: pq.levels[priority].length()})
+	}
+
+	return levels
+}
+
+// LengthByPriority returns the number of items in the given priority
+// level.
+func (pq *PriorityQueue) LengthByPriority(priority uint8) uint64 {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	return pq.levels[priority].length()
+}
+
 // Length returns the total number of items in the priority queue.
 func (pq *PriorityQueue) Length() uint64 {
 	var length uint64
@@ -209,27 +821,111 @@ func (pq *PriorityQueue) Length() uint64 {
 	return length
 }
 
-// Close closes the LevelDB database of the priority queue.
-func (pq *PriorityQueue) Close() {
-	// If queue is already closed.
-	if !pq.isOpen {
-		return
+// Close closes the LevelDB database of the priority queue. Once closed,
+// every operation on the priority queue returns ErrDBClosed.
+func (pq *PriorityQueue) Close() error {
+	_, err := pq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the priority queue like Close once check, if not nil,
+// returns nil. Check is called after the items buffered by EnqueueAsync
+// were written, holding the lock that is only released once the
+// priority queue is marked closed, so nothing changes it in between. If
+// check fails, the priority queue is left open, EnqueueAsync buffers
+// items again, and the error is returned. closeIf reports whether the
+// priority queue is closed.
+func (pq *PriorityQueue) closeIf(check func() error) (bool, error) {
+	// Write the items buffered by EnqueueAsync.
+	aerr := pq.closeAsync()
+
+	pq.Lock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			if pq.isOpen {
+				pq.reopenAsync(aerr)
+			}
+			pq.Unlock()
+			return false, err
+		}
 	}
 
-	pq.db.Close()
+	// If priority queue is already closed.
+	if !pq.isOpen {
+		pq.Unlock()
+		return true, nil
+	}
 	pq.isOpen = false
+
+	// Wake anything waiting for space, and close the Notify channels and
+	// a buffer of EnqueueAsync started meanwhile.
+	pq.bounds.wake()
+	pq.async.close()
+	pq.notify.close()
+	pq.Unlock()
+
+	// Stop the channel streams, letting them return undelivered items.
+	close(pq.done)
+	pq.streams.Wait()
+
+	pq.Lock()
+	defer pq.Unlock()
+
+	err := aerr
+
+	// Sync the writes of a batched priority queue.
+	if err == nil && pq.durable == DurabilityBatched {
+		err = syncDB(pq.db)
+	}
+
+	if cerr := pq.db.Close(); err == nil {
+		err = cerr
+	}
+
+	return true, err
+}
+
+// Drop closes and deletes the LevelDB database of the priority queue,
+// as long as it holds no items, counting the items in flight and those
+// buffered by EnqueueAsync. Otherwise nothing is done and ErrNotEmpty is
+// returned. Like Close, Drop first writes the buffered items, and
+// EnqueueAsync returns ErrDBClosed until the check is done even if the
+// priority queue isn't dropped.
+func (pq *PriorityQueue) Drop() error {
+	return dropIf(pq.DataDir, pq.closeIf, func() error {
+		n := pq.Length()
+		if n == 0 && pq.isOpen {
+			leases, err := pq.getLeases()
+			if err != nil {
+				return err
+			}
+			n = uint64(len(leases))
+		}
+		if n > 0 {
+			return ErrNotEmpty
+		}
+
+		return nil
+	})
 }
 
-// Drop closes and deletes the LevelDB database of the priority queue.
-func (pq *PriorityQueue) Drop() {
-	pq.Close()
-	os.RemoveAll(pq.DataDir)
+// ForceDrop closes and deletes the LevelDB database of the priority
+// queue, along with any items it still holds.
+func (pq *PriorityQueue) ForceDrop() error {
+	err := pq.Close()
+	if rerr := os.RemoveAll(pq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
 }
 
 // cmpAsc returns wehther the given priority level is higher than the
-// current priority level based on ascending order.
+// current priority level based on ascending order, which round robin
+// priority queues use outside of dequeues.
 func (pq *PriorityQueue) cmpAsc(priority uint8) bool {
-	return pq.order == ASC && priority < pq.curLevel
+	return (pq.order == ASC || pq.order == RR) && priority < pq.curLevel
 }
 
 // cmpAsc returns wehther the given priority level is higher than the
@@ -238,10 +934,37 @@ func (pq *PriorityQueue) cmpDesc(priority uint8) bool {
 	return pq.order == DESC && priority > pq.curLevel
 }
 
+// advanceHead moves the head of the given priority level past the
+// given ID once the item at its front is removed.
+func (pq *PriorityQueue) advanceHead(priority uint8, id uint64) {
+	level := pq.levels[priority]
+	*level = level.withHead(id)
+	pq.updateActive(priority)
+}
+
+// updateActive updates whether the given priority level is in the set
+// of active levels based on its current length.
+func (pq *PriorityQueue) updateActive(priority uint8) {
+	pq.active.set(priority, pq.levels[priority].length() > 0)
+}
+
+// dequeueLevels returns the priority levels that currently contain
+// items, in the order they would be dequeued.
+func (pq *PriorityQueue) dequeueLevels() []uint8 {
+	levels := pq.active.levels()
+	if pq.order == DESC {
+		for i, j := 0, len(levels)-1; i < j; i, j = i+1, j-1 {
+			levels[i], levels[j] = levels[j], levels[i]
+		}
+	}
+
+	return levels
+}
+
 // resetCurrentLevel resets the current priority level of the queue
 // so the highest level can be found.
 func (pq *PriorityQueue) resetCurrentLevel() {
-	if pq.order == ASC {
+	if pq.order == ASC || pq.order == RR {
 		pq.curLevel = 255
 	} else if pq.order == DESC {
 		pq.curLevel = 0
@@ -265,7 +988,7 @@ func (pq *PriorityQueue) findOffsetAsc(offset uint64) (*PriorityItem, error) {
 
 			// If the offset is within the current priority level.
 			if length+newLength >= offset {
-				return pq.getItemByPriorityID(priority, offset-length+1)
+				return pq.getItemByPriorityID(priority, pq.levels[iu8].id(offset-length+1))
 			}
 
 			length += newLength + 1
@@ -292,7 +1015,7 @@ func (pq *PriorityQueue) findOffsetDesc(offset uint64) (*PriorityItem, error) {
 
 			// If the offset is within the current priority level.
 			if length+newLength >= offset {
-				return pq.getItemByPriorityID(priority, offset-length+1)
+				return pq.getItemByPriorityID(priority, pq.levels[iu8].id(offset-length+1))
 			}
 
 			length += newLength + 1
@@ -323,6 +1046,12 @@ func (pq *PriorityQueue) getNextItem() (*PriorityItem, error) {
 		}
 	}
 
+	// Pick the priority level by weight, if weights are set.
+	if pq.fair != nil {
+		priority := pq.fair.next(pq.dequeueLevels())
+		return pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+	}
+
 	// Try to get the next item in the current priority level.
 	return pq.getItemByPriorityID(pq.curLevel, pq.levels[pq.curLevel].head+1)
 }
@@ -336,13 +1065,14 @@ func (pq *PriorityQueue) getItemByPriorityID(priority uint8, id uint64) (*Priori
 		return nil, ErrOutOfBounds
 	}
 
-	var err error
-
-	// Create a new PriorityItem.
-	item := &PriorityItem{ID: id, Priority: priority, Key: pq.generateKey(priority, id)}
-	item.Value, err = pq.db.Get(item.Key, nil)
+	// Get the stored value of the item.
+	key := pq.generateKey(priority, id)
+	data, err := pq.db.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	return item, err
+	return pq.decodeItem(key, data)
 }
 
 // generatePrefix creates the key prefix for the given priority level.
@@ -365,11 +1095,28 @@ func (pq *PriorityQueue) generateKey(priority uint8, id uint64) []byte {
 
 // init initializes the priority queue data.
 func (pq *PriorityQueue) init() error {
+	pq.log = openLogger()
+
+	// Rotate among the priority levels of a round robin priority queue.
+	if pq.order == RR {
+		pq.fair = newFairness(nil)
+	}
+
 	// Set starting value for curLevel.
 	pq.resetCurrentLevel()
 
-	// Loop through each priority level.
-	for i := 0; i <= 255; i++ {
+	// Load the global sequence number.
+	if err := pq.initSeq(); err != nil {
+		return err
+	}
+
+	// Use the persisted positions, if any, and otherwise find them by
+	// scanning each priority level.
+	loaded, err := pq.loadMeta()
+	if err != nil {
+		return err
+	}
+	for i := 0; i <= 255 && !loaded; i++ {
 		// Create a new LevelDB Iterator for this priority level.
 		prefix := pq.generatePrefix(uint8(i))
 		iter := pq.db.NewIterator(util.BytesPrefix(prefix), nil)
@@ -400,8 +1147,48 @@ func (pq *PriorityQueue) init() error {
 		}
 
 		pq.levels[i] = pl
+		pq.updateActive(uint8(i))
 		iter.Release()
 	}
+	if !loaded {
+		if pq.Length() > 0 {
+			pq.log.warn("goque: Rebuilt the positions of a priority queue", "dir", pq.DataDir, "items", pq.Length())
+		}
 
-	return nil
+		// Persist the positions found, so the next open doesn't have to
+		// scan them again.
+		if err = pq.saveMeta(); err != nil {
+			return err
+		}
+	}
+
+	// Load the IDs of the items removed from the middle of each level.
+	keys, err := loadRemoved(pq.db, pq.wo, func(key []byte) bool {
+		if len(key) != 10 || key[1] != prefixSep[0] {
+			return false
+		}
+
+		id, level := keyToID(key[2:]), pq.levels[key[0]]
+		return id > level.head+1 && id < level.tail
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		level := pq.levels[key[0]]
+		level.removed = append(level.removed, keyToID(key[2:]))
+	}
+
+	// Find the earliest lease deadline, so leases that expired while
+	// the priority queue was closed are reclaimed on first access.
+	leases, err := pq.getLeases()
+	if err != nil {
+		return err
+	}
+	for _, lease := range leases {
+		pq.trackDeadline(lease.Deadline)
+	}
+
+	// Return the items of interrupted transfers.
+	return pq.recoverTransfers()
 }
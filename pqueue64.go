@@ -0,0 +1,359 @@
+package goque
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// pq64MetaKey is the key used to persist the metadata of a 64-bit
+// priority queue. Item keys start with pq64ItemPrefix, so they never
+// collide with it.
+var pq64MetaKey = []byte{0xFF}
+
+// pq64ItemPrefix is the key prefix of the items of a 64-bit priority
+// queue.
+var pq64ItemPrefix = []byte{0x00}
+
+// PriorityItem64 represents an entry in a 64-bit priority queue.
+type PriorityItem64 struct {
+	ID       uint64
+	Priority uint64
+	Key      []byte
+	Value    []byte
+}
+
+// NewPriorityItem64 creates a new item for use with a 64-bit priority
+// queue.
+func NewPriorityItem64(value []byte, priority uint64) *PriorityItem64 {
+	return &PriorityItem64{Priority: priority, Value: value}
+}
+
+// NewPriorityItem64String is a helper function for NewPriorityItem64
+// that accepts a value as a string rather than a byte slice.
+func NewPriorityItem64String(value string, priority uint64) *PriorityItem64 {
+	return NewPriorityItem64([]byte(value), priority)
+}
+
+// ToString returns the priority item value as a string.
+func (pi *PriorityItem64) ToString() string {
+	return string(pi.Value)
+}
+
+// PriorityQueue64 is a FIFO (first in, first out) queue with 64-bit
+// priorities, for when 256 priority levels are too coarse, such as when
+// the priority is a deadline. Items of the same priority are dequeued in
+// the order they were added.
+//
+// Items are stored under keys starting with the big-endian priority, so
+// LevelDB keeps them in priority order and the next item is found with a
+// single seek, however many distinct priorities are in use.
+type PriorityQueue64 struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	order   order
+	lastID  uint64
+	length  uint64
+	isOpen  bool
+}
+
+// OpenPriorityQueue64 opens a 64-bit priority queue if one exists at the
+// given directory. If one does not already exist, a new 64-bit priority
+// queue is created.
+//
+// With the ASC order, priority 0 is the most important, and with DESC the
+// highest priority is. The RR order isn't supported, and is treated as
+// ASC. Like for a PriorityQueue, the order only affects dequeues, so it
+// can change between opens.
+func OpenPriorityQueue64(dataDir string, order order) (*PriorityQueue64, error) {
+	return openPriorityQueue64(dataDir, order, goquePriorityQueue64)
+}
+
+// openPriorityQueue64 opens a 64-bit priority queue storing the given
+// Goque type.
+func openPriorityQueue64(dataDir string, order order, gt goqueType) (*PriorityQueue64, error) {
+	var err error
+
+	// Create a new PriorityQueue64.
+	pq := &PriorityQueue64{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		order:   order,
+		isOpen:  false,
+	}
+
+	// Open database for the priority queue.
+	pq.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return pq, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, gt)
+	if err != nil {
+		return pq, err
+	}
+	if !ok {
+		return pq, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, pq.db, gt); err != nil {
+		return pq, err
+	}
+
+	// Set isOpen and return.
+	pq.isOpen = true
+	return pq, pq.init()
+}
+
+// Enqueue adds an item to the priority queue.
+func (pq *PriorityQueue64) Enqueue(item *PriorityItem64) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Set item ID and key.
+	item.ID = pq.lastID + 1
+	item.Key = generatePQ64Key(item.Priority, item.ID)
+
+	// Add it to the priority queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, item.Value)
+	pq.putMeta(batch, item.ID, pq.length+1)
+	if err := pq.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	pq.lastID++
+	pq.length++
+
+	return nil
+}
+
+// Dequeue removes the next item in the priority queue and returns it.
+func (pq *PriorityQueue64) Dequeue() (*PriorityItem64, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the next item in the priority queue.
+	item, err := pq.getNextItem()
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the priority queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	pq.putMeta(batch, pq.lastID, pq.length-1)
+	if err = pq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	pq.length--
+
+	return item, nil
+}
+
+// Peek returns the next item in the priority queue without removing it.
+func (pq *PriorityQueue64) Peek() (*PriorityItem64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return pq.getNextItem()
+}
+
+// peekBelow returns the items with a priority below the given one, in
+// ascending order, without removing them.
+func (pq *PriorityQueue64) peekBelow(priority uint64) ([]*PriorityItem64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Create a new LevelDB Iterator over the items below the priority.
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq64ItemPrefix,
+		Limit: generatePQ64Key(priority, 0),
+	}, nil)
+	defer iter.Release()
+
+	var items []*PriorityItem64
+	for iter.Next() {
+		items = append(items, decodePQ64Item(iter.Key(), iter.Value()))
+	}
+
+	return items, iter.Error()
+}
+
+// Update updates an item in the priority queue without changing its
+// position.
+func (pq *PriorityQueue64) Update(item *PriorityItem64, newValue []byte) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	item.Value = newValue
+	return pq.db.Put(item.Key, item.Value, nil)
+}
+
+// UpdateString is a helper function for Update that accepts a value as
+// a string rather than a byte slice.
+func (pq *PriorityQueue64) UpdateString(item *PriorityItem64, newValue string) error {
+	return pq.Update(item, []byte(newValue))
+}
+
+// Length returns the total number of items in the priority queue.
+func (pq *PriorityQueue64) Length() uint64 {
+	return pq.length
+}
+
+// Close closes the LevelDB database of the priority queue. Once closed,
+// every operation on the priority queue returns ErrDBClosed.
+func (pq *PriorityQueue64) Close() error {
+	_, err := pq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the priority queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the priority queue in
+// between. If check fails, the priority queue is left as it is and the error is
+// returned. closeIf reports whether the priority queue is closed.
+func (pq *PriorityQueue64) closeIf(check func() error) (bool, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If priority queue is already closed.
+	if !pq.isOpen {
+		return true, nil
+	}
+	pq.isOpen = false
+
+	return true, pq.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the priority queue, as
+// long as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (pq *PriorityQueue64) Drop() error {
+	return dropIf(pq.DataDir, pq.closeIf, checkEmpty(pq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the priority
+// queue, along with any items it still holds.
+func (pq *PriorityQueue64) ForceDrop() error {
+	err := pq.Close()
+	if rerr := os.RemoveAll(pq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// getNextItem returns the next item in dequeue order. In descending
+// order, the last key gives the highest priority, and a second seek
+// finds the first item added with it.
+func (pq *PriorityQueue64) getNextItem() (*PriorityItem64, error) {
+	if pq.length == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Create a new LevelDB Iterator over the items.
+	iter := pq.db.NewIterator(util.BytesPrefix(pq64ItemPrefix), nil)
+	defer iter.Release()
+
+	ok := iter.First()
+	if ok && pq.order == DESC {
+		iter.Last()
+		ok = iter.Seek(generatePQ64Key(binary.BigEndian.Uint64(iter.Key()[1:9]), 0))
+	}
+	if !ok {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmpty
+	}
+
+	return decodePQ64Item(iter.Key(), iter.Value()), nil
+}
+
+// decodePQ64Item creates an item from the key and value of a LevelDB
+// iterator, copying them as the iterator reuses its buffers.
+func decodePQ64Item(key, value []byte) *PriorityItem64 {
+	return &PriorityItem64{
+		ID:       binary.BigEndian.Uint64(key[9:17]),
+		Priority: binary.BigEndian.Uint64(key[1:9]),
+		Key:      append([]byte(nil), key...),
+		Value:    append([]byte(nil), value...),
+	}
+}
+
+// putMeta adds the last assigned ID and the length of the priority queue
+// to the batch.
+func (pq *PriorityQueue64) putMeta(batch *leveldb.Batch, lastID, length uint64) {
+	// lastID + length = 8 + 8
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[0:8], lastID)
+	binary.BigEndian.PutUint64(data[8:16], length)
+	batch.Put(pq64MetaKey, data)
+}
+
+// init initializes the priority queue data.
+func (pq *PriorityQueue64) init() error {
+	data, err := pq.db.Get(pq64MetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 16 {
+		return ErrInvalidRecord
+	}
+	pq.lastID = binary.BigEndian.Uint64(data[0:8])
+	pq.length = binary.BigEndian.Uint64(data[8:16])
+
+	return nil
+}
+
+// generatePQ64Key creates a key ordered by the given priority, then by
+// the ID, so items of the same priority keep the order they were added.
+func generatePQ64Key(priority, id uint64) []byte {
+	// prefix + priority + id = 1 + 8 + 8
+	key := make([]byte, 17)
+	key[0] = pq64ItemPrefix[0]
+	binary.BigEndian.PutUint64(key[1:9], priority)
+	binary.BigEndian.PutUint64(key[9:17], id)
+	return key
+}
@@ -0,0 +1,159 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueue64Order(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue64(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// Priorities far beyond 255, including ones only apart in their
+	// lowest byte, and a repeated one.
+	priorities := []uint64{1 << 40, 256, math.MaxUint64, 1 << 40, 5, 1<<40 + 1}
+	for i, p := range priorities {
+		if err = pq.Enqueue(NewPriorityItem64String(fmt.Sprintf("value%d", i), p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", pq.Length())
+	}
+
+	item, err := pq.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Priority != 5 {
+		t.Errorf("Expected priority 5, got %d", item.Priority)
+	}
+
+	for _, want := range []string{"value4", "value1", "value0", "value3", "value5", "value2"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPriorityQueue64Desc(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue64(file, DESC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i, p := range []uint64{7, 1 << 50, 1 << 50, 1 << 50, 7} {
+		if err = pq.Enqueue(NewPriorityItem64String(fmt.Sprintf("value%d", i), p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The highest priority goes first, keeping the order within it.
+	for _, want := range []string{"value1", "value2", "value3", "value0"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+
+	// The items are kept, in order, after reopening.
+	if err = pq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+	if pq, err = OpenPriorityQueue64(file, DESC); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+	item := NewPriorityItem64String("value5", 8)
+	if err = pq.Enqueue(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 6 {
+		t.Errorf("Expected ID 6, got %d", item.ID)
+	}
+	if item, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value5" {
+		t.Errorf("Expected 'value5', got '%s'", item.ToString())
+	}
+	if err = pq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+}
+
+func TestPriorityQueue64IncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+	pq.Close()
+
+	if _, err = OpenPriorityQueue64(file, ASC); err != ErrIncompatibleType {
+		t.Errorf("Expected 64-bit priority queue to return ErrIncompatibleType when opening a PriorityQueue, got %v", err)
+	}
+}
+
+func TestPriorityQueue64BackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue64(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItem64String("value", 1<<33)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "64-bit priority queue" {
+		t.Errorf("Expected type '64-bit priority queue', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenPriorityQueue64(file+"_restore", ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" || item.Priority != 1<<33 {
+		t.Errorf("Expected 'value' with priority %d, got '%s' with %d", uint64(1<<33), item.ToString(), item.Priority)
+	}
+}
@@ -1,11 +1,17 @@
 package goque
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 func TestPriorityQueueDrop(t *testing.T) {
@@ -26,13 +32,58 @@ func TestPriorityQueueDrop(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Enqueue, got %v", err)
+	}
+
+	if _, err = pq.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Dequeue, got %v", err)
+	}
+
+	if _, err = pq.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Peek, got %v", err)
+	}
+
+	if _, err = pq.UpdatePriority(&PriorityItem{ID: 1}, 1); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on UpdatePriority, got %v", err)
+	}
+
+	// Closing again is a no-op.
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
 func TestPriorityQueueIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 	q.Close()
 
 	if _, err = OpenPriorityQueue(file, ASC); err != ErrIncompatibleType {
@@ -40,13 +91,31 @@ func TestPriorityQueueIncompatibleType(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueWithOptions(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, &opt.Options{WriteBuffer: 1 << 20})
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+	pq.Close()
+
+	if _, err = OpenPriorityQueueWithOptions(file, ASC, &opt.Options{ErrorIfExist: true}); err == nil {
+		t.Error("Expected an error opening an existing priority queue with ErrorIfExist")
+	}
+}
+
 func TestPriorityQueueEnqueue(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -62,13 +131,48 @@ func TestPriorityQueueEnqueue(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueEnqueueValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueValue(1, []byte("value for item 1")); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.EnqueueString(1, "value for item 2")
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ID != 2 || item.Priority != 1 || item.Seq != 2 || item.CreatedAt.IsZero() {
+		t.Errorf("Expected item 2 of priority 1 with seq 2 and a creation time, got %d, %d, %d and %v", item.ID, item.Priority, item.Seq, item.CreatedAt)
+	}
+
+	peeked, err := pq.PeekByPriorityID(1, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if peeked.ToString() != "value for item 2" {
+		t.Errorf("Expected string to be 'value for item 2', got '%s'", peeked.ToString())
+	}
+
+	pq.Close()
+
+	if _, err = pq.EnqueueString(0, "value"); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
 func TestPriorityQueueDequeueAsc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -109,7 +213,7 @@ func TestPriorityQueueDequeueDesc(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -150,7 +254,7 @@ func TestPriorityQueueDequeueByPriority(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -191,7 +295,7 @@ func TestPriorityQueuePeek(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -222,13 +326,53 @@ func TestPriorityQueuePeek(t *testing.T) {
 	}
 }
 
+func TestPriorityQueuePeekLast(t *testing.T) {
+	for _, o := range []order{ASC, DESC} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		pq, err := OpenPriorityQueue(file, o)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if _, err = pq.PeekLast(); err != ErrEmpty {
+			t.Errorf("Expected to get empty error, got %v", err)
+		}
+
+		for _, p := range []uint8{5, 0, 9, 5, 9} {
+			if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", pq.LengthByPriority(p)+1), p)); err != nil {
+				t.Error(err)
+			}
+		}
+
+		// The last item of the least important level.
+		want := "9 value for item 2"
+		if o == DESC {
+			want = "0 value for item 1"
+		}
+
+		item, err := pq.PeekLast()
+		if err != nil {
+			t.Error(err)
+		}
+		if got := fmt.Sprintf("%d %s", item.Priority, item.ToString()); got != want {
+			t.Errorf("Expected '%s', got '%s'", want, got)
+		}
+
+		if pq.Length() != 5 {
+			t.Errorf("Expected queue length of 5, got %d", pq.Length())
+		}
+
+		pq.ForceDrop()
+	}
+}
+
 func TestPriorityQueuePeekByOffsetAsc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -293,7 +437,7 @@ func TestPriorityQueuePeekByOffsetDesc(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -358,7 +502,7 @@ func TestPriorityQueuePeekByPriorityID(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -389,13 +533,58 @@ func TestPriorityQueuePeekByPriorityID(t *testing.T) {
 	}
 }
 
+func TestPriorityQueuePeekByPriorityIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			item := NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))
+			if err = pq.Enqueue(item); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	items, err := pq.PeekByPriorityIDs(3, []uint64{9, 0, 4})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+
+	if items[0].Priority != 3 {
+		t.Errorf("Expected priority level to be 3, got %d", items[0].Priority)
+	}
+
+	compStr := "value for item 9"
+	if items[0].ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, items[0].ToString())
+	}
+
+	if items[1] != nil {
+		t.Error("Expected item for out of range ID to be nil")
+	}
+
+	compStr = "value for item 4"
+	if items[2].ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, items[2].ToString())
+	}
+}
+
 func TestPriorityQueueUpdate(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -450,7 +639,7 @@ func TestPriorityQueueUpdateString(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 0; p <= 4; p++ {
 		for i := 1; i <= 10; i++ {
@@ -499,13 +688,107 @@ func TestPriorityQueueUpdateString(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueUpdatePriority(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for _, p := range []uint8{5, 5, 5, 0, 0} {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", pq.LengthByPriority(p)+1), p)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Escalate the second item of level 5.
+	item, err := pq.PeekByPriorityID(5, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	seq := item.Seq
+
+	moved, err := pq.UpdatePriority(item, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if moved.Priority != 0 || moved.ID != 3 || moved.Seq != seq || moved.ToString() != "value for item 2" {
+		t.Errorf("Expected priority 0, ID 3, seq %d and 'value for item 2', got %d, %d, %d and '%s'", seq, moved.Priority, moved.ID, moved.Seq, moved.ToString())
+	}
+
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+	if pq.LengthByPriority(5) != 2 {
+		t.Errorf("Expected priority level length of 2, got %d", pq.LengthByPriority(5))
+	}
+
+	// The old position is gone.
+	if _, err = pq.UpdatePriority(&PriorityItem{ID: 2, Priority: 5}, 1); err == nil {
+		t.Error("Expected to get an error updating a moved item")
+	}
+
+	// Reopen the priority queue, which should keep the move.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, want := range []string{"0 value for item 1", "0 value for item 2", "0 value for item 2", "5 value for item 1", "5 value for item 3"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		got := fmt.Sprintf("%d %s", item.Priority, item.ToString())
+		if got != want {
+			t.Errorf("Expected '%s', got '%s'", want, got)
+		}
+	}
+}
+
+func TestPriorityQueueUpdatePriorityCurrentLevel(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("first", 10)); err != nil {
+		t.Error(err)
+	}
+	if err = pq.Enqueue(NewPriorityItemString("second", 10)); err != nil {
+		t.Error(err)
+	}
+
+	// Moving an item above the current level makes it the next one.
+	item, err := pq.PeekByPriorityID(10, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.UpdatePriority(item, 20); err != nil {
+		t.Error(err)
+	}
+
+	item, err = pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "second" {
+		t.Errorf("Expected string to be 'second', got '%s'", item.ToString())
+	}
+}
+
 func TestPriorityQueueHigherPriorityAsc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 5; p <= 9; p++ {
 		for i := 1; i <= 10; i++ {
@@ -546,7 +829,7 @@ func TestPriorityQueueHigherPriorityDesc(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	for p := 5; p <= 9; p++ {
 		for i := 1; i <= 10; i++ {
@@ -581,13 +864,415 @@ func TestPriorityQueueHigherPriorityDesc(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueActiveLevels(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for _, p := range []uint8{3, 200, 64, 0} {
+		if err = pq.Enqueue(NewPriorityItemString("value", p)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	levels := pq.ActiveLevels()
+	if fmt.Sprint(levels) != "[64 3 0]" {
+		t.Errorf("Expected active levels to be [64 3 0], got %v", levels)
+	}
+
+	// Reopen the priority queue, which should rebuild the active levels.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	levels = pq.ActiveLevels()
+	if fmt.Sprint(levels) != "[0 3 64]" {
+		t.Errorf("Expected active levels to be [0 3 64], got %v", levels)
+	}
+}
+
+func TestPriorityQueueLevels(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i, p := range []uint8{3, 200, 64, 0} {
+		for j := 0; j <= i; j++ {
+			if err = pq.Enqueue(NewPriorityItemString("value", p)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	levels := pq.Levels()
+	if fmt.Sprint(levels) != "[{200 1} {64 3} {3 1} {0 4}]" {
+		t.Errorf("Expected levels to be [{200 1} {64 3} {3 1} {0 4}], got %v", levels)
+	}
+
+	if pq.LengthByPriority(0) != 4 {
+		t.Errorf("Expected priority level length of 4, got %d", pq.LengthByPriority(0))
+	}
+	if pq.LengthByPriority(1) != 0 {
+		t.Errorf("Expected priority level length of 0, got %d", pq.LengthByPriority(1))
+	}
+
+	// An empty priority queue has no levels.
+	if err = pq.Clear(); err != nil {
+		t.Error(err)
+	}
+	if len(pq.Levels()) != 0 {
+		t.Errorf("Expected no levels, got %v", pq.Levels())
+	}
+}
+
+func TestPriorityQueueSeq(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i, p := range []uint8{5, 1, 5, 0} {
+		item := NewPriorityItemString("value", p)
+		if err = pq.Enqueue(item); err != nil {
+			t.Error(err)
+		}
+
+		if item.Seq != uint64(i+1) {
+			t.Errorf("Expected sequence number to be %d, got %d", i+1, item.Seq)
+		}
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.Seq != 4 {
+		t.Errorf("Expected sequence number to be 4, got %d", item.Seq)
+	}
+
+	// Reopen the priority queue and make sure the sequence continues.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item, err = pq.PeekByPriorityID(5, 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.Seq != 3 {
+		t.Errorf("Expected sequence number to be 3, got %d", item.Seq)
+	}
+
+	item = NewPriorityItemString("value", 3)
+	if err = pq.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+
+	if item.Seq != 5 {
+		t.Errorf("Expected sequence number to be 5, got %d", item.Seq)
+	}
+}
+
+func TestPriorityQueueEnqueueBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 1)); err != nil {
+		t.Error(err)
+	}
+
+	items := []*PriorityItem{
+		NewPriorityItemString("value for item 1", 1),
+		NewPriorityItemString("value for item 2", 0),
+		NewPriorityItemString("value for item 3", 1),
+	}
+	ids, err := pq.EnqueueBatch(items)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if fmt.Sprint(ids) != "[2 1 3]" {
+		t.Errorf("Expected IDs to be [2 1 3], got %v", ids)
+	}
+
+	if pq.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", pq.Length())
+	}
+
+	for i, item := range items {
+		if item.Seq != uint64(i+2) {
+			t.Errorf("Expected sequence number to be %d, got %d", i+2, item.Seq)
+		}
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	item, err = pq.PeekByPriorityID(1, 3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 3"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestPriorityQueueDequeueBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i, priority := range []uint8{0, 1, 0, 1} {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i+1), priority)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := pq.DequeueBatch(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+
+	for i, compStr := range []string{"value for item 2", "value for item 4", "value for item 1"} {
+		if items[i].ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, items[i].ToString())
+		}
+	}
+
+	if items, err = pq.DequeueBatch(3); err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].ToString() != "value for item 3" {
+		t.Errorf("Expected only 'value for item 3' to be left, got %d items", len(items))
+	}
+
+	if _, err = pq.DequeueBatch(3); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// Reopen the priority queue and make sure the items are gone.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, DESC); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueRawFormat(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+
+	// Create a data directory the way older versions of Goque did.
+	if err := os.MkdirAll(file, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(goquePriorityQueue)}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 0)); err != nil {
+		t.Error(err)
+	}
+
+	// Values must still be stored as is.
+	value, err := pq.db.Get(pq.generateKey(0, 1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item"
+	if string(value) != compStr {
+		t.Errorf("Expected stored value to be '%s', got '%s'", compStr, value)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != compStr || item.Seq != 0 {
+		t.Errorf("Expected item '%s' without sequence number, got '%s' with %d", compStr, item.ToString(), item.Seq)
+	}
+}
+
+func TestPriorityQueueMetadata(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	before := time.Now()
+	item := NewPriorityItemString("value for item", 0)
+	item.Headers = map[string]string{"correlation-id": "abc123", "source": "test"}
+	if err = pq.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+
+	if item.CreatedAt.Before(before) || !item.UpdatedAt.Equal(item.CreatedAt) {
+		t.Errorf("Expected creation and update times after %v, got %v and %v", before, item.CreatedAt, item.UpdatedAt)
+	}
+	created := item.CreatedAt
+
+	// Reopen the priority queue, which should keep the metadata.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item, err = pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(item.Headers) != 2 || item.Headers["correlation-id"] != "abc123" || item.Headers["source"] != "test" {
+		t.Errorf("Expected the headers to be kept, got %v", item.Headers)
+	}
+	if !item.CreatedAt.Equal(created) || !item.UpdatedAt.Equal(created) {
+		t.Errorf("Expected creation and update times of %v, got %v and %v", created, item.CreatedAt, item.UpdatedAt)
+	}
+
+	// Updating the item only changes its update time.
+	delete(item.Headers, "source")
+	if err = pq.UpdateString(item, "new value"); err != nil {
+		t.Error(err)
+	}
+
+	item, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(item.Headers) != 1 || item.Headers["correlation-id"] != "abc123" {
+		t.Errorf("Expected the updated headers to be kept, got %v", item.Headers)
+	}
+	if !item.CreatedAt.Equal(created) || !item.UpdatedAt.After(created) {
+		t.Errorf("Expected creation time of %v and a later update time, got %v and %v", created, item.CreatedAt, item.UpdatedAt)
+	}
+}
+
+// errDeleteFailed is returned by every delete of a failDeleteStore.
+var errDeleteFailed = errors.New("delete failed")
+
+// failDeleteStore is a Store whose deletes always fail, including the
+// batches holding one.
+type failDeleteStore struct{ Store }
+
+func (failDeleteStore) Delete(key []byte, wo *opt.WriteOptions) error {
+	return errDeleteFailed
+}
+
+func (s failDeleteStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	var deletes deleteCounter
+	batch.Replay(&deletes)
+	if deletes > 0 {
+		return errDeleteFailed
+	}
+
+	return s.Store.Write(batch, wo)
+}
+
+// deleteCounter counts the deletes of a replayed batch.
+type deleteCounter int
+
+func (d *deleteCounter) Put(key, value []byte) {}
+
+func (d *deleteCounter) Delete(key []byte) {
+	*d++
+}
+
+func TestPriorityQueueDequeueFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value for item", 0)); err != nil {
+		t.Error(err)
+	}
+
+	// A failed delete must not hand out the item.
+	db := pq.db
+	pq.db = failDeleteStore{db}
+	item, err := pq.Dequeue()
+	if item != nil || err != errDeleteFailed {
+		t.Errorf("Expected no item and the delete error, got %v and %v", item, err)
+	}
+	if item, err = pq.DequeueByPriority(0); item != nil || err != errDeleteFailed {
+		t.Errorf("Expected no item and the delete error, got %v and %v", item, err)
+	}
+	pq.db = db
+
+	// The item is still the next one.
+	item, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item" {
+		t.Errorf("Expected string to be 'value for item', got '%s'", item.ToString())
+	}
+}
+
 func TestPriorityQueueEmpty(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	err = pq.Enqueue(NewPriorityItemString("value for item", 0))
 	if err != nil {
@@ -611,7 +1296,7 @@ func TestPriorityQueueOutOfBounds(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	err = pq.Enqueue(NewPriorityItemString("value for item", 0))
 	if err != nil {
@@ -631,7 +1316,7 @@ func BenchmarkPriorityQueueEnqueue(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	// Create dummy data for pushing
 	item := NewPriorityItemString("value", 0)
@@ -644,6 +1329,27 @@ func BenchmarkPriorityQueueEnqueue(b *testing.B) {
 	}
 }
 
+func BenchmarkPriorityQueueEnqueueBatch(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		b.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	// Create dummy data for pushing
+	items := make([]*PriorityItem, b.N)
+	for n := range items {
+		items[n] = NewPriorityItemString("value", 0)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	_, _ = pq.EnqueueBatch(items)
+}
+
 func BenchmarkPriorityQueueDequeue(b *testing.B) {
 	// Open test database
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
@@ -651,7 +1357,7 @@ func BenchmarkPriorityQueueDequeue(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 
 	// Fill with dummy data
 	for n := 0; n < b.N; n++ {
@@ -0,0 +1,377 @@
+package goque
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// prefixQueueLengthKey is the key used to persist the total number of
+// items in a prefix queue. It is shorter than any item key, so it can
+// never collide with one.
+var prefixQueueLengthKey = []byte("length")
+
+// PrefixQueue is a collection of independent FIFO queues, each one
+// identified by a prefix, stored in a single LevelDB database.
+//
+// The head and tail of each queue are persisted under the key for ID 0
+// of its prefix, which is never used by an item.
+type PrefixQueue struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	length  uint64
+	isOpen  bool
+}
+
+// OpenPrefixQueue opens a prefix queue if one exists at the given
+// directory. If one does not already exist, a new prefix queue is
+// created.
+func OpenPrefixQueue(dataDir string) (*PrefixQueue, error) {
+	var err error
+
+	// Create a new PrefixQueue.
+	pq := &PrefixQueue{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		isOpen:  false,
+	}
+
+	// Open database for the prefix queue.
+	pq.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return pq, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goquePrefixQueue)
+	if err != nil {
+		return pq, err
+	}
+	if !ok {
+		return pq, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, pq.db, goquePrefixQueue); err != nil {
+		return pq, err
+	}
+
+	// Set isOpen and return.
+	pq.isOpen = true
+	return pq, pq.init()
+}
+
+// Enqueue adds an item with the given value to the queue with the
+// given prefix.
+func (pq *PrefixQueue) Enqueue(prefix, value []byte) (*Item, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the new item.
+	item := &Item{
+		ID:    q.tail + 1,
+		Key:   generatePrefixKey(prefix, q.tail+1),
+		Value: value,
+	}
+	q.tail++
+
+	// Add it to the queue, updating the queue and total length.
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, item.Value)
+	pq.putQueue(batch, prefix, q)
+	pq.putLength(batch, pq.length+1)
+	if err = pq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	pq.length++
+
+	return item, nil
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a value
+// as a string rather than a byte slice.
+func (pq *PrefixQueue) EnqueueString(prefix, value string) (*Item, error) {
+	return pq.Enqueue([]byte(prefix), []byte(value))
+}
+
+// Dequeue removes the next item in the queue with the given prefix and
+// returns it.
+func (pq *PrefixQueue) Dequeue(prefix []byte) (*Item, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to get the next item in the queue.
+	item, err := pq.getItemByID(prefix, q, q.head+1)
+	if err != nil {
+		return nil, err
+	}
+	q.head++
+
+	// Remove this item from the queue, updating the queue and total
+	// length. Empty queues are deleted entirely.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	if q.length() == 0 {
+		batch.Delete(generatePrefixKey(prefix, 0))
+	} else {
+		pq.putQueue(batch, prefix, q)
+	}
+	pq.putLength(batch, pq.length-1)
+	if err = pq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	pq.length--
+
+	return item, nil
+}
+
+// DequeueString is a helper function for Dequeue that accepts a prefix
+// as a string rather than a byte slice.
+func (pq *PrefixQueue) DequeueString(prefix string) (*Item, error) {
+	return pq.Dequeue([]byte(prefix))
+}
+
+// Peek returns the next item in the queue with the given prefix without
+// removing it.
+func (pq *PrefixQueue) Peek(prefix []byte) (*Item, error) {
+	return pq.PeekByOffset(prefix, 0)
+}
+
+// PeekByOffset returns the item located at the given offset, starting
+// from the head of the queue with the given prefix, without removing it.
+func (pq *PrefixQueue) PeekByOffset(prefix []byte, offset uint64) (*Item, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.getItemByID(prefix, q, q.head+offset+1)
+}
+
+// PeekByID returns the item with the given ID in the queue with the
+// given prefix without removing it.
+func (pq *PrefixQueue) PeekByID(prefix []byte, id uint64) (*Item, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.getItemByID(prefix, q, id)
+}
+
+// Update updates an item in the prefix queue without changing its
+// position.
+func (pq *PrefixQueue) Update(item *Item, newValue []byte) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	item.Value = newValue
+	return pq.db.Put(item.Key, item.Value, nil)
+}
+
+// UpdateString is a helper function for Update that accepts a value
+// as a string rather than a byte slice.
+func (pq *PrefixQueue) UpdateString(item *Item, newValue string) error {
+	return pq.Update(item, []byte(newValue))
+}
+
+// PrefixLength returns the number of items in the queue with the given
+// prefix.
+func (pq *PrefixQueue) PrefixLength(prefix []byte) (uint64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the prefix queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.length(), nil
+}
+
+// Length returns the total number of items in all queues of the prefix
+// queue.
+func (pq *PrefixQueue) Length() uint64 {
+	return pq.length
+}
+
+// Close closes the LevelDB database of the prefix queue. Once closed, every
+// operation on the prefix queue returns ErrDBClosed.
+func (pq *PrefixQueue) Close() error {
+	_, err := pq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the prefix queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the prefix queue in
+// between. If check fails, the prefix queue is left as it is and the error is
+// returned. closeIf reports whether the prefix queue is closed.
+func (pq *PrefixQueue) closeIf(check func() error) (bool, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If prefix queue is already closed.
+	if !pq.isOpen {
+		return true, nil
+	}
+	pq.isOpen = false
+
+	return true, pq.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the prefix queue, as long
+// as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (pq *PrefixQueue) Drop() error {
+	return dropIf(pq.DataDir, pq.closeIf, checkEmpty(pq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the prefix queue,
+// along with any items it still holds.
+func (pq *PrefixQueue) ForceDrop() error {
+	err := pq.Close()
+	if rerr := os.RemoveAll(pq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// getQueue returns the head and tail position of the queue with the
+// given prefix.
+func (pq *PrefixQueue) getQueue(prefix []byte) (*priorityLevel, error) {
+	data, err := pq.db.Get(generatePrefixKey(prefix, 0), nil)
+	if err == leveldb.ErrNotFound {
+		return &priorityLevel{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 16 {
+		return nil, ErrInvalidRecord
+	}
+
+	return &priorityLevel{
+		head: binary.BigEndian.Uint64(data[0:8]),
+		tail: binary.BigEndian.Uint64(data[8:16]),
+	}, nil
+}
+
+// putQueue adds the head and tail position of the queue with the given
+// prefix to the batch.
+func (pq *PrefixQueue) putQueue(batch *leveldb.Batch, prefix []byte, q *priorityLevel) {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[0:8], q.head)
+	binary.BigEndian.PutUint64(data[8:16], q.tail)
+	batch.Put(generatePrefixKey(prefix, 0), data)
+}
+
+// putLength adds the total number of items to the batch.
+func (pq *PrefixQueue) putLength(batch *leveldb.Batch, length uint64) {
+	batch.Put(prefixQueueLengthKey, idToKey(length))
+}
+
+// getItemByID returns an item, if found, for the given prefix and ID.
+func (pq *PrefixQueue) getItemByID(prefix []byte, q *priorityLevel, id uint64) (*Item, error) {
+	// Check if empty or out of bounds.
+	if q.length() == 0 {
+		return nil, ErrEmpty
+	} else if id <= q.head || id > q.tail {
+		return nil, ErrOutOfBounds
+	}
+
+	var err error
+	item := &Item{ID: id, Key: generatePrefixKey(prefix, id)}
+	item.Value, err = pq.db.Get(item.Key, nil)
+
+	return item, err
+}
+
+// init initializes the prefix queue data.
+func (pq *PrefixQueue) init() error {
+	data, err := pq.db.Get(prefixQueueLengthKey, nil)
+	if err == leveldb.ErrNotFound {
+		pq.length = 0
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 8 {
+		return ErrInvalidRecord
+	}
+	pq.length = keyToID(data)
+
+	return nil
+}
+
+// generatePrefixKey creates a key for the given prefix and ID to be
+// used with LevelDB.
+func generatePrefixKey(prefix []byte, id uint64) []byte {
+	// prefix + prefixSep + key = n + 1 + 8
+	key := make([]byte, len(prefix)+9)
+	copy(key, prefix)
+	key[len(prefix)] = prefixSep[0]
+	copy(key[len(prefix)+1:], idToKey(id))
+	return key
+}
@@ -0,0 +1,309 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPrefixQueueDrop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); os.IsNotExist(err) {
+		t.Error(err)
+	}
+
+	pq.Drop()
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestPrefixQueueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Enqueue, got %v", err)
+	}
+
+	if _, err = pq.DequeueString("prefix"); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Dequeue, got %v", err)
+	}
+
+	if _, err = pq.Peek([]byte("prefix")); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Peek, got %v", err)
+	}
+
+	if err = pq.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrefixQueueIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+	q.Close()
+
+	if _, err = OpenPrefixQueue(file); err != ErrIncompatibleType {
+		t.Error("Expected prefix queue to return ErrIncompatibleTypes when opening Queue")
+	}
+}
+
+func TestPrefixQueueEnqueueDequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for _, prefix := range []string{"a", "ab", ""} {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("value for %s item %d", prefix, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if pq.Length() != 30 {
+		t.Errorf("Expected total length of 30, got %d", pq.Length())
+	}
+
+	item, err := pq.DequeueString("ab")
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for ab item 1"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	length, err := pq.PrefixLength([]byte("ab"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length != 9 {
+		t.Errorf("Expected prefix length of 9, got %d", length)
+	}
+
+	length, err = pq.PrefixLength([]byte("a"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if length != 10 {
+		t.Errorf("Expected prefix length of 10, got %d", length)
+	}
+}
+
+func TestPrefixQueuePeek(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := pq.Peek([]byte("prefix"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	item, err = pq.PeekByOffset([]byte("prefix"), 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 5"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	item, err = pq.PeekByID([]byte("prefix"), 7)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 7"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if _, err = pq.PeekByID([]byte("prefix"), 11); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+}
+
+func TestPrefixQueueUpdate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	item, err := pq.EnqueueString("prefix", "value for item")
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "new value for item"
+	if err = pq.UpdateString(item, compStr); err != nil {
+		t.Error(err)
+	}
+
+	newItem, err := pq.Peek([]byte("prefix"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, newItem.ToString())
+	}
+}
+
+func TestPrefixQueueReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = pq.DequeueString("prefix"); err != nil {
+		t.Error(err)
+	}
+
+	pq.Close()
+
+	pq, err = OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected total length of 2, got %d", pq.Length())
+	}
+
+	item, err := pq.DequeueString("prefix")
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestPrefixQueueEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString("prefix", "value for item"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.DequeueString("prefix"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.DequeueString("prefix"); err != ErrEmpty {
+		t.Errorf("Expected to get queue empty error, got %v", err)
+	}
+
+	if _, err = pq.DequeueString("other"); err != ErrEmpty {
+		t.Errorf("Expected to get queue empty error, got %v", err)
+	}
+}
+
+func BenchmarkPrefixQueueEnqueue(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		b.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	prefix := []byte("prefix")
+	value := []byte("value")
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = pq.Enqueue(prefix, value)
+	}
+}
+
+func BenchmarkPrefixQueueDequeue(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		b.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	// Fill with dummy data
+	prefix := []byte("prefix")
+	for n := 0; n < b.N; n++ {
+		if _, err := pq.Enqueue(prefix, []byte("value")); err != nil {
+			b.Error(err)
+		}
+	}
+
+	// Start benchmark
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = pq.Dequeue(prefix)
+	}
+}
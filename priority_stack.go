@@ -0,0 +1,367 @@
+package goque
+
+import (
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// PriorityStack is a LIFO (last in, first out) stack with priority
+// levels, for depth-first scheduling: Pop returns the newest item of the
+// most important priority level that has items. Each level is a stack
+// of its own, kept with the same head and tail positions as the levels
+// of a PriorityQueue, where the tail is the top.
+//
+// Only the ID, priority and value of an item are stored, so Headers,
+// CreatedAt and UpdatedAt are ignored.
+type PriorityStack struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	order   order
+	levels  [256]*priorityLevel
+	active  levelSet
+	isOpen  bool
+}
+
+// OpenPriorityStack opens a priority stack if one exists at the given
+// directory. If one does not already exist, a new priority stack is
+// created.
+//
+// With the ASC order, priority level 0 is the most important, and with
+// DESC level 255 is. The RR order isn't supported, and is treated as ASC.
+// The order only affects pops, so it can change between opens.
+func OpenPriorityStack(dataDir string, order order) (*PriorityStack, error) {
+	var err error
+
+	// Create a new PriorityStack.
+	ps := &PriorityStack{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		order:   order,
+		isOpen:  false,
+	}
+
+	// Open database for the priority stack.
+	ps.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return ps, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goquePriorityStack)
+	if err != nil {
+		return ps, err
+	}
+	if !ok {
+		return ps, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, ps.db, goquePriorityStack); err != nil {
+		return ps, err
+	}
+
+	// Set isOpen and return.
+	ps.isOpen = true
+	return ps, ps.init()
+}
+
+// Push adds an item to the top of its priority level.
+func (ps *PriorityStack) Push(item *PriorityItem) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		return ErrDBClosed
+	}
+
+	// Get the priorityLevel.
+	level := ps.levels[item.Priority]
+
+	// Set item ID and key.
+	item.ID = level.tail + 1
+	item.Key = generatePSKey(item.Priority, item.ID)
+
+	// Add it to the priority stack.
+	if err := ps.db.Put(item.Key, item.Value, nil); err != nil {
+		return err
+	}
+
+	// Increment tail position.
+	level.tail++
+	ps.active.set(item.Priority, true)
+
+	return nil
+}
+
+// PushValue is a helper function for Push that creates the item for the
+// given priority level and value, and returns it.
+func (ps *PriorityStack) PushValue(priority uint8, value []byte) (*PriorityItem, error) {
+	item := NewPriorityItem(value, priority)
+	if err := ps.Push(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// PushString is a helper function for PushValue that accepts a value as
+// a string rather than a byte slice.
+func (ps *PriorityStack) PushString(priority uint8, value string) (*PriorityItem, error) {
+	return ps.PushValue(priority, []byte(value))
+}
+
+// Pop removes the newest item of the most important priority level
+// that has items, and returns it.
+func (ps *PriorityStack) Pop() (*PriorityItem, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	priority, ok := ps.topLevel()
+	if !ok {
+		return nil, ErrEmpty
+	}
+
+	return ps.pop(priority)
+}
+
+// PopByPriority removes the newest item of the given priority level and
+// returns it.
+func (ps *PriorityStack) PopByPriority(priority uint8) (*PriorityItem, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return ps.pop(priority)
+}
+
+// Peek returns the item Pop would return, without removing it.
+func (ps *PriorityStack) Peek() (*PriorityItem, error) {
+	ps.RLock()
+	defer ps.RUnlock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	priority, ok := ps.topLevel()
+	if !ok {
+		return nil, ErrEmpty
+	}
+
+	return ps.getItemByPriorityID(priority, ps.levels[priority].tail)
+}
+
+// Update updates an item in the priority stack without changing its
+// position.
+func (ps *PriorityStack) Update(item *PriorityItem, newValue []byte) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	// If the priority stack is closed.
+	if !ps.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if item exists in the priority stack.
+	level := ps.levels[item.Priority]
+	if item.ID <= level.head || item.ID > level.tail {
+		return ErrOutOfBounds
+	}
+
+	item.Value = newValue
+	return ps.db.Put(item.Key, item.Value, nil)
+}
+
+// UpdateString is a helper function for Update that accepts a value as
+// a string rather than a byte slice.
+func (ps *PriorityStack) UpdateString(item *PriorityItem, newValue string) error {
+	return ps.Update(item, []byte(newValue))
+}
+
+// LengthByPriority returns the number of items in the given priority
+// level.
+func (ps *PriorityStack) LengthByPriority(priority uint8) uint64 {
+	ps.RLock()
+	defer ps.RUnlock()
+
+	return ps.levels[priority].length()
+}
+
+// Length returns the total number of items in the priority stack.
+func (ps *PriorityStack) Length() uint64 {
+	var length uint64
+	for _, priority := range ps.active.levels() {
+		length += ps.levels[priority].length()
+	}
+
+	return length
+}
+
+// Close closes the LevelDB database of the priority stack. Once closed,
+// every operation on the priority stack returns ErrDBClosed.
+func (ps *PriorityStack) Close() error {
+	_, err := ps.closeIf(nil)
+	return err
+}
+
+// closeIf closes the priority stack like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the priority stack in
+// between. If check fails, the priority stack is left as it is and the error is
+// returned. closeIf reports whether the priority stack is closed.
+func (ps *PriorityStack) closeIf(check func() error) (bool, error) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If priority stack is already closed.
+	if !ps.isOpen {
+		return true, nil
+	}
+	ps.isOpen = false
+
+	return true, ps.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the priority stack, as
+// long as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (ps *PriorityStack) Drop() error {
+	return dropIf(ps.DataDir, ps.closeIf, checkEmpty(ps.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the priority
+// stack, along with any items it still holds.
+func (ps *PriorityStack) ForceDrop() error {
+	err := ps.Close()
+	if rerr := os.RemoveAll(ps.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// topLevel returns the most important priority level that has items,
+// and false if there is none. The caller must hold the lock.
+func (ps *PriorityStack) topLevel() (uint8, bool) {
+	levels := ps.active.levels()
+	if len(levels) == 0 {
+		return 0, false
+	}
+
+	if ps.order == DESC {
+		return levels[len(levels)-1], true
+	}
+	return levels[0], true
+}
+
+// pop removes the item at the top of the given priority level and
+// returns it. The caller must hold the lock.
+func (ps *PriorityStack) pop(priority uint8) (*PriorityItem, error) {
+	// Try to get the top item of the priority level.
+	level := ps.levels[priority]
+	item, err := ps.getItemByPriorityID(priority, level.tail)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the priority stack.
+	if err := ps.db.Delete(item.Key, nil); err != nil {
+		return nil, err
+	}
+
+	// Decrement tail position.
+	level.tail--
+	ps.active.set(priority, level.length() > 0)
+
+	return item, nil
+}
+
+// getItemByPriorityID returns an item, if found, for the given priority
+// level and ID.
+func (ps *PriorityStack) getItemByPriorityID(priority uint8, id uint64) (*PriorityItem, error) {
+	// Check if empty or out of bounds.
+	level := ps.levels[priority]
+	if level.length() == 0 {
+		return nil, ErrEmpty
+	} else if id <= level.head || id > level.tail {
+		return nil, ErrOutOfBounds
+	}
+
+	// Get the stored value of the item.
+	key := generatePSKey(priority, id)
+	value, err := ps.db.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &PriorityItem{
+		ID:       id,
+		Priority: priority,
+		Key:      key,
+		Value:    value,
+	}
+
+	return item, nil
+}
+
+// init initializes the priority stack data, finding the positions of
+// each priority level by scanning its items.
+func (ps *PriorityStack) init() error {
+	for i := 0; i <= 255; i++ {
+		// Create a new LevelDB Iterator for this priority level.
+		prefix := generatePSKey(uint8(i), 0)[:2]
+		iter := ps.db.NewIterator(util.BytesPrefix(prefix), nil)
+
+		// Set the priority level head and tail to the first and last
+		// item.
+		pl := &priorityLevel{}
+		if iter.First() {
+			pl.head = keyToID(iter.Key()[2:]) - 1
+		}
+		if iter.Last() {
+			pl.tail = keyToID(iter.Key()[2:])
+		}
+
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		}
+
+		ps.levels[i] = pl
+		ps.active.set(uint8(i), pl.length() > 0)
+	}
+
+	return nil
+}
+
+// generatePSKey creates a key ordered by the given priority level, then
+// by the ID, laid out like the keys of a PriorityQueue.
+func generatePSKey(priority uint8, id uint64) []byte {
+	// priority + prefixSep + id = 1 + 1 + 8 = 10
+	key := make([]byte, 10)
+	key[0] = priority
+	key[1] = prefixSep[0]
+	copy(key[2:], idToKey(id))
+	return key
+}
@@ -0,0 +1,170 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityStackPop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	ps, err := OpenPriorityStack(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.ForceDrop()
+
+	for i, p := range []uint8{5, 2, 5, 2, 200, 2} {
+		if _, err = ps.PushString(p, fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ps.Length() != 6 {
+		t.Errorf("Expected stack length of 6, got %d", ps.Length())
+	}
+	if ps.LengthByPriority(2) != 3 {
+		t.Errorf("Expected level length of 3, got %d", ps.LengthByPriority(2))
+	}
+
+	item, err := ps.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value5" || item.Priority != 2 {
+		t.Errorf("Expected 'value5' with priority 2, got '%s' with %d", item.ToString(), item.Priority)
+	}
+
+	// The newest item of the most important level goes first, and a push
+	// onto it goes on top.
+	for _, want := range []string{"value5", "value3"} {
+		item, err := ps.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = ps.PushString(2, "value6"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"value6", "value1", "value2", "value0", "value4"} {
+		item, err := ps.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = ps.Pop(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	if _, err = ps.PopByPriority(2); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestPriorityStackDesc(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	ps, err := OpenPriorityStack(file, DESC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.ForceDrop()
+
+	for i, p := range []uint8{1, 9, 9, 1} {
+		if _, err = ps.PushString(p, fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, err := ps.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value2" {
+		t.Errorf("Expected 'value2', got '%s'", item.ToString())
+	}
+	if item, err = ps.PopByPriority(1); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value3" {
+		t.Errorf("Expected 'value3', got '%s'", item.ToString())
+	}
+
+	// The positions are found again after reopening.
+	if err = ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ps.Pop(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+	if ps, err = OpenPriorityStack(file, DESC); err != nil {
+		t.Fatal(err)
+	}
+	if ps.Length() != 2 {
+		t.Errorf("Expected stack length of 2, got %d", ps.Length())
+	}
+	item, err = ps.PushString(9, "value4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 2 {
+		t.Errorf("Expected ID 2, got %d", item.ID)
+	}
+	if err = ps.UpdateString(item, "value5"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"value5", "value1", "value0"} {
+		item, err := ps.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if err = ps.Drop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriorityStackBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	ps, err := OpenPriorityStack(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.ForceDrop()
+
+	if _, err = ps.PushString(7, "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = ps.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "priority stack" {
+		t.Errorf("Expected type 'priority stack', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenPriorityStack(file+"_restore", ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" || item.Priority != 7 {
+		t.Errorf("Expected 'value' with priority 7, got '%s' with %d", item.ToString(), item.Priority)
+	}
+}
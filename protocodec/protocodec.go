@@ -0,0 +1,50 @@
+// Package protocodec provides a goque.Codec for protocol buffer
+// messages.
+package protocodec
+
+import (
+	"errors"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotMessage is returned when encoding or decoding a value that is
+// not a proto.Message.
+var ErrNotMessage = errors.New("protocodec: Value is not a proto.Message")
+
+// Codec is a goque.Codec for values implementing proto.Message.
+type Codec struct{}
+
+// Marshal encodes the given message using the protocol buffer wire
+// format.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotMessage
+	}
+
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes the given data into the message v. v may also be a
+// pointer to a message pointer, as used by the goque typed wrappers, in
+// which case a new message is allocated if it is nil.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	// Allocate the message a pointer to a nil message pointer refers to.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+
+	return ErrNotMessage
+}
@@ -0,0 +1,60 @@
+package protocodec
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var _ goque.Codec = Codec{}
+
+func TestCodec(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueObjectWithCodec(wrapperspb.String("value"), 0, Codec{}); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var msg wrapperspb.StringValue
+	if err = item.ToObjectWithCodec(&msg, Codec{}); err != nil {
+		t.Error(err)
+	}
+
+	if msg.GetValue() != "value" {
+		t.Errorf("Expected message value to be 'value', got '%s'", msg.GetValue())
+	}
+
+	// Decode into a pointer to a nil message pointer.
+	var ptr *wrapperspb.StringValue
+	if err = item.ToObjectWithCodec(&ptr, Codec{}); err != nil {
+		t.Error(err)
+	}
+
+	if ptr.GetValue() != "value" {
+		t.Errorf("Expected message value to be 'value', got '%s'", ptr.GetValue())
+	}
+}
+
+func TestCodecNotMessage(t *testing.T) {
+	if _, err := (Codec{}).Marshal("value"); err != ErrNotMessage {
+		t.Errorf("Expected to get not message error, got %v", err)
+	}
+
+	var s string
+	if err := (Codec{}).Unmarshal(nil, &s); err != ErrNotMessage {
+		t.Errorf("Expected to get not message error, got %v", err)
+	}
+}
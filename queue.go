@@ -3,8 +3,10 @@ package goque
 import (
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 // Queue is a standard FIFO (first in, first out) queue.
@@ -14,6 +16,11 @@ type Queue struct {
 	db      *leveldb.DB
 	head    uint64
 	tail    uint64
+	format  uint8
+	seal    valueSeal
+	dedup   time.Duration
+	wo      *opt.WriteOptions
+	durable Durability
 	isOpen  bool
 }
 
@@ -46,6 +53,19 @@ func OpenQueue(dataDir string) (*Queue, error) {
 		return q, ErrIncompatibleType
 	}
 
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, q.db, goqueQueue); err != nil {
+		return q, err
+	}
+
+	// Get the on-disk format of the item values.
+	if q.format, err = goqueFormat(dataDir); err != nil {
+		return q, err
+	}
+	if q.format > formatEnvelope {
+		return q, ErrUnsupportedFormat
+	}
+
 	// Set isOpen and return.
 	q.isOpen = true
 	return q, q.init()
@@ -56,12 +76,35 @@ func (q *Queue) Enqueue(item *Item) error {
 	q.Lock()
 	defer q.Unlock()
 
-	// Set item ID and key.
+	// If the queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	return q.enqueue(item, nil)
+}
+
+// enqueue adds the given item to the queue, along with the given
+// deduplication record if not nil. The caller must hold the lock.
+func (q *Queue) enqueue(item *Item, dedup *dedupEntry) error {
+	// Set item ID, key and timestamps.
 	item.ID = q.tail + 1
 	item.Key = idToKey(item.ID)
+	stampItem(q.format, item)
 
 	// Add it to the queue.
-	err := q.db.Put(item.Key, item.Value, nil)
+	value, err := encodeItemValue(q.format, q.seal, item.Key, item)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, value)
+	if dedup != nil {
+		if err = dedup.put(q.db, batch, item.Key); err != nil {
+			return err
+		}
+	}
+	err = q.db.Write(batch, q.wo)
 	if err == nil {
 		q.tail++
 	}
@@ -69,20 +112,77 @@ func (q *Queue) Enqueue(item *Item) error {
 	return err
 }
 
-// Dequeue removes the next item in the queue and returns it.
+// EnqueueValue creates an item with the given value, adds it to the
+// queue and returns it with its ID, key and timestamps set.
+func (q *Queue) EnqueueValue(value []byte) (*Item, error) {
+	item := NewItem(value)
+	if err := q.Enqueue(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// EnqueueString is a helper function for EnqueueValue that accepts a
+// value as a string rather than a byte slice.
+func (q *Queue) EnqueueString(value string) (*Item, error) {
+	return q.EnqueueValue([]byte(value))
+}
+
+// enqueueBatch adds the given items to the queue using a single
+// LevelDB batch.
+func (q *Queue) enqueueBatch(items []*Item) error {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Set the item IDs and keys.
+	batch := new(leveldb.Batch)
+	for i, item := range items {
+		item.ID = q.tail + uint64(i) + 1
+		item.Key = idToKey(item.ID)
+		stampItem(q.format, item)
+		value, err := encodeItemValue(q.format, q.seal, item.Key, item)
+		if err != nil {
+			return err
+		}
+		batch.Put(item.Key, value)
+	}
+
+	// Add them to the queue.
+	err := q.db.Write(batch, q.wo)
+	if err == nil {
+		q.tail += uint64(len(items))
+	}
+
+	return err
+}
+
+// Dequeue removes the next item in the queue and returns it. As with
+// PriorityQueue.Dequeue, the item is deleted in a single write before it
+// is returned, and never returned together with an error.
 func (q *Queue) Dequeue() (*Item, error) {
 	q.Lock()
 	defer q.Unlock()
 
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	// Try to get the next item in the queue.
 	item, err := q.getItemByID(q.head + 1)
 	if err != nil {
-		return item, err
+		return nil, err
 	}
 
 	// Remove this item from the queue.
-	if err := q.db.Delete(item.Key, nil); err != nil {
-		return item, err
+	if err := q.db.Delete(item.Key, q.wo); err != nil {
+		return nil, err
 	}
 
 	// Increment position.
@@ -95,6 +195,12 @@ func (q *Queue) Dequeue() (*Item, error) {
 func (q *Queue) Peek() (*Item, error) {
 	q.RLock()
 	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return q.getItemByID(q.head + 1)
 }
 
@@ -103,6 +209,12 @@ func (q *Queue) Peek() (*Item, error) {
 func (q *Queue) PeekByOffset(offset uint64) (*Item, error) {
 	q.RLock()
 	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return q.getItemByID(q.head + offset + 1)
 }
 
@@ -110,15 +222,79 @@ func (q *Queue) PeekByOffset(offset uint64) (*Item, error) {
 func (q *Queue) PeekByID(id uint64) (*Item, error) {
 	q.RLock()
 	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return q.getItemByID(id)
 }
 
+// PeekByIDs returns the items with the given IDs without removing them,
+// fetching all of them in a single pass. The returned slice is in the
+// same order as ids and contains nil for any ID not currently in the
+// queue.
+func (q *Queue) PeekByIDs(ids []uint64) ([]*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Collect the keys of the IDs within range in ascending order.
+	var keys [][]byte
+	var indexes []int
+	for _, i := range sortedIndexes(ids) {
+		if ids[i] > q.head && ids[i] <= q.tail {
+			keys = append(keys, idToKey(ids[i]))
+			indexes = append(indexes, i)
+		}
+	}
+
+	// Fetch all of the values at once.
+	values, err := multiGet(q.db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, len(ids))
+	for j, i := range indexes {
+		if values[j] != nil {
+			items[i] = &Item{ID: ids[i], Key: keys[j]}
+			if err = decodeItemValue(q.format, q.seal, items[i], values[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return items, nil
+}
+
 // Update updates an item in the queue without changing its position.
+// The headers of the item are stored as they are set on it, and its
+// update time is set to the current time.
 func (q *Queue) Update(item *Item, newValue []byte) error {
 	q.Lock()
 	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
 	item.Value = newValue
-	return q.db.Put(item.Key, item.Value, nil)
+	if q.format != formatRaw {
+		item.UpdatedAt = time.Now()
+	}
+	value, err := encodeItemValue(q.format, q.seal, item.Key, item)
+	if err != nil {
+		return err
+	}
+
+	return q.db.Put(item.Key, value, q.wo)
 }
 
 // UpdateString is a helper function for Update that accepts a value
@@ -132,21 +308,62 @@ func (q *Queue) Length() uint64 {
 	return q.tail - q.head
 }
 
-// Close closes the LevelDB database of the queue.
-func (q *Queue) Close() {
+// Close closes the LevelDB database of the queue. Once closed, every
+// operation on the queue returns ErrDBClosed.
+func (q *Queue) Close() error {
+	_, err := q.closeIf(nil)
+	return err
+}
+
+// closeIf closes the queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the queue in
+// between. If check fails, the queue is left as it is and the error is
+// returned. closeIf reports whether the queue is closed.
+func (q *Queue) closeIf(check func() error) (bool, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
 	// If queue is already closed.
 	if !q.isOpen {
-		return
+		return true, nil
 	}
-
-	q.db.Close()
 	q.isOpen = false
+
+	// Sync the writes of a batched queue.
+	var err error
+	if q.durable == DurabilityBatched {
+		err = syncDB(q.db)
+	}
+
+	if cerr := q.db.Close(); err == nil {
+		err = cerr
+	}
+
+	return true, err
 }
 
-// Drop closes and deletes the LevelDB database of the queue.
-func (q *Queue) Drop() {
-	q.Close()
-	os.RemoveAll(q.DataDir)
+// Drop closes and deletes the LevelDB database of the queue, as long
+// as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (q *Queue) Drop() error {
+	return dropIf(q.DataDir, q.closeIf, checkEmpty(q.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the queue,
+// along with any items it still holds.
+func (q *Queue) ForceDrop() error {
+	err := q.Close()
+	if rerr := os.RemoveAll(q.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
 }
 
 // getItemByID returns an item, if found, for the given ID.
@@ -158,32 +375,26 @@ func (q *Queue) getItemByID(id uint64) (*Item, error) {
 		return nil, ErrOutOfBounds
 	}
 
-	var err error
 	item := &Item{ID: id, Key: idToKey(id)}
-	item.Value, err = q.db.Get(item.Key, nil)
+	data, err := q.db.Get(item.Key, nil)
+	if err != nil {
+		return item, err
+	}
 
-	return item, err
+	return item, decodeItemValue(q.format, q.seal, item, data)
 }
 
 // init initializes the queue data.
 func (q *Queue) init() error {
-	// Create a new LevelDB Iterator.
-	iter := q.db.NewIterator(nil, nil)
-	defer iter.Release()
-
-	// Set queue head to the first item.
-	if iter.First() {
-		q.head = keyToID(iter.Key()) - 1
-	} else {
-		q.head = 0
+	// Discard the positions persisted by a stack using the same data
+	// directory, as the queue is about to change them.
+	if _, err := takeMeta(q.db, q.wo); err != nil {
+		return err
 	}
 
-	// Set queue tail to the last item.
-	if iter.Last() {
-		q.tail = keyToID(iter.Key())
-	} else {
-		q.tail = 0
-	}
+	// Set queue head to the first item and tail to the last item.
+	var err error
+	q.tail, q.head, err = scanEnds(q.db)
 
-	return iter.Error()
+	return err
 }
@@ -2,7 +2,9 @@ package goque
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -25,13 +27,54 @@ func TestQueueDrop(t *testing.T) {
 	}
 }
 
+func TestQueueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Enqueue(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Enqueue(NewItemString("value")); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Enqueue, got %v", err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Dequeue, got %v", err)
+	}
+
+	if _, err = q.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Peek, got %v", err)
+	}
+
+	// Closing again is a no-op.
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
 func TestQueueIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 	pq.Close()
 
 	if _, err = OpenQueue(file); err != ErrIncompatibleType {
@@ -45,7 +88,7 @@ func TestQueueEnqueue(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -59,13 +102,48 @@ func TestQueueEnqueue(t *testing.T) {
 	}
 }
 
+func TestQueueEnqueueValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if _, err = q.EnqueueValue([]byte("value for item 1")); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.EnqueueString("value for item 2")
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ID != 2 || item.CreatedAt.IsZero() {
+		t.Errorf("Expected item 2 with a creation time, got %d and %v", item.ID, item.CreatedAt)
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", item.ToString())
+	}
+
+	q.Close()
+
+	if _, err = q.EnqueueString("value"); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
 func TestQueueDequeue(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -100,7 +178,7 @@ func TestQueuePeek(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	compStr := "value for item"
 
@@ -128,7 +206,7 @@ func TestQueuePeekByOffset(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -179,7 +257,7 @@ func TestQueuePeekByID(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -204,13 +282,53 @@ func TestQueuePeekByID(t *testing.T) {
 	}
 }
 
+func TestQueuePeekByIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		item := NewItemString(fmt.Sprintf("value for item %d", i))
+		if err = q.Enqueue(item); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := q.PeekByIDs([]uint64{7, 2, 11, 5})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, id := range []uint64{7, 2} {
+		compStr := fmt.Sprintf("value for item %d", id)
+		if items[i].ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, items[i].ToString())
+		}
+	}
+
+	if items[2] != nil {
+		t.Error("Expected item for out of range ID to be nil")
+	}
+
+	if items[3].ID != 5 {
+		t.Errorf("Expected item ID to be 5, got %d", items[3].ID)
+	}
+}
+
 func TestQueueUpdate(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -255,7 +373,7 @@ func TestQueueUpdateString(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -294,13 +412,97 @@ func TestQueueUpdateString(t *testing.T) {
 	}
 }
 
+func TestQueueMetadata(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	item := NewItemString("value for item")
+	item.Headers = map[string]string{"correlation-id": "abc123"}
+	if err = q.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+	if item.CreatedAt.IsZero() || !item.UpdatedAt.Equal(item.CreatedAt) {
+		t.Errorf("Expected creation and update times to be set, got %v and %v", item.CreatedAt, item.UpdatedAt)
+	}
+	created := item.CreatedAt
+
+	// Reopen the queue, which should keep the metadata.
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item" {
+		t.Errorf("Expected string to be 'value for item', got '%s'", item.ToString())
+	}
+	if len(item.Headers) != 1 || item.Headers["correlation-id"] != "abc123" {
+		t.Errorf("Expected the headers to be kept, got %v", item.Headers)
+	}
+	if !item.CreatedAt.Equal(created) || !item.UpdatedAt.Equal(created) {
+		t.Errorf("Expected creation and update times of %v, got %v and %v", created, item.CreatedAt, item.UpdatedAt)
+	}
+}
+
+func TestQueueRawFormat(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+
+	// Create a data directory the way older versions of Goque did.
+	if err := os.MkdirAll(file, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(goqueQueue)}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	item := NewItemString("value for item")
+	item.Headers = map[string]string{"correlation-id": "abc123"}
+	if err = q.Enqueue(item); err != nil {
+		t.Error(err)
+	}
+
+	// Values must still be stored as is.
+	value, err := q.db.Get(idToKey(1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item"
+	if string(value) != compStr {
+		t.Errorf("Expected stored value to be '%s', got '%s'", compStr, value)
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != compStr || item.Headers != nil || !item.CreatedAt.IsZero() {
+		t.Errorf("Expected item '%s' without metadata, got '%s' with %v and %v", compStr, item.ToString(), item.Headers, item.CreatedAt)
+	}
+}
+
 func TestQueueEmpty(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	err = q.Enqueue(NewItemString("value for item"))
 	if err != nil {
@@ -324,7 +526,7 @@ func TestQueueOutOfBounds(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	err = q.Enqueue(NewItemString("value for item"))
 	if err != nil {
@@ -344,7 +546,7 @@ func BenchmarkQueueEnqueue(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	// Create dummy data for pushing
 	item := NewItemString("value")
@@ -364,7 +566,7 @@ func BenchmarkQueueDequeue(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer q.Drop()
+	defer q.ForceDrop()
 
 	// Fill with dummy data
 	item := NewItemString("value")
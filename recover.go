@@ -0,0 +1,99 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Recovery reports how opening a data structure with recovery went.
+type Recovery struct {
+	// Recovered is true if the LevelDB database was corrupted, and had
+	// to be recovered before it could be opened.
+	Recovered bool
+
+	// Items is the number of items found once the data structure was
+	// opened, all of which were salvaged if Recovered is true.
+	Items uint64
+}
+
+// OpenPriorityQueueWithRecovery is like OpenPriorityQueueWithOptions,
+// but if the LevelDB database is corrupted, such as its manifest after a
+// power loss, it is recovered with leveldb.RecoverFile first. Recovery
+// rebuilds the database from the table and journal files that can still
+// be read, dropping what can't, and the positions of the items are then
+// found again by scanning them. The returned Recovery reports whether
+// the database was recovered and how many items it holds.
+func OpenPriorityQueueWithRecovery(dataDir string, order order, o *opt.Options) (*PriorityQueue, *Recovery, error) {
+	recovered, err := recoverDB(dataDir, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pq, err := OpenPriorityQueueWithOptions(dataDir, order, o)
+	if err != nil {
+		return pq, nil, err
+	}
+
+	return pq, &Recovery{Recovered: recovered, Items: pq.Length()}, nil
+}
+
+// OpenStackWithRecovery is like OpenStackWithOptions, but recovers a
+// corrupted LevelDB database first, the same way as
+// OpenPriorityQueueWithRecovery.
+func OpenStackWithRecovery(dataDir string, o *opt.Options) (*Stack, *Recovery, error) {
+	recovered, err := recoverDB(dataDir, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := OpenStackWithOptions(dataDir, o)
+	if err != nil {
+		return s, nil, err
+	}
+
+	return s, &Recovery{Recovered: recovered, Items: s.Length()}, nil
+}
+
+// OpenQueueWithRecovery is like OpenQueue, but recovers a corrupted
+// LevelDB database first, the same way as
+// OpenPriorityQueueWithRecovery.
+func OpenQueueWithRecovery(dataDir string) (*Queue, *Recovery, error) {
+	recovered, err := recoverDB(dataDir, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := OpenQueue(dataDir)
+	if err != nil {
+		return q, nil, err
+	}
+
+	return q, &Recovery{Recovered: recovered, Items: q.Length()}, nil
+}
+
+// recoverDB recovers the LevelDB database at dataDir with
+// leveldb.RecoverFile if it can't be opened because it is corrupted,
+// returning whether it was. The positions persisted on close are
+// deleted from a recovered database, as they may no longer match its
+// items.
+func recoverDB(dataDir string, o *opt.Options) (bool, error) {
+	db, err := leveldb.OpenFile(dataDir, o)
+	if err == nil {
+		return false, db.Close()
+	}
+	if !errors.IsCorrupted(err) {
+		return false, err
+	}
+
+	if db, err = leveldb.RecoverFile(dataDir, o); err != nil {
+		return true, err
+	}
+
+	err = db.Delete(metaKey, nil)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+
+	return true, err
+}
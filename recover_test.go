@@ -0,0 +1,112 @@
+package goque
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// corruptManifest overwrites the manifest of the LevelDB database at
+// dataDir with garbage.
+func corruptManifest(t *testing.T, dataDir string) {
+	manifests, err := filepath.Glob(filepath.Join(dataDir, "MANIFEST-*"))
+	if err != nil || len(manifests) == 0 {
+		t.Fatalf("Expected a manifest, got %v and %v", manifests, err)
+	}
+
+	for _, path := range manifests {
+		if err = ioutil.WriteFile(path, []byte("corrupted manifest"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPriorityQueueWithRecovery(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(uint8(i%3), fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	pq.Close()
+
+	// An intact database opens as it is.
+	pq, rec, err := OpenPriorityQueueWithRecovery(file, ASC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Recovered || rec.Items != 9 {
+		t.Errorf("Expected 9 items without recovery, got %+v", rec)
+	}
+	pq.Close()
+
+	corruptManifest(t, file)
+	if _, err = OpenPriorityQueue(file, ASC); !errors.IsCorrupted(err) {
+		t.Fatalf("Expected a corrupted database, got %v", err)
+	}
+
+	pq, rec, err = OpenPriorityQueueWithRecovery(file, ASC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Recovered || rec.Items != 9 {
+		t.Errorf("Expected 9 items to be recovered, got %+v", rec)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 6" {
+		t.Errorf("Expected 'value 6', got '%s'", item.ToString())
+	}
+	pq.Close()
+}
+
+func TestQueueWithRecovery(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+
+	corruptManifest(t, file)
+
+	q, rec, err := OpenQueueWithRecovery(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Recovered || rec.Items != 5 {
+		t.Errorf("Expected 5 items to be recovered, got %+v", rec)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 1" {
+		t.Errorf("Expected 'value 1', got '%s'", item.ToString())
+	}
+	q.Close()
+}
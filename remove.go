@@ -0,0 +1,268 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// removedPrefix is the key prefix of the tombstones left by items
+// removed from the middle of a priority level or stack.
+var removedPrefix = []byte("goque:removed:")
+
+// removedIDs is the sorted list of IDs removed from between the two
+// ends of a priority level or stack.
+type removedIDs []uint64
+
+func (r removedIDs) Len() int           { return len(r) }
+func (r removedIDs) Less(i, j int) bool { return r[i] < r[j] }
+func (r removedIDs) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// with returns a copy of the list with the given ID added. The list is
+// copied, as snapshots and transactions may share it.
+func (r removedIDs) with(id uint64) removedIDs {
+	i := 0
+	for i < len(r) && r[i] < id {
+		i++
+	}
+
+	c := make(removedIDs, 0, len(r)+1)
+	c = append(c, r[:i]...)
+	c = append(c, id)
+	return append(c, r[i:]...)
+}
+
+// trim narrows the range of IDs after low up to high until the IDs at
+// both ends are not removed ones, returning the removed IDs left within
+// the range.
+func (r removedIDs) trim(low, high *uint64) removedIDs {
+	for len(r) > 0 && r[0] <= *low+1 {
+		if r[0] == *low+1 {
+			*low++
+		}
+		r = r[1:]
+	}
+	for len(r) > 0 && r[len(r)-1] >= *high {
+		if r[len(r)-1] == *high {
+			*high--
+		}
+		r = r[:len(r)-1]
+	}
+
+	return r
+}
+
+// after returns the ID n IDs after the given one, skipping removed IDs.
+func (r removedIDs) after(id, n uint64) uint64 {
+	id += n
+	for _, removed := range r {
+		if removed > id {
+			break
+		}
+		id++
+	}
+
+	return id
+}
+
+// before returns the ID n IDs before the given one, skipping removed
+// IDs.
+func (r removedIDs) before(id, n uint64) uint64 {
+	id -= n
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i] < id {
+			break
+		}
+		id--
+	}
+
+	return id
+}
+
+// RemoveByPriorityID removes the item with the given ID and priority
+// from the priority queue and returns it, wherever it is in its
+// priority level.
+//
+// An item removed from the middle of its priority level leaves a
+// tombstone behind, so the gap is skipped once it reaches the head.
+//
+// An item whose value doesn't match its checksum is removed all the
+// same, and returned without its value, so it doesn't block its
+// priority level.
+func (pq *PriorityQueue) RemoveByPriorityID(priority uint8, id uint64) (*PriorityItem, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the item, falling back to its key if it is corrupted.
+	item, err := pq.getItemByPriorityID(priority, id)
+	if err == ErrChecksumMismatch {
+		item, err = &PriorityItem{ID: id, Priority: priority, Key: pq.generateKey(priority, id)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pq.dropItem(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// dropItem removes the given item from the priority queue, wherever it
+// is in its priority level. The caller must hold the lock.
+func (pq *PriorityQueue) dropItem(item *PriorityItem) error {
+	batch := new(leveldb.Batch)
+	pq.removeItem(batch, item)
+	putLevelMeta(batch, item.Priority, pq.levels[item.Priority].without(item.ID))
+	if err := pq.write(batch, changeOf(ChangeDrop, item)); err != nil {
+		return err
+	}
+	pq.commitRemove(item)
+	pq.bounds.remove(uint64(len(item.Value)))
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	firePriority(pq.hooks.OnDrop, item)
+
+	return nil
+}
+
+// removeItem adds the deletion of the given item to the batch, along
+// with a tombstone if the item is in the middle of its priority level.
+// Once the batch is written, commitRemove must be called with the same
+// item. The caller must hold the lock.
+func (pq *PriorityQueue) removeItem(batch *leveldb.Batch, item *PriorityItem) {
+	level := pq.levels[item.Priority]
+	batch.Delete(item.Key)
+	if item.ID != level.head+1 && item.ID != level.tail {
+		batch.Put(removedKey(item.Key), []byte{})
+	}
+}
+
+// commitRemove updates the positions of the priority level of the given
+// item once its removal is written.
+func (pq *PriorityQueue) commitRemove(item *PriorityItem) {
+	level := pq.levels[item.Priority]
+	*level = level.without(item.ID)
+	pq.updateActive(item.Priority)
+}
+
+// RemoveByID removes the item with the given ID from the stack and
+// returns it, wherever it is in the stack.
+//
+// An item removed from the middle of the stack leaves a tombstone
+// behind, so the gap is skipped once it reaches the top or bottom.
+//
+// An item whose value doesn't match its checksum is removed all the
+// same, and returned without its value, so it doesn't block the stack.
+func (s *Stack) RemoveByID(id uint64) (*Item, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the item, falling back to its key if it is corrupted.
+	item, err := s.getItemByID(id)
+	if err == ErrChecksumMismatch {
+		item, err = &Item{ID: id, Key: idToKey(id)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.dropItem(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// dropItem removes the given item from the stack, wherever it is in the
+// stack. The caller must hold the lock.
+func (s *Stack) dropItem(item *Item) error {
+	id := item.ID
+	middle := id != s.head && id != s.tail+1
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	head, tail := s.head, s.tail
+	if middle {
+		batch.Put(removedKey(item.Key), []byte{})
+	} else if id == head {
+		head, tail = s.trimmed(head-1, tail)
+	} else {
+		head, tail = s.trimmed(head, tail+1)
+	}
+	if err := s.writeMeta(batch, head, tail); err != nil {
+		return err
+	}
+
+	// Update the positions of the stack.
+	if middle {
+		s.removed = s.removed.with(id)
+	} else if id == s.head {
+		s.head--
+	} else {
+		s.tail++
+	}
+	s.trim()
+	s.bounds.remove(uint64(len(item.Value)))
+	s.compact.deleted(s.db, s.log, 1, uint64(len(item.Value)))
+	fireItem(s.hooks.OnDrop, item)
+
+	return nil
+}
+
+// removedKey returns the key of the tombstone for the given item key.
+func removedKey(key []byte) []byte {
+	return append(append([]byte{}, removedPrefix...), key...)
+}
+
+// loadRemoved returns the item keys of the tombstones in the store, in
+// ascending order, for which within returns true and the item is gone.
+// Every other tombstone is left over from an item whose ID was passed
+// or reused, and is deleted.
+func loadRemoved(db Store, wo *opt.WriteOptions, within func(key []byte) bool) ([][]byte, error) {
+	// Collect the item keys of the tombstones.
+	iter := db.NewIterator(util.BytesPrefix(removedPrefix), nil)
+	var keys [][]byte
+	for iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()[len(removedPrefix):]...))
+	}
+	err := iter.Error()
+	iter.Release()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	// Check which of the items are still gone.
+	values, err := multiGet(db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed [][]byte
+	batch := new(leveldb.Batch)
+	for i, key := range keys {
+		if values[i] == nil && within(key) {
+			removed = append(removed, key)
+		} else {
+			batch.Delete(removedKey(key))
+		}
+	}
+
+	// Delete the tombstones that are left over.
+	if batch.Len() > 0 {
+		if err := db.Write(batch, wo); err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,232 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueRemoveByPriorityID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Remove items from the middle and both ends.
+	for _, id := range []uint64{3, 4, 1, 10} {
+		item, err := pq.RemoveByPriorityID(0, id)
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", id)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if pq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", pq.Length())
+	}
+
+	if _, err = pq.RemoveByPriorityID(0, 3); err == nil {
+		t.Error("Expected to get an error removing an item twice")
+	}
+	if _, err = pq.RemoveByPriorityID(0, 10); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	item, err := pq.PeekByOffset(1)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 5" {
+		t.Errorf("Expected string to be 'value for item 5', got '%s'", item.ToString())
+	}
+
+	// Dequeue skips the removed items.
+	for _, id := range []uint64{2, 5, 6, 7, 8, 9} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", id)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestPriorityQueueRemoveByPriorityIDPersist(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i%2))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Remove two of the middle items of level 0, which holds the even
+	// items, then dequeue past the first gap.
+	for _, id := range []uint64{2, 4} {
+		if _, err = pq.RemoveByPriorityID(0, id); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = pq.DequeueByPriority(0); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Reopen the priority queue, which should find the remaining gap.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.LengthByPriority(0) != 1 {
+		t.Errorf("Expected priority level length of 1, got %d", pq.LengthByPriority(0))
+	}
+	if pq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", pq.Length())
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 10" {
+		t.Errorf("Expected string to be 'value for item 10', got '%s'", item.ToString())
+	}
+}
+
+func TestPriorityQueueRemoveByPriorityIDClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	if _, err = pq.RemoveByPriorityID(0, 1); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestStackRemoveByID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Remove items from the middle and both ends.
+	for _, id := range []uint64{5, 10, 1} {
+		item, err := s.RemoveByID(id)
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", id)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 7 {
+		t.Errorf("Expected stack length of 7, got %d", s.Length())
+	}
+
+	item, err := s.PeekByOffset(4)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 4" {
+		t.Errorf("Expected string to be 'value for item 4', got '%s'", item.ToString())
+	}
+
+	// Reopen the stack, which should find the gap.
+	s.Close()
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 7 {
+		t.Errorf("Expected stack length of 7, got %d", s.Length())
+	}
+
+	// Pop skips the removed items.
+	for _, id := range []uint64{9, 8, 7, 6, 4, 3, 2} {
+		item, err := s.Pop()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", id)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = s.Pop(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// The stack starts over once empty.
+	if err = s.Push(NewItemString("new item")); err != nil {
+		t.Error(err)
+	}
+	s.Close()
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if s.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", s.Length())
+	}
+}
+
+func TestStackRemoveByIDClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	s.Close()
+
+	if _, err = s.RemoveByID(1); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+// Package replication keeps a standby copy of a Goque priority queue or
+// stack on another machine, so it can be promoted when the primary
+// fails.
+//
+// On the primary, the store of the data structure is wrapped in a
+// Primary, which numbers every write and keeps the latest ones in an
+// in-memory operation log. Replicas connect to the Primary over TCP and
+// apply the writes to their own store, in the order and batches they
+// were made on the primary. A replica that is too far behind, or new,
+// first receives a full copy of the store.
+//
+// Replication is asynchronous: a write returns once applied on the
+// primary, and replicas receive it shortly after. Writes the primary
+// made just before failing may be lost. The store of a replica is
+// always a copy of the primary's store at some earlier point, except
+// while a full copy is in progress, so promoting it is like reopening
+// the primary after a crash.
+package replication
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/beeker1121/goque"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	// ErrClosed is returned by Serve once the primary is closed.
+	ErrClosed = errors.New("replication: Primary is closed")
+
+	// ErrProtocol is returned when a peer sends data that doesn't
+	// follow the replication protocol.
+	ErrProtocol = errors.New("replication: Unexpected data from peer")
+)
+
+// positionKey holds the log ID and sequence number of the last write
+// applied to a store. It is written along with every write, so a
+// replica knows where to resume from. Like every key Goque keeps
+// besides the items, it starts with "goque:".
+var positionKey = []byte("goque:repl")
+
+// defaultLogSize is the default size of the operation log.
+const defaultLogSize = 64 << 20
+
+// Options configures a Primary.
+type Options struct {
+	// LogSize is the largest total size, in bytes, of the writes kept
+	// in the operation log. A replica that falls further behind needs a
+	// full copy of the store. Defaults to 64 MiB.
+	LogSize int
+
+	// Logger, if set, receives the replicas connecting and the
+	// failures of their connections.
+	Logger goque.Logger
+}
+
+// entry is a write in the operation log.
+type entry struct {
+	seq  uint64
+	data []byte
+}
+
+// Primary is a goque.Store replicating its writes. It also implements
+// goque.Snapshotter, goque.Compacter and goque.Sizer when the wrapped
+// store supports them.
+type Primary struct {
+	store goque.Store
+	opts  Options
+
+	// mu serializes the writes, so they are numbered and logged in
+	// the order they were applied.
+	mu      sync.Mutex
+	id      [8]byte
+	seq     uint64
+	log     []entry
+	size    int
+	changed chan struct{}
+
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	done      chan struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// The Primary is a Store.
+var _ goque.Store = (*Primary)(nil)
+
+// NewPrimary returns a Primary replicating the writes made to store.
+// Open the data structure with the Primary as its store, such as with
+// goque.OpenPriorityQueueWithStore, then serve replicas with Serve.
+//
+// Every Primary starts a new operation log, so replicas connecting to
+// it for the first time, including after the primary restarts, receive
+// a full copy of the store.
+func NewPrimary(store goque.Store, opts Options) (*Primary, error) {
+	if opts.LogSize <= 0 {
+		opts.LogSize = defaultLogSize
+	}
+
+	p := &Primary{
+		store:     store,
+		opts:      opts,
+		changed:   make(chan struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+	}
+	if _, err := rand.Read(p.id[:]); err != nil {
+		return nil, err
+	}
+
+	// Record the new log in the store, so full copies carry it.
+	if err := store.Put(positionKey, p.position(0), nil); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Seq returns the sequence number of the last write.
+func (p *Primary) Seq() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.seq
+}
+
+// Get gets the value of a key from the wrapped store.
+func (p *Primary) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	return p.store.Get(key, ro)
+}
+
+// NewIterator returns an iterator over the wrapped store.
+func (p *Primary) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return p.store.NewIterator(slice, ro)
+}
+
+// Put sets the value of a key and replicates it.
+func (p *Primary) Put(key, value []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, value)
+
+	return p.commit(batch, wo)
+}
+
+// Delete deletes a key and replicates it.
+func (p *Primary) Delete(key []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+
+	return p.commit(batch, wo)
+}
+
+// Write applies a batch atomically and replicates it.
+func (p *Primary) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	// Copy the batch, which belongs to the caller.
+	b := new(leveldb.Batch)
+	if err := batch.Replay(b); err != nil {
+		return err
+	}
+
+	return p.commit(b, wo)
+}
+
+// commit numbers a batch, applies it along with the new position and
+// appends it to the operation log.
+func (p *Primary) commit(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := p.seq + 1
+	batch.Put(positionKey, p.position(seq))
+	if err := p.store.Write(batch, wo); err != nil {
+		return err
+	}
+	p.seq = seq
+
+	// Append the write, then trim the oldest ones over the size.
+	data := batch.Dump()
+	p.log = append(p.log, entry{seq: seq, data: data})
+	p.size += len(data)
+	for len(p.log) > 0 && p.size > p.opts.LogSize {
+		p.size -= len(p.log[0].data)
+		p.log = p.log[1:]
+	}
+
+	// Wake up the replicas.
+	close(p.changed)
+	p.changed = make(chan struct{})
+
+	return nil
+}
+
+// position encodes the log ID and a sequence number.
+func (p *Primary) position(seq uint64) []byte {
+	data := make([]byte, 16)
+	copy(data, p.id[:])
+	binary.BigEndian.PutUint64(data[8:], seq)
+
+	return data
+}
+
+// decodePosition decodes the log ID and sequence number of a position.
+func decodePosition(data []byte) ([]byte, uint64, error) {
+	if len(data) != 16 {
+		return nil, 0, ErrProtocol
+	}
+
+	return data[:8], binary.BigEndian.Uint64(data[8:]), nil
+}
+
+// since returns the writes following seq in the log of the given ID, and
+// whether the log still holds all of them. The caller must hold the
+// lock.
+func (p *Primary) since(id []byte, seq uint64) ([]entry, bool) {
+	switch {
+	case !bytes.Equal(id, p.id[:]) || seq > p.seq:
+		return nil, false
+	case seq == p.seq:
+		return nil, true
+	case len(p.log) == 0 || p.log[0].seq > seq+1:
+		return nil, false
+	}
+
+	return p.log[seq+1-p.log[0].seq:], true
+}
+
+// Snapshot takes a snapshot of the wrapped store, returning
+// goque.ErrSnapshotUnsupported if it can't take one.
+func (p *Primary) Snapshot() (goque.StoreSnapshot, error) {
+	switch s := p.store.(type) {
+	case *leveldb.DB:
+		return s.GetSnapshot()
+	case goque.Snapshotter:
+		return s.Snapshot()
+	}
+
+	return nil, goque.ErrSnapshotUnsupported
+}
+
+// CompactRange compacts the wrapped store, returning
+// goque.ErrCompactUnsupported if it can't compact.
+func (p *Primary) CompactRange(r util.Range) error {
+	if c, ok := p.store.(goque.Compacter); ok {
+		return c.CompactRange(r)
+	}
+
+	return goque.ErrCompactUnsupported
+}
+
+// SizeOf estimates the disk usage of the wrapped store, returning
+// goque.ErrSizeUnsupported if it can't estimate it.
+func (p *Primary) SizeOf(ranges []util.Range) (leveldb.Sizes, error) {
+	if s, ok := p.store.(goque.Sizer); ok {
+		return s.SizeOf(ranges)
+	}
+
+	return nil, goque.ErrSizeUnsupported
+}
+
+// Close disconnects the replicas and closes the wrapped store. It is
+// called when the data structure using the Primary is closed.
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+		for l := range p.listeners {
+			l.Close()
+		}
+		for conn := range p.conns {
+			conn.Close()
+		}
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return p.store.Close()
+}
+
+func (p *Primary) info(msg string, args ...interface{}) {
+	if p.opts.Logger != nil {
+		p.opts.Logger.Info(msg, args...)
+	}
+}
+
+func (p *Primary) warn(msg string, args ...interface{}) {
+	if p.opts.Logger != nil {
+		p.opts.Logger.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,157 @@
+package replication
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// testLogger counts the messages it receives.
+type testLogger struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (l *testLogger) Info(msg string, args ...interface{}) { l.log(msg) }
+func (l *testLogger) Warn(msg string, args ...interface{}) { l.log(msg) }
+
+func (l *testLogger) log(msg string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.counts == nil {
+		l.counts = make(map[string]int)
+	}
+	l.counts[msg]++
+}
+
+// count returns how many times the given message was received.
+func (l *testLogger) count(msg string) int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.counts[msg]
+}
+
+// openPrimary opens a priority queue replicated by a Primary.
+func openPrimary(t *testing.T, opts Options) (*goque.PriorityQueue, *Primary) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPrimary(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pq, err := goque.OpenPriorityQueueWithStore(file, goque.ASC, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq, p
+}
+
+func TestPrimaryLog(t *testing.T) {
+	pq, p := openPrimary(t, Options{})
+	defer pq.ForceDrop()
+
+	start := p.Seq()
+	for i := 0; i < 3; i++ {
+		if _, err := pq.EnqueueString(0, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Seq() != start+3 {
+		t.Errorf("Expected 3 writes to be logged, got %d", p.Seq()-start)
+	}
+
+	p.mu.Lock()
+	entries, ok := p.since(p.id[:], start)
+	_, otherOK := p.since(make([]byte, 8), start)
+	_, aheadOK := p.since(p.id[:], start+4)
+	p.mu.Unlock()
+
+	if !ok || len(entries) != 3 || entries[0].seq != start+1 {
+		t.Errorf("Expected the 3 writes following %d, got %d", start, len(entries))
+	}
+	if otherOK {
+		t.Error("Expected the writes of another log not to be found")
+	}
+	if aheadOK {
+		t.Error("Expected the writes of a replica ahead of the primary not to be found")
+	}
+
+	// Every write holds the position.
+	data, err := p.Get(positionKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, seq, _ := decodePosition(data); seq != p.Seq() {
+		t.Errorf("Expected the stored position to be %d, got %d", p.Seq(), seq)
+	}
+}
+
+func TestPrimaryLogSize(t *testing.T) {
+	pq, p := openPrimary(t, Options{LogSize: 1024})
+	defer pq.ForceDrop()
+
+	start := p.Seq()
+	for i := 0; i < 10; i++ {
+		if _, err := pq.EnqueueValue(0, make([]byte, 200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.size > 1024 {
+		t.Errorf("Expected the log to be trimmed to 1024 bytes, got %d", p.size)
+	}
+	if _, ok := p.since(p.id[:], start); ok {
+		t.Error("Expected the trimmed writes not to be found")
+	}
+	if _, ok := p.since(p.id[:], p.seq-1); !ok {
+		t.Error("Expected the last write to be found")
+	}
+}
+
+func TestPrimaryWriteKeepsBatch(t *testing.T) {
+	pq, p := openPrimary(t, Options{})
+	defer pq.ForceDrop()
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte("a"), []byte("1"))
+	if err := p.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+	if batch.Len() != 1 {
+		t.Errorf("Expected the batch of the caller to keep 1 record, got %d", batch.Len())
+	}
+}
+
+func TestPrimarySnapshot(t *testing.T) {
+	pq, _ := openPrimary(t, Options{})
+	defer pq.ForceDrop()
+
+	if _, err := pq.EnqueueString(0, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := pq.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	if snap.Length() != 1 {
+		t.Errorf("Expected the snapshot to hold 1 item, got %d", snap.Length())
+	}
+}
@@ -0,0 +1,102 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// A replica opens a connection with a handshake holding the position of
+// the last write it applied, which is followed by the frames of the
+// primary:
+//
+//	handshake = magic version id(8) seq(8)
+//	frame     = kind seq(8) length(uvarint) data
+//
+// A batch frame holds a batch dump, the seq being that of the write, or
+// 0 for the parts of a full copy but the last. A reset frame starts a
+// full copy. A heartbeat frame, sent while the primary is idle, holds
+// no data and the seq of the last write.
+var magic = []byte("GQRP")
+
+// The version of the protocol.
+const protocolV1 byte = 1
+
+// The kinds of frames.
+const (
+	frameBatch byte = iota + 1
+	frameReset
+	frameHeartbeat
+)
+
+// maxFrameSize is the size of the largest frame a replica accepts.
+const maxFrameSize = 1 << 30
+
+// writeHandshake writes a handshake resuming from the given position.
+func writeHandshake(w io.Writer, id []byte, seq uint64) error {
+	buf := make([]byte, 0, len(magic)+17)
+	buf = append(buf, magic...)
+	buf = append(buf, protocolV1)
+	buf = append(buf, id...)
+	buf = append(buf, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], seq)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readHandshake reads a handshake, returning the position the replica
+// resumes from.
+func readHandshake(r io.Reader) ([]byte, uint64, error) {
+	buf := make([]byte, len(magic)+17)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(buf[:len(magic)], magic) || buf[len(magic)] != protocolV1 {
+		return nil, 0, ErrProtocol
+	}
+	buf = buf[len(magic)+1:]
+
+	return buf[:8], binary.BigEndian.Uint64(buf[8:]), nil
+}
+
+// writeFrame writes a frame.
+func writeFrame(w *bufio.Writer, kind byte, seq uint64, data []byte) error {
+	var hdr [9 + binary.MaxVarintLen64]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint64(hdr[1:], seq)
+	n := binary.PutUvarint(hdr[9:], uint64(len(data)))
+
+	if _, err := w.Write(hdr[:9+n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a frame.
+func readFrame(r *bufio.Reader) (byte, uint64, []byte, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	if hdr[0] < frameBatch || hdr[0] > frameHeartbeat {
+		return 0, 0, nil, ErrProtocol
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if n > maxFrameSize {
+		return 0, 0, nil, ErrProtocol
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return hdr[0], binary.BigEndian.Uint64(hdr[1:]), data, nil
+}
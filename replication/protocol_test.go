@@ -0,0 +1,60 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHandshake(&buf, []byte("12345678"), 42); err != nil {
+		t.Fatal(err)
+	}
+
+	id, seq, err := readHandshake(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(id) != "12345678" || seq != 42 {
+		t.Errorf("Expected position 12345678/42, got %s/%d", id, seq)
+	}
+
+	if _, _, err := readHandshake(bytes.NewReader([]byte("GET / HTTP/1.1\r\n\r\n   "))); err != ErrProtocol {
+		t.Errorf("Expected ErrProtocol, got %v", err)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeFrame(w, frameBatch, 7, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(w, frameHeartbeat, 8, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	r := bufio.NewReader(&buf)
+	for _, want := range []struct {
+		kind byte
+		seq  uint64
+		data string
+	}{
+		{frameBatch, 7, "data"},
+		{frameHeartbeat, 8, ""},
+	} {
+		kind, seq, data, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != want.kind || seq != want.seq || string(data) != want.data {
+			t.Errorf("Expected frame %d/%d/%q, got %d/%d/%q", want.kind, want.seq, want.data, kind, seq, data)
+		}
+	}
+
+	if _, _, _, err := readFrame(bufio.NewReader(bytes.NewReader(make([]byte, 10)))); err != ErrProtocol {
+		t.Errorf("Expected ErrProtocol for an unknown frame, got %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// The defaults of the replica options.
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// ReplicaOptions configures a Replica.
+type ReplicaOptions struct {
+	// Timeout bounds connecting to the primary, and how long the
+	// replica waits for data from a connected primary before
+	// reconnecting. It must be well above a second, how often an idle
+	// primary sends a heartbeat. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the wait before reconnecting
+	// after a failure, which doubles with every failure in a row. They
+	// default to 100 milliseconds and 30 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Logger, if set, receives the failures of the replica.
+	Logger goque.Logger
+}
+
+// Status describes the state of a replica.
+type Status struct {
+	// Connected is whether the replica is connected to the primary.
+	Connected bool
+
+	// Copying is whether the replica is receiving a full copy of the
+	// store of the primary. Until it completes, the store of the
+	// replica only holds part of the data and must not be promoted.
+	Copying bool
+
+	// Seq is the sequence number of the last write the replica
+	// applied, and PrimarySeq that of the last write on the primary it
+	// knows of.
+	Seq        uint64
+	PrimarySeq uint64
+}
+
+// Replica applies the writes of a primary to its own store.
+type Replica struct {
+	store goque.Store
+	addr  string
+	opts  ReplicaOptions
+
+	mu     sync.Mutex
+	status Status
+
+	runMu   sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewReplica returns a Replica applying the writes of the primary at
+// the given TCP address to store. The store must not be used by a data
+// structure while the replica runs. The replica only connects once
+// Start is called.
+//
+// To promote the replica, stop it, then open a data structure on its
+// store, such as with goque.OpenPriorityQueueWithStore, wrapping the
+// store in a new Primary to keep replicating.
+func NewReplica(store goque.Store, addr string, opts ReplicaOptions) *Replica {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = defaultMaxBackoff
+		if opts.MaxBackoff < opts.MinBackoff {
+			opts.MaxBackoff = opts.MinBackoff
+		}
+	}
+
+	return &Replica{store: store, addr: addr, opts: opts}
+}
+
+// Start starts a background goroutine following the primary, which
+// reconnects after failures until Stop is called. Calling Start again
+// while it runs does nothing.
+func (r *Replica) Start() {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.stopped = make(chan struct{})
+	go r.run(ctx, r.stopped)
+}
+
+// Stop disconnects from the primary and waits for the background
+// goroutine to return. The store must not be closed before Stop
+// returns.
+func (r *Replica) Stop() {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	if r.cancel == nil {
+		return
+	}
+
+	r.cancel()
+	<-r.stopped
+	r.cancel = nil
+}
+
+// Status returns the state of the replica.
+func (r *Replica) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.status
+}
+
+// run follows the primary until the context is cancelled, backing off
+// between connections that fail.
+func (r *Replica) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	var backoff time.Duration
+	for {
+		received, err := r.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if received {
+			backoff = 0
+		}
+		backoff = r.nextBackoff(backoff)
+		r.warn("goque: Following the primary failed", "addr", r.addr, "error", err, "backoff", backoff)
+		if !sleep(ctx, backoff) {
+			return
+		}
+	}
+}
+
+// follow connects to the primary and applies its writes until the
+// connection fails. It returns whether anything was received.
+func (r *Replica) follow(ctx context.Context) (bool, error) {
+	id, seq, err := r.position()
+	if err != nil {
+		return false, err
+	}
+
+	dialer := net.Dialer{Timeout: r.opts.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Close the connection when the context is cancelled, so reads
+	// return.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	conn.SetWriteDeadline(time.Now().Add(r.opts.Timeout))
+	if err := writeHandshake(conn, id, seq); err != nil {
+		return false, err
+	}
+
+	r.setStatus(func(s *Status) { s.Connected, s.Seq = true, seq })
+	defer r.setStatus(func(s *Status) { s.Connected = false })
+
+	rd := bufio.NewReader(conn)
+	for received := false; ; received = true {
+		conn.SetReadDeadline(time.Now().Add(r.opts.Timeout))
+		kind, seq, data, err := readFrame(rd)
+		if err != nil {
+			return received, err
+		}
+
+		if err := r.apply(kind, seq, data); err != nil {
+			return received, err
+		}
+	}
+}
+
+// apply applies a frame received from the primary.
+func (r *Replica) apply(kind byte, seq uint64, data []byte) error {
+	switch kind {
+	case frameReset:
+		r.setStatus(func(s *Status) { s.Copying = true })
+		return r.clear()
+	case frameHeartbeat:
+		r.setStatus(func(s *Status) { s.PrimarySeq = seq })
+		return nil
+	}
+
+	batch := new(leveldb.Batch)
+	if err := batch.Load(data); err != nil {
+		return ErrProtocol
+	}
+	if err := r.store.Write(batch, nil); err != nil {
+		return err
+	}
+
+	// Parts of a full copy but the last have no sequence number.
+	if seq != 0 {
+		r.setStatus(func(s *Status) {
+			s.Copying, s.Seq = false, seq
+			if s.PrimarySeq < seq {
+				s.PrimarySeq = seq
+			}
+		})
+	}
+
+	return nil
+}
+
+// position returns the position of the last write applied to the store,
+// or a zero position if it never was.
+func (r *Replica) position() ([]byte, uint64, error) {
+	data, err := r.store.Get(positionKey, nil)
+	if err == leveldb.ErrNotFound {
+		return make([]byte, 8), 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	return decodePosition(data)
+}
+
+// clear deletes every key of the store, starting with the position, so
+// a replica disconnected before a full copy completes starts over.
+func (r *Replica) clear() error {
+	if err := r.store.Delete(positionKey, nil); err != nil {
+		return err
+	}
+
+	iter := r.store.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+		if len(batch.Dump()) >= copyChunkSize {
+			if err := r.store.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return r.store.Write(batch, nil)
+}
+
+// setStatus updates the status of the replica.
+func (r *Replica) setStatus(update func(s *Status)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update(&r.status)
+}
+
+// nextBackoff returns the backoff following the given one.
+func (r *Replica) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return r.opts.MinBackoff
+	}
+
+	backoff *= 2
+	if backoff > r.opts.MaxBackoff {
+		return r.opts.MaxBackoff
+	}
+
+	return backoff
+}
+
+// sleep waits for d, returning false if the context is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (r *Replica) warn(msg string, args ...interface{}) {
+	if r.opts.Logger != nil {
+		r.opts.Logger.Warn(msg, args...)
+	}
+}
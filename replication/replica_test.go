@@ -0,0 +1,240 @@
+package replication
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// serve serves replicas of p on a local port, returning its address.
+func serve(t *testing.T, p *Primary) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+
+	return l.Addr().String()
+}
+
+// openReplicaStore opens the store of a replica.
+func openReplicaStore(t *testing.T) (*leveldb.DB, string) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, file
+}
+
+// waitFor waits for the replica to apply the writes up to seq, which
+// must be past the position the replica starts from.
+func waitFor(t *testing.T, r *Replica, seq uint64) {
+	for i := 0; i < 500; i++ {
+		if s := r.Status(); s.Seq == seq && !s.Copying {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected the replica to reach %d, got %+v", seq, r.Status())
+}
+
+// countKeys returns the number of keys in a store.
+func countKeys(store goque.Store) int {
+	iter := store.NewIterator(nil, nil)
+	defer iter.Release()
+
+	n := 0
+	for iter.Next() {
+		n++
+	}
+
+	return n
+}
+
+func TestReplicaPromote(t *testing.T) {
+	pq, p := openPrimary(t, Options{})
+	defer pq.ForceDrop()
+	addr := serve(t, p)
+
+	// Items enqueued before the replica connects are part of the full
+	// copy.
+	for i := 1; i <= 5; i++ {
+		if _, err := pq.EnqueueString(uint8(i%2), fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, file := openReplicaStore(t)
+	defer os.RemoveAll(file)
+
+	r := NewReplica(db, addr, ReplicaOptions{MinBackoff: 10 * time.Millisecond})
+	r.Start()
+	waitFor(t, r, p.Seq())
+
+	// Later writes are streamed.
+	if _, err := pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pq.EnqueueString(0, "value for item 6"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, r, p.Seq())
+	r.Stop()
+
+	if s := r.Status(); s.Connected || s.PrimarySeq != p.Seq() {
+		t.Errorf("Expected a stopped replica knowing of %d writes, got %+v", p.Seq(), s)
+	}
+
+	// The promoted replica holds the same items.
+	promoted, err := goque.OpenPriorityQueueWithStore(file, goque.ASC, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer promoted.Close()
+
+	if promoted.Length() != pq.Length() {
+		t.Fatalf("Expected the promoted replica to hold %d items, got %d", pq.Length(), promoted.Length())
+	}
+	for pq.Length() > 0 {
+		want, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := promoted.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ToString() != want.ToString() || got.Priority != want.Priority {
+			t.Errorf("Expected %s with priority %d, got %s with priority %d", want.ToString(), want.Priority, got.ToString(), got.Priority)
+		}
+	}
+}
+
+func TestReplicaResume(t *testing.T) {
+	logger := &testLogger{}
+	pq, p := openPrimary(t, Options{LogSize: 1024, Logger: logger})
+	defer pq.ForceDrop()
+	addr := serve(t, p)
+
+	db, file := openReplicaStore(t)
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	if _, err := pq.EnqueueString(0, "a"); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReplica(db, addr, ReplicaOptions{MinBackoff: 10 * time.Millisecond})
+	r.Start()
+	waitFor(t, r, p.Seq())
+	r.Stop()
+
+	// A replica that is a little behind resumes from the log.
+	if _, err := pq.EnqueueString(0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	r.Start()
+	waitFor(t, r, p.Seq())
+	r.Stop()
+
+	if n := logger.count("goque: Sending a full copy to a replica"); n != 1 {
+		t.Errorf("Expected a single full copy, got %d", n)
+	}
+
+	// A replica further behind than the log gets a full copy again.
+	for i := 0; i < 10; i++ {
+		if _, err := pq.EnqueueValue(0, make([]byte, 200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Start()
+	waitFor(t, r, p.Seq())
+	r.Stop()
+
+	if n := logger.count("goque: Sending a full copy to a replica"); n < 2 {
+		t.Errorf("Expected another full copy, got %d", n)
+	}
+
+	if got, want := countKeys(db), countKeys(p); got != want {
+		t.Errorf("Expected the %d keys of the primary to be copied, got %d", want, got)
+	}
+}
+
+func TestReplicaReconnect(t *testing.T) {
+	pq, p := openPrimary(t, Options{})
+	addr := serve(t, p)
+
+	db, file := openReplicaStore(t)
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	if _, err := pq.EnqueueString(0, "a"); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReplica(db, addr, ReplicaOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	r.Start()
+	defer r.Stop()
+	waitFor(t, r, p.Seq())
+
+	// Closing the primary disconnects the replica.
+	if err := pq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500 && r.Status().Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.Status().Connected {
+		t.Fatal("Expected the replica to be disconnected")
+	}
+
+	// A new primary on the same address starts a new log, which the
+	// replica copies once it reconnects.
+	store, err := leveldb.OpenFile(pq.DataDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = NewPrimary(store, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq, err = goque.OpenPriorityQueueWithStore(pq.DataDir, goque.ASC, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+
+	if _, err := pq.EnqueueString(0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, r, p.Seq())
+
+	if got, want := countKeys(db), countKeys(p); got != want {
+		t.Errorf("Expected the %d keys of the new primary to be copied, got %d", want, got)
+	}
+}
+
+func TestServeClosed(t *testing.T) {
+	pq, p := openPrimary(t, Options{})
+	pq.ForceDrop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Serve(l); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// heartbeatInterval is how often an idle primary tells its replicas the
+// position of its last write, so they can tell it is still up.
+const heartbeatInterval = time.Second
+
+// handshakeTimeout is how long the primary waits for the handshake of a
+// new connection.
+const handshakeTimeout = 10 * time.Second
+
+// copyChunkSize is the size of the batches a full copy is sent in.
+const copyChunkSize = 1 << 20
+
+// ListenAndServe listens on the given TCP address and serves the
+// replicas connecting to it.
+func (p *Primary) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return p.Serve(l)
+}
+
+// Serve serves the replicas connecting on l until the primary is closed,
+// when it returns ErrClosed.
+func (p *Primary) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	p.listeners[l] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, l)
+		p.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-p.done:
+				return ErrClosed
+			default:
+				return err
+			}
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return ErrClosed
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		go p.serveReplica(conn)
+	}
+}
+
+// serveReplica sends the writes to a replica, starting after the
+// position in its handshake, until the connection fails or the primary
+// is closed.
+func (p *Primary) serveReplica(conn net.Conn) {
+	defer p.wg.Done()
+	defer func() {
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		conn.Close()
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	id, seq, err := readHandshake(conn)
+	if err != nil {
+		p.warn("goque: Reading a replica handshake failed", "addr", conn.RemoteAddr(), "error", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	p.info("goque: Replica connected", "addr", conn.RemoteAddr(), "seq", seq)
+
+	// Replicas send nothing after the handshake, so a read returns once
+	// the replica disconnects.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, conn)
+		close(gone)
+	}()
+
+	w := bufio.NewWriter(conn)
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		p.mu.Lock()
+		entries, ok := p.since(id, seq)
+		last, changed := p.seq, p.changed
+		p.mu.Unlock()
+
+		if !ok {
+			p.info("goque: Sending a full copy to a replica", "addr", conn.RemoteAddr())
+			if seq, err = p.sendCopy(w); err != nil {
+				p.connFailed(conn, err)
+				return
+			}
+			id = p.id[:]
+			continue
+		}
+
+		if len(entries) > 0 {
+			for _, e := range entries {
+				if err = writeFrame(w, frameBatch, e.seq, e.data); err != nil {
+					break
+				}
+				seq = e.seq
+			}
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				p.connFailed(conn, err)
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			err = writeFrame(w, frameHeartbeat, last, nil)
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				p.connFailed(conn, err)
+				return
+			}
+		case <-gone:
+			return
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// sendCopy sends a full copy of the store, returning the sequence number
+// of the last write it holds. The position is sent last, so a replica
+// disconnected during the copy starts over.
+func (p *Primary) sendCopy(w *bufio.Writer) (uint64, error) {
+	// Writes are serialized, so the iterator sees the store as of the
+	// last write.
+	p.mu.Lock()
+	iter := p.store.NewIterator(nil, nil)
+	seq := p.seq
+	pos := p.position(seq)
+	p.mu.Unlock()
+	defer iter.Release()
+
+	if err := writeFrame(w, frameReset, 0, nil); err != nil {
+		return 0, err
+	}
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		if bytes.Equal(iter.Key(), positionKey) {
+			continue
+		}
+
+		batch.Put(iter.Key(), iter.Value())
+		if len(batch.Dump()) >= copyChunkSize {
+			if err := writeFrame(w, frameBatch, 0, batch.Dump()); err != nil {
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	batch.Put(positionKey, pos)
+	if err := writeFrame(w, frameBatch, seq, batch.Dump()); err != nil {
+		return 0, err
+	}
+
+	return seq, w.Flush()
+}
+
+// connFailed logs the failure of a replica connection, unless the
+// primary closed it.
+func (p *Primary) connFailed(conn net.Conn, err error) {
+	select {
+	case <-p.done:
+	default:
+		p.warn("goque: Replicating to a replica failed", "addr", conn.RemoteAddr(), "error", err)
+	}
+}
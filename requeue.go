@@ -0,0 +1,122 @@
+package goque
+
+import "github.com/syndtr/goleveldb/leveldb"
+
+// Requeue adds a dequeued item back to the tail of its priority level,
+// giving it a new ID and key. Its sequence number is kept. If retry is
+// set, the attempt count of the item is incremented first, which is
+// persisted along with it.
+//
+// Attempts are only persisted by priority queues that store items in
+// an envelope, which all priority queues created by this version do.
+func (pq *PriorityQueue) Requeue(item *PriorityItem, retry bool) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Make sure the item fits.
+	if err := pq.makeRoom(1, uint64(len(item.Value))); err != nil {
+		return err
+	}
+
+	// Get the priorityLevel.
+	level := pq.levels[item.Priority]
+
+	// Set item ID and key.
+	requeued := *item
+	requeued.ID = level.tail + 1
+	requeued.Key = pq.generateKey(item.Priority, requeued.ID)
+	if retry {
+		requeued.Attempts++
+	}
+
+	// Add it back to the priority queue.
+	batch := new(leveldb.Batch)
+	if err := pq.putValue(batch, &requeued); err != nil {
+		return err
+	}
+	next := *level
+	next.tail++
+	putLevelMeta(batch, item.Priority, next)
+	if err := pq.write(batch, changeOf(ChangeRequeue, &requeued)); err != nil {
+		return err
+	}
+	*item = requeued
+
+	level.tail++
+	before := pq.active
+	pq.active.set(item.Priority, true)
+	pq.bounds.add(uint64(len(item.Value)))
+	pq.counters.Enqueued++
+	firePriority(pq.hooks.OnRequeue, item)
+	pq.signalAdded(before)
+
+	// If this priority level is more important than the curLevel.
+	if pq.cmpAsc(item.Priority) || pq.cmpDesc(item.Priority) {
+		pq.curLevel = item.Priority
+	}
+
+	return nil
+}
+
+// Requeue adds a popped item back to the bottom of the stack, giving it
+// a new ID and key, so it is popped after every other item.
+//
+// The bottom of the stack can only grow into IDs freed by items removed
+// from the bottom, such as by a capacity with OverflowDropOldest. If
+// there is no free ID below the bottom of a non-empty stack,
+// ErrOutOfBounds is returned.
+func (s *Stack) Requeue(item *Item) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	// Make sure the item fits.
+	if err := s.makeRoom(1, uint64(len(item.Value))); err != nil {
+		return err
+	}
+
+	// Set item ID and key. An empty stack has its bottom at the top.
+	var id uint64
+	if s.Length() == 0 {
+		id = s.head + 1
+	} else if s.tail > 0 {
+		id = s.tail
+	} else {
+		return ErrOutOfBounds
+	}
+
+	// Add it back to the stack.
+	stampItem(s.format, item)
+	value, err := encodeItemValue(s.format, s.seal, idToKey(id), item)
+	if err != nil {
+		return err
+	}
+	head, tail := s.head, s.tail
+	if id > head {
+		head++
+	} else {
+		tail--
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(idToKey(id), value)
+	if err = s.writeMeta(batch, head, tail); err != nil {
+		return err
+	}
+	item.ID = id
+	item.Key = idToKey(id)
+	s.head, s.tail = head, tail
+	s.bounds.add(uint64(len(item.Value)))
+	s.counters.Enqueued++
+	fireItem(s.hooks.OnRequeue, item)
+
+	return nil
+}
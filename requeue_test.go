@@ -0,0 +1,147 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueRequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	seq := item.Seq
+
+	// Send the item to the back of the line as a retry.
+	if err = pq.Requeue(item, true); err != nil {
+		t.Error(err)
+	}
+	if item.ID != 4 || item.Seq != seq || item.Attempts != 1 {
+		t.Errorf("Expected ID 4, seq %d and 1 attempt, got %d, %d and %d", seq, item.ID, item.Seq, item.Attempts)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	// Reopen the priority queue, which should keep the attempt count.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, want := range []string{"value for item 2", "value for item 3", "value for item 1"} {
+		item, err = pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if item.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", item.Attempts)
+	}
+
+	// Without retry, the attempt count is kept as is.
+	if err = pq.Requeue(item, false); err != nil {
+		t.Error(err)
+	}
+	if item.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", item.Attempts)
+	}
+}
+
+func TestPriorityQueueRequeueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	if err = pq.Requeue(NewPriorityItemString("value", 0), false); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestStackRequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	// An empty stack takes the item.
+	if err = s.Requeue(NewItemString("value for item 1")); err != nil {
+		t.Error(err)
+	}
+	for i := 2; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// There is no room below the first item.
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+	if err = s.Requeue(item); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	// Free the bottom ID and requeue the item there.
+	if _, err = s.RemoveByID(1); err != nil {
+		t.Error(err)
+	}
+	if err = s.Requeue(item); err != nil {
+		t.Error(err)
+	}
+	if item.ID != 1 {
+		t.Errorf("Expected ID 1, got %d", item.ID)
+	}
+
+	for _, want := range []string{"value for item 2", "value for item 3"} {
+		item, err = s.Pop()
+		if err != nil {
+			t.Error(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected string to be '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestStackRequeueClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	s.Close()
+
+	if err = s.Requeue(NewItemString("value")); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
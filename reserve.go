@@ -0,0 +1,44 @@
+package goque
+
+import (
+	"time"
+)
+
+// Reserve removes the next item in the priority queue and returns it
+// along with an ownership token, hiding the item for the given
+// visibility timeout. The reservation is persisted, so it survives
+// restarts.
+//
+// The item must be passed to Ack once processed. If it is not acked in
+// time, it is returned to the queue on the next dequeue, giving
+// at-least-once delivery.
+func (pq *PriorityQueue) Reserve(timeout time.Duration) (*PriorityItem, Token, error) {
+	return pq.DequeueWithLease(timeout)
+}
+
+// Ack deletes the reserved item owned by the given token. It is
+// equivalent to Complete.
+func (pq *PriorityQueue) Ack(token Token) error {
+	return pq.Complete(token)
+}
+
+// Nack makes the reserved item owned by the given token immediately
+// visible again, returning it to the head of its priority level so it
+// is the next item dequeued from that level.
+func (pq *PriorityQueue) Nack(token Token) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Get the lease for this token.
+	lease, err := pq.getLease(token)
+	if err != nil {
+		return err
+	}
+
+	return pq.failLease(lease, true)
+}
@@ -0,0 +1,156 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueReserveAck(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.Reserve(time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	if err = pq.Ack(token); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Ack(token); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+}
+
+func TestPriorityQueueNack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, token, err := pq.Reserve(time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Nack(token); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if err = pq.Nack(token); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+}
+
+func TestPriorityQueueNackEmptyLevel(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 3)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.Reserve(time.Minute)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Reopen the priority queue so the empty level starts over.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Nack(token); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value" || item.Priority != 3 {
+		t.Errorf("Expected 'value' with priority 3, got '%s' with %d", item.ToString(), item.Priority)
+	}
+}
+
+func TestPriorityQueueReserveTimeout(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	_, token, err := pq.Reserve(20 * time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// Reopen the priority queue so the reservation has to be reloaded.
+	pq.Close()
+	time.Sleep(30 * time.Millisecond)
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value" {
+		t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+	}
+
+	if err = pq.Ack(token); err != ErrInvalidToken {
+		t.Errorf("Expected to get invalid token error, got %v", err)
+	}
+}
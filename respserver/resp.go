@@ -0,0 +1,132 @@
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The longest bulk string and the most arguments accepted in a command,
+// so a bad request can't make the server allocate an arbitrary amount
+// of memory.
+const (
+	maxBulkLen = 512 << 20
+	maxArgs    = 1 << 20
+)
+
+// errProtocol is returned when a request doesn't follow the protocol.
+var errProtocol = errors.New("ERR Protocol error")
+
+// readCommand reads a command from r, sent either as an array of bulk
+// strings or inline as words separated by spaces.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// An inline command, as typed in telnet.
+		var args [][]byte
+		for _, word := range strings.Fields(string(line)) {
+			args = append(args, []byte(word))
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, errProtocol
+	}
+
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+
+		// Read the bulk string along with its trailing CRLF.
+		arg := make([]byte, size+2)
+		if _, err = io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+// readLine reads a line ending with CRLF, or LF for inline commands,
+// and returns it without its ending.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	return line, nil
+}
+
+// writer writes replies to a connection.
+type writer struct {
+	*bufio.Writer
+}
+
+// simple writes a simple string reply, such as OK.
+func (w writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// error writes an error reply. The message starts with an error code,
+// such as ERR.
+func (w writer) error(msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
+
+// integer writes an integer reply.
+func (w writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// bulk writes a bulk string reply.
+func (w writer) bulk(b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// null writes a null bulk string reply.
+func (w writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// nullArray writes a null array reply, as returned by blocking commands
+// that timed out.
+func (w writer) nullArray() {
+	w.WriteString("*-1\r\n")
+}
+
+// array writes the header of an array reply of n elements, which must
+// be written next.
+func (w writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
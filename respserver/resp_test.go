@@ -0,0 +1,64 @@
+package respserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{"*2\r\n$4\r\nLLEN\r\n$4\r\njobs\r\n", []string{"LLEN", "jobs"}, nil},
+		{"*1\r\n$6\r\na\r\nb c\r\n", []string{"a\r\nb c"}, nil},
+		{"*2\r\n$0\r\n\r\n$1\r\nx\r\n", []string{"", "x"}, nil},
+		{"LLEN  jobs\n", []string{"LLEN", "jobs"}, nil},
+		{"\r\n", nil, nil},
+		{"*x\r\n", nil, errProtocol},
+		{"*1\r\n:1\r\n", nil, errProtocol},
+		{"*1\r\n$-1\r\n", nil, errProtocol},
+		{"*1\r\n$1\r\nab\r\n", nil, errProtocol},
+		{"*2\r\n$4\r\nLLEN\r\n", nil, io.EOF},
+		{"*1\r\n$4\r\nLL", nil, io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		args, err := readCommand(bufio.NewReader(strings.NewReader(tt.in)))
+		if err != tt.err {
+			t.Errorf("Expected error %v reading %q, got %v", tt.err, tt.in, err)
+			continue
+		}
+
+		var got []string
+		for _, arg := range args {
+			got = append(got, string(arg))
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("Expected %q reading %q, got %q", tt.want, tt.in, got)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := writer{bufio.NewWriter(&buf)}
+
+	w.simple("OK")
+	w.error("ERR bad")
+	w.integer(-3)
+	w.array(2)
+	w.bulk([]byte("a\r\nb"))
+	w.null()
+	w.nullArray()
+	w.Flush()
+
+	want := "+OK\r\n-ERR bad\r\n:-3\r\n*2\r\n$4\r\na\r\nb\r\n$-1\r\n*-1\r\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
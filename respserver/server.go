@@ -0,0 +1,609 @@
+// Package respserver serves Goque queues and priority queues over the
+// Redis protocol (RESP), so existing Redis clients can use an embedded
+// Goque instance, such as during a Redis outage or in edge deployments.
+//
+// Every data structure is registered under a key. A queue serves the
+// list commands, used as a FIFO:
+//
+//	LPUSH key value [value ...]    Enqueue the values.
+//	RPOP key [count]               Dequeue the next item(s).
+//	BRPOP key [key ...] timeout    Dequeue the next item of the first
+//	                               non-empty key, waiting up to timeout
+//	                               seconds, or forever for 0.
+//	LLEN key                       Get the number of items.
+//
+// A priority queue serves the sorted set commands, with the score as the
+// priority of an item, from 0 to 255, and the member as its value:
+//
+//	ZADD key score member [score member ...]
+//	ZPOPMIN key [count]
+//	BZPOPMIN key [key ...] timeout
+//	ZCARD key
+//
+// ZPOPMIN dequeues in the order of the priority queue, which is the
+// lowest score first for an ASC priority queue. Members are not unique,
+// unlike those of a Redis sorted set. PING, ECHO and QUIT are supported
+// as well. Unregistered keys read as empty, but can't be written to.
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+var (
+	// ErrRegistered is returned when registering a data structure
+	// under a key that is already taken.
+	ErrRegistered = errors.New("respserver: Key is already registered")
+
+	// ErrUnsupportedType is returned when registering a value that is
+	// not a queue or priority queue.
+	ErrUnsupportedType = errors.New("respserver: Data structure type is not supported")
+
+	// ErrServerClosed is returned by Serve once the server is closed.
+	ErrServerClosed = errors.New("respserver: Server closed")
+)
+
+// pollInterval is how often blocking commands check their keys for
+// items.
+const pollInterval = 10 * time.Millisecond
+
+// The replies of failed commands.
+const (
+	errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errNoSuchKey = "ERR no such key"
+	errNotInt    = "ERR value is not an integer or out of range"
+	errScore     = "ERR score must be an integer from 0 to 255"
+	errTimeout   = "ERR timeout is not a float or out of range"
+)
+
+// Server serves the registered data structures over RESP.
+type Server struct {
+	mu         sync.RWMutex
+	structures map[string]interface{}
+	listeners  map[net.Listener]struct{}
+	conns      map[net.Conn]struct{}
+	done       chan struct{}
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+// New returns a Server without any data structure.
+func New() *Server {
+	return &Server{
+		structures: make(map[string]interface{}),
+		listeners:  make(map[net.Listener]struct{}),
+		conns:      make(map[net.Conn]struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Register serves the given *goque.Queue or *goque.PriorityQueue under
+// key. Any other value returns ErrUnsupportedType. The data structure
+// must be unregistered before it is closed.
+func (s *Server) Register(key string, v interface{}) error {
+	switch v.(type) {
+	case *goque.Queue, *goque.PriorityQueue:
+	default:
+		return ErrUnsupportedType
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.structures[key]; ok {
+		return ErrRegistered
+	}
+	s.structures[key] = v
+
+	return nil
+}
+
+// Unregister stops serving the data structure registered under key.
+func (s *Server) Unregister(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.structures, key)
+}
+
+// ListenAndServe listens on the given TCP address and serves the
+// connections accepted on it.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on l until the server is
+// closed, when it returns ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, closes every connection and waits for the
+// commands in progress to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+		for l := range s.listeners {
+			l.Close()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn runs the commands read from a connection until it is
+// closed.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r)
+		if err == errProtocol {
+			w.error(err.Error())
+			w.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.run(w, args)
+
+		// Flush once every pipelined command was answered.
+		if r.Buffered() == 0 || quit {
+			if err = w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// run runs a command and writes its reply. It returns true if the
+// connection should be closed.
+func (s *Server) run(w writer, args [][]byte) bool {
+	name := strings.ToLower(string(args[0]))
+	args = args[1:]
+
+	switch name {
+	case "ping":
+		if len(args) > 1 {
+			wrongArgs(w, name)
+		} else if len(args) == 1 {
+			w.bulk(args[0])
+		} else {
+			w.simple("PONG")
+		}
+	case "echo":
+		if len(args) != 1 {
+			wrongArgs(w, name)
+		} else {
+			w.bulk(args[0])
+		}
+	case "quit":
+		w.simple("OK")
+		return true
+	case "lpush":
+		s.lpush(w, args)
+	case "rpop":
+		s.rpop(w, args)
+	case "brpop":
+		s.blockingPop(w, name, args, s.popQueue)
+	case "llen":
+		s.llen(w, args)
+	case "zadd":
+		s.zadd(w, args)
+	case "zpopmin":
+		s.zpopmin(w, args)
+	case "bzpopmin":
+		s.blockingPop(w, name, args, s.popPriorityQueue)
+	case "zcard":
+		s.zcard(w, args)
+	default:
+		w.error("ERR unknown command '" + name + "'")
+	}
+
+	return false
+}
+
+// wrongArgs writes the error of a command called with the wrong number
+// of arguments.
+func wrongArgs(w writer, name string) {
+	w.error("ERR wrong number of arguments for '" + name + "' command")
+}
+
+// lookup returns the data structure registered under key, or nil.
+func (s *Server) lookup(key []byte) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.structures[string(key)]
+}
+
+// queue returns the queue registered under key. It returns false after
+// writing an error if another type of data structure is registered
+// under key, or if there is none and write is set.
+func (s *Server) queue(w writer, key []byte, write bool) (*goque.Queue, bool) {
+	switch v := s.lookup(key).(type) {
+	case *goque.Queue:
+		return v, true
+	case nil:
+		if write {
+			w.error(errNoSuchKey)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	w.error(errWrongType)
+	return nil, false
+}
+
+// priorityQueue is like queue for a priority queue.
+func (s *Server) priorityQueue(w writer, key []byte, write bool) (*goque.PriorityQueue, bool) {
+	switch v := s.lookup(key).(type) {
+	case *goque.PriorityQueue:
+		return v, true
+	case nil:
+		if write {
+			w.error(errNoSuchKey)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	w.error(errWrongType)
+	return nil, false
+}
+
+func (s *Server) lpush(w writer, args [][]byte) {
+	if len(args) < 2 {
+		wrongArgs(w, "lpush")
+		return
+	}
+
+	q, ok := s.queue(w, args[0], true)
+	if !ok {
+		return
+	}
+
+	for _, value := range args[1:] {
+		if _, err := q.EnqueueValue(value); err != nil {
+			w.error("ERR " + err.Error())
+			return
+		}
+	}
+
+	w.integer(int64(q.Length()))
+}
+
+func (s *Server) rpop(w writer, args [][]byte) {
+	if len(args) < 1 || len(args) > 2 {
+		wrongArgs(w, "rpop")
+		return
+	}
+
+	q, ok := s.queue(w, args[0], false)
+	if !ok {
+		return
+	}
+
+	count, ok := parseCount(w, args[1:])
+	if !ok {
+		return
+	}
+
+	var values [][]byte
+	for q != nil && len(values) < count {
+		item, err := q.Dequeue()
+		if err == goque.ErrEmpty {
+			break
+		} else if err != nil {
+			w.error("ERR " + err.Error())
+			return
+		}
+		values = append(values, item.Value)
+	}
+
+	if len(args) == 1 {
+		if len(values) == 0 {
+			w.null()
+		} else {
+			w.bulk(values[0])
+		}
+		return
+	}
+
+	if len(values) == 0 {
+		w.nullArray()
+		return
+	}
+	w.array(len(values))
+	for _, value := range values {
+		w.bulk(value)
+	}
+}
+
+func (s *Server) llen(w writer, args [][]byte) {
+	if len(args) != 1 {
+		wrongArgs(w, "llen")
+		return
+	}
+
+	q, ok := s.queue(w, args[0], false)
+	if !ok {
+		return
+	}
+
+	if q == nil {
+		w.integer(0)
+		return
+	}
+	w.integer(int64(q.Length()))
+}
+
+func (s *Server) zadd(w writer, args [][]byte) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		wrongArgs(w, "zadd")
+		return
+	}
+
+	pq, ok := s.priorityQueue(w, args[0], true)
+	if !ok {
+		return
+	}
+
+	// Check every score before adding any item.
+	items := make([]*goque.PriorityItem, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		priority, err := strconv.ParseUint(string(args[i]), 10, 8)
+		if err != nil {
+			w.error(errScore)
+			return
+		}
+		items = append(items, goque.NewPriorityItem(args[i+1], uint8(priority)))
+	}
+
+	if _, err := pq.EnqueueBatch(items); err != nil {
+		w.error("ERR " + err.Error())
+		return
+	}
+
+	w.integer(int64(len(items)))
+}
+
+func (s *Server) zpopmin(w writer, args [][]byte) {
+	if len(args) < 1 || len(args) > 2 {
+		wrongArgs(w, "zpopmin")
+		return
+	}
+
+	pq, ok := s.priorityQueue(w, args[0], false)
+	if !ok {
+		return
+	}
+
+	count, ok := parseCount(w, args[1:])
+	if !ok {
+		return
+	}
+
+	var items []*goque.PriorityItem
+	for pq != nil && len(items) < count {
+		item, err := pq.Dequeue()
+		if err == goque.ErrEmpty {
+			break
+		} else if err != nil {
+			w.error("ERR " + err.Error())
+			return
+		}
+		items = append(items, item)
+	}
+
+	w.array(2 * len(items))
+	for _, item := range items {
+		w.bulk(item.Value)
+		w.bulk([]byte(strconv.Itoa(int(item.Priority))))
+	}
+}
+
+func (s *Server) zcard(w writer, args [][]byte) {
+	if len(args) != 1 {
+		wrongArgs(w, "zcard")
+		return
+	}
+
+	pq, ok := s.priorityQueue(w, args[0], false)
+	if !ok {
+		return
+	}
+
+	if pq == nil {
+		w.integer(0)
+		return
+	}
+	w.integer(int64(pq.Length()))
+}
+
+// popFunc pops the next item of the data structure registered under
+// key, writing its reply and returning true, or returns false if there
+// is none. It writes an error and returns true if the pop failed.
+type popFunc func(w writer, key []byte) bool
+
+// popQueue pops the next item of a queue for BRPOP.
+func (s *Server) popQueue(w writer, key []byte) bool {
+	q, ok := s.queue(w, key, false)
+	if !ok {
+		return true
+	}
+	if q == nil {
+		return false
+	}
+
+	item, err := q.Dequeue()
+	if err == goque.ErrEmpty {
+		return false
+	} else if err != nil {
+		w.error("ERR " + err.Error())
+		return true
+	}
+
+	w.array(2)
+	w.bulk(key)
+	w.bulk(item.Value)
+	return true
+}
+
+// popPriorityQueue pops the next item of a priority queue for BZPOPMIN.
+func (s *Server) popPriorityQueue(w writer, key []byte) bool {
+	pq, ok := s.priorityQueue(w, key, false)
+	if !ok {
+		return true
+	}
+	if pq == nil {
+		return false
+	}
+
+	item, err := pq.Dequeue()
+	if err == goque.ErrEmpty {
+		return false
+	} else if err != nil {
+		w.error("ERR " + err.Error())
+		return true
+	}
+
+	w.array(3)
+	w.bulk(key)
+	w.bulk(item.Value)
+	w.bulk([]byte(strconv.Itoa(int(item.Priority))))
+	return true
+}
+
+// blockingPop pops the next item of the first of the given keys that
+// has one, checking them every pollInterval until the timeout given as
+// the last argument. A timeout of 0 waits until the server is closed.
+func (s *Server) blockingPop(w writer, name string, args [][]byte, pop popFunc) {
+	if len(args) < 2 {
+		wrongArgs(w, name)
+		return
+	}
+
+	seconds, err := strconv.ParseFloat(string(args[len(args)-1]), 64)
+	if err != nil || seconds < 0 {
+		w.error(errTimeout)
+		return
+	}
+	keys := args[:len(args)-1]
+
+	var deadline <-chan time.Time
+	if seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, key := range keys {
+			if pop(w, key) {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			w.nullArray()
+			return
+		case <-s.done:
+			w.nullArray()
+			return
+		}
+	}
+}
+
+// parseCount returns the count given as the optional argument of a
+// pop, or 1 if there is none. It returns false after writing an error
+// if the count is invalid.
+func parseCount(w writer, args [][]byte) (int, bool) {
+	if len(args) == 0 {
+		return 1, true
+	}
+
+	n, err := strconv.Atoi(string(args[0]))
+	if err != nil || n < 0 {
+		w.error(errNotInt)
+		return 0, false
+	}
+
+	return n, true
+}
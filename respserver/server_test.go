@@ -0,0 +1,297 @@
+package respserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// client sends commands to a Server and reads its replies.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// serve starts a server with the given data structures registered by
+// key, returning a client connected to it and a function stopping it.
+func serve(t *testing.T, structures map[string]interface{}) (*client, func()) {
+	s := New()
+	for key, v := range structures {
+		if err := s.Register(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}, func() {
+		conn.Close()
+		s.Close()
+	}
+}
+
+// send writes a command as an array of bulk strings.
+func (c *client) send(args ...string) {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	if _, err := io.WriteString(c.conn, cmd); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// do sends a command and returns its reply, written on a single line
+// with the elements of arrays separated by spaces.
+func (c *client) do(args ...string) string {
+	c.send(args...)
+	return c.reply()
+}
+
+// reply reads the next reply.
+func (c *client) reply() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := readLine(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(string(line[1:]))
+		if n < 0 {
+			return "(nil)"
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(string(line[1:]))
+		if n < 0 {
+			return "(nil array)"
+		}
+		elems := make([]string, n)
+		for i := range elems {
+			elems[i] = c.reply()
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	}
+
+	return string(line)
+}
+
+func TestServerQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	c, stop := serve(t, map[string]interface{}{"jobs": q})
+	defer stop()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"LPUSH", "jobs", "a", "b", "c"}, ":3"},
+		{[]string{"LLEN", "jobs"}, ":3"},
+		{[]string{"RPOP", "jobs"}, "a"},
+		{[]string{"RPOP", "jobs", "5"}, "[b c]"},
+		{[]string{"RPOP", "jobs"}, "(nil)"},
+		{[]string{"RPOP", "jobs", "2"}, "(nil array)"},
+		{[]string{"LLEN", "other"}, ":0"},
+		{[]string{"RPOP", "other"}, "(nil)"},
+		{[]string{"LPUSH", "other", "a"}, "-" + errNoSuchKey},
+		{[]string{"ZCARD", "jobs"}, "-" + errWrongType},
+		{[]string{"LPUSH", "jobs"}, "-ERR wrong number of arguments for 'lpush' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'flushall'"},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); got != tt.want {
+			t.Errorf("Expected %v to reply %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestServerPriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	c, stop := serve(t, map[string]interface{}{"jobs": pq})
+	defer stop()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ZADD", "jobs", "5", "low", "1", "high", "3", "mid"}, ":3"},
+		{[]string{"ZADD", "jobs", "256", "bad"}, "-" + errScore},
+		{[]string{"ZADD", "jobs", "1", "a", "x", "b"}, "-" + errScore},
+		{[]string{"ZCARD", "jobs"}, ":3"},
+		{[]string{"ZPOPMIN", "jobs"}, "[high 1]"},
+		{[]string{"ZPOPMIN", "jobs", "5"}, "[mid 3 low 5]"},
+		{[]string{"ZPOPMIN", "jobs"}, "[]"},
+		{[]string{"LLEN", "jobs"}, "-" + errWrongType},
+	}
+
+	for _, tt := range tests {
+		if got := c.do(tt.args...); got != tt.want {
+			t.Errorf("Expected %v to reply %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestServerBlockingPop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	pqFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(pqFile, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	c, stop := serve(t, map[string]interface{}{"jobs": q, "tasks": pq})
+	defer stop()
+
+	if got := c.do("BRPOP", "jobs", "0.05"); got != "(nil array)" {
+		t.Errorf("Expected BRPOP to time out, got %q", got)
+	}
+
+	c.send("BRPOP", "other", "jobs", "0")
+	time.Sleep(50 * time.Millisecond)
+	if _, err = q.EnqueueString("value"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.reply(); got != "[jobs value]" {
+		t.Errorf("Expected BRPOP to reply [jobs value], got %q", got)
+	}
+
+	c.send("BZPOPMIN", "tasks", "1")
+	time.Sleep(50 * time.Millisecond)
+	if err = pq.Enqueue(goque.NewPriorityItem([]byte("task"), 7)); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.reply(); got != "[tasks task 7]" {
+		t.Errorf("Expected BZPOPMIN to reply [tasks task 7], got %q", got)
+	}
+
+	if got := c.do("BRPOP", "jobs", "-1"); got != "-"+errTimeout {
+		t.Errorf("Expected an invalid timeout error, got %q", got)
+	}
+}
+
+func TestServerPipelineAndInline(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	c, stop := serve(t, map[string]interface{}{"jobs": q})
+	defer stop()
+
+	io.WriteString(c.conn, "*3\r\n$5\r\nLPUSH\r\n$4\r\njobs\r\n$1\r\na\r\nLPUSH jobs b\r\nRPOP jobs 2\r\nQUIT\r\n")
+	for _, want := range []string{":1", ":2", "[a b]", "+OK"} {
+		if got := c.reply(); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	if _, err = c.r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected QUIT to close the connection, got %v", err)
+	}
+}
+
+func TestServerRegister(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	srv := New()
+	if err = srv.Register("stack", s); err != ErrUnsupportedType {
+		t.Errorf("Expected error ErrUnsupportedType, got %v", err)
+	}
+
+	q, err := goque.OpenQueue(file + "_queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	if err = srv.Register("jobs", q); err != nil {
+		t.Error(err)
+	}
+	if err = srv.Register("jobs", q); err != ErrRegistered {
+		t.Errorf("Expected error ErrRegistered, got %v", err)
+	}
+	srv.Unregister("jobs")
+	if err = srv.Register("jobs", q); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Close unblocks the pending BRPOP and stops serving.
+	io.WriteString(conn, "BRPOP jobs 0\r\n")
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+
+	if err = <-errc; err != ErrServerClosed {
+		t.Errorf("Expected error ErrServerClosed, got %v", err)
+	}
+	if err = s.Serve(l); err != ErrServerClosed {
+		t.Errorf("Expected error ErrServerClosed, got %v", err)
+	}
+}
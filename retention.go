@@ -0,0 +1,103 @@
+package goque
+
+import (
+	"time"
+)
+
+// SetRetention sets the retention policy of the priority queue and trims
+// the items it no longer keeps. The policy is applied again after every
+// enqueue and committed transaction. Unlike a capacity, it never rejects
+// or blocks an enqueue, but discards the oldest items once the new ones
+// are written.
+//
+// Items are trimmed from the head of their priority level. Age is based
+// on the CreatedAt time of the items, so items without one are only
+// trimmed by MaxBytes. Items in flight are never trimmed.
+//
+// Each trimmed item is passed to the OnDrop hook and counted in the
+// Trimmed counter of the stats. The policy isn't persisted, so
+// SetRetention should be called right after every open.
+func (pq *PriorityQueue) SetRetention(r Retention) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Track the size of the item values, unless a capacity already does.
+	if r.MaxBytes > 0 && pq.bounds == nil {
+		b, err := pq.newBounds(Capacity{})
+		if err != nil {
+			return err
+		}
+		pq.bounds = b
+	}
+
+	pq.retention = r
+	_, err := pq.trim(time.Now())
+	return err
+}
+
+// Trim applies the retention policy of the priority queue, returning the
+// number of items trimmed. Age based retention only trims on enqueues,
+// so Trim can be called periodically, or by the janitor started with
+// SetJanitor, for priority queues that are rarely added to.
+func (pq *PriorityQueue) Trim() (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return pq.trim(time.Now())
+}
+
+// trim removes the items older than the given time allows, then the
+// oldest items until the values fit. The caller must hold the lock.
+func (pq *PriorityQueue) trim(now time.Time) (int, error) {
+	r := pq.retention
+	if r.MaxAge <= 0 && r.MaxBytes == 0 {
+		return 0, nil
+	}
+
+	var trimmed int
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		for _, priority := range pq.active.levels() {
+			for pq.levels[priority].length() > 0 {
+				item, err := pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+				if err != nil {
+					return trimmed, err
+				}
+				if item.CreatedAt.IsZero() || !item.CreatedAt.Before(cutoff) {
+					break
+				}
+
+				if err = pq.dropHead(item); err != nil {
+					return trimmed, err
+				}
+				pq.counters.Trimmed++
+				trimmed++
+			}
+		}
+	}
+
+	for r.MaxBytes > 0 && pq.bounds.bytes > r.MaxBytes && pq.Length() > 0 {
+		item, err := pq.oldestItem()
+		if err != nil {
+			return trimmed, err
+		}
+
+		if err = pq.dropHead(item); err != nil {
+			return trimmed, err
+		}
+		pq.counters.Trimmed++
+		trimmed++
+	}
+
+	return trimmed, nil
+}
@@ -0,0 +1,124 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueRetentionMaxBytes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	var dropped []*PriorityItem
+	pq.SetHooks(PriorityHooks{OnDrop: func(item *PriorityItem) {
+		dropped = append(dropped, item)
+	}})
+
+	value := bytes.Repeat([]byte{'x'}, 10)
+	for i := 0; i < 10; i++ {
+		if err = pq.Enqueue(NewPriorityItem(value, uint8(i%2))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Trim down to 50 bytes of values, oldest first across the levels.
+	if err = pq.SetRetention(Retention{MaxBytes: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+	if len(dropped) != 5 {
+		t.Fatalf("Expected 5 items to be dropped, got %d", len(dropped))
+	}
+	for i, item := range dropped {
+		if item.Seq != uint64(i+1) {
+			t.Errorf("Expected item %d to be dropped, got item %d", i+1, item.Seq)
+		}
+	}
+
+	// Enqueues never block, but push out the oldest items.
+	if err = pq.Enqueue(NewPriorityItem(value, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+	if _, err = pq.EnqueueBatch([]*PriorityItem{NewPriorityItem(value, 1), NewPriorityItem(value, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", pq.Length())
+	}
+
+	stats, err := pq.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Counters.Trimmed != 8 {
+		t.Errorf("Expected 8 trimmed items, got %d", stats.Counters.Trimmed)
+	}
+}
+
+func TestPriorityQueueRetentionMaxAge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 0; i < 3; i++ {
+		if _, err = pq.EnqueueString(uint8(i), "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err = pq.EnqueueString(1, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trim every item older than the limit.
+	if err = pq.SetRetention(Retention{MaxAge: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+	item, err := pq.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "new" {
+		t.Errorf("Expected 'new', got '%s'", item.ToString())
+	}
+
+	// Trim applies the policy without an enqueue.
+	time.Sleep(20 * time.Millisecond)
+	if n, err := pq.Trim(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("Expected 1 item to be trimmed, got %d", n)
+	}
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+
+	// The zero Retention keeps every item.
+	if err = pq.SetRetention(Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(0, "kept"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n, err := pq.Trim(); err != nil || n != 0 {
+		t.Errorf("Expected nothing to be trimmed, got %d and %v", n, err)
+	}
+}
@@ -0,0 +1,189 @@
+package goque
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// RetryOptions configures the backoff of a retry queue.
+type RetryOptions struct {
+	// BaseDelay is the delay before the first retry. Defaults to one
+	// second.
+	BaseDelay time.Duration
+
+	// Multiplier is the factor the delay grows by with every retry.
+	// Defaults to 2.
+	Multiplier float64
+
+	// MaxDelay, if set, caps the delay between retries.
+	MaxDelay time.Duration
+
+	// MaxAttempts, if set, is the number of attempts an item gets,
+	// including the first one, before Retry rejects it.
+	MaxAttempts uint32
+}
+
+// RetryItem represents an entry in a retry queue.
+//
+// Attempts is the number of times the item has been retried.
+type RetryItem struct {
+	ID        uint64
+	Attempts  uint32
+	VisibleAt time.Time
+	Key       []byte
+	Value     []byte
+}
+
+// ToString returns the retry item value as a string.
+func (ri *RetryItem) ToString() string {
+	return string(ri.Value)
+}
+
+// RetryQueue is a queue where failed items are retried after an
+// exponentially increasing delay.
+type RetryQueue struct {
+	dq   *DelayQueue
+	opts RetryOptions
+}
+
+// OpenRetryQueue opens a retry queue if one exists at the given
+// directory. If one does not already exist, a new retry queue is
+// created.
+func OpenRetryQueue(dataDir string, opts RetryOptions) (*RetryQueue, error) {
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = time.Second
+	}
+	if opts.Multiplier <= 0 {
+		opts.Multiplier = 2
+	}
+
+	dq, err := openDelayQueue(dataDir, goqueRetryQueue)
+	return &RetryQueue{dq: dq, opts: opts}, err
+}
+
+// Enqueue adds an item with the given value to the retry queue, visible
+// right away.
+func (rq *RetryQueue) Enqueue(value []byte) (*RetryItem, error) {
+	item := &RetryItem{VisibleAt: time.Now(), Value: value}
+	return item, rq.put(item)
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a value
+// as a string rather than a byte slice.
+func (rq *RetryQueue) EnqueueString(value string) (*RetryItem, error) {
+	return rq.Enqueue([]byte(value))
+}
+
+// Dequeue removes the next visible item in the retry queue and returns
+// it. If the retry queue has items but none of them are visible yet,
+// ErrNotVisible is returned.
+func (rq *RetryQueue) Dequeue() (*RetryItem, error) {
+	di, err := rq.dq.Dequeue()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRetryItem(di)
+}
+
+// Peek returns the next item in the retry queue without removing it,
+// whether or not it is visible yet.
+func (rq *RetryQueue) Peek() (*RetryItem, error) {
+	di, err := rq.dq.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRetryItem(di)
+}
+
+// Retry adds a failed item back to the retry queue, visible once its
+// backoff delay has passed. If the item has used up its attempts, it is
+// not added and ErrMaxAttempts is returned.
+func (rq *RetryQueue) Retry(item *RetryItem) error {
+	if rq.opts.MaxAttempts > 0 && item.Attempts+1 >= rq.opts.MaxAttempts {
+		return ErrMaxAttempts
+	}
+
+	item.Attempts++
+	item.VisibleAt = time.Now().Add(rq.Backoff(item.Attempts))
+	return rq.put(item)
+}
+
+// Backoff returns the delay before the given retry attempt, starting
+// from 1.
+func (rq *RetryQueue) Backoff(attempt uint32) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+
+	delay := float64(rq.opts.BaseDelay) * math.Pow(rq.opts.Multiplier, float64(attempt-1))
+	if rq.opts.MaxDelay > 0 && delay > float64(rq.opts.MaxDelay) {
+		return rq.opts.MaxDelay
+	} else if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(delay)
+}
+
+// Length returns the total number of items in the retry queue, visible
+// or not.
+func (rq *RetryQueue) Length() uint64 {
+	return rq.dq.Length()
+}
+
+// Close closes the LevelDB database of the retry queue.
+func (rq *RetryQueue) Close() error {
+	return rq.dq.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the retry queue, as
+// long as it holds no items, visible or not. Otherwise nothing is done
+// and ErrNotEmpty is returned.
+func (rq *RetryQueue) Drop() error {
+	return rq.dq.Drop()
+}
+
+// ForceDrop closes and deletes the LevelDB database of the retry queue,
+// along with any items it still holds.
+func (rq *RetryQueue) ForceDrop() error {
+	return rq.dq.ForceDrop()
+}
+
+// put adds the given item to the underlying delay queue, storing its
+// attempt count in front of its value.
+func (rq *RetryQueue) put(item *RetryItem) error {
+	// attempts + value = 4 + n
+	data := make([]byte, 4+len(item.Value))
+	binary.BigEndian.PutUint32(data[0:4], item.Attempts)
+	copy(data[4:], item.Value)
+
+	di := &DelayItem{VisibleAt: item.VisibleAt, Value: data}
+	if err := rq.dq.Enqueue(di); err != nil {
+		return err
+	}
+
+	item.ID = di.ID
+	item.Key = di.Key
+	return nil
+}
+
+// decodeRetryItem creates a RetryItem from the given item of the
+// underlying delay queue.
+func decodeRetryItem(di *DelayItem) (*RetryItem, error) {
+	if len(di.Value) < 4 {
+		return nil, ErrInvalidRecord
+	}
+
+	item := &RetryItem{
+		ID:        di.ID,
+		Attempts:  binary.BigEndian.Uint32(di.Value[0:4]),
+		VisibleAt: di.VisibleAt,
+		Key:       di.Key,
+		Value:     di.Value[4:],
+	}
+
+	return item, nil
+}
@@ -0,0 +1,97 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryQueueIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+	dq.Close()
+
+	if _, err = OpenRetryQueue(file, RetryOptions{}); err != ErrIncompatibleType {
+		t.Error("Expected retry queue to return ErrIncompatibleTypes when opening DelayQueue")
+	}
+}
+
+func TestRetryQueueRetry(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := OpenRetryQueue(file, RetryOptions{BaseDelay: 20 * time.Millisecond, MaxAttempts: 3})
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.ForceDrop()
+
+	if _, err = rq.EnqueueString("value"); err != nil {
+		t.Error(err)
+	}
+
+	item, err := rq.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.ToString() != "value" || item.Attempts != 0 {
+		t.Errorf("Expected 'value' with 0 attempts, got '%s' with %d", item.ToString(), item.Attempts)
+	}
+
+	if err = rq.Retry(item); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = rq.Dequeue(); err != ErrNotVisible {
+		t.Errorf("Expected to get not visible error, got %v", err)
+	}
+
+	// Reopen the retry queue to make sure the attempts persist.
+	rq.Close()
+	if rq, err = OpenRetryQueue(file, RetryOptions{BaseDelay: 20 * time.Millisecond, MaxAttempts: 3}); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if item, err = rq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if item.ToString() != "value" || item.Attempts != 1 {
+		t.Errorf("Expected 'value' with 1 attempt, got '%s' with %d", item.ToString(), item.Attempts)
+	}
+
+	if err = rq.Retry(item); err != nil {
+		t.Error(err)
+	}
+
+	if item, err = rq.Peek(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = rq.Retry(item); err != ErrMaxAttempts {
+		t.Errorf("Expected to get max attempts error, got %v", err)
+	}
+
+	if rq.Length() != 1 {
+		t.Errorf("Expected retry queue length of 1, got %d", rq.Length())
+	}
+}
+
+func TestRetryQueueBackoff(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := OpenRetryQueue(file, RetryOptions{BaseDelay: time.Second, Multiplier: 3, MaxDelay: 20 * time.Second})
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.ForceDrop()
+
+	for attempt, delay := range []time.Duration{0, time.Second, 3 * time.Second, 9 * time.Second, 20 * time.Second, 20 * time.Second} {
+		if backoff := rq.Backoff(uint32(attempt)); backoff != delay {
+			t.Errorf("Expected backoff of attempt %d to be %s, got %s", attempt, delay, backoff)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// KeyUsage reports which keys the stored values of a data structure are
+// encrypted with.
+type KeyUsage struct {
+	// Current is the ID of the key new values are encrypted with.
+	Current uint32
+
+	// Keys is the number of values encrypted with each key, by ID.
+	Keys map[uint32]uint64
+
+	// Unencrypted is the number of values stored in the clear.
+	Unencrypted uint64
+
+	// Failed holds the keys of the records RotateKey couldn't
+	// re-encrypt, because their value couldn't be decrypted or failed
+	// its checksum. They are left as they were.
+	Failed [][]byte
+}
+
+// Stale returns the number of values that are not encrypted with the
+// current key, including the ones stored in the clear.
+func (u *KeyUsage) Stale() uint64 {
+	stale := u.Unencrypted
+	for id, n := range u.Keys {
+		if id != u.Current {
+			stale += n
+		}
+	}
+
+	return stale
+}
+
+// add counts a value encrypted with the key of the given ID, or stored
+// in the clear if not encrypted.
+func (u *KeyUsage) add(id uint32, encrypted bool) {
+	if !encrypted {
+		u.Unencrypted++
+		return
+	}
+	u.Keys[id]++
+}
+
+// KeyUsage returns which keys the items of the priority queue and its
+// items in flight are encrypted with. If encryption isn't enabled,
+// ErrEncryptionDisabled is returned.
+func (pq *PriorityQueue) KeyUsage() (*KeyUsage, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return pq.rekey(pq.seal, false)
+}
+
+// RotateKey makes the priority queue encrypt new values with the key of
+// the given ID, which is fetched from the KeyProvider passed to
+// SetEncryption, and re-encrypts every value of an item, in the
+// priority queue or in flight, that isn't encrypted with it yet. Values
+// stored in the clear are encrypted along the way. The values are
+// written in batches, so if RotateKey fails part way, the values
+// re-encrypted so far stay re-encrypted.
+//
+// The returned KeyUsage tells which keys the values are encrypted with
+// afterwards. Values that can't be decrypted are left as they were and
+// listed in Failed. The records of the change log keep the key they
+// were written with, so old keys can only be retired once they are
+// trimmed.
+//
+// The key stays current until encryption is set again, so the provider
+// should return it as its current key from now on. If encryption isn't
+// enabled, ErrEncryptionDisabled is returned.
+func (pq *PriorityQueue) RotateKey(newKeyID uint32) (*KeyUsage, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	seal, err := pq.seal.withKey(newKeyID)
+	if err != nil {
+		return nil, err
+	}
+	pq.seal = seal
+
+	return pq.rekey(seal, true)
+}
+
+// rekey counts the keys the values of the items and the records of the
+// items in flight are encrypted with, re-encrypting the ones that
+// aren't encrypted with the current key of seal if rotate is set. The
+// caller must hold the lock.
+func (pq *PriorityQueue) rekey(seal valueSeal, rotate bool) (*KeyUsage, error) {
+	if seal.crypt == nil {
+		return nil, ErrEncryptionDisabled
+	}
+
+	usage := &KeyUsage{Current: seal.crypt.id, Keys: make(map[uint32]uint64)}
+	if err := rekeyRange(pq.db, pq.wo, nil, 0, seal, rotate, usage); err != nil {
+		return usage, err
+	}
+
+	// Leases and transfer records hold the key of the item, and its
+	// value after 26 bytes.
+	for _, prefix := range [][]byte{leasePrefix, transferPrefix} {
+		if err := rekeyRange(pq.db, pq.wo, util.BytesPrefix(prefix), 26, seal, rotate, usage); err != nil {
+			return usage, err
+		}
+	}
+
+	return usage, nil
+}
+
+// KeyUsage returns which keys the items of the stack are encrypted
+// with, the same way as PriorityQueue.KeyUsage.
+func (s *Stack) KeyUsage() (*KeyUsage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return rekeyItems(s.db, s.wo, s.seal, false)
+}
+
+// RotateKey makes the stack encrypt new values with the key of the
+// given ID and re-encrypts the values of its items, the same way as
+// PriorityQueue.RotateKey.
+func (s *Stack) RotateKey(newKeyID uint32) (*KeyUsage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	seal, err := s.seal.withKey(newKeyID)
+	if err != nil {
+		return nil, err
+	}
+	s.seal = seal
+
+	return rekeyItems(s.db, s.wo, seal, true)
+}
+
+// KeyUsage returns which keys the items of the queue are encrypted
+// with, the same way as PriorityQueue.KeyUsage.
+func (q *Queue) KeyUsage() (*KeyUsage, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return rekeyItems(q.db, q.wo, q.seal, false)
+}
+
+// RotateKey makes the queue encrypt new values with the key of the
+// given ID and re-encrypts the values of its items, the same way as
+// PriorityQueue.RotateKey.
+func (q *Queue) RotateKey(newKeyID uint32) (*KeyUsage, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	seal, err := q.seal.withKey(newKeyID)
+	if err != nil {
+		return nil, err
+	}
+	q.seal = seal
+
+	return rekeyItems(q.db, q.wo, seal, true)
+}
+
+// rekeyItems counts the keys the values of the items of a stack or a
+// queue are encrypted with, like PriorityQueue.rekey.
+func rekeyItems(db Store, wo *opt.WriteOptions, seal valueSeal, rotate bool) (*KeyUsage, error) {
+	if seal.crypt == nil {
+		return nil, ErrEncryptionDisabled
+	}
+
+	usage := &KeyUsage{Current: seal.crypt.id, Keys: make(map[uint32]uint64)}
+	err := rekeyRange(db, wo, nil, 0, seal, rotate, usage)
+
+	return usage, err
+}
+
+// rekeyRange counts the keys the values in the given range are
+// encrypted with in usage, skipping reserved keys when the range is
+// nil. The values of records other than items start after offset bytes,
+// preceded by the key of their item. If rotate is set, the values not
+// encrypted with the current key of seal are re-encrypted, in batches
+// of clearBatchSize.
+func rekeyRange(db Store, wo *opt.WriteOptions, slice *util.Range, offset int, seal valueSeal, rotate bool, usage *KeyUsage) error {
+	var start, limit []byte
+	if slice != nil {
+		start, limit = slice.Start, slice.Limit
+	}
+
+	for {
+		// Collect the next batch of values to re-encrypt. The iterator
+		// is released before the batch is written, as some stores can't
+		// write while one is open.
+		iter := db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+		batch := new(leveldb.Batch)
+		n := 0
+		for n < clearBatchSize && iter.Next() {
+			n++
+			key, value := iter.Key(), iter.Value()
+			start = append(append([]byte(nil), key...), 0)
+			if slice == nil && bytes.HasPrefix(key, goquePrefix) {
+				continue
+			}
+
+			// The item key the value is sealed with.
+			itemKey := key
+			if offset > 0 {
+				if len(value) < offset {
+					usage.Failed = append(usage.Failed, append([]byte(nil), key...))
+					continue
+				}
+				itemKey = value[:10]
+			}
+
+			data := value[offset:]
+			id, encrypted := keyIDOf(data)
+			if !rotate || encrypted && id == usage.Current {
+				usage.add(id, encrypted)
+				continue
+			}
+
+			envelope, err := seal.open(itemKey, data)
+			if err != nil {
+				usage.Failed = append(usage.Failed, append([]byte(nil), key...))
+				usage.add(id, encrypted)
+				continue
+			}
+			sealed, err := seal.seal(itemKey, append([]byte(nil), envelope...))
+			if err != nil {
+				iter.Release()
+				return err
+			}
+			batch.Put(key, append(append([]byte(nil), value[:offset]...), sealed...))
+			usage.add(usage.Current, true)
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return nil
+		}
+
+		if batch.Len() > 0 {
+			if err := db.Write(batch, wo); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// keyIDOf returns the ID of the key the value in data is encrypted
+// with, and whether it is encrypted at all.
+func keyIDOf(data []byte) (uint32, bool) {
+	// version + key ID = 1 + 4
+	if len(data) < 5 || data[0] != envelopeEncrypted {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(data[1:5]), true
+}
+
+// withKey returns the seal encrypting new values with the key of the
+// given ID instead, fetching it from the provider of its encryption. If
+// encryption isn't enabled, ErrEncryptionDisabled is returned.
+func (v valueSeal) withKey(id uint32) (valueSeal, error) {
+	if v.crypt == nil {
+		return v, ErrEncryptionDisabled
+	}
+
+	key, err := v.crypt.keys.Key(id)
+	if err != nil {
+		return v, err
+	}
+	if v.crypt, err = encryptWith(v.crypt.keys, id, key); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
@@ -0,0 +1,133 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueRotateKey(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.RotateKey(1); err != ErrEncryptionDisabled {
+		t.Errorf("Expected ErrEncryptionDisabled, got %v", err)
+	}
+
+	// One value in the clear, two with key 1, one of them in flight.
+	if _, err = pq.EnqueueString(1, "value 1"); err != nil {
+		t.Fatal(err)
+	}
+	keys := StaticKeys{Current: 1, Keys: map[uint32][]byte{
+		1: bytes.Repeat([]byte{1}, 32),
+		2: bytes.Repeat([]byte{2}, 32),
+	}}
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 3; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err = pq.DequeueWithToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := pq.KeyUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Current != 1 || usage.Unencrypted != 1 || usage.Keys[1] != 2 || usage.Stale() != 1 {
+		t.Errorf("Expected 1 value in the clear and 2 with key 1, got %+v", usage)
+	}
+
+	if _, err = pq.RotateKey(3); err != ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if usage, err = pq.RotateKey(2); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Current != 2 || usage.Keys[2] != 3 || usage.Stale() != 0 || len(usage.Failed) != 0 {
+		t.Errorf("Expected 3 values with key 2, got %+v", usage)
+	}
+
+	// Key 1 is no longer needed.
+	delete(keys.Keys, 1)
+	keys.Current = 2
+	if err = pq.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	leases, err := pq.Leases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 1 || leases[0].Item.ToString() != "value 2" {
+		t.Errorf("Expected the item in flight to be 'value 2', got %v", leases)
+	}
+	for _, want := range []string{"value 3", "value 1"} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestStackRotateKeyFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	keys := StaticKeys{Current: 1, Keys: map[uint32][]byte{
+		1: bytes.Repeat([]byte{1}, 16),
+		2: bytes.Repeat([]byte{2}, 16),
+	}}
+	if err = s.SetEncryption(keys); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tamper with the value of item 2.
+	data, err := s.db.Get(idToKey(2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err = s.db.Put(idToKey(2), data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := s.RotateKey(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Keys[1] != 1 || usage.Keys[2] != 2 || usage.Stale() != 1 {
+		t.Errorf("Expected 1 value left with key 1, got %+v", usage)
+	}
+	if len(usage.Failed) != 1 || !bytes.Equal(usage.Failed[0], idToKey(2)) {
+		t.Errorf("Expected item 2 to fail, got %v", usage.Failed)
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value 3" {
+		t.Errorf("Expected 'value 3', got '%s'", item.ToString())
+	}
+}
@@ -0,0 +1,210 @@
+package goque
+
+import (
+	"sync"
+	"time"
+)
+
+// ScheduledQueue is a delay queue for work that should run at a
+// specific wall-clock time. Dequeue only returns items that are due,
+// and Start can be used to receive due items on a channel instead.
+type ScheduledQueue struct {
+	*DelayQueue
+	mu      sync.Mutex
+	due     chan *DelayItem
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// OpenScheduledQueue opens a scheduled queue if one exists at the given
+// directory. If one does not already exist, a new scheduled queue is
+// created. Scheduled queues and delay queues are interchangeable.
+func OpenScheduledQueue(dataDir string) (*ScheduledQueue, error) {
+	dq, err := OpenDelayQueue(dataDir)
+
+	sq := &ScheduledQueue{
+		DelayQueue: dq,
+		wake:       make(chan struct{}, 1),
+	}
+
+	return sq, err
+}
+
+// EnqueueAt adds an item with the given value that is due at the given
+// time.
+func (sq *ScheduledQueue) EnqueueAt(value []byte, at time.Time) (*DelayItem, error) {
+	item := &DelayItem{VisibleAt: at, Value: value}
+	if err := sq.DelayQueue.Enqueue(item); err != nil {
+		return nil, err
+	}
+
+	sq.notify()
+	return item, nil
+}
+
+// EnqueueIn adds an item with the given value that is due after the
+// given duration.
+func (sq *ScheduledQueue) EnqueueIn(value []byte, d time.Duration) (*DelayItem, error) {
+	return sq.EnqueueAt(value, time.Now().Add(d))
+}
+
+// Enqueue adds an item to the scheduled queue, due at its VisibleAt
+// time.
+func (sq *ScheduledQueue) Enqueue(item *DelayItem) error {
+	if err := sq.DelayQueue.Enqueue(item); err != nil {
+		return err
+	}
+
+	sq.notify()
+	return nil
+}
+
+// Start starts a background goroutine that dequeues items as they
+// become due and sends them on the returned channel, which has the
+// given buffer size. The channel is closed when the scheduled queue is
+// closed. Calling Start again returns the same channel.
+//
+// Items are removed from the queue before being sent, so items sitting
+// in the channel buffer are lost if the process exits.
+func (sq *ScheduledQueue) Start(buffer int) <-chan *DelayItem {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	if sq.due == nil {
+		sq.due = make(chan *DelayItem, buffer)
+		sq.stop = make(chan struct{})
+		sq.stopped = make(chan struct{})
+		go sq.run()
+	}
+
+	return sq.due
+}
+
+// Close stops the background goroutine, if started, and closes the
+// LevelDB database of the scheduled queue.
+func (sq *ScheduledQueue) Close() error {
+	sq.stopRun()
+	return sq.DelayQueue.Close()
+}
+
+// closeIf closes the delay queue with its closeIf, passing it check, and
+// then stops the background goroutine if it was closed. An item the
+// goroutine was about to send is not put back.
+func (sq *ScheduledQueue) closeIf(check func() error) (bool, error) {
+	closed, err := sq.DelayQueue.closeIf(check)
+	if closed {
+		sq.stopRun()
+	}
+
+	return closed, err
+}
+
+// stopRun stops the background goroutine, if started, and waits for it
+// to return.
+func (sq *ScheduledQueue) stopRun() {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+
+	if sq.stop != nil {
+		select {
+		case <-sq.stop:
+		default:
+			close(sq.stop)
+		}
+		<-sq.stopped
+	}
+}
+
+// Drop closes and deletes the LevelDB database of the scheduled queue,
+// as long as it holds no items, due or not. Otherwise nothing is done
+// and ErrNotEmpty is returned.
+func (sq *ScheduledQueue) Drop() error {
+	return dropIf(sq.DataDir, sq.closeIf, checkEmpty(sq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the scheduled
+// queue, along with any items it still holds.
+func (sq *ScheduledQueue) ForceDrop() error {
+	err := sq.Close()
+	if derr := sq.DelayQueue.ForceDrop(); err == nil {
+		err = derr
+	}
+
+	return err
+}
+
+// notify wakes the background goroutine so it can recheck when the
+// next item is due.
+func (sq *ScheduledQueue) notify() {
+	select {
+	case sq.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dequeues due items and sends them on the due channel until the
+// scheduled queue is closed.
+func (sq *ScheduledQueue) run() {
+	defer close(sq.stopped)
+	defer close(sq.due)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// Dequeue every item that is currently due.
+		for {
+			item, err := sq.DelayQueue.Dequeue()
+			if err != nil {
+				break
+			}
+
+			select {
+			case sq.due <- item:
+			case <-sq.stop:
+				// Put the item back so it is not lost.
+				sq.DelayQueue.Enqueue(item)
+				return
+			}
+		}
+
+		// Wait until the next item is due, or until a new item is
+		// enqueued if the queue is empty.
+		wait := sq.nextWait()
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-timeout:
+		case <-sq.wake:
+		case <-sq.stop:
+			return
+		}
+	}
+}
+
+// nextWait returns how long until the next item is due, which is 0 if
+// it already is, or -1 if the scheduled queue is empty.
+func (sq *ScheduledQueue) nextWait() time.Duration {
+	item, err := sq.DelayQueue.Peek()
+	if err != nil {
+		return -1
+	}
+
+	// The item may have become due since it was last dequeued.
+	if wait := item.VisibleAt.Sub(time.Now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestScheduledQueueOpenDelayQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dq, err := OpenDelayQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dq.ForceDrop()
+
+	if err = dq.Enqueue(NewDelayItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+	dq.Close()
+
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer sq.Close()
+
+	if sq.Length() != 1 {
+		t.Errorf("Expected scheduled queue length of 1, got %d", sq.Length())
+	}
+}
+
+func TestScheduledQueueEnqueueAt(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueAt([]byte("later item"), time.Now().Add(time.Hour)); err != nil {
+		t.Error(err)
+	}
+	if _, err = sq.EnqueueIn([]byte("second item"), -time.Second); err != nil {
+		t.Error(err)
+	}
+	if _, err = sq.EnqueueAt([]byte("first item"), time.Now().Add(-time.Minute)); err != nil {
+		t.Error(err)
+	}
+
+	for _, compStr := range []string{"first item", "second item"} {
+		item, err := sq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = sq.Dequeue(); err != ErrNotVisible {
+		t.Errorf("Expected to get not visible error, got %v", err)
+	}
+}
+
+func TestScheduledQueueStart(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueIn([]byte("second item"), 50*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	if _, err = sq.EnqueueIn([]byte("first item"), 0); err != nil {
+		t.Error(err)
+	}
+
+	due := sq.Start(0)
+	if sq.Start(0) != due {
+		t.Error("Expected Start to return the same channel when called again")
+	}
+
+	for _, compStr := range []string{"first item", "second item", "third item"} {
+		if compStr == "third item" {
+			if _, err = sq.EnqueueIn([]byte(compStr), 10*time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		}
+
+		select {
+		case item := <-due:
+			if item.ToString() != compStr {
+				t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected to receive '%s' on the channel", compStr)
+		}
+	}
+
+	if sq.Length() != 0 {
+		t.Errorf("Expected scheduled queue length of 0, got %d", sq.Length())
+	}
+}
+
+func TestScheduledQueueStartDueNow(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer sq.ForceDrop()
+
+	if wait := sq.nextWait(); wait != -1 {
+		t.Errorf("Expected a wait of -1 for an empty queue, got %v", wait)
+	}
+
+	// An item that is already due is waited for 0, even if it wasn't
+	// due when the queue was last dequeued.
+	if _, err = sq.EnqueueAt([]byte("value"), time.Now()); err != nil {
+		t.Error(err)
+	}
+	if wait := sq.nextWait(); wait != 0 {
+		t.Errorf("Expected a wait of 0 for a due item, got %v", wait)
+	}
+
+	// It is sent without any later enqueue.
+	select {
+	case item := <-sq.Start(0):
+		if item.ToString() != "value" {
+			t.Errorf("Expected string to be 'value', got '%s'", item.ToString())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected to receive the due item on the channel")
+	}
+}
+
+func TestScheduledQueueStartClose(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueIn([]byte("value"), 0); err != nil {
+		t.Error(err)
+	}
+
+	due := sq.Start(0)
+	time.Sleep(20 * time.Millisecond)
+	sq.Close()
+
+	if _, ok := <-due; ok {
+		t.Error("Expected channel to be closed without receiving an item")
+	}
+
+	sq, err = OpenScheduledQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if sq.Length() != 1 {
+		t.Errorf("Expected undelivered item to remain queued, got length %d", sq.Length())
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps the handler of a Server, such as to authenticate
+// requests before they reach it.
+type Middleware func(next http.Handler) http.Handler
+
+// BearerToken returns a Middleware accepting the requests that carry one
+// of the given tokens in an "Authorization: Bearer" header. Any other
+// request gets a 401 Unauthorized response.
+func BearerToken(tokens ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "Bearer ") && validToken(strings.TrimPrefix(auth, "Bearer "), tokens) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goque"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+		})
+	}
+}
+
+// validToken reports whether token is one of the given tokens, in time
+// that doesn't depend on where they differ. An empty token is never
+// valid.
+func validToken(token string, tokens []string) bool {
+	if token == "" {
+		return false
+	}
+
+	ok := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			ok = true
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	s := New(Options{Auth: BearerToken("secret", "other")})
+
+	for _, tc := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Basic c2VjcmV0", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+		{"Bearer other", http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/queues", nil)
+		if tc.auth != "" {
+			r.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, r)
+
+		if rec.Code != tc.want {
+			t.Errorf("Expected status %d for '%s', got %d", tc.want, tc.auth, rec.Code)
+		}
+		if tc.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("Expected a WWW-Authenticate header")
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package server exposes Goque priority queues, queues and stacks over
+// HTTP, so services not written in Go can share them.
+//
+// Every data structure is registered under a name, and served under
+// /queues/{name}:
+//
+//	GET    /queues               List the names of the data structures.
+//	POST   /queues/{name}/items  Enqueue the request body as an item. A
+//	                             priority query parameter sets the priority
+//	                             of the item in a priority queue.
+//	DELETE /queues/{name}/items  Dequeue the next item.
+//	GET    /queues/{name}/items  Peek at the next item.
+//	GET    /queues/{name}/stats  Get the stats of the data structure.
+//
+// Items are returned as JSON objects holding the priority, ID, base64
+// value and metadata of the item. Dequeueing or peeking at an empty data
+// structure returns 204 No Content, and errors are returned as a JSON
+// object with an error field.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+var (
+	// ErrRegistered is returned when registering a data structure
+	// under a name that is already taken.
+	ErrRegistered = errors.New("server: Name is already registered")
+
+	// ErrUnsupportedType is returned when registering a value that is
+	// not a priority queue, queue or stack.
+	ErrUnsupportedType = errors.New("server: Data structure type is not supported")
+)
+
+// The maximum size of an item value, unless set by the options.
+const defaultMaxItemSize = 1 << 20
+
+// Options configures a Server.
+type Options struct {
+	// Auth, if set, wraps every request, such as BearerToken to
+	// require a token.
+	Auth Middleware
+
+	// MaxItemSize is the largest item value accepted, in bytes.
+	// Defaults to 1 MiB.
+	MaxItemSize int64
+}
+
+// Server is an http.Handler serving the registered data structures.
+type Server struct {
+	mu         sync.RWMutex
+	structures map[string]structure
+	opts       Options
+	handler    http.Handler
+}
+
+// New returns a Server without any data structure.
+func New(opts Options) *Server {
+	if opts.MaxItemSize <= 0 {
+		opts.MaxItemSize = defaultMaxItemSize
+	}
+
+	s := &Server{structures: make(map[string]structure), opts: opts}
+	s.handler = http.HandlerFunc(s.serve)
+	if opts.Auth != nil {
+		s.handler = opts.Auth(s.handler)
+	}
+
+	return s
+}
+
+// Register serves the given *goque.PriorityQueue, *goque.Queue or
+// *goque.Stack under name. Any other value returns ErrUnsupportedType.
+// The data structure must be unregistered before it is closed.
+func (s *Server) Register(name string, v interface{}) error {
+	var st structure
+	switch v := v.(type) {
+	case *goque.PriorityQueue:
+		st = &pqueue{v}
+	case *goque.Queue:
+		st = &queue{v}
+	case *goque.Stack:
+		st = &stack{v}
+	default:
+		return ErrUnsupportedType
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.structures[name]; ok {
+		return ErrRegistered
+	}
+	s.structures[name] = st
+
+	return nil
+}
+
+// Unregister stops serving the data structure registered under name.
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.structures, name)
+}
+
+// ServeHTTP serves a request, after the auth middleware if any.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// serve routes a request to its handler.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "queues" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.list(w)
+		return
+	}
+
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	s.mu.RLock()
+	st, ok := s.structures[parts[1]]
+	s.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no queue named "+strconv.Quote(parts[1]))
+		return
+	}
+
+	switch parts[2] {
+	case "items":
+		switch r.Method {
+		case http.MethodPost:
+			s.enqueue(w, r, st)
+		case http.MethodDelete:
+			writeItem(w, http.StatusOK)(st.dequeue())
+		case http.MethodGet:
+			writeItem(w, http.StatusOK)(st.peek())
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+		}
+
+	case "stats":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeStats(w, st)
+
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// list writes the sorted names of the registered data structures.
+func (s *Server) list(w http.ResponseWriter) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.structures))
+	for name := range s.structures {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string][]string{"queues": names})
+}
+
+// enqueue adds the body of the request as an item.
+func (s *Server) enqueue(w http.ResponseWriter, r *http.Request, st structure) {
+	var priority uint8
+	if p := r.URL.Query().Get("priority"); p != "" {
+		n, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid priority "+strconv.Quote(p))
+			return
+		}
+		priority = uint8(n)
+	}
+
+	// Read one byte more than allowed to tell if the value is too big.
+	value, err := ioutil.ReadAll(io.LimitReader(r.Body, s.opts.MaxItemSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if int64(len(value)) > s.opts.MaxItemSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "item is larger than "+strconv.FormatInt(s.opts.MaxItemSize, 10)+" bytes")
+		return
+	}
+
+	writeItem(w, http.StatusCreated)(st.enqueue(value, priority))
+}
+
+// statsRecord holds the stats of a data structure as returned.
+type statsRecord struct {
+	Length      uint64        `json:"length"`
+	Levels      []levelRecord `json:"levels,omitempty"`
+	DiskUsage   int64         `json:"disk_usage"`
+	Enqueued    uint64        `json:"enqueued"`
+	Dequeued    uint64        `json:"dequeued"`
+	HeadAge     float64       `json:"head_age_seconds"`
+	DequeueTime float64       `json:"dequeue_time_seconds"`
+}
+
+// levelRecord holds the number of items in a priority level.
+type levelRecord struct {
+	Priority uint8  `json:"priority"`
+	Length   uint64 `json:"length"`
+}
+
+// writeStats writes the stats of the data structure.
+func writeStats(w http.ResponseWriter, st structure) {
+	stats, err := st.stats()
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	rec := &statsRecord{
+		Length:      stats.Length,
+		DiskUsage:   stats.DiskUsage,
+		Enqueued:    stats.Counters.Enqueued,
+		Dequeued:    stats.Counters.Dequeued,
+		DequeueTime: stats.Counters.DequeueTime.Seconds(),
+	}
+	for _, l := range stats.Levels {
+		rec.Levels = append(rec.Levels, levelRecord{Priority: l.Priority, Length: l.Length})
+	}
+	if !stats.Next.IsZero() {
+		rec.HeadAge = time.Since(stats.Next).Seconds()
+	}
+
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// writeItem returns a function writing the item returned by a call
+// with the given status, or its error.
+func writeItem(w http.ResponseWriter, status int) func(rec *record, err error) {
+	return func(rec *record, err error) {
+		if err == goque.ErrEmpty {
+			w.WriteHeader(http.StatusNoContent)
+		} else if err != nil {
+			writeStatusError(w, err)
+		} else {
+			writeJSON(w, status, rec)
+		}
+	}
+}
+
+// writeStatusError writes a Goque error with a matching status.
+func writeStatusError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case goque.ErrDBClosed:
+		status = http.StatusServiceUnavailable
+	case goque.ErrFull:
+		status = http.StatusTooManyRequests
+	}
+
+	writeError(w, status, err.Error())
+}
+
+// methodNotAllowed writes a 405 error listing the allowed methods.
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// writeError writes an error message with the given status.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeJSON writes v as JSON with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
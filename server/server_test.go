@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// do sends a request to the server, decoding the JSON response into v
+// if set, and returns the status.
+func do(t *testing.T, s *Server, method, target, body string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	if v != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Error(err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestServerPriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	s := New(Options{})
+	if err = s.Register("jobs", pq); err != nil {
+		t.Error(err)
+	}
+	if err = s.Register("jobs", pq); err != ErrRegistered {
+		t.Errorf("Expected to get registered error, got %v", err)
+	}
+
+	var rec record
+	if code := do(t, s, http.MethodPost, "/queues/jobs/items?priority=5", "low", &rec); code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", code)
+	}
+	if rec.Priority == nil || *rec.Priority != 5 || string(rec.Value) != "low" {
+		t.Errorf("Expected item 'low' with priority 5, got %+v", rec)
+	}
+	do(t, s, http.MethodPost, "/queues/jobs/items?priority=1", "high", nil)
+
+	if code := do(t, s, http.MethodGet, "/queues/jobs/items", "", &rec); code != http.StatusOK || string(rec.Value) != "high" {
+		t.Errorf("Expected to peek at 'high', got %d and '%s'", code, rec.Value)
+	}
+
+	var stats statsRecord
+	if code := do(t, s, http.MethodGet, "/queues/jobs/stats", "", &stats); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if stats.Length != 2 || len(stats.Levels) != 2 || stats.Levels[0].Priority != 1 || stats.Enqueued != 2 {
+		t.Errorf("Expected 2 items in 2 levels, got %+v", stats)
+	}
+
+	for _, want := range []string{"high", "low"} {
+		if code := do(t, s, http.MethodDelete, "/queues/jobs/items", "", &rec); code != http.StatusOK || string(rec.Value) != want {
+			t.Errorf("Expected to dequeue '%s', got %d and '%s'", want, code, rec.Value)
+		}
+	}
+	if code := do(t, s, http.MethodDelete, "/queues/jobs/items", "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+}
+
+func TestServerQueueAndStack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	stk, err := goque.OpenStack(file + "_stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stk.ForceDrop()
+
+	s := New(Options{})
+	s.Register("fifo", q)
+	s.Register("lifo", stk)
+	if err = s.Register("other", (*goque.Deque)(nil)); err != ErrUnsupportedType {
+		t.Errorf("Expected to get unsupported type error, got %v", err)
+	}
+
+	var list struct {
+		Queues []string `json:"queues"`
+	}
+	do(t, s, http.MethodGet, "/queues", "", &list)
+	if strings.Join(list.Queues, ",") != "fifo,lifo" {
+		t.Errorf("Expected 'fifo,lifo', got '%s'", strings.Join(list.Queues, ","))
+	}
+
+	for _, name := range []string{"fifo", "lifo"} {
+		for i := 1; i <= 2; i++ {
+			do(t, s, http.MethodPost, "/queues/"+name+"/items", fmt.Sprintf("value for item %d", i), nil)
+		}
+	}
+
+	var rec record
+	do(t, s, http.MethodDelete, "/queues/fifo/items", "", &rec)
+	if string(rec.Value) != "value for item 1" {
+		t.Errorf("Expected 'value for item 1', got '%s'", rec.Value)
+	}
+	do(t, s, http.MethodDelete, "/queues/lifo/items", "", &rec)
+	if string(rec.Value) != "value for item 2" {
+		t.Errorf("Expected 'value for item 2', got '%s'", rec.Value)
+	}
+
+	// A closed data structure is unavailable.
+	q.Close()
+	if code := do(t, s, http.MethodGet, "/queues/fifo/items", "", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", code)
+	}
+
+	s.Unregister("fifo")
+	if code := do(t, s, http.MethodGet, "/queues/fifo/items", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", code)
+	}
+}
+
+func TestServerInvalidRequests(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+
+	s := New(Options{MaxItemSize: 4})
+	s.Register("jobs", q)
+
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodPost, "/queues/jobs/items?priority=256", "", http.StatusBadRequest},
+		{http.MethodPost, "/queues/jobs/items", "too big", http.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/queues/jobs/items", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/queues/jobs/stats", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/queues/jobs/other", "", http.StatusNotFound},
+		{http.MethodGet, "/other", "", http.StatusNotFound},
+		{http.MethodGet, "/queues/jobs/items", "", http.StatusNoContent},
+	} {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if code := do(t, s, tc.method, tc.target, tc.body, &body); code != tc.want {
+			t.Errorf("%s %s: Expected status %d, got %d (%s)", tc.method, tc.target, tc.want, code, body.Error)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// structure is a registered data structure the handlers work on.
+type structure interface {
+	// enqueue adds an item with the given value, using the priority
+	// if the data structure has priorities.
+	enqueue(value []byte, priority uint8) (*record, error)
+
+	dequeue() (*record, error)
+	peek() (*record, error)
+	stats() (*goque.Stats, error)
+}
+
+// record is an item as returned by the handlers. Values are base64
+// encoded.
+type record struct {
+	Priority  *uint8            `json:"priority,omitempty"`
+	ID        uint64            `json:"id"`
+	Value     []byte            `json:"value"`
+	Attempts  uint32            `json:"attempts,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// pqueue is a Goque priority queue.
+type pqueue struct {
+	pq *goque.PriorityQueue
+}
+
+func (st *pqueue) enqueue(value []byte, priority uint8) (*record, error) {
+	return priorityRecord(st.pq.EnqueueValue(priority, value))
+}
+
+func (st *pqueue) dequeue() (*record, error)    { return priorityRecord(st.pq.Dequeue()) }
+func (st *pqueue) peek() (*record, error)       { return priorityRecord(st.pq.Peek()) }
+func (st *pqueue) stats() (*goque.Stats, error) { return st.pq.Stats() }
+
+// queue is a Goque queue.
+type queue struct {
+	q *goque.Queue
+}
+
+func (st *queue) enqueue(value []byte, priority uint8) (*record, error) {
+	return itemRecord(st.q.EnqueueValue(value))
+}
+
+func (st *queue) dequeue() (*record, error)    { return itemRecord(st.q.Dequeue()) }
+func (st *queue) peek() (*record, error)       { return itemRecord(st.q.Peek()) }
+func (st *queue) stats() (*goque.Stats, error) { return st.q.Stats() }
+
+// stack is a Goque stack.
+type stack struct {
+	s *goque.Stack
+}
+
+func (st *stack) enqueue(value []byte, priority uint8) (*record, error) {
+	item := goque.NewItem(value)
+	return itemRecord(item, st.s.Push(item))
+}
+
+func (st *stack) dequeue() (*record, error)    { return itemRecord(st.s.Pop()) }
+func (st *stack) peek() (*record, error)       { return itemRecord(st.s.Peek()) }
+func (st *stack) stats() (*goque.Stats, error) { return st.s.Stats() }
+
+// priorityRecord returns the record of a priority queue item, passing
+// on the error of the call returning it.
+func priorityRecord(item *goque.PriorityItem, err error) (*record, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &record{
+		Priority:  &item.Priority,
+		ID:        item.ID,
+		Value:     item.Value,
+		Attempts:  item.Attempts,
+		Headers:   item.Headers,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}, nil
+}
+
+// itemRecord returns the record of a queue or stack item, passing on
+// the error of the call returning it.
+func itemRecord(item *goque.Item, err error) (*record, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &record{
+		ID:        item.ID,
+		Value:     item.Value,
+		Headers:   item.Headers,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}, nil
+}
@@ -0,0 +1,216 @@
+package goque
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// ShardedQueue is a FIFO queue partitioned across several queues, each
+// with its own LevelDB database and lock, so enqueues on different
+// shards run in parallel. Items are added to the shards in turn, or to
+// the shard picked by the hash of a key, which keeps the items of a key
+// in order.
+//
+// Dequeue takes the oldest of the items at the front of the shards, so
+// items come out in about the order they were added, but not exactly:
+// concurrent dequeues may each take another shard's item first. Item IDs
+// are only unique within a shard.
+type ShardedQueue struct {
+	DataDir string
+	shards  []*Queue
+	next    uint64
+}
+
+// OpenShardedQueue opens a sharded queue with the given number of shards
+// if one exists at the given directory. If one does not already exist, a
+// new sharded queue is created. Each shard is a queue of its own, in a
+// subdirectory of the data directory. Since items are assigned to shards
+// by their number, a sharded queue must always be opened with the same
+// number of shards, or ErrShardCount is returned.
+func OpenShardedQueue(dataDir string, shards int) (*ShardedQueue, error) {
+	sq := &ShardedQueue{DataDir: dataDir}
+	if shards < 1 {
+		return sq, ErrShardCount
+	}
+
+	// Create the data directory and check if this Goque type can open it.
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return sq, err
+	}
+	ok, err := checkGoqueType(dataDir, goqueShardedQueue)
+	if err != nil {
+		return sq, err
+	}
+	if !ok {
+		return sq, ErrIncompatibleType
+	}
+
+	// Make sure the number of shards matches the existing ones, if any.
+	existing, err := filepath.Glob(filepath.Join(dataDir, "shard-*"))
+	if err != nil {
+		return sq, err
+	}
+	if len(existing) > 0 && len(existing) != shards {
+		return sq, ErrShardCount
+	}
+
+	// Open each shard, closing the ones already open on failure.
+	for i := 0; i < shards; i++ {
+		q, err := OpenQueue(sq.shardDir(i))
+		if err != nil {
+			sq.Close()
+			return sq, err
+		}
+		sq.shards = append(sq.shards, q)
+	}
+
+	return sq, nil
+}
+
+// Enqueue adds an item to the next shard in turn.
+func (sq *ShardedQueue) Enqueue(item *Item) error {
+	n := atomic.AddUint64(&sq.next, 1)
+	return sq.shards[n%uint64(len(sq.shards))].Enqueue(item)
+}
+
+// EnqueueString is a helper function for Enqueue that creates an item
+// with the given value as a string, and returns it.
+func (sq *ShardedQueue) EnqueueString(value string) (*Item, error) {
+	item := NewItemString(value)
+	if err := sq.Enqueue(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// EnqueueByKey adds an item to the shard picked by the hash of the given
+// key. Items enqueued with the same key are dequeued in the order they
+// were added.
+func (sq *ShardedQueue) EnqueueByKey(key []byte, item *Item) error {
+	return sq.shards[sq.ShardOf(key)].Enqueue(item)
+}
+
+// ShardOf returns the index of the shard EnqueueByKey adds the items of
+// the given key to.
+func (sq *ShardedQueue) ShardOf(key []byte) int {
+	return int(crc32.ChecksumIEEE(key) % uint32(len(sq.shards)))
+}
+
+// Dequeue removes the oldest of the items at the front of the shards and
+// returns it.
+func (sq *ShardedQueue) Dequeue() (*Item, error) {
+	for {
+		shard, err := sq.oldestShard()
+		if err != nil {
+			return nil, err
+		}
+
+		// Another dequeue may have emptied the shard in the meantime, so
+		// look again.
+		item, err := sq.shards[shard].Dequeue()
+		if err != ErrEmpty {
+			return item, err
+		}
+	}
+}
+
+// Peek returns the item Dequeue would return, without removing it.
+func (sq *ShardedQueue) Peek() (*Item, error) {
+	shard, err := sq.oldestShard()
+	if err != nil {
+		return nil, err
+	}
+
+	return sq.shards[shard].Peek()
+}
+
+// Shard returns the queue of the shard with the given index, such as to
+// look up an item by its ID.
+func (sq *ShardedQueue) Shard(i int) *Queue {
+	return sq.shards[i]
+}
+
+// Shards returns the number of shards of the sharded queue.
+func (sq *ShardedQueue) Shards() int {
+	return len(sq.shards)
+}
+
+// Length returns the total number of items in the sharded queue.
+func (sq *ShardedQueue) Length() uint64 {
+	var length uint64
+	for _, q := range sq.shards {
+		length += q.Length()
+	}
+
+	return length
+}
+
+// Close closes the LevelDB databases of every shard, returning the
+// first error.
+func (sq *ShardedQueue) Close() error {
+	var err error
+	for _, q := range sq.shards {
+		if cerr := q.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Drop closes and deletes the LevelDB databases of the sharded queue, as
+// long as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned. The shards are checked one at a time, so unlike the other
+// data structures, an item added while Drop runs may be deleted with
+// them.
+func (sq *ShardedQueue) Drop() error {
+	if sq.Length() > 0 {
+		return ErrNotEmpty
+	}
+
+	return sq.ForceDrop()
+}
+
+// ForceDrop closes and deletes the LevelDB databases of the sharded
+// queue, along with any items they still hold.
+func (sq *ShardedQueue) ForceDrop() error {
+	err := sq.Close()
+	if rerr := os.RemoveAll(sq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// oldestShard returns the index of the shard whose front item was added
+// first, or ErrEmpty if every shard is empty.
+func (sq *ShardedQueue) oldestShard() (int, error) {
+	oldest := -1
+	var front *Item
+	for i, q := range sq.shards {
+		item, err := q.Peek()
+		if err == ErrEmpty {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		if front == nil || item.CreatedAt.Before(front.CreatedAt) {
+			oldest, front = i, item
+		}
+	}
+	if oldest < 0 {
+		return 0, ErrEmpty
+	}
+
+	return oldest, nil
+}
+
+// shardDir returns the data directory of the shard with the given index.
+func (sq *ShardedQueue) shardDir(i int) string {
+	return filepath.Join(sq.DataDir, fmt.Sprintf("shard-%03d", i))
+}
@@ -0,0 +1,180 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedQueueOrder(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenShardedQueue(file, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = sq.EnqueueString(fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", sq.Length())
+	}
+	for i := 0; i < sq.Shards(); i++ {
+		if n := sq.Shard(i).Length(); n < 2 || n > 3 {
+			t.Errorf("Expected shard %d to hold 2 or 3 items, got %d", i, n)
+		}
+	}
+
+	// Dequeued one at a time, the items come out in the order they were
+	// added.
+	item, err := sq.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value1" {
+		t.Errorf("Expected 'value1', got '%s'", item.ToString())
+	}
+	for i := 1; i <= 10; i++ {
+		item, err := sq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("value%d", i); item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = sq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestShardedQueueByKey(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenShardedQueue(file, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	key := []byte("user-42")
+	for i := 0; i < 3; i++ {
+		if err = sq.EnqueueByKey(key, NewItemString(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every item of the key is on the same shard, in order.
+	shard := sq.Shard(sq.ShardOf(key))
+	if shard.Length() != 3 {
+		t.Fatalf("Expected the shard of the key to hold 3 items, got %d", shard.Length())
+	}
+	for i := 0; i < 3; i++ {
+		item, err := shard.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("value%d", i); item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+}
+
+func TestShardedQueueConcurrent(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenShardedQueue(file, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := sq.EnqueueString(fmt.Sprintf("%d-%d", w, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Concurrent consumers take every item exactly once.
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, err := sq.Dequeue()
+				if err == ErrEmpty {
+					return
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				if seen[item.ToString()] {
+					t.Errorf("Expected '%s' to be dequeued once", item.ToString())
+				}
+				seen[item.ToString()] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 200 {
+		t.Errorf("Expected 200 items dequeued, got %d", len(seen))
+	}
+}
+
+func TestShardedQueueReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenShardedQueue(file, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueString("value"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sq.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = OpenShardedQueue(file, 3); err != ErrShardCount {
+		t.Errorf("Expected ErrShardCount, got %v", err)
+	}
+	if sq, err = OpenShardedQueue(file, 2); err != nil {
+		t.Fatal(err)
+	}
+	if sq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", sq.Length())
+	}
+	if typ, err := DataDirType(file); err != nil || typ != "sharded queue" {
+		t.Errorf("Expected type 'sharded queue', got '%s' and %v", typ, err)
+	}
+	if err = sq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+
+	q, err := OpenQueue(fmt.Sprintf("test_db_%d", time.Now().UnixNano()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+	if _, err = OpenShardedQueue(q.DataDir, 2); err != ErrIncompatibleType {
+		t.Errorf("Expected ErrIncompatibleType, got %v", err)
+	}
+}
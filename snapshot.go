@@ -0,0 +1,179 @@
+package goque
+
+import (
+	"io"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// PriorityQueueSnapshot is a read-only view of a priority queue, frozen
+// at the time it was taken. Items added or removed later do not affect
+// it, so it can be read while producers and consumers keep using the
+// priority queue. Items that were in flight are not included.
+//
+// The snapshot must be released once it is no longer needed, and
+// before the priority queue is closed. Once released, every operation
+// on the snapshot returns ErrDBClosed.
+type PriorityQueueSnapshot struct {
+	mu   sync.Mutex
+	pq   *PriorityQueue
+	snap StoreSnapshot
+}
+
+// Snapshot returns a read-only view of the priority queue as it is now.
+// If the store of the priority queue can't take snapshots,
+// ErrSnapshotUnsupported is returned.
+func (pq *PriorityQueue) Snapshot() (*PriorityQueueSnapshot, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	snap, err := takeSnapshot(pq.db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the priority queue, reading from the snapshot instead of
+	// the store.
+	view := &PriorityQueue{
+		DataDir:  pq.DataDir,
+		db:       snapshotStore{snap},
+		order:    pq.order,
+		active:   pq.active,
+		curLevel: pq.curLevel,
+		fair:     pq.fair.clone(),
+		format:   pq.format,
+		seal:     pq.seal,
+		isOpen:   true,
+	}
+	for i, level := range pq.levels {
+		l := *level
+		view.levels[i] = &l
+	}
+
+	return &PriorityQueueSnapshot{pq: view, snap: snap}, nil
+}
+
+// Peek returns the next item in the snapshot.
+func (s *PriorityQueueSnapshot) Peek() (*PriorityItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pq.Peek()
+}
+
+// PeekLast returns the item of the snapshot that would be dequeued
+// last.
+func (s *PriorityQueueSnapshot) PeekLast() (*PriorityItem, error) {
+	return s.pq.PeekLast()
+}
+
+// PeekByOffset returns the item located at the given offset, starting
+// from the head of the snapshot.
+func (s *PriorityQueueSnapshot) PeekByOffset(offset uint64) (*PriorityItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pq.PeekByOffset(offset)
+}
+
+// PeekByPriorityID returns the item with the given ID and priority in
+// the snapshot.
+func (s *PriorityQueueSnapshot) PeekByPriorityID(priority uint8, id uint64) (*PriorityItem, error) {
+	return s.pq.PeekByPriorityID(priority, id)
+}
+
+// ActiveLevels returns the priority levels that have items in the
+// snapshot, in the order they would be dequeued.
+func (s *PriorityQueueSnapshot) ActiveLevels() []uint8 {
+	return s.pq.ActiveLevels()
+}
+
+// Levels returns the number of items in each priority level that has
+// items in the snapshot, in the order they would be dequeued.
+func (s *PriorityQueueSnapshot) Levels() []LevelLength {
+	return s.pq.Levels()
+}
+
+// LengthByPriority returns the number of items in the given priority
+// level of the snapshot.
+func (s *PriorityQueueSnapshot) LengthByPriority(priority uint8) uint64 {
+	return s.pq.LengthByPriority(priority)
+}
+
+// Length returns the total number of items in the snapshot.
+func (s *PriorityQueueSnapshot) Length() uint64 {
+	return s.pq.Length()
+}
+
+// Iterator returns an iterator over the items of the snapshot. It must
+// be released before the snapshot is.
+func (s *PriorityQueueSnapshot) Iterator() (*PriorityQueueIterator, error) {
+	return s.pq.Iterator()
+}
+
+// ForEach calls fn for every item of the snapshot in dequeue order,
+// until fn returns false.
+func (s *PriorityQueueSnapshot) ForEach(fn func(item *PriorityItem) bool) error {
+	return s.pq.ForEach(fn)
+}
+
+// Backup writes a backup of the snapshot to w, the same way as
+// PriorityQueue.Backup, so it holds the priority queue as it was when
+// the snapshot was taken. The snapshot must not be released before
+// Backup returns.
+func (s *PriorityQueueSnapshot) Backup(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// If the snapshot is released.
+	if !s.pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return writeBackup(w, goquePriorityQueue, s.pq.format, s.snap)
+}
+
+// Release releases the snapshot.
+func (s *PriorityQueueSnapshot) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pq.Lock()
+	defer s.pq.Unlock()
+
+	// If the snapshot is already released.
+	if !s.pq.isOpen {
+		return
+	}
+	s.pq.isOpen = false
+
+	s.snap.Release()
+}
+
+// snapshotStore is a read-only Store reading from a snapshot.
+type snapshotStore struct {
+	StoreSnapshot
+}
+
+func (snapshotStore) Put(key, value []byte, wo *opt.WriteOptions) error {
+	return leveldb.ErrReadOnly
+}
+
+func (snapshotStore) Delete(key []byte, wo *opt.WriteOptions) error {
+	return leveldb.ErrReadOnly
+}
+
+func (snapshotStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	return leveldb.ErrReadOnly
+}
+
+func (snapshotStore) Close() error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueSnapshot(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for p := 0; p <= 2; p++ {
+		for i := 1; i <= 3; i++ {
+			if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(p))); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	snap, err := pq.Snapshot()
+	if err != nil {
+		t.Error(err)
+	}
+	defer snap.Release()
+
+	// Changes made after the snapshot was taken are not seen.
+	for i := 0; i < 4; i++ {
+		if _, err = pq.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = pq.Enqueue(NewPriorityItemString("later item", 0)); err != nil {
+		t.Error(err)
+	}
+	head, err := pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if err = pq.Update(head, []byte("updated item")); err != nil {
+		t.Error(err)
+	}
+
+	if snap.Length() != 9 {
+		t.Errorf("Expected snapshot length of 9, got %d", snap.Length())
+	}
+
+	item, err := snap.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.Priority != 0 || item.ToString() != "value for item 1" {
+		t.Errorf("Expected priority 0 and 'value for item 1', got %d and '%s'", item.Priority, item.ToString())
+	}
+
+	item, err = snap.PeekByOffset(4)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.Priority != 1 || item.ToString() != "value for item 2" {
+		t.Errorf("Expected priority 1 and 'value for item 2', got %d and '%s'", item.Priority, item.ToString())
+	}
+
+	item, err = snap.PeekByPriorityID(1, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 2" {
+		t.Errorf("Expected string to be 'value for item 2', got '%s'", item.ToString())
+	}
+
+	var got []string
+	err = snap.ForEach(func(item *PriorityItem) bool {
+		got = append(got, fmt.Sprintf("%d %s", item.Priority, item.ToString()))
+		return true
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	var want []string
+	for p := 0; p <= 2; p++ {
+		for i := 1; i <= 3; i++ {
+			want = append(want, fmt.Sprintf("%d value for item %d", p, i))
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected items %v, got %v", want, got)
+	}
+
+	// The priority queue itself moved on.
+	if pq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", pq.Length())
+	}
+}
+
+func TestPriorityQueueSnapshotReleased(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("value", 0)); err != nil {
+		t.Error(err)
+	}
+
+	snap, err := pq.Snapshot()
+	if err != nil {
+		t.Error(err)
+	}
+	snap.Release()
+	snap.Release()
+
+	if _, err = snap.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+	if _, err = snap.Iterator(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriorityQueueSnapshotBackup(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	snap, err := pq.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items added after the snapshot are not part of the backup.
+	if _, err = pq.EnqueueString(0, "value for item 3"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = snap.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snap.Release()
+
+	if err = snap.Backup(new(bytes.Buffer)); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := OpenPriorityQueue(file+"_restore", ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.ForceDrop()
+
+	if restored.Length() != 2 {
+		t.Errorf("Expected restored queue length of 2, got %d", restored.Length())
+	}
+}
+
+func TestPriorityQueueSnapshotUnsupported(t *testing.T) {
+	pq, err := OpenPriorityQueueMem(ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Close()
+
+	// Hide the snapshots of the LevelDB database.
+	pq.db = struct{ Store }{pq.db}
+
+	if _, err = pq.Snapshot(); err != ErrSnapshotUnsupported {
+		t.Errorf("Expected to get snapshot unsupported error, got %v", err)
+	}
+}
+
+func TestPriorityQueueSnapshotClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	pq.Close()
+
+	if _, err = pq.Snapshot(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
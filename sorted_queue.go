@@ -0,0 +1,402 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// sortedMetaKey is the key used to persist the metadata of a sorted
+// queue. Item keys start with sortedItemPrefix, so they never collide
+// with it.
+var sortedMetaKey = []byte{0xFF}
+
+// sortedItemPrefix is the key prefix of the items of a sorted queue.
+var sortedItemPrefix = []byte{0x00}
+
+// sortKeyEnd terminates the escaped sort key of an item key. Zero bytes
+// within a sort key are escaped as 0x00 0xFF, so sort keys that are a
+// prefix of another still sort first once the ID is appended.
+var sortKeyEnd = []byte{0x00, 0x01}
+
+// SortedItem represents an entry in a sorted queue.
+type SortedItem struct {
+	ID      uint64
+	SortKey []byte
+	Key     []byte
+	Value   []byte
+}
+
+// ToString returns the sorted item value as a string.
+func (si *SortedItem) ToString() string {
+	return string(si.Value)
+}
+
+// SortedQueue is a queue where every item has a sort key given by the
+// caller, and items are kept in the byte order of their sort keys. Items
+// with the same sort key keep the order they were added. It generalizes
+// the priority queue to priorities of any length, such as a big-endian
+// timestamp followed by a tenant ID.
+type SortedQueue struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	lastID  uint64
+	length  uint64
+	isOpen  bool
+}
+
+// OpenSortedQueue opens a sorted queue if one exists at the given
+// directory. If one does not already exist, a new sorted queue is
+// created.
+func OpenSortedQueue(dataDir string) (*SortedQueue, error) {
+	var err error
+
+	// Create a new SortedQueue.
+	sq := &SortedQueue{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		isOpen:  false,
+	}
+
+	// Open database for the sorted queue.
+	sq.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return sq, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goqueSortedQueue)
+	if err != nil {
+		return sq, err
+	}
+	if !ok {
+		return sq, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, sq.db, goqueSortedQueue); err != nil {
+		return sq, err
+	}
+
+	// Set isOpen and return.
+	sq.isOpen = true
+	return sq, sq.init()
+}
+
+// Enqueue adds an item with the given sort key and value to the sorted
+// queue.
+func (sq *SortedQueue) Enqueue(sortKey, value []byte) (*SortedItem, error) {
+	sq.Lock()
+	defer sq.Unlock()
+
+	// If the sorted queue is closed.
+	if !sq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	item := &SortedItem{ID: sq.lastID + 1, SortKey: sortKey, Value: value}
+	item.Key = generateSortedKey(sortKey, item.ID)
+
+	// Add it to the sorted queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, item.Value)
+	sq.putMeta(batch, item.ID, sq.length+1)
+	if err := sq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	sq.lastID++
+	sq.length++
+
+	return item, nil
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a sort key
+// and value as strings rather than byte slices.
+func (sq *SortedQueue) EnqueueString(sortKey, value string) (*SortedItem, error) {
+	return sq.Enqueue([]byte(sortKey), []byte(value))
+}
+
+// Dequeue removes the item with the smallest sort key and returns it.
+func (sq *SortedQueue) Dequeue() (*SortedItem, error) {
+	return sq.dequeue(false)
+}
+
+// DequeueMax removes the item with the largest sort key and returns it.
+// Of the items with that sort key, the one added first is returned.
+func (sq *SortedQueue) DequeueMax() (*SortedItem, error) {
+	return sq.dequeue(true)
+}
+
+// Peek returns the item with the smallest sort key without removing it.
+func (sq *SortedQueue) Peek() (*SortedItem, error) {
+	return sq.peek(false)
+}
+
+// PeekMax returns the item with the largest sort key without removing
+// it.
+func (sq *SortedQueue) PeekMax() (*SortedItem, error) {
+	return sq.peek(true)
+}
+
+// Range calls fn with the items whose sort key is at least start and
+// below limit, in order, until fn returns false. A nil limit means no
+// limit. The sorted queue is locked for reading meanwhile, so fn must
+// not use it.
+func (sq *SortedQueue) Range(start, limit []byte, fn func(item *SortedItem) bool) error {
+	sq.RLock()
+	defer sq.RUnlock()
+
+	// If the sorted queue is closed.
+	if !sq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Keys of a sort key start with its escaped form, so bounds without
+	// the terminator include start and exclude limit.
+	r := &util.Range{Start: sortedKeyPrefix(start)}
+	if limit != nil {
+		r.Limit = sortedKeyPrefix(limit)
+	} else {
+		r.Limit = []byte{sortedItemPrefix[0] + 1}
+	}
+
+	// Create a new LevelDB Iterator over the range.
+	iter := sq.db.NewIterator(r, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		item, err := decodeSortedItem(iter.Key(), iter.Value())
+		if err != nil {
+			return err
+		}
+		if !fn(item) {
+			break
+		}
+	}
+
+	return iter.Error()
+}
+
+// Length returns the total number of items in the sorted queue.
+func (sq *SortedQueue) Length() uint64 {
+	return sq.length
+}
+
+// Close closes the LevelDB database of the sorted queue. Once closed,
+// every operation on the sorted queue returns ErrDBClosed.
+func (sq *SortedQueue) Close() error {
+	_, err := sq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the sorted queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the sorted queue in
+// between. If check fails, the sorted queue is left as it is and the error is
+// returned. closeIf reports whether the sorted queue is closed.
+func (sq *SortedQueue) closeIf(check func() error) (bool, error) {
+	sq.Lock()
+	defer sq.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If sorted queue is already closed.
+	if !sq.isOpen {
+		return true, nil
+	}
+	sq.isOpen = false
+
+	return true, sq.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the sorted queue, as
+// long as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (sq *SortedQueue) Drop() error {
+	return dropIf(sq.DataDir, sq.closeIf, checkEmpty(sq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the sorted queue,
+// along with any items it still holds.
+func (sq *SortedQueue) ForceDrop() error {
+	err := sq.Close()
+	if rerr := os.RemoveAll(sq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// dequeue removes the item at the given end of the sorted queue and
+// returns it.
+func (sq *SortedQueue) dequeue(max bool) (*SortedItem, error) {
+	sq.Lock()
+	defer sq.Unlock()
+
+	// If the sorted queue is closed.
+	if !sq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the item at this end of the sorted queue.
+	item, err := sq.getEndItem(max)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the sorted queue, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	sq.putMeta(batch, sq.lastID, sq.length-1)
+	if err = sq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	sq.length--
+
+	return item, nil
+}
+
+// peek returns the item at the given end of the sorted queue without
+// removing it.
+func (sq *SortedQueue) peek(max bool) (*SortedItem, error) {
+	sq.RLock()
+	defer sq.RUnlock()
+
+	// If the sorted queue is closed.
+	if !sq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return sq.getEndItem(max)
+}
+
+// getEndItem returns the first item with the smallest sort key, or with
+// the largest one if max is set. For the largest, the last key gives the
+// sort key, and a second seek finds the first item added with it.
+func (sq *SortedQueue) getEndItem(max bool) (*SortedItem, error) {
+	if sq.length == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Create a new LevelDB Iterator over the items.
+	iter := sq.db.NewIterator(util.BytesPrefix(sortedItemPrefix), nil)
+	defer iter.Release()
+
+	ok := iter.First()
+	if ok && max {
+		iter.Last()
+		item, err := decodeSortedItem(iter.Key(), nil)
+		if err != nil {
+			return nil, err
+		}
+		ok = iter.Seek(sortedKeyPrefix(item.SortKey))
+	}
+	if !ok {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmpty
+	}
+
+	return decodeSortedItem(iter.Key(), iter.Value())
+}
+
+// putMeta adds the last assigned ID and the length of the sorted queue
+// to the batch.
+func (sq *SortedQueue) putMeta(batch *leveldb.Batch, lastID, length uint64) {
+	// lastID + length = 8 + 8
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[0:8], lastID)
+	binary.BigEndian.PutUint64(data[8:16], length)
+	batch.Put(sortedMetaKey, data)
+}
+
+// init initializes the sorted queue data.
+func (sq *SortedQueue) init() error {
+	data, err := sq.db.Get(sortedMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 16 {
+		return ErrInvalidRecord
+	}
+	sq.lastID = binary.BigEndian.Uint64(data[0:8])
+	sq.length = binary.BigEndian.Uint64(data[8:16])
+
+	return nil
+}
+
+// escapeSortKey escapes the zero bytes of the given sort key.
+func escapeSortKey(sortKey []byte) []byte {
+	escaped := make([]byte, 0, len(sortKey)+2)
+	for _, b := range sortKey {
+		escaped = append(escaped, b)
+		if b == 0x00 {
+			escaped = append(escaped, 0xFF)
+		}
+	}
+
+	return escaped
+}
+
+// sortedKeyPrefix returns the start of the keys of the items with the
+// given sort key, which also sorts after the keys of every smaller sort
+// key.
+func sortedKeyPrefix(sortKey []byte) []byte {
+	return append(append([]byte{}, sortedItemPrefix...), escapeSortKey(sortKey)...)
+}
+
+// generateSortedKey creates a key ordered by the given sort key, then by
+// the ID, so items of the same sort key keep the order they were added.
+func generateSortedKey(sortKey []byte, id uint64) []byte {
+	// prefix + escaped sort key + end + id = 1 + n + 2 + 8
+	key := append(sortedKeyPrefix(sortKey), sortKeyEnd...)
+	return append(key, idToKey(id)...)
+}
+
+// decodeSortedItem creates an item from the key and value of a LevelDB
+// iterator, copying them as the iterator reuses its buffers.
+func decodeSortedItem(key, value []byte) (*SortedItem, error) {
+	// The sort key ends at the first zero byte not escaping another.
+	escaped := key[1:]
+	sortKey := make([]byte, 0, len(escaped))
+	for {
+		i := bytes.IndexByte(escaped, 0x00)
+		if i < 0 || i+1 >= len(escaped) {
+			return nil, ErrInvalidRecord
+		}
+
+		sortKey = append(sortKey, escaped[:i]...)
+		if escaped[i+1] == sortKeyEnd[1] {
+			escaped = escaped[i+2:]
+			break
+		}
+		sortKey = append(sortKey, 0x00)
+		escaped = escaped[i+2:]
+	}
+	if len(escaped) != 8 {
+		return nil, ErrInvalidRecord
+	}
+
+	item := &SortedItem{
+		ID:      keyToID(escaped),
+		SortKey: sortKey,
+		Key:     append([]byte(nil), key...),
+		Value:   append([]byte(nil), value...),
+	}
+
+	return item, nil
+}
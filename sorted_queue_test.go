@@ -0,0 +1,167 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSortedQueueOrder(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenSortedQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	// Sort keys that are a prefix of another, hold zero bytes, are empty
+	// or repeated.
+	keys := []string{"b", "ab", "a", "a\x00", "", "b", "a\x00\x00", "a\x01"}
+	for i, key := range keys {
+		if _, err = sq.EnqueueString(key, fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sq.Length() != 8 {
+		t.Errorf("Expected queue length of 8, got %d", sq.Length())
+	}
+
+	// The largest sort key goes first from the top, keeping the order of
+	// ties.
+	item, err := sq.PeekMax()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value0" || string(item.SortKey) != "b" {
+		t.Errorf("Expected 'value0' with sort key 'b', got '%s' with '%s'", item.ToString(), item.SortKey)
+	}
+	if item, err = sq.DequeueMax(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value0" {
+		t.Errorf("Expected 'value0', got '%s'", item.ToString())
+	}
+
+	for _, want := range []string{"value4", "value2", "value3", "value6", "value7", "value1", "value5"} {
+		item, err := sq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ToString() != want {
+			t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+		}
+	}
+	if _, err = sq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+	if _, err = sq.PeekMax(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+}
+
+func TestSortedQueueRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenSortedQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	for _, key := range []string{"c", "a", "bb", "b", "b\x00", "d"} {
+		if _, err = sq.EnqueueString(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect := func(start, limit []byte, max int) []string {
+		var got []string
+		err := sq.Range(start, limit, func(item *SortedItem) bool {
+			got = append(got, string(item.SortKey))
+			return len(got) < max
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// The start is included and the limit excluded.
+	if got := fmt.Sprintf("%q", collect([]byte("b"), []byte("c"), 10)); got != `["b" "b\x00" "bb"]` {
+		t.Errorf("Expected the items from 'b' below 'c', got %s", got)
+	}
+	if got := fmt.Sprintf("%q", collect([]byte("bb"), nil, 10)); got != `["bb" "c" "d"]` {
+		t.Errorf("Expected the items from 'bb' on, got %s", got)
+	}
+	if got := fmt.Sprintf("%q", collect(nil, nil, 2)); got != `["a" "b"]` {
+		t.Errorf("Expected iteration to stop after two items, got %s", got)
+	}
+	if sq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", sq.Length())
+	}
+
+	// The items are kept, in order, after reopening.
+	if err = sq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = sq.Range(nil, nil, func(*SortedItem) bool { return true }); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed, got %v", err)
+	}
+	if sq, err = OpenSortedQueue(file); err != nil {
+		t.Fatal(err)
+	}
+	item, err := sq.EnqueueString("a", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 7 {
+		t.Errorf("Expected ID 7, got %d", item.ID)
+	}
+	if item, err = sq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 2 {
+		t.Errorf("Expected the first item with sort key 'a', got ID %d", item.ID)
+	}
+	if err = sq.Drop(); err != ErrNotEmpty {
+		t.Errorf("Expected ErrNotEmpty, got %v", err)
+	}
+}
+
+func TestSortedQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	sq, err := OpenSortedQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.ForceDrop()
+
+	if _, err = sq.EnqueueString("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = sq.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "sorted queue" {
+		t.Errorf("Expected type 'sorted queue', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenSortedQueue(file + "_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value" || string(item.SortKey) != "key" {
+		t.Errorf("Expected 'value' with sort key 'key', got '%s' with '%s'", item.ToString(), item.SortKey)
+	}
+}
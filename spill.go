@@ -0,0 +1,450 @@
+package goque
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The tags starting the values stored by a SpillStore.
+const (
+	spillInline byte = 0 // The value follows.
+	spillBlob   byte = 1 // The name of the blob holding the value follows.
+)
+
+// BlobStore holds the values spilled over by a SpillStore, each under a
+// name of its own. Its methods may be called concurrently.
+type BlobStore interface {
+	// Put stores the given data under the given name. It must not
+	// return before the data is durable.
+	Put(name string, data []byte) error
+
+	// Get returns the data stored under the given name.
+	Get(name string) ([]byte, error)
+
+	// Delete deletes the data stored under the given name, if any.
+	Delete(name string) error
+
+	// Names returns the names of all the data stored.
+	Names() ([]string, error)
+}
+
+// DirBlobStore is a BlobStore keeping each blob in a file of its
+// directory.
+type DirBlobStore struct {
+	dir string
+}
+
+// The DirBlobStore is a BlobStore.
+var _ BlobStore = (*DirBlobStore)(nil)
+
+// NewDirBlobStore returns the DirBlobStore keeping its blobs in the
+// given directory, which is created if it doesn't exist.
+func NewDirBlobStore(dir string) (*DirBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DirBlobStore{dir: dir}, nil
+}
+
+// Put writes the given data to the file of the given name, through a
+// temporary file synced before it is renamed.
+func (d *DirBlobStore) Put(name string, data []byte) error {
+	path := filepath.Join(d.dir, name)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Get reads the file of the given name.
+func (d *DirBlobStore) Get(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(d.dir, name))
+}
+
+// Delete removes the file of the given name, if it exists.
+func (d *DirBlobStore) Delete(name string) error {
+	if err := os.Remove(filepath.Join(d.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Names returns the names of the files of the directory, including the
+// temporary files left by a crash, so they get collected as well.
+func (d *DirBlobStore) Names() ([]string, error) {
+	infos, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// SpillStore is a Store moving the values larger than its threshold out
+// of the store it wraps and into a BlobStore, keeping only the name of
+// their blob in the wrapped store. LevelDB is a poor home for values of
+// many megabytes, which it copies as it compacts.
+//
+// The blob of a value is written before the value is, and deleted once
+// its key is deleted or overwritten, so a dequeued item doesn't leave
+// its blob behind. Moving an item to another key, such as into a lease
+// or the change log, writes a copy of its blob. A crash in the middle of
+// a write can leave a blob no value refers to, which Collect deletes.
+//
+// Every value is stored along with a tag telling whether it was spilled,
+// so the wrapped store must always be opened through a SpillStore.
+// Deleting or overwriting a key reads its value first, to find its blob.
+type SpillStore struct {
+	store     Store
+	blobs     BlobStore
+	threshold int
+
+	// Serializes the writes, which read the values they replace, and
+	// keeps Collect from seeing a blob before its value is written.
+	mu sync.Mutex
+}
+
+// The SpillStore is a Store.
+var (
+	_ Store       = (*SpillStore)(nil)
+	_ Snapshotter = (*SpillStore)(nil)
+	_ Compacter   = (*SpillStore)(nil)
+	_ Sizer       = (*SpillStore)(nil)
+)
+
+// NewSpillStore returns the SpillStore moving the values of the given
+// store larger than threshold bytes into the given blob store.
+func NewSpillStore(store Store, blobs BlobStore, threshold int) *SpillStore {
+	return &SpillStore{store: store, blobs: blobs, threshold: threshold}
+}
+
+// Get returns the value of the given key, read from its blob if it was
+// spilled.
+func (s *SpillStore) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	data, err := s.store.Get(key, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	return readSpilled(s.blobs, data)
+}
+
+// Put stores the value of the given key, spilling it if needed.
+func (s *SpillStore) Put(key, value []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Put(key, value)
+	return s.Write(batch, wo)
+}
+
+// Delete deletes the given key along with its blob.
+func (s *SpillStore) Delete(key []byte, wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return s.Write(batch, wo)
+}
+
+// Write applies the given batch atomically, spilling the values it puts
+// into blobs first, and deleting the blobs of the values it replaces
+// once it is applied. If the batch fails, the blobs written for it are
+// deleted.
+func (s *SpillStore) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &spillWriter{store: s.store, blobs: s.blobs, threshold: s.threshold, out: new(leveldb.Batch), pending: make(map[string]string)}
+	err := batch.Replay(w)
+	if err == nil {
+		err = w.err
+	}
+	if err == nil {
+		err = s.store.Write(w.out, wo)
+	}
+	if err != nil {
+		for _, name := range w.written {
+			s.blobs.Delete(name)
+		}
+		return err
+	}
+
+	// The batch no longer refers to these, and Collect gets any left
+	// by a failure.
+	for _, name := range w.garbage {
+		s.blobs.Delete(name)
+	}
+
+	return nil
+}
+
+// Collect deletes the blobs no value of the wrapped store refers to,
+// such as those left by a crash, returning how many it deleted.
+func (s *SpillStore) Collect() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.blobs.Names()
+	if err != nil {
+		return 0, err
+	}
+
+	used := make(map[string]bool)
+	iter := s.store.NewIterator(nil, nil)
+	for iter.Next() {
+		if name, ok := spilledName(iter.Value()); ok {
+			used[name] = true
+		}
+	}
+	err = iter.Error()
+	iter.Release()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	for _, name := range names {
+		if used[name] {
+			continue
+		}
+		if err = s.blobs.Delete(name); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// NewIterator returns an iterator over the given range, reading the
+// values of spilled keys from their blobs.
+func (s *SpillStore) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &spillIterator{Iterator: s.store.NewIterator(slice, ro), blobs: s.blobs}
+}
+
+// Close closes the wrapped store.
+func (s *SpillStore) Close() error {
+	return s.store.Close()
+}
+
+// Snapshot takes a snapshot of the wrapped store, returning
+// ErrSnapshotUnsupported if it can't take one. The blobs aren't part of
+// the snapshot, so reading a value deleted since it was taken fails.
+func (s *SpillStore) Snapshot() (StoreSnapshot, error) {
+	snap, err := takeSnapshot(s.store)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillSnapshot{snap: snap, blobs: s.blobs}, nil
+}
+
+// CompactRange compacts the given range of the wrapped store, returning
+// ErrCompactUnsupported if it can't compact.
+func (s *SpillStore) CompactRange(r util.Range) error {
+	return compactStore(s.store, r)
+}
+
+// SizeOf estimates the on-disk size of the given ranges of the wrapped
+// store, leaving out the blobs, returning ErrSizeUnsupported if it
+// can't estimate it.
+func (s *SpillStore) SizeOf(ranges []util.Range) (leveldb.Sizes, error) {
+	sizer, ok := s.store.(Sizer)
+	if !ok {
+		return nil, ErrSizeUnsupported
+	}
+
+	return sizer.SizeOf(ranges)
+}
+
+// readSpilled returns the value stored as data, reading it from its blob
+// if it was spilled. It returns ErrInvalidRecord if data isn't tagged.
+func readSpilled(blobs BlobStore, data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == spillInline {
+		return data[1:], nil
+	}
+
+	name, ok := spilledName(data)
+	if !ok {
+		return nil, ErrInvalidRecord
+	}
+
+	return blobs.Get(name)
+}
+
+// spilledName returns the name of the blob the value stored as data was
+// spilled into, if it was.
+func spilledName(data []byte) (string, bool) {
+	if len(data) < 2 || data[0] != spillBlob {
+		return "", false
+	}
+
+	return string(data[1:]), true
+}
+
+// newBlobName generates a new random name for a blob.
+func newBlobName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// spillWriter replays a batch written to a SpillStore into the batch
+// written to the wrapped store.
+type spillWriter struct {
+	store     Store
+	blobs     BlobStore
+	threshold int
+	out       *leveldb.Batch
+	err       error
+
+	// The blobs written for the batch, and those of the values it
+	// replaces.
+	written, garbage []string
+
+	// The blobs of the keys written so far, which the wrapped store
+	// doesn't hold yet, or "" if they weren't spilled.
+	pending map[string]string
+}
+
+// Put puts the given value, spilled into a blob if larger than the
+// threshold, replacing the blob of the previous value.
+func (w *spillWriter) Put(key, value []byte) {
+	if w.err != nil {
+		return
+	}
+	w.replace(key)
+	if len(value) <= w.threshold {
+		w.out.Put(key, append([]byte{spillInline}, value...))
+		w.pending[string(key)] = ""
+		return
+	}
+
+	name, err := newBlobName()
+	if err == nil {
+		err = w.blobs.Put(name, value)
+	}
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.written = append(w.written, name)
+
+	w.out.Put(key, append([]byte{spillBlob}, name...))
+	w.pending[string(key)] = name
+}
+
+// Delete deletes the given key along with its blob.
+func (w *spillWriter) Delete(key []byte) {
+	if w.err != nil {
+		return
+	}
+	w.replace(key)
+	w.out.Delete(key)
+	w.pending[string(key)] = ""
+}
+
+// replace marks the blob of the value currently stored at the given key
+// as garbage, if it was spilled.
+func (w *spillWriter) replace(key []byte) {
+	name, ok := w.pending[string(key)]
+	if !ok {
+		data, err := w.store.Get(key, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			w.err = err
+			return
+		}
+		name, _ = spilledName(data)
+	}
+
+	if name != "" {
+		w.garbage = append(w.garbage, name)
+	}
+}
+
+// spillIterator is an iterator of a SpillStore, reading the values of
+// spilled keys from their blobs.
+type spillIterator struct {
+	iterator.Iterator
+	blobs BlobStore
+	err   error
+}
+
+// Value returns the value at the current key, read from its blob if it
+// was spilled. If that fails, it returns nil and Error returns why.
+func (it *spillIterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+
+	value, err := readSpilled(it.blobs, it.Iterator.Value())
+	if err != nil {
+		it.err = err
+		return nil
+	}
+
+	return value
+}
+
+func (it *spillIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.Iterator.Error()
+}
+
+// spillSnapshot is a snapshot of a SpillStore.
+type spillSnapshot struct {
+	snap  StoreSnapshot
+	blobs BlobStore
+}
+
+func (s *spillSnapshot) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	data, err := s.snap.Get(key, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	return readSpilled(s.blobs, data)
+}
+
+func (s *spillSnapshot) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &spillIterator{Iterator: s.snap.NewIterator(slice, ro), blobs: s.blobs}
+}
+
+func (s *spillSnapshot) Release() {
+	s.snap.Release()
+}
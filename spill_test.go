@@ -0,0 +1,137 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestSpillStore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := NewDirBlobStore(filepath.Join(file, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq, err := OpenPriorityQueueWithStore(file, ASC, NewSpillStore(db, blobs, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	large := bytes.Repeat([]byte("0123456789"), 50)
+	if err = pq.Enqueue(NewPriorityItem(large, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(0, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := blobs.Names(); len(names) != 1 {
+		t.Errorf("Expected the large value to be spilled into 1 blob, got %d", len(names))
+	}
+
+	// Only the name of the blob is kept in LevelDB.
+	data, err := db.Get(pq.generateKey(0, 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != spillBlob || len(data) > 64 {
+		t.Errorf("Expected a reference to the blob, got %d bytes tagged %d", len(data), data[0])
+	}
+
+	// The value moves into a lease and back.
+	item, token, err := pq.DequeueWithToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(item.Value, large) {
+		t.Error("Expected the large value to be read from its blob")
+	}
+	if err = pq.Release(token); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := blobs.Names(); len(names) != 1 {
+		t.Errorf("Expected the replaced blobs to be deleted, got %d blobs", len(names))
+	}
+
+	for _, want := range [][]byte{[]byte("small"), large} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(item.Value, want) {
+			t.Errorf("Expected a value of %d bytes, got %d", len(want), len(item.Value))
+		}
+	}
+	if names, _ := blobs.Names(); len(names) != 0 {
+		t.Errorf("Expected the blob to be deleted along with the item, got %d blobs", len(names))
+	}
+}
+
+func TestSpillStoreCollect(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := leveldb.OpenFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := NewDirBlobStore(filepath.Join(file, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSpillStore(db, blobs, 4)
+	s, err := OpenStackWithStore(file, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("a spilled value")); err != nil {
+		t.Fatal(err)
+	}
+	// A blob left by a crash before its value was written.
+	if err = blobs.Put("orphan", []byte("orphaned value")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 blob to be collected, got %d", n)
+	}
+	if _, err = blobs.Get("orphan"); err == nil {
+		t.Error("Expected the orphaned blob to be deleted")
+	}
+
+	item, err := s.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "a spilled value" {
+		t.Errorf("Expected 'a spilled value', got '%s'", item.ToString())
+	}
+
+	// A value whose blob is missing can't be read.
+	data, err := db.Get(item.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, ok := spilledName(data)
+	if !ok {
+		t.Fatalf("Expected the value to be spilled, got %q", data)
+	}
+	if err = blobs.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Peek(); err == nil {
+		t.Error("Expected reading a value without its blob to fail")
+	}
+}
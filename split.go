@@ -0,0 +1,141 @@
+package goque
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Split moves every item of the priority queue that pred returns true
+// for into a new priority queue created at dstDir, with the same order,
+// and returns it open. The items keep their priority level, headers and
+// timestamps, and their relative order within each priority level, in
+// both priority queues. Items in flight are not moved.
+//
+// The items are moved in batches of up to 1000, each one removed from
+// this priority queue only once the new one holds it, so if Split fails
+// part way, the items of the last batch may end up in both, and the
+// items moved so far are found by opening dstDir. The moved items fire
+// OnDrop and are recorded in the change log as ChangeDrop, like
+// RemoveByPriorityID. If dstDir is not empty, ErrDataDirExists is
+// returned.
+func (pq *PriorityQueue) Split(pred func(item *PriorityItem) bool, dstDir string) (*PriorityQueue, error) {
+	// Make sure the destination is empty.
+	entries, err := ioutil.ReadDir(dstDir)
+	if err == nil && len(entries) > 0 {
+		return nil, ErrDataDirExists
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	pq.readLock()
+	isOpen, order := pq.isOpen, pq.order
+	pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !isOpen {
+		return nil, ErrDBClosed
+	}
+
+	dst, err := OpenPriorityQueue(dstDir, order)
+	if err != nil {
+		return nil, err
+	}
+
+	// Move batches of items until a pass over the priority levels finds
+	// no more.
+	var scanned [256]uint64
+	for {
+		n, err := pq.splitBatch(pred, dst, &scanned, defaultCopyBatchSize)
+		if err != nil {
+			dst.Close()
+			return nil, err
+		}
+		if n == 0 {
+			return dst, nil
+		}
+	}
+}
+
+// splitBatch moves up to max items that pred returns true for, and that
+// come after the given IDs scanned in each priority level, into dst. It
+// returns the number of items moved, advancing the scanned IDs.
+func (pq *PriorityQueue) splitBatch(pred func(item *PriorityItem) bool, dst *PriorityQueue, scanned *[256]uint64, max int) (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	// Collect the matching items in dequeue order.
+	var items []*PriorityItem
+	for _, priority := range pq.dequeueLevels() {
+		if len(items) == max {
+			break
+		}
+
+		level := pq.levels[priority]
+		start := scanned[priority]
+		if start < level.head {
+			start = level.head
+		}
+		iter := pq.db.NewIterator(&util.Range{
+			Start: pq.generateKey(priority, start+1),
+			Limit: pq.generateKey(priority, level.tail+1),
+		}, nil)
+
+		scanned[priority] = level.tail
+		for iter.Next() {
+			item, err := pq.decodeItem(iter.Key(), iter.Value())
+			if err != nil {
+				iter.Release()
+				return 0, err
+			}
+			if !pred(item) {
+				continue
+			}
+
+			items = append(items, item)
+			if len(items) == max {
+				scanned[priority] = item.ID
+				break
+			}
+		}
+
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	// Add the items to the destination, then remove them from here.
+	if err := dst.copyItems(items); err != nil {
+		return 0, err
+	}
+	batch := new(leveldb.Batch)
+	for _, item := range items {
+		pq.removeItem(batch, item)
+	}
+	pq.putLevelsMeta(batch, items, (*priorityLevel).without)
+	if err := pq.write(batch, changeOf(ChangeDrop, items...)); err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		pq.commitRemove(item)
+	}
+	size := priorityItemsSize(items)
+	pq.bounds.remove(size)
+	pq.compact.deleted(pq.db, pq.log, uint64(len(items)), size)
+	firePriority(pq.hooks.OnDrop, items...)
+
+	return len(items), nil
+}
@@ -0,0 +1,93 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueSplit(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 2500; i++ {
+		item := NewPriorityItemString(fmt.Sprintf("item %d", i), uint8(i%2))
+		item.Headers = map[string]string{"tenant": fmt.Sprint(i % 3)}
+		if err = pq.Enqueue(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dstDir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := pq.Split(func(item *PriorityItem) bool { return item.Headers["tenant"] == "0" }, dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	if dst.Length() != 833 || pq.Length() != 1667 {
+		t.Fatalf("Expected 833 items moved and 1667 left, got %d and %d", dst.Length(), pq.Length())
+	}
+
+	// Both priority queues keep the order of their items, also once
+	// reopened.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, DESC); err != nil {
+		t.Fatal(err)
+	}
+	check := func(q *PriorityQueue, tenant0 bool) {
+		for _, priority := range []int{1, 0} {
+			for i := 1; i <= 2500; i++ {
+				if i%2 != priority || (i%3 == 0) != tenant0 {
+					continue
+				}
+				item, err := q.Dequeue()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := fmt.Sprintf("item %d", i); item.ToString() != want || int(item.Priority) != priority {
+					t.Fatalf("Expected '%s' in priority %d, got '%s' in %d", want, priority, item.ToString(), item.Priority)
+				}
+			}
+		}
+		if _, err := q.Dequeue(); err != ErrEmpty {
+			t.Errorf("Expected ErrEmpty, got %v", err)
+		}
+	}
+	check(dst, true)
+	check(pq, false)
+}
+
+func TestPriorityQueueSplitExists(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The destination must be empty.
+	dstDir := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	other, err := OpenPriorityQueue(dstDir, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	defer os.RemoveAll(dstDir)
+
+	if _, err = pq.Split(func(*PriorityItem) bool { return true }, dstDir); err != ErrDataDirExists {
+		t.Errorf("Expected ErrDataDirExists, got %v", err)
+	}
+	if pq.Length() != 1 {
+		t.Errorf("Expected the item to stay, got %d items", pq.Length())
+	}
+}
@@ -0,0 +1,403 @@
+package sqsserver
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// messageIDHeader is the item header holding the ID of a message.
+const messageIDHeader = "sqs-message-id"
+
+// The limits of SQS on the parameters of ReceiveMessage.
+const (
+	maxReceiveMessages   = 10
+	maxWaitTime          = 20 * time.Second
+	maxVisibilityTimeout = 12 * time.Hour
+)
+
+// receiveRetryInterval is how often a waiting ReceiveMessage retries an
+// empty queue without being signaled, so messages whose visibility
+// timeout passed are received again.
+const receiveRetryInterval = time.Second
+
+// decode decodes the JSON request body into v.
+func decode(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return invalidParameter("invalid request body: " + err.Error())
+	}
+
+	return nil
+}
+
+type getQueueURLRequest struct {
+	QueueName string
+}
+
+type getQueueURLResponse struct {
+	QueueUrl string
+}
+
+// getQueueURL returns the URL of a queue, on the host the request was
+// sent to.
+func (s *Server) getQueueURL(r *http.Request, body []byte) (interface{}, error) {
+	var req getQueueURLRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	if req.QueueName == "" {
+		return nil, missingParameter("QueueName")
+	}
+	if _, err := s.queueByName(req.QueueName); err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return &getQueueURLResponse{QueueUrl: scheme + "://" + r.Host + "/" + req.QueueName}, nil
+}
+
+type sendMessageRequest struct {
+	QueueUrl     string
+	MessageBody  string
+	DelaySeconds int
+}
+
+type sendMessageResponse struct {
+	MessageId        string
+	MD5OfMessageBody string
+}
+
+// sendMessage enqueues a message.
+func (s *Server) sendMessage(r *http.Request, body []byte) (interface{}, error) {
+	var req sendMessageRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	pq, err := s.queue(req.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.MessageBody == "" {
+		return nil, missingParameter("MessageBody")
+	}
+	if len(req.MessageBody) > s.opts.MaxMessageSize {
+		return nil, invalidParameter("message must be shorter than " + strconv.Itoa(s.opts.MaxMessageSize) + " bytes")
+	}
+	if req.DelaySeconds != 0 {
+		return nil, invalidParameter("message delays are not supported")
+	}
+
+	id, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+	item := goque.NewPriorityItem([]byte(req.MessageBody), 0)
+	item.Headers = map[string]string{messageIDHeader: id}
+	if err = pq.Enqueue(item); err != nil {
+		return nil, toAPIError(err)
+	}
+
+	return &sendMessageResponse{MessageId: id, MD5OfMessageBody: md5Hex(item.Value)}, nil
+}
+
+type receiveMessageRequest struct {
+	QueueUrl            string
+	MaxNumberOfMessages *int
+	VisibilityTimeout   *int
+	WaitTimeSeconds     *int
+}
+
+type receiveMessageResponse struct {
+	Messages []*message `json:",omitempty"`
+}
+
+type message struct {
+	MessageId     string
+	ReceiptHandle string
+	MD5OfBody     string
+	Body          string
+	Attributes    map[string]string `json:",omitempty"`
+}
+
+// receiveMessage reserves the next messages of a queue, waiting for one
+// while it is empty if the request sets a wait time.
+func (s *Server) receiveMessage(r *http.Request, body []byte) (interface{}, error) {
+	var req receiveMessageRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	pq, err := s.queue(req.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	max := 1
+	if req.MaxNumberOfMessages != nil {
+		max = *req.MaxNumberOfMessages
+		if max < 1 || max > maxReceiveMessages {
+			return nil, invalidParameter("MaxNumberOfMessages must be from 1 to 10")
+		}
+	}
+	timeout := s.opts.VisibilityTimeout
+	if req.VisibilityTimeout != nil {
+		timeout = time.Duration(*req.VisibilityTimeout) * time.Second
+		if timeout < 0 || timeout > maxVisibilityTimeout {
+			return nil, invalidParameter("VisibilityTimeout must be from 0 to 43200 seconds")
+		}
+	}
+	var wait time.Duration
+	if req.WaitTimeSeconds != nil {
+		wait = time.Duration(*req.WaitTimeSeconds) * time.Second
+		if wait < 0 || wait > maxWaitTime {
+			return nil, invalidParameter("WaitTimeSeconds must be from 0 to 20")
+		}
+	}
+
+	// Start listening before the first receive, so no message sent in
+	// between is missed.
+	ch := pq.Notify()
+	defer pq.StopNotify(ch)
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(receiveRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		messages, err := receive(pq, max, timeout)
+		if err != nil {
+			return nil, toAPIError(err)
+		}
+		if len(messages) > 0 {
+			return &receiveMessageResponse{Messages: messages}, nil
+		}
+
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return nil, toAPIError(goque.ErrDBClosed)
+			}
+		case <-ticker.C:
+		case <-deadline.C:
+			return &receiveMessageResponse{}, nil
+		case <-r.Context().Done():
+			return &receiveMessageResponse{}, nil
+		}
+	}
+}
+
+// receive reserves up to max messages of a priority queue for the given
+// visibility timeout. Messages received with a timeout of 0 are made
+// visible again right away.
+func receive(pq *goque.PriorityQueue, max int, timeout time.Duration) ([]*message, error) {
+	// Reserve the messages without a deadline when they are made
+	// visible again right away, so they aren't received twice.
+	lease := timeout
+	if timeout == 0 {
+		lease = maxVisibilityTimeout
+	}
+
+	var messages []*message
+	var tokens []goque.Token
+	for len(messages) < max {
+		item, token, err := pq.Reserve(lease)
+		if err == goque.ErrEmpty {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		msg := &message{
+			MessageId:     messageID(item),
+			ReceiptHandle: string(token),
+			MD5OfBody:     md5Hex(item.Value),
+			Body:          string(item.Value),
+			Attributes: map[string]string{
+				"ApproximateReceiveCount": strconv.FormatUint(uint64(item.Attempts)+1, 10),
+			},
+		}
+		if !item.CreatedAt.IsZero() {
+			msg.Attributes["SentTimestamp"] = strconv.FormatInt(item.CreatedAt.UnixNano()/int64(time.Millisecond), 10)
+		}
+		messages = append(messages, msg)
+		tokens = append(tokens, token)
+	}
+
+	// Nacked items go back to the head of their level, so nack the
+	// last one first to keep their order.
+	if timeout == 0 {
+		for i := len(tokens) - 1; i >= 0; i-- {
+			if err := pq.Nack(tokens[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+type deleteMessageRequest struct {
+	QueueUrl      string
+	ReceiptHandle string
+}
+
+// deleteMessage deletes a received message.
+func (s *Server) deleteMessage(r *http.Request, body []byte) (interface{}, error) {
+	var req deleteMessageRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	pq, err := s.queue(req.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if req.ReceiptHandle == "" {
+		return nil, missingParameter("ReceiptHandle")
+	}
+
+	if err = pq.Ack(goque.Token(req.ReceiptHandle)); err != nil {
+		return nil, toAPIError(err)
+	}
+
+	return struct{}{}, nil
+}
+
+type changeMessageVisibilityRequest struct {
+	QueueUrl          string
+	ReceiptHandle     string
+	VisibilityTimeout *int
+}
+
+// changeMessageVisibility sets the visibility timeout of a received
+// message to the given time from now. A timeout of 0 makes it visible
+// again right away.
+func (s *Server) changeMessageVisibility(r *http.Request, body []byte) (interface{}, error) {
+	var req changeMessageVisibilityRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	pq, err := s.queue(req.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if req.ReceiptHandle == "" {
+		return nil, missingParameter("ReceiptHandle")
+	}
+	if req.VisibilityTimeout == nil {
+		return nil, missingParameter("VisibilityTimeout")
+	}
+
+	timeout := time.Duration(*req.VisibilityTimeout) * time.Second
+	if timeout < 0 || timeout > maxVisibilityTimeout {
+		return nil, invalidParameter("VisibilityTimeout must be from 0 to 43200 seconds")
+	}
+
+	token := goque.Token(req.ReceiptHandle)
+	if timeout == 0 {
+		err = pq.Nack(token)
+	} else {
+		err = pq.Extend(token, timeout)
+	}
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+
+	return struct{}{}, nil
+}
+
+type getQueueAttributesRequest struct {
+	QueueUrl       string
+	AttributeNames []string
+}
+
+type getQueueAttributesResponse struct {
+	Attributes map[string]string
+}
+
+// getQueueAttributes returns the requested attributes of a queue, or all
+// of them for All.
+func (s *Server) getQueueAttributes(r *http.Request, body []byte) (interface{}, error) {
+	var req getQueueAttributesRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	pq, err := s.queue(req.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := pq.Stats()
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+	leases, err := pq.Leases()
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+
+	all := map[string]string{
+		"ApproximateNumberOfMessages":           strconv.FormatUint(stats.Length, 10),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(len(leases)),
+		"ApproximateNumberOfMessagesDelayed":    "0",
+		"VisibilityTimeout":                     strconv.Itoa(int(s.opts.VisibilityTimeout / time.Second)),
+		"MaximumMessageSize":                    strconv.Itoa(s.opts.MaxMessageSize),
+		"DelaySeconds":                          "0",
+	}
+
+	attrs := make(map[string]string)
+	for _, name := range req.AttributeNames {
+		if name == "All" {
+			attrs = all
+			break
+		}
+
+		v, ok := all[name]
+		if !ok {
+			return nil, &apiError{http.StatusBadRequest, "InvalidAttributeName", "unknown attribute " + name}
+		}
+		attrs[name] = v
+	}
+
+	return &getQueueAttributesResponse{Attributes: attrs}, nil
+}
+
+// messageID returns the ID of the message held by an item. Items not
+// sent through SQS get an ID made of their priority and ID.
+func messageID(item *goque.PriorityItem) string {
+	if id, ok := item.Headers[messageIDHeader]; ok {
+		return id
+	}
+
+	return fmt.Sprintf("%d-%d", item.Priority, item.ID)
+}
+
+// newMessageID generates a random message ID formatted as a UUID.
+func newMessageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// md5Hex returns the hex-encoded MD5 digest of b, which SQS clients use
+// to check message bodies.
+func md5Hex(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,202 @@
+package sqsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/beeker1121/goque"
+)
+
+// newClient starts a server serving the given priority queue as "jobs",
+// returning an SQS client of the AWS SDK pointed at it and a function
+// stopping it.
+func newClient(t *testing.T, pq *goque.PriorityQueue) (*sqs.Client, func()) {
+	s := New(Options{})
+	if err := s.Register("jobs", pq); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+
+	client := sqs.New(sqs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(ts.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+
+	return client, ts.Close
+}
+
+func TestActions(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := newClient(t, pq)
+	defer stop()
+	ctx := context.Background()
+
+	url, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String("jobs")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueURL := url.QueueUrl
+
+	var ids []string
+	for i := 1; i <= 3; i++ {
+		sent, err := client.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:    queueURL,
+			MessageBody: aws.String(fmt.Sprintf("value for item %d", i)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, aws.ToString(sent.MessageId))
+	}
+
+	received, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            queueURL,
+		MaxNumberOfMessages: 2,
+		VisibilityTimeout:   60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Messages) != 2 {
+		t.Fatalf("Expected to receive 2 messages, got %d", len(received.Messages))
+	}
+	for i, msg := range received.Messages {
+		if aws.ToString(msg.Body) != fmt.Sprintf("value for item %d", i+1) || aws.ToString(msg.MessageId) != ids[i] {
+			t.Errorf("Expected message %d, got %s %s", i+1, aws.ToString(msg.MessageId), aws.ToString(msg.Body))
+		}
+	}
+
+	attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queueURL,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Attributes["ApproximateNumberOfMessages"] != "1" || attrs.Attributes["ApproximateNumberOfMessagesNotVisible"] != "2" {
+		t.Errorf("Expected 1 visible and 2 hidden messages, got %v", attrs.Attributes)
+	}
+
+	first, second := received.Messages[0], received.Messages[1]
+	if _, err = client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: queueURL, ReceiptHandle: first.ReceiptHandle}); err != nil {
+		t.Error(err)
+	}
+	_, err = client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: queueURL, ReceiptHandle: first.ReceiptHandle})
+	var invalid *types.ReceiptHandleIsInvalid
+	if !errors.As(err, &invalid) {
+		t.Errorf("Expected a ReceiptHandleIsInvalid error, got %v", err)
+	}
+
+	// Making the second message visible again puts it back first.
+	if _, err = client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          queueURL,
+		ReceiptHandle:     second.ReceiptHandle,
+		VisibilityTimeout: 0,
+	}); err != nil {
+		t.Error(err)
+	}
+
+	received, err = client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: queueURL, MaxNumberOfMessages: 10, VisibilityTimeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Messages) != 2 || aws.ToString(received.Messages[0].Body) != "value for item 2" {
+		t.Fatalf("Expected to receive items 2 and 3, got %v", received.Messages)
+	}
+	if received.Messages[0].Attributes["ApproximateReceiveCount"] != "2" {
+		t.Errorf("Expected a receive count of 2, got %v", received.Messages[0].Attributes)
+	}
+
+	// Once their visibility timeout passes, a waiting receive gets the
+	// messages again.
+	received, err = client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: queueURL, MaxNumberOfMessages: 10, WaitTimeSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Messages) != 2 {
+		t.Errorf("Expected to receive 2 messages again, got %d", len(received.Messages))
+	}
+}
+
+func TestActionsWait(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := newClient(t, pq)
+	defer stop()
+	ctx := context.Background()
+	queueURL := aws.String("http://localhost/jobs")
+
+	received, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: queueURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Messages) != 0 {
+		t.Errorf("Expected no message, got %d", len(received.Messages))
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pq.EnqueueString(0, "value")
+	}()
+
+	received, err = client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: queueURL, WaitTimeSeconds: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Messages) != 1 || aws.ToString(received.Messages[0].Body) != "value" {
+		t.Errorf("Expected to receive the message sent while waiting, got %v", received.Messages)
+	}
+}
+
+func TestActionsErrors(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	client, stop := newClient(t, pq)
+	defer stop()
+	ctx := context.Background()
+
+	_, err = client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String("other")})
+	var notExist *types.QueueDoesNotExist
+	if !errors.As(err, &notExist) {
+		t.Errorf("Expected a QueueDoesNotExist error, got %v", err)
+	}
+
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String("http://localhost/jobs"),
+		MessageBody:  aws.String("value"),
+		DelaySeconds: 10,
+	})
+	if err == nil {
+		t.Error("Expected an error sending a delayed message")
+	}
+
+	_, err = client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://localhost/jobs"), MaxNumberOfMessages: 11})
+	if err == nil {
+		t.Error("Expected an error receiving more than 10 messages")
+	}
+}
@@ -0,0 +1,224 @@
+// Package sqsserver serves Goque priority queues through the core
+// actions of the Amazon SQS API, so code written against SQS can run
+// against Goque in local development and air-gapped deployments.
+//
+// The Server is an http.Handler speaking the AWS JSON protocol used by
+// the current AWS SDKs, which send every action as a POST request with
+// an X-Amz-Target header. Point an SDK at it by setting its endpoint,
+// such as BaseEndpoint in the AWS SDK for Go v2. The supported actions
+// are:
+//
+//	GetQueueUrl              Get the URL of a registered queue.
+//	SendMessage              Enqueue a message with a priority of 0.
+//	ReceiveMessage           Reserve up to 10 messages for a visibility
+//	                         timeout, waiting up to 20 seconds for one.
+//	DeleteMessage            Delete a received message.
+//	ChangeMessageVisibility  Change the visibility timeout of a received
+//	                         message.
+//	GetQueueAttributes       Get the message counts and visibility
+//	                         timeout of a queue.
+//
+// Request signatures are not checked, so any credentials are accepted.
+// Message delays and message attributes are not supported.
+package sqsserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// ErrRegistered is returned when registering a priority queue under a
+// name that is already taken.
+var ErrRegistered = errors.New("sqsserver: Name is already registered")
+
+// The defaults of the options, which are the defaults of SQS.
+const (
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultMaxMessageSize    = 256 << 10
+)
+
+// targetPrefix prefixes the X-Amz-Target header of SQS actions.
+const targetPrefix = "AmazonSQS."
+
+// Options configures a Server.
+type Options struct {
+	// VisibilityTimeout is how long received messages are hidden,
+	// unless set by the request. Defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+
+	// MaxMessageSize is the largest message body accepted, in bytes.
+	// Defaults to 256 KiB.
+	MaxMessageSize int
+}
+
+// Server is an http.Handler serving the registered priority queues as
+// SQS queues.
+type Server struct {
+	mu      sync.RWMutex
+	queues  map[string]*goque.PriorityQueue
+	opts    Options
+	actions map[string]action
+}
+
+// action runs an SQS action on the request body, returning the value
+// of the response body.
+type action func(r *http.Request, body []byte) (interface{}, error)
+
+// New returns a Server without any priority queue.
+func New(opts Options) *Server {
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = defaultMaxMessageSize
+	}
+
+	s := &Server{queues: make(map[string]*goque.PriorityQueue), opts: opts}
+	s.actions = map[string]action{
+		"GetQueueUrl":             s.getQueueURL,
+		"SendMessage":             s.sendMessage,
+		"ReceiveMessage":          s.receiveMessage,
+		"DeleteMessage":           s.deleteMessage,
+		"ChangeMessageVisibility": s.changeMessageVisibility,
+		"GetQueueAttributes":      s.getQueueAttributes,
+	}
+
+	return s
+}
+
+// Register serves the given priority queue as the SQS queue with the
+// given name. The priority queue must be unregistered before it is
+// closed.
+func (s *Server) Register(name string, pq *goque.PriorityQueue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; ok {
+		return ErrRegistered
+	}
+	s.queues[name] = pq
+
+	return nil
+}
+
+// Unregister stops serving the priority queue registered under name.
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.queues, name)
+}
+
+// ServeHTTP runs the SQS action of a request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, &apiError{http.StatusMethodNotAllowed, "InvalidAction", "actions must be sent with POST"})
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	act, ok := s.actions[strings.TrimPrefix(target, targetPrefix)]
+	if !ok || !strings.HasPrefix(target, targetPrefix) {
+		writeError(w, &apiError{http.StatusBadRequest, "InvalidAction", "unsupported action " + target})
+		return
+	}
+
+	// Leave room for the JSON encoding of the largest message.
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 2*int64(s.opts.MaxMessageSize)+64<<10))
+	if err != nil {
+		writeError(w, invalidParameter(err.Error()))
+		return
+	}
+
+	v, err := act(r, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(v)
+}
+
+// queue returns the priority queue named by a queue URL, which is the
+// last element of its path.
+func (s *Server) queue(url string) (*goque.PriorityQueue, error) {
+	if url == "" {
+		return nil, missingParameter("QueueUrl")
+	}
+
+	return s.queueByName(url[strings.LastIndex(url, "/")+1:])
+}
+
+// queueByName returns the priority queue registered under name.
+func (s *Server) queueByName(name string) (*goque.PriorityQueue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pq, ok := s.queues[name]
+	if !ok {
+		return nil, &apiError{http.StatusBadRequest, "QueueDoesNotExist", "the specified queue does not exist"}
+	}
+
+	return pq, nil
+}
+
+// apiError is an SQS error response.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+// invalidParameter returns an error for an invalid request parameter.
+func invalidParameter(msg string) error {
+	return &apiError{http.StatusBadRequest, "InvalidParameterValue", msg}
+}
+
+// missingParameter returns an error for a missing request parameter.
+func missingParameter(name string) error {
+	return &apiError{http.StatusBadRequest, "MissingParameter", "the request must contain the parameter " + name}
+}
+
+// toAPIError returns a Goque error as an SQS error.
+func toAPIError(err error) error {
+	switch err {
+	case goque.ErrInvalidToken, goque.ErrLeaseExpired:
+		return &apiError{http.StatusBadRequest, "ReceiptHandleIsInvalid", "the receipt handle is not valid"}
+	case goque.ErrDBClosed:
+		return &apiError{http.StatusServiceUnavailable, "ServiceUnavailable", err.Error()}
+	case goque.ErrFull:
+		return &apiError{http.StatusBadRequest, "OverLimit", err.Error()}
+	}
+
+	return err
+}
+
+// writeError writes an error response. Errors other than an *apiError
+// are written as internal errors.
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*apiError)
+	if !ok {
+		e = &apiError{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.sqs#" + e.code,
+		"message": e.message,
+	})
+}
@@ -0,0 +1,132 @@
+package sqsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+)
+
+// call sends an action to the server and decodes its response body.
+func call(t *testing.T, s *Server, method, target, body string) (int, map[string]interface{}) {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	r.Header.Set("X-Amz-Target", target)
+	r.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.Code, resp
+}
+
+func TestServerErrors(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	s := New(Options{MaxMessageSize: 4})
+	if err = s.Register("jobs", pq); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "AmazonSQS.SendMessage", `{}`, http.StatusMethodNotAllowed, "InvalidAction"},
+		{http.MethodPost, "AmazonSQS.CreateQueue", `{}`, http.StatusBadRequest, "InvalidAction"},
+		{http.MethodPost, "SendMessage", `{}`, http.StatusBadRequest, "InvalidAction"},
+		{http.MethodPost, "AmazonSQS.SendMessage", `{`, http.StatusBadRequest, "InvalidParameterValue"},
+		{http.MethodPost, "AmazonSQS.SendMessage", `{"MessageBody":"a"}`, http.StatusBadRequest, "MissingParameter"},
+		{http.MethodPost, "AmazonSQS.SendMessage", `{"QueueUrl":"http://h/other","MessageBody":"a"}`, http.StatusBadRequest, "QueueDoesNotExist"},
+		{http.MethodPost, "AmazonSQS.SendMessage", `{"QueueUrl":"http://h/jobs","MessageBody":"abcde"}`, http.StatusBadRequest, "InvalidParameterValue"},
+		{http.MethodPost, "AmazonSQS.DeleteMessage", `{"QueueUrl":"http://h/jobs","ReceiptHandle":"x"}`, http.StatusBadRequest, "ReceiptHandleIsInvalid"},
+		{http.MethodPost, "AmazonSQS.ChangeMessageVisibility", `{"QueueUrl":"http://h/jobs","ReceiptHandle":"x"}`, http.StatusBadRequest, "MissingParameter"},
+		{http.MethodPost, "AmazonSQS.GetQueueAttributes", `{"QueueUrl":"http://h/jobs","AttributeNames":["Policy"]}`, http.StatusBadRequest, "InvalidAttributeName"},
+	}
+
+	for _, tt := range tests {
+		status, resp := call(t, s, tt.method, tt.target, tt.body)
+		if status != tt.status || resp["__type"] != "com.amazonaws.sqs#"+tt.code {
+			t.Errorf("Expected %s %s to fail with %d %s, got %d %v", tt.target, tt.body, tt.status, tt.code, status, resp)
+		}
+	}
+}
+
+func TestServerRegister(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	s := New(Options{})
+	if err = s.Register("jobs", pq); err != nil {
+		t.Error(err)
+	}
+	if err = s.Register("jobs", pq); err != ErrRegistered {
+		t.Errorf("Expected error ErrRegistered, got %v", err)
+	}
+
+	status, resp := call(t, s, http.MethodPost, "AmazonSQS.GetQueueUrl", `{"QueueName":"jobs"}`)
+	if status != http.StatusOK || resp["QueueUrl"] != "http://example.com/jobs" {
+		t.Errorf("Expected the URL of jobs, got %d %v", status, resp)
+	}
+
+	s.Unregister("jobs")
+	status, resp = call(t, s, http.MethodPost, "AmazonSQS.GetQueueUrl", `{"QueueName":"jobs"}`)
+	if status != http.StatusBadRequest || resp["__type"] != "com.amazonaws.sqs#QueueDoesNotExist" {
+		t.Errorf("Expected jobs to be unregistered, got %d %v", status, resp)
+	}
+}
+
+func TestServerReceiveVisible(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := goque.OpenPriorityQueue(file, goque.ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	s := New(Options{})
+	if err = s.Register("jobs", pq); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if _, err = pq.EnqueueString(0, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Messages received with a visibility timeout of 0 stay visible, in
+	// the same order.
+	for i := 0; i < 2; i++ {
+		status, resp := call(t, s, http.MethodPost, "AmazonSQS.ReceiveMessage", `{"QueueUrl":"http://h/jobs","MaxNumberOfMessages":10,"VisibilityTimeout":0}`)
+		messages, _ := resp["Messages"].([]interface{})
+		if status != http.StatusOK || len(messages) != 2 {
+			t.Fatalf("Expected to receive 2 messages, got %d %v", status, resp)
+		}
+		if body := messages[0].(map[string]interface{})["Body"]; body != "value for item 1" {
+			t.Errorf("Expected to receive item 1 first, got %v", body)
+		}
+	}
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+}
@@ -3,23 +3,41 @@ package goque
 import (
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 // Stack is a standard LIFO (last in, first out) stack.
 type Stack struct {
 	sync.RWMutex
-	DataDir string
-	db      *leveldb.DB
-	head    uint64
-	tail    uint64
-	isOpen  bool
+	DataDir  string
+	db       Store
+	head     uint64
+	tail     uint64
+	removed  removedIDs
+	format   uint8
+	seal     valueSeal
+	bounds   *bounds
+	compact  *compaction
+	counters Counters
+	log      *logger
+	hooks    Hooks
+	wo       *opt.WriteOptions
+	durable  Durability
+	isOpen   bool
 }
 
 // OpenStack opens a stack if one exists at the given directory. If one
 // does not already exist, a new stack is created.
 func OpenStack(dataDir string) (*Stack, error) {
+	return OpenStackWithOptions(dataDir, nil)
+}
+
+// OpenStackWithOptions is like OpenStack, but opens the LevelDB
+// database using the given options.
+func OpenStackWithOptions(dataDir string, o *opt.Options) (*Stack, error) {
 	var err error
 
 	// Create a new Stack.
@@ -32,7 +50,7 @@ func OpenStack(dataDir string) (*Stack, error) {
 	}
 
 	// Open database for the stack.
-	s.db, err = leveldb.OpenFile(dataDir, nil)
+	s.db, err = leveldb.OpenFile(dataDir, o)
 	if err != nil {
 		return s, err
 	}
@@ -46,79 +64,329 @@ func OpenStack(dataDir string) (*Stack, error) {
 		return s, ErrIncompatibleType
 	}
 
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, s.db, goqueStack); err != nil {
+		return s, err
+	}
+
+	// Get the on-disk format of the item values.
+	if s.format, err = goqueFormat(dataDir); err != nil {
+		return s, err
+	}
+	if s.format > formatEnvelope {
+		return s, ErrUnsupportedFormat
+	}
+
 	// Set isOpen and return.
 	s.isOpen = true
 	return s, s.init()
 }
 
+// OpenStackWithStore opens a stack kept in the given store, such as one
+// of another storage engine. The store is closed along with the stack.
+//
+// dataDir is the path of the store's data, removed by Drop. It may be
+// a single file, so no 'GOQUE' file is kept there, and the store must
+// only be used for this stack. Item values are stored as is, so the
+// headers and timestamps of items are not persisted.
+func OpenStackWithStore(dataDir string, store Store) (*Stack, error) {
+	// Create a new Stack.
+	s := &Stack{
+		DataDir: dataDir,
+		db:      store,
+		head:    0,
+		tail:    0,
+		isOpen:  true,
+	}
+
+	return s, s.init()
+}
+
 // Push adds an item to the stack.
 func (s *Stack) Push(item *Item) error {
+	start := time.Now()
 	s.Lock()
 	defer s.Unlock()
+	defer s.log.timed("push", start)
 
-	// Set item ID and key.
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	// Make sure the item fits.
+	if err := s.bounds.checkValue(uint64(len(item.Value))); err != nil {
+		return err
+	}
+	if err := s.makeRoom(1, uint64(len(item.Value))); err != nil {
+		return err
+	}
+
+	// Set item ID, key and timestamps.
 	item.ID = s.head + 1
 	item.Key = idToKey(item.ID)
+	stampItem(s.format, item)
 
 	// Add it to the stack.
-	err := s.db.Put(item.Key, item.Value, nil)
+	value, err := encodeItemValue(s.format, s.seal, item.Key, item)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, value)
+	err = s.writeMeta(batch, s.head+1, s.tail)
 	if err == nil {
 		s.head++
+		s.bounds.add(uint64(len(item.Value)))
+		s.counters.Enqueued++
+		fireItem(s.hooks.OnEnqueue, item)
 	}
 
 	return err
 }
 
-// Pop removes the next item in the stack and returns it.
+// PushBatch adds the given items to the stack using a single LevelDB
+// batch, so either all of them are added or none are. The last item
+// ends up on top of the stack. It returns the IDs assigned to the
+// items, in the same order.
+func (s *Stack) PushBatch(items []*Item) ([]uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Make sure the items fit.
+	for _, item := range items {
+		if err := s.bounds.checkValue(uint64(len(item.Value))); err != nil {
+			return nil, err
+		}
+	}
+	size := itemsSize(items)
+	if err := s.makeRoom(uint64(len(items)), size); err != nil {
+		return nil, err
+	}
+
+	// Set the item IDs and keys.
+	ids := make([]uint64, len(items))
+	batch := new(leveldb.Batch)
+	for i, item := range items {
+		item.ID = s.head + uint64(i) + 1
+		item.Key = idToKey(item.ID)
+		stampItem(s.format, item)
+		value, err := encodeItemValue(s.format, s.seal, item.Key, item)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(item.Key, value)
+		ids[i] = item.ID
+	}
+
+	// Add them to the stack.
+	if err := s.writeMeta(batch, s.head+uint64(len(items)), s.tail); err != nil {
+		return nil, err
+	}
+	s.head += uint64(len(items))
+	s.bounds.add(size)
+	s.counters.Enqueued += uint64(len(items))
+	fireItem(s.hooks.OnEnqueue, items...)
+
+	return ids, nil
+}
+
+// Pop removes the next item in the stack and returns it. As with
+// PriorityQueue.Dequeue, the item is deleted in a single write before it
+// is returned, and never returned together with an error.
 func (s *Stack) Pop() (*Item, error) {
+	start := time.Now()
 	s.Lock()
 	defer s.Unlock()
 
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	// Try to get the next item in the stack.
 	item, err := s.getItemByID(s.head)
 	if err != nil {
-		return item, err
+		return nil, err
 	}
 
 	// Remove this item from the stack.
-	if err := s.db.Delete(item.Key, nil); err != nil {
-		return item, err
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	head, tail := s.trimmed(s.head-1, s.tail)
+	if err := s.writeMeta(batch, head, tail); err != nil {
+		return nil, err
 	}
 
 	// Decrement position.
 	s.head--
+	s.trim()
+	s.bounds.remove(uint64(len(item.Value)))
+	s.compact.deleted(s.db, s.log, 1, uint64(len(item.Value)))
+	s.counters.Dequeued++
+	s.counters.dequeue(start)
+	fireItem(s.hooks.OnDequeue, item)
+	s.log.timed("pop", start)
 
 	return item, nil
 }
 
+// PopBatch removes up to n items from the top of the stack and returns
+// them in pop order, deleting them in a single LevelDB batch. If the
+// stack is empty, ErrEmpty is returned.
+func (s *Stack) PopBatch(n int) ([]*Item, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var items []*Item
+	_, err := s.DrainTo(ItemWriterFunc(func(batch []*Item) (int, error) {
+		items = batch
+		return len(batch), nil
+	}), n)
+	if err != nil {
+		return nil, err
+	} else if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return items, nil
+}
+
 // Peek returns the next item in the stack without removing it.
 func (s *Stack) Peek() (*Item, error) {
 	s.RLock()
 	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return s.getItemByID(s.head)
 }
 
+// PeekBottom returns the item at the bottom of the stack, which would
+// be popped last, without removing it.
+func (s *Stack) PeekBottom() (*Item, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return s.getItemByID(s.tail + 1)
+}
+
 // PeekByOffset returns the item located at the given offset,
 // starting from the head of the stack, without removing it.
 func (s *Stack) PeekByOffset(offset uint64) (*Item, error) {
 	s.RLock()
 	defer s.RUnlock()
-	return s.getItemByID(s.head - offset)
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return s.getItemByID(s.removed.before(s.head, offset))
 }
 
 // PeekByID returns the item with the given ID without removing it.
 func (s *Stack) PeekByID(id uint64) (*Item, error) {
 	s.RLock()
 	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
 	return s.getItemByID(id)
 }
 
+// PeekByIDs returns the items with the given IDs without removing them,
+// fetching all of them in a single pass. The returned slice is in the
+// same order as ids and contains nil for any ID not currently in the
+// stack.
+func (s *Stack) PeekByIDs(ids []uint64) ([]*Item, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Collect the keys of the IDs within range in ascending order.
+	var keys [][]byte
+	var indexes []int
+	for _, i := range sortedIndexes(ids) {
+		if ids[i] > s.tail && ids[i] <= s.head {
+			keys = append(keys, idToKey(ids[i]))
+			indexes = append(indexes, i)
+		}
+	}
+
+	// Fetch all of the values at once.
+	values, err := multiGet(s.db, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, len(ids))
+	for j, i := range indexes {
+		if values[j] != nil {
+			items[i] = &Item{ID: ids[i], Key: keys[j]}
+			if err = decodeItemValue(s.format, s.seal, items[i], values[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return items, nil
+}
+
 // Update updates an item in the stack without changing its position.
+// The headers of the item are stored as they are set on it, and its
+// update time is set to the current time.
 func (s *Stack) Update(item *Item, newValue []byte) error {
 	s.Lock()
 	defer s.Unlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	if err := s.bounds.checkValue(uint64(len(newValue))); err != nil {
+		return err
+	}
+
+	oldSize := uint64(len(item.Value))
 	item.Value = newValue
-	return s.db.Put(item.Key, item.Value, nil)
+	if s.format != formatRaw {
+		item.UpdatedAt = time.Now()
+	}
+	value, err := encodeItemValue(s.format, s.seal, item.Key, item)
+	if err != nil {
+		return err
+	}
+	if err = s.db.Put(item.Key, value, s.wo); err != nil {
+		return err
+	}
+
+	s.bounds.remove(oldSize)
+	s.bounds.add(uint64(len(newValue)))
+
+	return nil
 }
 
 // UpdateString is a helper function for Update that accepts a value
@@ -129,24 +397,68 @@ func (s *Stack) UpdateString(item *Item, newValue string) error {
 
 // Length returns the total number of items in the stack.
 func (s *Stack) Length() uint64 {
-	return s.head - s.tail
+	return s.head - s.tail - uint64(len(s.removed))
 }
 
-// Close closes the LevelDB database of the stack.
-func (s *Stack) Close() {
+// Close closes the LevelDB database of the stack. Once closed, every
+// operation on the stack returns ErrDBClosed.
+func (s *Stack) Close() error {
+	_, err := s.closeIf(nil)
+	return err
+}
+
+// closeIf closes the stack like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the stack in
+// between. If check fails, the stack is left as it is and the error is
+// returned. closeIf reports whether the stack is closed.
+func (s *Stack) closeIf(check func() error) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
 	// If stack is already closed.
 	if !s.isOpen {
-		return
+		return true, nil
 	}
-
-	s.db.Close()
 	s.isOpen = false
+
+	// Wake anything waiting for space.
+	s.bounds.wake()
+
+	// Sync the writes of a batched stack.
+	var err error
+	if s.durable == DurabilityBatched {
+		err = syncDB(s.db)
+	}
+
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+
+	return true, err
+}
+
+// Drop closes and deletes the LevelDB database of the stack, as long
+// as it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (s *Stack) Drop() error {
+	return dropIf(s.DataDir, s.closeIf, checkEmpty(s.Length))
 }
 
-// Drop closes and deletes the LevelDB database of the stack.
-func (s *Stack) Drop() {
-	s.Close()
-	os.RemoveAll(s.DataDir)
+// ForceDrop closes and deletes the LevelDB database of the stack,
+// along with any items it still holds.
+func (s *Stack) ForceDrop() error {
+	err := s.Close()
+	if rerr := os.RemoveAll(s.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
 }
 
 // getItemByID returns an item, if found, for the given ID.
@@ -158,32 +470,99 @@ func (s *Stack) getItemByID(id uint64) (*Item, error) {
 		return nil, ErrOutOfBounds
 	}
 
-	var err error
 	item := &Item{ID: id, Key: idToKey(id)}
-	item.Value, err = s.db.Get(item.Key, nil)
+	data, err := s.db.Get(item.Key, nil)
+	if err != nil {
+		return item, err
+	}
 
-	return item, err
+	return item, decodeItemValue(s.format, s.seal, item, data)
 }
 
 // init initializes the stack data.
 func (s *Stack) init() error {
+	s.log = openLogger()
+
+	// Use the persisted positions, if any, and otherwise find them by
+	// scanning the stack.
+	loaded, err := s.loadMeta()
+	if err != nil {
+		return err
+	} else if !loaded {
+		if s.head, s.tail, err = scanEnds(s.db); err != nil {
+			return err
+		}
+		if s.head > s.tail {
+			s.log.warn("goque: Rebuilt the positions of a stack", "dir", s.DataDir, "items", s.head-s.tail)
+		}
+
+		// Persist the positions found, so the next open doesn't have to
+		// scan the stack again.
+		if err = s.writeMeta(new(leveldb.Batch), s.head, s.tail); err != nil {
+			return err
+		}
+	}
+
+	// Load the IDs of the items removed from the middle of the stack.
+	keys, err := loadRemoved(s.db, s.wo, func(key []byte) bool {
+		if len(key) != 8 {
+			return false
+		}
+
+		id := keyToID(key)
+		return id > s.tail+1 && id < s.head
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		s.removed = append(s.removed, keyToID(key))
+	}
+
+	return nil
+}
+
+// scanEnds returns the IDs of the last item in the store and of the one
+// before the first item, which are the head and tail of a stack or the
+// tail and head of a queue.
+func scanEnds(db Store) (uint64, uint64, error) {
 	// Create a new LevelDB Iterator.
-	iter := s.db.NewIterator(nil, nil)
+	iter := db.NewIterator(nil, nil)
 	defer iter.Release()
 
-	// Set stack head to the last item.
-	if iter.Last() {
-		s.head = keyToID(iter.Key())
+	// Find the last item, passing the keys Goque keeps after the items,
+	// which all start with the same prefix.
+	ok := iter.Seek(goquePrefix)
+	if ok {
+		ok = iter.Prev()
 	} else {
-		s.head = 0
+		ok = iter.Last()
+	}
+	for ok && len(iter.Key()) != 8 {
+		ok = iter.Prev()
 	}
+	if !ok {
+		return 0, 0, iter.Error()
+	}
+	last := keyToID(iter.Key())
 
-	// Set stack tail to the first item.
-	if iter.First() {
-		s.tail = keyToID(iter.Key()) - 1
-	} else {
-		s.tail = 0
+	// Find the first item.
+	if !iter.First() {
+		return 0, 0, iter.Error()
 	}
 
-	return iter.Error()
+	return last, keyToID(iter.Key()) - 1, iter.Error()
+}
+
+// trim moves the top and bottom of the stack past any removed IDs, so
+// the items at both ends of the stack are never removed ones.
+func (s *Stack) trim() {
+	s.removed = s.removed.trim(&s.tail, &s.head)
+}
+
+// trimmed returns the given top and bottom of the stack moved past any
+// removed IDs, as trim would leave them.
+func (s *Stack) trimmed(head, tail uint64) (uint64, uint64) {
+	s.removed.trim(&tail, &head)
+	return head, tail
 }
@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 func TestStackDrop(t *testing.T) {
@@ -25,13 +27,72 @@ func TestStackDrop(t *testing.T) {
 	}
 }
 
+func TestStackClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Push(NewItemString("value")); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Push, got %v", err)
+	}
+
+	if _, err = s.Pop(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Pop, got %v", err)
+	}
+
+	if _, err = s.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error on Peek, got %v", err)
+	}
+
+	// Closing again is a no-op.
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.ForceDrop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err == nil {
+		t.Error("Expected directory for test database to have been deleted")
+	}
+}
+
+func TestStackWithOptions(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStackWithOptions(file, &opt.Options{WriteBuffer: 1 << 20})
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+	s.Close()
+
+	if _, err = OpenStackWithOptions(file, &opt.Options{ErrorIfExist: true}); err == nil {
+		t.Error("Expected an error opening an existing stack with ErrorIfExist")
+	}
+}
+
 func TestStackIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer pq.Drop()
+	defer pq.ForceDrop()
 	pq.Close()
 
 	if _, err = OpenStack(file); err != ErrIncompatibleType {
@@ -45,7 +106,7 @@ func TestStackPush(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -65,7 +126,7 @@ func TestStackPop(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -100,7 +161,7 @@ func TestStackPeek(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	compStr := "value for item"
 
@@ -122,13 +183,46 @@ func TestStackPeek(t *testing.T) {
 	}
 }
 
+func TestStackPeekBottom(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if _, err = s.PeekBottom(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	peekItem, err := s.PeekBottom()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", s.Length())
+	}
+}
+
 func TestStackPeekByOffset(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -179,7 +273,7 @@ func TestStackPeekByID(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -204,13 +298,139 @@ func TestStackPeekByID(t *testing.T) {
 	}
 }
 
+func TestStackPeekByIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		item := NewItemString(fmt.Sprintf("value for item %d", i))
+		if err = s.Push(item); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := s.PeekByIDs([]uint64{7, 2, 11, 5})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, id := range []uint64{7, 2} {
+		compStr := fmt.Sprintf("value for item %d", id)
+		if items[i].ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, items[i].ToString())
+		}
+	}
+
+	if items[2] != nil {
+		t.Error("Expected item for out of range ID to be nil")
+	}
+
+	if items[3].ID != 5 {
+		t.Errorf("Expected item ID to be 5, got %d", items[3].ID)
+	}
+}
+
+func TestStackPushBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	ids, err := s.PushBatch([]*Item{
+		NewItemString("value for item 1"),
+		NewItemString("value for item 2"),
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Errorf("Expected IDs to be [2 3], got %v", ids)
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	item, err := s.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestStackPopBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 5; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := s.PopBatch(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", 5-i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 2 {
+		t.Errorf("Expected stack length of 2, got %d", s.Length())
+	}
+
+	if items, err = s.PopBatch(10); err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("Expected 2 items, got %d", len(items))
+	}
+
+	if _, err = s.PopBatch(1); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
 func TestStackUpdate(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -255,7 +475,7 @@ func TestStackUpdateString(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	for i := 1; i <= 10; i++ {
 		item := NewItemString(fmt.Sprintf("value for item %d", i))
@@ -294,13 +514,89 @@ func TestStackUpdateString(t *testing.T) {
 	}
 }
 
+func TestStackMetadata(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	item := NewItemString("value for item")
+	item.Headers = map[string]string{"correlation-id": "abc123"}
+	if err = s.Push(item); err != nil {
+		t.Error(err)
+	}
+	created := item.CreatedAt
+
+	// Reopen the stack, which should keep the metadata.
+	s.Close()
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item, err = s.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(item.Headers) != 1 || item.Headers["correlation-id"] != "abc123" {
+		t.Errorf("Expected the headers to be kept, got %v", item.Headers)
+	}
+	if created.IsZero() || !item.CreatedAt.Equal(created) || !item.UpdatedAt.Equal(created) {
+		t.Errorf("Expected creation and update times of %v, got %v and %v", created, item.CreatedAt, item.UpdatedAt)
+	}
+
+	// Updating the item only changes its update time.
+	if err = s.UpdateString(item, "new value"); err != nil {
+		t.Error(err)
+	}
+
+	item, err = s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "new value" || item.Headers["correlation-id"] != "abc123" {
+		t.Errorf("Expected 'new value' with its headers, got '%s' with %v", item.ToString(), item.Headers)
+	}
+	if !item.CreatedAt.Equal(created) || !item.UpdatedAt.After(created) {
+		t.Errorf("Expected creation time of %v and a later update time, got %v and %v", created, item.CreatedAt, item.UpdatedAt)
+	}
+}
+
+func TestStackPopFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	if err = s.Push(NewItemString("value for item")); err != nil {
+		t.Error(err)
+	}
+
+	// A failed delete must not hand out the item.
+	db := s.db
+	s.db = failDeleteStore{db}
+	item, err := s.Pop()
+	if item != nil || err != errDeleteFailed {
+		t.Errorf("Expected no item and the delete error, got %v and %v", item, err)
+	}
+	s.db = db
+
+	if s.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", s.Length())
+	}
+}
+
 func TestStackEmpty(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	err = s.Push(NewItemString("value for item"))
 	if err != nil {
@@ -324,7 +620,7 @@ func TestStackOutOfBounds(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	err = s.Push(NewItemString("value for item"))
 	if err != nil {
@@ -344,7 +640,7 @@ func BenchmarkStackPush(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	// Create dummy data for pushing
 	item := NewItemString("value")
@@ -357,6 +653,27 @@ func BenchmarkStackPush(b *testing.B) {
 	}
 }
 
+func BenchmarkStackPushBatch(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		b.Error(err)
+	}
+	defer s.ForceDrop()
+
+	// Create dummy data for pushing
+	items := make([]*Item, b.N)
+	for n := range items {
+		items[n] = NewItemString("value")
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	_, _ = s.PushBatch(items)
+}
+
 func BenchmarkStackPop(b *testing.B) {
 	// Open test database
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
@@ -364,7 +681,7 @@ func BenchmarkStackPop(b *testing.B) {
 	if err != nil {
 		b.Error(err)
 	}
-	defer s.Drop()
+	defer s.ForceDrop()
 
 	// Fill with dummy data
 	item := NewItemString("value")
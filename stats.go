@@ -0,0 +1,247 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Sizer is implemented by a Store that can estimate the on-disk size of
+// ranges of its keys, which DiskUsage needs. The LevelDB database
+// implements it.
+type Sizer interface {
+	SizeOf(ranges []util.Range) (leveldb.Sizes, error)
+}
+
+// Stats describes the contents of a data structure and its store.
+type Stats struct {
+	// Length is the number of items.
+	Length uint64
+
+	// Levels is the number of items in each priority level that
+	// contains items, in the order they would be dequeued. It is only
+	// set for priority queues.
+	Levels []LevelLength
+
+	// DiskUsage is the approximate on-disk size of the store in bytes,
+	// as returned by DiskUsage, or -1 if the store can't estimate it.
+	DiskUsage int64
+
+	// LevelDB holds the internal statistics of the LevelDB database,
+	// or nil if the store is not one.
+	LevelDB *leveldb.DBStats
+
+	// Counters counts the operations since the data structure was
+	// opened. It is only set for priority queues and stacks.
+	Counters Counters
+
+	// Next is the creation time of the item that would be dequeued
+	// next, or zero if there is none or its creation time isn't known.
+	// It is only set for priority queues and stacks.
+	Next time.Time
+}
+
+// Counters counts the operations on a priority queue or stack since it
+// was opened.
+type Counters struct {
+	// Enqueued is the number of items added, including the ones put
+	// back by Requeue, by releasing a lease or by a channel stream.
+	Enqueued uint64
+
+	// Dequeued is the number of items removed by dequeuing or popping
+	// them, including by DrainTo, Reserve and transactions. Items
+	// dropped by a capacity, removed by ID or cleared are not counted.
+	Dequeued uint64
+
+	// Trimmed is the number of items discarded by the retention policy.
+	// It is only counted for priority queues.
+	Trimmed uint64
+
+	// Dequeues is the number of calls to Dequeue, DequeueByPriority or
+	// Pop that returned an item, and DequeueTime the total time they
+	// took, including waiting for the lock.
+	Dequeues    uint64
+	DequeueTime time.Duration
+}
+
+// dequeue records a call returning an item that started at the given
+// time.
+func (c *Counters) dequeue(start time.Time) {
+	c.Dequeues++
+	c.DequeueTime += time.Since(start)
+}
+
+// DiskUsage returns the approximate on-disk size of the priority
+// queue's store in bytes. Recent writes still held in memory by the
+// store are not counted.
+func (pq *PriorityQueue) DiskUsage() (int64, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return storeSize(pq.db)
+}
+
+// Stats returns the number of items in the priority queue and in each
+// of its priority levels, its operation counters and the creation time
+// of its next item, along with the statistics of its store.
+func (pq *PriorityQueue) Stats() (*Stats, error) {
+	pq.readLock()
+	defer pq.readUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	stats, err := storeStats(pq.db, pq.Length())
+	if err != nil {
+		return nil, err
+	}
+	stats.Levels = pq.levelLengths()
+	stats.Counters = pq.counters
+
+	// Get the next item without moving the current priority level,
+	// which would need the write lock.
+	if len(stats.Levels) > 0 {
+		priority := stats.Levels[0].Priority
+		item, err := pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+		if err != nil {
+			return nil, err
+		}
+		stats.Next = item.CreatedAt
+	}
+
+	return stats, nil
+}
+
+// DiskUsage returns the approximate on-disk size of the stack's store
+// in bytes, the same way as PriorityQueue.DiskUsage.
+func (s *Stack) DiskUsage() (int64, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return storeSize(s.db)
+}
+
+// Stats returns the number of items in the stack, its operation
+// counters and the creation time of its top item, along with the
+// statistics of its store.
+func (s *Stack) Stats() (*Stats, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// If the stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	stats, err := storeStats(s.db, s.Length())
+	if err != nil {
+		return nil, err
+	}
+	stats.Counters = s.counters
+
+	if s.Length() > 0 {
+		item, err := s.getItemByID(s.head)
+		if err != nil {
+			return nil, err
+		}
+		stats.Next = item.CreatedAt
+	}
+
+	return stats, nil
+}
+
+// DiskUsage returns the approximate on-disk size of the queue's LevelDB
+// database in bytes, the same way as PriorityQueue.DiskUsage.
+func (q *Queue) DiskUsage() (int64, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return storeSize(q.db)
+}
+
+// Stats returns the number of items in the queue, along with the
+// statistics of its LevelDB database.
+func (q *Queue) Stats() (*Stats, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// If the queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return storeStats(q.db, q.Length())
+}
+
+// storeSize returns the approximate on-disk size of every key in the
+// store, returning ErrSizeUnsupported if the store can't estimate it.
+func storeSize(db Store) (int64, error) {
+	sizer, ok := db.(Sizer)
+	if !ok {
+		return 0, ErrSizeUnsupported
+	}
+
+	// Find the range covering every key.
+	iter := db.NewIterator(nil, nil)
+	var r util.Range
+	ok = iter.First()
+	if ok {
+		r.Start = append([]byte{}, iter.Key()...)
+		if ok = iter.Last(); ok {
+			r.Limit = append(append([]byte{}, iter.Key()...), 0)
+		}
+	}
+	err := iter.Error()
+	iter.Release()
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	sizes, err := sizer.SizeOf([]util.Range{r})
+	if err != nil {
+		return 0, err
+	}
+
+	return sizes.Sum(), nil
+}
+
+// storeStats returns the statistics of the store of a data structure
+// holding the given number of items.
+func storeStats(db Store, length uint64) (*Stats, error) {
+	stats := &Stats{Length: length}
+
+	size, err := storeSize(db)
+	if err == ErrSizeUnsupported {
+		size = -1
+	} else if err != nil {
+		return nil, err
+	}
+	stats.DiskUsage = size
+
+	if ldb, ok := db.(*leveldb.DB); ok {
+		stats.LevelDB = new(leveldb.DBStats)
+		if err := ldb.Stats(stats.LevelDB); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
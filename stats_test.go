@@ -0,0 +1,165 @@
+package goque
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	// An empty priority queue uses no space.
+	size, err := pq.DiskUsage()
+	if err != nil {
+		t.Error(err)
+	}
+	if size != 0 {
+		t.Errorf("Expected disk usage of 0, got %d", size)
+	}
+
+	value := strings.Repeat("x", 1000)
+	for i := 1; i <= 100; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(value, uint8(i%2))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Compacting writes the items out to tables.
+	if err = pq.Compact(); err != nil {
+		t.Error(err)
+	}
+	if size, err = pq.DiskUsage(); err != nil {
+		t.Error(err)
+	}
+	if size == 0 {
+		t.Error("Expected disk usage above 0")
+	}
+
+	stats, err := pq.Stats()
+	if err != nil {
+		t.Error(err)
+	}
+	if stats.Length != 100 || stats.DiskUsage != size || stats.LevelDB == nil {
+		t.Errorf("Expected length 100, disk usage %d and LevelDB stats, got %d, %d and %v", size, stats.Length, stats.DiskUsage, stats.LevelDB)
+	}
+	if len(stats.Levels) != 2 || stats.Levels[0] != (LevelLength{Priority: 0, Length: 50}) {
+		t.Errorf("Expected 50 items in each of 2 levels, got %v", stats.Levels)
+	}
+
+	// A store that can't estimate its size reports it.
+	pq.db = struct{ Store }{pq.db}
+	if _, err = pq.DiskUsage(); err != ErrSizeUnsupported {
+		t.Errorf("Expected to get size unsupported error, got %v", err)
+	}
+	if stats, err = pq.Stats(); err != nil {
+		t.Error(err)
+	}
+	if stats.DiskUsage != -1 || stats.LevelDB != nil {
+		t.Errorf("Expected disk usage of -1 without LevelDB stats, got %d and %v", stats.DiskUsage, stats.LevelDB)
+	}
+}
+
+func TestStackStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = s.Push(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	stats, err := s.Stats()
+	if err != nil {
+		t.Error(err)
+	}
+	if stats.Length != 10 || stats.Levels != nil || stats.LevelDB == nil {
+		t.Errorf("Expected length 10 and LevelDB stats, got %d and %v", stats.Length, stats.LevelDB)
+	}
+
+	s.Close()
+
+	if _, err = s.Stats(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+	if _, err = s.DiskUsage(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = q.Enqueue(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = q.Compact(); err != nil {
+		t.Error(err)
+	}
+
+	stats, err := q.Stats()
+	if err != nil {
+		t.Error(err)
+	}
+	if stats.Length != 10 || stats.DiskUsage <= 0 {
+		t.Errorf("Expected length 10 and disk usage above 0, got %d and %d", stats.Length, stats.DiskUsage)
+	}
+}
+
+func TestPriorityQueueCounters(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueBatch([]*PriorityItem{NewPriorityItemString("value 1", 0), NewPriorityItemString("value 2", 1)}); err != nil {
+		t.Error(err)
+	}
+	if err = pq.Enqueue(NewPriorityItemString("value 3", 1)); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.DequeueBatch(1); err != nil {
+		t.Error(err)
+	}
+
+	stats, err := pq.Stats()
+	if err != nil {
+		t.Error(err)
+	}
+	c := stats.Counters
+	if c.Enqueued != 3 || c.Dequeued != 2 || c.Dequeues != 1 || c.DequeueTime <= 0 {
+		t.Errorf("Expected 3 enqueued, 2 dequeued and 1 timed dequeue, got %+v", c)
+	}
+
+	// The next item is the one left in priority level 1.
+	item, err := pq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if !stats.Next.Equal(item.CreatedAt) {
+		t.Errorf("Expected next creation time %v, got %v", item.CreatedAt, stats.Next)
+	}
+}
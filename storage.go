@@ -0,0 +1,113 @@
+package goque
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store is the key/value storage a priority queue or stack keeps its
+// items in. It is the subset of the LevelDB API Goque uses, so a
+// *leveldb.DB is a Store, and other storage engines can be used by
+// implementing it.
+//
+// Get must return leveldb.ErrNotFound for a missing key. Write must
+// apply the whole batch atomically, and iterators must see a consistent
+// snapshot of the store, iterating keys in bytewise order. A write with
+// Sync set must be durable before it returns.
+type Store interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Delete(key []byte, wo *opt.WriteOptions) error
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Close() error
+}
+
+// StoreSnapshot is a read-only view of a store, frozen at the time it
+// was taken. Like the iterators of a Store, it must be released once it
+// is no longer needed.
+type StoreSnapshot interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Release()
+}
+
+// Snapshotter is implemented by a Store that can take snapshots, which
+// PriorityQueue.Snapshot needs. The LevelDB database takes snapshots
+// without implementing it.
+type Snapshotter interface {
+	Snapshot() (StoreSnapshot, error)
+}
+
+// MultiGetter is implemented by a Store that can fetch the values of
+// many keys at once, such as within a single read transaction, which
+// the batch lookups of priority queues, queues and stacks then use
+// instead of stepping an iterator through the keys. The keys are sorted
+// in ascending order, and MultiGet returns their values in the same
+// order, with nil for any key not found and an empty slice for an empty
+// value.
+type MultiGetter interface {
+	MultiGet(keys [][]byte) ([][]byte, error)
+}
+
+// The LevelDB database is the default Store.
+var (
+	_ Store         = (*leveldb.DB)(nil)
+	_ StoreSnapshot = (*leveldb.Snapshot)(nil)
+)
+
+// takeSnapshot takes a snapshot of the given store, returning
+// ErrSnapshotUnsupported if it can't take one.
+func takeSnapshot(db Store) (StoreSnapshot, error) {
+	switch s := db.(type) {
+	case *leveldb.DB:
+		return s.GetSnapshot()
+	case Snapshotter:
+		return s.Snapshot()
+	}
+
+	return nil, ErrSnapshotUnsupported
+}
+
+// multiGet fetches the values of many keys using the MultiGet of the
+// store if it has one, or else a single iterator, stepping or seeking
+// forward from one key to the next instead of performing an independent
+// Get for each key.
+//
+// The keys must be sorted in ascending order. The returned slice is in
+// the same order as keys and contains nil for any key not found.
+func multiGet(db Store, keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	if mg, ok := db.(MultiGetter); ok {
+		return mg.MultiGet(keys)
+	}
+
+	// Create a new LevelDB Iterator.
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	for i, key := range keys {
+		// Batch lookups are usually for neighbouring keys, so try
+		// stepping to the next key before falling back to a seek.
+		if !iter.Valid() || bytes.Compare(iter.Key(), key) < 0 {
+			if !iter.Next() || bytes.Compare(iter.Key(), key) < 0 {
+				iter.Seek(key)
+			}
+		}
+
+		// Copy the value if the iterator landed on this key.
+		if iter.Valid() && bytes.Equal(iter.Key(), key) {
+			values[i] = make([]byte, len(iter.Value()))
+			copy(values[i], iter.Value())
+		}
+	}
+
+	return values, iter.Error()
+}
@@ -0,0 +1,100 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestMultiGet(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	for i := 1; i <= 10; i++ {
+		if err = q.Enqueue(NewItemString(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Store an empty value to make sure it is not treated as missing.
+	if err = q.Enqueue(NewItem([]byte{})); err != nil {
+		t.Error(err)
+	}
+
+	keys := [][]byte{idToKey(0), idToKey(1), idToKey(2), idToKey(5), idToKey(5), idToKey(11), idToKey(12)}
+	values, err := multiGet(q.db, keys)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i, id := range []uint64{0, 1, 2, 5, 5, 11, 12} {
+		want, err := q.db.Get(idToKey(id), nil)
+		if err == leveldb.ErrNotFound {
+			if values[i] != nil {
+				t.Errorf("Expected value for ID %d to be nil, got '%s'", id, values[i])
+			}
+			continue
+		}
+
+		if values[i] == nil || string(values[i]) != string(want) {
+			t.Errorf("Expected value for ID %d to be '%s', got '%s'", id, want, values[i])
+		}
+	}
+}
+
+// multiGetStore is a Store counting the calls to its MultiGet.
+type multiGetStore struct {
+	Store
+	calls int
+}
+
+func (s *multiGetStore) MultiGet(keys [][]byte) ([][]byte, error) {
+	s.calls++
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, err := s.Get(key, nil)
+		if err == nil {
+			values[i] = value
+		} else if err != leveldb.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func TestMultiGetMultiGetter(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	if err = q.Enqueue(NewItemString("value")); err != nil {
+		t.Error(err)
+	}
+
+	// The MultiGet of the store is used in place of an iterator.
+	store := &multiGetStore{Store: q.db}
+	values, err := multiGet(store, [][]byte{idToKey(1), idToKey(2)})
+	if err != nil {
+		t.Error(err)
+	}
+	if store.calls != 1 {
+		t.Errorf("Expected 1 call to MultiGet, got %d", store.calls)
+	}
+	want, err := q.db.Get(idToKey(1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 2 || string(values[0]) != string(want) || values[1] != nil {
+		t.Errorf("Expected the stored value and nil, got %q", values)
+	}
+}
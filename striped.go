@@ -0,0 +1,197 @@
+package goque
+
+import (
+	"errors"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// errLevelChanged is returned by takeHead when another operation changed
+// the next priority level to dequeue from, so it must be found again.
+var errLevelChanged = errors.New("goque: Next priority level changed")
+
+// readLock locks the priority queue for reading, holding the read lock
+// and the state lock.
+//
+// Enqueue, Dequeue and DequeueByPriority only hold the read lock of the
+// priority queue, along with the lock of the priority level they work
+// on, so operations on different levels write to the store at the same
+// time. The state shared between the levels, which is the positions of
+// every level, the set of active levels, curLevel, the sequence number
+// and the counters, only changes while also holding the state lock, and
+// every other operation reading it holds the read lock and the state
+// lock, using readLock. Operations changing anything else hold the
+// write lock, which waits for every other operation.
+//
+// Features spanning the levels, such as capacity limits, the change log,
+// weights and leases, are kept consistent by the write lock, so while
+// any of them is in use Enqueue and Dequeue take the write lock instead.
+func (pq *PriorityQueue) readLock() {
+	pq.RLock()
+	pq.state.Lock()
+}
+
+// readUnlock undoes a readLock.
+func (pq *PriorityQueue) readUnlock() {
+	pq.state.Unlock()
+	pq.RUnlock()
+}
+
+// striped returns whether Enqueue and Dequeue can hold just the lock of
+// their priority level, which is the case unless a feature spanning the
+// levels is in use. The caller must hold the lock or the read lock.
+func (pq *PriorityQueue) striped() bool {
+	return pq.bounds == nil && pq.changes == nil && pq.fair == nil && !pq.groups &&
+		pq.retention == (Retention{}) && pq.deadline.IsZero()
+}
+
+// enqueueStriped adds the given item to the priority queue holding just
+// the lock of its priority level. It returns false without adding it if
+// the priority queue can't do so, leaving it to enqueue.
+func (pq *PriorityQueue) enqueueStriped(item *PriorityItem) (bool, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return true, ErrDBClosed
+	}
+	if !pq.striped() {
+		return false, nil
+	}
+
+	pq.stripes[item.Priority].Lock()
+	defer pq.stripes[item.Priority].Unlock()
+
+	// Set item ID, key and sequence number. The sequence number is taken
+	// right away, so a failed write leaves a gap, and it is stored under
+	// the key of the level, as enqueues on other levels may be written
+	// before this one.
+	level := pq.levels[item.Priority]
+	item.ID = level.tail + 1
+	item.Key = pq.generateKey(item.Priority, item.ID)
+	batch := new(leveldb.Batch)
+	pq.state.Lock()
+	pq.seq = pq.stampItemsTo(levelSeqKey(item.Priority), pq.seq, batch, item)
+	pq.state.Unlock()
+	if err := pq.putValue(batch, item); err != nil {
+		return true, err
+	}
+
+	// Add it to the priority queue.
+	next := *level
+	next.tail++
+	putLevelMeta(batch, item.Priority, next)
+	if err := pq.db.Write(batch, pq.wo); err != nil {
+		return true, err
+	}
+
+	pq.state.Lock()
+	level.tail++
+	before := pq.active
+	pq.active.set(item.Priority, true)
+	pq.counters.Enqueued++
+	pq.signalAdded(before)
+
+	// If this priority level is more important than the curLevel.
+	if pq.cmpAsc(item.Priority) || pq.cmpDesc(item.Priority) {
+		pq.curLevel = item.Priority
+	}
+	pq.state.Unlock()
+	firePriority(pq.hooks.OnEnqueue, item)
+
+	return true, nil
+}
+
+// dequeueStriped removes the next item in the given priority level, or
+// in the priority queue if anyLevel is set, holding just the lock of its
+// priority level. It returns false without removing an item if the
+// priority queue can't do so, or if the item expired, leaving it to
+// dequeue.
+func (pq *PriorityQueue) dequeueStriped(priority uint8, anyLevel bool, start time.Time) (*PriorityItem, bool, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		return nil, true, ErrDBClosed
+	}
+	if !pq.striped() {
+		return nil, false, nil
+	}
+
+	for {
+		// Find the priority level of the next item.
+		if anyLevel {
+			pq.state.Lock()
+			item, err := pq.getNextItem()
+			pq.state.Unlock()
+			if err != nil {
+				return nil, true, err
+			}
+			priority = item.Priority
+		}
+
+		pq.stripes[priority].Lock()
+		item, ok, err := pq.takeHead(priority, anyLevel, start)
+		pq.stripes[priority].Unlock()
+		if err != errLevelChanged {
+			return item, ok, err
+		}
+	}
+}
+
+// takeHead removes the item at the front of the given priority level and
+// returns it. If anyLevel is set, errLevelChanged is returned when the
+// level is no longer the one to dequeue from. It returns false if the
+// item expired. The caller must hold the read lock and the lock of the
+// level.
+func (pq *PriorityQueue) takeHead(priority uint8, anyLevel bool, start time.Time) (*PriorityItem, bool, error) {
+	pq.state.Lock()
+	var item *PriorityItem
+	var err error
+	if anyLevel {
+		item, err = pq.getNextItem()
+		if err == nil && item.Priority != priority {
+			err = errLevelChanged
+		}
+	} else {
+		item, err = pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+	}
+	if err != nil || item.expired(time.Now()) {
+		pq.state.Unlock()
+		return nil, err != nil, err
+	}
+
+	// Move the head past the item before deleting it, so operations on
+	// other levels never look it up meanwhile, and move it back if the
+	// delete fails. Nothing else moves the head while holding the lock
+	// of the level.
+	level := pq.levels[priority]
+	saved := *level
+	pq.advanceHead(priority, item.ID)
+	next := *level
+	pq.state.Unlock()
+
+	// Remove this item from the priority queue.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	putLevelMeta(batch, priority, next)
+	if err = pq.db.Write(batch, pq.wo); err != nil {
+		pq.state.Lock()
+		*level = saved
+		pq.updateActive(priority)
+		pq.state.Unlock()
+		return nil, true, err
+	}
+
+	pq.state.Lock()
+	pq.compact.deleted(pq.db, pq.log, 1, uint64(len(item.Value)))
+	pq.counters.Dequeued++
+	pq.counters.dequeue(start)
+	pq.state.Unlock()
+	firePriority(pq.hooks.OnDequeue, item)
+
+	return item, true, nil
+}
@@ -0,0 +1,174 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueLevelsDontBlock(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold up an enqueue at priority 200 in its hook, while it is still
+	// holding the lock of its level.
+	entered, release := make(chan struct{}), make(chan struct{})
+	pq.SetHooks(PriorityHooks{OnEnqueue: func(item *PriorityItem) {
+		if item.Priority == 200 {
+			close(entered)
+			<-release
+		}
+	}})
+	done := make(chan error)
+	go func() {
+		_, err := pq.EnqueueString(200, "blocked")
+		done <- err
+	}()
+	<-entered
+
+	// A dequeue at priority 0 goes ahead meanwhile.
+	dequeued := make(chan *PriorityItem)
+	go func() {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		dequeued <- item
+	}()
+	select {
+	case item := <-dequeued:
+		if item != nil && item.ToString() != "value" {
+			t.Errorf("Expected 'value', got '%s'", item.ToString())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the dequeue at priority 0 not to wait for the enqueue at priority 200")
+	}
+
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if pq.LengthByPriority(200) != 1 {
+		t.Errorf("Expected level length of 1, got %d", pq.LengthByPriority(200))
+	}
+}
+
+func TestPriorityQueueConcurrentLevels(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	// A producer and a consumer per priority level.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seqs := make(map[uint64]bool)
+	for p := 0; p < 4; p++ {
+		wg.Add(2)
+		go func(p uint8) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				item, err := pq.EnqueueString(p, fmt.Sprintf("%d-%d", p, i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				if seqs[item.Seq] {
+					t.Errorf("Expected sequence number %d to be assigned once", item.Seq)
+				}
+				seqs[item.Seq] = true
+				mu.Unlock()
+			}
+		}(uint8(p))
+		go func(p uint8) {
+			defer wg.Done()
+			for i := 0; i < 25; {
+				item, err := pq.DequeueByPriority(p)
+				if err == ErrEmpty {
+					continue
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				if want := fmt.Sprintf("%d-%d", p, i); item.ToString() != want {
+					t.Errorf("Expected '%s', got '%s'", want, item.ToString())
+				}
+				i++
+			}
+		}(uint8(p))
+	}
+	wg.Wait()
+
+	stats, err := pq.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Counters.Enqueued != 200 || stats.Counters.Dequeued != 100 {
+		t.Errorf("Expected 200 enqueued and 100 dequeued, got %d and %d", stats.Counters.Enqueued, stats.Counters.Dequeued)
+	}
+
+	// The highest sequence number is found again after reopening, even
+	// though the levels were written in any order.
+	if err = pq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Fatal(err)
+	}
+	if pq.Length() != 100 {
+		t.Errorf("Expected queue length of 100, got %d", pq.Length())
+	}
+	item, err := pq.EnqueueString(9, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Seq != 201 {
+		t.Errorf("Expected sequence number 201, got %d", item.Seq)
+	}
+	if item, err = pq.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "0-25" {
+		t.Errorf("Expected '0-25', got '%s'", item.ToString())
+	}
+}
+
+func TestPriorityQueueStripedFallback(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.ForceDrop()
+
+	if !pq.striped() {
+		t.Error("Expected a plain priority queue to lock by level")
+	}
+	if err = pq.SetCapacity(Capacity{MaxItems: 1, Policy: OverflowError}); err != nil {
+		t.Fatal(err)
+	}
+	if pq.striped() {
+		t.Error("Expected a priority queue with a capacity to lock as a whole")
+	}
+
+	// The capacity is still enforced across the levels.
+	if _, err = pq.EnqueueString(0, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pq.EnqueueString(1, "value"); err != ErrFull {
+		t.Errorf("Expected ErrFull, got %v", err)
+	}
+}
@@ -0,0 +1,520 @@
+package goque
+
+import (
+	"encoding/binary"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// topicMetaKey is the key used to persist the metadata of a topic. The
+// keys of the items and of the consumer group offsets start with a
+// lower byte, so they never collide with it.
+var topicMetaKey = []byte{0xFF}
+
+// The prefixes of the keys of a topic. The items are stored under their
+// offset, and the committed offsets under the name of their consumer
+// group.
+var (
+	topicItemPrefix  = []byte{0x00}
+	topicGroupPrefix = []byte{0x01}
+)
+
+// TopicItem represents an entry in a topic.
+type TopicItem struct {
+	Offset    uint64
+	Timestamp time.Time
+	Value     []byte
+}
+
+// ToString returns the topic item value as a string.
+func (ti *TopicItem) ToString() string {
+	return string(ti.Value)
+}
+
+// Retention is the policy trimming the oldest items of a topic or a
+// priority queue. Items older than MaxAge are trimmed, as are the oldest
+// items once the values of the items add up to more than MaxBytes. A
+// zero field doesn't limit anything, and the zero Retention keeps every
+// item.
+type Retention struct {
+	MaxAge   time.Duration
+	MaxBytes uint64
+}
+
+// Topic is an append-only log where items are not removed when read.
+// Each named consumer group reads the items at its own pace, from the
+// offset it last committed, and can go back to replay them. Items are
+// only removed from the head of the topic by its retention policy.
+//
+// Offsets start at 0 and increase by one with every item appended, and
+// the offset committed by a consumer group is the one of the next item
+// it will read.
+type Topic struct {
+	sync.RWMutex
+	DataDir   string
+	db        *leveldb.DB
+	first     uint64
+	next      uint64
+	bytes     uint64
+	retention Retention
+	isOpen    bool
+}
+
+// OpenTopic opens a topic if one exists at the given directory. If one
+// does not already exist, a new topic is created.
+func OpenTopic(dataDir string) (*Topic, error) {
+	var err error
+
+	// Create a new Topic.
+	t := &Topic{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		isOpen:  false,
+	}
+
+	// Open database for the topic.
+	t.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return t, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goqueTopic)
+	if err != nil {
+		return t, err
+	}
+	if !ok {
+		return t, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, t.db, goqueTopic); err != nil {
+		return t, err
+	}
+
+	// Set isOpen and return.
+	t.isOpen = true
+	return t, t.init()
+}
+
+// SetRetention sets the retention policy of the topic and trims the
+// items it no longer keeps. The policy is applied again after every
+// append. It isn't persisted, so SetRetention should be called right
+// after every open.
+func (t *Topic) SetRetention(r Retention) error {
+	t.Lock()
+	defer t.Unlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return ErrDBClosed
+	}
+
+	t.retention = r
+	_, err := t.trim(time.Now())
+	return err
+}
+
+// Trim applies the retention policy of the topic, returning the number
+// of items trimmed. Age based retention only trims on appends, so Trim
+// can be called periodically for topics that are rarely appended to.
+func (t *Topic) Trim() (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return t.trim(time.Now())
+}
+
+// Append adds an item with the given value to the end of the topic and
+// returns it with its offset and timestamp set.
+func (t *Topic) Append(value []byte) (*TopicItem, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	item := &TopicItem{Offset: t.next, Timestamp: time.Now(), Value: value}
+
+	// Add it to the topic, updating the metadata.
+	batch := new(leveldb.Batch)
+	batch.Put(topicItemKey(item.Offset), encodeTopicItem(item))
+	t.putMeta(batch, t.first, t.next+1, t.bytes+uint64(len(value)))
+	if err := t.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	t.next++
+	t.bytes += uint64(len(value))
+
+	if _, err := t.trim(item.Timestamp); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// AppendString is a helper function for Append that accepts a value as
+// a string rather than a byte slice.
+func (t *Topic) AppendString(value string) (*TopicItem, error) {
+	return t.Append([]byte(value))
+}
+
+// Read returns up to max items of the topic, in order, starting at the
+// given offset. If the item at the offset was already trimmed,
+// ErrOffsetTrimmed is returned. Reading from the end of the topic
+// returns no items.
+func (t *Topic) Read(offset uint64, max int) ([]*TopicItem, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	if offset < t.first {
+		return nil, ErrOffsetTrimmed
+	}
+
+	return t.readItems(offset, max)
+}
+
+// Fetch returns up to max items of the topic, in order, starting at the
+// offset committed by the given consumer group. A group that never
+// committed an offset, or whose offset was trimmed, starts at the head
+// of the topic. Fetch doesn't commit anything, so the group reads the
+// same items again until it commits the offset after them.
+func (t *Topic) Fetch(group string, max int) ([]*TopicItem, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	offset, err := t.getOffset(group)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.readItems(offset, max)
+}
+
+// Commit records the given offset, the one of the next item to read, as
+// the offset of the given consumer group. Committing an offset before
+// the current one rewinds the group, so it replays the items from
+// there. If the offset is past the end of the topic, ErrOutOfBounds is
+// returned.
+func (t *Topic) Commit(group string, offset uint64) error {
+	t.Lock()
+	defer t.Unlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return ErrDBClosed
+	}
+
+	if offset > t.next {
+		return ErrOutOfBounds
+	}
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, offset)
+	return t.db.Put(topicGroupKey(group), data, nil)
+}
+
+// Committed returns the offset of the next item the given consumer
+// group will read, the head of the topic if it never committed one or
+// its offset was trimmed.
+func (t *Topic) Committed(group string) (uint64, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return t.getOffset(group)
+}
+
+// Groups returns the names of the consumer groups that committed an
+// offset, in order.
+func (t *Topic) Groups() ([]string, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	iter := t.db.NewIterator(util.BytesPrefix(topicGroupPrefix), nil)
+	defer iter.Release()
+
+	var groups []string
+	for iter.Next() {
+		groups = append(groups, string(iter.Key()[len(topicGroupPrefix):]))
+	}
+	sort.Strings(groups)
+
+	return groups, iter.Error()
+}
+
+// RemoveGroup deletes the committed offset of the given consumer group.
+func (t *Topic) RemoveGroup(group string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	// If the topic is closed.
+	if !t.isOpen {
+		return ErrDBClosed
+	}
+
+	return t.db.Delete(topicGroupKey(group), nil)
+}
+
+// FirstOffset returns the offset of the oldest item kept by the topic.
+// Once every item is trimmed, it is the same as NextOffset.
+func (t *Topic) FirstOffset() uint64 {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.first
+}
+
+// NextOffset returns the offset the next item appended will get.
+func (t *Topic) NextOffset() uint64 {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.next
+}
+
+// Length returns the number of items kept by the topic.
+func (t *Topic) Length() uint64 {
+	return t.next - t.first
+}
+
+// Close closes the LevelDB database of the topic. Once closed, every
+// operation on the topic returns ErrDBClosed.
+func (t *Topic) Close() error {
+	_, err := t.closeIf(nil)
+	return err
+}
+
+// closeIf closes the topic like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the topic in
+// between. If check fails, the topic is left as it is and the error is
+// returned. closeIf reports whether the topic is closed.
+func (t *Topic) closeIf(check func() error) (bool, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If topic is already closed.
+	if !t.isOpen {
+		return true, nil
+	}
+	t.isOpen = false
+
+	return true, t.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the topic, as long as
+// it holds no items. Otherwise nothing is done and ErrNotEmpty is
+// returned.
+func (t *Topic) Drop() error {
+	return dropIf(t.DataDir, t.closeIf, checkEmpty(t.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the topic, along
+// with any items it still holds.
+func (t *Topic) ForceDrop() error {
+	err := t.Close()
+	if rerr := os.RemoveAll(t.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// trim deletes the items at the head of the topic that the retention
+// policy no longer keeps at now, in batches of up to clearBatchSize,
+// returning how many it deleted. The caller must hold the lock.
+func (t *Topic) trim(now time.Time) (int, error) {
+	r := t.retention
+	if r.MaxAge <= 0 && r.MaxBytes == 0 {
+		return 0, nil
+	}
+	cutoff := now.Add(-r.MaxAge)
+
+	var trimmed int
+	for t.first < t.next {
+		iter := t.db.NewIterator(&util.Range{Start: topicItemKey(t.first), Limit: topicItemKey(t.next)}, nil)
+		batch := new(leveldb.Batch)
+		first, bytes := t.first, t.bytes
+		for batch.Len() < clearBatchSize && iter.Next() {
+			item, err := decodeTopicItem(iter.Key(), iter.Value())
+			if err != nil {
+				iter.Release()
+				return trimmed, err
+			}
+
+			tooOld := r.MaxAge > 0 && item.Timestamp.Before(cutoff)
+			tooLarge := r.MaxBytes > 0 && bytes > r.MaxBytes
+			if !tooOld && !tooLarge {
+				break
+			}
+
+			batch.Delete(iter.Key())
+			first = item.Offset + 1
+			bytes -= uint64(len(item.Value))
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil || batch.Len() == 0 {
+			return trimmed, err
+		}
+
+		t.putMeta(batch, first, t.next, bytes)
+		if err = t.db.Write(batch, nil); err != nil {
+			return trimmed, err
+		}
+		trimmed += batch.Len() - 1
+		t.first, t.bytes = first, bytes
+	}
+
+	return trimmed, nil
+}
+
+// readItems returns up to max items starting at the given offset.
+func (t *Topic) readItems(offset uint64, max int) ([]*TopicItem, error) {
+	if offset < t.first {
+		offset = t.first
+	}
+
+	iter := t.db.NewIterator(&util.Range{Start: topicItemKey(offset), Limit: topicItemKey(t.next)}, nil)
+	defer iter.Release()
+
+	var items []*TopicItem
+	for len(items) < max && iter.Next() {
+		item, err := decodeTopicItem(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, iter.Error()
+}
+
+// getOffset returns the committed offset of the given consumer group,
+// moved up to the head of the topic if it was trimmed.
+func (t *Topic) getOffset(group string) (uint64, error) {
+	data, err := t.db.Get(topicGroupKey(group), nil)
+	if err == leveldb.ErrNotFound {
+		return t.first, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if len(data) != 8 {
+		return 0, ErrInvalidRecord
+	}
+	offset := binary.BigEndian.Uint64(data)
+	if offset < t.first {
+		offset = t.first
+	}
+
+	return offset, nil
+}
+
+// putMeta adds the first and next offsets and the size of the values of
+// the topic to the batch.
+func (t *Topic) putMeta(batch *leveldb.Batch, first, next, bytes uint64) {
+	// first + next + bytes = 8 + 8 + 8
+	data := make([]byte, 24)
+	binary.BigEndian.PutUint64(data[0:8], first)
+	binary.BigEndian.PutUint64(data[8:16], next)
+	binary.BigEndian.PutUint64(data[16:24], bytes)
+	batch.Put(topicMetaKey, data)
+}
+
+// init initializes the topic data.
+func (t *Topic) init() error {
+	data, err := t.db.Get(topicMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 24 {
+		return ErrInvalidRecord
+	}
+	t.first = binary.BigEndian.Uint64(data[0:8])
+	t.next = binary.BigEndian.Uint64(data[8:16])
+	t.bytes = binary.BigEndian.Uint64(data[16:24])
+
+	return nil
+}
+
+// topicItemKey creates the key of the item with the given offset.
+func topicItemKey(offset uint64) []byte {
+	// prefix + offset = 1 + 8
+	key := make([]byte, 9)
+	key[0] = topicItemPrefix[0]
+	binary.BigEndian.PutUint64(key[1:], offset)
+	return key
+}
+
+// topicGroupKey creates the key of the offset of the given consumer
+// group.
+func topicGroupKey(group string) []byte {
+	key := make([]byte, 0, 1+len(group))
+	key = append(key, topicGroupPrefix...)
+	return append(key, group...)
+}
+
+// encodeTopicItem returns the stored value of the given item, its
+// timestamp followed by its value.
+func encodeTopicItem(item *TopicItem) []byte {
+	// timestamp + value = 8 + value
+	data := make([]byte, 8+len(item.Value))
+	binary.BigEndian.PutUint64(data[0:8], uint64(item.Timestamp.UnixNano()))
+	copy(data[8:], item.Value)
+	return data
+}
+
+// decodeTopicItem returns the item stored under the given key.
+func decodeTopicItem(key, data []byte) (*TopicItem, error) {
+	if len(key) != 9 || len(data) < 8 {
+		return nil, ErrInvalidRecord
+	}
+
+	return &TopicItem{
+		Offset:    binary.BigEndian.Uint64(key[1:]),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(data[0:8]))),
+		Value:     append([]byte(nil), data[8:]...),
+	}, nil
+}
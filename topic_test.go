@@ -0,0 +1,156 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTopicConsumerGroups(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	topic, err := OpenTopic(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer topic.ForceDrop()
+
+	for i := 0; i < 5; i++ {
+		item, err := topic.AppendString(fmt.Sprintf("value%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Offset != uint64(i) {
+			t.Errorf("Expected offset %d, got %d", i, item.Offset)
+		}
+	}
+
+	// Each group reads at its own pace.
+	items, err := topic.Fetch("billing", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].ToString() != "value0" {
+		t.Fatalf("Expected 3 items from value0, got %d", len(items))
+	}
+	if err = topic.Commit("billing", items[2].Offset+1); err != nil {
+		t.Fatal(err)
+	}
+	if items, err = topic.Fetch("search", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ToString() != "value0" {
+		t.Errorf("Expected the other group to start at value0, got %d items", len(items))
+	}
+
+	// Items are not removed by reads.
+	if topic.Length() != 5 {
+		t.Errorf("Expected topic length of 5, got %d", topic.Length())
+	}
+
+	// The offsets persist.
+	if err = topic.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if topic, err = OpenTopic(file); err != nil {
+		t.Fatal(err)
+	}
+	if items, err = topic.Fetch("billing", 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ToString() != "value3" {
+		t.Errorf("Expected 2 items from value3, got %d", len(items))
+	}
+	if groups, err := topic.Groups(); err != nil || len(groups) != 1 || groups[0] != "billing" {
+		t.Errorf("Expected the billing group, got %v and %v", groups, err)
+	}
+
+	// A group can rewind to replay items.
+	if err = topic.Commit("billing", 1); err != nil {
+		t.Fatal(err)
+	}
+	if offset, err := topic.Committed("billing"); err != nil || offset != 1 {
+		t.Errorf("Expected offset 1, got %d and %v", offset, err)
+	}
+	if err = topic.Commit("billing", 6); err != ErrOutOfBounds {
+		t.Errorf("Expected ErrOutOfBounds, got %v", err)
+	}
+	if items, err = topic.Fetch("billing", 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Errorf("Expected 4 items, got %d", len(items))
+	}
+
+	// Fetching at the end returns no items.
+	if err = topic.Commit("billing", topic.NextOffset()); err != nil {
+		t.Fatal(err)
+	}
+	if items, err = topic.Fetch("billing", 10); err != nil || len(items) != 0 {
+		t.Errorf("Expected no items, got %d and %v", len(items), err)
+	}
+}
+
+func TestTopicRetention(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	topic, err := OpenTopic(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer topic.ForceDrop()
+
+	value := bytes.Repeat([]byte{'x'}, 10)
+	for i := 0; i < 10; i++ {
+		if _, err = topic.Append(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = topic.Commit("slow", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trim down to 50 bytes of values.
+	if err = topic.SetRetention(Retention{MaxBytes: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if topic.Length() != 5 || topic.FirstOffset() != 5 {
+		t.Errorf("Expected 5 items from offset 5, got %d from %d", topic.Length(), topic.FirstOffset())
+	}
+	if _, err = topic.Read(4, 1); err != ErrOffsetTrimmed {
+		t.Errorf("Expected ErrOffsetTrimmed, got %v", err)
+	}
+
+	// A group behind the head skips the trimmed items.
+	if offset, err := topic.Committed("slow"); err != nil || offset != 5 {
+		t.Errorf("Expected offset 5, got %d and %v", offset, err)
+	}
+
+	// Appending keeps the size within the limit.
+	if _, err = topic.Append(value); err != nil {
+		t.Fatal(err)
+	}
+	if topic.Length() != 5 || topic.FirstOffset() != 6 {
+		t.Errorf("Expected 5 items from offset 6, got %d from %d", topic.Length(), topic.FirstOffset())
+	}
+
+	// Trim every item older than the limit.
+	time.Sleep(20 * time.Millisecond)
+	if err = topic.SetRetention(Retention{MaxAge: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if topic.Length() != 0 || topic.FirstOffset() != 11 {
+		t.Errorf("Expected no items from offset 11, got %d from %d", topic.Length(), topic.FirstOffset())
+	}
+	if n, err := topic.Trim(); err != nil || n != 0 {
+		t.Errorf("Expected nothing left to trim, got %d and %v", n, err)
+	}
+
+	// The offsets keep increasing.
+	item, err := topic.Append(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Offset != 11 {
+		t.Errorf("Expected offset 11, got %d", item.Offset)
+	}
+}
@@ -0,0 +1,100 @@
+package goque
+
+// transferPrefix is the key prefix used to persist the items of
+// transfers in progress. Its second byte is not prefixSep, so it can
+// never collide with the key of an item in any priority level.
+var transferPrefix = []byte("goque:xfer:")
+
+// Transfer removes the next item in the source priority queue and adds
+// it to the destination, such as a dead letter queue or a stack,
+// returning the item removed from the source.
+//
+// Every Goque data structure has a database of its own, so the item
+// can't be moved in a single write. Instead, it is first moved into a
+// journal record in the source and only removed from there once the
+// destination holds it. If adding it to the destination fails, the
+// item is returned to the head of its priority level. If the process
+// exits halfway, the item is returned when the source is next opened,
+// so it is never lost, although it may then end up in both.
+func Transfer(src *PriorityQueue, dst Queuer) (*PriorityItem, error) {
+	return src.transfer(dst, nil)
+}
+
+// transfer removes the next item in the priority queue and adds it to
+// the destination like Transfer, adding the item returned by fn instead
+// if fn is set. If fn returns a nil item, nothing is added and the item
+// is removed all the same.
+func (src *PriorityQueue) transfer(dst Queuer, fn PipeFunc) (*PriorityItem, error) {
+	// Move the next item into a journal record.
+	src.Lock()
+	if !src.isOpen {
+		src.Unlock()
+		return nil, ErrDBClosed
+	}
+	record, err := src.takeNext(transferPrefix, 0)
+	src.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the item to the destination, giving fn a copy so the item put
+	// back on failure is left as it was.
+	item, out := record.Item, record.Item
+	var werr error
+	if fn != nil {
+		in := *item
+		in.Headers = cloneHeaders(item.Headers)
+		out, werr = fn(&in)
+	}
+	if werr == nil && out != nil {
+		werr = dst.copyItems([]*PriorityItem{out})
+	}
+
+	src.Lock()
+	defer src.Unlock()
+
+	// If the source was closed in the meantime, the record is handled
+	// when it is next opened.
+	if !src.isOpen {
+		if werr != nil {
+			return nil, werr
+		}
+		return item, ErrDBClosed
+	}
+
+	// Put the item back if the destination failed.
+	key := tokenKey(transferPrefix, record.Token)
+	if werr != nil {
+		if err = src.restoreItem(item, key, true); err != nil {
+			return nil, err
+		}
+		return nil, werr
+	}
+
+	// Clear the journal record.
+	if err = src.db.Delete(key, src.wo); err != nil {
+		return item, err
+	}
+
+	return item, nil
+}
+
+// recoverTransfers returns the items of transfers that were interrupted
+// to the head of their priority levels.
+func (pq *PriorityQueue) recoverTransfers() error {
+	records, err := pq.getRecords(transferPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err = pq.restoreItem(record.Item, tokenKey(transferPrefix, record.Token), true); err != nil {
+			return err
+		}
+	}
+	if len(records) > 0 {
+		pq.log.warn("goque: Returned the items of interrupted transfers", "dir", pq.DataDir, "items", len(records))
+	}
+
+	return nil
+}
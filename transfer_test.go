@@ -0,0 +1,172 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTransfer(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := Transfer(pq, s)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", item.ToString())
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	if s.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", s.Length())
+	}
+
+	popItem, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if popItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", popItem.ToString())
+	}
+
+	// No journal record is left behind.
+	records, err := pq.getRecords(transferPrefix)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(records) != 0 {
+		t.Errorf("Expected 0 transfer records, got %d", len(records))
+	}
+}
+
+func TestTransferEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dlq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dlq.ForceDrop()
+
+	if _, err = Transfer(pq, dlq); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestTransferFailed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// A closed destination fails the transfer.
+	s.Close()
+	if _, err = Transfer(pq, s); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error, got %v", err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", deqItem.ToString())
+	}
+}
+
+func TestTransferRecover(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Start a transfer and stop before the item reaches a destination.
+	pq.Lock()
+	_, err = pq.takeNext(transferPrefix, 0)
+	pq.Unlock()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	// Reopen the priority queue.
+	pq.Close()
+	if pq, err = OpenPriorityQueue(file, ASC); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", deqItem.ToString())
+	}
+}
@@ -0,0 +1,223 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Tx is a transaction on a priority queue. Its operations are collected
+// in a single LevelDB batch and either all take effect on Commit or
+// none do.
+//
+// The priority queue is locked from Begin until the transaction is
+// committed or rolled back, so the priority queue itself must not be
+// used in the meantime.
+type Tx struct {
+	pq      *PriorityQueue
+	batch   *leveldb.Batch
+	levels  [256]priorityLevel
+	seq     uint64
+	pending map[string]*PriorityItem
+	adds    []*PriorityItem
+	removes []*PriorityItem
+	added   uint64
+	addSize uint64
+	removed uint64
+	remSize uint64
+	done    bool
+}
+
+// Begin starts a new transaction on the priority queue.
+func (pq *PriorityQueue) Begin() (*Tx, error) {
+	pq.Lock()
+
+	// If the priority queue is closed.
+	if !pq.isOpen {
+		pq.Unlock()
+		return nil, ErrDBClosed
+	}
+
+	// Return items with expired leases first.
+	if err := pq.reclaimDue(); err != nil {
+		pq.Unlock()
+		return nil, err
+	}
+
+	tx := &Tx{
+		pq:      pq,
+		batch:   new(leveldb.Batch),
+		seq:     pq.seq,
+		pending: make(map[string]*PriorityItem),
+	}
+	for i, level := range pq.levels {
+		tx.levels[i] = *level
+	}
+
+	return tx, nil
+}
+
+// Enqueue adds an item to the priority queue when the transaction is
+// committed. The ID and key of the item are set right away.
+func (tx *Tx) Enqueue(item *PriorityItem) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	// Make sure the item isn't too large. The capacity is checked on
+	// commit.
+	if err := tx.pq.bounds.checkValue(uint64(len(item.Value))); err != nil {
+		return err
+	}
+
+	// Get the priorityLevel.
+	level := &tx.levels[item.Priority]
+
+	// Set item ID, key and sequence number.
+	item.ID = level.tail + 1
+	item.Key = tx.pq.generateKey(item.Priority, item.ID)
+	seq := tx.pq.stampItemsFrom(tx.seq, tx.batch, item)
+	value, err := tx.pq.encodeValue(item)
+	if err != nil {
+		return err
+	}
+	tx.seq = seq
+	tx.batch.Put(item.Key, value)
+
+	level.tail++
+	tx.pending[string(item.Key)] = item
+	tx.adds = append(tx.adds, item)
+	tx.added++
+	tx.addSize += uint64(len(item.Value))
+
+	return nil
+}
+
+// Dequeue removes the next item in the priority queue, including the
+// items enqueued earlier in the transaction, when the transaction is
+// committed.
+func (tx *Tx) Dequeue() (*PriorityItem, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	// Find the most important priority level with items.
+	var level *priorityLevel
+	var priority uint8
+	for i := 0; i <= 255; i++ {
+		p := uint8(i)
+		if tx.pq.order == DESC {
+			p = uint8(255 - i)
+		}
+		if tx.levels[p].length() > 0 {
+			level, priority = &tx.levels[p], p
+			break
+		}
+	}
+	if level == nil {
+		return nil, ErrEmpty
+	}
+
+	// Get the item, which may have been enqueued in this transaction.
+	key := tx.pq.generateKey(priority, level.head+1)
+	item, ok := tx.pending[string(key)]
+	if ok {
+		delete(tx.pending, string(key))
+	} else {
+		data, err := tx.pq.db.Get(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if item, err = tx.pq.decodeItem(key, data); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.batch.Delete(key)
+	level.head++
+	level.trim()
+	tx.removes = append(tx.removes, item)
+	tx.removed++
+	tx.remSize += uint64(len(item.Value))
+
+	return item, nil
+}
+
+// Commit applies the operations of the transaction to the priority
+// queue. If the priority queue has a capacity, the transaction must not
+// take it over its limits, whatever the overflow policy, or ErrFull is
+// returned and nothing is applied.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	pq := tx.pq
+	defer pq.Unlock()
+
+	// Make sure the items fit.
+	var n, size uint64
+	if tx.added > tx.removed {
+		n = tx.added - tx.removed
+	}
+	if tx.addSize > tx.remSize {
+		size = tx.addSize - tx.remSize
+	}
+	if pq.bounds != nil && !pq.bounds.fits(pq.Length(), n, size) {
+		return ErrFull
+	}
+
+	// Apply the operations.
+	for i := range tx.levels {
+		if tx.levels[i].head != pq.levels[i].head || tx.levels[i].tail != pq.levels[i].tail {
+			putLevelMeta(tx.batch, uint8(i), tx.levels[i])
+		}
+	}
+	err := pq.write(tx.batch, changeOf(ChangeEnqueue, tx.adds...), changeOf(ChangeDequeue, tx.removes...))
+	if err != nil {
+		return err
+	}
+
+	pq.seq = tx.seq
+	before := pq.active
+	for i := range pq.levels {
+		*pq.levels[i] = tx.levels[i]
+		pq.updateActive(uint8(i))
+	}
+	pq.bounds.add(tx.addSize)
+	pq.bounds.remove(tx.remSize)
+	pq.compact.deleted(pq.db, pq.log, tx.removed, tx.remSize)
+	pq.counters.Enqueued += tx.added
+	pq.counters.Dequeued += tx.removed
+	firePriority(pq.hooks.OnEnqueue, tx.adds...)
+	firePriority(pq.hooks.OnDequeue, tx.removes...)
+
+	// Find the new current priority level.
+	pq.resetCurrentLevel()
+	for _, priority := range pq.active.levels() {
+		if pq.cmpAsc(priority) || pq.cmpDesc(priority) {
+			pq.curLevel = priority
+		}
+	}
+
+	if tx.added > 0 {
+		pq.signalAdded(before)
+	}
+
+	// Apply the retention policy.
+	_, err = pq.trim(time.Now())
+	return err
+}
+
+// Rollback discards the operations of the transaction. If the
+// transaction has already been committed or rolled back, ErrTxDone is
+// returned, so Rollback can always be deferred.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.pq.Unlock()
+
+	return nil
+}
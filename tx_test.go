@@ -0,0 +1,186 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTxCommit(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.Enqueue(NewPriorityItemString("existing item", 3)); err != nil {
+		t.Error(err)
+	}
+
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tx.Rollback()
+
+	for i := 1; i <= 3; i++ {
+		if err = tx.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 1)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The items enqueued in the transaction are dequeued first.
+	deqItem, err := tx.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", deqItem.ToString())
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	deqItem, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 2" {
+		t.Errorf("Expected string to be 'value for item 2', got '%s'", deqItem.ToString())
+	}
+
+	if deqItem.Seq != 3 {
+		t.Errorf("Expected sequence number to be 3, got %d", deqItem.Seq)
+	}
+
+	if err = tx.Commit(); err != ErrTxDone {
+		t.Errorf("Expected to get transaction done error, got %v", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if err = pq.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), uint8(i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+
+	deqItem, err := tx.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", deqItem.ToString())
+	}
+
+	if err = tx.Enqueue(NewPriorityItemString("value for item 4", 4)); err != nil {
+		t.Error(err)
+	}
+
+	if err = tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", pq.Length())
+	}
+
+	deqItem, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", deqItem.ToString())
+	}
+
+	if _, err = tx.Dequeue(); err != ErrTxDone {
+		t.Errorf("Expected to get transaction done error, got %v", err)
+	}
+}
+
+func TestTxEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestTxCapacity(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	if err = pq.SetCapacity(Capacity{MaxItems: 2, Policy: OverflowBlock}); err != nil {
+		t.Error(err)
+	}
+
+	tx, err := pq.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if err = tx.Enqueue(NewPriorityItemString(fmt.Sprintf("value for item %d", i), 0)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = tx.Commit(); err != ErrFull {
+		t.Errorf("Expected to get full error, got %v", err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestTxClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+	pq.Close()
+
+	if _, err = pq.Begin(); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error, got %v", err)
+	}
+}
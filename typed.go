@@ -0,0 +1,189 @@
+//go:build go1.18
+// +build go1.18
+
+package goque
+
+// TypedQueue wraps a Queue, encoding and decoding values of type T
+// using a Codec.
+type TypedQueue[T any] struct {
+	q     *Queue
+	codec Codec
+}
+
+// NewTypedQueue creates a TypedQueue storing values in the given queue
+// using the given codec.
+func NewTypedQueue[T any](q *Queue, codec Codec) *TypedQueue[T] {
+	return &TypedQueue[T]{q: q, codec: codec}
+}
+
+// Enqueue adds a value to the queue.
+func (tq *TypedQueue[T]) Enqueue(v T) error {
+	data, err := tq.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tq.q.Enqueue(NewItem(data))
+}
+
+// Dequeue removes the next value in the queue and returns it.
+func (tq *TypedQueue[T]) Dequeue() (T, error) {
+	item, err := tq.q.Dequeue()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](tq.codec, item.Value)
+}
+
+// Peek returns the next value in the queue without removing it.
+func (tq *TypedQueue[T]) Peek() (T, error) {
+	item, err := tq.q.Peek()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](tq.codec, item.Value)
+}
+
+// Length returns the total number of values in the queue.
+func (tq *TypedQueue[T]) Length() uint64 {
+	return tq.q.Length()
+}
+
+// Queue returns the wrapped queue.
+func (tq *TypedQueue[T]) Queue() *Queue {
+	return tq.q
+}
+
+// TypedStack wraps a Stack, encoding and decoding values of type T
+// using a Codec.
+type TypedStack[T any] struct {
+	s     *Stack
+	codec Codec
+}
+
+// NewTypedStack creates a TypedStack storing values in the given stack
+// using the given codec.
+func NewTypedStack[T any](s *Stack, codec Codec) *TypedStack[T] {
+	return &TypedStack[T]{s: s, codec: codec}
+}
+
+// Push adds a value to the stack.
+func (ts *TypedStack[T]) Push(v T) error {
+	data, err := ts.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ts.s.Push(NewItem(data))
+}
+
+// Pop removes the next value in the stack and returns it.
+func (ts *TypedStack[T]) Pop() (T, error) {
+	item, err := ts.s.Pop()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](ts.codec, item.Value)
+}
+
+// Peek returns the next value in the stack without removing it.
+func (ts *TypedStack[T]) Peek() (T, error) {
+	item, err := ts.s.Peek()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](ts.codec, item.Value)
+}
+
+// Length returns the total number of values in the stack.
+func (ts *TypedStack[T]) Length() uint64 {
+	return ts.s.Length()
+}
+
+// Stack returns the wrapped stack.
+func (ts *TypedStack[T]) Stack() *Stack {
+	return ts.s
+}
+
+// TypedPriorityQueue wraps a PriorityQueue, encoding and decoding
+// values of type T using a Codec.
+type TypedPriorityQueue[T any] struct {
+	pq    *PriorityQueue
+	codec Codec
+}
+
+// NewTypedPriorityQueue creates a TypedPriorityQueue storing values in
+// the given priority queue using the given codec.
+func NewTypedPriorityQueue[T any](pq *PriorityQueue, codec Codec) *TypedPriorityQueue[T] {
+	return &TypedPriorityQueue[T]{pq: pq, codec: codec}
+}
+
+// Enqueue adds a value to the priority queue with the given priority.
+func (tpq *TypedPriorityQueue[T]) Enqueue(v T, priority uint8) error {
+	data, err := tpq.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tpq.pq.Enqueue(NewPriorityItem(data, priority))
+}
+
+// Dequeue removes the next value in the priority queue and returns it.
+func (tpq *TypedPriorityQueue[T]) Dequeue() (T, error) {
+	item, err := tpq.pq.Dequeue()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](tpq.codec, item.Value)
+}
+
+// DequeueByPriority removes the next value in the given priority level
+// and returns it.
+func (tpq *TypedPriorityQueue[T]) DequeueByPriority(priority uint8) (T, error) {
+	item, err := tpq.pq.DequeueByPriority(priority)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](tpq.codec, item.Value)
+}
+
+// Peek returns the next value in the priority queue without removing
+// it.
+func (tpq *TypedPriorityQueue[T]) Peek() (T, error) {
+	item, err := tpq.pq.Peek()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return decodeTyped[T](tpq.codec, item.Value)
+}
+
+// Length returns the total number of values in the priority queue.
+func (tpq *TypedPriorityQueue[T]) Length() uint64 {
+	return tpq.pq.Length()
+}
+
+// PriorityQueue returns the wrapped priority queue.
+func (tpq *TypedPriorityQueue[T]) PriorityQueue() *PriorityQueue {
+	return tpq.pq
+}
+
+// decodeTyped decodes the given item value into a value of type T.
+func decodeTyped[T any](codec Codec, data []byte) (T, error) {
+	var v T
+	err := codec.Unmarshal(data, &v)
+	return v, err
+}
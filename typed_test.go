@@ -0,0 +1,114 @@
+//go:build go1.18
+// +build go1.18
+
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTypedQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.ForceDrop()
+
+	tq := NewTypedQueue[object](q, JSONCodec{})
+	for i := 1; i <= 2; i++ {
+		if err = tq.Enqueue(object{Name: "value", Count: i}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if tq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", tq.Length())
+	}
+
+	for i := 1; i <= 2; i++ {
+		obj, err := tq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if obj.Count != i {
+			t.Errorf("Expected count to be %d, got %d", i, obj.Count)
+		}
+	}
+
+	if _, err = tq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestTypedStack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.ForceDrop()
+
+	ts := NewTypedStack[string](s, GobCodec{})
+	for _, v := range []string{"first", "second"} {
+		if err = ts.Push(v); err != nil {
+			t.Error(err)
+		}
+	}
+
+	v, err := ts.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if v != "second" {
+		t.Errorf("Expected value to be 'second', got '%s'", v)
+	}
+
+	if v, err = ts.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	if v != "second" {
+		t.Errorf("Expected value to be 'second', got '%s'", v)
+	}
+}
+
+func TestTypedPriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.ForceDrop()
+
+	tpq := NewTypedPriorityQueue[int](pq, JSONCodec{})
+	for i, priority := range []uint8{2, 0, 1} {
+		if err = tpq.Enqueue(i, priority); err != nil {
+			t.Error(err)
+		}
+	}
+
+	v, err := tpq.DequeueByPriority(2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if v != 0 {
+		t.Errorf("Expected value to be 0, got %d", v)
+	}
+
+	for _, compV := range []int{1, 2} {
+		v, err := tpq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if v != compV {
+			t.Errorf("Expected value to be %d, got %d", compV, v)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package goque
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// uniqueMetaKey is the key used to persist the metadata of a unique
+// queue. The keys of the order and of the items start with a lower
+// byte, so they never collide with it.
+var uniqueMetaKey = []byte{0xFF}
+
+// The prefixes of the keys of a unique queue. The order holds the key
+// of each item under its ID, and the items hold their ID and value
+// under their key.
+var (
+	uniqueOrderPrefix = []byte{0x00}
+	uniqueItemPrefix  = []byte{0x01}
+)
+
+// UniqueItem represents an entry in a unique queue.
+type UniqueItem struct {
+	ID    uint64
+	Key   []byte
+	Value []byte
+}
+
+// ToString returns the unique item value as a string.
+func (ui *UniqueItem) ToString() string {
+	return string(ui.Value)
+}
+
+// UniqueQueue is a FIFO queue where every item has a key given by the
+// caller, and each key has at most one pending item. It suits work that
+// only needs doing once however many times it is requested before it
+// is done, such as refreshing a cache entry.
+type UniqueQueue struct {
+	sync.RWMutex
+	DataDir string
+	db      *leveldb.DB
+	lastID  uint64
+	length  uint64
+	isOpen  bool
+}
+
+// OpenUniqueQueue opens a unique queue if one exists at the given
+// directory. If one does not already exist, a new unique queue is
+// created.
+func OpenUniqueQueue(dataDir string) (*UniqueQueue, error) {
+	var err error
+
+	// Create a new UniqueQueue.
+	uq := &UniqueQueue{
+		DataDir: dataDir,
+		db:      &leveldb.DB{},
+		isOpen:  false,
+	}
+
+	// Open database for the unique queue.
+	uq.db, err = leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return uq, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	ok, err := checkGoqueType(dataDir, goqueUniqueQueue)
+	if err != nil {
+		return uq, err
+	}
+	if !ok {
+		return uq, ErrIncompatibleType
+	}
+
+	// Upgrade the data directory to the current layout.
+	if err = migrate(dataDir, uq.db, goqueUniqueQueue); err != nil {
+		return uq, err
+	}
+
+	// Set isOpen and return.
+	uq.isOpen = true
+	return uq, uq.init()
+}
+
+// Enqueue adds an item with the given key and value to the back of the
+// unique queue. If the key already has a pending item, nothing is done
+// and ErrDuplicateKey is returned.
+func (uq *UniqueQueue) Enqueue(key, value []byte) (*UniqueItem, error) {
+	uq.Lock()
+	defer uq.Unlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	_, err := uq.getItem(key)
+	if err == nil {
+		return nil, ErrDuplicateKey
+	} else if err != ErrItemNotFound {
+		return nil, err
+	}
+
+	return uq.add(key, value)
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a key and
+// a value as strings rather than byte slices.
+func (uq *UniqueQueue) EnqueueString(key, value string) (*UniqueItem, error) {
+	return uq.Enqueue([]byte(key), []byte(value))
+}
+
+// EnqueueOrUpdate adds an item with the given key and value to the back
+// of the unique queue, or replaces the value of the pending item of the
+// key, keeping its position. It returns the item, and reports whether
+// it was added.
+func (uq *UniqueQueue) EnqueueOrUpdate(key, value []byte) (*UniqueItem, bool, error) {
+	uq.Lock()
+	defer uq.Unlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, false, ErrDBClosed
+	}
+
+	item, err := uq.getItem(key)
+	if err == ErrItemNotFound {
+		item, err = uq.add(key, value)
+		return item, err == nil, err
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	item.Value = value
+	if err = uq.db.Put(uniqueItemKey(key), encodeUniqueItem(item), nil); err != nil {
+		return nil, false, err
+	}
+
+	return item, false, nil
+}
+
+// Dequeue removes the item at the front of the unique queue and returns
+// it. Its key can be enqueued again right away.
+func (uq *UniqueQueue) Dequeue() (*UniqueItem, error) {
+	uq.Lock()
+	defer uq.Unlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the next item in the unique queue.
+	item, err := uq.getNextItem()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = uq.removeItem(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// Peek returns the item at the front of the unique queue without
+// removing it.
+func (uq *UniqueQueue) Peek() (*UniqueItem, error) {
+	uq.RLock()
+	defer uq.RUnlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return uq.getNextItem()
+}
+
+// Get returns the pending item of the given key, or ErrItemNotFound if
+// it has none.
+func (uq *UniqueQueue) Get(key []byte) (*UniqueItem, error) {
+	uq.RLock()
+	defer uq.RUnlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return uq.getItem(key)
+}
+
+// Remove removes the pending item of the given key from the unique
+// queue, wherever it is, and returns it. If the key has no pending
+// item, ErrItemNotFound is returned.
+func (uq *UniqueQueue) Remove(key []byte) (*UniqueItem, error) {
+	uq.Lock()
+	defer uq.Unlock()
+
+	// If the unique queue is closed.
+	if !uq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	item, err := uq.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = uq.removeItem(item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// Length returns the total number of items in the unique queue.
+func (uq *UniqueQueue) Length() uint64 {
+	return uq.length
+}
+
+// Close closes the LevelDB database of the unique queue. Once closed,
+// every operation on the unique queue returns ErrDBClosed.
+func (uq *UniqueQueue) Close() error {
+	_, err := uq.closeIf(nil)
+	return err
+}
+
+// closeIf closes the unique queue like Close once check, if not nil, returns
+// nil, calling it under the same lock so nothing changes the unique queue in
+// between. If check fails, the unique queue is left as it is and the error is
+// returned. closeIf reports whether the unique queue is closed.
+func (uq *UniqueQueue) closeIf(check func() error) (bool, error) {
+	uq.Lock()
+	defer uq.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
+	}
+
+	// If unique queue is already closed.
+	if !uq.isOpen {
+		return true, nil
+	}
+	uq.isOpen = false
+
+	return true, uq.db.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the unique queue, as
+// long as it holds no items. Otherwise nothing is done and ErrNotEmpty
+// is returned.
+func (uq *UniqueQueue) Drop() error {
+	return dropIf(uq.DataDir, uq.closeIf, checkEmpty(uq.Length))
+}
+
+// ForceDrop closes and deletes the LevelDB database of the unique
+// queue, along with any items it still holds.
+func (uq *UniqueQueue) ForceDrop() error {
+	err := uq.Close()
+	if rerr := os.RemoveAll(uq.DataDir); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// add adds an item with the given key and value to the back of the
+// unique queue, updating the metadata. The caller must hold the lock.
+func (uq *UniqueQueue) add(key, value []byte) (*UniqueItem, error) {
+	item := &UniqueItem{ID: uq.lastID + 1, Key: key, Value: value}
+
+	batch := new(leveldb.Batch)
+	batch.Put(uniqueOrderKey(item.ID), key)
+	batch.Put(uniqueItemKey(key), encodeUniqueItem(item))
+	uq.putMeta(batch, item.ID, uq.length+1)
+	if err := uq.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	uq.lastID++
+	uq.length++
+
+	return item, nil
+}
+
+// removeItem removes the given item from the unique queue, updating the
+// metadata. The caller must hold the lock.
+func (uq *UniqueQueue) removeItem(item *UniqueItem) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(uniqueOrderKey(item.ID))
+	batch.Delete(uniqueItemKey(item.Key))
+	uq.putMeta(batch, uq.lastID, uq.length-1)
+	if err := uq.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	uq.length--
+
+	return nil
+}
+
+// getItem returns the pending item of the given key.
+func (uq *UniqueQueue) getItem(key []byte) (*UniqueItem, error) {
+	data, err := uq.db.Get(uniqueItemKey(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrItemNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeUniqueItem(key, data)
+}
+
+// getNextItem returns the item at the front of the unique queue using a
+// single iterator seek.
+func (uq *UniqueQueue) getNextItem() (*UniqueItem, error) {
+	if uq.length == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Create a new LevelDB Iterator over the order.
+	iter := uq.db.NewIterator(util.BytesPrefix(uniqueOrderPrefix), nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmpty
+	}
+
+	item, err := uq.getItem(iter.Value())
+	if err == ErrItemNotFound {
+		return nil, ErrInvalidRecord
+	}
+
+	return item, err
+}
+
+// putMeta adds the last assigned ID and the length of the unique queue
+// to the batch.
+func (uq *UniqueQueue) putMeta(batch *leveldb.Batch, lastID, length uint64) {
+	// lastID + length = 8 + 8
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[0:8], lastID)
+	binary.BigEndian.PutUint64(data[8:16], length)
+	batch.Put(uniqueMetaKey, data)
+}
+
+// init initializes the unique queue data.
+func (uq *UniqueQueue) init() error {
+	data, err := uq.db.Get(uniqueMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) != 16 {
+		return ErrInvalidRecord
+	}
+	uq.lastID = binary.BigEndian.Uint64(data[0:8])
+	uq.length = binary.BigEndian.Uint64(data[8:16])
+
+	return nil
+}
+
+// uniqueOrderKey creates the key of the given ID in the order of a
+// unique queue.
+func uniqueOrderKey(id uint64) []byte {
+	// prefix + id = 1 + 8
+	key := make([]byte, 9)
+	key[0] = uniqueOrderPrefix[0]
+	binary.BigEndian.PutUint64(key[1:], id)
+	return key
+}
+
+// uniqueItemKey creates the key the item of the given key is stored
+// under in a unique queue.
+func uniqueItemKey(key []byte) []byte {
+	out := make([]byte, 0, 1+len(key))
+	out = append(out, uniqueItemPrefix...)
+	return append(out, key...)
+}
+
+// encodeUniqueItem returns the stored value of the given item, its ID
+// followed by its value.
+func encodeUniqueItem(item *UniqueItem) []byte {
+	// id + value = 8 + value
+	data := make([]byte, 8+len(item.Value))
+	binary.BigEndian.PutUint64(data[0:8], item.ID)
+	copy(data[8:], item.Value)
+	return data
+}
+
+// decodeUniqueItem returns the item of the given key from its stored
+// value.
+func decodeUniqueItem(key, data []byte) (*UniqueItem, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidRecord
+	}
+
+	return &UniqueItem{
+		ID:    binary.BigEndian.Uint64(data[0:8]),
+		Key:   append([]byte(nil), key...),
+		Value: data[8:],
+	}, nil
+}
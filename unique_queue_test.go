@@ -0,0 +1,164 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUniqueQueueEnqueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	uq, err := OpenUniqueQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uq.ForceDrop()
+
+	for _, key := range []string{"user:1", "user:2"} {
+		if _, err = uq.EnqueueString(key, "refresh "+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = uq.EnqueueString("user:1", "again"); err != ErrDuplicateKey {
+		t.Errorf("Expected ErrDuplicateKey, got %v", err)
+	}
+	if uq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", uq.Length())
+	}
+
+	// Updating keeps the position of the item.
+	item, added, err := uq.EnqueueOrUpdate([]byte("user:1"), []byte("updated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added || item.ID != 1 {
+		t.Errorf("Expected the item with ID 1 to be updated, got %v with ID %d", added, item.ID)
+	}
+	if _, added, err = uq.EnqueueOrUpdate([]byte("user:3"), []byte("new")); err != nil {
+		t.Fatal(err)
+	} else if !added {
+		t.Error("Expected an item to be added for a new key")
+	}
+
+	for _, want := range []string{"user:1=updated", "user:2=refresh user:2", "user:3=new"} {
+		item, err := uq.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(item.Key) + "=" + item.ToString(); got != want {
+			t.Errorf("Expected '%s', got '%s'", want, got)
+		}
+	}
+	if _, err = uq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, got %v", err)
+	}
+
+	// Once dequeued, a key can be enqueued again.
+	if _, err = uq.EnqueueString("user:1", "later"); err != nil {
+		t.Errorf("Expected the dequeued key to be enqueued again, got %v", err)
+	}
+}
+
+func TestUniqueQueueRemove(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	uq, err := OpenUniqueQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uq.ForceDrop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = uq.EnqueueString(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, err := uq.Remove([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ToString() != "value1" {
+		t.Errorf("Expected 'value1', got '%s'", item.ToString())
+	}
+	if _, err = uq.Remove([]byte("key1")); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got %v", err)
+	}
+	if _, err = uq.Get([]byte("key1")); err != ErrItemNotFound {
+		t.Errorf("Expected ErrItemNotFound, got %v", err)
+	}
+	if item, err = uq.Get([]byte("key3")); err != nil || item.ToString() != "value3" {
+		t.Errorf("Expected 'value3', got %v", err)
+	}
+
+	// The length and the order persist.
+	if err = uq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if uq, err = OpenUniqueQueue(file); err != nil {
+		t.Fatal(err)
+	}
+	if uq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", uq.Length())
+	}
+	if item, err = uq.Peek(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(item.Key, []byte("key2")) || item.ID != 2 {
+		t.Errorf("Expected key2 with ID 2, got %s with ID %d", item.Key, item.ID)
+	}
+	if item, err = uq.EnqueueString("key4", "value4"); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 4 {
+		t.Errorf("Expected ID 4, got %d", item.ID)
+	}
+}
+
+func TestUniqueQueueIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.ForceDrop()
+	q.Close()
+
+	if _, err = OpenUniqueQueue(file); err != ErrIncompatibleType {
+		t.Errorf("Expected unique queue to return ErrIncompatibleType when opening a Queue, got %v", err)
+	}
+}
+
+func TestUniqueQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	uq, err := OpenUniqueQueue(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uq.ForceDrop()
+
+	if _, err = uq.EnqueueString("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = uq.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = Restore(&buf, file+"_restore"); err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := DataDirType(file + "_restore"); err != nil || typ != "unique queue" {
+		t.Errorf("Expected type 'unique queue', got '%s' and %v", typ, err)
+	}
+
+	dst, err := OpenUniqueQueue(file + "_restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.ForceDrop()
+
+	if _, err = dst.EnqueueString("key", "again"); err != ErrDuplicateKey {
+		t.Errorf("Expected ErrDuplicateKey, got %v", err)
+	}
+}